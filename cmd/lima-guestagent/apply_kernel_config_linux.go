@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/guestagent/kernelconfig"
+	"github.com/spf13/cobra"
+)
+
+func newApplyKernelConfigCommand() *cobra.Command {
+	applyKernelConfigCommand := &cobra.Command{
+		Use:   "apply-kernel-config FILE",
+		Short: "load the kernel modules and set the sysctl values of the instance",
+		Long: `Load the kernel modules and set the sysctl values of the instance (` + "`kernel.modules` and `sysctl`" + `).
+The FILE is "kernel-config.json" of the cidata. Used by the boot scripts.`,
+		Args: cobra.ExactArgs(1),
+		RunE: applyKernelConfigAction,
+	}
+	return applyKernelConfigCommand
+}
+
+func applyKernelConfigAction(cmd *cobra.Command, args []string) error {
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var cfg kernelconfig.Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+	return kernelconfig.Apply(cmd.Context(), &cfg)
+}
@@ -15,6 +15,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// guestAgentSocket is the UNIX socket of the guest agent.
+// The socket is accessible to all the users in the guest, for LimitProcess.
+const guestAgentSocket = "/run/lima-guestagent.sock"
+
 func newDaemonCommand() *cobra.Command {
 	daemonCommand := &cobra.Command{
 		Use:   "daemon",
@@ -28,7 +32,7 @@ func newDaemonCommand() *cobra.Command {
 }
 
 func daemonAction(cmd *cobra.Command, _ []string) error {
-	socket := "/run/lima-guestagent.sock"
+	socket := guestAgentSocket
 	tick, err := cmd.Flags().GetDuration("tick")
 	if err != nil {
 		return err
@@ -66,6 +70,7 @@ func daemonAction(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	guestServer := &server.GuestServer{Agent: agent, TunnelS: portfwdserver.NewTunnelServer()}
 	var l net.Listener
 	if virtioPort != "" {
 		qemuL, err := serialport.Listen("/dev/virtio-ports/" + virtioPort)
@@ -81,16 +86,35 @@ func daemonAction(cmd *cobra.Command, _ []string) error {
 		}
 		l = vsockL
 		logrus.Infof("serving the guest agent on vsock port: %d", vSockPort)
-	} else {
-		socketL, err := net.Listen("unix", socket)
-		if err != nil {
-			return err
-		}
-		if err := os.Chmod(socket, 0o777); err != nil {
-			return err
-		}
-		l = socketL
+	}
+	socketL, err := listenUnix(socket)
+	if err != nil {
+		return err
+	}
+	if l == nil {
 		logrus.Infof("serving the guest agent on %q", socket)
+		return server.StartServer(socketL, guestServer)
+	}
+	// Serve on the UNIX socket too, so that the host agent can fall back to the socket
+	// forwarded over SSH when the vsock connection is not available, and so that
+	// the processes in the guest can request LimitProcess.
+	logrus.Infof("serving the guest agent on %q too", socket)
+	go func() {
+		if err := server.StartServer(socketL, guestServer); err != nil {
+			logrus.WithError(err).Warnf("failed to serve the guest agent on %q", socket)
+		}
+	}()
+	return server.StartServer(l, guestServer)
+}
+
+func listenUnix(socket string) (net.Listener, error) {
+	socketL, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0o777); err != nil {
+		_ = socketL.Close()
+		return nil, err
 	}
-	return server.StartServer(l, &server.GuestServer{Agent: agent, TunnelS: portfwdserver.NewTunnelServer()})
+	return server.NewPeerCredListener(socketL), nil
 }
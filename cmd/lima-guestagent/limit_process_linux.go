@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/guestagent/api/client"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func newLimitProcessCommand() *cobra.Command {
+	limitProcessCommand := &cobra.Command{
+		Use:   "limit-process",
+		Short: "limit the resources of a process (the parent process by default), via the daemon",
+		Long: `Limit the resources of a process (the parent process by default), via the daemon.
+The process is moved into a transient systemd scope, and its children inherit the limits.
+Used by "limactl shell --cpu-limit --memory-limit --timeout".`,
+		Args: cobra.NoArgs,
+		RunE: limitProcessAction,
+	}
+	limitProcessCommand.Flags().Int("pid", os.Getppid(), "process to limit")
+	limitProcessCommand.Flags().Float64("cpus", 0, "CPU quota in the number of CPUs (0 for no limit)")
+	limitProcessCommand.Flags().Int64("memory-bytes", 0, "maximum memory usage in bytes (0 for no limit)")
+	limitProcessCommand.Flags().Duration("timeout", 0, "maximum run time; the processes are killed after it (0 for no limit)")
+	return limitProcessCommand
+}
+
+func limitProcessAction(cmd *cobra.Command, _ []string) error {
+	pid, err := cmd.Flags().GetInt("pid")
+	if err != nil {
+		return err
+	}
+	cpus, err := cmd.Flags().GetFloat64("cpus")
+	if err != nil {
+		return err
+	}
+	memoryBytes, err := cmd.Flags().GetInt64("memory-bytes")
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	req := &api.LimitProcessRequest{
+		Pid:         int32(pid),
+		Cpus:        cpus,
+		MemoryBytes: memoryBytes,
+	}
+	if timeout > 0 {
+		req.Timeout = durationpb.New(timeout)
+	}
+	cli, err := client.NewGuestAgentClient(func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", guestAgentSocket)
+	})
+	if err != nil {
+		return err
+	}
+	return cli.LimitProcess(cmd.Context(), req)
+}
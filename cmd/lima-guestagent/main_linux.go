@@ -33,6 +33,8 @@ func newApp() *cobra.Command {
 	rootCmd.AddCommand(
 		newDaemonCommand(),
 		newInstallSystemdCommand(),
+		newLimitProcessCommand(),
+		newApplyKernelConfigCommand(),
 	)
 	return rootCmd
 }
@@ -1,8 +1,11 @@
 @echo off
 REM Environment Variables
-REM LIMA_INSTANCE: Specifies the name of the Lima instance to use. Default is "default".
+REM LIMA_INSTANCE: Specifies the name of the Lima instance to use. Default is the instance set with "limactl default set", or "default".
 REM LIMACTL: Specifies the path to the limactl binary. Default is "limactl" in %PATH%.
 
 IF NOT DEFINED LIMACTL (SET LIMACTL=limactl)
+IF NOT DEFINED LIMA_INSTANCE (
+  FOR /F "usebackq delims=" %%i IN (`%LIMACTL% default show`) DO SET LIMA_INSTANCE=%%i
+)
 IF NOT DEFINED LIMA_INSTANCE (SET LIMA_INSTANCE=default)
 %LIMACTL% shell %LIMA_INSTANCE% %*
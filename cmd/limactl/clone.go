@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const cloneHelp = `Clone an instance
+
+The instance can be either stopped or running.
+A running instance is cloned from a crash-consistent snapshot of its disk, as if the power of the instance were cut.
+Specify --quiesce to freeze the filesystems of the guest via the guest agent while the snapshot is taken,
+so that the snapshot is consistent at the filesystem level too.
+The disk is copied with clonefile(2) on APFS and with reflinks on Btrfs and XFS, where available.
+
+The clone gets its own MAC addresses, VZ machine identifier, machine ID, and SSH host keys.
+The additional disks and the TPM state are not cloned.
+
+Example: limactl clone default default2
+`
+
+func newCloneCommand() *cobra.Command {
+	cloneCommand := &cobra.Command{
+		Use:               "clone OLDINST NEWINST",
+		Short:             "Clone an instance",
+		Long:              cloneHelp,
+		Args:              WrapArgsError(cobra.ExactArgs(2)),
+		RunE:              cloneAction,
+		ValidArgsFunction: cloneBashComplete,
+		GroupID:           advancedCommand,
+	}
+	cloneCommand.Flags().Bool("quiesce", false, "freeze the filesystems of the running instance while its disk is snapshotted")
+	return cloneCommand
+}
+
+func cloneAction(cmd *cobra.Command, args []string) error {
+	oldInstName, newInstName := args[0], args[1]
+	quiesce, err := cmd.Flags().GetBool("quiesce")
+	if err != nil {
+		return err
+	}
+	oldInst, err := store.Inspect(oldInstName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist", oldInstName)
+		}
+		return err
+	}
+	inst, err := instance.Clone(cmd.Context(), oldInst, newInstName, instance.CloneOptions{Quiesce: quiesce})
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Cloned instance %q as %q", oldInstName, inst.Name)
+	logrus.Infof("Run `limactl start %s` to start the instance.", inst.Name)
+	return nil
+}
+
+func cloneBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return bashCompleteInstanceNames(cmd)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	completionBlockBegin = "# >>> limactl completion >>>"
+	completionBlockEnd   = "# <<< limactl completion <<<"
+)
+
+// completionShells are the shells supported by `limactl completion install`.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// addCompletionInstallCommand adds `limactl completion install` to the default completion command of cobra.
+func addCompletionInstallCommand(rootCmd *cobra.Command) {
+	rootCmd.InitDefaultCompletionCmd()
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == "completion" {
+			c.AddCommand(newCompletionInstallCommand())
+			return
+		}
+	}
+}
+
+func newCompletionInstallCommand() *cobra.Command {
+	installCommand := &cobra.Command{
+		Use:   "install",
+		Short: "Install the autocompletion script into the shell startup file",
+		Long: `Install the autocompletion script into the startup file of the shell.
+
+The shell is detected from $SHELL (PowerShell on Windows), unless --shell is specified.
+The following files are updated:
+  bash:       ~/.bashrc (~/.bash_profile on macOS)
+  zsh:        ${ZDOTDIR:-~}/.zshrc
+  fish:       ~/.config/fish/completions/limactl.fish
+  powershell: $PROFILE
+
+The snippet is enclosed in the "` + completionBlockBegin + `" and "` + completionBlockEnd + `" lines,
+and is replaced when the command is run again, so running the command multiple times is safe.
+The snippet loads the completions from limactl on every start of the shell, so it does not need to be
+updated after upgrading Lima.
+
+Use --uninstall to remove the snippet.`,
+		Example: `  To install the completion for the current shell:
+  $ limactl completion install
+
+  To install the completion for zsh:
+  $ limactl completion install --shell zsh
+
+  To uninstall the completion:
+  $ limactl completion install --uninstall`,
+		Args:              WrapArgsError(cobra.NoArgs),
+		RunE:              completionInstallAction,
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+	installCommand.Flags().String("shell", "", fmt.Sprintf("shell, one of %v (default: detected from $SHELL)", completionShells))
+	_ = installCommand.RegisterFlagCompletionFunc("shell", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return completionShells, cobra.ShellCompDirectiveNoFileComp
+	})
+	installCommand.Flags().Bool("uninstall", false, "Remove the autocompletion script from the shell startup file")
+	return installCommand
+}
+
+func completionInstallAction(cmd *cobra.Command, _ []string) error {
+	shell, err := cmd.Flags().GetString("shell")
+	if err != nil {
+		return err
+	}
+	uninstall, err := cmd.Flags().GetBool("uninstall")
+	if err != nil {
+		return err
+	}
+	if shell == "" {
+		shell, err = detectShell()
+		if err != nil {
+			return err
+		}
+	}
+	file, snippet, err := completionSnippet(shell)
+	if err != nil {
+		return err
+	}
+	w := cmd.OutOrStdout()
+	content, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var updated string
+	if uninstall {
+		updated = removeCompletionBlock(string(content))
+	} else {
+		updated = updateCompletionBlock(string(content), snippet)
+	}
+	if updated == string(content) {
+		if uninstall {
+			fmt.Fprintf(w, "The %s completion is not installed in %q\n", shell, file)
+		} else {
+			fmt.Fprintf(w, "The %s completion is already installed in %q\n", shell, file)
+		}
+		return nil
+	}
+	switch {
+	case uninstall && strings.TrimSpace(updated) == "" && shell == "fish":
+		// The file is dedicated to limactl
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	default:
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte(updated), 0o644); err != nil {
+			return err
+		}
+	}
+	if uninstall {
+		fmt.Fprintf(w, "Uninstalled the %s completion from %q\n", shell, file)
+	} else {
+		fmt.Fprintf(w, "Installed the %s completion into %q; start a new shell to enable it\n", shell, file)
+	}
+	return nil
+}
+
+// detectShell detects the shell of the user from $SHELL.
+func detectShell() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "powershell", nil
+	}
+	s := os.Getenv("SHELL")
+	if s == "" {
+		return "", errors.New("failed to detect the shell from $SHELL; specify --shell")
+	}
+	name := filepath.Base(s)
+	switch name {
+	case "bash", "zsh", "fish":
+		return name, nil
+	case "pwsh", "powershell":
+		return "powershell", nil
+	}
+	return "", fmt.Errorf("unsupported shell %q; specify --shell (one of %v)", s, completionShells)
+}
+
+// completionSnippet returns the startup file of the shell, and the snippet to be installed into it.
+func completionSnippet(shell string) (file, snippet string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	switch shell {
+	case "bash":
+		file = filepath.Join(home, ".bashrc")
+		if runtime.GOOS == "darwin" {
+			// Terminal.app starts a login shell, which does not read ~/.bashrc
+			file = filepath.Join(home, ".bash_profile")
+		}
+		snippet = `if command -v limactl >/dev/null 2>&1; then
+  source <(limactl completion bash)
+fi`
+	case "zsh":
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		file = filepath.Join(dir, ".zshrc")
+		snippet = `if command -v limactl >/dev/null 2>&1; then
+  (( $+functions[compdef] )) || { autoload -Uz compinit && compinit }
+  source <(limactl completion zsh)
+fi`
+	case "fish":
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".config")
+		}
+		file = filepath.Join(dir, "fish", "completions", "limactl.fish")
+		snippet = `limactl completion fish | source`
+	case "powershell":
+		file, err = powerShellProfile(home)
+		if err != nil {
+			return "", "", err
+		}
+		snippet = `if (Get-Command limactl -ErrorAction SilentlyContinue) {
+  limactl completion powershell | Out-String | Invoke-Expression
+}`
+	default:
+		return "", "", fmt.Errorf("unsupported shell %q (expected one of %v)", shell, completionShells)
+	}
+	return file, snippet, nil
+}
+
+// powerShellProfile returns $PROFILE of PowerShell.
+func powerShellProfile(home string) (string, error) {
+	for _, exe := range []string{"pwsh", "powershell"} {
+		if _, err := exec.LookPath(exe); err != nil {
+			continue
+		}
+		out, err := exec.Command(exe, "-NoProfile", "-NonInteractive", "-Command", "$PROFILE").Output()
+		if p := strings.TrimSpace(string(out)); err == nil && p != "" {
+			return p, nil
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1"), nil
+	}
+	return filepath.Join(home, ".config", "powershell", "Microsoft.PowerShell_profile.ps1"), nil
+}
+
+// updateCompletionBlock replaces the completion block in content with the snippet, or appends the block.
+func updateCompletionBlock(content, snippet string) string {
+	block := completionBlockBegin + "\n" + snippet + "\n" + completionBlockEnd + "\n"
+	if begin, end, ok := findCompletionBlock(content); ok {
+		return content[:begin] + block + content[end:]
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	return content + block
+}
+
+// removeCompletionBlock removes the completion block from content, with the empty line preceding it.
+func removeCompletionBlock(content string) string {
+	begin, end, ok := findCompletionBlock(content)
+	if !ok {
+		return content
+	}
+	before := content[:begin]
+	if strings.HasSuffix(before, "\n\n") {
+		before = before[:len(before)-1]
+	}
+	return before + content[end:]
+}
+
+// findCompletionBlock returns the byte range of the completion block in content, including the trailing newline.
+// A begin line without the end line (e.g., left by a manual edit) is not a part of the block, so that
+// the lines following it are never removed.
+func findCompletionBlock(content string) (begin, end int, ok bool) {
+	for off := 0; ; {
+		i := strings.Index(content[off:], completionBlockEnd)
+		if i < 0 {
+			return 0, 0, false
+		}
+		end = off + i + len(completionBlockEnd)
+		begin = strings.LastIndex(content[:off+i], completionBlockBegin+"\n")
+		if begin >= 0 {
+			break
+		}
+		off = end
+	}
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return begin, end, true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCompletionBlock(t *testing.T) {
+	const snippet = "source <(limactl completion bash)"
+	block := completionBlockBegin + "\n" + snippet + "\n" + completionBlockEnd + "\n"
+	cases := []struct {
+		name      string
+		content   string
+		installed string
+		// uninstalled is the result of removing the block from installed
+		uninstalled string
+	}{
+		{
+			name:        "empty file",
+			content:     "",
+			installed:   block,
+			uninstalled: "",
+		},
+		{
+			name:        "existing file",
+			content:     "export PATH=$HOME/bin:$PATH\n",
+			installed:   "export PATH=$HOME/bin:$PATH\n\n" + block,
+			uninstalled: "export PATH=$HOME/bin:$PATH\n",
+		},
+		{
+			name:        "without the trailing newline",
+			content:     "export PATH=$HOME/bin:$PATH",
+			installed:   "export PATH=$HOME/bin:$PATH\n\n" + block,
+			uninstalled: "export PATH=$HOME/bin:$PATH\n",
+		},
+		{
+			name:        "outdated block in the middle",
+			content:     "alias ll='ls -l'\n\n" + completionBlockBegin + "\nsource <(limactl completion)\n" + completionBlockEnd + "\nalias la='ls -a'\n",
+			installed:   "alias ll='ls -l'\n\n" + block + "alias la='ls -a'\n",
+			uninstalled: "alias ll='ls -l'\nalias la='ls -a'\n",
+		},
+		{
+			name:        "block without the trailing newline",
+			content:     "alias ll='ls -l'\n\n" + completionBlockBegin + "\n" + snippet + "\n" + completionBlockEnd,
+			installed:   "alias ll='ls -l'\n\n" + block,
+			uninstalled: "alias ll='ls -l'\n",
+		},
+		{
+			name:        "only the begin line",
+			content:     completionBlockBegin + "\nalias ll='ls -l'\n",
+			installed:   completionBlockBegin + "\nalias ll='ls -l'\n\n" + block,
+			uninstalled: completionBlockBegin + "\nalias ll='ls -l'\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installed := updateCompletionBlock(tc.content, snippet)
+			assert.Equal(t, installed, tc.installed)
+			// Installing again is a no-op
+			assert.Equal(t, updateCompletionBlock(installed, snippet), installed)
+
+			uninstalled := removeCompletionBlock(installed)
+			assert.Equal(t, uninstalled, tc.uninstalled)
+			// Uninstalling again is a no-op
+			assert.Equal(t, removeCompletionBlock(uninstalled), uninstalled)
+		})
+	}
+}
+
+func TestFindCompletionBlock(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		begin   int
+		end     int
+		ok      bool
+	}{
+		{name: "no block", content: "alias ll='ls -l'\n"},
+		{name: "only the begin line", content: completionBlockBegin + "\n"},
+		{name: "only the end line", content: completionBlockEnd + "\n"},
+		{name: "end line before the begin line", content: completionBlockEnd + "\n" + completionBlockBegin + "\n"},
+		{
+			name:    "block",
+			content: "x\n" + completionBlockBegin + "\ny\n" + completionBlockEnd + "\nz\n",
+			begin:   2,
+			end:     2 + len(completionBlockBegin) + 3 + len(completionBlockEnd) + 1,
+			ok:      true,
+		},
+		{
+			name:    "block at the end without the trailing newline",
+			content: completionBlockBegin + "\ny\n" + completionBlockEnd,
+			begin:   0,
+			end:     len(completionBlockBegin) + 3 + len(completionBlockEnd),
+			ok:      true,
+		},
+		{
+			name:    "stray begin line before the block",
+			content: completionBlockBegin + "\nx\n" + completionBlockBegin + "\ny\n" + completionBlockEnd + "\n",
+			begin:   len(completionBlockBegin) + 3,
+			end:     2*len(completionBlockBegin) + 6 + len(completionBlockEnd) + 1,
+			ok:      true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			begin, end, ok := findCompletionBlock(tc.content)
+			assert.Equal(t, ok, tc.ok)
+			assert.Equal(t, begin, tc.begin)
+			assert.Equal(t, end, tc.end)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/lima-vm/lima/pkg/compose"
+	"github.com/lima-vm/lima/pkg/instance"
+	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newComposeCommand() *cobra.Command {
+	composeCommand := &cobra.Command{
+		Use:   "compose",
+		Short: "Manage a group of instances declared in a compose file",
+		Long: `Manage a group of instances declared in a compose file (` + compose.DefaultFile + `).
+
+The instances are named "<project>-<instance>", e.g., "myapp-web".
+See https://lima-vm.io/docs/usage/compose/ for the format of the compose file.`,
+		Example: `  # Create and start the instances declared in ./lima-compose.yaml
+  limactl compose up
+
+  # Stop the instances
+  limactl compose down
+
+  # Stop and delete the instances
+  limactl compose down --delete
+`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		GroupID:       advancedCommand,
+	}
+	composeCommand.PersistentFlags().StringP("file", "f", compose.DefaultFile, "compose file")
+	composeCommand.AddCommand(
+		newComposeUpCommand(),
+		newComposeDownCommand(),
+	)
+	return composeCommand
+}
+
+func loadComposeProject(cmd *cobra.Command) (*compose.Project, error) {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return nil, err
+	}
+	return compose.Load(file)
+}
+
+func newComposeUpCommand() *cobra.Command {
+	composeUpCommand := &cobra.Command{
+		Use:   "up [INSTANCE...]",
+		Short: "Create and start the instances",
+		Long: `Create and start the instances of the project, after their dependencies.
+Existing instances are not recreated; run 'limactl compose down --delete' first to apply the changes of the compose file.`,
+		Args: WrapArgsError(cobra.ArbitraryArgs),
+		RunE: composeUpAction,
+	}
+	composeUpCommand.Flags().Duration("timeout", instance.DefaultWatchHostAgentEventsTimeout, "duration to wait for each instance to be running before timing out")
+	return composeUpCommand
+}
+
+func composeUpAction(cmd *cobra.Command, args []string) error {
+	p, err := loadComposeProject(cmd)
+	if err != nil {
+		return err
+	}
+	if err := p.ValidateNetworks(); err != nil {
+		return err
+	}
+	keys, err := composeKeys(p, args, true)
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	for _, key := range keys {
+		instName := p.InstanceName(key)
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			tmpl, err := p.Template(ctx, key)
+			if err != nil {
+				return err
+			}
+			logrus.Infof("Creating the instance %q", instName)
+			if inst, err = instance.Create(ctx, instName, tmpl.Bytes, false); err != nil {
+				return fmt.Errorf("failed to create the instance %q: %w", instName, err)
+			}
+			history.Record(inst.Dir, history.Entry{
+				Event:    history.EventCreate,
+				Template: tmpl.Locator,
+				Digest:   history.Digest(tmpl.Bytes),
+				Message:  "limactl compose",
+			})
+		}
+		if len(inst.Errors) > 0 {
+			return fmt.Errorf("errors inspecting instance %q: %+v", instName, inst.Errors)
+		}
+		if inst.Status == store.StatusRunning {
+			logrus.Infof("The instance %q is already running", instName)
+			continue
+		}
+		if err := networks.Reconcile(ctx, instName); err != nil {
+			return err
+		}
+		startCtx := ctx
+		if timeout > 0 {
+			startCtx = instance.WithWatchHostAgentTimeout(ctx, timeout)
+		}
+		if err := instance.Start(startCtx, inst, "", false); err != nil {
+			return fmt.Errorf("failed to start the instance %q: %w", instName, err)
+		}
+	}
+	return nil
+}
+
+func newComposeDownCommand() *cobra.Command {
+	composeDownCommand := &cobra.Command{
+		Use:   "down [INSTANCE...]",
+		Short: "Stop the instances",
+		Long:  "Stop the instances of the project, before their dependencies.",
+		Args:  WrapArgsError(cobra.ArbitraryArgs),
+		RunE:  composeDownAction,
+	}
+	composeDownCommand.Flags().Bool("delete", false, "delete the instances after stopping them")
+	composeDownCommand.Flags().Bool("force", false, "force stop (and delete) the instances")
+	return composeDownCommand
+}
+
+func composeDownAction(cmd *cobra.Command, args []string) error {
+	p, err := loadComposeProject(cmd)
+	if err != nil {
+		return err
+	}
+	keys, err := composeKeys(p, args, false)
+	if err != nil {
+		return err
+	}
+	deleteInstances, err := cmd.Flags().GetBool("delete")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	slices.Reverse(keys)
+	for _, key := range keys {
+		instName := p.InstanceName(key)
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				logrus.Infof("The instance %q does not exist", instName)
+				continue
+			}
+			return err
+		}
+		switch {
+		case force:
+			instance.StopForcibly(inst)
+		case inst.Status == store.StatusRunning:
+			if err := instance.StopGracefully(inst); err != nil {
+				return fmt.Errorf("failed to stop the instance %q: %w", instName, err)
+			}
+		}
+		if deleteInstances {
+			if inst, err = store.Inspect(instName); err != nil {
+				return err
+			}
+			if err := instance.Delete(cmd.Context(), inst, force); err != nil {
+				return fmt.Errorf("failed to delete the instance %q: %w", instName, err)
+			}
+			logrus.Infof("Deleted %q (%q)", instName, inst.Dir)
+		}
+	}
+	return networks.Reconcile(cmd.Context(), "")
+}
+
+// composeKeys returns the keys of the instances to be processed, in the order to be started.
+// When args are specified, only the specified instances are returned, along with their dependencies
+// when withDeps is true.
+func composeKeys(p *compose.Project, args []string, withDeps bool) ([]string, error) {
+	order, err := p.Order()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return order, nil
+	}
+	selected := make(map[string]bool)
+	var add func(key string)
+	add = func(key string) {
+		selected[key] = true
+		if withDeps {
+			for _, dep := range p.Instances[key].DependsOn {
+				add(dep)
+			}
+		}
+	}
+	for _, arg := range args {
+		if _, ok := p.Instances[arg]; !ok {
+			return nil, fmt.Errorf("unknown instance %q in the compose file", arg)
+		}
+		add(arg)
+	}
+	var keys []string
+	for _, key := range order {
+		if selected[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
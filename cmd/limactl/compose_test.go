@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestComposeCommandFlags(t *testing.T) {
+	composeCommand := newComposeCommand()
+	composeCommand.SetOut(io.Discard)
+	composeCommand.SetArgs([]string{"down", "--help"})
+	assert.NilError(t, composeCommand.Execute())
+
+	for _, sub := range []string{"up", "down"} {
+		cmd, _, err := newComposeCommand().Find([]string{sub})
+		assert.NilError(t, err)
+		assert.NilError(t, cmd.ParseFlags([]string{"-f", "project.yaml"}))
+		file, err := cmd.Flags().GetString("file")
+		assert.NilError(t, err)
+		assert.Equal(t, file, "project.yaml")
+	}
+
+	cmd, _, err := newComposeCommand().Find([]string{"down"})
+	assert.NilError(t, err)
+	assert.NilError(t, cmd.ParseFlags([]string{"--force", "--delete"}))
+	force, err := cmd.Flags().GetBool("force")
+	assert.NilError(t, err)
+	assert.Assert(t, force)
+}
@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
-	"github.com/coreos/go-semver/semver"
+	"github.com/lima-vm/lima/pkg/copyutil"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/sirupsen/logrus"
@@ -17,8 +18,13 @@ import (
 const copyHelp = `Copy files between host and guest
 
 Prefix guest filenames with the instance name and a colon.
+Files can be copied between two instances too; they are streamed through the host.
 
 Example: limactl copy default:/etc/os-release .
+
+Large files can be resumed with --resume after an interruption:
+
+Example: limactl copy --resume ./disk.img default:/tmp/disk.img
 `
 
 func newCopyCommand() *cobra.Command {
@@ -34,6 +40,7 @@ func newCopyCommand() *cobra.Command {
 
 	copyCommand.Flags().BoolP("recursive", "r", false, "copy directories recursively")
 	copyCommand.Flags().BoolP("verbose", "v", false, "enable verbose output")
+	copyCommand.Flags().Bool("resume", false, "resume copying partially copied files, and skip the files that have already been copied")
 
 	return copyCommand
 }
@@ -49,13 +56,11 @@ func copyAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	arg0, err := exec.LookPath("scp")
+	resume, err := cmd.Flags().GetBool("resume")
 	if err != nil {
 		return err
 	}
-	instances := make(map[string]*store.Instance)
-	scpFlags := []string{}
-	scpArgs := []string{}
+
 	debug, err := cmd.Flags().GetBool("debug")
 	if err != nil {
 		return err
@@ -65,76 +70,85 @@ func copyAction(cmd *cobra.Command, args []string) error {
 		verbose = true
 	}
 
-	if verbose {
-		scpFlags = append(scpFlags, "-v")
-	} else {
-		scpFlags = append(scpFlags, "-q")
-	}
-
-	if recursive {
-		scpFlags = append(scpFlags, "-r")
-	}
-	legacySSH := sshutil.DetectOpenSSHVersion().LessThan(*semver.New("8.0.0"))
+	guests := make(map[string]*copyutil.SFTPFS)
+	defer func() {
+		for instName, guest := range guests {
+			if err := guest.Close(); err != nil {
+				logrus.WithError(err).Warnf("Failed to close the SFTP session of instance %q", instName)
+			}
+		}
+	}()
+	paths := make([]copyutil.Path, 0, len(args))
 	for _, arg := range args {
 		path := strings.Split(arg, ":")
 		switch len(path) {
 		case 1:
-			scpArgs = append(scpArgs, arg)
+			paths = append(paths, copyutil.Path{FS: copyutil.HostFS{}, Path: arg, Name: arg})
 		case 2:
 			instName := path[0]
-			inst, err := store.Inspect(instName)
-			if err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+			guest, ok := guests[instName]
+			if !ok {
+				guest, err = newGuestFS(cmd, instName)
+				if err != nil {
+					return err
 				}
-				return err
-			}
-			if inst.Status == store.StatusStopped {
-				return fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
+				guests[instName] = guest
 			}
-			if legacySSH {
-				scpFlags = append(scpFlags, "-P", fmt.Sprintf("%d", inst.SSHLocalPort))
-				scpArgs = append(scpArgs, fmt.Sprintf("%s@127.0.0.1:%s", *inst.Config.User.Name, path[1]))
-			} else {
-				scpArgs = append(scpArgs, fmt.Sprintf("scp://%s@127.0.0.1:%d/%s", *inst.Config.User.Name, inst.SSHLocalPort, path[1]))
+			guestPath := path[1]
+			if guestPath == "" {
+				// the home directory
+				guestPath = "."
 			}
-			instances[instName] = inst
+			paths = append(paths, copyutil.Path{FS: guest, Path: guestPath, Name: arg})
 		default:
 			return fmt.Errorf("path %q contains multiple colons", arg)
 		}
 	}
-	if legacySSH && len(instances) > 1 {
-		return errors.New("more than one (instance) host is involved in this command, this is only supported for openSSH v8.0 or higher")
+
+	opts := copyutil.Options{
+		Recursive: recursive,
+		Resume:    resume,
+		Verbose:   verbose,
 	}
-	scpFlags = append(scpFlags, "-3", "--")
-	scpArgs = append(scpFlags, scpArgs...)
-
-	var sshOpts []string
-	if len(instances) == 1 {
-		// Only one (instance) host is involved; we can use the instance-specific
-		// arguments such as ControlPath.  This is preferred as we can multiplex
-		// sessions without re-authenticating (MaxSessions permitting).
-		for _, inst := range instances {
-			sshOpts, err = sshutil.SSHOpts(inst.Dir, *inst.Config.User.Name, false, false, false, false)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		// Copying among multiple hosts; we can't pass in host-specific options.
-		sshOpts, err = sshutil.CommonOpts(false)
-		if err != nil {
-			return err
+	return copyutil.Copy(cmd.Context(), paths[:len(paths)-1], paths[len(paths)-1], opts)
+}
+
+// newGuestFS opens an SFTP session to the instance, via the SSH control master of the instance.
+func newGuestFS(cmd *cobra.Command, instName string) (*copyutil.SFTPFS, error) {
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
 		}
+		return nil, err
 	}
-	sshArgs := sshutil.SSHArgsFromOpts(sshOpts)
-
-	sshCmd := exec.Command(arg0, append(sshArgs, scpArgs...)...)
-	sshCmd.Stdin = cmd.InOrStdin()
-	sshCmd.Stdout = cmd.OutOrStdout()
+	if inst.Status == store.StatusStopped {
+		return nil, fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
+	}
+	if inst.Status == store.StatusSuspended {
+		return nil, fmt.Errorf("instance %q is suspended, run `limactl resume %s` to resume the instance", instName, instName)
+	}
+	arg0, err := exec.LookPath("ssh")
+	if err != nil {
+		return nil, err
+	}
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *inst.Config.User.Name, false, false, false, false)
+	if err != nil {
+		return nil, err
+	}
+	sshArgs := append(sshutil.SSHArgsFromOpts(sshOpts),
+		"-o", "LogLevel=ERROR",
+		"-p", strconv.Itoa(inst.SSHLocalPort),
+		"-s",
+		inst.SSHAddress,
+		"sftp",
+	)
+	sshCmd := exec.CommandContext(cmd.Context(), arg0, sshArgs...)
 	sshCmd.Stderr = cmd.ErrOrStderr()
-	logrus.Debugf("executing scp (may take a long time): %+v", sshCmd.Args)
-
-	// TODO: use syscall.Exec directly (results in losing tty?)
-	return sshCmd.Run()
+	logrus.Debugf("executing ssh for SFTP: %+v", sshCmd.Args)
+	guest, err := copyutil.NewSFTPFS(sshCmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SFTP for instance %q (is sftp-server installed in the guest?): %w", instName, err)
+	}
+	return guest, nil
 }
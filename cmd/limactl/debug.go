@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lima-vm/lima/pkg/hostagent/dns"
@@ -29,6 +31,7 @@ func newDebugDNSCommand() *cobra.Command {
 		RunE:  debugDNSAction,
 	}
 	cmd.Flags().BoolP("ipv6", "6", false, "lookup IPv6 addresses too")
+	cmd.Flags().StringArray("rule", nil, "route a domain to upstream servers (DOMAIN=SERVER[,SERVER...]), can be specified multiple times")
 	return cmd
 }
 
@@ -37,6 +40,18 @@ func debugDNSAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	ruleFlags, err := cmd.Flags().GetStringArray("rule")
+	if err != nil {
+		return err
+	}
+	var rules []dns.Rule
+	for _, f := range ruleFlags {
+		domain, servers, ok := strings.Cut(f, "=")
+		if !ok {
+			return fmt.Errorf("invalid rule %q, expected DOMAIN=SERVER[,SERVER...]", f)
+		}
+		rules = append(rules, dns.Rule{Domain: domain, Servers: strings.Split(servers, ",")})
+	}
 	udpLocalPort, err := strconv.Atoi(args[0])
 	if err != nil {
 		return err
@@ -55,6 +70,7 @@ func debugDNSAction(cmd *cobra.Command, args []string) error {
 		HandlerOptions: dns.HandlerOptions{
 			IPv6:        ipv6,
 			StaticHosts: map[string]string{},
+			Rules:       rules,
 		},
 	}
 	srv, err := dns.Start(srvOpts)
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const defaultHelp = `Manage the default instance
+
+The default instance is used by the commands that take an optional instance name, such as
+"limactl start", "limactl stop", and "limactl shell" without the instance name, and by the "lima" command.
+
+The default instance is looked up in the following order:
+  - $LIMA_INSTANCE
+  - the name set with "limactl default set" (stored in $LIMA_HOME/_config/default-instance)
+  - "` + DefaultInstanceName + `"
+
+Unlike $LIMA_INSTANCE, the name set with "limactl default set" is shared across the shells.
+Other tools can look up the default instance with "limactl default show".
+`
+
+func newDefaultCommand() *cobra.Command {
+	defaultCmd := &cobra.Command{
+		Use:     "default",
+		Short:   "Manage the default instance",
+		Long:    defaultHelp,
+		GroupID: advancedCommand,
+	}
+	defaultCmd.AddCommand(newDefaultSetCommand())
+	defaultCmd.AddCommand(newDefaultShowCommand())
+	defaultCmd.AddCommand(newDefaultUnsetCommand())
+
+	return defaultCmd
+}
+
+func newDefaultSetCommand() *cobra.Command {
+	setCmd := &cobra.Command{
+		Use:               "set INSTANCE",
+		Short:             "Set the default instance",
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              defaultSetAction,
+		ValidArgsFunction: defaultSetBashComplete,
+	}
+	return setCmd
+}
+
+func defaultSetAction(_ *cobra.Command, args []string) error {
+	instName := args[0]
+	if _, err := store.Inspect(instName); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist, run `limactl create --name=%s` to create a new instance", instName, instName)
+		}
+		return err
+	}
+	if err := store.SetDefaultInstance(instName); err != nil {
+		return err
+	}
+	if env := os.Getenv("LIMA_INSTANCE"); env != "" && env != instName {
+		logrus.Warnf("$LIMA_INSTANCE (%q) takes precedence over the default instance %q in this shell", env, instName)
+	}
+	logrus.Infof("Set the default instance to %q", instName)
+	return nil
+}
+
+func defaultSetBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
+
+func newDefaultShowCommand() *cobra.Command {
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the default instance",
+		Args:  WrapArgsError(cobra.NoArgs),
+		RunE:  defaultShowAction,
+	}
+	return showCmd
+}
+
+func defaultShowAction(cmd *cobra.Command, _ []string) error {
+	instName, err := store.DefaultInstance()
+	if err != nil {
+		return err
+	}
+	if env := os.Getenv("LIMA_INSTANCE"); env != "" {
+		logrus.Debugf("the default instance %q is specified by $LIMA_INSTANCE", env)
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), instName)
+	return err
+}
+
+func newDefaultUnsetCommand() *cobra.Command {
+	unsetCmd := &cobra.Command{
+		Use:   "unset",
+		Short: "Reset the default instance to \"" + DefaultInstanceName + "\"",
+		Args:  WrapArgsError(cobra.NoArgs),
+		RunE:  defaultUnsetAction,
+	}
+	return unsetCmd
+}
+
+func defaultUnsetAction(_ *cobra.Command, _ []string) error {
+	return store.SetDefaultInstance("")
+}
+
+// instanceNameFromArgs returns args[0] if specified, otherwise the default instance (see `limactl default`).
+func instanceNameFromArgs(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return store.DefaultInstance()
+}
@@ -52,6 +52,9 @@ func deleteAction(cmd *cobra.Command, args []string) error {
 			} else if deleted {
 				logrus.Infof("The autostart file %q has been deleted", autostart.GetFilePath(runtime.GOOS, instName))
 			}
+			if err := deleteHostServices(instName); err != nil {
+				logrus.WithError(err).Warnf("Failed to remove the host services of instance %q", instName)
+			}
 		}
 		logrus.Infof("Deleted %q (%q)", instName, inst.Dir)
 	}
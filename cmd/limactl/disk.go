@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/instance"
 	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/sirupsen/logrus"
@@ -20,7 +22,7 @@ func newDiskCommand() *cobra.Command {
 		Use:   "disk",
 		Short: "Lima disk management",
 		Example: `  Create a disk:
-  $ limactl disk create DISK --size SIZE [--format qcow2]
+  $ limactl disk create DISK --size SIZE [--format qcow2] [--fs ext4 [--label LABEL]]
 
   List existing disks:
   $ limactl disk ls
@@ -29,7 +31,10 @@ func newDiskCommand() *cobra.Command {
   $ limactl disk delete DISK
 
   Resize a disk:
-  $ limactl disk resize DISK --size SIZE`,
+  $ limactl disk resize DISK --size SIZE
+
+  Resize the main disk of an instance:
+  $ limactl disk resize --instance INSTANCE --size SIZE`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		GroupID:       advancedCommand,
@@ -50,6 +55,9 @@ func newDiskCreateCommand() *cobra.Command {
 		Example: `
 To create a new disk:
 $ limactl disk create DISK --size SIZE [--format qcow2]
+
+To create a new disk with an XFS filesystem labeled "data":
+$ limactl disk create DISK --size SIZE --fs xfs --label data
 `,
 		Short: "Create a Lima disk",
 		Args:  WrapArgsError(cobra.ExactArgs(1)),
@@ -58,6 +66,9 @@ $ limactl disk create DISK --size SIZE [--format qcow2]
 	diskCreateCommand.Flags().String("size", "", "configure the disk size")
 	_ = diskCreateCommand.MarkFlagRequired("size")
 	diskCreateCommand.Flags().String("format", "qcow2", "specify the disk format")
+	diskCreateCommand.Flags().String("fs", "", fmt.Sprintf("create a filesystem on the disk (%v)", qemu.DataDiskFSTypes))
+	diskCreateCommand.Flags().String("label", "", "filesystem label (default: lima-DISK), requires --fs")
+	diskCreateCommand.Flags().StringArray("mkfs-arg", nil, "extra argument for mkfs, requires --fs (can be specified multiple times)")
 	return diskCreateCommand
 }
 
@@ -86,6 +97,11 @@ func diskCreateAction(cmd *cobra.Command, args []string) error {
 	// only exactly one arg is allowed
 	name := args[0]
 
+	fsys, err := diskFilesystemFromFlags(cmd, name)
+	if err != nil {
+		return err
+	}
+
 	diskDir, err := store.DiskDir(name)
 	if err != nil {
 		return err
@@ -109,9 +125,58 @@ func diskCreateAction(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create %s disk in %q: %w", format, diskDir, err)
 	}
 
+	if fsys != nil {
+		fsys.Formatted, err = qemu.FormatDataDisk(diskDir, format, int(diskSize), fsys)
+		if err == nil {
+			err = store.SaveDiskFilesystem(diskDir, fsys)
+		}
+		if err != nil {
+			rerr := os.RemoveAll(diskDir)
+			if rerr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to remove a directory %q: %w", diskDir, rerr))
+			}
+			return fmt.Errorf("failed to create %s filesystem in %q: %w", fsys.Type, diskDir, err)
+		}
+	}
+
 	return nil
 }
 
+// diskFilesystemFromFlags returns nil when --fs is not specified.
+func diskFilesystemFromFlags(cmd *cobra.Command, name string) (*store.DiskFilesystem, error) {
+	flags := cmd.Flags()
+	fsType, err := flags.GetString("fs")
+	if err != nil {
+		return nil, err
+	}
+	label, err := flags.GetString("label")
+	if err != nil {
+		return nil, err
+	}
+	mkfsArgs, err := flags.GetStringArray("mkfs-arg")
+	if err != nil {
+		return nil, err
+	}
+	if fsType == "" {
+		if flags.Changed("label") || flags.Changed("mkfs-arg") {
+			return nil, errors.New("--label and --mkfs-arg require --fs")
+		}
+		return nil, nil
+	}
+	if label == "" {
+		label = "lima-" + name
+	}
+	fsys := &store.DiskFilesystem{
+		Type:     fsType,
+		Label:    label,
+		MkfsArgs: mkfsArgs,
+	}
+	if err := qemu.ValidateDataDiskFilesystem(fsys); err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
 func newDiskListCommand() *cobra.Command {
 	diskListCommand := &cobra.Command{
 		Use: "list",
@@ -328,8 +393,8 @@ func diskUnlockAction(_ *cobra.Command, args []string) error {
 					diskName, disk.Instance, inst.Errors)
 				continue
 			}
-			if inst.Status == store.StatusRunning {
-				logrus.Warnf("Cannot unlock disk %q used by running instance %q", diskName, disk.Instance)
+			if inst.Status == store.StatusRunning || inst.Status == store.StatusSuspended {
+				logrus.Warnf("Cannot unlock disk %q used by %s instance %q", diskName, strings.ToLower(inst.Status), disk.Instance)
 				continue
 			}
 		}
@@ -346,13 +411,20 @@ func newDiskResizeCommand() *cobra.Command {
 		Use: "resize DISK",
 		Example: `
 Resize a disk:
-$ limactl disk resize DISK --size SIZE`,
+$ limactl disk resize DISK --size SIZE
+
+Resize the main disk of an instance (the partition and the filesystem are grown on the next boot):
+$ limactl disk resize --instance INSTANCE --size SIZE`,
 		Short:             "Resize existing Lima disk",
-		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
 		RunE:              diskResizeAction,
 		ValidArgsFunction: diskBashComplete,
 	}
 	diskResizeCommand.Flags().String("size", "", "Disk size")
+	diskResizeCommand.Flags().String("instance", "", "resize the main disk of the instance, instead of a Lima disk")
+	_ = diskResizeCommand.RegisterFlagCompletionFunc("instance", func(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return bashCompleteInstanceNames(cmd)
+	})
 	_ = diskResizeCommand.MarkFlagRequired("size")
 	return diskResizeCommand
 }
@@ -362,6 +434,19 @@ func diskResizeAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	instName, err := cmd.Flags().GetString("instance")
+	if err != nil {
+		return err
+	}
+	if instName != "" {
+		if len(args) != 0 {
+			return errors.New("DISK must not be specified with --instance")
+		}
+		return instanceDiskResizeAction(cmd, instName, size)
+	}
+	if len(args) != 1 {
+		return errors.New("DISK or --instance must be specified")
+	}
 
 	diskSize, err := units.RAMInBytes(size)
 	if err != nil {
@@ -385,8 +470,8 @@ func diskResizeAction(cmd *cobra.Command, args []string) error {
 	if disk.Instance != "" {
 		inst, err := store.Inspect(disk.Instance)
 		if err == nil {
-			if inst.Status == store.StatusRunning {
-				return fmt.Errorf("cannot resize disk %q used by running instance %q. Please stop the VM instance", diskName, disk.Instance)
+			if inst.Status == store.StatusRunning || inst.Status == store.StatusSuspended {
+				return fmt.Errorf("cannot resize disk %q used by %s instance %q. Please stop the VM instance", diskName, strings.ToLower(inst.Status), disk.Instance)
 			}
 		}
 	}
@@ -397,6 +482,21 @@ func diskResizeAction(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func instanceDiskResizeAction(cmd *cobra.Command, instName, size string) error {
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+		}
+		return err
+	}
+	if err := instance.ResizeDisk(cmd.Context(), inst, size); err != nil {
+		return err
+	}
+	logrus.Infof("Resized the disk of instance %q to %s. The partition and the filesystem will be grown on the next start", instName, size)
+	return nil
+}
+
 func diskBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	return bashCompleteDiskNames(cmd)
 }
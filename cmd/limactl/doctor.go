@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lima-vm/lima/pkg/doctor"
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCommand() *cobra.Command {
+	doctorCommand := &cobra.Command{
+		Use:   "doctor [INSTANCE]...",
+		Short: "Diagnose the host environment and instances",
+		Long: `Diagnose the host environment and instances.
+
+The host is checked for QEMU (and its firmware), KVM, vz, nested virtualization, Rosetta, and socket_vmnet.
+The instances (all the instances when none is specified) are checked for the driver requirements,
+collisions of the SSH ports, socket_vmnet networks, Rosetta, and the connection to the guest agent.
+
+Each finding has the severity "ok", "warning", or "error", with a hint for resolving it.
+The command fails when an error is found.`,
+		Example: `  To diagnose the host and all the instances:
+  $ limactl doctor
+
+  To diagnose the host and the instance "default" as JSON lines:
+  $ limactl doctor --json default`,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              doctorAction,
+		ValidArgsFunction: doctorBashComplete,
+		SilenceUsage:      true,
+		SilenceErrors:     true,
+		GroupID:           advancedCommand,
+	}
+	doctorCommand.Flags().Bool("json", false, "JSONify output")
+	doctorCommand.AddCommand(newDoctorRosettaCommand())
+	return doctorCommand
+}
+
+func doctorAction(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	jsonFormat, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	instNames, err := store.Instances()
+	if err != nil {
+		return err
+	}
+	var all []*store.Instance
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to inspect instance %q", instName)
+			continue
+		}
+		all = append(all, inst)
+	}
+	instances := all
+	if len(args) > 0 {
+		instances = nil
+		for _, instName := range args {
+			inst, err := store.Inspect(instName)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+				}
+				return err
+			}
+			instances = append(instances, inst)
+		}
+	}
+
+	findings := doctor.Host(ctx)
+	for _, inst := range instances {
+		findings = append(findings, doctor.Instance(ctx, inst, all)...)
+	}
+
+	w := cmd.OutOrStdout()
+	if jsonFormat {
+		enc := json.NewEncoder(w)
+		for _, f := range findings {
+			if err := enc.Encode(f); err != nil {
+				return err
+			}
+		}
+	} else {
+		tw := tabwriter.NewWriter(w, 4, 8, 4, ' ', 0)
+		fmt.Fprintln(tw, "SEVERITY\tINSTANCE\tCHECK\tMESSAGE")
+		for _, f := range findings {
+			instName := f.Instance
+			if instName == "" {
+				instName = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Severity, instName, f.Check, f.Message)
+			if f.Hint != "" {
+				fmt.Fprintf(tw, "\t\t\t(hint: %s)\n", f.Hint)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if n := doctor.Count(findings, doctor.SeverityError); n > 0 {
+		return fmt.Errorf("found %d error(s)", n)
+	}
+	return nil
+}
+
+func newDoctorRosettaCommand() *cobra.Command {
+	doctorRosettaCommand := &cobra.Command{
+		Use:   "rosetta INSTANCE",
+		Short: "Diagnose and repair Rosetta in a running vz instance",
+		Long: `Diagnose and repair Rosetta in a running vz instance.
+
+The Rosetta volume is mounted if it is not mounted, and the binfmt_misc entry of Rosetta is
+reinstalled when "rosetta.binfmt" is true (or removed when it is false).
+The other enabled binfmt_misc entries for the x86_64 executables (e.g., "qemu-x86_64") are disabled.
+
+The repair needs "security.sudo: full".`,
+		Example: `  To diagnose Rosetta without repairing it:
+  $ limactl doctor rosetta --dry-run default`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              doctorRosettaAction,
+		ValidArgsFunction: doctorBashComplete,
+	}
+	doctorRosettaCommand.Flags().Bool("dry-run", false, "Only report the problems")
+	return doctorRosettaCommand
+}
+
+func doctorRosettaAction(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	if inst.VMType != limayaml.VZ {
+		return fmt.Errorf("instance %q has vmType %q, while Rosetta is supported only for vmType %q", inst.Name, inst.VMType, limayaml.VZ)
+	}
+	if !*inst.Config.Rosetta.Enabled {
+		return fmt.Errorf("instance %q does not enable Rosetta; run `limactl edit --rosetta %s`", inst.Name, inst.Name)
+	}
+	if inst.Status != store.StatusRunning {
+		return fmt.Errorf("instance %q is not running; run `limactl start %s`", inst.Name, inst.Name)
+	}
+
+	if v, err := osutil.ProductVersion(); err == nil {
+		logrus.Infof("Host: macOS %s", v)
+	}
+	if v, err := osutil.RosettaVersion(); err != nil {
+		logrus.WithError(err).Warn("Failed to detect the version of Rosetta on the host")
+	} else {
+		logrus.Infof("Host: Rosetta %s", v)
+	}
+	st, err := instance.InspectRosetta(ctx, inst)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Guest: Linux %s", st.Kernel)
+	binFmt := *inst.Config.Rosetta.BinFmt
+	problems := st.Problems(binFmt)
+	if len(problems) == 0 {
+		logrus.Infof("No problem found in Rosetta of instance %q (binfmt: %v)", inst.Name, binFmt)
+		return nil
+	}
+	for _, p := range problems {
+		logrus.Warnf("Problem: %s", p)
+	}
+	if dryRun {
+		return fmt.Errorf("found %d problem(s) in Rosetta of instance %q; run `limactl doctor rosetta %s` to repair", len(problems), inst.Name, inst.Name)
+	}
+
+	logrus.Infof("Repairing Rosetta of instance %q", inst.Name)
+	if err := instance.RepairRosetta(ctx, inst); err != nil {
+		return err
+	}
+	st, err = instance.InspectRosetta(ctx, inst)
+	if err != nil {
+		return err
+	}
+	if problems = st.Problems(binFmt); len(problems) > 0 {
+		for _, p := range problems {
+			logrus.Warnf("Problem: %s", p)
+		}
+		return fmt.Errorf("failed to repair %d problem(s) in Rosetta of instance %q", len(problems), inst.Name)
+	}
+	logrus.Infof("Repaired Rosetta of instance %q", inst.Name)
+	return nil
+}
+
+func doctorBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -2,23 +2,29 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"github.com/lima-vm/lima/cmd/limactl/editflags"
 	"github.com/lima-vm/lima/pkg/editutil"
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
 	"github.com/lima-vm/lima/pkg/instance"
 	"github.com/lima-vm/lima/pkg/limatmpl"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
 	"github.com/lima-vm/lima/pkg/uiutil"
 	"github.com/lima-vm/lima/pkg/yqutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func newEditCommand() *cobra.Command {
@@ -31,6 +37,8 @@ func newEditCommand() *cobra.Command {
 		GroupID:           basicCommand,
 	}
 	editflags.RegisterEdit(editCommand)
+	editCommand.Flags().Bool("live", false, "apply the changes of `param`, `hostResolver.hosts`, `kernel.modules`, and `sysctl` to the running instance without restarting it")
+	editCommand.Flags().Bool("etc-hosts", false, "with --live, also write `hostResolver.hosts` to /etc/hosts in the guest")
 	return editCommand
 }
 
@@ -43,19 +51,35 @@ func editAction(cmd *cobra.Command, args []string) error {
 	var filePath string
 	var err error
 	var inst *store.Instance
+	flags := cmd.Flags()
+	live, err := flags.GetBool("live")
+	if err != nil {
+		return err
+	}
+	etcHosts, err := flags.GetBool("etc-hosts")
+	if err != nil {
+		return err
+	}
+	if etcHosts && !live {
+		return errors.New("--etc-hosts requires --live")
+	}
 	switch {
 	case limatmpl.SeemsYAMLPath(arg):
+		if live {
+			return errors.New("--live cannot be used for editing a template")
+		}
 		// absolute path is required for `limayaml.Validate`
 		filePath, err = filepath.Abs(arg)
 		if err != nil {
 			return err
 		}
 	default:
-		var instName string
-		if arg != "" {
-			instName = arg
-		} else {
-			instName = DefaultInstanceName
+		instName := arg
+		if instName == "" {
+			instName, err = store.DefaultInstance()
+			if err != nil {
+				return err
+			}
 		}
 
 		inst, err = store.Inspect(instName)
@@ -66,8 +90,13 @@ func editAction(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		if inst.Status == store.StatusRunning {
-			return errors.New("cannot edit a running instance")
+		if inst.Status == store.StatusSuspended {
+			// The saved state of the VM depends on the configuration
+			return fmt.Errorf("cannot edit a suspended instance (hint: run `limactl resume %s`, or `limactl stop %s` to discard the saved state)",
+				inst.Name, inst.Name)
+		}
+		if inst.Status == store.StatusRunning && !live && !liveParamEdit(cmd, inst) {
+			return errors.New("cannot edit a running instance (hint: use --live to edit `param`, `hostResolver.hosts`, `kernel.modules`, and `sysctl`)")
 		}
 		filePath = filepath.Join(inst.Dir, filenames.LimaYAML)
 	}
@@ -76,7 +105,6 @@ func editAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	flags := cmd.Flags()
 	tty, err := flags.GetBool("tty")
 	if err != nil {
 		return err
@@ -92,6 +120,12 @@ func editAction(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
+		if inst != nil {
+			yBytes, err = editflags.AddProvenanceComment(yBytes, "edit", flags)
+			if err != nil {
+				return err
+			}
+		}
 	} else if tty {
 		var hdr string
 		if inst != nil {
@@ -119,6 +153,14 @@ func editAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	var hostsChanged, kernelConfigChanged bool
+	if inst != nil && inst.Status == store.StatusRunning {
+		if err := checkLiveEdit(inst, y, live); err != nil {
+			return err
+		}
+		hostsChanged = !reflect.DeepEqual(inst.Config.HostResolver.Hosts, y.HostResolver.Hosts)
+		kernelConfigChanged = !reflect.DeepEqual(inst.Config.Kernel, y.Kernel) || !reflect.DeepEqual(inst.Config.Sysctl, y.Sysctl)
+	}
 	if err := limayaml.Validate(y, true); err != nil {
 		rejectedYAML := "lima.REJECTED.yaml"
 		if writeErr := os.WriteFile(rejectedYAML, yBytes, 0o644); writeErr != nil {
@@ -131,8 +173,22 @@ func editAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	if inst != nil {
+		history.RecordEdit(inst.Dir, yContent, yBytes, "limactl edit")
 		logrus.Infof("Instance %q configuration edited", inst.Name)
 	}
+	if hostsChanged || (etcHosts && inst != nil && inst.Status == store.StatusRunning) {
+		if err := setLiveHosts(cmd.Context(), inst, y.HostResolver.Hosts, etcHosts); err != nil {
+			return fmt.Errorf("the configuration was saved, but failed to apply `hostResolver.hosts` to the running instance: %w", err)
+		}
+		logrus.Infof("Applied `hostResolver.hosts` to the running instance %q", inst.Name)
+	}
+	if kernelConfigChanged {
+		if err := applyLiveKernelConfig(cmd.Context(), inst, y); err != nil {
+			return fmt.Errorf("the configuration was saved, but failed to apply `kernel.modules` and `sysctl` to the running instance: %w", err)
+		}
+		// The modules are not unloaded, and the removed keys are not reset, as their original values are unknown
+		logrus.Infof("Applied `kernel.modules` and `sysctl` to the running instance %q (the removed ones are reverted on the next restart)", inst.Name)
+	}
 
 	if !tty {
 		// use "start" to start it
@@ -142,6 +198,10 @@ func editAction(cmd *cobra.Command, args []string) error {
 		// edited a limayaml file directly
 		return nil
 	}
+	if inst.Status == store.StatusRunning {
+		// the new values have been applied to the running instance
+		return nil
+	}
 	startNow, err := askWhetherToStart()
 	if err != nil {
 		return err
@@ -157,6 +217,72 @@ func editAction(cmd *cobra.Command, args []string) error {
 	return instance.Start(ctx, inst, "", false)
 }
 
+// liveParamEdit returns true if the running instance can be edited with the flags,
+// i.e., only `--param` is specified, and the new values can be delivered via `metadataService`.
+func liveParamEdit(cmd *cobra.Command, inst *store.Instance) bool {
+	if inst.Config == nil || inst.Config.MetadataService.Enabled == nil || !*inst.Config.MetadataService.Enabled {
+		return false
+	}
+	changed := 0
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name != "tty" && f.Name != "live" {
+			changed++
+		}
+	})
+	return changed == 1 && cmd.Flags().Changed("param")
+}
+
+// checkLiveEdit returns an error if y cannot be applied to the running instance.
+// Without live, only `param` can be changed, as by `liveParamEdit`.
+func checkLiveEdit(inst *store.Instance, y *limayaml.LimaYAML, live bool) error {
+	current := inst.Config
+	if !live {
+		if !onlyChanged(current, y, false) {
+			return errors.New("cannot edit a running instance, except for `param`")
+		}
+		return nil
+	}
+	if !onlyChanged(current, y, true) {
+		return errors.New("cannot edit a running instance, except for `param`, `hostResolver.hosts`, `kernel.modules`, and `sysctl`")
+	}
+	metadataService := current.MetadataService.Enabled != nil && *current.MetadataService.Enabled
+	if !metadataService && !reflect.DeepEqual(current.Param, y.Param) {
+		return errors.New("cannot edit `param` of a running instance without `metadataService`")
+	}
+	return nil
+}
+
+// onlyChanged returns true if y differs from the current config only in `param`,
+// and also in `hostResolver.hosts`, `kernel`, and `sysctl` when live is true.
+func onlyChanged(current, y *limayaml.LimaYAML, live bool) bool {
+	a, b := *current, *y
+	a.Param, b.Param = nil, nil
+	if live {
+		a.HostResolver.Hosts, b.HostResolver.Hosts = nil, nil
+		a.Kernel, b.Kernel = limayaml.KernelConfig{}, limayaml.KernelConfig{}
+		a.Sysctl, b.Sysctl = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// setLiveHosts applies `hostResolver.hosts` to the running instance via the host agent.
+func setLiveHosts(ctx context.Context, inst *store.Instance, hosts map[string]string, etcHosts bool) error {
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+	return haClient.SetHosts(ctx, &hostagentapi.Hosts{Hosts: hosts, EtcHosts: etcHosts})
+}
+
+// applyLiveKernelConfig applies `kernel.modules` and `sysctl` to the running instance via the host agent.
+func applyLiveKernelConfig(ctx context.Context, inst *store.Instance, y *limayaml.LimaYAML) error {
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+	return haClient.ApplyKernelConfig(ctx, &hostagentapi.KernelConfig{Modules: y.Kernel.Modules, Sysctl: y.Sysctl})
+}
+
 func askWhetherToStart() (bool, error) {
 	message := "Do you want to start the instance now? "
 	return uiutil.Confirm(message, true)
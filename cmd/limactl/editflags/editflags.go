@@ -3,10 +3,16 @@ package editflags
 import (
 	"fmt"
 	"math/bits"
+	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 
+	"al.essio.dev/pkg/shellescape"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/pbnjay/memory"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -43,9 +49,9 @@ func registerEdit(cmd *cobra.Command, commentPrefix string) {
 
 	flags.StringSlice("mount", nil, commentPrefix+"directories to mount, suffix ':w' for writable (Do not specify directories that overlap with the existing mounts)") // colima-compatible
 
-	flags.String("mount-type", "", commentPrefix+"mount type (reverse-sshfs, 9p, virtiofs)") // Similar to colima's --mount-type=(sshfs|9p|virtiofs), but "reverse-sshfs" is Lima is called "sshfs" in colima
+	flags.String("mount-type", "", commentPrefix+"mount type (reverse-sshfs, 9p, virtiofs, nfs)") // Similar to colima's --mount-type=(sshfs|9p|virtiofs), but "reverse-sshfs" is Lima is called "sshfs" in colima
 	_ = cmd.RegisterFlagCompletionFunc("mount-type", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
-		return []string{"reverse-sshfs", "9p", "virtiofs"}, cobra.ShellCompDirectiveNoFileComp
+		return []string{"reverse-sshfs", "9p", "virtiofs", "nfs"}, cobra.ShellCompDirectiveNoFileComp
 	})
 
 	flags.Bool("mount-writable", false, commentPrefix+"make all mounts writable")
@@ -57,9 +63,17 @@ func registerEdit(cmd *cobra.Command, commentPrefix string) {
 		return []string{"lima:shared", "lima:bridged", "lima:host", "lima:user-v2", "vzNAT"}, cobra.ShellCompDirectiveNoFileComp
 	})
 
+	flags.StringArrayP("param", "e", nil, commentPrefix+"set a template parameter (KEY=VALUE), can be specified multiple times. "+
+		"Changing a parameter of an existing instance reruns the provisioning scripts with `rerunOnParamChange: true`")
+
+	flags.String("profile", "", commentPrefix+"profile to be merged into the configuration, from $LIMA_HOME/_config/profiles/PROFILE.yaml (default: $LIMA_PROFILE for new instances)")
+	_ = cmd.RegisterFlagCompletionFunc("profile", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return completeProfiles(), cobra.ShellCompDirectiveNoFileComp
+	})
+
 	flags.Bool("rosetta", false, commentPrefix+"enable Rosetta (for vz instances)")
 
-	flags.String("set", "", commentPrefix+"modify the template inplace, using yq syntax")
+	flags.StringArray("set", nil, commentPrefix+"modify the template inplace, using yq syntax, e.g., '.cpus = 8 | .memory = \"16GiB\"' (can be specified multiple times)")
 
 	// negative performance impact: https://gitlab.com/qemu-project/qemu/-/issues/334
 	flags.Bool("video", false, commentPrefix+"enable video output (has negative performance impact for QEMU)")
@@ -186,6 +200,19 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			false,
 			false,
 		},
+		{
+			"param",
+			func(_ *flag.Flag) (string, error) {
+				ss, err := flags.GetStringArray("param")
+				if err != nil {
+					return "", err
+				}
+				return paramExpression(ss)
+			},
+			false,
+			false,
+		},
+		{"profile", d(".profile = %q"), false, false},
 		{
 			"rosetta",
 			func(_ *flag.Flag) (string, error) {
@@ -198,7 +225,18 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			false,
 			false,
 		},
-		{"set", d("%s"), false, false},
+		{
+			"set",
+			func(_ *flag.Flag) (string, error) {
+				ss, err := flags.GetStringArray("set")
+				if err != nil {
+					return "", err
+				}
+				return strings.Join(ss, " | "), nil
+			},
+			false,
+			false,
+		},
 		{
 			"video",
 			func(_ *flag.Flag) (string, error) {
@@ -261,9 +299,47 @@ func YQExpressions(flags *flag.FlagSet, newInstance bool) ([]string, error) {
 			exprs = append(exprs, expr)
 		}
 	}
+	if v := flags.Lookup("profile"); newInstance && v != nil && !v.Changed {
+		if profile := os.Getenv("LIMA_PROFILE"); profile != "" {
+			// The profile specified in the template takes precedence
+			exprs = append(exprs, fmt.Sprintf(".profile = (.profile // %q)", profile))
+		}
+	}
 	return exprs, nil
 }
 
+// completeProfiles returns the names of the profiles in $LIMA_HOME/_config/profiles.
+func completeProfiles() []string {
+	configDir, err := dirnames.LimaConfigDir()
+	if err != nil {
+		return nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(configDir, filenames.ProfilesDir, "*.yaml"))
+	res := make([]string, len(matches))
+	for i, m := range matches {
+		res[i] = strings.TrimSuffix(filepath.Base(m), ".yaml")
+	}
+	return res
+}
+
+var paramKeyRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// paramExpression converts KEY=VALUE pairs into a yq expression that sets `.param`.
+func paramExpression(ss []string) (string, error) {
+	var exprs []string
+	for _, s := range ss {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok {
+			return "", fmt.Errorf("param must be KEY=VALUE, got %q", s)
+		}
+		if !paramKeyRegexp.MatchString(k) {
+			return "", fmt.Errorf("param key must start with a letter followed by letters, digits, and underscores, got %q", k)
+		}
+		exprs = append(exprs, fmt.Sprintf(".param.%s = %q", k, v))
+	}
+	return strings.Join(exprs, " | "), nil
+}
+
 func isPowerOfTwo(x int) bool {
 	return bits.OnesCount(uint(x)) == 1
 }
@@ -293,3 +369,38 @@ func completeMemoryGiB(hostMemory uint64) []float32 {
 	}
 	return res
 }
+
+// provenancePrefix is the prefix of the provenance comments, which record the `--set` expressions in lima.yaml.
+const provenancePrefix = "# limactl "
+
+// AddProvenanceComment records the `--set` expressions of `limactl COMMAND` as a comment line at the top of
+// the YAML, after the provenance comments of the previous commands, e.g.,
+//
+//	# limactl create --set '.cpus = 8 | .memory = "16GiB"'
+//
+// The YAML is returned as is if `--set` is not specified.
+func AddProvenanceComment(b []byte, command string, flags *flag.FlagSet) ([]byte, error) {
+	if !flags.Changed("set") {
+		return b, nil
+	}
+	ss, err := flags.GetStringArray("set")
+	if err != nil {
+		return nil, err
+	}
+	comment := provenancePrefix + command
+	for _, s := range ss {
+		comment += " --set " + shellescape.Quote(s)
+	}
+	comment = strings.ReplaceAll(comment, "\n", " ") + "\n"
+	s := string(b)
+	i := 0
+	for strings.HasPrefix(s[i:], provenancePrefix) {
+		j := strings.IndexByte(s[i:], '\n')
+		if j < 0 {
+			s += "\n"
+			j = len(s) - 1 - i
+		}
+		i += j + 1
+	}
+	return []byte(s[:i] + comment + s[i:]), nil
+}
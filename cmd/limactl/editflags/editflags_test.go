@@ -3,6 +3,7 @@ package editflags
 import (
 	"testing"
 
+	flag "github.com/spf13/pflag"
 	"gotest.tools/v3/assert"
 )
 
@@ -20,3 +21,42 @@ func TestCompleteMemoryGiB(t *testing.T) {
 	assert.DeepEqual(t, []float32{1, 2, 4}, completeMemoryGiB(8<<30))
 	assert.DeepEqual(t, []float32{1, 2, 4, 8, 10}, completeMemoryGiB(20<<30))
 }
+
+func TestParamExpression(t *testing.T) {
+	expr, err := paramExpression([]string{"API_ENDPOINT=https://example.com/?a=b", "Empty="})
+	assert.NilError(t, err)
+	assert.Equal(t, `.param.API_ENDPOINT = "https://example.com/?a=b" | .param.Empty = ""`, expr)
+
+	_, err = paramExpression([]string{"NOVALUE"})
+	assert.ErrorContains(t, err, "must be KEY=VALUE")
+
+	_, err = paramExpression([]string{"1KEY=foo"})
+	assert.ErrorContains(t, err, "param key must start with a letter")
+}
+
+func TestAddProvenanceComment(t *testing.T) {
+	newFlags := func(args ...string) *flag.FlagSet {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.StringArray("set", nil, "")
+		assert.NilError(t, flags.Parse(args))
+		return flags
+	}
+	y := []byte("# A template\ncpus: 2\n")
+	b, err := AddProvenanceComment(y, "create", newFlags())
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), string(y))
+
+	b, err = AddProvenanceComment(y, "create", newFlags("--set", `.cpus = 8 | .memory = "16GiB"`, "--set", ".disk = \"100GiB\""))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `# limactl create --set '.cpus = 8 | .memory = "16GiB"' --set '.disk = "100GiB"'
+# A template
+cpus: 2
+`)
+	b, err = AddProvenanceComment(b, "start", newFlags("--set", ".cpus = 4"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `# limactl create --set '.cpus = 8 | .memory = "16GiB"' --set '.disk = "100GiB"'
+# limactl start --set '.cpus = 4'
+# A template
+cpus: 2
+`)
+}
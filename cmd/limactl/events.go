@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/spf13/cobra"
+)
+
+func newEventsCommand() *cobra.Command {
+	eventsCommand := &cobra.Command{
+		Use: "events [INSTANCE]",
+		Example: `
+To show the events since the instance was started:
+$ limactl events default
+
+To keep streaming the new events until the instance stops:
+$ limactl events --follow default
+`,
+		Short: "Show the events of the host agent as JSON lines",
+		Long: `Show the events of the host agent as JSON lines.
+
+The events include the status changes ("booting", "running", "degraded", "exiting"), the boot phases,
+the readiness of SSH, the mounts, and the guest agent, the results of the readiness probes,
+the guest ports being added or removed, the driver failures, and the guest kernel panics.
+
+The events are streamed from the host agent socket ("ha.sock") of a running instance.
+For a stopped instance, the events of the last run are read from "ha.stdout.log".`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              eventsAction,
+		ValidArgsFunction: eventsBashComplete,
+		GroupID:           advancedCommand,
+	}
+	eventsCommand.Flags().BoolP("follow", "f", false, "keep streaming the new events until the instance stops")
+	return eventsCommand
+}
+
+func eventsAction(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist", instName)
+		}
+		return err
+	}
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	if inst.Status != store.StatusRunning {
+		if follow {
+			return fmt.Errorf("instance %q is not running (status %q), run `limactl start %s` to start it", instName, inst.Status, instName)
+		}
+		return printLoggedEvents(enc, filepath.Join(inst.Dir, filenames.HostAgentStdoutLog))
+	}
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+	var encErr error
+	if err := haClient.Events(ctx, follow, func(ev hostagentevents.Event) bool {
+		encErr = enc.Encode(ev)
+		return encErr != nil
+	}); err != nil {
+		return fmt.Errorf("failed to receive the events from the host agent of instance %q: %w", instName, err)
+	}
+	return encErr
+}
+
+// printLoggedEvents prints the events recorded in ha.stdout.log by the host agent that is no longer running.
+func printLoggedEvents(enc *json.Encoder, haStdoutPath string) error {
+	f, err := os.Open(haStdoutPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var ev hostagentevents.Event
+		if err := dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to decode %q: %w", haStdoutPath, err)
+		}
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+}
+
+func eventsBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
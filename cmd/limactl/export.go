@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const exportHelp = `Export a stopped instance as a portable archive
+
+The archive contains the configuration, the disks, and the firmware variables of the instance,
+along with a manifest. The archive can be imported on another machine with ` + "`limactl import`" + `.
+The additional disks are not exported.
+
+The archive is compressed with zstd (".tar.zst", ".tzst") or gzip (".tar.gz", ".tgz"),
+depending on the extension of the file name. ".tar" is not compressed.
+
+Example: limactl export default -o default.tar.zst
+`
+
+func newExportCommand() *cobra.Command {
+	exportCommand := &cobra.Command{
+		Use:               "export INSTANCE",
+		Short:             "Export a stopped instance as a portable archive",
+		Long:              exportHelp,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              exportAction,
+		ValidArgsFunction: exportBashComplete,
+		GroupID:           advancedCommand,
+	}
+	exportCommand.Flags().StringP("output", "o", "", "archive file to write (e.g., INSTANCE.tar.zst)")
+	return exportCommand
+}
+
+func exportAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = instName + ".tar.zst"
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist", instName)
+		}
+		return err
+	}
+	if err := instance.Export(cmd.Context(), inst, output); err != nil {
+		return err
+	}
+	logrus.Infof("Exported instance %q to %q", instName, output)
+	return nil
+}
+
+func exportBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
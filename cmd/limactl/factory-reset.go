@@ -27,9 +27,9 @@ func newFactoryResetCommand() *cobra.Command {
 }
 
 func factoryResetAction(_ *cobra.Command, args []string) error {
-	instName := DefaultInstanceName
-	if len(args) > 0 {
-		instName = args[0]
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
 	}
 
 	inst, err := store.Inspect(instName)
@@ -51,6 +51,7 @@ func factoryResetAction(_ *cobra.Command, args []string) error {
 		return err
 	}
 	retain := map[string]struct{}{
+		filenames.Metadata:     {},
 		filenames.LimaVersion:  {},
 		filenames.Protected:    {},
 		filenames.VzIdentifier: {},
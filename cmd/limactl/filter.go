@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func registerFilterFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArray("filter", nil, "select the instances matching the filter, e.g., \"label=team=infra\" (can be specified multiple times)")
+}
+
+// filterInstanceNames returns the instances in instNames that match all the filters specified with --filter.
+// instNames is returned as is when no filter is specified.
+func filterInstanceNames(cmd *cobra.Command, instNames []string) ([]string, error) {
+	ss, err := cmd.Flags().GetStringArray("filter")
+	if err != nil {
+		return nil, err
+	}
+	if len(ss) == 0 {
+		return instNames, nil
+	}
+	filters, err := store.ParseFilters(ss)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load instance %s: %w", instName, err)
+		}
+		if store.MatchFilters(inst, filters) {
+			res = append(res, instName)
+		}
+	}
+	return res, nil
+}
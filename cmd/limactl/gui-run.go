@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/lima-vm/lima/pkg/guiforward"
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const guiRunHelp = `Run a GUI application of the guest on the display of the host
+
+The application is displayed with one of the following backends:
+
+  x11      - X11 forwarding over SSH. XQuartz is launched on macOS when it is not running yet.
+  wayland  - Wayland forwarding over SSH with waypipe, which has to be installed on the host.
+  wslg     - the display server of WSLg, for the instances with vmType "wsl2".
+
+The backend is chosen automatically by default, in the order of wslg, wayland, and x11.
+The commands required in the guest for the backend (xauth or waypipe) are installed with the package manager of the guest,
+unless --install-deps=false is specified.
+
+The GUI toolkits (GTK, Qt, Firefox, SDL) are configured to use the backend, via the environment variables.
+
+Example: limactl gui-run default firefox
+`
+
+func newGUIRunCommand() *cobra.Command {
+	guiRunCmd := &cobra.Command{
+		Use:               "gui-run [flags] INSTANCE COMMAND [ARGS...]",
+		Short:             "Run a GUI application of the guest on the display of the host",
+		Long:              guiRunHelp,
+		Args:              WrapArgsError(cobra.MinimumNArgs(2)),
+		RunE:              guiRunAction,
+		ValidArgsFunction: guiRunBashComplete,
+		SilenceErrors:     true,
+		GroupID:           advancedCommand,
+	}
+	guiRunCmd.Flags().SetInterspersed(false)
+	guiRunCmd.Flags().String("backend", "auto", "backend, one of: auto, x11, wayland, wslg")
+	guiRunCmd.Flags().Bool("x11-trusted", true, "use the trusted X11 forwarding (ssh -Y), as many applications do not work with the untrusted one")
+	guiRunCmd.Flags().Bool("install-deps", true, "install the commands required in the guest for the backend")
+	return guiRunCmd
+}
+
+func guiRunAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+	if len(args) >= 3 && args[1] == "--" {
+		args = append(args[:1], args[2:]...)
+	}
+	backendStr, err := cmd.Flags().GetString("backend")
+	if err != nil {
+		return err
+	}
+	want, err := guiforward.ParseBackend(backendStr)
+	if err != nil {
+		return err
+	}
+	trusted, err := cmd.Flags().GetBool("x11-trusted")
+	if err != nil {
+		return err
+	}
+	installDeps, err := cmd.Flags().GetBool("install-deps")
+	if err != nil {
+		return err
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+		}
+		return err
+	}
+	if inst.Status != store.StatusRunning {
+		return fmt.Errorf("instance %q is not running (status: %s), run `limactl start %s` to start the instance", instName, inst.Status, instName)
+	}
+
+	host := guiforward.DetectHost()
+	backend, err := host.Backend(inst.VMType, want)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("GUI backend: %q", backend)
+	if backend == guiforward.X11 && host.Display == "" {
+		display, err := guiforward.StartXQuartz(cmd.Context())
+		if err != nil {
+			return err
+		}
+		// ssh connects to $DISPLAY
+		if err := os.Setenv("DISPLAY", display); err != nil {
+			return err
+		}
+	}
+
+	sshExe, err := exec.LookPath("ssh")
+	if err != nil {
+		return err
+	}
+	if script := guiforward.PrepareScript(backend); script != "" && installDeps {
+		sshArgs, err := guiRunSSHArgs(inst, false, false)
+		if err != nil {
+			return err
+		}
+		prepareCmd := exec.CommandContext(cmd.Context(), sshExe, append(sshArgs, "--", script)...)
+		prepareCmd.Stdout = os.Stderr
+		prepareCmd.Stderr = os.Stderr
+		logrus.Debugf("executing ssh for preparing the guest: %+v", prepareCmd.Args)
+		if err := prepareCmd.Run(); err != nil {
+			return fmt.Errorf("failed to prepare the guest for backend %q: %w", backend, err)
+		}
+	}
+
+	sshArgs, err := guiRunSSHArgs(inst, backend == guiforward.X11, backend == guiforward.X11 && trusted)
+	if err != nil {
+		return err
+	}
+	remoteCmd := "sh -c " + shellescape.Quote(guiforward.RunScript(backend, args[1:]))
+	var runCmd *exec.Cmd
+	if backend == guiforward.Wayland {
+		waypipeExe, err := exec.LookPath("waypipe")
+		if err != nil {
+			return err
+		}
+		// waypipe inserts `waypipe server --` after the destination, so "--" must not be specified
+		runCmd = exec.CommandContext(cmd.Context(), waypipeExe, append(append([]string{"ssh"}, sshArgs...), remoteCmd)...)
+	} else {
+		runCmd = exec.CommandContext(cmd.Context(), sshExe, append(sshArgs, "--", remoteCmd)...)
+	}
+	runCmd.Stdin = os.Stdin
+	runCmd.Stdout = os.Stdout
+	runCmd.Stderr = os.Stderr
+	logrus.Debugf("executing %+v", runCmd.Args)
+	return runCmd.Run()
+}
+
+// guiRunSSHArgs returns the ssh arguments for connecting to the instance, ending with the destination.
+func guiRunSSHArgs(inst *store.Instance, forwardX11, forwardX11Trusted bool) ([]string, error) {
+	sshOpts, err := sshutil.SSHOpts(
+		inst.Dir,
+		*inst.Config.User.Name,
+		*inst.Config.SSH.LoadDotSSHPubKeys,
+		*inst.Config.SSH.ForwardAgent,
+		forwardX11,
+		forwardX11Trusted)
+	if err != nil {
+		return nil, err
+	}
+	// The X11 connections of a multiplexed session are forwarded to the display of the control master,
+	// which may not be the display of this session, so each connection is made directly.
+	sshOpts = slices.DeleteFunc(sshOpts, func(opt string) bool {
+		return strings.HasPrefix(opt, "ControlMaster=") || strings.HasPrefix(opt, "ControlPath=") || strings.HasPrefix(opt, "ControlPersist=")
+	})
+	sshArgs := sshutil.SSHArgsFromOpts(sshOpts)
+	return append(sshArgs,
+		"-o", "LogLevel=ERROR",
+		"-p", strconv.Itoa(inst.SSHLocalPort),
+		inst.SSHAddress,
+	), nil
+}
+
+func guiRunBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
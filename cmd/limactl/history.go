@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCommand() *cobra.Command {
+	historyCommand := &cobra.Command{
+		Use: "history INSTANCE",
+		Example: `
+To show the lifecycle events of the instance:
+$ limactl history default
+
+To show the changes of lima.yaml during the last week:
+$ limactl history --diff --since 168h default
+`,
+		Short: "Show the lifecycle history of an instance",
+		Long: `Show the lifecycle history of an instance: the creation (with the template and its digest),
+the starts and stops, the edits of lima.yaml, the snapshots, and the upgrades of Lima.
+
+The history is recorded in history.jsonl in the instance directory.
+The instances created by older versions of Lima have no history prior to the upgrade.`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              historyAction,
+		ValidArgsFunction: historyBashComplete,
+		GroupID:           advancedCommand,
+	}
+	historyCommand.Flags().Bool("json", false, "JSONify output")
+	historyCommand.Flags().Bool("diff", false, "print the diffs of lima.yaml")
+	historyCommand.Flags().String("since", "", "show the events since a duration ago (e.g., 24h) or a date (e.g., 2006-01-02, or RFC 3339)")
+	return historyCommand
+}
+
+func historyAction(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	jsonFormat, err := flags.GetBool("json")
+	if err != nil {
+		return err
+	}
+	showDiff, err := flags.GetBool("diff")
+	if err != nil {
+		return err
+	}
+	sinceStr, err := flags.GetString("since")
+	if err != nil {
+		return err
+	}
+	var since time.Time
+	if sinceStr != "" {
+		if since, err = parseSince(sinceStr, time.Now()); err != nil {
+			return err
+		}
+	}
+	instName := args[0]
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist", instName)
+		}
+		return err
+	}
+	entries, err := history.Read(inst.Dir)
+	if err != nil {
+		return err
+	}
+	var filtered []history.Entry
+	for _, e := range entries {
+		if e.Time.Before(since) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	w := cmd.OutOrStdout()
+	if jsonFormat {
+		enc := json.NewEncoder(w)
+		for _, e := range filtered {
+			if !showDiff {
+				e.Diff = ""
+			}
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if showDiff {
+		return printHistoryDiffs(w, filtered)
+	}
+	tw := tabwriter.NewWriter(w, 4, 8, 4, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tEVENT\tDETAILS")
+	for _, e := range filtered {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Event, historyDetails(e))
+	}
+	return tw.Flush()
+}
+
+// printHistoryDiffs prints the edits of lima.yaml in the format of `git log -p`.
+func printHistoryDiffs(w io.Writer, entries []history.Entry) error {
+	for _, e := range entries {
+		if e.Diff == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%s %s: %s (Lima %s)\n", e.Time.Local().Format(time.DateTime), e.Event, historyDetails(e), e.LimaVersion)
+		fmt.Fprintln(w, strings.TrimSuffix(e.Diff, "\n"))
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func historyDetails(e history.Entry) string {
+	var details []string
+	switch e.Event {
+	case history.EventCreate:
+		if e.Template != "" {
+			details = append(details, "from "+e.Template)
+		}
+	case history.EventStart:
+		details = append(details, "Lima "+e.LimaVersion)
+	case history.EventEdit:
+		added, removed := history.DiffStat(e.Diff)
+		details = append(details, fmt.Sprintf("+%d -%d", added, removed))
+	}
+	if e.Digest != "" {
+		details = append(details, e.Digest[:min(len(e.Digest), len("sha256:")+12)])
+	}
+	if e.Message != "" {
+		details = append(details, e.Message)
+	}
+	return strings.Join(details, ", ")
+}
+
+// parseSince parses either a duration before now, or a date.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: must be a duration (e.g., 24h) or a date (e.g., 2006-01-02)", s)
+}
+
+func historyBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/lima-vm/lima/pkg/autostart"
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newHostServiceCommand() *cobra.Command {
+	hostServiceCommand := &cobra.Command{
+		Use:   "host-service",
+		Short: "Publish guest ports as services of the host",
+		Long: `Publish the guest ports of the "portForwards" rules with "hostService: true" as socket-activated
+services of the host (launchd agents on macOS, systemd user units on Linux).
+
+The host keeps listening on the host ports after the instance or limactl has stopped,
+and the instance is started on demand by the first connection.`,
+		Example: `  To publish the ports of the instance "default":
+  $ limactl host-service install default
+
+  To list the published ports:
+  $ limactl host-service list`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		GroupID:       advancedCommand,
+	}
+	hostServiceCommand.AddCommand(
+		newHostServiceInstallCommand(),
+		newHostServiceUninstallCommand(),
+		newHostServiceListCommand(),
+		newHostServiceConnectCommand(),
+	)
+	return hostServiceCommand
+}
+
+func newHostServiceInstallCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "install INSTANCE",
+		Short:             "Register the host services of the instance",
+		Long:              "Register the host services of the instance, and remove the ones that are no longer in the portForwards rules.",
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              hostServiceInstallAction,
+		ValidArgsFunction: hostServiceBashComplete,
+	}
+}
+
+// hostServices returns the host services of the "portForwards" rules of the instance.
+func hostServices(inst *store.Instance) []autostart.HostService {
+	var res []autostart.HostService
+	for _, rule := range inst.Config.PortForwards {
+		if !rule.HostService {
+			continue
+		}
+		guestIP := rule.GuestIP
+		if guestIP.IsUnspecified() {
+			guestIP = net.IPv4(127, 0, 0, 1)
+		}
+		res = append(res, autostart.HostService{
+			Instance:  inst.Name,
+			HostIP:    rule.HostIP.String(),
+			HostPort:  rule.HostPort,
+			GuestIP:   guestIP.String(),
+			GuestPort: rule.GuestPort,
+		})
+	}
+	return res
+}
+
+func hostServiceInstallAction(_ *cobra.Command, args []string) error {
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	limaHome, err := dirnames.LimaDir()
+	if err != nil {
+		return err
+	}
+	svcs := hostServices(inst)
+	if len(svcs) == 0 {
+		logrus.Warnf("Instance %q has no portForwards rules with `hostService: true`", inst.Name)
+	}
+	var errs []error
+	for _, svc := range svcs {
+		if err := autostart.CreateHostService(runtime.GOOS, svc, limaHome, filepath.Join(inst.Dir, filenames.HostServiceStderrLog)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to register the host service for port %d: %w", svc.HostPort, err))
+			continue
+		}
+		logrus.Infof("Published %s:%d of instance %q on %s:%d", svc.GuestIP, svc.GuestPort, inst.Name, svc.HostIP, svc.HostPort)
+	}
+	ports, err := autostart.HostServicePorts(runtime.GOOS, inst.Name)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, port := range ports {
+		if slices.ContainsFunc(svcs, func(svc autostart.HostService) bool { return svc.HostPort == port }) {
+			continue
+		}
+		if err := autostart.DeleteHostService(runtime.GOOS, inst.Name, port); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove the host service for port %d: %w", port, err))
+			continue
+		}
+		logrus.Infof("Removed the host service for port %d of instance %q", port, inst.Name)
+	}
+	return errors.Join(errs...)
+}
+
+func newHostServiceUninstallCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "uninstall INSTANCE",
+		Short:             "Remove the host services of the instance",
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              hostServiceUninstallAction,
+		ValidArgsFunction: hostServiceBashComplete,
+	}
+}
+
+func hostServiceUninstallAction(_ *cobra.Command, args []string) error {
+	return deleteHostServices(args[0])
+}
+
+// deleteHostServices removes all the host services of the instance, including the ones of the rules that were removed.
+func deleteHostServices(instName string) error {
+	ports, err := autostart.HostServicePorts(runtime.GOOS, instName)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, port := range ports {
+		if err := autostart.DeleteHostService(runtime.GOOS, instName, port); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove the host service for port %d: %w", port, err))
+			continue
+		}
+		logrus.Infof("Removed the host service for port %d of instance %q", port, instName)
+	}
+	return errors.Join(errs...)
+}
+
+func newHostServiceListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "list [INSTANCE, ...]",
+		Short:             "List the host services",
+		Aliases:           []string{"ls"},
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              hostServiceListAction,
+		ValidArgsFunction: hostServiceBashComplete,
+	}
+}
+
+func hostServiceListAction(cmd *cobra.Command, args []string) error {
+	instNames := args
+	if len(instNames) == 0 {
+		var err error
+		instNames, err = store.Instances()
+		if err != nil {
+			return err
+		}
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "INSTANCE\tHOST\tGUEST\tSTATUS")
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return err
+		}
+		ports, err := autostart.HostServicePorts(runtime.GOOS, instName)
+		if err != nil {
+			return err
+		}
+		for _, svc := range hostServices(inst) {
+			status := "Not installed"
+			if slices.Contains(ports, svc.HostPort) {
+				status = "Installed"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", instName,
+				net.JoinHostPort(svc.HostIP, strconv.Itoa(svc.HostPort)),
+				net.JoinHostPort(svc.GuestIP, strconv.Itoa(svc.GuestPort)), status)
+		}
+		for _, port := range ports {
+			if !slices.ContainsFunc(hostServices(inst), func(svc autostart.HostService) bool { return svc.HostPort == port }) {
+				fmt.Fprintf(w, "%s\t%d\t-\tStale (run `limactl host-service install %s`)\n", instName, port, instName)
+			}
+		}
+	}
+	return w.Flush()
+}
+
+func newHostServiceConnectCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:    "connect INSTANCE GUEST_ADDRESS",
+		Short:  "Connect stdio to the guest address, starting the instance if needed (used by the host services)",
+		Args:   WrapArgsError(cobra.ExactArgs(2)),
+		RunE:   hostServiceConnectAction,
+		Hidden: true,
+	}
+}
+
+func hostServiceConnectAction(cmd *cobra.Command, args []string) error {
+	instName, guestAddress := args[0], args[1]
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if inst.Status != store.StatusRunning {
+		limaHome, err := dirnames.LimaDir()
+		if err != nil {
+			return err
+		}
+		// Serialize the on-demand starts by the concurrent connections.
+		// The instance directory cannot be locked, as the metadata of the instance is updated under its lock.
+		err = lockutil.WithDirLock(limaHome, func() error {
+			inst, err = store.Inspect(instName)
+			if err != nil || inst.Status == store.StatusRunning {
+				return err
+			}
+			logrus.Infof("Starting instance %q on demand", instName)
+			return instance.Start(cmd.Context(), inst, "", false)
+		})
+		if err != nil {
+			return err
+		}
+		if inst, err = store.Inspect(instName); err != nil {
+			return err
+		}
+	}
+	sshExe, err := exec.LookPath("ssh")
+	if err != nil {
+		return err
+	}
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *inst.Config.User.Name, *inst.Config.SSH.LoadDotSSHPubKeys, false, false, false)
+	if err != nil {
+		return err
+	}
+	sshArgs := append(sshutil.SSHArgsFromOpts(sshOpts),
+		"-o", "LogLevel=ERROR",
+		"-p", strconv.Itoa(inst.SSHLocalPort),
+		"-W", guestAddress,
+		inst.SSHAddress,
+	)
+	sshCmd := exec.CommandContext(cmd.Context(), sshExe, sshArgs...)
+	sshCmd.Stdin = os.Stdin
+	sshCmd.Stdout = os.Stdout
+	sshCmd.Stderr = os.Stderr
+	logrus.Debugf("executing ssh: %+v", sshCmd.Args)
+	return sshCmd.Run()
+}
+
+func hostServiceBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
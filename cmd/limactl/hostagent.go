@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,11 @@ import (
 
 	"github.com/lima-vm/lima/pkg/hostagent"
 	"github.com/lima-vm/lima/pkg/hostagent/api/server"
+	"github.com/lima-vm/lima/pkg/instance"
+	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -26,10 +32,11 @@ func newHostagentCommand() *cobra.Command {
 		RunE:   hostagentAction,
 		Hidden: true,
 	}
-	hostagentCommand.Flags().StringP("pidfile", "p", "", "write pid to file")
+	hostagentCommand.Flags().StringP("pidfile", "p", "", "write pid to file, in addition to the metadata of the instance")
 	hostagentCommand.Flags().String("socket", "", "hostagent socket")
 	hostagentCommand.Flags().Bool("run-gui", false, "run gui synchronously within hostagent")
 	hostagentCommand.Flags().String("nerdctl-archive", "", "local file path (not URL) of nerdctl-full-VERSION-GOOS-GOARCH.tar.gz")
+	hostagentCommand.Flags().Int("metrics-port", 0, "serve the metrics of the guest in the Prometheus format on 127.0.0.1:PORT")
 	return hostagentCommand
 }
 
@@ -56,6 +63,28 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 	}
 
 	instName := args[0]
+	instDir, err := store.InstanceDir(instName)
+	if err != nil {
+		return err
+	}
+	if err := metadata.Update(instDir, func(m *metadata.Metadata) error {
+		if m.HostAgentPID != 0 && m.HostAgentPID != os.Getpid() {
+			exists, err := store.ProcessExists(m.HostAgentPID)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("another host agent (PID %d) seems running", m.HostAgentPID)
+			}
+		}
+		m.HostAgentPID = os.Getpid()
+		m.SSHAddress = ""
+		m.SSHLocalPort = 0
+		return nil
+	}); err != nil {
+		return err
+	}
+	defer clearHostAgentMetadata(instDir)
 
 	runGUI, err := cmd.Flags().GetBool("run-gui")
 	if err != nil {
@@ -82,6 +111,13 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 	if nerdctlArchive != "" {
 		opts = append(opts, hostagent.WithNerdctlArchive(nerdctlArchive))
 	}
+	metricsPort, err := cmd.Flags().GetInt("metrics-port")
+	if err != nil {
+		return err
+	}
+	if metricsPort != 0 {
+		opts = append(opts, hostagent.WithMetricsPort(metricsPort))
+	}
 	ha, err := hostagent.New(instName, stdout, signalCh, opts...)
 	if err != nil {
 		return err
@@ -109,7 +145,40 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 			logrus.WithError(serveErr).Warn("hostagent API server exited with an error")
 		}
 	}()
-	return ha.Run(cmd.Context())
+	history.RecordStart(instDir)
+	err = ha.Run(cmd.Context())
+	// the instance is no longer running
+	stopped := history.Entry{Event: history.EventStop}
+	if err != nil {
+		stopped.Message = err.Error()
+	}
+	history.Record(instDir, stopped)
+	if pidfile != "" {
+		_ = os.RemoveAll(pidfile)
+	}
+	if inst, inspectErr := store.Inspect(instName); inspectErr == nil {
+		instance.StopTunnels(inst)
+	}
+	clearHostAgentMetadata(instDir)
+	if releaseErr := networks.Release(context.Background(), instName); releaseErr != nil {
+		logrus.WithError(releaseErr).Warn("Failed to stop the networks that are no longer used")
+	}
+	return err
+}
+
+// clearHostAgentMetadata removes the PID of the host agent, the SSH address, and the tunnels from the metadata of the instance.
+func clearHostAgentMetadata(instDir string) {
+	if err := metadata.Update(instDir, func(m *metadata.Metadata) error {
+		if m.HostAgentPID == os.Getpid() {
+			m.HostAgentPID = 0
+			m.SSHAddress = ""
+			m.SSHLocalPort = 0
+			m.Tunnels = nil
+		}
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Warn("Failed to update the metadata of the instance")
+	}
 }
 
 // syncer is implemented by *os.File.
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/fileutils"
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/templatestore"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newImageCommand() *cobra.Command {
+	imageCommand := &cobra.Command{
+		Use:   "image",
+		Short: "Manage the disk images distributed via OCI registries",
+		Example: `  Push the disk of a stopped instance, along with its configuration:
+  $ limactl image push ghcr.io/org/dev-base:2024.06 dev-base
+
+  Create an instance from the pushed image:
+  $ limactl start oci://ghcr.io/org/dev-base:2024.06`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		GroupID:       advancedCommand,
+	}
+	imageCommand.AddCommand(
+		newImagePushCommand(),
+	)
+	return imageCommand
+}
+
+func newImagePushCommand() *cobra.Command {
+	imagePushCommand := &cobra.Command{
+		Use:   "push REF INSTANCE|FILE",
+		Short: "Push a disk image to an OCI registry",
+		Long: `Push a disk image to an OCI registry as an OCI artifact.
+
+When INSTANCE is specified, the disk of the stopped instance is pushed as a standalone image,
+along with the lima.yaml of the instance as a template that refers to the pushed image with its digest.
+The instance should be cleaned up (e.g., ` + "`sudo cloud-init clean --logs`" + `) before stopping it,
+so that the instances created from the image run the provisioning scripts again.
+
+When FILE is specified, the disk image file is pushed as is, optionally with the template specified with --template.
+
+The pushed artifact can be used as ` + "`images[].location: oci://REF`" + ` in templates,
+and as the template locator of ` + "`limactl start oci://REF`" + ` when it contains a template.
+The reference is printed with the digest of the manifest, for pinning the artifact.
+
+The credentials in ~/.docker/config.json (including credHelpers and credsStore) are used for pushing.`,
+		Example: `  Push the disk of the stopped instance "dev-base":
+  $ limactl image push ghcr.io/org/dev-base:2024.06 dev-base
+
+  Push a disk image file, with a template:
+  $ limactl image push --template=dev-base.yaml ghcr.io/org/dev-base:2024.06 dev-base.qcow2`,
+		Args:              WrapArgsError(cobra.ExactArgs(2)),
+		RunE:              imagePushAction,
+		ValidArgsFunction: imagePushBashComplete,
+	}
+	imagePushCommand.Flags().String("template", "", "template to be pushed along with the disk image FILE")
+	return imagePushCommand
+}
+
+func imagePushAction(cmd *cobra.Command, args []string) error {
+	ref, source := strings.TrimPrefix(args[0], fileutils.OCIScheme), args[1]
+	templatePath, err := cmd.Flags().GetString("template")
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	tmpDir, err := os.MkdirTemp("", "lima-image-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	disk := fileutils.OCILayer{MediaType: fileutils.DiskMediaType}
+	layers := []fileutils.OCILayer{}
+	if st, err := os.Stat(source); err == nil && !st.IsDir() {
+		disk.Path = source
+		layers = append(layers, disk)
+		if templatePath != "" {
+			layers = append(layers, fileutils.OCILayer{MediaType: templatestore.TemplateMediaType, Path: templatePath})
+		}
+	} else {
+		if templatePath != "" {
+			return errors.New("--template cannot be specified for an instance, as the lima.yaml of the instance is pushed")
+		}
+		inst, err := store.Inspect(source)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("%q is neither an instance nor a file", source)
+			}
+			return err
+		}
+		disk.Path = filepath.Join(tmpDir, inst.Name+".img")
+		if err := instance.ExportDisk(ctx, inst, disk.Path); err != nil {
+			return err
+		}
+		if disk.Digest, err = fileutils.ComputeDigest(disk.Path); err != nil {
+			return err
+		}
+		tmpl, err := instance.ImageTemplate(inst, fileutils.OCIScheme+ref, disk.Digest)
+		if err != nil {
+			return err
+		}
+		tmplPath := filepath.Join(tmpDir, "lima.yaml")
+		if err := os.WriteFile(tmplPath, tmpl, 0o644); err != nil {
+			return err
+		}
+		layers = append(layers, disk, fileutils.OCILayer{MediaType: templatestore.TemplateMediaType, Path: tmplPath})
+	}
+
+	manifest, descs, err := fileutils.PushOCI(ctx, ref, layers)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Pushed the disk image %q (%s) to %q", filepath.Base(disk.Path), descs[0].Digest, ref)
+	_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s%s@%s\n", fileutils.OCIScheme, ref, manifest.Digest)
+	return err
+}
+
+func imagePushBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 1 {
+		instances, _ := bashCompleteInstanceNames(cmd)
+		return instances, cobra.ShellCompDirectiveDefault
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
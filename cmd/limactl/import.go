@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const importHelp = `Import an instance from an archive written by ` + "`limactl export`" + `
+
+The name of the instance defaults to the name of the exported instance.
+When the driver of the imported instance cannot use the disk format of the exported instance,
+e.g., an instance exported from QEMU is imported as a VZ instance, the disk is converted.
+
+Example: limactl import default.tar.zst --name=default2
+`
+
+func newImportCommand() *cobra.Command {
+	importCommand := &cobra.Command{
+		Use:     "import FILE",
+		Short:   "Import an instance from an archive written by `limactl export`",
+		Long:    importHelp,
+		Args:    WrapArgsError(cobra.ExactArgs(1)),
+		RunE:    importAction,
+		GroupID: advancedCommand,
+	}
+	importCommand.Flags().String("name", "", "name of the instance (defaults to the name of the exported instance)")
+	return importCommand
+}
+
+func importAction(cmd *cobra.Command, args []string) error {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	inst, err := instance.Import(cmd.Context(), args[0], name)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Imported instance %q", inst.Name)
+	logrus.Infof("Run `limactl start %s` to start the instance.", inst.Name)
+	return nil
+}
@@ -2,32 +2,133 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/lima-vm/lima/pkg/infoutil"
+	"github.com/lima-vm/lima/pkg/plugin"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 func newInfoCommand() *cobra.Command {
 	infoCommand := &cobra.Command{
-		Use:     "info",
-		Short:   "Show diagnostic information",
-		Args:    WrapArgsError(cobra.NoArgs),
-		RunE:    infoAction,
-		GroupID: advancedCommand,
+		Use: "info [INSTANCE]",
+		Example: `
+To show the diagnostic information:
+$ limactl info
+
+To show the diagnostic information, including the sections contributed by plugins:
+$ limactl info --plugins
+
+To show the SSH port of an instance:
+$ limactl info default --field ssh.localPort
+
+To show the location of the first mount of an instance:
+$ limactl info default --field config.mounts[0].location
+`,
+		Short: "Show diagnostic information",
+		Long: `Show diagnostic information.
+
+When INSTANCE is specified, the information of the instance is shown, in the same format as ` + "`limactl list --json`" + `.
+
+The --field flag prints the value at a dot-separated path into the JSON, e.g., "version", "config.mounts[0].location".
+Strings are printed without quotes, and objects and arrays are printed as JSON.
+For an instance, a path that does not exist at the top level is also looked up in ".config",
+so "ssh.localPort" is equivalent to "config.ssh.localPort".
+The exit code is 2 when the field does not exist.
+
+With --plugins, plugins ("limactl-NAME" executables in $PATH) may contribute sections to ".plugins.NAME"
+by implementing the "lima-plugin-info" subcommand that prints a JSON object.`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              infoAction,
+		ValidArgsFunction: infoBashComplete,
+		GroupID:           advancedCommand,
 	}
+	infoCommand.Flags().String("field", "", "print only the value at the dot-separated path, e.g., \"config.mounts[0].location\"")
+	infoCommand.Flags().Bool("plugins", false, "Show the sections contributed by plugins (\"limactl-NAME\" executables in $PATH that implement \"lima-plugin-info\")")
 	return infoCommand
 }
 
-func infoAction(cmd *cobra.Command, _ []string) error {
-	info, err := infoutil.GetInfo()
+// fieldNotFoundError is returned by `limactl info --field` when the field does not exist.
+type fieldNotFoundError struct{}
+
+// Error implements error.
+func (fieldNotFoundError) Error() string {
+	return "field not found"
+}
+
+// ExitCode implements ExitCoder.
+func (fieldNotFoundError) ExitCode() int {
+	return 2
+}
+
+func infoAction(cmd *cobra.Command, args []string) error {
+	field, err := cmd.Flags().GetString("field")
+	if err != nil {
+		return err
+	}
+	showPlugins, err := cmd.Flags().GetBool("plugins")
+	if err != nil {
+		return err
+	}
+	var v any
+	if len(args) > 0 {
+		inst, err := store.Inspect(args[0])
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("instance %q does not exist", args[0])
+			}
+			return err
+		}
+		// The port assigned on start, rather than 0 for the automatic assignment
+		if inst.Config != nil && inst.SSHLocalPort != 0 {
+			*inst.Config.SSH.LocalPort = inst.SSHLocalPort
+		}
+		v = inst
+	} else {
+		info, err := infoutil.GetInfo()
+		if err != nil {
+			return err
+		}
+		if showPlugins {
+			info.Plugins = plugin.Infos(cmd.Context())
+		}
+		v = info
+	}
+	if !cmd.Flags().Changed("field") {
+		j, err := json.MarshalIndent(v, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), string(j))
+		return err
+	}
+	value, err := infoutil.Field(v, field)
+	if errors.Is(err, infoutil.ErrFieldNotFound) && len(args) > 0 {
+		value, err = infoutil.Field(v, "config."+strings.TrimPrefix(field, "."))
+	}
 	if err != nil {
+		if errors.Is(err, infoutil.ErrFieldNotFound) {
+			logrus.Errorf("field %q does not exist", field)
+			return fieldNotFoundError{}
+		}
 		return err
 	}
-	j, err := json.MarshalIndent(info, "", "    ")
+	s, err := infoutil.FormatField(value)
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(j))
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), s)
 	return err
 }
+
+func infoBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return bashCompleteInstanceNames(cmd)
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/cheggaaa/pb/v3/termutil"
+	"github.com/lima-vm/lima/pkg/plugin"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/mattn/go-isatty"
 	"github.com/sirupsen/logrus"
@@ -46,6 +49,7 @@ The output can be presented in one of several formats, using the --format <forma
   --format table - output in table format
   --format '{{ <go template> }}' - if the format begins and ends with '{{ }}', then it is used as a go template.
 ` + store.FormatHelp + `
+` + store.FilterHelp + `
 The following legacy flags continue to function:
   --json - equal to '--format json'`,
 		Args:              WrapArgsError(cobra.ArbitraryArgs),
@@ -59,6 +63,8 @@ The following legacy flags continue to function:
 	listCommand.Flags().Bool("json", false, "JSONify output")
 	listCommand.Flags().BoolP("quiet", "q", false, "Only show names")
 	listCommand.Flags().Bool("all-fields", false, "Show all fields")
+	listCommand.Flags().Bool("plugins", false, "Show the columns contributed by plugins (\"limactl-NAME\" executables in $PATH that implement \"lima-plugin-list\")")
+	registerFilterFlag(listCommand)
 
 	return listCommand
 }
@@ -155,6 +161,10 @@ func listAction(cmd *cobra.Command, args []string) error {
 	} else {
 		instanceNames = allinstances
 	}
+	instanceNames, err = filterInstanceNames(cmd, instanceNames)
+	if err != nil {
+		return err
+	}
 
 	if quiet {
 		for _, instName := range instanceNames {
@@ -180,6 +190,14 @@ func listAction(cmd *cobra.Command, args []string) error {
 		if len(instance.Errors) > 0 {
 			logrus.WithField("errors", instance.Errors).Warnf("instance %q has errors", instance.Name)
 		}
+		if f := instance.DriverFailure; f != nil {
+			logrus.WithField("reason", f.Reason).Warnf("the driver of instance %q failed unexpectedly at %s (restarts: %d)",
+				instance.Name, f.Time.Format(time.RFC3339), f.Restarts)
+		}
+		if c := instance.Crash; c != nil {
+			logrus.WithField("message", c.Message).Warnf("the guest kernel of instance %q panicked at %s (artifacts: %s)",
+				instance.Name, c.Time.Format(time.RFC3339), c.Dir)
+		}
 	}
 
 	allFields, err := cmd.Flags().GetBool("all-fields")
@@ -188,6 +206,13 @@ func listAction(cmd *cobra.Command, args []string) error {
 	}
 
 	options := store.PrintOptions{AllFields: allFields}
+	showPlugins, err := cmd.Flags().GetBool("plugins")
+	if err != nil {
+		return err
+	}
+	if showPlugins {
+		options.PluginColumns = listPluginColumns(cmd.Context(), instances)
+	}
 	out := cmd.OutOrStdout()
 	if out == os.Stdout {
 		if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
@@ -204,6 +229,35 @@ func listAction(cmd *cobra.Command, args []string) error {
 	return err
 }
 
+// listPluginColumns populates instances[*].Plugins and returns the plugin columns.
+// Plugins that fail are skipped.
+func listPluginColumns(ctx context.Context, instances []*store.Instance) []store.PluginColumn {
+	instNames := make([]string, len(instances))
+	for i, inst := range instances {
+		instNames[i] = inst.Name
+	}
+	var columns []store.PluginColumn
+	for _, p := range plugin.Discover() {
+		out, err := p.List(ctx, instNames)
+		if err != nil {
+			logrus.WithError(err).Debugf("Plugin %q does not provide columns", p.Name)
+			continue
+		}
+		for _, c := range out.Columns {
+			columns = append(columns, store.PluginColumn{Plugin: p.Name, Name: c})
+		}
+		for _, inst := range instances {
+			if values, ok := out.Instances[inst.Name]; ok {
+				if inst.Plugins == nil {
+					inst.Plugins = make(map[string]map[string]string)
+				}
+				inst.Plugins[p.Name] = values
+			}
+		}
+	}
+	return columns
+}
+
 func listBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	return bashCompleteInstanceNames(cmd)
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/logrotate"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/spf13/cobra"
+)
+
+func newLogsCommand() *cobra.Command {
+	logsCommand := &cobra.Command{
+		Use: "logs [INSTANCE]",
+		Example: `
+To show the logs of the host agent:
+$ limactl logs default
+
+To show the serial console logs, including the rotated ones:
+$ limactl logs --serial default
+`,
+		Short: "Show the logs of an instance",
+		Long: `Show the logs of an instance.
+
+By default, the logs of the host agent ("ha.stderr.log") are shown.
+
+With --serial, the serial console logs ("serial*.log") are shown, from the oldest rotated log.
+The serial console logs are rotated when they grow larger than ` + "`serialLog.maxSize`" + ` in lima.yaml,
+and ` + "`serialLog.maxFiles`" + ` rotated logs are retained for each console.
+The logs of the consoles that are not used by the driver do not exist.`,
+		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		RunE:              logsAction,
+		ValidArgsFunction: logsBashComplete,
+		GroupID:           advancedCommand,
+	}
+	logsCommand.Flags().Bool("serial", false, "show the serial console logs")
+	return logsCommand
+}
+
+func logsAction(cmd *cobra.Command, args []string) error {
+	serial, err := cmd.Flags().GetBool("serial")
+	if err != nil {
+		return err
+	}
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist", instName)
+		}
+		return err
+	}
+	w := cmd.OutOrStdout()
+	if !serial {
+		return catFile(w, filepath.Join(inst.Dir, filenames.HostAgentStderrLog))
+	}
+	var consoles [][]string
+	for _, name := range filenames.SerialLogs() {
+		if files := logrotate.Files(filepath.Join(inst.Dir, name)); len(files) > 0 {
+			consoles = append(consoles, files)
+		}
+	}
+	for i, files := range consoles {
+		// Print the headers like tail(1), only when there are multiple consoles
+		if len(consoles) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "==> %s <==\n", filepath.Base(files[len(files)-1]))
+		}
+		for _, f := range files {
+			if err := catFile(w, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// catFile copies the file to w. A file that does not exist is skipped.
+func catFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func logsBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -9,8 +9,12 @@ import (
 	"strings"
 
 	"github.com/lima-vm/lima/pkg/debugutil"
+	"github.com/lima-vm/lima/pkg/downloader"
 	"github.com/lima-vm/lima/pkg/fsutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/progress"
+	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/version"
 	"github.com/mattn/go-isatty"
@@ -19,7 +23,7 @@ import (
 )
 
 const (
-	DefaultInstanceName = "default"
+	DefaultInstanceName = store.DefaultInstanceName
 	basicCommand        = "basic"
 	advancedCommand     = "advanced"
 )
@@ -62,6 +66,8 @@ func newApp() *cobra.Command {
 	}
 	rootCmd.PersistentFlags().String("log-level", "", "Set the logging level [trace, debug, info, warn, error]")
 	rootCmd.PersistentFlags().String("log-format", "text", "Set the logging format [text, json]")
+	rootCmd.PersistentFlags().String("progress", progress.ModeAuto, "Set the progress output [auto, fancy, plain, json, quiet]")
+	rootCmd.PersistentFlags().String("download-limit", "", "Limit the bandwidth of downloading images and archives, e.g., \"10MiB\" (per second)")
 	rootCmd.PersistentFlags().Bool("debug", false, "debug mode")
 	// TODO: "survey" does not support using cygwin terminal on windows yet
 	rootCmd.PersistentFlags().Bool("tty", isatty.IsTerminal(os.Stdout.Fd()), "Enable TUI interactions such as opening an editor. Defaults to true when stdout is a terminal. Set to false for automation.")
@@ -92,6 +98,18 @@ func newApp() *cobra.Command {
 			return fmt.Errorf("unsupported log-format: %q", logFormat)
 		}
 
+		progressMode, _ := cmd.Flags().GetString("progress")
+		if err := progress.SetMode(progressMode); err != nil {
+			return err
+		}
+
+		downloadLimit, _ := cmd.Flags().GetString("download-limit")
+		downloadBytesPerSec, err := limayaml.ParseBandwidth(downloadLimit)
+		if err != nil {
+			return fmt.Errorf("invalid --download-limit %q: %w", downloadLimit, err)
+		}
+		downloader.SetRateLimit(downloadBytesPerSec)
+
 		debug, _ := cmd.Flags().GetBool("debug")
 		if debug {
 			logrus.SetLevel(logrus.DebugLevel)
@@ -134,7 +152,11 @@ func newApp() *cobra.Command {
 		newCreateCommand(),
 		newStartCommand(),
 		newStopCommand(),
+		newRestartCommand(),
+		newSuspendCommand(),
+		newResumeCommand(),
 		newShellCommand(),
+		newGUIRunCommand(),
 		newCopyCommand(),
 		newListCommand(),
 		newDeleteCommand(),
@@ -145,10 +167,13 @@ func newApp() *cobra.Command {
 		newInfoCommand(),
 		newShowSSHCommand(),
 		newDebugCommand(),
+		newDefaultCommand(),
 		newEditCommand(),
 		newFactoryResetCommand(),
 		newDiskCommand(),
 		newUsernetCommand(),
+		newNetworkCommand(),
+		newPathCommand(),
 		newGenDocCommand(),
 		newGenSchemaCommand(),
 		newSnapshotCommand(),
@@ -156,10 +181,27 @@ func newApp() *cobra.Command {
 		newUnprotectCommand(),
 		newTunnelCommand(),
 		newTemplateCommand(),
+		newUpgradeCommand(),
+		newStatsCommand(),
+		newUpdateCommand(),
+		newWaitCommand(),
+		newExportCommand(),
+		newImportCommand(),
+		newCloneCommand(),
+		newStorageCommand(),
+		newComposeCommand(),
+		newHistoryCommand(),
+		newEventsCommand(),
+		newLogsCommand(),
+		newMigrateLayoutCommand(),
+		newDoctorCommand(),
+		newImageCommand(),
 	)
 	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
 		rootCmd.AddCommand(startAtLoginCommand())
+		rootCmd.AddCommand(newHostServiceCommand())
 	}
+	addCompletionInstallCommand(rootCmd)
 
 	return rootCmd
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateLayoutCommand() *cobra.Command {
+	migrateLayoutCommand := &cobra.Command{
+		Use:   "migrate-layout [INSTANCE, ...]",
+		Short: "Migrate instances created by old versions of Lima",
+		Long: `Migrate instances created by old versions of Lima to the current layout.
+
+The instance directories are scanned for the files, the fields of lima.yaml, and the
+LIMA_CIDATA variables that are no longer used by this version of Lima.
+The instances must be stopped. The modified files are backed up under
+"migrate-backup/<TIME>" in the instance directory.
+
+The layouts that cannot be migrated automatically are reported with the instructions,
+and make the command fail.
+
+When no instance is specified, all the instances are migrated.`,
+		Example: `  To see what would be migrated:
+  $ limactl migrate-layout --dry-run
+
+  To migrate the instance "default":
+  $ limactl migrate-layout default`,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              migrateLayoutAction,
+		ValidArgsFunction: migrateLayoutBashComplete,
+		GroupID:           advancedCommand,
+	}
+	migrateLayoutCommand.Flags().Bool("dry-run", false, "Only report the legacy layouts")
+	return migrateLayoutCommand
+}
+
+func migrateLayoutAction(cmd *cobra.Command, args []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	instNames := args
+	if len(instNames) == 0 {
+		instNames, err = store.Instances()
+		if err != nil {
+			return err
+		}
+	}
+	var errs []error
+	var manual []string
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to inspect instance %q: %w", instName, err))
+			continue
+		}
+		layouts, err := instance.DetectLegacyLayouts(inst)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to inspect the layout of instance %q: %w", instName, err))
+			continue
+		}
+		if len(layouts) == 0 {
+			logrus.Infof("Instance %q is up to date", instName)
+			continue
+		}
+		for _, l := range layouts {
+			switch {
+			case l.Manual != "":
+				logrus.Warnf("Instance %q: %s; cannot be migrated automatically: %s", instName, l.Description, l.Manual)
+				if !slices.Contains(manual, instName) {
+					manual = append(manual, instName)
+				}
+			case dryRun:
+				logrus.Infof("Instance %q: %s; would be migrated", instName, l.Description)
+			default:
+				logrus.Infof("Instance %q: %s; migrating", instName, l.Description)
+			}
+		}
+		if dryRun {
+			continue
+		}
+		backupDir, err := instance.MigrateLayouts(inst, layouts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to migrate instance %q: %w", instName, err))
+			continue
+		}
+		if backupDir != "" {
+			logrus.Infof("Migrated instance %q; the original files are backed up in %q", instName, backupDir)
+		}
+	}
+	if len(manual) > 0 {
+		errs = append(errs, fmt.Errorf("instance(s) %q need to be migrated by hand", manual))
+	}
+	return errors.Join(errs...)
+}
+
+func migrateLayoutBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	reconcile "github.com/lima-vm/lima/pkg/networks/reconcile"
+	"github.com/lima-vm/lima/pkg/networks/wireguard"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/spf13/cobra"
+)
+
+func newNetworkCommand() *cobra.Command {
+	networkCommand := &cobra.Command{
+		Use:   "network",
+		Short: "Lima network management",
+		Example: `  List the networks in networks.yaml:
+  $ limactl network ls
+
+  Print the WireGuard peer entry of an instance, for networks.yaml of the other hosts:
+  $ limactl network wireguard-peer default`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		GroupID:       advancedCommand,
+	}
+	networkCommand.AddCommand(
+		newNetworkListCommand(),
+		newNetworkWireGuardPeerCommand(),
+	)
+	return networkCommand
+}
+
+func newNetworkListCommand() *cobra.Command {
+	networkListCommand := &cobra.Command{
+		Use: "list",
+		Example: `
+To list the networks, with the instances that use them:
+$ limactl network list
+`,
+		Short:   "List the Lima networks",
+		Long:    "List the networks in networks.yaml. A network is started with the first instance that uses it, and stopped with the last one.",
+		Aliases: []string{"ls"},
+		Args:    WrapArgsError(cobra.NoArgs),
+		RunE:    networkListAction,
+	}
+	networkListCommand.Flags().Bool("json", false, "JSONify output")
+	return networkListCommand
+}
+
+func networkListAction(cmd *cobra.Command, _ []string) error {
+	jsonFormat, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	list, err := reconcile.List()
+	if err != nil {
+		return err
+	}
+
+	if jsonFormat {
+		for _, nw := range list {
+			j, err := json.Marshal(nw)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(j))
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "NAME\tMODE\tSTATUS\tINSTANCES")
+	for _, nw := range list {
+		status := "Stopped"
+		if nw.Running {
+			status = "Running"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", nw.Name, nw.Mode, status, strings.Join(nw.Instances, ","))
+	}
+	return w.Flush()
+}
+
+func newNetworkWireGuardPeerCommand() *cobra.Command {
+	networkWireGuardPeerCommand := &cobra.Command{
+		Use: "wireguard-peer INSTANCE",
+		Example: `
+To print the peer entry of instance "default", which is reachable as "laptop-a.local" from the other hosts:
+$ limactl network wireguard-peer default --endpoint-host laptop-a.local
+`,
+		Short: "Print the WireGuard peer entry of an instance, for networks.yaml of the other hosts",
+		Long: `Print the WireGuard peer entry of an instance on a "wireguard" network.
+Add the entry to the "peers" of the network in networks.yaml on the other hosts of the mesh.
+The key of the instance is generated if the instance has never been started.`,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              networkWireGuardPeerAction,
+		ValidArgsFunction: networkWireGuardPeerBashComplete,
+	}
+	networkWireGuardPeerCommand.Flags().String("network", "", "the \"wireguard\" network (default: the first one of the instance)")
+	networkWireGuardPeerCommand.Flags().String("endpoint-host", "", "the host name or the address of this host, reachable from the other hosts (default: the host name)")
+	return networkWireGuardPeerCommand
+}
+
+func networkWireGuardPeerAction(cmd *cobra.Command, args []string) error {
+	nwName, err := cmd.Flags().GetString("network")
+	if err != nil {
+		return err
+	}
+	endpointHost, err := cmd.Flags().GetString("endpoint-host")
+	if err != nil {
+		return err
+	}
+	if endpointHost == "" {
+		if endpointHost, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	nwCfg, err := networks.LoadConfig()
+	if err != nil {
+		return err
+	}
+	var nw *limayaml.Network
+	for i := range inst.Config.Networks {
+		if n := &inst.Config.Networks[i]; n.Lima != "" && networks.IsWireGuard(n.Lima) && (nwName == "" || n.Lima == nwName) {
+			nw = n
+			break
+		}
+	}
+	if nw == nil {
+		if nwName != "" {
+			return fmt.Errorf("instance %q does not use network %q, or it is not a %q network", inst.Name, nwName, networks.ModeWireGuard)
+		}
+		return fmt.Errorf("instance %q does not use a %q network", inst.Name, networks.ModeWireGuard)
+	}
+	ip, err := netip.ParseAddr(nw.StaticIP)
+	if err != nil {
+		return err
+	}
+	port, err := nwCfg.WireGuardPort(nw.Lima, ip)
+	if err != nil {
+		return err
+	}
+	key, err := wireguard.LoadOrGenerateKey(filepath.Join(inst.Dir, filenames.WireGuardKey))
+	if err != nil {
+		return err
+	}
+	pub, err := wireguard.PublicKey(key)
+	if err != nil {
+		return err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	peers := []wireguard.Peer{
+		{
+			Name:      hostname + "/" + inst.Name,
+			PublicKey: pub,
+			Endpoint:  net.JoinHostPort(endpointHost, strconv.Itoa(port)),
+			Address:   ip.String(),
+		},
+	}
+	b, err := yaml.Marshal(peers)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "# Add to `networks.%s.peers` in networks.yaml on the other hosts\n%s", nw.Lima, b)
+	return nil
+}
+
+func networkWireGuardPeerBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// registerParallelFlags registers the flags for processing multiple instances in parallel with runParallel.
+func registerParallelFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.IntP("jobs", "j", 0, "maximum number of the instances to process in parallel, when multiple instances are specified (0 means no limit)")
+	flags.Bool("json", false, "print the result of each instance to stdout as JSON lines, when multiple instances are specified")
+}
+
+// parallelFlags are the flags that are consumed by runParallel, and not passed to the child processes.
+var parallelFlags = []string{"jobs", "json", "tty", "filter"}
+
+// parallelResult is the result of an instance processed by runParallel.
+type parallelResult struct {
+	Name      string        `json:"name"`
+	Succeeded bool          `json:"succeeded"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// runParallel runs `limactl COMMAND [FLAGS] INSTANCE` for each instance as a child process, in parallel.
+// The flags specified for the command are passed to the child processes.
+// The output lines of the child processes are prefixed with "[INSTANCE] ".
+func runParallel(cmd *cobra.Command, instNames []string) error {
+	flags := cmd.Flags()
+	jobs, err := flags.GetInt("jobs")
+	if err != nil {
+		return err
+	}
+	if jobs <= 0 {
+		jobs = len(instNames)
+	}
+	printJSON, err := flags.GetBool("json")
+	if err != nil {
+		return err
+	}
+	limactl, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	childArgs := []string{cmd.Name()}
+	flags.Visit(func(f *pflag.Flag) {
+		for _, name := range parallelFlags {
+			if f.Name == name {
+				return
+			}
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				childArgs = append(childArgs, fmt.Sprintf("--%s=%s", f.Name, v))
+			}
+			return
+		}
+		childArgs = append(childArgs, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+	// The child processes cannot share the terminal
+	childArgs = append(childArgs, "--tty=false")
+
+	var mu sync.Mutex // serializes the writes to stdout and stderr
+	results := make([]parallelResult, len(instNames))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, instName := range instNames {
+		wg.Add(1)
+		sem <- struct{}{} // acquired in the order of the arguments
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			prefix := fmt.Sprintf("[%s] ", instName)
+			stdout := &prefixWriter{mu: &mu, w: cmd.OutOrStdout(), prefix: prefix}
+			stderr := &prefixWriter{mu: &mu, w: cmd.ErrOrStderr(), prefix: prefix}
+			child := exec.CommandContext(cmd.Context(), limactl, append(childArgs, instName)...)
+			child.Stdout = stdout
+			child.Stderr = stderr
+			logrus.Debugf("Running %v", child.Args)
+			begin := time.Now()
+			childErr := child.Run()
+			stdout.Flush()
+			stderr.Flush()
+			results[i] = parallelResult{
+				Name:      instName,
+				Succeeded: childErr == nil,
+				Duration:  time.Since(begin),
+			}
+			if childErr != nil {
+				results[i].Error = childErr.Error()
+				if msg := logrusMessage(stderr.LastLine()); msg != "" {
+					results[i].Error = msg
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, res := range results {
+		if printJSON {
+			b, err := json.Marshal(res)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(b))
+		}
+		if !res.Succeeded {
+			failed = append(failed, res.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to %s %d of %d instances: %s", cmd.Name(), len(failed), len(instNames), strings.Join(failed, ", "))
+	}
+	logrus.Infof("Completed `limactl %s` for %d instances", cmd.Name(), len(instNames))
+	return nil
+}
+
+// prefixWriter writes each line with the prefix.
+type prefixWriter struct {
+	mu       *sync.Mutex
+	w        io.Writer
+	prefix   string
+	buf      []byte
+	lastLine string
+}
+
+// Write implements io.Writer.
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		pw.writeLine(string(pw.buf[:i]))
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the incomplete line.
+func (pw *prefixWriter) Flush() {
+	if len(pw.buf) > 0 {
+		pw.writeLine(string(pw.buf))
+		pw.buf = nil
+	}
+}
+
+// LastLine returns the last line written, e.g., the fatal error of the child process.
+func (pw *prefixWriter) LastLine() string {
+	return pw.lastLine
+}
+
+func (pw *prefixWriter) writeLine(line string) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	_, _ = fmt.Fprintln(pw.w, pw.prefix+line)
+	if strings.TrimSpace(line) != "" {
+		pw.lastLine = line
+	}
+}
+
+// logrusMessage returns the message of the line printed by logrus in the text format,
+// e.g., `time="..." level=fatal msg="..."`, or the line itself.
+func logrusMessage(line string) string {
+	_, msg, ok := strings.Cut(line, " msg=")
+	if !ok {
+		return line
+	}
+	if quoted, err := strconv.QuotedPrefix(msg); err == nil {
+		if s, err := strconv.Unquote(quoted); err == nil {
+			return s
+		}
+	}
+	msg, _, _ = strings.Cut(msg, " ")
+	return msg
+}
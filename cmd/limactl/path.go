@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newPathCommand() *cobra.Command {
+	pathCommand := &cobra.Command{
+		Use:   "path",
+		Short: "Translate paths between host and guest",
+		Example: `  Print the guest path of the current directory:
+  $ limactl path translate default .`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		GroupID:       advancedCommand,
+	}
+	pathCommand.AddCommand(
+		newPathTranslateCommand(),
+	)
+	return pathCommand
+}
+
+func newPathTranslateCommand() *cobra.Command {
+	pathTranslateCommand := &cobra.Command{
+		Use: "translate INSTANCE PATH...",
+		Example: `
+To print the guest path of a host file:
+$ limactl path translate default ~/src/main.go
+
+To print the host path of a guest file:
+$ limactl path translate --to-host default /Users/foo/src/main.go
+`,
+		Short: "Translate host paths to guest paths, or vice versa",
+		Long: `Translate host paths to guest paths, or vice versa, using the mounts of the instance.
+The mount points that differ from the locations are honored, and the symbolic links on the host are resolved.
+Fails when a path is not under any mount.`,
+		Args:              WrapArgsError(cobra.MinimumNArgs(2)),
+		RunE:              pathTranslateAction,
+		ValidArgsFunction: pathTranslateBashComplete,
+	}
+	pathTranslateCommand.Flags().Bool("to-host", false, "translate guest paths to host paths")
+	return pathTranslateCommand
+}
+
+func pathTranslateAction(cmd *cobra.Command, args []string) error {
+	toHost, err := cmd.Flags().GetBool("to-host")
+	if err != nil {
+		return err
+	}
+	instName := args[0]
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist", instName)
+		}
+		return err
+	}
+	for _, p := range args[1:] {
+		var translated string
+		if toHost {
+			translated, err = instance.GuestToHostPath(inst, p)
+		} else {
+			translated, err = instance.HostToGuestPath(inst, p)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), translated)
+	}
+	return nil
+}
+
+func pathTranslateBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return bashCompleteInstanceNames(cmd)
+	}
+	return nil, cobra.ShellCompDirectiveDefault
+}
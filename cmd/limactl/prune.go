@@ -1,26 +1,57 @@
 package main
 
 import (
-	"os"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/downloader"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/prune"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/templatestore"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+const pruneHelp = `Prune garbage objects
+
+By default, the whole download cache is removed.
+The objects to be pruned can be selected with the following flags instead:
+
+  --downloads POLICY    - prune the download cache, by a comma-separated list of:
+                          "all", "older-than=DURATION" (e.g., "30d"), and "max-size=SIZE" (e.g., "20GiB")
+  --unused-disks        - prune the disks ("limactl disk") that are not used by any instance
+  --dangling-snapshots  - prune the snapshots that can no longer be applied
+  --unused-images       - prune the images of the image store ($LIMA_HOME/_images) that are not used by any instance
+
+Use --dry-run to see the objects and the sizes without removing them, and --format json for a machine-readable report.
+
+Example: limactl prune --downloads older-than=30d --unused-disks --dry-run
+`
+
 func newPruneCommand() *cobra.Command {
 	pruneCommand := &cobra.Command{
 		Use:               "prune",
 		Short:             "Prune garbage objects",
+		Long:              pruneHelp,
 		Args:              WrapArgsError(cobra.NoArgs),
 		RunE:              pruneAction,
 		ValidArgsFunction: cobra.NoFileCompletions,
 		GroupID:           advancedCommand,
 	}
 	pruneCommand.Flags().Bool("keep-referred", false, "Keep objects that are referred by some instances or templates")
+	pruneCommand.Flags().String("downloads", "", "Prune the download cache by the policy, e.g., \"older-than=30d,max-size=20GiB\"")
+	pruneCommand.Flags().Bool("unused-disks", false, "Prune the disks that are not used by any instance")
+	pruneCommand.Flags().Bool("dangling-snapshots", false, "Prune the snapshots that can no longer be applied")
+	pruneCommand.Flags().Bool("unused-images", false, "Prune the images of the image store that are not used by any instance")
+	pruneCommand.Flags().Bool("dry-run", false, "Show the objects to be pruned without removing them")
+	pruneCommand.Flags().StringP("format", "f", "table", "output format, one of: json, table")
 	return pruneCommand
 }
 
@@ -29,34 +60,141 @@ func pruneAction(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
-	opt := downloader.WithCache()
-	if !keepReferred {
-		return downloader.RemoveAllCacheDir(opt)
+	downloads, err := cmd.Flags().GetString("downloads")
+	if err != nil {
+		return err
 	}
-
-	// Prune downloads that are not used by any instances or templates
-	cacheEntries, err := downloader.CacheEntries(opt)
+	unusedDisks, err := cmd.Flags().GetBool("unused-disks")
+	if err != nil {
+		return err
+	}
+	danglingSnapshots, err := cmd.Flags().GetBool("dangling-snapshots")
+	if err != nil {
+		return err
+	}
+	unusedImages, err := cmd.Flags().GetBool("unused-images")
 	if err != nil {
 		return err
 	}
-	knownLocations, err := knownLocations()
+	dryRun, err := cmd.Flags().GetBool("dry-run")
 	if err != nil {
 		return err
 	}
-	for cacheKey, cachePath := range cacheEntries {
-		if file, exists := knownLocations[cacheKey]; exists {
-			logrus.Debugf("Keep %q caching %q", cacheKey, file.Location)
-		} else {
-			logrus.Debug("Deleting ", cacheKey)
-			if err := os.RemoveAll(cachePath); err != nil {
-				logrus.Warnf("Failed to delete %q: %v", cacheKey, err)
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %q, must be one of: json, table", format)
+	}
+	if downloads == "" && !unusedDisks && !danglingSnapshots && !unusedImages {
+		downloads = "all"
+	}
+	opt := downloader.WithCache()
+	var policy *prune.DownloadPolicy
+	if downloads != "" {
+		policy, err = prune.ParseDownloadPolicy(downloads)
+		if err != nil {
+			return err
+		}
+		if policy.All && !keepReferred && !unusedDisks && !danglingSnapshots && !unusedImages && !dryRun && format == "table" {
+			return downloader.RemoveAllCacheDir(opt)
+		}
+	}
+
+	instances, err := pruneInstances()
+	if err != nil {
+		return err
+	}
+	report := &prune.Report{DryRun: dryRun}
+	if policy != nil {
+		keep := make(map[string]struct{})
+		if keepReferred {
+			knownLocations, err := knownLocations()
+			if err != nil {
 				return err
 			}
+			for cacheKey, file := range knownLocations {
+				logrus.Debugf("Keep %q caching %q", cacheKey, file.Location)
+				keep[cacheKey] = struct{}{}
+			}
 		}
+		objs, err := prune.Downloads(*policy, keep, time.Now(), opt)
+		if err != nil {
+			return err
+		}
+		report.Add(objs...)
+	}
+	if unusedDisks {
+		objs, err := prune.UnusedDisks(instances)
+		if err != nil {
+			return err
+		}
+		report.Add(objs...)
+	}
+	if danglingSnapshots {
+		objs, err := prune.DanglingSnapshots(instances)
+		if err != nil {
+			return err
+		}
+		report.Add(objs...)
+	}
+	if unusedImages {
+		objs, err := prune.UnusedImages()
+		if err != nil {
+			return err
+		}
+		report.Add(objs...)
+	}
+	report.Remove()
+	if err := printPruneReport(cmd.OutOrStdout(), format, report); err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return errors.New(strings.Join(report.Errors, "; "))
 	}
 	return nil
 }
 
+func pruneInstances() ([]*store.Instance, error) {
+	instNames, err := store.Instances()
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]*store.Instance, 0, len(instNames))
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+func printPruneReport(w io.Writer, format string, report *prune.Report) error {
+	if format == "json" {
+		if report.Objects == nil {
+			report.Objects = []prune.Object{}
+		}
+		return json.NewEncoder(w).Encode(report)
+	}
+	tw := tabwriter.NewWriter(w, 4, 8, 4, ' ', 0)
+	if len(report.Objects) > 0 {
+		fmt.Fprintln(tw, "KIND\tNAME\tSIZE\tREASON")
+		for _, o := range report.Objects {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Kind, o.Name, units.BytesSize(float64(o.Size)), o.Reason)
+		}
+		fmt.Fprintln(tw)
+	}
+	if report.DryRun {
+		fmt.Fprintf(tw, "Total reclaimable space: %s (dry run)\n", units.BytesSize(float64(report.TotalSize)))
+	} else {
+		fmt.Fprintf(tw, "Total reclaimed space: %s\n", units.BytesSize(float64(report.TotalSize)))
+	}
+	return tw.Flush()
+}
+
 func knownLocations() (map[string]limayaml.File, error) {
 	locations := make(map[string]limayaml.File)
 
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/instance"
+	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newRestartCommand() *cobra.Command {
+	restartCmd := &cobra.Command{
+		Use: "restart INSTANCE [INSTANCE...]",
+		Example: `
+To restart the instance "default":
+$ limactl restart
+
+To restart the instances "foo", "bar", and "baz" in parallel:
+$ limactl restart foo bar baz
+`,
+		Short: "Restart an instance",
+		Long: `Stop the instance if it is running, and start it again.
+
+The tunnels created with "limactl tunnel" are re-created on the same host ports,
+unless --restore-tunnels=false is specified.
+
+The state of an instance suspended with "limactl suspend" is discarded, and the instance is booted from scratch.`,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              restartAction,
+		ValidArgsFunction: restartBashComplete,
+		GroupID:           basicCommand,
+	}
+
+	restartCmd.Flags().BoolP("force", "f", false, "force stop the instance")
+	restartCmd.Flags().Bool("restore-tunnels", true, "re-create the tunnels created with `limactl tunnel`")
+	restartCmd.Flags().Duration("timeout", instance.DefaultWatchHostAgentEventsTimeout, "duration to wait for the instance to be running before timing out")
+	registerParallelFlags(restartCmd)
+	return restartCmd
+}
+
+func restartAction(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return runParallel(cmd, args)
+	}
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	restore, err := cmd.Flags().GetBool("restore-tunnels")
+	if err != nil {
+		return err
+	}
+
+	var tunnels []metadata.Tunnel
+	if inst.Status == store.StatusRunning || inst.Status == store.StatusCrashed {
+		// The tunnels are cleared when the host agent exits
+		if tunnels, err = instance.Tunnels(inst); err != nil {
+			return err
+		}
+		if !restore {
+			for _, t := range tunnels {
+				logrus.Warnf("The tunnel %q (%s, %s) will not be re-created", t.Name, t.Type, t.Local)
+			}
+			tunnels = nil
+		}
+		if force {
+			instance.StopForcibly(inst)
+		} else if err := instance.StopGracefully(inst); err != nil {
+			return err
+		}
+		// Reload the status
+		if inst, err = store.Inspect(instName); err != nil {
+			return err
+		}
+	} else if inst.Status == store.StatusSuspended {
+		if err := instance.DiscardSuspendedState(inst); err != nil {
+			return err
+		}
+		if inst, err = store.Inspect(instName); err != nil {
+			return err
+		}
+	} else {
+		logrus.Infof("The instance %q is not running (status %q)", inst.Name, inst.Status)
+	}
+
+	ctx := cmd.Context()
+	if err := networks.Reconcile(ctx, inst.Name); err != nil {
+		return err
+	}
+	if timeout > 0 {
+		ctx = instance.WithWatchHostAgentTimeout(ctx, timeout)
+	}
+	if err := instance.Start(ctx, inst, "", false); err != nil {
+		return err
+	}
+	if len(tunnels) == 0 {
+		return nil
+	}
+	// Reload the SSH address and port
+	if inst, err = store.Inspect(instName); err != nil {
+		return err
+	}
+	restoreTunnels(cmd.Context(), inst, tunnels)
+	return nil
+}
+
+func restartBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newResumeCommand() *cobra.Command {
+	resumeCmd := &cobra.Command{
+		Use: "resume INSTANCE [INSTANCE...]",
+		Example: `
+To resume the instance "default" suspended with "limactl suspend":
+$ limactl resume
+`,
+		Short: "Resume an instance suspended with `limactl suspend`",
+		Long: `Restore the state of an instance saved by "limactl suspend", and start the instance.
+
+The tunnels created with "limactl tunnel" are re-created on the same host ports.`,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              resumeAction,
+		ValidArgsFunction: resumeBashComplete,
+		GroupID:           advancedCommand,
+	}
+	resumeCmd.Flags().Duration("timeout", instance.DefaultWatchHostAgentEventsTimeout, "duration to wait for the instance to be running before timing out")
+	registerParallelFlags(resumeCmd)
+	return resumeCmd
+}
+
+func resumeAction(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return runParallel(cmd, args)
+	}
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if inst.Status != store.StatusSuspended {
+		return fmt.Errorf("expected status %q, got %q", store.StatusSuspended, inst.Status)
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	if err := networks.Reconcile(ctx, inst.Name); err != nil {
+		return err
+	}
+	if timeout > 0 {
+		ctx = instance.WithWatchHostAgentTimeout(ctx, timeout)
+	}
+	if err := instance.Start(ctx, inst, "", false); err != nil {
+		return err
+	}
+	return restoreSuspended(cmd.Context(), instName)
+}
+
+// restoreSuspended re-creates the tunnels recorded by `limactl suspend`, after the instance has been resumed.
+func restoreSuspended(ctx context.Context, instName string) error {
+	// Reload the SSH address and port
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	suspended, err := instance.TakeSuspended(inst)
+	if err != nil {
+		return err
+	}
+	if suspended == nil {
+		return nil
+	}
+	logrus.Infof("Resumed the instance %q suspended at %s", inst.Name, suspended.Time.Format("2006-01-02 15:04:05"))
+	restoreTunnels(ctx, inst, suspended.Tunnels)
+	return nil
+}
+
+func resumeBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -5,11 +5,17 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"al.essio.dev/pkg/shellescape"
 	"github.com/coreos/go-semver/semver"
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/mattn/go-isatty"
@@ -24,20 +30,35 @@ const envShellSSH = "SSH"
 
 const shellHelp = `Execute shell in Lima
 
-lima command is provided as an alias for limactl shell $LIMA_INSTANCE. $LIMA_INSTANCE defaults to "` + DefaultInstanceName + `".
+lima command is provided as an alias for limactl shell $LIMA_INSTANCE. $LIMA_INSTANCE defaults to the default instance
+set with "limactl default set", or "` + DefaultInstanceName + `". When no argument is specified, limactl shell opens the shell of the default instance.
 
 By default, the first 'ssh' executable found in the host's PATH is used to connect to the Lima instance.
 A custom ssh alias can be used instead by setting the $` + envShellSSH + ` environment variable.
 
+The shell starts in the guest path of the host's current directory when it is mounted (see "limactl path translate"),
+or in the guest path of the host's home directory. Specify --map-cwd=false to start in the home directory of the guest.
+
+With --persist, the shell runs in a tmux (or screen) session in the guest, and the connection is
+automatically re-established when it is lost, e.g., on sleep/wake of the host or on a restart of the host agent.
+The reconnected shell is reattached to the same session.
+
+With --cpu-limit, --memory-limit, and --timeout, the shell (or the command) runs in a transient systemd scope
+in the guest with the resource limits, so that the command cannot consume the whole instance:
+
+  limactl shell --cpu-limit 2 --memory-limit 1GiB --timeout 10m default make -j
+
+With --user, the shell is logged in as one of the additional users defined in the "users" field of the instance.
+
 Hint: try --debug to show the detailed logs, if it seems hanging (mostly due to some SSH issue).
 `
 
 func newShellCommand() *cobra.Command {
 	shellCmd := &cobra.Command{
-		Use:               "shell [flags] INSTANCE [COMMAND...]",
+		Use:               "shell [flags] [INSTANCE [COMMAND...]]",
 		Short:             "Execute shell in Lima",
 		Long:              shellHelp,
-		Args:              WrapArgsError(cobra.MinimumNArgs(1)),
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
 		RunE:              shellAction,
 		ValidArgsFunction: shellBashComplete,
 		SilenceErrors:     true,
@@ -48,6 +69,12 @@ func newShellCommand() *cobra.Command {
 
 	shellCmd.Flags().String("shell", "", "shell interpreter, e.g. /bin/bash")
 	shellCmd.Flags().String("workdir", "", "working directory")
+	shellCmd.Flags().StringP("user", "u", "", "log in as one of the additional users of the instance (the users field), instead of the default user")
+	shellCmd.Flags().Bool("map-cwd", true, "change the working directory to the guest path of the host's current directory (or the home directory) when it is mounted")
+	shellCmd.Flags().Float64("cpu-limit", 0, "limit the CPU usage of the shell to the number of CPUs, e.g., 1.5 (requires systemd in the guest)")
+	shellCmd.Flags().String("memory-limit", "", "limit the memory usage of the shell, e.g., \"1GiB\" (requires systemd in the guest)")
+	shellCmd.Flags().Duration("timeout", 0, "kill the shell and its processes after the duration, e.g., \"10m\" (requires systemd in the guest)")
+	shellCmd.Flags().Bool("persist", false, "run the shell in a persistent tmux or screen session in the guest, and reconnect to it when the connection is lost")
 	return shellCmd
 }
 
@@ -59,7 +86,10 @@ func shellAction(cmd *cobra.Command, args []string) error {
 		newArg = append(newArg, args[2:]...)
 		args = newArg
 	}
-	instName := args[0]
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
+	}
 
 	if len(args) >= 2 {
 		switch args[1] {
@@ -79,37 +109,48 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	if inst.Status == store.StatusStopped {
 		return fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
 	}
+	if inst.Status == store.StatusSuspended {
+		return fmt.Errorf("instance %q is suspended, run `limactl resume %s` to resume the instance", instName, instName)
+	}
+	if inst.Status == store.StatusCrashed {
+		return fmt.Errorf("the guest kernel of instance %q has panicked (artifacts: %s), run `limactl restart %s` to restart the instance",
+			instName, inst.Crash.Dir, instName)
+	}
+	username, err := cmd.Flags().GetString("user")
+	if err != nil {
+		return err
+	}
+	if username == "" {
+		username = *inst.Config.User.Name
+	} else if username != *inst.Config.User.Name && !slices.ContainsFunc(inst.Config.Users, func(u limayaml.AdditionalUser) bool {
+		return u.Name == username
+	}) {
+		return fmt.Errorf("user %q is not defined in `user` nor `users` of instance %q", username, instName)
+	}
 
 	// When workDir is explicitly set, the shell MUST have workDir as the cwd, or exit with an error.
 	//
 	// changeDirCmd := "cd workDir || exit 1"                  if workDir != ""
-	//              := "cd hostCurrentDir || cd hostHomeDir"   if workDir == ""
+	//              := "cd guestCurrentDir"                    if workDir == "" && mapCwd && the current directory is mounted
+	//              := "cd guestHomeDir"                       if workDir == "" && mapCwd && the home directory is mounted
 	var changeDirCmd string
 	workDir, err := cmd.Flags().GetString("workdir")
 	if err != nil {
 		return err
 	}
+	mapCwd, err := cmd.Flags().GetBool("map-cwd")
+	if err != nil {
+		return err
+	}
 	if workDir != "" {
 		changeDirCmd = fmt.Sprintf("cd %s || exit 1", shellescape.Quote(workDir))
-		// FIXME: check whether y.Mounts contains the home, not just len > 0
-	} else if len(inst.Config.Mounts) > 0 {
-		hostCurrentDir, err := os.Getwd()
-		if err == nil {
-			changeDirCmd = fmt.Sprintf("cd %s", shellescape.Quote(hostCurrentDir))
+	} else if mapCwd {
+		if guestDir, err := mappedCwd(inst); err == nil {
+			changeDirCmd = fmt.Sprintf("cd %s", shellescape.Quote(guestDir))
 		} else {
-			changeDirCmd = "false"
-			logrus.WithError(err).Warn("failed to get the current directory")
+			logrus.WithError(err).Debug("the current directory and the home directory do not seem mounted, so the guest shell will have a different cwd")
 		}
-		hostHomeDir, err := os.UserHomeDir()
-		if err == nil {
-			changeDirCmd = fmt.Sprintf("%s || cd %s", changeDirCmd, shellescape.Quote(hostHomeDir))
-		} else {
-			logrus.WithError(err).Warn("failed to get the home directory")
-		}
-	} else {
-		logrus.Debug("the host home does not seem mounted, so the guest shell will have a different cwd")
 	}
-
 	if changeDirCmd == "" {
 		changeDirCmd = "false"
 	}
@@ -124,7 +165,32 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	} else {
 		shell = shellescape.Quote(shell)
 	}
+	persist, err := cmd.Flags().GetBool("persist")
+	if err != nil {
+		return err
+	}
+	if persist {
+		if len(args) > 1 {
+			return errors.New("--persist cannot be used with a command")
+		}
+		if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+			return errors.New("--persist requires a terminal")
+		}
+	}
+	limitCmd, err := limitProcessCmd(cmd, inst)
+	if err != nil {
+		return err
+	}
+	if limitCmd != "" && persist {
+		return errors.New("--persist cannot be used with --cpu-limit, --memory-limit, nor --timeout")
+	}
 	script := fmt.Sprintf("%s ; exec %s --login", changeDirCmd, shell)
+	if limitCmd != "" {
+		script = fmt.Sprintf("%s || exit 1 ; %s", limitCmd, script)
+	}
+	if persist {
+		script = persistentSessionScript(script)
+	}
 	if len(args) > 1 {
 		quotedArgs := make([]string, len(args[1:]))
 		parsingEnv := true
@@ -166,15 +232,111 @@ func shellAction(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	sshCmd, err := newShellSSHCmd(inst, username, arg0, arg0Args, script, persist)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("executing ssh (may take a long)): %+v", sshCmd.Args)
+
+	// TODO: use syscall.Exec directly (results in losing tty?)
+	err = sshCmd.Run()
+	if !persist {
+		return err
+	}
+	// The first connection is not retried, so that errors such as an authentication failure are reported immediately.
+	for attempt := 0; isConnectionLost(err); attempt++ {
+		inst, err = waitForReconnect(instName, attempt)
+		if err != nil {
+			return err
+		}
+		sshCmd, err = newShellSSHCmd(inst, username, arg0, arg0Args, script, persist)
+		if err != nil {
+			return err
+		}
+		logrus.Debugf("executing ssh (may take a long)): %+v", sshCmd.Args)
+		started := time.Now()
+		err = sshCmd.Run()
+		if time.Since(started) > time.Minute {
+			// the session was alive for a while, so the next reconnection starts without the back-off
+			attempt = -1
+		}
+	}
+	return err
+}
+
+// mappedCwd returns the guest path of the host's current directory, or of the host's home directory
+// when the current directory is not mounted.
+func mappedCwd(inst *store.Instance) (string, error) {
+	hostCurrentDir, err := os.Getwd()
+	if err == nil {
+		var guestDir string
+		if guestDir, err = instance.HostToGuestPath(inst, hostCurrentDir); err == nil {
+			return guestDir, nil
+		}
+	}
+	logrus.WithError(err).Debug("failed to map the current directory")
+	hostHomeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return instance.HostToGuestPath(inst, hostHomeDir)
+}
+
+// limitProcessCmd returns the command that moves the guest shell into a transient systemd scope
+// with the resource limits specified by the flags, via the guest agent.
+// An empty string is returned when no limit is specified.
+func limitProcessCmd(cmd *cobra.Command, inst *store.Instance) (string, error) {
+	cpuLimit, err := cmd.Flags().GetFloat64("cpu-limit")
+	if err != nil {
+		return "", err
+	}
+	memoryLimit, err := cmd.Flags().GetString("memory-limit")
+	if err != nil {
+		return "", err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return "", err
+	}
+	if cpuLimit < 0 || timeout < 0 {
+		return "", errors.New("--cpu-limit and --timeout must not be negative")
+	}
+	var memoryBytes int64
+	if memoryLimit != "" {
+		memoryBytes, err = units.RAMInBytes(memoryLimit)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse --memory-limit %q: %w", memoryLimit, err)
+		}
+	}
+	if cpuLimit == 0 && memoryBytes == 0 && timeout == 0 {
+		return "", nil
+	}
+	guestAgent := path.Join(*inst.Config.GuestInstallPrefix, "bin", "lima-guestagent")
+	return fmt.Sprintf("%s limit-process --cpus %s --memory-bytes %d --timeout %s",
+		shellescape.Quote(guestAgent), strconv.FormatFloat(cpuLimit, 'f', -1, 64), memoryBytes, timeout), nil
+}
+
+func newShellSSHCmd(inst *store.Instance, username, arg0 string, arg0Args []string, script string, persist bool) (*exec.Cmd, error) {
 	sshOpts, err := sshutil.SSHOpts(
 		inst.Dir,
-		*inst.Config.User.Name,
+		username,
 		*inst.Config.SSH.LoadDotSSHPubKeys,
 		*inst.Config.SSH.ForwardAgent,
 		*inst.Config.SSH.ForwardX11,
 		*inst.Config.SSH.ForwardX11Trusted)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// A control master that was connected before sleep/wake may hang, so each connection is made directly for persist.
+	// The control master is logged in as `user`, so the other users connect directly too.
+	if persist || username != *inst.Config.User.Name {
+		sshOpts = slices.DeleteFunc(sshOpts, func(opt string) bool {
+			return strings.HasPrefix(opt, "ControlMaster=") || strings.HasPrefix(opt, "ControlPath=") || strings.HasPrefix(opt, "ControlPersist=")
+		})
+	}
+	if persist {
+		// The keep-alive detects the lost connection within 15 seconds.
+		sshOpts = append(sshOpts, "ServerAliveInterval=5", "ServerAliveCountMax=3")
 	}
 	sshArgs := sshutil.SSHArgsFromOpts(sshOpts)
 	if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
@@ -203,10 +365,53 @@ func shellAction(cmd *cobra.Command, args []string) error {
 	sshCmd.Stdin = os.Stdin
 	sshCmd.Stdout = os.Stdout
 	sshCmd.Stderr = os.Stderr
-	logrus.Debugf("executing ssh (may take a long)): %+v", sshCmd.Args)
+	return sshCmd, nil
+}
 
-	// TODO: use syscall.Exec directly (results in losing tty?)
-	return sshCmd.Run()
+// persistentSessionName is the name of the tmux (or screen) session used by `limactl shell --persist`.
+const persistentSessionName = "lima-shell"
+
+// persistentSessionScript wraps script so that it runs in a tmux (or screen) session that survives the ssh connection.
+// An existing session is reattached.
+func persistentSessionScript(script string) string {
+	return fmt.Sprintf(`if command -v tmux >/dev/null 2>&1; then exec tmux new-session -A -s %[1]s %[2]s; `+
+		`elif command -v screen >/dev/null 2>&1; then exec screen -xRR -S %[1]s sh -c %[2]s; `+
+		`else echo >&2 "--persist requires tmux or screen to be installed in the guest"; exit 1; fi`,
+		persistentSessionName, shellescape.Quote(script))
+}
+
+// isConnectionLost returns true if ssh exited due to a connection error.
+// ssh exits with 255 on connection errors, including the keep-alive timeout.
+func isConnectionLost(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 255
+}
+
+// waitForReconnect waits until the instance becomes running again after the connection was lost,
+// and returns the instance with the possibly updated SSH port.
+// The wait before checking the instance grows with attempt, up to 10 seconds.
+func waitForReconnect(instName string, attempt int) (*store.Instance, error) {
+	if attempt == 0 {
+		fmt.Fprintf(os.Stderr, "\r\n[lima] Connection to instance %q lost, reconnecting... (press Ctrl-C to give up)\r\n", instName)
+	}
+	interval := min(time.Second<<min(attempt, 4), 10*time.Second)
+	for {
+		time.Sleep(interval)
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return nil, err
+		}
+		switch inst.Status {
+		case store.StatusRunning:
+			logrus.Debugf("Reconnecting to instance %q (attempt %d)", instName, attempt+1)
+			return inst, nil
+		case store.StatusStopped:
+			return nil, fmt.Errorf("instance %q was stopped", instName)
+		case store.StatusSuspended:
+			return nil, fmt.Errorf("instance %q was suspended", instName)
+		}
+		interval = 10 * time.Second
+	}
 }
 
 func shellBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
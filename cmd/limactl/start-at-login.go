@@ -30,9 +30,9 @@ func startAtLoginCommand() *cobra.Command {
 }
 
 func startAtLoginAction(cmd *cobra.Command, args []string) error {
-	instName := DefaultInstanceName
-	if len(args) > 0 {
-		instName = args[0]
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
 	}
 
 	inst, err := store.Inspect(instName)
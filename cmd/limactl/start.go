@@ -6,17 +6,20 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/containerd/containerd/identifiers"
 	"github.com/lima-vm/lima/cmd/limactl/editflags"
 	"github.com/lima-vm/lima/pkg/editutil"
+	"github.com/lima-vm/lima/pkg/identifierutil"
 	"github.com/lima-vm/lima/pkg/instance"
 	"github.com/lima-vm/lima/pkg/limatmpl"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
 	"github.com/lima-vm/lima/pkg/templatestore"
 	"github.com/lima-vm/lima/pkg/uiutil"
 	"github.com/lima-vm/lima/pkg/yqutil"
@@ -28,6 +31,11 @@ func registerCreateFlags(cmd *cobra.Command, commentPrefix string) {
 	flags := cmd.Flags()
 	flags.String("name", "", commentPrefix+"override the instance name")
 	flags.Bool("list-templates", false, commentPrefix+"list available templates and exit")
+	flags.StringArray("override", nil, commentPrefix+"merge a YAML file or URL into the template; can be specified multiple times, the last one has the highest priority")
+	flags.String("from-instance", "", commentPrefix+"derive the template from an existing instance, without the values specific to the machine (requires --name)")
+	_ = cmd.RegisterFlagCompletionFunc("from-instance", func(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return bashCompleteInstanceNames(cmd)
+	})
 	editflags.RegisterCreate(cmd, commentPrefix)
 }
 
@@ -47,6 +55,9 @@ $ limactl create --cpus=2 --memory=2
 To create an instance "default" with yq expressions:
 $ limactl create --set='.cpus = 2 | .memory = "2GiB"'
 
+To create an instance "default" from a template "docker", with layered customizations:
+$ limactl create --name=default --override=./team.yaml --override=./me.yaml template://docker
+
 To see the template list:
 $ limactl create --list-templates
 
@@ -58,6 +69,9 @@ $ limactl create --name=default https://raw.githubusercontent.com/lima-vm/lima/m
 
 To create an instance "local" from a template passed to stdin (--name parameter is required):
 $ cat template.yaml | limactl create --name=local -
+
+To create an instance "docker2" with the same configuration as the existing instance "docker":
+$ limactl create --name=docker2 --from-instance=docker
 `,
 		Short:             "Create an instance of Lima",
 		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
@@ -71,7 +85,7 @@ $ cat template.yaml | limactl create --name=local -
 
 func newStartCommand() *cobra.Command {
 	startCommand := &cobra.Command{
-		Use: "start NAME|FILE.yaml|URL",
+		Use: "start NAME|FILE.yaml|URL [NAME...]",
 		Example: `
 To create an instance "default" (if not created yet) from the default Ubuntu template, and start it:
 $ limactl start
@@ -79,11 +93,26 @@ $ limactl start
 To create an instance "default" from a template "docker", and start it:
 $ limactl start --name=default template://docker
 
+To create an instance "dev" from an image pushed with ` + "`limactl image push`" + `, and start it:
+$ limactl start --name=dev oci://ghcr.io/org/dev-base:2024.06
+
+To start an existing instance "default" with a different template parameter:
+$ limactl start -e API_ENDPOINT=https://example.com default
+
+To start an instance "default", returning as soon as the readiness probe "docker" passes:
+$ limactl start --wait-for-probe=docker default
+
+To start an instance "default", serving the metrics of the guest for Prometheus on http://127.0.0.1:9100/metrics:
+$ limactl start --metrics-port=9100 default
+
+To start the existing instances "foo", "bar", and "baz" in parallel, up to 2 instances at a time:
+$ limactl start --jobs=2 foo bar baz
+
 'limactl start' also accepts the 'limactl create' flags such as '--set'.
 See the examples in 'limactl create --help'.
 `,
 		Short:             "Start an instance of Lima",
-		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
 		ValidArgsFunction: startBashComplete,
 		RunE:              startAction,
 		GroupID:           basicCommand,
@@ -93,6 +122,10 @@ See the examples in 'limactl create --help'.
 		startCommand.Flags().Bool("foreground", false, "run the hostagent in the foreground")
 	}
 	startCommand.Flags().Duration("timeout", instance.DefaultWatchHostAgentEventsTimeout, "duration to wait for the instance to be running before timing out")
+	startCommand.Flags().Bool("probe-events", false, "print the results of the readiness probes to stdout as JSON lines")
+	startCommand.Flags().StringArray("wait-for-probe", nil, "return as soon as the named readiness probe passes, without waiting for the other requirements (can be specified multiple times)")
+	startCommand.Flags().Int("metrics-port", 0, "serve the metrics of the guest in the Prometheus format on http://127.0.0.1:PORT/metrics")
+	registerParallelFlags(startCommand)
 	return startCommand
 }
 
@@ -145,7 +178,16 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 		}
 		tty = false
 	}
-	tmpl, err := limatmpl.Read(cmd.Context(), name, arg)
+	fromInstance, err := flags.GetString("from-instance")
+	if err != nil {
+		return nil, err
+	}
+	var tmpl *limatmpl.Template
+	if fromInstance != "" {
+		tmpl, err = templateFromInstance(fromInstance, name, arg)
+	} else {
+		tmpl, err = limatmpl.Read(cmd.Context(), name, arg)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -153,6 +195,12 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 		if arg == "" {
 			if tmpl.Name == "" {
 				tmpl.Name = DefaultInstanceName
+				if !createOnly {
+					// `limactl start` without the instance name starts the default instance (see `limactl default`)
+					if tmpl.Name, err = store.DefaultInstance(); err != nil {
+						return nil, err
+					}
+				}
 			}
 		} else {
 			logrus.Debugf("interpreting argument %q as an instance name", arg)
@@ -169,6 +217,9 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 			if createOnly {
 				return nil, fmt.Errorf("instance %q already exists", tmpl.Name)
 			}
+			if flags.Changed("override") {
+				return nil, fmt.Errorf("--override cannot be used with the existing instance %q; use `limactl edit` instead", tmpl.Name)
+			}
 			logrus.Infof("Using the existing instance %q", tmpl.Name)
 			yqExprs, err := editflags.YQExpressions(flags, false)
 			if err != nil {
@@ -176,7 +227,7 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 			}
 			if len(yqExprs) > 0 {
 				yq := yqutil.Join(yqExprs)
-				inst, err = applyYQExpressionToExistingInstance(inst, yq)
+				inst, err = applyYQExpressionToExistingInstance(cmd, inst, yq)
 				if err != nil {
 					return nil, fmt.Errorf("failed to apply yq expression %q to instance %q: %w", yq, tmpl.Name, err)
 				}
@@ -195,6 +246,34 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 		if err != nil {
 			return nil, err
 		}
+		tmpl.Locator = "template://" + templatestore.Default
+	}
+	// Recorded in the history, before being modified by the overrides, the flags, and the editor
+	created := history.Entry{
+		Event:    history.EventCreate,
+		Template: tmpl.Locator,
+		Digest:   history.Digest(tmpl.Bytes),
+	}
+
+	overrides, err := flags.GetStringArray("override")
+	if err != nil {
+		return nil, err
+	}
+	for _, locator := range overrides {
+		o, err := limatmpl.Read(cmd.Context(), tmpl.Name, locator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the override %q: %w", locator, err)
+		}
+		if len(o.Bytes) == 0 {
+			return nil, fmt.Errorf("override %q must be a non-empty YAML file or URL", locator)
+		}
+		logrus.Debugf("Applying the override %q", locator)
+		if err := tmpl.ApplyOverride(o.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to apply the override %q: %w", locator, err)
+		}
+	}
+	if len(overrides) > 0 {
+		created.Message = "overrides: " + strings.Join(overrides, ", ")
 	}
 
 	yqExprs, err := editflags.YQExpressions(flags, true)
@@ -214,11 +293,43 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string, createOnly bool) (*
 			return nil, err
 		}
 	}
+	tmpl.Bytes, err = editflags.AddProvenanceComment(tmpl.Bytes, cmd.Name(), flags)
+	if err != nil {
+		return nil, err
+	}
 	saveBrokenYAML := tty
-	return instance.Create(cmd.Context(), tmpl.Name, tmpl.Bytes, saveBrokenYAML)
+	inst, err := instance.Create(cmd.Context(), tmpl.Name, tmpl.Bytes, saveBrokenYAML)
+	if err != nil {
+		return nil, err
+	}
+	history.Record(inst.Dir, created)
+	return inst, nil
 }
 
-func applyYQExpressionToExistingInstance(inst *store.Instance, yq string) (*store.Instance, error) {
+func templateFromInstance(fromInstance, name, arg string) (*limatmpl.Template, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("--from-instance cannot be used with the argument %q", arg)
+	}
+	if name == "" {
+		return nil, errors.New("must pass instance name with --name when using --from-instance")
+	}
+	name, err := identifierutil.ExpandHostUser(name)
+	if err != nil {
+		return nil, err
+	}
+	src, err := store.Inspect(fromInstance)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := limatmpl.FromInstance(src)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Name = name
+	return tmpl, nil
+}
+
+func applyYQExpressionToExistingInstance(cmd *cobra.Command, inst *store.Instance, yq string) (*store.Instance, error) {
 	if strings.TrimSpace(yq) == "" {
 		return inst, nil
 	}
@@ -232,6 +343,10 @@ func applyYQExpressionToExistingInstance(inst *store.Instance, yq string) (*stor
 	if err != nil {
 		return nil, err
 	}
+	yBytes, err = editflags.AddProvenanceComment(yBytes, cmd.Name(), cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
 	y, err := limayaml.Load(yBytes, filePath)
 	if err != nil {
 		return nil, err
@@ -247,6 +362,7 @@ func applyYQExpressionToExistingInstance(inst *store.Instance, yq string) (*stor
 	if err := os.WriteFile(filePath, yBytes, 0o644); err != nil {
 		return nil, err
 	}
+	history.RecordEdit(inst.Dir, yContent, yBytes, "limactl start")
 	// Reload
 	return store.Inspect(inst.Name)
 }
@@ -397,6 +513,14 @@ func startAction(cmd *cobra.Command, args []string) error {
 	} else if exit {
 		return nil
 	}
+	if len(args) > 1 {
+		for _, name := range []string{"name", "foreground", "metrics-port"} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s cannot be used with multiple instances", name)
+			}
+		}
+		return runParallel(cmd, args)
+	}
 	inst, err := loadOrCreateInstance(cmd, args, false)
 	if err != nil {
 		return err
@@ -410,8 +534,14 @@ func startAction(cmd *cobra.Command, args []string) error {
 			inst.Name, instance.LimactlShellCmd(inst.Name))
 		// Not an error
 		return nil
+	case store.StatusCrashed:
+		return fmt.Errorf("the guest kernel of instance %q has panicked (artifacts: %s), run `limactl restart %s` to restart the instance",
+			inst.Name, inst.Crash.Dir, inst.Name)
 	case store.StatusStopped:
 		// NOP
+	case store.StatusSuspended:
+		logrus.Infof("Resuming the instance %q suspended with `limactl suspend` (run `limactl stop %s` first to boot it from scratch)",
+			inst.Name, inst.Name)
 	default:
 		logrus.Warnf("expected status %q, got %q", store.StatusStopped, inst.Status)
 	}
@@ -436,7 +566,44 @@ func startAction(cmd *cobra.Command, args []string) error {
 	if timeout > 0 {
 		ctx = instance.WithWatchHostAgentTimeout(ctx, timeout)
 	}
+	probeEvents, err := cmd.Flags().GetBool("probe-events")
+	if err != nil {
+		return err
+	}
+	if probeEvents {
+		ctx = instance.WithProbeEventsWriter(ctx, cmd.OutOrStdout())
+	}
+	waitForProbes, err := cmd.Flags().GetStringArray("wait-for-probe")
+	if err != nil {
+		return err
+	}
+	if len(waitForProbes) > 0 {
+		for _, name := range waitForProbes {
+			if !slices.ContainsFunc(inst.Config.Probes, func(p limayaml.Probe) bool {
+				return p.Name == name || (p.Name == "" && p.Description == name)
+			}) {
+				return fmt.Errorf("instance %q does not have a readiness probe named %q", inst.Name, name)
+			}
+		}
+		ctx = instance.WithWaitForProbes(ctx, waitForProbes)
+	}
+	metricsPort, err := cmd.Flags().GetInt("metrics-port")
+	if err != nil {
+		return err
+	}
+	if metricsPort != 0 {
+		if metricsPort < 1 || metricsPort > 65535 {
+			return fmt.Errorf("invalid metrics port %d", metricsPort)
+		}
+		ctx = instance.WithMetricsPort(ctx, metricsPort)
+	}
 
+	if inst.Status == store.StatusSuspended && !launchHostAgentForeground {
+		if err := instance.Start(ctx, inst, "", false); err != nil {
+			return err
+		}
+		return restoreSuspended(cmd.Context(), inst.Name)
+	}
 	return instance.Start(ctx, inst, "", launchHostAgentForeground)
 }
 
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/mattn/go-isatty"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const statsHelp = `Display the live resource usage of instances
+
+The CPU usage is relative to the capacity of a single CPU (i.e., 200% means two CPUs are fully used).
+The network and the block I/O are the cumulative values since the boot of the guest.
+The host CPU usage is the usage of the VM process and the host agent on the host, including the overhead
+of the virtualization; it is the estimate of the power impact of the instance.
+
+The output can be presented in one of several formats, using the --format <format> flag.
+
+  --format table - output in table format
+  --format json  - output in json format (one line per instance)
+
+With --top, the processes of the instance that use the most CPU (or memory, with --sort=memory)
+are displayed too, along with the IDs of the containers that they belong to.
+
+Example: limactl stats --top default
+`
+
+// statsInterval is the interval between the samples.
+const statsInterval = 2 * time.Second
+
+func newStatsCommand() *cobra.Command {
+	statsCommand := &cobra.Command{
+		Use:               "stats [INSTANCE]...",
+		Short:             "Display the live resource usage of instances",
+		Long:              statsHelp,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              statsAction,
+		ValidArgsFunction: statsBashComplete,
+		GroupID:           basicCommand,
+	}
+
+	statsCommand.Flags().StringP("format", "f", "table", "output format, one of: json, table")
+	statsCommand.Flags().BoolP("watch", "w", false, "keep refreshing the stats, like `top`")
+	statsCommand.Flags().Int("top", 0, "display the top N processes of the instance (\"--top\" without a value displays 10)")
+	statsCommand.Flags().Lookup("top").NoOptDefVal = "10"
+	statsCommand.Flags().String("sort", "cpu", "sort the processes by, one of: cpu, memory")
+
+	return statsCommand
+}
+
+func statsAction(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %q, must be one of: json, table", format)
+	}
+	watch, err := cmd.Flags().GetBool("watch")
+	if err != nil {
+		return err
+	}
+	top, err := cmd.Flags().GetInt("top")
+	if err != nil {
+		return err
+	}
+	sortBy, err := cmd.Flags().GetString("sort")
+	if err != nil {
+		return err
+	}
+	if sortBy != "cpu" && sortBy != "memory" {
+		return fmt.Errorf("unsupported sort key %q, must be one of: cpu, memory", sortBy)
+	}
+	if top < 0 {
+		return fmt.Errorf("--top must not be negative, got %d", top)
+	}
+	if top > 0 && len(args) != 1 {
+		return errors.New("--top requires exactly one instance name")
+	}
+
+	instances, err := statsInstances(args)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		logrus.Warn("No running instance found")
+		return nil
+	}
+
+	ctx := cmd.Context()
+	out := cmd.OutOrStdout()
+	clearScreen := watch && format == "table" && (isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()))
+	withProcesses := top > 0
+	prev := readSamples(ctx, instances, withProcesses)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(statsInterval):
+		}
+		cur := readSamples(ctx, instances, withProcesses)
+		var stats []*instance.Stats
+		for i, inst := range instances {
+			if cur[i] == nil {
+				continue
+			}
+			st := instance.NewStats(inst.Name, prev[i], cur[i])
+			if err := st.SortProcesses(sortBy, top); err != nil {
+				return err
+			}
+			stats = append(stats, st)
+		}
+		if clearScreen {
+			fmt.Fprint(out, "\033[H\033[2J")
+		}
+		if err := printStats(out, format, stats); err != nil {
+			return err
+		}
+		if !watch {
+			return nil
+		}
+		prev = cur
+	}
+}
+
+// statsInstances returns the specified instances, or all the running instances when none is specified.
+func statsInstances(args []string) ([]*store.Instance, error) {
+	if len(args) == 0 {
+		instNames, err := store.Instances()
+		if err != nil {
+			return nil, err
+		}
+		var instances []*store.Instance
+		for _, instName := range instNames {
+			inst, err := store.Inspect(instName)
+			if err != nil {
+				logrus.WithError(err).Warnf("Failed to inspect instance %q", instName)
+				continue
+			}
+			if inst.Status == store.StatusRunning {
+				instances = append(instances, inst)
+			}
+		}
+		return instances, nil
+	}
+	instances := make([]*store.Instance, 0, len(args))
+	for _, instName := range args {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+			}
+			return nil, err
+		}
+		if inst.Status != store.StatusRunning {
+			return nil, fmt.Errorf("instance %q is not running (status %q)", instName, inst.Status)
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// readSamples reads the samples of the instances in parallel.
+// The sample is nil for the instances that failed.
+func readSamples(ctx context.Context, instances []*store.Instance, withProcesses bool) []*instance.Sample {
+	samples := make([]*instance.Sample, len(instances))
+	var wg sync.WaitGroup
+	for i, inst := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sample, err := instance.ReadSample(ctx, inst, withProcesses)
+			if err != nil {
+				if ctx.Err() == nil {
+					logrus.WithError(err).Warnf("Failed to read the stats of instance %q", inst.Name)
+				}
+				return
+			}
+			samples[i] = sample
+		}()
+	}
+	wg.Wait()
+	return samples
+}
+
+func printStats(w io.Writer, format string, stats []*instance.Stats) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		for _, st := range stats {
+			if err := enc.Encode(st); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 4, 8, 4, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCPU %\tHOST CPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O")
+	for _, st := range stats {
+		fmt.Fprintf(tw, "%s\t%.2f%%\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\n",
+			st.Name,
+			st.CPUPercent,
+			st.HostCPUPercent,
+			units.BytesSize(float64(st.MemoryUsed)), units.BytesSize(float64(st.MemoryTotal)),
+			st.MemoryPercent,
+			units.HumanSize(float64(st.NetRxBytes)), units.HumanSize(float64(st.NetTxBytes)),
+			units.HumanSize(float64(st.DiskReadBytes)), units.HumanSize(float64(st.DiskWriteBytes)),
+		)
+	}
+	for _, st := range stats {
+		if len(st.Processes) == 0 {
+			continue
+		}
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "PID\tCPU %\tMEM %\tRSS\tCONTAINER\tCOMMAND")
+		for _, p := range st.Processes {
+			container := p.Container
+			if container == "" {
+				container = "-"
+			}
+			fmt.Fprintf(tw, "%d\t%.2f%%\t%.2f%%\t%s\t%s\t%s\n",
+				p.PID, p.CPUPercent, p.MemoryPercent, units.BytesSize(float64(p.MemoryRSS)), container, p.Command)
+		}
+	}
+	return tw.Flush()
+}
+
+func statsBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
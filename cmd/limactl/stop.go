@@ -4,27 +4,57 @@ import (
 	"github.com/lima-vm/lima/pkg/instance"
 	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 func newStopCommand() *cobra.Command {
 	stopCmd := &cobra.Command{
-		Use:               "stop INSTANCE",
-		Short:             "Stop an instance",
-		Args:              WrapArgsError(cobra.MaximumNArgs(1)),
+		Use: "stop INSTANCE [INSTANCE...]",
+		Example: `
+To stop the instances "foo", "bar", and "baz" in parallel:
+$ limactl stop foo bar baz
+
+To stop all the running instances with the label "team=infra":
+$ limactl stop --filter label=team=infra
+`,
+		Short: "Stop an instance",
+		Long: `Stop an instance.
+
+With --filter, the running instances matching the filters are stopped.
+When no instance is specified, all the instances are filtered.
+
+` + store.FilterHelp,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
 		RunE:              stopAction,
 		ValidArgsFunction: stopBashComplete,
 		GroupID:           basicCommand,
 	}
 
 	stopCmd.Flags().BoolP("force", "f", false, "force stop the instance")
+	registerParallelFlags(stopCmd)
+	registerFilterFlag(stopCmd)
 	return stopCmd
 }
 
 func stopAction(cmd *cobra.Command, args []string) error {
-	instName := DefaultInstanceName
-	if len(args) > 0 {
-		instName = args[0]
+	if cmd.Flags().Changed("filter") {
+		instNames, err := stopFilteredInstanceNames(cmd, args)
+		if err != nil {
+			return err
+		}
+		if len(instNames) == 0 {
+			logrus.Warn("No running instance matching the filters found.")
+			return nil
+		}
+		args = instNames
+	}
+	if len(args) > 1 {
+		return runParallel(cmd, args)
+	}
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
 	}
 
 	inst, err := store.Inspect(instName)
@@ -36,6 +66,10 @@ func stopAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if inst.Status == store.StatusSuspended {
+		// The instance is not running, so stopping it means discarding the saved state
+		return instance.DiscardSuspendedState(inst)
+	}
 	if force {
 		instance.StopForcibly(inst)
 	} else {
@@ -48,6 +82,36 @@ func stopAction(cmd *cobra.Command, args []string) error {
 	return err
 }
 
+// stopFilteredInstanceNames returns the instances in args (or all the instances, if args is empty)
+// that match --filter, excluding the stopped ones.
+func stopFilteredInstanceNames(cmd *cobra.Command, args []string) ([]string, error) {
+	instNames := args
+	if len(instNames) == 0 {
+		var err error
+		instNames, err = store.Instances()
+		if err != nil {
+			return nil, err
+		}
+	}
+	instNames, err := filterInstanceNames(cmd, instNames)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return nil, err
+		}
+		if inst.Status == store.StatusStopped {
+			logrus.Debugf("Skipping the stopped instance %q", instName)
+			continue
+		}
+		res = append(res, instName)
+	}
+	return res, nil
+}
+
 func stopBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	return bashCompleteInstanceNames(cmd)
 }
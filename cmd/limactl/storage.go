@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newStorageCommand() *cobra.Command {
+	storageCommand := &cobra.Command{
+		Use:   "storage",
+		Short: "Manage the storage locations of the disk images of instances",
+		Example: `  Move the disk images of an instance to an external volume:
+  $ limactl storage move INSTANCE /Volumes/External/lima
+
+  Move the disk images back into the instance directory:
+  $ limactl storage move INSTANCE`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		GroupID:       advancedCommand,
+	}
+	storageCommand.AddCommand(
+		newStorageMoveCommand(),
+	)
+	return storageCommand
+}
+
+func newStorageMoveCommand() *cobra.Command {
+	storageMoveCommand := &cobra.Command{
+		Use:   "move INSTANCE [DIR]",
+		Short: "Move the disk images of a stopped instance to another directory",
+		Long: `Move the disk images of a stopped instance to "DIR/INSTANCE", and save DIR as ` + "`storage.dir`" + ` of the instance.
+When DIR is omitted, the disk images are moved back into the instance directory.
+The other files of the instance stay in the instance directory.`,
+		Args:              WrapArgsError(cobra.RangeArgs(1, 2)),
+		RunE:              storageMoveAction,
+		ValidArgsFunction: storageMoveBashComplete,
+	}
+	return storageMoveCommand
+}
+
+func storageMoveAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+	var dir string
+	if len(args) > 1 {
+		dir = args[1]
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist", instName)
+		}
+		return err
+	}
+	if err := instance.MoveStorage(cmd.Context(), inst, dir); err != nil {
+		return err
+	}
+	inst, err = store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("The disk images of instance %q are stored in %q", instName, store.StorageDir(inst.Dir, inst.Config))
+	return nil
+}
+
+func storageMoveBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return bashCompleteInstanceNames(cmd)
+	}
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
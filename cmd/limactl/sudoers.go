@@ -4,14 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"runtime"
+	"slices"
 
 	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/vfio"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
-const networksURL = "https://lima-vm.io/docs/config/network/#socket_vmnet"
+const (
+	networksURL    = "https://lima-vm.io/docs/config/network/#socket_vmnet"
+	passthroughURL = "https://lima-vm.io/docs/config/passthrough/"
+)
 
 func newSudoersCommand() *cobra.Command {
 	sudoersCommand := &cobra.Command{
@@ -24,10 +31,11 @@ To validate the existing /etc/sudoers.d/lima file:
 $ limactl sudoers --check /etc/sudoers.d/lima
 `,
 		Short: "Generate the content of the /etc/sudoers.d/lima file",
-		Long: fmt.Sprintf(`Generate the content of the /etc/sudoers.d/lima file for enabling vmnet.framework support.
+		Long: fmt.Sprintf(`Generate the content of the /etc/sudoers.d/lima file for enabling vmnet.framework support (macOS),
+or for preparing the PCI devices of "passthrough.pci" and "passthrough.gpu" for VFIO (Linux).
 The content is written to stdout, NOT to the file.
 This command must not run as the root user.
-See %s for the usage.`, networksURL),
+See %s and %s for the usage.`, networksURL, passthroughURL),
 		Args:    WrapArgsError(cobra.MaximumNArgs(1)),
 		RunE:    sudoersAction,
 		GroupID: advancedCommand,
@@ -39,8 +47,12 @@ See %s for the usage.`, networksURL),
 }
 
 func sudoersAction(cmd *cobra.Command, args []string) error {
-	if runtime.GOOS != "darwin" {
-		return errors.New("sudoers command is only supported on macOS right now")
+	switch runtime.GOOS {
+	case "darwin":
+	case "linux":
+		return sudoersVFIOAction(cmd, args)
+	default:
+		return errors.New("sudoers command is only supported on macOS and Linux right now")
 	}
 	nwCfg, err := networks.LoadConfig()
 	if err != nil {
@@ -94,3 +106,55 @@ func verifySudoAccess(nwCfg networks.Config, args []string, stdout io.Writer) er
 	fmt.Fprintf(stdout, "%q is up-to-date (or sudo doesn't require a password)\n", file)
 	return nil
 }
+
+// sudoersVFIOAction generates the sudoers rules for the PCI devices of `passthrough.pci` and `passthrough.gpu` of the instances.
+func sudoersVFIOAction(cmd *cobra.Command, args []string) error {
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+	if !check && len(args) > 0 {
+		return errors.New("the file argument can be specified only for --check mode")
+	}
+	instNames, err := store.Instances()
+	if err != nil {
+		return err
+	}
+	var addrs []string
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return err
+		}
+		if inst.Config != nil {
+			pci, err := vfio.Addresses(inst.Config.Passthrough.PCI, inst.Config.Passthrough.GPU)
+			if err != nil {
+				return fmt.Errorf("instance %q: %w", instName, err)
+			}
+			addrs = append(addrs, pci...)
+		}
+	}
+	slices.Sort(addrs)
+	sudoers, err := vfio.Sudoers(slices.Compact(addrs))
+	if err != nil {
+		return err
+	}
+	if !check {
+		fmt.Fprint(cmd.OutOrStdout(), sudoers)
+		return nil
+	}
+	file := "/etc/sudoers.d/lima"
+	if len(args) > 0 {
+		file = args[0]
+	}
+	hint := fmt.Sprintf("run `%s sudoers | sudo tee %q`", os.Args[0], file)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("can't read %q: %w: (Hint: %s)", file, err, hint)
+	}
+	if string(b) != sudoers {
+		return fmt.Errorf("sudoers file %q is out of sync and must be regenerated (Hint: %s)", file, hint)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%q is up-to-date\n", file)
+	return nil
+}
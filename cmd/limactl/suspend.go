@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/lima-vm/lima/pkg/instance"
+	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newSuspendCommand() *cobra.Command {
+	suspendCmd := &cobra.Command{
+		Use: "suspend INSTANCE [INSTANCE...]",
+		Example: `
+To suspend the instance "default":
+$ limactl suspend
+
+To resume the instance:
+$ limactl resume
+`,
+		Short: "Save the state of an instance to the disk, and stop it",
+		Long: `Save the whole state of the VM, including the memory, to the disk, and stop the instance without shutting down the guest.
+
+The state is restored by "limactl resume" (or "limactl start"), without a boot cycle.
+The tunnels created with "limactl tunnel" are re-created on resuming, and the ports are forwarded again.
+"limactl stop" discards the saved state, so that the next start boots the VM from scratch.
+
+The state is stored next to the disks of the instance, and its size is up to the memory size of the instance.
+Requires the qemu driver, or the vz driver on macOS 14 or later with Apple silicon.`,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              suspendAction,
+		ValidArgsFunction: suspendBashComplete,
+		GroupID:           advancedCommand,
+	}
+	registerParallelFlags(suspendCmd)
+	return suspendCmd
+}
+
+func suspendAction(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return runParallel(cmd, args)
+	}
+	instName, err := instanceNameFromArgs(args)
+	if err != nil {
+		return err
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return err
+	}
+	if err := instance.Suspend(cmd.Context(), inst); err != nil {
+		return err
+	}
+	return networks.Reconcile(cmd.Context(), "")
+}
+
+func suspendBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
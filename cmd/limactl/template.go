@@ -1,13 +1,19 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/lima-vm/lima/pkg/limatmpl"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/templatestore"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -27,6 +33,7 @@ func newTemplateCommand() *cobra.Command {
 	templateCommand.AddCommand(
 		newTemplateCopyCommand(),
 		newTemplateValidateCommand(),
+		newTemplateRepoCommand(),
 	)
 	return templateCommand
 }
@@ -38,13 +45,16 @@ func newValidateCommand() *cobra.Command {
 	return validateCommand
 }
 
-var templateCopyExample = `  Template locators are local files, file://, https://, or template:// URLs
+var templateCopyExample = `  Template locators are local files, file://, https://, template://, or oci:// URLs
 
   # Copy default template to STDOUT
   limactl template copy template://default -
 
   # Copy template from web location to local file
   limactl template copy https://example.com/lima.yaml mighty-machine.yaml
+
+  # Derive a template from the existing instance "default", for sharing the configuration with others
+  limactl template copy --from-instance=default shared.yaml
 `
 
 func newTemplateCopyCommand() *cobra.Command {
@@ -53,22 +63,46 @@ func newTemplateCopyCommand() *cobra.Command {
 		Short:   "Copy template",
 		Long:    "Copy a template via locator to a local file",
 		Example: templateCopyExample,
-		Args:    WrapArgsError(cobra.ExactArgs(2)),
+		Args:    WrapArgsError(cobra.RangeArgs(1, 2)),
 		RunE:    templateCopyAction,
 	}
+	templateCopyCommand.Flags().String("from-instance", "", "derive the template from an existing instance, instead of TEMPLATE")
+	_ = templateCopyCommand.RegisterFlagCompletionFunc("from-instance", func(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return bashCompleteInstanceNames(cmd)
+	})
 	return templateCopyCommand
 }
 
 func templateCopyAction(cmd *cobra.Command, args []string) error {
-	tmpl, err := limatmpl.Read(cmd.Context(), "", args[0])
+	fromInstance, err := cmd.Flags().GetString("from-instance")
 	if err != nil {
 		return err
 	}
-	if len(tmpl.Bytes) == 0 {
-		return fmt.Errorf("don't know how to interpret %q as a template locator", args[0])
+	var tmpl *limatmpl.Template
+	if fromInstance != "" {
+		if len(args) != 1 {
+			return errors.New("--from-instance requires exactly 1 argument (DEST)")
+		}
+		inst, err := store.Inspect(fromInstance)
+		if err != nil {
+			return err
+		}
+		if tmpl, err = limatmpl.FromInstance(inst); err != nil {
+			return err
+		}
+	} else {
+		if len(args) != 2 {
+			return fmt.Errorf("accepts 2 arg(s), received %d", len(args))
+		}
+		if tmpl, err = limatmpl.Read(cmd.Context(), "", args[0]); err != nil {
+			return err
+		}
+		if len(tmpl.Bytes) == 0 {
+			return fmt.Errorf("don't know how to interpret %q as a template locator", args[0])
+		}
 	}
 	writer := cmd.OutOrStdout()
-	target := args[1]
+	target := args[len(args)-1]
 	if target != "-" {
 		file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
 		if err != nil {
@@ -135,3 +169,123 @@ func templateValidateAction(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+var templateRepoExample = `  # Add a repository served over HTTPS, which resolves template://myrepo/foo to https://example.com/templates/foo.yaml
+  limactl template repo add myrepo https://example.com/templates
+
+  # Add a repository in an OCI registry, which resolves template://myrepo/foo to ghcr.io/OWNER/templates/foo:latest
+  limactl template repo add myrepo oci://ghcr.io/OWNER/templates
+
+  # Create an instance from a template pinned to the digest of its content
+  limactl create template://myrepo/foo@sha256:0123...
+`
+
+func newTemplateRepoCommand() *cobra.Command {
+	templateRepoCommand := &cobra.Command{
+		Use:   "repo",
+		Short: "Manage template repositories",
+		Long: `Manage template repositories, which resolve template://REPO/TEMPLATE in addition to the builtin templates.
+The fetched templates are cached, and the cache is used when the repository is not reachable.`,
+		Example: templateRepoExample,
+	}
+	templateRepoCommand.AddCommand(
+		newTemplateRepoAddCommand(),
+		newTemplateRepoRemoveCommand(),
+		newTemplateRepoListCommand(),
+	)
+	return templateRepoCommand
+}
+
+func newTemplateRepoAddCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add NAME URL",
+		Short: "Add a template repository",
+		Long:  "Add a template repository. URL is either https://HOST/PATH or oci://REGISTRY/REPOSITORY.",
+		Args:  WrapArgsError(cobra.ExactArgs(2)),
+		RunE:  templateRepoAddAction,
+	}
+}
+
+func templateRepoAddAction(_ *cobra.Command, args []string) error {
+	repo := templatestore.Repo{Name: args[0], URL: args[1]}
+	if err := templatestore.AddRepo(repo); err != nil {
+		return err
+	}
+	if strings.HasPrefix(repo.URL, "http://") {
+		logrus.Warnf("Template repository %q is not served over HTTPS, the templates can be tampered with in transit (hint: pin the templates to digests)", repo.Name)
+	}
+	logrus.Infof("Added template repository %q (%s), use template://%s/TEMPLATE to refer to the templates", repo.Name, repo.URL, repo.Name)
+	return nil
+}
+
+func newTemplateRepoRemoveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "remove NAME [NAME, ...]",
+		Aliases:           []string{"rm"},
+		Short:             "Remove template repositories",
+		Args:              WrapArgsError(cobra.MinimumNArgs(1)),
+		RunE:              templateRepoRemoveAction,
+		ValidArgsFunction: templateRepoBashComplete,
+	}
+}
+
+func templateRepoRemoveAction(_ *cobra.Command, args []string) error {
+	for _, name := range args {
+		if err := templatestore.RemoveRepo(name); err != nil {
+			return err
+		}
+		logrus.Infof("Removed template repository %q", name)
+	}
+	return nil
+}
+
+func newTemplateRepoListCommand() *cobra.Command {
+	templateRepoListCommand := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List template repositories",
+		Args:    WrapArgsError(cobra.NoArgs),
+		RunE:    templateRepoListAction,
+	}
+	templateRepoListCommand.Flags().Bool("json", false, "JSONify output")
+	return templateRepoListCommand
+}
+
+func templateRepoListAction(cmd *cobra.Command, _ []string) error {
+	jsonFormat, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	repos, err := templatestore.Repos()
+	if err != nil {
+		return err
+	}
+	if jsonFormat {
+		for _, repo := range repos {
+			j, err := json.Marshal(repo)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(j))
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "NAME\tURL")
+	for _, repo := range repos {
+		fmt.Fprintf(w, "%s\t%s\n", repo.Name, repo.URL)
+	}
+	return w.Flush()
+}
+
+func templateRepoBashComplete(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	repos, err := templatestore.Repos()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
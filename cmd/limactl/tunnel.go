@@ -1,16 +1,30 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/containerd/containerd/identifiers"
+	"github.com/lima-vm/lima/pkg/executil"
 	"github.com/lima-vm/lima/pkg/freeport"
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/mattn/go-shellwords"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -18,13 +32,33 @@ import (
 
 const tunnelHelp = `Create a tunnel for Lima
 
-Create a SOCKS tunnel so that the host can join the guest network.
+Create a SOCKS tunnel so that the host can join the guest network (--type=socks, the default),
+or forward a UDP port of the host to the guest via the usernet (--type=udp).
+
+An instance may have multiple tunnels, distinguished by --name.
+The tunnels run in the background until "limactl tunnel stop" is executed or the instance is stopped.
+
+The UDP tunnels require the gvisor-tap-vsock usernet, i.e., the vz driver,
+or "networks: [{lima: user-v2}]" in the instance.
 `
 
 func newTunnelCommand() *cobra.Command {
 	tunnelCmd := &cobra.Command{
 		Use:   "tunnel [flags] INSTANCE",
 		Short: "Create a tunnel for Lima",
+		Example: `
+To create a SOCKS tunnel:
+$ limactl tunnel default
+
+To forward the UDP port 5353 of the host to the UDP port 53 of the guest:
+$ limactl tunnel --type=udp --udp-port=5353:53 default
+
+To list the tunnels:
+$ limactl tunnel list default
+
+To stop the tunnel:
+$ limactl tunnel stop default udp-53
+`,
 		PersistentPreRun: func(*cobra.Command, []string) {
 			logrus.Warn("`limactl tunnel` is experimental")
 		},
@@ -38,8 +72,14 @@ func newTunnelCommand() *cobra.Command {
 
 	tunnelCmd.Flags().SetInterspersed(false)
 	// TODO: implement l2tp, ikev2, masque, ...
-	tunnelCmd.Flags().String("type", "socks", "Tunnel type, currently only \"socks\" is implemented")
+	tunnelCmd.Flags().String("type", instance.TunnelSOCKS, "Tunnel type, one of: socks, udp")
+	tunnelCmd.Flags().String("name", "", "Tunnel name, defaults to \"socks\", or \"udp-GUESTPORT\"")
 	tunnelCmd.Flags().Int("socks-port", 0, "SOCKS port, defaults to a random port")
+	tunnelCmd.Flags().String("udp-port", "", "UDP port to forward, as [HOSTPORT:]GUESTPORT")
+	tunnelCmd.AddCommand(
+		newTunnelListCommand(),
+		newTunnelStopCommand(),
+	)
 	return tunnelCmd
 }
 
@@ -49,17 +89,51 @@ func tunnelAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	if tunnelType != "socks" {
-		return fmt.Errorf("unknown tunnel type: %q", tunnelType)
+	name, err := flags.GetString("name")
+	if err != nil {
+		return err
 	}
-	port, err := flags.GetInt("socks-port")
+	socksPort, err := flags.GetInt("socks-port")
 	if err != nil {
 		return err
 	}
-	if port != 0 && (port < 1024 || port > 65535) {
-		return fmt.Errorf("invalid socks port %d", port)
+	udpPort, err := flags.GetString("udp-port")
+	if err != nil {
+		return err
 	}
-	stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	var hostPort, guestPort int
+	switch tunnelType {
+	case instance.TunnelSOCKS:
+		if udpPort != "" {
+			return errors.New("--udp-port requires --type=udp")
+		}
+		if socksPort != 0 && (socksPort < 1024 || socksPort > 65535) {
+			return fmt.Errorf("invalid socks port %d", socksPort)
+		}
+		if name == "" {
+			name = instance.TunnelSOCKS
+		}
+	case instance.TunnelUDP:
+		if flags.Changed("socks-port") {
+			return errors.New("--socks-port requires --type=socks")
+		}
+		if udpPort == "" {
+			return errors.New("--type=udp requires --udp-port")
+		}
+		hostPort, guestPort, err = parseUDPPort(udpPort)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = fmt.Sprintf("udp-%d", guestPort)
+		}
+	default:
+		return fmt.Errorf("unknown tunnel type: %q", tunnelType)
+	}
+	if err := identifiers.Validate(name); err != nil {
+		return fmt.Errorf("invalid tunnel name %q: %w", name, err)
+	}
+	stdout := cmd.OutOrStdout()
 	instName := args[0]
 	inst, err := store.Inspect(instName)
 	if err != nil {
@@ -68,20 +142,87 @@ func tunnelAction(cmd *cobra.Command, args []string) error {
 		}
 		return err
 	}
-	if inst.Status == store.StatusStopped {
-		return fmt.Errorf("instance %q is stopped, run `limactl start %s` to start the instance", instName, instName)
+	if inst.Status != store.StatusRunning {
+		return fmt.Errorf("instance %q is not running, run `limactl start %s` to start the instance", instName, instName)
+	}
+
+	if tunnelType == instance.TunnelUDP {
+		if hostPort == 0 {
+			if hostPort, err = freeport.UDP(); err != nil {
+				return err
+			}
+		}
+		t, err := instance.StartUDPTunnel(cmd.Context(), inst, name, hostPort, guestPort)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Forwarding %s/udp to %s/udp of the instance.\n", t.Local, t.Remote)
+		fmt.Fprintf(stdout, "Run `limactl tunnel stop %s %s` to stop the tunnel.\n", instName, name)
+		return nil
 	}
 
-	if port == 0 {
-		port, err = freeport.TCP()
+	if err := instance.CheckTunnelName(inst, name); err != nil {
+		return err
+	}
+	if socksPort == 0 {
+		socksPort, err = freeport.TCP()
 		if err != nil {
 			return err
 		}
 	}
+	t, err := startSOCKSTunnel(inst, name, socksPort)
+	if err != nil {
+		return err
+	}
+	if err := instance.AddTunnel(inst, *t); err != nil {
+		if killErr := osutil.SysKill(t.PID, osutil.SigInt); killErr != nil {
+			logrus.WithError(killErr).Warnf("Failed to stop the ssh process (PID %d)", t.PID)
+		}
+		return err
+	}
 
+	switch runtime.GOOS {
+	case "darwin":
+		fmt.Fprintf(stdout, "Open <System Settings> → <Network> → <Wi-Fi> (or whatever) → <Details> → <Proxies> → <SOCKS proxy>,\n")
+		fmt.Fprintf(stdout, "and specify the following configuration:\n")
+		fmt.Fprintf(stdout, "- Server: 127.0.0.1\n")
+		fmt.Fprintf(stdout, "- Port: %d\n", socksPort)
+	case "windows":
+		fmt.Fprintf(stdout, "Open <Settings> → <Network & Internet> → <Proxy>,\n")
+		fmt.Fprintf(stdout, "and specify the following configuration:\n")
+		fmt.Fprintf(stdout, "- Address: socks=127.0.0.1\n")
+		fmt.Fprintf(stdout, "- Port: %d\n", socksPort)
+	default:
+		fmt.Fprintf(stdout, "Set `ALL_PROXY=socks5h://127.0.0.1:%d`, etc.\n", socksPort)
+	}
+	fmt.Fprintf(stdout, "The instance can be connected from the host as <http://%s.internal> via a web browser.\n", inst.Hostname)
+	fmt.Fprintf(stdout, "Run `limactl tunnel stop %s %s` to stop the tunnel.\n", instName, name)
+	return nil
+}
+
+// parseUDPPort parses "[HOSTPORT:]GUESTPORT". The host port is 0 when omitted.
+func parseUDPPort(s string) (hostPort, guestPort int, err error) {
+	hostStr, guestStr, ok := strings.Cut(s, ":")
+	if !ok {
+		hostStr, guestStr = "", s
+	}
+	if hostStr != "" {
+		if hostPort, err = strconv.Atoi(hostStr); err != nil || hostPort < 1 || hostPort > 65535 {
+			return 0, 0, fmt.Errorf("invalid host port in --udp-port %q", s)
+		}
+	}
+	if guestPort, err = strconv.Atoi(guestStr); err != nil || guestPort < 1 || guestPort > 65535 {
+		return 0, 0, fmt.Errorf("invalid guest port in --udp-port %q", s)
+	}
+	return hostPort, guestPort, nil
+}
+
+// startSOCKSTunnel starts `ssh -D` in the background, and waits until the SOCKS port is ready.
+func startSOCKSTunnel(inst *store.Instance, name string, port int) (*metadata.Tunnel, error) {
 	var (
 		arg0     string
 		arg0Args []string
+		err      error
 	)
 	// FIXME: deduplicate the code clone across `limactl shell` and `limactl tunnel`
 	if sshShell := os.Getenv(envShellSSH); sshShell != "" {
@@ -101,7 +242,7 @@ func tunnelAction(cmd *cobra.Command, args []string) error {
 	if arg0 == "" {
 		arg0, err = exec.LookPath("ssh")
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -113,47 +254,231 @@ func tunnelAction(cmd *cobra.Command, args []string) error {
 		*inst.Config.SSH.ForwardX11,
 		*inst.Config.SSH.ForwardX11Trusted)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	// Each tunnel has its own connection, so that the tunnel can be stopped by killing the ssh process.
+	sshOpts = slices.DeleteFunc(sshOpts, func(opt string) bool {
+		return strings.HasPrefix(opt, "ControlMaster=") || strings.HasPrefix(opt, "ControlPath=") || strings.HasPrefix(opt, "ControlPersist=")
+	})
+	// The ssh process exits when the instance is stopped.
+	sshOpts = append(sshOpts, "ExitOnForwardFailure=yes", "ServerAliveInterval=5", "ServerAliveCountMax=3")
+	local := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
 	sshArgs := sshutil.SSHArgsFromOpts(sshOpts)
 	sshArgs = append(sshArgs, []string{
-		"-q", // quiet
-		"-f", // background
 		"-N", // no command
-		"-D", fmt.Sprintf("127.0.0.1:%d", port),
+		"-D", local,
 		"-p", strconv.Itoa(inst.SSHLocalPort),
 		inst.SSHAddress,
 	}...)
 	sshCmd := exec.Command(arg0, append(arg0Args, sshArgs...)...)
-	sshCmd.Stdout = stderr
-	sshCmd.Stderr = stderr
+	sshCmd.SysProcAttr = executil.BackgroundSysProcAttr
+	logPath := filepath.Join(inst.Dir, fmt.Sprintf(filenames.TunnelLog, name))
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+	sshCmd.Stdout = logFile
+	sshCmd.Stderr = logFile
 	logrus.Debugf("executing ssh (may take a long)): %+v", sshCmd.Args)
+	if err := sshCmd.Start(); err != nil {
+		return nil, err
+	}
+	exitCh := make(chan error, 1)
+	go func() {
+		exitCh <- sshCmd.Wait()
+	}()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(time.Minute)
+	for {
+		select {
+		case err := <-exitCh:
+			return nil, fmt.Errorf("ssh exited before the SOCKS port got ready (hint: see %q): %w", logPath, err)
+		case <-timeout:
+			_ = sshCmd.Process.Kill()
+			return nil, fmt.Errorf("timed out waiting for the SOCKS port %s (hint: see %q)", local, logPath)
+		case <-ticker.C:
+			if conn, err := net.DialTimeout("tcp", local, time.Second); err == nil {
+				_ = conn.Close()
+				return &metadata.Tunnel{
+					Name:  name,
+					Type:  instance.TunnelSOCKS,
+					Local: local,
+					PID:   sshCmd.Process.Pid,
+				}, nil
+			}
+		}
+	}
+}
 
-	if err := sshCmd.Run(); err != nil {
-		return err
+// restoreTunnels re-creates the tunnels on the same host ports, e.g., after `limactl restart`.
+// The tunnels that cannot be re-created are logged.
+func restoreTunnels(ctx context.Context, inst *store.Instance, tunnels []metadata.Tunnel) {
+	for _, t := range tunnels {
+		if err := restoreTunnel(ctx, inst, t); err != nil {
+			logrus.WithError(err).Warnf("Failed to re-create the tunnel %q (%s, %s)", t.Name, t.Type, t.Local)
+			continue
+		}
+		logrus.Infof("Re-created the tunnel %q (%s, %s)", t.Name, t.Type, t.Local)
 	}
+}
 
-	switch runtime.GOOS {
-	case "darwin":
-		fmt.Fprintf(stdout, "Open <System Settings> → <Network> → <Wi-Fi> (or whatever) → <Details> → <Proxies> → <SOCKS proxy>,\n")
-		fmt.Fprintf(stdout, "and specify the following configuration:\n")
-		fmt.Fprintf(stdout, "- Server: 127.0.0.1\n")
-		fmt.Fprintf(stdout, "- Port: %d\n", port)
-	case "windows":
-		fmt.Fprintf(stdout, "Open <Settings> → <Network & Internet> → <Proxy>,\n")
-		fmt.Fprintf(stdout, "and specify the following configuration:\n")
-		fmt.Fprintf(stdout, "- Address: socks=127.0.0.1\n")
-		fmt.Fprintf(stdout, "- Port: %d\n", port)
+func restoreTunnel(ctx context.Context, inst *store.Instance, t metadata.Tunnel) error {
+	_, portStr, err := net.SplitHostPort(t.Local)
+	if err != nil {
+		return err
+	}
+	hostPort, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+	switch t.Type {
+	case instance.TunnelSOCKS:
+		restored, err := startSOCKSTunnel(inst, t.Name, hostPort)
+		if err != nil {
+			return err
+		}
+		if err := instance.AddTunnel(inst, *restored); err != nil {
+			if killErr := osutil.SysKill(restored.PID, osutil.SigInt); killErr != nil {
+				logrus.WithError(killErr).Warnf("Failed to stop the ssh process (PID %d)", restored.PID)
+			}
+			return err
+		}
+		return nil
+	case instance.TunnelUDP:
+		// The guest IP may have changed, so only the guest port is kept
+		_, guestPortStr, err := net.SplitHostPort(t.Remote)
+		if err != nil {
+			return err
+		}
+		guestPort, err := strconv.Atoi(guestPortStr)
+		if err != nil {
+			return err
+		}
+		_, err = instance.StartUDPTunnel(ctx, inst, t.Name, hostPort, guestPort)
+		return err
 	default:
-		fmt.Fprintf(stdout, "Set `ALL_PROXY=socks5h://127.0.0.1:%d`, etc.\n", port)
+		return fmt.Errorf("unknown tunnel type %q", t.Type)
 	}
-	fmt.Fprintf(stdout, "The instance can be connected from the host as <http://%s.internal> via a web browser.\n", inst.Hostname)
-
-	// TODO: show the port in `limactl list --json` ?
-	// TODO: add `--stop` flag to shut down the tunnel
-	return nil
 }
 
 func tunnelBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 	return bashCompleteInstanceNames(cmd)
 }
+
+func newTunnelListCommand() *cobra.Command {
+	tunnelListCommand := &cobra.Command{
+		Use: "list INSTANCE",
+		Example: `
+To list the tunnels of the instance:
+$ limactl tunnel list default
+`,
+		Short:             "List the tunnels of an instance",
+		Aliases:           []string{"ls"},
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              tunnelListAction,
+		ValidArgsFunction: tunnelBashComplete,
+	}
+	tunnelListCommand.Flags().Bool("json", false, "JSONify output")
+	return tunnelListCommand
+}
+
+func tunnelListAction(cmd *cobra.Command, args []string) error {
+	jsonFormat, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	tunnels, err := instance.Tunnels(inst)
+	if err != nil {
+		return err
+	}
+	w := cmd.OutOrStdout()
+	if jsonFormat {
+		enc := json.NewEncoder(w)
+		for _, t := range tunnels {
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 4, 8, 4, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tLOCAL\tREMOTE")
+	for _, t := range tunnels {
+		remote := t.Remote
+		if remote == "" {
+			remote = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Name, t.Type, t.Local, remote)
+	}
+	return tw.Flush()
+}
+
+func newTunnelStopCommand() *cobra.Command {
+	tunnelStopCommand := &cobra.Command{
+		Use: "stop INSTANCE [NAME...]",
+		Example: `
+To stop the tunnel:
+$ limactl tunnel stop default socks
+
+To stop all the tunnels of the instance:
+$ limactl tunnel stop --all default
+`,
+		Short:             "Stop the tunnels of an instance",
+		Args:              WrapArgsError(cobra.MinimumNArgs(1)),
+		RunE:              tunnelStopAction,
+		ValidArgsFunction: tunnelStopBashComplete,
+	}
+	tunnelStopCommand.Flags().Bool("all", false, "stop all the tunnels of the instance")
+	return tunnelStopCommand
+}
+
+func tunnelStopAction(cmd *cobra.Command, args []string) error {
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+	names := args[1:]
+	if all == (len(names) > 0) {
+		return errors.New("specify either the names of the tunnels or --all")
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return err
+	}
+	if all {
+		instance.StopTunnels(inst)
+		return nil
+	}
+	var errs []error
+	for _, name := range names {
+		if err := instance.StopTunnel(inst, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func tunnelStopBashComplete(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return bashCompleteInstanceNames(cmd)
+	}
+	inst, err := store.Inspect(args[0])
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	tunnels, err := instance.Tunnels(inst)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	var names []string
+	for _, t := range tunnels {
+		names = append(names, t.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const updateHelp = `Update the resources of an instance
+
+For a running instance, the CPUs are hot-plugged when the driver supports it
+(QEMU with x86_64 guests, up to ` + "`maxCPUs`" + `). Otherwise, a restart is required.
+The new values are saved in lima.yaml, so they are kept across restarts.
+
+Example: limactl update --cpus 8 default
+`
+
+func newUpdateCommand() *cobra.Command {
+	updateCommand := &cobra.Command{
+		Use:               "update INSTANCE",
+		Short:             "Update the resources of an instance, including running ones",
+		Long:              updateHelp,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              updateAction,
+		ValidArgsFunction: updateBashComplete,
+		GroupID:           advancedCommand,
+	}
+	updateCommand.Flags().Int("cpus", 0, "number of CPUs")
+	return updateCommand
+}
+
+func updateAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+	if !cmd.Flags().Changed("cpus") {
+		return errors.New("no resource to update was specified (e.g., --cpus)")
+	}
+	cpus, err := cmd.Flags().GetInt("cpus")
+	if err != nil {
+		return err
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+		}
+		return err
+	}
+	if err := instance.ChangeCPUs(cmd.Context(), inst, cpus); err != nil {
+		return err
+	}
+	logrus.Infof("Instance %q updated to %d CPUs", instName, cpus)
+	return nil
+}
+
+func updateBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
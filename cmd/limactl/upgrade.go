@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/upgrade"
+	"github.com/lima-vm/lima/pkg/version"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newUpgradeCommand() *cobra.Command {
+	upgradeCommand := &cobra.Command{
+		Use:   "upgrade [INSTANCE, ...]",
+		Short: "Upgrade Lima to the latest release, or upgrade instances to the current version of Lima",
+		Long: `Upgrade limactl, the bundled templates, and the guest agent binaries to the latest release on GitHub.
+
+The release archive is verified against the SHA256SUMS of the release, and its build provenance
+is verified with 'gh attestation verify'.
+
+Running instances keep using the previous guest agent until they are restarted
+or upgraded with 'limactl upgrade INSTANCE'. Such instances are reported after the upgrade.
+
+When instances are specified, the instances created or last upgraded with another version
+of Lima are upgraded to the current version of limactl, instead of upgrading Lima itself:
+- the legacy layouts are migrated as in 'limactl migrate-layout' (the instance must be stopped)
+- the cloud-config is regenerated
+- the guest agent of a running instance is replaced over SSH (requires 'security.sudo: full')
+- the current version of Lima is recorded in the metadata of the instance
+The cidata, nerdctl, and the guest agent of a stopped instance are upgraded on the next start.
+
+With --check, nothing is modified, and the command exits with status 1 when
+a newer release is available, an instance is running an outdated guest agent,
+or a specified instance needs to be upgraded.`,
+		Example: `  To upgrade Lima:
+  $ limactl upgrade
+
+  To check whether an upgrade is available (e.g., in CI):
+  $ limactl upgrade --check
+
+  To upgrade the instance "default" after upgrading Lima:
+  $ limactl upgrade default`,
+		Args:              WrapArgsError(cobra.ArbitraryArgs),
+		RunE:              upgradeAction,
+		ValidArgsFunction: upgradeBashComplete,
+		GroupID:           advancedCommand,
+	}
+	upgradeCommand.Flags().Bool("check", false, "Only check for an upgrade; exit with status 1 if one is needed")
+	upgradeCommand.Flags().Bool("insecure-skip-verify", false, "Skip the build provenance verification (the checksum is still verified)")
+	return upgradeCommand
+}
+
+// upgradeNeededError is returned by `limactl upgrade --check` when an upgrade is needed.
+type upgradeNeededError struct{}
+
+// Error implements error.
+func (upgradeNeededError) Error() string {
+	return "upgrade needed"
+}
+
+// ExitCode implements ExitCoder.
+func (upgradeNeededError) ExitCode() int {
+	return 1
+}
+
+func upgradeAction(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return upgradeInstances(cmd, args, check)
+	}
+	skipVerify, err := cmd.Flags().GetBool("insecure-skip-verify")
+	if err != nil {
+		return err
+	}
+	rel, err := upgrade.LatestRelease(ctx)
+	if err != nil {
+		return err
+	}
+	w := cmd.OutOrStdout()
+	available := upgrade.UpdateAvailable(version.Version, rel.TagName)
+	if available {
+		fmt.Fprintf(w, "Lima %s is available (current: %s)\n", rel.TagName, version.Version)
+	} else {
+		fmt.Fprintf(w, "Lima %s is up to date (latest: %s)\n", version.Version, rel.TagName)
+	}
+
+	if available && !check {
+		prefix, err := upgrade.Prefix()
+		if err != nil {
+			return err
+		}
+		tmpDir, err := os.MkdirTemp("", "lima-upgrade")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		archive, err := upgrade.Download(ctx, rel, tmpDir, upgrade.DownloadOptions{SkipVerify: skipVerify})
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Installing %q into %q", rel.TagName, prefix)
+		if err := upgrade.Install(archive, prefix); err != nil {
+			return fmt.Errorf("failed to install %q into %q: %w", archive, prefix, err)
+		}
+		fmt.Fprintf(w, "Upgraded Lima to %s\n", rel.TagName)
+	}
+
+	outdated, err := outdatedInstances()
+	if err != nil {
+		return err
+	}
+	for _, instName := range outdated {
+		fmt.Fprintf(w, "Instance %q is running an outdated guest agent; run `limactl upgrade %s` to update it\n",
+			instName, instName)
+	}
+	if check && (available || len(outdated) > 0) {
+		return upgradeNeededError{}
+	}
+	return nil
+}
+
+func outdatedInstances() ([]string, error) {
+	instNames, err := store.Instances()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return nil, err
+		}
+		outdated, err := upgrade.OutdatedGuestAgent(inst)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to check the guest agent of instance %q", instName)
+			continue
+		}
+		if outdated {
+			res = append(res, instName)
+		}
+	}
+	return res, nil
+}
+
+func upgradeInstances(cmd *cobra.Command, instNames []string, check bool) error {
+	ctx := cmd.Context()
+	w := cmd.OutOrStdout()
+	var errs []error
+	needed := false
+	for _, instName := range instNames {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to inspect instance %q: %w", instName, err))
+			continue
+		}
+		ok, err := instance.UpgradeNeeded(inst)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to check instance %q: %w", instName, err))
+			continue
+		}
+		if !ok {
+			fmt.Fprintf(w, "Instance %q is up to date (Lima %s)\n", instName, version.Version)
+			continue
+		}
+		if check {
+			fmt.Fprintf(w, "Instance %q needs to be upgraded to Lima %s\n", instName, version.Version)
+			needed = true
+			continue
+		}
+		res, err := instance.Upgrade(ctx, inst)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to upgrade instance %q: %w", instName, err))
+			continue
+		}
+		if res.BackupDir != "" {
+			logrus.Infof("Migrated the layout of instance %q; the original files are backed up in %q", instName, res.BackupDir)
+		}
+		if res.GuestAgentUpgraded {
+			logrus.Infof("Upgraded the guest agent of instance %q", instName)
+		}
+		for _, p := range res.Pending {
+			logrus.Infof("Instance %q: %s", instName, p)
+		}
+		prev := res.PreviousVersion
+		if prev == "" {
+			prev = "prior to v0.20"
+		}
+		fmt.Fprintf(w, "Upgraded instance %q from Lima %s to %s\n", instName, prev, version.Version)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if needed {
+		return upgradeNeededError{}
+	}
+	return nil
+}
+
+func upgradeBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
@@ -23,7 +23,9 @@ func newUsernetCommand() *cobra.Command {
 	hostagentCommand.Flags().String("listen-qemu", "", "listen for qemu connections")
 	hostagentCommand.Flags().String("listen", "", "listen on a Unix socket and receive Bess-compatible FDs as SCM_RIGHTS messages")
 	hostagentCommand.Flags().String("subnet", "192.168.5.0/24", "sets subnet value for the usernet network")
+	hostagentCommand.Flags().String("ipv6-subnet", "", "sets the /64 IPv6 subnet for the usernet network (default: IPv6 disabled)")
 	hostagentCommand.Flags().Int("mtu", 1500, "mtu")
+	hostagentCommand.Flags().Bool("internal", false, "do not connect the network to the outside (\"switch\" networks)")
 	hostagentCommand.Flags().StringToString("leases", nil, "pass default static leases for startup. Eg: '192.168.104.1=52:55:55:b3:bc:d9,192.168.104.2=5a:94:ef:e4:0c:df' ")
 	return hostagentCommand
 }
@@ -58,6 +60,10 @@ func usernetAction(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	subnet6, err := cmd.Flags().GetString("ipv6-subnet")
+	if err != nil {
+		return err
+	}
 
 	leases, err := cmd.Flags().GetStringToString("leases")
 	if err != nil {
@@ -69,6 +75,11 @@ func usernetAction(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	internal, err := cmd.Flags().GetBool("internal")
+	if err != nil {
+		return err
+	}
+
 	os.RemoveAll(endpoint)
 	os.RemoveAll(qemuSocket)
 	os.RemoveAll(fdSocket)
@@ -82,6 +93,8 @@ func usernetAction(cmd *cobra.Command, _ []string) error {
 		QemuSocket:    qemuSocket,
 		FdSocket:      fdSocket,
 		Subnet:        subnet,
+		IPv6Subnet:    subnet6,
 		DefaultLeases: leases,
+		Internal:      internal,
 	})
 }
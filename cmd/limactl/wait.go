@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const waitHelp = `Wait until the conditions are met for a running instance
+
+The conditions are:
+
+  running      - the instance is running (same as "READY" of ` + "`limactl start`" + `)
+  ssh          - the user session of the guest is accessible over SSH
+  guest-agent  - the guest agent is connected
+  probe:NAME   - the readiness probe NAME has passed
+  port:PORT    - the guest is listening on the TCP port PORT, and the port forwarding has been set up
+
+When --for is specified multiple times, all the conditions have to be met.
+The command fails when a condition can no longer be met, e.g., when a probe failed or the instance is shutting down.
+
+Example: limactl wait --for ssh --for port:8080 --timeout 5m default
+`
+
+func newWaitCommand() *cobra.Command {
+	waitCommand := &cobra.Command{
+		Use:               "wait INSTANCE",
+		Short:             "Wait until the conditions are met for a running instance",
+		Long:              waitHelp,
+		Args:              WrapArgsError(cobra.ExactArgs(1)),
+		RunE:              waitAction,
+		ValidArgsFunction: waitBashComplete,
+		GroupID:           advancedCommand,
+	}
+	waitCommand.Flags().StringArray("for", []string{"running"}, "condition to wait for, one of: running, ssh, guest-agent, probe:NAME, port:PORT (can be specified multiple times)")
+	waitCommand.Flags().Duration("timeout", instance.DefaultWatchHostAgentEventsTimeout, "duration to wait for the conditions to be met (0 to wait forever)")
+	return waitCommand
+}
+
+func waitAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+	fors, err := cmd.Flags().GetStringArray("for")
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	if timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative, got %v", timeout)
+	}
+	conds := make([]instance.WaitCondition, 0, len(fors))
+	for _, s := range fors {
+		c, err := instance.ParseWaitCondition(s)
+		if err != nil {
+			return err
+		}
+		conds = append(conds, c)
+	}
+	if len(conds) == 0 {
+		return errors.New("no condition was specified")
+	}
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("instance %q does not exist, run `limactl create %s` to create a new instance", instName, instName)
+		}
+		return err
+	}
+	if err := instance.Wait(cmd.Context(), inst, conds, timeout); err != nil {
+		return err
+	}
+	logrus.Infof("Instance %q met the conditions %v", instName, conds)
+	return nil
+}
+
+func waitBashComplete(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
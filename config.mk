@@ -1,6 +1,8 @@
 CONFIG_GUESTAGENT_OS_LINUX=y
 CONFIG_GUESTAGENT_ARCH_X8664=y
 CONFIG_GUESTAGENT_ARCH_AARCH64=y
+CONFIG_GUESTAGENT_ARCH_ARMV6L=y
 CONFIG_GUESTAGENT_ARCH_ARMV7L=y
 CONFIG_GUESTAGENT_ARCH_RISCV64=y
+CONFIG_GUESTAGENT_ARCH_LOONGARCH64=y
 CONFIG_GUESTAGENT_COMPRESS=n
@@ -60,18 +60,29 @@ func DeleteStartAtLoginEntry(hostOS, instName string) (bool, error) {
 func GetFilePath(hostOS, instName string) string {
 	var fileTmpl string
 	if hostOS == "darwin" { // launchd plist
-		fileTmpl = fmt.Sprintf("%s/Library/LaunchAgents/io.lima-vm.autostart.%s.plist", os.Getenv("HOME"), instName)
+		fileTmpl = fmt.Sprintf("%s/io.lima-vm.autostart.%s.plist", unitDir(hostOS), instName)
 	}
 	if hostOS == "linux" { // systemd service
 		// Use instance name as argument to systemd service
 		// Instance name available in unit file as %i
+		fileTmpl = fmt.Sprintf("%s/lima-vm@%s.service", unitDir(hostOS), instName)
+	}
+	return fileTmpl
+}
+
+// unitDir returns the directory of the launchd agents, or of the systemd user units.
+func unitDir(hostOS string) string {
+	switch hostOS {
+	case "darwin":
+		return fmt.Sprintf("%s/Library/LaunchAgents", os.Getenv("HOME"))
+	case "linux":
 		xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
 		if xdgConfigHome == "" {
 			xdgConfigHome = filepath.Join(os.Getenv("HOME"), ".config")
 		}
-		fileTmpl = fmt.Sprintf("%s/systemd/user/lima-vm@%s.service", xdgConfigHome, instName)
+		return fmt.Sprintf("%s/systemd/user", xdgConfigHome)
 	}
-	return fileTmpl
+	return ""
 }
 
 func enableDisableService(action, hostOS, serviceWithPath string) error {
@@ -0,0 +1,209 @@
+package autostart
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/textutil"
+)
+
+//go:embed lima-vm-port.INSTANCE.PORT.socket
+var systemdSocketTemplate string
+
+//go:embed lima-vm-port.INSTANCE.PORT@.service
+var systemdSocketServiceTemplate string
+
+//go:embed io.lima-vm.port.INSTANCE.PORT.plist
+var launchdSocketTemplate string
+
+const (
+	systemdHostServicePrefix = "lima-vm-port."
+	launchdHostServicePrefix = "io.lima-vm.port."
+)
+
+// HostService is a port of an instance published as a socket-activated service of the host.
+// The host (launchd or systemd) listens on HostIP:HostPort, and runs `limactl host-service connect`
+// for each connection, which starts the instance if needed and connects to GuestIP:GuestPort.
+type HostService struct {
+	Instance  string `json:"instance"`
+	HostIP    string `json:"hostIP"`
+	HostPort  int    `json:"hostPort"`
+	GuestIP   string `json:"guestIP"`
+	GuestPort int    `json:"guestPort"`
+}
+
+// hostServicePrefix returns the prefix of the units of the host services of the instance.
+func hostServicePrefix(hostOS, instName string) string {
+	if hostOS == "darwin" {
+		return launchdHostServicePrefix + instName + "."
+	}
+	return systemdHostServicePrefix + instName + "."
+}
+
+// hostServiceUnit returns the base name of the unit of the host service, without the extension.
+func hostServiceUnit(hostOS, instName string, hostPort int) string {
+	return hostServicePrefix(hostOS, instName) + strconv.Itoa(hostPort)
+}
+
+// HostServiceFiles returns the paths of the unit files of the host service.
+// The first one is the unit that listens on the host port.
+func HostServiceFiles(hostOS, instName string, hostPort int) []string {
+	unit := filepath.Join(unitDir(hostOS), hostServiceUnit(hostOS, instName, hostPort))
+	switch hostOS {
+	case "darwin":
+		return []string{unit + ".plist"}
+	case "linux":
+		return []string{unit + ".socket", unit + "@.service"}
+	}
+	return nil
+}
+
+// CreateHostService writes the unit files of the host service, and starts listening on the host port.
+// stderrPath is the log file of the connections on darwin; the journal is used on linux.
+func CreateHostService(hostOS string, svc HostService, limaHome, stderrPath string) error {
+	files, err := renderHostService(hostOS, svc, limaHome, stderrPath, os.Executable)
+	if err != nil {
+		return err
+	}
+	paths := HostServiceFiles(hostOS, svc.Instance, svc.HostPort)
+	if err := os.MkdirAll(unitDir(hostOS), os.ModePerm); err != nil {
+		return err
+	}
+	// Reload the unit, in case the rule has changed
+	_ = stopHostService(hostOS, svc.Instance, svc.HostPort)
+	for i, path := range paths {
+		if err := os.WriteFile(path, files[i], 0o644); err != nil {
+			return err
+		}
+	}
+	return startHostService(hostOS, svc.Instance, svc.HostPort)
+}
+
+// DeleteHostService stops listening on the host port, and removes the unit files of the host service.
+func DeleteHostService(hostOS, instName string, hostPort int) error {
+	if err := stopHostService(hostOS, instName, hostPort); err != nil {
+		return err
+	}
+	for _, path := range HostServiceFiles(hostOS, instName, hostPort) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if hostOS == "linux" {
+		return runCommand("systemctl", "--user", "daemon-reload")
+	}
+	return nil
+}
+
+// HostServicePorts returns the host ports of the host services of the instance, in ascending order.
+func HostServicePorts(hostOS, instName string) ([]int, error) {
+	prefix := hostServicePrefix(hostOS, instName)
+	ext := ".plist"
+	if hostOS == "linux" {
+		ext = ".socket"
+	}
+	entries, err := os.ReadDir(unitDir(hostOS))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ports []int
+	for _, e := range entries {
+		// The instance name may contain dots, so the port is parsed from the rest of the name
+		rest, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok {
+			continue
+		}
+		rest, ok = strings.CutSuffix(rest, ext)
+		if !ok {
+			continue
+		}
+		if port, err := strconv.Atoi(rest); err == nil {
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+func startHostService(hostOS, instName string, hostPort int) error {
+	unit := hostServiceUnit(hostOS, instName, hostPort)
+	if hostOS == "darwin" {
+		// man launchctl
+		return runCommand("launchctl", "bootstrap", "gui/"+strconv.Itoa(os.Getuid()), HostServiceFiles(hostOS, instName, hostPort)[0])
+	}
+	if err := runCommand("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	return runCommand("systemctl", "--user", "enable", "--now", unit+".socket")
+}
+
+func stopHostService(hostOS, instName string, hostPort int) error {
+	unit := hostServiceUnit(hostOS, instName, hostPort)
+	files := HostServiceFiles(hostOS, instName, hostPort)
+	if len(files) == 0 {
+		return fmt.Errorf("host services are not supported on %q", hostOS)
+	}
+	if _, err := os.Stat(files[0]); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if hostOS == "darwin" {
+		return runCommand("launchctl", "bootout", fmt.Sprintf("gui/%d/%s", os.Getuid(), unit))
+	}
+	return runCommand("systemctl", "--user", "disable", "--now", unit+".socket")
+}
+
+func runCommand(args ...string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// renderHostService returns the contents of HostServiceFiles.
+func renderHostService(hostOS string, svc HostService, limaHome, stderrPath string, getExecutable func() (string, error)) ([][]byte, error) {
+	selfExeAbs, err := getExecutable()
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]string{
+		"Binary":       selfExeAbs,
+		"Instance":     svc.Instance,
+		"Label":        hostServiceUnit(hostOS, svc.Instance, svc.HostPort),
+		"HostIP":       svc.HostIP,
+		"HostPort":     strconv.Itoa(svc.HostPort),
+		"HostAddress":  net.JoinHostPort(svc.HostIP, strconv.Itoa(svc.HostPort)),
+		"GuestAddress": net.JoinHostPort(svc.GuestIP, strconv.Itoa(svc.GuestPort)),
+		"LimaHome":     limaHome,
+		"Path":         os.Getenv("PATH"),
+		"StderrPath":   stderrPath,
+	}
+	var templates []string
+	switch hostOS {
+	case "darwin":
+		templates = []string{launchdSocketTemplate}
+	case "linux":
+		templates = []string{systemdSocketTemplate, systemdSocketServiceTemplate}
+	default:
+		return nil, fmt.Errorf("host services are not supported on %q", hostOS)
+	}
+	var files [][]byte
+	for _, tmpl := range templates {
+		b, err := textutil.ExecuteTemplate(tmpl, args)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, b)
+	}
+	return files, nil
+}
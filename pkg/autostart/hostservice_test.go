@@ -0,0 +1,135 @@
+package autostart
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRenderHostService(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping testing on windows host")
+	}
+	t.Setenv("PATH", "/usr/bin:/bin")
+	svc := HostService{
+		Instance:  "default",
+		HostIP:    "127.0.0.1",
+		HostPort:  5432,
+		GuestIP:   "127.0.0.1",
+		GuestPort: 5432,
+	}
+	getExecutable := func() (string, error) {
+		return "/limactl", nil
+	}
+
+	files, err := renderHostService("linux", svc, "/home/user/.lima", "/home/user/.lima/default/host-service.stderr.log", getExecutable)
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 2)
+	assert.Equal(t, string(files[0]), `[Unit]
+Description=Lima - port 5432 of instance default
+Documentation=man:lima(1)
+
+[Socket]
+ListenStream=127.0.0.1:5432
+Accept=yes
+
+[Install]
+WantedBy=sockets.target`)
+	assert.Equal(t, string(files[1]), `[Unit]
+Description=Lima - connection to 127.0.0.1:5432 of instance default
+Documentation=man:lima(1)
+
+[Service]
+ExecStart=/limactl host-service connect default 127.0.0.1:5432
+Environment="LIMA_HOME=/home/user/.lima"
+Environment="PATH=/usr/bin:/bin"
+StandardInput=socket
+StandardOutput=socket
+StandardError=journal`)
+
+	files, err = renderHostService("darwin", svc, "/Users/user/.lima", "/Users/user/.lima/default/host-service.stderr.log", getExecutable)
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, string(files[0]), `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>io.lima-vm.port.default.5432</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>/limactl</string>
+		<string>host-service</string>
+		<string>connect</string>
+		<string>default</string>
+		<string>127.0.0.1:5432</string>
+	</array>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>LIMA_HOME</key>
+		<string>/Users/user/.lima</string>
+		<key>PATH</key>
+		<string>/usr/bin:/bin</string>
+	</dict>
+	<key>Sockets</key>
+	<dict>
+		<key>Listeners</key>
+		<dict>
+			<key>SockNodeName</key>
+			<string>127.0.0.1</string>
+			<key>SockServiceName</key>
+			<string>5432</string>
+			<key>SockType</key>
+			<string>stream</string>
+		</dict>
+	</dict>
+	<key>inetdCompatibility</key>
+	<dict>
+		<key>Wait</key>
+		<false/>
+	</dict>
+	<key>StandardErrorPath</key>
+	<string>/Users/user/.lima/default/host-service.stderr.log</string>
+	<key>ProcessType</key>
+	<string>Background</string>
+</dict>
+</plist>`)
+
+	_, err = renderHostService("windows", svc, "", "", getExecutable)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestHostServicePorts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping testing on windows host")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	ports, err := HostServicePorts("linux", "foo")
+	assert.NilError(t, err)
+	assert.Equal(t, len(ports), 0)
+
+	dir := unitDir("linux")
+	assert.NilError(t, os.MkdirAll(dir, 0o755))
+	for _, f := range []string{
+		"lima-vm-port.foo.8080.socket",
+		"lima-vm-port.foo.8080@.service",
+		"lima-vm-port.foo.443.socket",
+		"lima-vm-port.foo.bar.22.socket",
+		"lima-vm@foo.service",
+	} {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, f), nil, 0o644))
+	}
+	ports, err = HostServicePorts("linux", "foo")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ports, []int{443, 8080})
+	ports, err = HostServicePorts("linux", "foo.bar")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ports, []int{22})
+	assert.DeepEqual(t, HostServiceFiles("linux", "foo", 8080), []string{
+		filepath.Join(dir, "lima-vm-port.foo.8080.socket"),
+		filepath.Join(dir, "lima-vm-port.foo.8080@.service"),
+	})
+}
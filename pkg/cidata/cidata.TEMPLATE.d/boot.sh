@@ -30,6 +30,36 @@ done <"${LIMA_CIDATA_MNT}"/etc_environment
 PATH="${LIMA_CIDATA_MNT}"/util:"${PATH}"
 export PATH
 
+# Provisioning scripts with `rerunOnParamChange: true` have the ".on-param-change" suffix.
+# They are skipped when neither the script nor param.env has changed since their last successful run.
+PROVISION_STAMP_DIR=/var/lib/lima-provision
+
+provision_stamp() {
+	echo "${PROVISION_STAMP_DIR}/$(basename "$(dirname "$1")")-$(basename "$1")"
+}
+
+provision_digest() {
+	cat "${LIMA_CIDATA_MNT}"/param.env "$1" | sha256sum | cut -d' ' -f1
+}
+
+provision_needed() {
+	case "$1" in
+	*.on-param-change)
+		[ "$(cat "$(provision_stamp "$1")" 2>/dev/null)" != "$(provision_digest "$1")" ]
+		;;
+	*) return 0 ;;
+	esac
+}
+
+provision_done() {
+	case "$1" in
+	*.on-param-change)
+		mkdir -p "${PROVISION_STAMP_DIR}"
+		provision_digest "$1" >"$(provision_stamp "$1")"
+		;;
+	esac
+}
+
 CODE=0
 
 # Don't make any changes to /etc or /var/lib until boot/04-persistent-data-volume.sh
@@ -50,8 +80,14 @@ fi
 
 if [ -d "${LIMA_CIDATA_MNT}"/provision.system ]; then
 	for f in "${LIMA_CIDATA_MNT}"/provision.system/*; do
+		if ! provision_needed "$f"; then
+			INFO "Skipping $f (param unchanged)"
+			continue
+		fi
 		INFO "Executing $f"
-		if ! "$f"; then
+		if "$f"; then
+			provision_done "$f"
+		else
 			WARNING "Failed to execute $f"
 			CODE=1
 		fi
@@ -65,11 +101,17 @@ if [ -d "${LIMA_CIDATA_MNT}"/provision.user ]; then
 	fi
 	params=$(grep -o '^PARAM_[^=]*' "${LIMA_CIDATA_MNT}"/param.env | paste -sd ,)
 	for f in "${LIMA_CIDATA_MNT}"/provision.user/*; do
+		if ! provision_needed "$f"; then
+			INFO "Skipping $f (param unchanged)"
+			continue
+		fi
 		INFO "Executing $f (as user ${LIMA_CIDATA_USER})"
 		cp "$f" "${USER_SCRIPT}"
 		chown "${LIMA_CIDATA_USER}" "${USER_SCRIPT}"
 		chmod 755 "${USER_SCRIPT}"
-		if ! sudo -iu "${LIMA_CIDATA_USER}" "--preserve-env=${params}" "XDG_RUNTIME_DIR=/run/user/${LIMA_CIDATA_UID}" "${USER_SCRIPT}"; then
+		if sudo -iu "${LIMA_CIDATA_USER}" "--preserve-env=${params}" "XDG_RUNTIME_DIR=/run/user/${LIMA_CIDATA_UID}" "${USER_SCRIPT}"; then
+			provision_done "$f"
+		else
 			WARNING "Failed to execute $f (as user ${LIMA_CIDATA_USER})"
 			CODE=1
 		fi
@@ -77,9 +119,10 @@ if [ -d "${LIMA_CIDATA_MNT}"/provision.user ]; then
 	done
 fi
 
-# Signal that provisioning is done. The instance-id in the meta-data file changes on every boot,
-# so any copy from a previous boot cycle will have different content.
-cp "${LIMA_CIDATA_MNT}"/meta-data /run/lima-boot-done
+# Signal that provisioning is done. /run is cleared on every boot, so a copy from a previous boot cycle
+# is never found, even though the instance-id in the meta-data file only changes with the content of the cidata.
+# The copy is world-readable, so that the host agent can check it without sudo (see 05-sudo-policy.sh).
+install -m 644 "${LIMA_CIDATA_MNT}"/meta-data /run/lima-boot-done
 
 INFO "Exiting with code $CODE"
 exit "$CODE"
@@ -15,29 +15,37 @@ for i in $(seq 0 $((LIMA_CIDATA_DISKS - 1))); do
 	FORMAT_DISK="$(get_disk_var "$i" "FORMAT")"
 	FORMAT_FSTYPE="$(get_disk_var "$i" "FSTYPE")"
 	FORMAT_FSARGS="$(get_disk_var "$i" "FSARGS")"
+	DISK_LABEL="$(get_disk_var "$i" "LABEL")"
+	MOUNT_POINT="$(get_disk_var "$i" "MOUNTPOINT")"
+	MOUNT_OPTIONS="$(get_disk_var "$i" "MOUNTOPTIONS")"
 
 	test -n "$FORMAT_DISK" || FORMAT_DISK=true
 	test -n "$FORMAT_FSTYPE" || FORMAT_FSTYPE=ext4
+	test -n "$DISK_LABEL" || DISK_LABEL="lima-${DISK_NAME}"
+	test -n "$MOUNT_POINT" || MOUNT_POINT="/mnt/lima-${DISK_NAME}"
+	test -n "$MOUNT_OPTIONS" || MOUNT_OPTIONS=defaults
 
 	# first time setup
-	if [[ ! -b "/dev/disk/by-label/lima-${DISK_NAME}" ]]; then
+	if [[ ! -b "/dev/disk/by-label/${DISK_LABEL}" ]]; then
 		if $FORMAT_DISK; then
 			echo 'type=linux' | sfdisk --label gpt "/dev/${DEVICE_NAME}"
 			# shellcheck disable=SC2086
-			mkfs.$FORMAT_FSTYPE $FORMAT_FSARGS -L "lima-${DISK_NAME}" "/dev/${DEVICE_NAME}1"
+			mkfs.$FORMAT_FSTYPE $FORMAT_FSARGS -L "${DISK_LABEL}" "/dev/${DEVICE_NAME}1"
 		fi
 	fi
 
-	mkdir -p "/mnt/lima-${DISK_NAME}"
-	mount -t "$FORMAT_FSTYPE" "/dev/${DEVICE_NAME}1" "/mnt/lima-${DISK_NAME}"
+	mkdir -p "${MOUNT_POINT}"
+	mount -t "$FORMAT_FSTYPE" -o "$MOUNT_OPTIONS" "/dev/${DEVICE_NAME}1" "${MOUNT_POINT}"
 	if command -v growpart >/dev/null 2>&1 && command -v resize2fs >/dev/null 2>&1; then
 		growpart "/dev/${DEVICE_NAME}" 1 || true
 		# Only resize when filesystem is in a healthy state
-		if command -v "fsck.$FORMAT_FSTYPE" -f -p "/dev/disk/by-label/lima-${DISK_NAME}"; then
+		if command -v "fsck.$FORMAT_FSTYPE" -f -p "/dev/disk/by-label/${DISK_LABEL}"; then
 			if [[ $FORMAT_FSTYPE == "ext2" || $FORMAT_FSTYPE == "ext3" || $FORMAT_FSTYPE == "ext4" ]]; then
-				resize2fs "/dev/disk/by-label/lima-${DISK_NAME}" || true
+				resize2fs "/dev/disk/by-label/${DISK_LABEL}" || true
 			elif [ "$FORMAT_FSTYPE" == "xfs" ]; then
-				xfs_growfs "/dev/disk/by-label/lima-${DISK_NAME}" || true
+				xfs_growfs "/dev/disk/by-label/${DISK_LABEL}" || true
+			elif [ "$FORMAT_FSTYPE" == "btrfs" ]; then
+				btrfs filesystem resize max "${MOUNT_POINT}" || true
 			else
 				echo >&2 "WARNING: unknown fs '$FORMAT_FSTYPE'. FS will not be grew up automatically"
 			fi
@@ -0,0 +1,29 @@
+#!/bin/sh
+# Apply `security.sudo`. For "full", the sudoers rule is written by cloud-init (see user-data).
+# Runs after 04-persistent-data-volume.sh, as /etc/sudoers.d may be moved to the data volume on the first boot.
+set -eux
+
+SUDOERS=/etc/sudoers.d/99-lima-sudo-policy
+rm -f "${SUDOERS}" /run/lima-meta-data /run/lima-param.env
+[ "${LIMA_CIDATA_SUDO}" != "full" ] || exit 0
+
+# Remove the rules written while the policy was "full"
+for f in /etc/sudoers.d/90-cloud-init-users /etc/sudoers.d/99_lima_sudoers; do
+	if [ -f "$f" ]; then
+		sed -i "/^${LIMA_CIDATA_USER} /d" "$f"
+	fi
+done
+
+if [ "${LIMA_CIDATA_SUDO}" = "limited" ]; then
+	# The host agent removes this rule once the instance is ready
+	mkdir -p /etc/sudoers.d
+	echo "${LIMA_CIDATA_USER} ALL=(ALL) NOPASSWD:ALL" >"${SUDOERS}"
+	chmod 440 "${SUDOERS}"
+	exit 0
+fi
+
+# "none": publish the cidata files that the host agent reads as the user
+install -m 644 "${LIMA_CIDATA_MNT}"/meta-data /run/lima-meta-data
+install -m 640 -g "$(id -g "${LIMA_CIDATA_USER}")" "${LIMA_CIDATA_MNT}"/param.env /run/lima-param.env
+# ssh.forwardAgent
+install -d -m 700 -o "${LIMA_CIDATA_USER}" /run/host-services
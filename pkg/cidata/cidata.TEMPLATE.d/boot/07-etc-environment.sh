@@ -20,4 +20,4 @@ fi
 
 # Signal that provisioning is done. The instance-id in the meta-data file changes on every boot,
 # so any copy from a previous boot cycle will have different content.
-cp "${LIMA_CIDATA_MNT}"/meta-data /run/lima-ssh-ready
+install -m 644 "${LIMA_CIDATA_MNT}"/meta-data /run/lima-ssh-ready
@@ -0,0 +1,66 @@
+#!/bin/sh
+set -eux
+
+# Tag the shell prompt with the instance name, the template, and the vmType (`instanceTags`),
+# e.g., "[lima:default docker/qemu] user@lima-default:~$ ".
+# The tag is also exported as $LIMA_INSTANCE_TAG, for the prompts that are not managed by bash (e.g., starship).
+
+profile=/etc/profile.d/lima-instance-tags.sh
+starship=/etc/lima/starship.toml
+marker="# Lima instance tags"
+
+if [ "${LIMA_CIDATA_INSTANCE_TAGS}" != 1 ]; then
+	rm -f "${profile}" "${starship}"
+	for f in /etc/bash.bashrc /etc/bash/bashrc; do
+		if [ -f "${f}" ]; then
+			sed -i "/${marker}\$/d" "${f}"
+		fi
+	done
+	exit 0
+fi
+
+tag="lima:${LIMA_CIDATA_NAME}"
+if [ -n "${LIMA_CIDATA_TEMPLATE}" ]; then
+	tag="${tag} ${LIMA_CIDATA_TEMPLATE}/${LIMA_CIDATA_VMTYPE}"
+else
+	tag="${tag} ${LIMA_CIDATA_VMTYPE}"
+fi
+
+mkdir -p /etc/profile.d
+cat >"${profile}" <<EOF
+# Generated by Lima on every boot. Set \`instanceTags: false\` in lima.yaml to disable.
+export LIMA_INSTANCE_NAME="${LIMA_CIDATA_NAME}"
+export LIMA_INSTANCE_TEMPLATE="${LIMA_CIDATA_TEMPLATE}"
+export LIMA_INSTANCE_VMTYPE="${LIMA_CIDATA_VMTYPE}"
+export LIMA_INSTANCE_TAG="${tag}"
+if [ -n "\${BASH_VERSION:-}" ] && [ -n "\${PS1:-}" ]; then
+	__lima_instance_tag() {
+		case "\${PS1}" in
+		"[\${LIMA_INSTANCE_TAG}] "*) ;;
+		*) PS1="[\${LIMA_INSTANCE_TAG}] \${PS1}" ;;
+		esac
+	}
+	case ";\${PROMPT_COMMAND:-};" in
+	*";__lima_instance_tag;"*) ;;
+	*) PROMPT_COMMAND="__lima_instance_tag\${PROMPT_COMMAND:+;\${PROMPT_COMMAND}}" ;;
+	esac
+fi
+EOF
+chmod 644 "${profile}"
+
+# /etc/profile.d is not sourced by the non-login interactive shells
+for f in /etc/bash.bashrc /etc/bash/bashrc; do
+	if [ -f "${f}" ] && ! grep -q "${marker}\$" "${f}"; then
+		echo "[ -r ${profile} ] && . ${profile} ${marker}" >>"${f}"
+	fi
+done
+
+# The fragment to be appended to ~/.config/starship.toml, as starship overwrites PS1
+mkdir -p "$(dirname "${starship}")"
+cat >"${starship}" <<'EOF'
+# Lima instance tags for starship (https://starship.rs). Append this to ~/.config/starship.toml.
+[env_var.LIMA_INSTANCE_TAG]
+format = "[\\[$env_value\\]]($style) "
+style = "bold green"
+EOF
+chmod 644 "${starship}"
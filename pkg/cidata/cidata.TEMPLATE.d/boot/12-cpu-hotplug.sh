@@ -0,0 +1,15 @@
+#!/bin/sh
+# Bring the hot-plugged CPUs online (`limactl update --cpus`).
+# Some distros (e.g., Ubuntu) already ship a similar rule, but it is harmless to have both.
+set -eux
+
+if [ ! -d /etc/udev/rules.d ] || [ -e /etc/udev/rules.d/40-lima-cpu-hotplug.rules ]; then
+	exit 0
+fi
+
+cat >/etc/udev/rules.d/40-lima-cpu-hotplug.rules <<'EOR'
+SUBSYSTEM=="cpu", ACTION=="add", TEST=="online", ATTR{online}=="0", ATTR{online}="1"
+EOR
+if command -v udevadm >/dev/null 2>&1; then
+	udevadm control --reload-rules || true
+fi
@@ -0,0 +1,28 @@
+#!/bin/sh
+# Configure the guest kernel for `crashCapture`, so that the host agent can capture
+# the kernel panics from the serial console logs.
+set -eux
+
+if [ "${LIMA_CIDATA_CRASH_CAPTURE}" != 1 ]; then
+	exit 0
+fi
+
+# Replay the kernel ring buffer to the consoles on a panic (bit 5 of panic_print; Linux 5.10+),
+# so that the messages preceding the panic are preserved in the serial console logs too.
+if [ -d /etc/sysctl.d ] && [ ! -e /etc/sysctl.d/99-lima-crash-capture.conf ]; then
+	echo "kernel.panic_print = 32" >/etc/sysctl.d/99-lima-crash-capture.conf
+	sysctl -p /etc/sysctl.d/99-lima-crash-capture.conf || true
+fi
+
+# Print the kernel messages to the virtio console (hvc0) too, which is the only serial console of the vz driver.
+# The kernel command line is updated for the next boot.
+if grep -qw console=hvc0 /proc/cmdline || [ -e /etc/default/grub.d/99-lima-crash-capture.cfg ]; then
+	exit 0
+fi
+if [ -d /etc/default/grub.d ] && command -v update-grub >/dev/null 2>&1; then
+	# Prepended, so that the last `console=` of the image remains /dev/console
+	cat >/etc/default/grub.d/99-lima-crash-capture.cfg <<'EOF'
+GRUB_CMDLINE_LINUX="console=hvc0 ${GRUB_CMDLINE_LINUX}"
+EOF
+	update-grub || true
+fi
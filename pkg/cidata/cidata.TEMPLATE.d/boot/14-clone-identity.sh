@@ -0,0 +1,30 @@
+#!/bin/sh
+# Regenerate the machine ID and the SSH host keys of an instance cloned with `limactl clone`,
+# so that they do not collide with the ones of the original instance.
+# The name of the instance is recorded on the first boot; a different name means that the disk has been cloned.
+set -eux
+
+marker=/var/lib/lima-instance-name
+if [ -e "${marker}" ] && [ "$(cat "${marker}")" != "${LIMA_CIDATA_NAME}" ]; then
+	if [ -e /etc/machine-id ]; then
+		rm -f /etc/machine-id
+		# /var/lib/dbus/machine-id is often a symlink to /etc/machine-id
+		[ -L /var/lib/dbus/machine-id ] || rm -f /var/lib/dbus/machine-id
+		if command -v systemd-machine-id-setup >/dev/null 2>&1; then
+			systemd-machine-id-setup
+		elif command -v dbus-uuidgen >/dev/null 2>&1; then
+			dbus-uuidgen --ensure=/etc/machine-id
+		fi
+	fi
+	if command -v ssh-keygen >/dev/null 2>&1; then
+		rm -f /etc/ssh/ssh_host_*_key /etc/ssh/ssh_host_*_key.pub
+		ssh-keygen -A
+		# The existing connections are kept on restarting sshd
+		if command -v systemctl >/dev/null 2>&1; then
+			systemctl try-restart ssh.service sshd.service || true
+		elif command -v rc-service >/dev/null 2>&1; then
+			rc-service --ifstarted sshd restart || true
+		fi
+	fi
+fi
+echo "${LIMA_CIDATA_NAME}" >"${marker}"
@@ -0,0 +1,12 @@
+#!/bin/sh
+# Load `kernel.modules` and set `sysctl` on every boot, with the guest agent installed by 25-guestagent-base.sh.
+# The values are not written to /etc/sysctl.d, so the keys removed from lima.yaml are reset by the next reboot.
+set -eux
+
+if [ ! -f "${LIMA_CIDATA_MNT}"/kernel-config.json ]; then
+	exit 0
+fi
+
+if ! "${LIMA_CIDATA_GUEST_INSTALL_PREFIX}"/bin/lima-guestagent apply-kernel-config "${LIMA_CIDATA_MNT}"/kernel-config.json; then
+	echo >&2 "Failed to apply the kernel config (kernel.modules, sysctl) of the instance"
+fi
@@ -41,12 +41,23 @@ if head -c 4 "$(command -v apt-get)" | grep -qP '\x7fELF' >/dev/null 2>&1; then
 			pkgs="${pkgs} sshfs"
 		fi
 	fi
+	if [ "${LIMA_CIDATA_MOUNTTYPE}" = "nfs" ]; then
+		if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ] && ! command -v mount.nfs >/dev/null 2>&1; then
+			pkgs="${pkgs} nfs-common"
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ] && [ ! -e /usr/sbin/iptables ]; then
 		pkgs="${pkgs} iptables"
 	fi
 	if [ "${LIMA_CIDATA_CONTAINERD_USER}" = 1 ] && ! command -v newuidmap >/dev/null 2>&1; then
 		pkgs="${pkgs} uidmap fuse3 dbus-user-session"
 	fi
+	if [ "${LIMA_CIDATA_PODMAN_USER}" = 1 ] && ! command -v podman >/dev/null 2>&1; then
+		pkgs="${pkgs} podman uidmap dbus-user-session"
+	fi
+	if [ "${LIMA_CIDATA_WIREGUARD}" -gt 0 ] && ! command -v wg >/dev/null 2>&1; then
+		pkgs="${pkgs} wireguard-tools"
+	fi
 	if [ -n "${pkgs}" ]; then
 		DEBIAN_FRONTEND=noninteractive
 		export DEBIAN_FRONTEND
@@ -64,6 +75,11 @@ elif command -v dnf >/dev/null 2>&1; then
 			pkgs="${pkgs} fuse-sshfs"
 		fi
 	fi
+	if [ "${LIMA_CIDATA_MOUNTTYPE}" = "nfs" ]; then
+		if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ] && ! command -v mount.nfs >/dev/null 2>&1; then
+			pkgs="${pkgs} nfs-utils"
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ] && [ ! -e /usr/sbin/iptables ]; then
 		pkgs="${pkgs} iptables"
 	fi
@@ -75,6 +91,12 @@ elif command -v dnf >/dev/null 2>&1; then
 			pkgs="${pkgs} fuse3"
 		fi
 	fi
+	if [ "${LIMA_CIDATA_PODMAN_USER}" = 1 ] && ! command -v podman >/dev/null 2>&1; then
+		pkgs="${pkgs} podman"
+	fi
+	if [ "${LIMA_CIDATA_WIREGUARD}" -gt 0 ] && ! command -v wg >/dev/null 2>&1; then
+		pkgs="${pkgs} wireguard-tools"
+	fi
 	if [ -n "${pkgs}" ]; then
 		dnf_install_flags="-y --setopt=install_weak_deps=False"
 		if grep -q "Oracle Linux Server release 8" /etc/system-release; then
@@ -113,6 +135,11 @@ elif command -v yum >/dev/null 2>&1; then
 	if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ] && ! command -v sshfs >/dev/null 2>&1; then
 		pkgs="${pkgs} fuse-sshfs"
 	fi
+	if [ "${LIMA_CIDATA_MOUNTTYPE}" = "nfs" ]; then
+		if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ] && ! command -v mount.nfs >/dev/null 2>&1; then
+			pkgs="${pkgs} nfs-utils"
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ] && [ ! -e /usr/sbin/iptables ]; then
 		pkgs="${pkgs} iptables"
 	fi
@@ -124,6 +151,9 @@ elif command -v yum >/dev/null 2>&1; then
 			pkgs="${pkgs} fuse3"
 		fi
 	fi
+	if [ "${LIMA_CIDATA_PODMAN_USER}" = 1 ] && ! command -v podman >/dev/null 2>&1; then
+		pkgs="${pkgs} podman"
+	fi
 	if [ -n "${pkgs}" ]; then
 		# shellcheck disable=SC2086
 		yum install ${yum_install_flags} ${pkgs}
@@ -136,6 +166,17 @@ elif command -v pacman >/dev/null 2>&1; then
 			pkgs="${pkgs} sshfs"
 		fi
 	fi
+	if [ "${LIMA_CIDATA_MOUNTTYPE}" = "nfs" ]; then
+		if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ] && ! command -v mount.nfs >/dev/null 2>&1; then
+			pkgs="${pkgs} nfs-utils"
+		fi
+	fi
+	if [ "${LIMA_CIDATA_PODMAN_USER}" = 1 ] && ! command -v podman >/dev/null 2>&1; then
+		pkgs="${pkgs} podman"
+	fi
+	if [ "${LIMA_CIDATA_WIREGUARD}" -gt 0 ] && ! command -v wg >/dev/null 2>&1; then
+		pkgs="${pkgs} wireguard-tools"
+	fi
 	# other dependencies are preinstalled on Arch Linux
 	if [ -n "${pkgs}" ]; then
 		# shellcheck disable=SC2086
@@ -148,12 +189,23 @@ elif command -v zypper >/dev/null 2>&1; then
 			pkgs="${pkgs} sshfs"
 		fi
 	fi
+	if [ "${LIMA_CIDATA_MOUNTTYPE}" = "nfs" ]; then
+		if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ] && ! command -v mount.nfs >/dev/null 2>&1; then
+			pkgs="${pkgs} nfs-client"
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ] && [ ! -e /usr/sbin/iptables ]; then
 		pkgs="${pkgs} iptables"
 	fi
 	if [ "${LIMA_CIDATA_CONTAINERD_USER}" = 1 ] && ! command -v mount.fuse3 >/dev/null 2>&1; then
 		pkgs="${pkgs} fuse3"
 	fi
+	if [ "${LIMA_CIDATA_PODMAN_USER}" = 1 ] && ! command -v podman >/dev/null 2>&1; then
+		pkgs="${pkgs} podman"
+	fi
+	if [ "${LIMA_CIDATA_WIREGUARD}" -gt 0 ] && ! command -v wg >/dev/null 2>&1; then
+		pkgs="${pkgs} wireguard-tools"
+	fi
 	if [ -n "${pkgs}" ]; then
 		# shellcheck disable=SC2086
 		zypper --non-interactive install -y --no-recommends ${pkgs}
@@ -165,9 +217,20 @@ elif command -v apk >/dev/null 2>&1; then
 			pkgs="${pkgs} sshfs"
 		fi
 	fi
+	if [ "${LIMA_CIDATA_MOUNTTYPE}" = "nfs" ]; then
+		if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ] && ! command -v mount.nfs >/dev/null 2>&1; then
+			pkgs="${pkgs} nfs-utils"
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ] && ! command -v iptables >/dev/null 2>&1; then
 		pkgs="${pkgs} iptables"
 	fi
+	if [ "${LIMA_CIDATA_PODMAN_USER}" = 1 ] && ! command -v podman >/dev/null 2>&1; then
+		pkgs="${pkgs} podman"
+	fi
+	if [ "${LIMA_CIDATA_WIREGUARD}" -gt 0 ] && ! command -v wg >/dev/null 2>&1; then
+		pkgs="${pkgs} wireguard-tools"
+	fi
 	if [ -n "${pkgs}" ]; then
 		apk update
 		# shellcheck disable=SC2086
@@ -0,0 +1,31 @@
+#!/bin/sh
+# Set up the interfaces of the "wireguard" networks of networks.yaml.
+# The configs are generated by the host, with the other members of the mesh as the peers.
+set -eux
+
+test "${LIMA_CIDATA_WIREGUARD:-0}" -gt 0 || exit 0
+
+if ! command -v wg >/dev/null 2>&1; then
+	echo >&2 "wg (wireguard-tools) is not installed; skipping the WireGuard networks"
+	exit 0
+fi
+modprobe wireguard || true
+
+get_wireguard_var() {
+	varname="LIMA_CIDATA_WIREGUARD_${1}_${2}"
+	eval echo \$"$varname"
+}
+
+mkdir -p /etc/wireguard
+chmod 700 /etc/wireguard
+for i in $(seq 0 $((LIMA_CIDATA_WIREGUARD - 1))); do
+	iface="$(get_wireguard_var "$i" "INTERFACE")"
+	address="$(get_wireguard_var "$i" "ADDRESS")"
+	install -m 600 "${LIMA_CIDATA_MNT}/wireguard/${iface}.conf" "/etc/wireguard/${iface}.conf"
+	# Recreate the interface, as the peers may have changed since the last boot
+	ip link delete "${iface}" 2>/dev/null || true
+	ip link add "${iface}" type wireguard
+	wg setconf "${iface}" "/etc/wireguard/${iface}.conf"
+	ip address add "${address}" dev "${iface}"
+	ip link set "${iface}" up
+done
@@ -46,6 +46,14 @@ if [ "${LIMA_CIDATA_CONTAINERD_SYSTEM}" = 1 ]; then
       type = "snapshot"
       address = "/run/containerd-stargz-grpc/containerd-stargz-grpc.sock"
 EOF
+	if command -v selinuxenabled >/dev/null 2>&1 && selinuxenabled; then
+		# Label the CRI containers, so that container-selinux allows them to access the snapshots,
+		# and the mounts labeled with nfs_t (see 05-lima-mounts.sh)
+		cat >>"/etc/containerd/config.toml" <<EOF
+  [plugins."io.containerd.grpc.v1.cri"]
+    enable_selinux = true
+EOF
+	fi
 	cat >"/etc/buildkit/buildkitd.toml" <<EOF
 [worker.oci]
   enabled = false
@@ -0,0 +1,19 @@
+#!/bin/sh
+set -eux
+
+if [ "${LIMA_CIDATA_PODMAN_USER}" != 1 ]; then
+	exit 0
+fi
+
+# This script does not work unless systemd is available
+command -v systemctl >/dev/null 2>&1 || exit 0
+
+# podman is installed in 30-install-packages.sh
+if ! command -v podman >/dev/null 2>&1; then
+	echo >&2 "podman is not installed"
+	exit 0
+fi
+
+# The socket is forwarded to the host by the host agent
+until [ -e "/run/user/${LIMA_CIDATA_UID}/systemd/private" ]; do sleep 3; done
+sudo -iu "${LIMA_CIDATA_USER}" "XDG_RUNTIME_DIR=/run/user/${LIMA_CIDATA_UID}" systemctl --user enable --now podman.socket
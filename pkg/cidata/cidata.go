@@ -1,11 +1,14 @@
 package cidata
 
 import (
+	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
 	"net/url"
 	"os"
 	"path"
@@ -16,15 +19,20 @@ import (
 
 	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/debugutil"
+	"github.com/lima-vm/lima/pkg/guestagent/kernelconfig"
 	"github.com/lima-vm/lima/pkg/identifierutil"
 	"github.com/lima-vm/lima/pkg/iso9660util"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/networks/usernet"
+	"github.com/lima-vm/lima/pkg/nfsserver"
 	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
 	"github.com/lima-vm/lima/pkg/usrlocalsharelima"
 	"github.com/sirupsen/logrus"
 )
@@ -112,6 +120,62 @@ func setupEnv(instConfigEnv map[string]string, propagateProxyEnv bool, slirpGate
 	return env, nil
 }
 
+// setupSlirpIPv6 configures the guest for the IPv6 subnet of the gvisor-tap-vsock network, if any.
+// The DNS server on the DNS IP of both subnets answers AAAA queries too, unlike the one on the gateway IP.
+// setupStaticIP configures the static address of a "host" or "shared" network.
+// Only "shared" networks have the default route via the gateway, as "host" networks cannot reach the outside.
+func setupStaticIP(network *Network, nw limayaml.Network) error {
+	ip, err := netip.ParseAddr(nw.StaticIP)
+	if err != nil {
+		return err
+	}
+	nwCfg, err := networks.LoadConfig()
+	if err != nil {
+		return err
+	}
+	prefix, _, err := nwCfg.StaticIPPrefix(nw.Lima, ip)
+	if err != nil {
+		return err
+	}
+	network.Address = prefix.String()
+	if cfg := nwCfg.Networks[nw.Lima]; cfg.Mode == networks.ModeShared {
+		network.Gateway = cfg.Gateway.String()
+	}
+	return nil
+}
+
+func setupSlirpIPv6(args *TemplateArgs, subnet net.IP, subnet6 string) {
+	if subnet6 == "" {
+		return
+	}
+	ip6, _, err := net.ParseCIDR(subnet6)
+	if err != nil {
+		logrus.WithError(err).Warnf("Ignoring invalid IPv6 subnet %q", subnet6)
+		return
+	}
+	args.SlirpDNS = usernet.DNSIP(subnet)
+	args.SlirpIPv6DNS = usernet.DNSIP(ip6)
+}
+
+// templateName returns the short name of a template locator for the instance tags (`instanceTags`),
+// e.g., "docker" for "template://docker" and "/path/to/docker.yaml".
+// The characters other than alphanumerics, '.', '-', and '_' are replaced with '_'.
+func templateName(locator string) string {
+	if locator == "" {
+		return ""
+	}
+	name := path.Base(filepath.ToSlash(locator))
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".yaml"), ".yml")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
 func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.LimaYAML, udpDNSLocalPort, tcpDNSLocalPort, vsockPort int, virtioPort string) (*TemplateArgs, error) {
 	if err := limayaml.Validate(instConfig, false); err != nil {
 		return nil, err
@@ -125,9 +189,11 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		Comment:            *instConfig.User.Comment,
 		Home:               *instConfig.User.Home,
 		UID:                *instConfig.User.UID,
+		Shell:              *instConfig.User.Shell,
 		GuestInstallPrefix: *instConfig.GuestInstallPrefix,
 		UpgradePackages:    *instConfig.UpgradePackages,
 		Containerd:         Containerd{System: *instConfig.Containerd.System, User: *instConfig.Containerd.User},
+		Podman:             Podman{User: *instConfig.Podman.User},
 		SlirpNICName:       networks.SlirpNICName,
 
 		RosettaEnabled: *instConfig.Rosetta.Enabled,
@@ -136,8 +202,18 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		VSockPort:      vsockPort,
 		VirtioPort:     virtioPort,
 		Plain:          *instConfig.Plain,
+		CrashCapture:   *instConfig.CrashCapture.Enabled,
+		InstanceTags:   *instConfig.InstanceTags,
+		Template:       templateName(history.Template(instDir)),
 		TimeZone:       *instConfig.TimeZone,
+		SearchDomains:  instConfig.DHCP.SearchDomains,
+		NTPServers:     instConfig.DHCP.NTPServers,
+		MTU:            *instConfig.DHCP.MTU,
 		Param:          instConfig.Param,
+		Sudo:           *instConfig.Security.Sudo,
+	}
+	if instConfig.CloudInit.ExtraUserData != nil {
+		args.ExtraUserData = *instConfig.CloudInit.ExtraUserData
 	}
 
 	firstUsernetIndex := limayaml.FirstUsernetIndex(instConfig)
@@ -152,6 +228,11 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		}
 		args.SlirpGateway = usernet.GatewayIP(subnet)
 		args.SlirpDNS = usernet.GatewayIP(subnet)
+		subnet6, err := usernet.IPv6Subnet(usernetName)
+		if err != nil {
+			return nil, err
+		}
+		setupSlirpIPv6(&args, subnet, subnet6)
 	} else {
 		subnet, _, err = net.ParseCIDR(networks.SlirpNetwork)
 		if err != nil {
@@ -164,9 +245,15 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 			args.SlirpDNS = usernet.DNSIP(subnet)
 		}
 		args.SlirpIPAddress = networks.SlirpIPAddress
+		// The gvisor-tap-vsock network in the host agent
+		if *instConfig.VMType == limayaml.VZ || instConfig.EgressPolicy != nil || *instConfig.MetadataService.Enabled {
+			setupSlirpIPv6(&args, subnet, networks.SlirpIPv6Network)
+		}
 	}
 
-	// change instance id on every boot so network config will be processed again
+	// change instance id on every boot so network config will be processed again.
+	// GenerateISO9660 replaces it with an id derived from the content of the cidata,
+	// so that cloud-init only reprocesses the config when it has changed.
 	args.IID = fmt.Sprintf("iid-%d", time.Now().Unix())
 
 	pubKeys, err := sshutil.DefaultPubKeys(*instConfig.SSH.LoadDotSSHPubKeys)
@@ -179,6 +266,21 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 	for _, f := range pubKeys {
 		args.SSHPubKeys = append(args.SSHPubKeys, f.Content)
 	}
+	for _, u := range instConfig.Users {
+		au := AdditionalUser{
+			Name:    u.Name,
+			Comment: *u.Comment,
+			Home:    *u.Home,
+			Shell:   *u.Shell,
+			Sudo:    *u.Sudo == limayaml.SudoFull,
+			// the keys of Lima are needed for `limactl shell --user`
+			SSHPubKeys: append(slices.Clone(args.SSHPubKeys), u.SSHPubKeys...),
+		}
+		if u.UID != nil {
+			au.UID = *u.UID
+		}
+		args.AdditionalUsers = append(args.AdditionalUsers, au)
+	}
 
 	var fstype string
 	switch *instConfig.MountType {
@@ -188,13 +290,15 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		fstype = "9p"
 	case limayaml.VIRTIOFS:
 		fstype = "virtiofs"
+	case limayaml.NFS:
+		fstype = "nfs"
 	}
 	hostHome, err := localpathutil.Expand("~")
 	if err != nil {
 		return nil, err
 	}
 	for i, f := range instConfig.Mounts {
-		tag := fmt.Sprintf("mount%d", i)
+		tag := limayaml.MountTag(instConfig, i)
 		location, err := localpathutil.Expand(f.Location)
 		if err != nil {
 			return nil, err
@@ -222,6 +326,16 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 			}
 			// don't fail the boot, if virtfs is not available
 			options += ",nofail"
+		case "nfs":
+			// Served by the host agent via the SSH reverse forward, so mounted by the host agent rather than on boot
+			tag = "127.0.0.1:/"
+			port := nfsserver.GuestPort(i)
+			options = fmt.Sprintf("vers=3,proto=tcp,port=%d,mountport=%d,mountproto=tcp,nolock,noauto,nofail,_netdev", port, port)
+			if *f.Writable {
+				options += ",rw"
+			} else {
+				options += ",ro"
+			}
 		}
 		args.Mounts = append(args.Mounts, Mount{Tag: tag, MountPoint: mountPoint, Type: fstype, Options: options})
 		if location == hostHome {
@@ -236,6 +350,13 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		args.MountType = "9p"
 	case limayaml.VIRTIOFS:
 		args.MountType = "virtiofs"
+	case limayaml.NFS:
+		args.MountType = "nfs"
+	default:
+		if limayaml.IsExternalMountType(*instConfig.MountType) {
+			// Mounted by the host agent, using the scripts returned by the external mount driver
+			args.MountType = *instConfig.MountType
+		}
 	}
 
 	for i, d := range instConfig.AdditionalDisks {
@@ -247,12 +368,40 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		if d.FSType != nil {
 			fstype = *d.FSType
 		}
+		fsargs := d.FSArgs
+		label := "lima-" + d.Name
+		// The filesystem created by `limactl disk create --fs` takes precedence
+		diskDir, err := store.DiskDir(d.Name)
+		if err != nil {
+			return nil, err
+		}
+		fsys, err := store.LoadDiskFilesystem(diskDir)
+		if err != nil {
+			return nil, err
+		}
+		if fsys != nil {
+			if fstype != "" && fstype != fsys.Type {
+				return nil, fmt.Errorf("field `additionalDisks[%d].fsType` is %q, but disk %q was created with filesystem %q", i, fstype, d.Name, fsys.Type)
+			}
+			fstype = fsys.Type
+			label = fsys.Label
+			if len(fsargs) == 0 {
+				fsargs = fsys.MkfsArgs
+			}
+		}
+		mountPoint := "/mnt/lima-" + d.Name
+		if d.MountPoint != nil {
+			mountPoint = *d.MountPoint
+		}
 		args.Disks = append(args.Disks, Disk{
-			Name:   d.Name,
-			Device: diskDeviceNameFromOrder(i),
-			Format: format,
-			FSType: fstype,
-			FSArgs: d.FSArgs,
+			Name:         d.Name,
+			Device:       diskDeviceNameFromOrder(i),
+			Format:       format,
+			FSType:       fstype,
+			FSArgs:       fsargs,
+			Label:        label,
+			MountPoint:   mountPoint,
+			MountOptions: d.MountOptions,
 		})
 	}
 
@@ -261,7 +410,31 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		if i == firstUsernetIndex {
 			continue
 		}
-		args.Networks = append(args.Networks, Network{MACAddress: nw.MACAddress, Interface: nw.Interface, Metric: *nw.Metric})
+		if nw.Lima != "" && networks.IsWireGuard(nw.Lima) {
+			wg, err := setupWireGuard(instDir, name, nw, args.SlirpGateway)
+			if err != nil {
+				return nil, err
+			}
+			args.WireGuard = append(args.WireGuard, *wg)
+			continue
+		}
+		network := Network{MACAddress: nw.MACAddress, Interface: nw.Interface, Metric: *nw.Metric}
+		if nw.Lima != "" && networks.IsSwitch(nw.Lima) {
+			// The gateway of the switch only serves DHCP and the names of the instances
+			subnet, err := usernet.Subnet(nw.Lima)
+			if err != nil {
+				return nil, err
+			}
+			network.Internal = true
+			network.DNS = usernet.GatewayIP(subnet)
+			network.DNSDomain = networks.SwitchDomain(nw.Lima)
+		}
+		if nw.StaticIP != "" {
+			if err := setupStaticIP(&network, nw); err != nil {
+				return nil, err
+			}
+		}
+		args.Networks = append(args.Networks, network)
 	}
 
 	args.Env, err = setupEnv(instConfig.Env, *instConfig.PropagateProxyEnv, args.SlirpGateway)
@@ -276,10 +449,16 @@ func templateArgs(bootScripts bool, instDir, name string, instConfig *limayaml.L
 		}
 	case firstUsernetIndex != -1 || *instConfig.VMType == limayaml.VZ:
 		args.DNSAddresses = append(args.DNSAddresses, args.SlirpDNS)
+		if args.SlirpIPv6DNS != "" {
+			args.DNSAddresses = append(args.DNSAddresses, args.SlirpIPv6DNS)
+		}
 	case *instConfig.HostResolver.Enabled:
 		args.UDPDNSLocalPort = udpDNSLocalPort
 		args.TCPDNSLocalPort = tcpDNSLocalPort
 		args.DNSAddresses = append(args.DNSAddresses, args.SlirpDNS)
+		if args.SlirpIPv6DNS != "" {
+			args.DNSAddresses = append(args.DNSAddresses, args.SlirpIPv6DNS)
+		}
 	default:
 		args.DNSAddresses, err = osutil.DNSAddresses()
 		if err != nil {
@@ -367,8 +546,13 @@ func GenerateISO9660(instDir, name string, instConfig *limayaml.LimaYAML, udpDNS
 	for i, f := range instConfig.Provision {
 		switch f.Mode {
 		case limayaml.ProvisionModeSystem, limayaml.ProvisionModeUser, limayaml.ProvisionModeDependency:
+			path := fmt.Sprintf("provision.%s/%08d", f.Mode, i)
+			if f.RerunOnParamChange != nil && *f.RerunOnParamChange {
+				// boot.sh skips the script unless the script or param.env has changed since the last successful run
+				path += ".on-param-change"
+			}
 			layout = append(layout, iso9660util.Entry{
-				Path:   fmt.Sprintf("provision.%s/%08d", f.Mode, i),
+				Path:   path,
 				Reader: strings.NewReader(f.Script),
 			})
 		case limayaml.ProvisionModeBoot:
@@ -380,6 +564,24 @@ func GenerateISO9660(instDir, name string, instConfig *limayaml.LimaYAML, udpDNS
 		}
 	}
 
+	for _, wg := range args.WireGuard {
+		layout = append(layout, iso9660util.Entry{
+			Path:   "wireguard/" + wg.Interface + ".conf",
+			Reader: strings.NewReader(wg.Config),
+		})
+	}
+
+	if len(instConfig.Kernel.Modules) > 0 || len(instConfig.Sysctl) > 0 {
+		b, err := json.Marshal(kernelconfig.Config{Modules: instConfig.Kernel.Modules, Sysctl: instConfig.Sysctl})
+		if err != nil {
+			return err
+		}
+		layout = append(layout, iso9660util.Entry{
+			Path:   "kernel-config.json",
+			Reader: bytes.NewReader(b),
+		})
+	}
+
 	guestAgentBinary, err := usrlocalsharelima.GuestAgentBinary(*instConfig.OS, *instConfig.Arch)
 	if err != nil {
 		return err
@@ -426,8 +628,44 @@ func GenerateISO9660(instDir, name string, instConfig *limayaml.LimaYAML, udpDNS
 		})
 		return writeCIDataDir(filepath.Join(instDir, filenames.CIDataISODir), layout)
 	}
+	return writeCIDataISO(instDir, layout, args)
+}
 
-	return iso9660util.Write(filepath.Join(instDir, filenames.CIDataISO), "cidata", layout)
+// writeCIDataISO writes the layout to cidata.iso, unless the existing image has the same content.
+// The instance id in meta-data is replaced with the one derived from the content, so it only changes
+// when the rest of the content has changed, not on every boot.
+func writeCIDataISO(instDir string, layout []iso9660util.Entry, args *TemplateArgs) error {
+	isoPath := filepath.Join(instDir, filenames.CIDataISO)
+	manifestPath := filepath.Join(instDir, filenames.CIDataManifest)
+	newManifest, layout, err := newManifest(layout)
+	if err != nil {
+		return err
+	}
+	args.IID = newManifest.instanceID()
+	if err := replaceMetaData(layout, newManifest, args); err != nil {
+		return err
+	}
+	oldManifest, err := loadManifest(manifestPath)
+	if err != nil {
+		logrus.WithError(err).Warn("Ignoring the manifest of the old cidata.iso")
+		oldManifest = nil
+	}
+	if upToDate(isoPath, oldManifest, newManifest) {
+		logrus.Debugf("%q is up to date", isoPath)
+		return nil
+	}
+	if oldManifest != nil {
+		logChanges(isoPath, oldManifest, newManifest, layout)
+	}
+	// Remove the manifest first, so that a partially written image is never considered to be up to date
+	if err := os.RemoveAll(manifestPath); err != nil {
+		return err
+	}
+	progress.Step("Generating %s", filenames.CIDataISO)
+	if err := iso9660util.Write(isoPath, "cidata", layout); err != nil {
+		return err
+	}
+	return saveManifest(manifestPath, newManifest)
 }
 
 func getCert(content string) Cert {
@@ -57,3 +57,11 @@ func TestSetupInvalidEnv(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, envs[envKey], envValue)
 }
+
+func TestTemplateName(t *testing.T) {
+	assert.Equal(t, templateName(""), "")
+	assert.Equal(t, templateName("template://docker"), "docker")
+	assert.Equal(t, templateName("template://experimental/vz"), "vz")
+	assert.Equal(t, templateName("/path/to/my template.yaml"), "my_template")
+	assert.Equal(t, templateName("https://example.com/k8s.yml"), "k8s")
+}
@@ -0,0 +1,54 @@
+package cidata
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// bootEnvNames are the variables set by boot.sh (via user-data), in addition to lima.env.
+var bootEnvNames = []string{"LIMA_CIDATA_MNT", "LIMA_CIDATA_DEV"}
+
+var envNames struct {
+	sync.Once
+	re  *regexp.Regexp
+	err error
+}
+
+// IsEnvName returns true if name, e.g., "LIMA_CIDATA_MOUNTS_0_MOUNTPOINT", is a variable set for the scripts in the guest
+// by this version of Lima. Provisioning scripts written for older versions may refer to variables that are no longer set.
+func IsEnvName(name string) (bool, error) {
+	envNames.Do(func() {
+		var b []byte
+		b, envNames.err = templateFS.ReadFile(path.Join(templateFSRoot, "lima.env"))
+		if envNames.err != nil {
+			return
+		}
+		alts := quoteMetaAll(bootEnvNames)
+		for _, line := range strings.Split(string(b), "\n") {
+			k, _, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if !ok || !strings.HasPrefix(k, "LIMA_CIDATA_") {
+				continue
+			}
+			// The variables of the lists are indexed, e.g., "LIMA_CIDATA_DISK_{{$i}}_NAME"
+			alts = append(alts, templateActionRegexp.ReplaceAllString(regexp.QuoteMeta(k), "[0-9]+"))
+		}
+		envNames.re, envNames.err = regexp.Compile("^(?:" + strings.Join(alts, "|") + ")$")
+	})
+	if envNames.err != nil {
+		return false, envNames.err
+	}
+	return envNames.re.MatchString(name), nil
+}
+
+// templateActionRegexp matches a template action quoted by regexp.QuoteMeta, e.g., `\{\{\$i\}\}`.
+var templateActionRegexp = regexp.MustCompile(`\\\{\\\{.*?\\\}\\\}`)
+
+func quoteMetaAll(ss []string) []string {
+	res := make([]string, len(ss))
+	for i, s := range ss {
+		res[i] = regexp.QuoteMeta(s)
+	}
+	return res
+}
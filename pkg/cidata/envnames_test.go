@@ -0,0 +1,24 @@
+package cidata
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestIsEnvName(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"LIMA_CIDATA_MNT":                  true,
+		"LIMA_CIDATA_USER":                 true,
+		"LIMA_CIDATA_MOUNTS":               true,
+		"LIMA_CIDATA_MOUNTS_12_MOUNTPOINT": true,
+		"LIMA_CIDATA_DISK_0_FSTYPE":        true,
+		"LIMA_CIDATA_DISK_X_FSTYPE":        false,
+		"LIMA_CIDATA_SLIRP_NETWORK":        false,
+		"LIMA_CIDATA_USE":                  false,
+	} {
+		ok, err := IsEnvName(name)
+		assert.NilError(t, err)
+		assert.Equal(t, ok, expected, name)
+	}
+}
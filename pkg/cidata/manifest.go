@@ -0,0 +1,225 @@
+package cidata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lima-vm/lima/pkg/iso9660util"
+	"github.com/sirupsen/logrus"
+)
+
+// manifest maps the paths in cidata.iso to the SHA-256 digests of their contents.
+// It is used for skipping the regeneration of cidata.iso when nothing has changed,
+// and for reporting what has changed otherwise.
+type manifest map[string]string
+
+// newManifest computes the manifest of the layout.
+// The readers that cannot be rewound are replaced with in-memory copies,
+// so the returned layout has to be used instead of the original one.
+func newManifest(layout []iso9660util.Entry) (manifest, []iso9660util.Entry, error) {
+	m := make(manifest, len(layout))
+	res := make([]iso9660util.Entry, len(layout))
+	for i, e := range layout {
+		h := sha256.New()
+		if rs, ok := e.Reader.(io.ReadSeeker); ok {
+			if _, err := io.Copy(h, rs); err != nil {
+				return nil, nil, err
+			}
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			b, err := io.ReadAll(e.Reader)
+			if err != nil {
+				return nil, nil, err
+			}
+			h.Write(b)
+			e.Reader = bytes.NewReader(b)
+		}
+		m[e.Path] = "sha256:" + hex.EncodeToString(h.Sum(nil))
+		res[i] = e
+	}
+	return m, res, nil
+}
+
+// instanceID returns the cloud-init instance id derived from the digests of all the files except meta-data,
+// which contains the instance id itself.
+func (m manifest) instanceID() string {
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	h := sha256.New()
+	for _, p := range paths {
+		if p == "meta-data" {
+			continue
+		}
+		fmt.Fprintf(h, "%s %s\n", m[p], p)
+	}
+	return "iid-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// replaceMetaData renders meta-data with args, and replaces the entry in the layout and the manifest.
+func replaceMetaData(layout []iso9660util.Entry, m manifest, args *TemplateArgs) error {
+	rendered, err := ExecuteTemplateCIDataISO(args)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(rendered, func(e iso9660util.Entry) bool { return e.Path == "meta-data" })
+	if idx < 0 {
+		return errors.New("meta-data not found in the template")
+	}
+	b, err := io.ReadAll(rendered[idx].Reader)
+	if err != nil {
+		return err
+	}
+	for i := range layout {
+		if layout[i].Path == "meta-data" {
+			layout[i].Reader = bytes.NewReader(b)
+		}
+	}
+	digest := sha256.Sum256(b)
+	m["meta-data"] = "sha256:" + hex.EncodeToString(digest[:])
+	return nil
+}
+
+func loadManifest(manifestPath string) (manifest, error) {
+	b, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", manifestPath, err)
+	}
+	return m, nil
+}
+
+func saveManifest(manifestPath string, m manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, append(b, '\n'), 0o644)
+}
+
+// maxDiffSize is the maximum size of the files shown in the diff.
+const maxDiffSize = 256 * 1024
+
+// logChanges logs the paths that differ between the old and the new manifest,
+// and the diffs of the changed text files (in the debug level).
+// The old contents are read from the existing isoPath, so this has to be called before overwriting it.
+func logChanges(isoPath string, oldManifest, newManifest manifest, layout []iso9660util.Entry) {
+	var added, removed, changed []string
+	for p, digest := range newManifest {
+		oldDigest, ok := oldManifest[p]
+		switch {
+		case !ok:
+			added = append(added, p)
+		case oldDigest != digest:
+			changed = append(changed, p)
+		}
+	}
+	for p := range oldManifest {
+		if _, ok := newManifest[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+	logrus.Infof("Regenerating cidata.iso: changed=%v, added=%v, removed=%v", changed, added, removed)
+	if logrus.GetLevel() < logrus.DebugLevel {
+		return
+	}
+	for _, p := range changed {
+		oldContent, err := iso9660util.ReadFile(isoPath, p)
+		if err != nil {
+			logrus.WithError(err).Debugf("Failed to read %q from the old cidata.iso", p)
+			continue
+		}
+		idx := slices.IndexFunc(layout, func(e iso9660util.Entry) bool { return e.Path == p })
+		rs, ok := layout[idx].Reader.(io.ReadSeeker)
+		if !ok {
+			continue
+		}
+		newContent, err := io.ReadAll(io.LimitReader(rs, maxDiffSize+1))
+		if _, seekErr := rs.Seek(0, io.SeekStart); seekErr != nil {
+			err = errors.Join(err, seekErr)
+		}
+		if err != nil {
+			logrus.WithError(err).Debugf("Failed to read %q", p)
+			continue
+		}
+		if !isText(oldContent) || !isText(newContent) {
+			logrus.Debugf("Binary file %q changed", p)
+			continue
+		}
+		logrus.Debugf("Diff of %q:\n%s", p, diffLines(string(oldContent), string(newContent)))
+	}
+}
+
+func isText(b []byte) bool {
+	return len(b) <= maxDiffSize && utf8.Valid(b) && !bytes.ContainsRune(b, 0)
+}
+
+// diffLines returns the lines removed from a (prefixed with "-") and added to b (prefixed with "+"),
+// in the order of the longest common subsequence of the lines.
+func diffLines(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&sb, "+%s\n", y[j])
+			j++
+		default:
+			fmt.Fprintf(&sb, "-%s\n", x[i])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// upToDate returns true if the manifests are identical and isoPath exists.
+func upToDate(isoPath string, oldManifest, newManifest manifest) bool {
+	if oldManifest == nil || !maps.Equal(oldManifest, newManifest) {
+		return false
+	}
+	_, err := os.Stat(isoPath)
+	return err == nil
+}
@@ -0,0 +1,87 @@
+package cidata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/iso9660util"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestManifest(t *testing.T) {
+	layout := func(userData string) []iso9660util.Entry {
+		return []iso9660util.Entry{
+			{Path: "meta-data", Reader: strings.NewReader("instance-id: iid-1\n")},
+			{Path: "user-data", Reader: strings.NewReader(userData)},
+		}
+	}
+	m1, l1, err := newManifest(layout("#cloud-config\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(l1), 2)
+	m2, _, err := newManifest(layout("#cloud-config\n"))
+	assert.NilError(t, err)
+	m3, _, err := newManifest(layout("#cloud-config\nusers: []\n"))
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, m1, m2)
+	assert.Equal(t, m1.instanceID(), m2.instanceID())
+	assert.Assert(t, m1.instanceID() != m3.instanceID())
+
+	// meta-data does not affect the instance id
+	m2["meta-data"] = "sha256:0"
+	assert.Equal(t, m1.instanceID(), m2.instanceID())
+}
+
+func TestDiffLines(t *testing.T) {
+	a := "a\nb\nc\n"
+	b := "a\nc\nd\n"
+	assert.Equal(t, diffLines(a, b), "-b\n+d\n")
+	assert.Equal(t, diffLines(a, a), "")
+}
+
+// TestWriteCIDataISOInstanceID pins the instance id of cidata.iso to the content,
+// so that cloud-init only reprocesses the per-instance config when the content has changed, not on every boot.
+func TestWriteCIDataISOInstanceID(t *testing.T) {
+	instDir := t.TempDir()
+	isoPath := filepath.Join(instDir, filenames.CIDataISO)
+	args := &TemplateArgs{
+		Name:       "default",
+		User:       "foo",
+		UID:        501,
+		Comment:    "Foo",
+		Home:       "/home/foo.linux",
+		SSHPubKeys: []string{"ssh-rsa dummy foo@example.com"},
+		MountType:  "reverse-sshfs",
+	}
+	write := func(iid, userData string) string {
+		layout := []iso9660util.Entry{
+			{Path: "meta-data", Reader: strings.NewReader("instance-id: " + iid + "\n")},
+			{Path: "user-data", Reader: strings.NewReader(userData)},
+		}
+		assert.NilError(t, writeCIDataISO(instDir, layout, args))
+		metaData, err := iso9660util.ReadFile(isoPath, "meta-data")
+		assert.NilError(t, err)
+		return string(metaData)
+	}
+
+	metaData1 := write("iid-1", "#cloud-config\n")
+	assert.Assert(t, strings.HasPrefix(metaData1, "instance-id: iid-"))
+	assert.Assert(t, !strings.Contains(metaData1, "iid-1\n"))
+	st1, err := os.Stat(isoPath)
+	assert.NilError(t, err)
+
+	// A new boot with the same content: the image is kept, with the same instance id
+	metaData2 := write("iid-2", "#cloud-config\n")
+	assert.Equal(t, metaData2, metaData1)
+	st2, err := os.Stat(isoPath)
+	assert.NilError(t, err)
+	assert.Assert(t, os.SameFile(st1, st2))
+	assert.Equal(t, st2.ModTime(), st1.ModTime())
+
+	// The content has changed: the image is regenerated, with a new instance id
+	metaData3 := write("iid-3", "#cloud-config\nusers: []\n")
+	assert.Assert(t, metaData3 != metaData1)
+}
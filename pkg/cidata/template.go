@@ -32,10 +32,31 @@ type Containerd struct {
 	System bool
 	User   bool
 }
+type Podman struct {
+	User bool
+}
 type Network struct {
 	MACAddress string
 	Interface  string
 	Metric     uint32
+	// Address is the static address with the prefix length, e.g., "192.168.105.10/24"; DHCP is used when empty
+	Address string
+	// Gateway is the default route of the static address; no default route is added when empty
+	Gateway string
+	// Internal ignores the routes and the DNS servers delivered by DHCP, for a "switch" network
+	Internal bool
+	// DNS is the DNS server for the names in DNSDomain, e.g., the gateway of a "switch" network
+	DNS       string
+	DNSDomain string
+}
+
+// WireGuard is the interface of a "wireguard" network; see pkg/networks/wireguard.
+type WireGuard struct {
+	Interface string
+	// Address is the static address with the prefix length, e.g., "10.99.0.10/24"
+	Address string
+	// Config is the configuration in the format of `wg setconf`, including the private key
+	Config string
 }
 type Mount struct {
 	Tag        string
@@ -43,15 +64,27 @@ type Mount struct {
 	Type       string
 	Options    string
 }
+type AdditionalUser struct {
+	Name       string
+	Comment    string
+	Home       string
+	UID        uint32 // 0 means that the UID is allocated by the guest
+	Shell      string
+	Sudo       bool
+	SSHPubKeys []string
+}
 type BootCmds struct {
 	Lines []string
 }
 type Disk struct {
-	Name   string
-	Device string
-	Format bool
-	FSType string
-	FSArgs []string
+	Name         string
+	Device       string
+	Format       bool
+	FSType       string
+	FSArgs       []string
+	Label        string
+	MountPoint   string
+	MountOptions []string
 }
 type TemplateArgs struct {
 	Debug                           bool
@@ -62,17 +95,22 @@ type TemplateArgs struct {
 	Comment                         string // user information
 	Home                            string // home directory
 	UID                             uint32
+	Shell                           string // login shell; empty means "/bin/bash"
 	SSHPubKeys                      []string
+	AdditionalUsers                 []AdditionalUser
 	Mounts                          []Mount
 	MountType                       string
 	Disks                           []Disk
 	GuestInstallPrefix              string
 	UpgradePackages                 bool
 	Containerd                      Containerd
+	Podman                          Podman
 	Networks                        []Network
+	WireGuard                       []WireGuard
 	SlirpNICName                    string
 	SlirpGateway                    string
 	SlirpDNS                        string
+	SlirpIPv6DNS                    string // empty unless the gvisor-tap-vsock network has an IPv6 subnet
 	SlirpIPAddress                  string
 	UDPDNSLocalPort                 int
 	TCPDNSLocalPort                 int
@@ -80,6 +118,9 @@ type TemplateArgs struct {
 	Param                           map[string]string
 	BootScripts                     bool
 	DNSAddresses                    []string
+	SearchDomains                   []string
+	NTPServers                      []string
+	MTU                             int
 	CACerts                         CACerts
 	HostHomeMountPoint              string
 	BootCmds                        []BootCmds
@@ -90,7 +131,12 @@ type TemplateArgs struct {
 	VSockPort                       int
 	VirtioPort                      string
 	Plain                           bool
+	CrashCapture                    bool
+	InstanceTags                    bool
+	Template                        string // short name of the template, e.g., "docker"; empty when unknown
 	TimeZone                        string
+	Sudo                            string // limayaml.SudoPolicy; empty means "full"
+	ExtraUserData                   string // merged into user-data; see limayaml.ParseExtraUserData
 }
 
 func ValidateTemplateArgs(args *TemplateArgs) error {
@@ -131,7 +177,11 @@ func ExecuteTemplateCloudConfig(args *TemplateArgs) ([]byte, error) {
 	}
 
 	cloudConfigYaml := string(userData)
-	return textutil.ExecuteTemplate(cloudConfigYaml, args)
+	b, err := textutil.ExecuteTemplate(cloudConfigYaml, args)
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtraUserData(b, args.ExtraUserData)
 }
 
 func ExecuteTemplateCIDataISO(args *TemplateArgs) ([]iso9660util.Entry, error) {
@@ -163,6 +213,12 @@ func ExecuteTemplateCIDataISO(args *TemplateArgs) ([]iso9660util.Entry, error) {
 		if err != nil {
 			return err
 		}
+		if path == "user-data" {
+			b, err = mergeExtraUserData(b, args.ExtraUserData)
+			if err != nil {
+				return err
+			}
+		}
 		layout = append(layout, iso9660util.Entry{
 			Path:   path,
 			Reader: bytes.NewReader(b),
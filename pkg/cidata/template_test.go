@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/goccy/go-yaml"
 	"gotest.tools/v3/assert"
 )
 
@@ -49,6 +50,90 @@ func TestConfigCACerts(t *testing.T) {
 	assert.Assert(t, strings.Contains(string(config), "ca_certs:"))
 }
 
+func TestConfigAdditionalUsers(t *testing.T) {
+	args := &TemplateArgs{
+		Name:    "default",
+		User:    "foo",
+		UID:     501,
+		Comment: "Foo",
+		Home:    "/home/foo.linux",
+		SSHPubKeys: []string{
+			"ssh-rsa dummy foo@example.com",
+		},
+		MountType: "reverse-sshfs",
+		AdditionalUsers: []AdditionalUser{
+			{Name: "alice", Comment: "Alice", Home: "/home/alice.linux", Shell: "/bin/zsh", Sudo: true, SSHPubKeys: []string{"ssh-ed25519 dummy alice@example.com"}},
+			{Name: "bob", Comment: "bob", Home: "/home/bob.linux", UID: 1002, Shell: "/bin/bash", SSHPubKeys: []string{"ssh-ed25519 dummy bob@example.com"}},
+		},
+	}
+	config, err := ExecuteTemplateCloudConfig(args)
+	assert.NilError(t, err)
+	t.Log(string(config))
+	var m map[string]any
+	assert.NilError(t, yaml.Unmarshal(config, &m))
+	users := m["users"].([]any)
+	assert.Equal(t, len(users), 3)
+	assert.Equal(t, users[0].(map[string]any)["shell"], "/bin/bash")
+	alice := users[1].(map[string]any)
+	assert.Equal(t, alice["name"], "alice")
+	assert.Equal(t, alice["shell"], "/bin/zsh")
+	assert.Equal(t, alice["sudo"], "ALL=(ALL) NOPASSWD:ALL")
+	_, ok := alice["uid"]
+	assert.Assert(t, !ok)
+	bob := users[2].(map[string]any)
+	assert.Equal(t, bob["uid"], "1002")
+	_, ok = bob["sudo"]
+	assert.Assert(t, !ok)
+	assert.DeepEqual(t, bob["ssh-authorized-keys"], []any{"ssh-ed25519 dummy bob@example.com"})
+}
+
+func TestConfigExtraUserData(t *testing.T) {
+	args := &TemplateArgs{
+		Name:    "default",
+		User:    "foo",
+		UID:     501,
+		Comment: "Foo",
+		Home:    "/home/foo.linux",
+		SSHPubKeys: []string{
+			"ssh-rsa dummy foo@example.com",
+		},
+		MountType:   "reverse-sshfs",
+		BootScripts: true,
+		ExtraUserData: `
+write_files:
+- path: /etc/motd
+  content: |
+    hello
+    world
+runcmd:
+- echo hello
+locale: en_US.UTF-8
+`,
+	}
+	config, err := ExecuteTemplateCloudConfig(args)
+	assert.NilError(t, err)
+	t.Log(string(config))
+	assert.Assert(t, strings.HasPrefix(string(config), "#cloud-config\n"))
+	var m map[string]any
+	assert.NilError(t, yaml.Unmarshal(config, &m))
+	writeFiles := m["write_files"].([]any)
+	assert.Equal(t, len(writeFiles), 2)
+	assert.Equal(t, writeFiles[0].(map[string]any)["path"], "/var/lib/cloud/scripts/per-boot/00-lima.boot.sh")
+	assert.Equal(t, writeFiles[1].(map[string]any)["content"], "hello\nworld\n")
+	assert.DeepEqual(t, m["runcmd"], []any{"echo hello"})
+	assert.Equal(t, m["locale"], "en_US.UTF-8")
+	assert.Equal(t, m["users"].([]any)[0].(map[string]any)["name"], "foo")
+
+	args.ExtraUserData = "growpart: {mode: off}"
+	_, err = ExecuteTemplateCloudConfig(args)
+	assert.ErrorContains(t, err, `key "growpart" is not supported`)
+
+	args.ExtraUserData = "package_update: true"
+	args.UpgradePackages = true
+	_, err = ExecuteTemplateCloudConfig(args)
+	assert.ErrorContains(t, err, "already set by Lima")
+}
+
 func TestTemplate(t *testing.T) {
 	args := &TemplateArgs{
 		Name: "default",
@@ -115,3 +200,120 @@ func TestTemplate9p(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateNFS(t *testing.T) {
+	args := &TemplateArgs{
+		Name: "default",
+		User: "foo",
+		UID:  501,
+		Home: "/home/foo.linux",
+		SSHPubKeys: []string{
+			"ssh-rsa dummy foo@example.com",
+		},
+		Mounts: []Mount{
+			{Tag: "127.0.0.1:/", MountPoint: "/Users/dummy", Type: "nfs", Options: "vers=3,proto=tcp,port=20490,mountport=20490,mountproto=tcp,nolock,noauto,nofail,_netdev,ro"},
+		},
+		MountType: "nfs",
+		CACerts: CACerts{
+			RemoveDefaults: &defaultRemoveDefaults,
+		},
+	}
+	layout, err := ExecuteTemplateCIDataISO(args)
+	assert.NilError(t, err)
+	for _, f := range layout {
+		if f.Path != "user-data" {
+			continue
+		}
+		b, err := io.ReadAll(f.Reader)
+		assert.NilError(t, err)
+		// written to /etc/fstab at boot, mounted later by the host agent
+		var config struct {
+			Mounts [][]string `yaml:"mounts"`
+		}
+		assert.NilError(t, yaml.Unmarshal(b, &config))
+		assert.DeepEqual(t, config.Mounts, [][]string{
+			{"127.0.0.1:/", "/Users/dummy", "nfs", "vers=3,proto=tcp,port=20490,mountport=20490,mountproto=tcp,nolock,noauto,nofail,_netdev,ro", "0", "0"},
+		})
+	}
+}
+
+func TestTemplateDHCP(t *testing.T) {
+	args := &TemplateArgs{
+		Name: "default",
+		User: "foo",
+		UID:  501,
+		Home: "/home/foo.linux",
+		SSHPubKeys: []string{
+			"ssh-rsa dummy foo@example.com",
+		},
+		MountType: "reverse-sshfs",
+		CACerts: CACerts{
+			RemoveDefaults: &defaultRemoveDefaults,
+		},
+		Networks: []Network{
+			{MACAddress: "52:55:55:00:00:01", Interface: "eth0", Metric: 200},
+			{MACAddress: "52:55:55:00:00:02", Interface: "lima0", Metric: 100},
+			{MACAddress: "52:55:55:00:00:03", Interface: "lima1", Metric: 100, Address: "192.168.105.10/24", Gateway: "192.168.105.1"},
+			{MACAddress: "52:55:55:00:00:04", Interface: "lima2", Metric: 100, Internal: true, DNS: "192.168.107.1", DNSDomain: "switch.internal"},
+		},
+		SlirpNICName:  "eth0",
+		SlirpIPv6DNS:  "fd4c:696d:6100:5::3",
+		DNSAddresses:  []string{"192.168.5.3", "fd4c:696d:6100:5::3"},
+		SearchDomains: []string{"corp.example.com"},
+		NTPServers:    []string{"ntp.example.com"},
+		MTU:           1400,
+	}
+	layout, err := ExecuteTemplateCIDataISO(args)
+	assert.NilError(t, err)
+	for _, f := range layout {
+		b, err := io.ReadAll(f.Reader)
+		assert.NilError(t, err)
+		switch f.Path {
+		case "network-config":
+			var config struct {
+				Ethernets map[string]struct {
+					DHCP4          bool `yaml:"dhcp4"`
+					DHCP4Overrides struct {
+						UseRoutes *bool `yaml:"use-routes"`
+						UseDNS    *bool `yaml:"use-dns"`
+					} `yaml:"dhcp4-overrides"`
+					Addresses []string `yaml:"addresses"`
+					MTU       int      `yaml:"mtu"`
+					AcceptRA  bool     `yaml:"accept-ra"`
+					Routes    []struct {
+						To     string `yaml:"to"`
+						Via    string `yaml:"via"`
+						Metric int    `yaml:"metric"`
+					} `yaml:"routes"`
+					Nameservers struct {
+						Addresses []string `yaml:"addresses"`
+						Search    []string `yaml:"search"`
+					} `yaml:"nameservers"`
+				} `yaml:"ethernets"`
+			}
+			assert.NilError(t, yaml.Unmarshal(b, &config))
+			assert.Equal(t, config.Ethernets["eth0"].MTU, 1400)
+			assert.Assert(t, config.Ethernets["eth0"].AcceptRA)
+			assert.DeepEqual(t, config.Ethernets["eth0"].Nameservers.Addresses, []string{"192.168.5.3", "fd4c:696d:6100:5::3"})
+			assert.DeepEqual(t, config.Ethernets["eth0"].Nameservers.Search, []string{"corp.example.com"})
+			assert.Equal(t, config.Ethernets["lima0"].MTU, 1400)
+			assert.Assert(t, !config.Ethernets["lima0"].AcceptRA)
+			assert.Assert(t, config.Ethernets["lima0"].Nameservers.Addresses == nil)
+			assert.DeepEqual(t, config.Ethernets["lima0"].Nameservers.Search, []string{"corp.example.com"})
+			assert.Assert(t, config.Ethernets["lima0"].DHCP4)
+			assert.Assert(t, !config.Ethernets["lima1"].DHCP4)
+			assert.DeepEqual(t, config.Ethernets["lima1"].Addresses, []string{"192.168.105.10/24"})
+			assert.Equal(t, len(config.Ethernets["lima1"].Routes), 1)
+			assert.Equal(t, config.Ethernets["lima1"].Routes[0].Via, "192.168.105.1")
+			assert.Equal(t, config.Ethernets["lima1"].Routes[0].Metric, 100)
+			assert.Assert(t, config.Ethernets["lima0"].DHCP4Overrides.UseRoutes == nil)
+			assert.Assert(t, config.Ethernets["lima2"].DHCP4)
+			assert.Equal(t, *config.Ethernets["lima2"].DHCP4Overrides.UseRoutes, false)
+			assert.Equal(t, *config.Ethernets["lima2"].DHCP4Overrides.UseDNS, false)
+			assert.DeepEqual(t, config.Ethernets["lima2"].Nameservers.Addresses, []string{"192.168.107.1"})
+			assert.DeepEqual(t, config.Ethernets["lima2"].Nameservers.Search, []string{"switch.internal", "corp.example.com"})
+		case "user-data":
+			assert.Assert(t, strings.Contains(string(b), "ntp:\n  enabled: true\n  servers:\n  - \"ntp.example.com\""))
+		}
+	}
+}
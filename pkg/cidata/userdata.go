@@ -0,0 +1,65 @@
+package cidata
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+const cloudConfigHeader = "#cloud-config\n"
+
+// mergeExtraUserData merges `cloudInit.extraUserData` into the user-data generated by Lima.
+// The lists are appended to the lists generated by Lima, and the other keys must not conflict.
+// userData is returned as is when extra is empty.
+func mergeExtraUserData(userData []byte, extra string) ([]byte, error) {
+	if extra == "" {
+		return userData, nil
+	}
+	extraM, err := limayaml.ParseExtraUserData(extra)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `cloudInit.extraUserData`: %w", err)
+	}
+	var v any
+	if err := yaml.UnmarshalWithOptions(userData, &v, yaml.UseOrderedMap()); err != nil {
+		return nil, fmt.Errorf("failed to parse the generated user-data: %w", err)
+	}
+	m, ok := v.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("the generated user-data must be a map, got %T", v)
+	}
+	for _, item := range extraM {
+		key := item.Key.(string) // validated by ParseExtraUserData
+		i := indexOfKey(m, key)
+		switch {
+		case i < 0:
+			m = append(m, item)
+		case limayaml.IsExtraUserDataListKey(key):
+			list, ok := m[i].Value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("the generated user-data has an unexpected %q: %T", key, m[i].Value)
+			}
+			m[i].Value = append(list, item.Value.([]any)...)
+		default:
+			return nil, fmt.Errorf("`cloudInit.extraUserData` must not set %q, as it is already set by Lima", key)
+		}
+	}
+	b, err := yaml.MarshalWithOptions(m, yaml.UseLiteralStyleIfMultiline(true))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigHeader)
+	buf.Write(b)
+	return buf.Bytes(), nil
+}
+
+func indexOfKey(m yaml.MapSlice, key string) int {
+	for i, item := range m {
+		if item.Key == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,120 @@
+package cidata
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/networks/wireguard"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// setupWireGuard configures the interface of a "wireguard" network.
+// The peers are the members on the other hosts in networks.yaml, and the other instances on this host that use
+// the same network. The latter are reached via the ports forwarded on the host, i.e., via hostGateway.
+// The instances on this host that are created later are added on the next start of the instance.
+func setupWireGuard(instDir, name string, nw limayaml.Network, hostGateway string) (*WireGuard, error) {
+	nwCfg, err := networks.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	ip, err := netip.ParseAddr(nw.StaticIP)
+	if err != nil {
+		return nil, err
+	}
+	prefix, _, err := nwCfg.StaticIPPrefix(nw.Lima, ip)
+	if err != nil {
+		return nil, err
+	}
+	port, err := nwCfg.WireGuardPort(nw.Lima, ip)
+	if err != nil {
+		return nil, err
+	}
+	key, err := wireguard.LoadOrGenerateKey(filepath.Join(instDir, filenames.WireGuardKey))
+	if err != nil {
+		return nil, err
+	}
+	peers, err := localWireGuardPeers(&nwCfg, name, nw.Lima, hostGateway)
+	if err != nil {
+		return nil, err
+	}
+	peers = append(peers, nwCfg.Networks[nw.Lima].Peers...)
+	return &WireGuard{
+		Interface: nw.Interface,
+		Address:   prefix.String(),
+		Config:    wireguard.Config(key, port, peers),
+	}, nil
+}
+
+// localWireGuardPeers returns the other instances on this host that use the "wireguard" network.
+// The instances that have never been started are skipped, as they have no key yet.
+func localWireGuardPeers(nwCfg *networks.Config, name, nwName, hostGateway string) ([]wireguard.Peer, error) {
+	instNames, err := store.Instances()
+	if err != nil {
+		return nil, err
+	}
+	var peers []wireguard.Peer
+	for _, instName := range instNames {
+		if instName == name {
+			continue
+		}
+		instDir, err := store.InstanceDir(instName)
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(filepath.Join(instDir, filenames.WireGuardKey))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				logrus.WithError(err).Warnf("Ignoring the WireGuard key of instance %q", instName)
+			}
+			continue
+		}
+		y, err := store.LoadYAMLByFilePath(filepath.Join(instDir, filenames.LimaYAML))
+		if err != nil {
+			logrus.WithError(err).Warnf("Ignoring instance %q as a WireGuard peer", instName)
+			continue
+		}
+		for _, nw := range y.Networks {
+			if nw.Lima != nwName || nw.StaticIP == "" {
+				continue
+			}
+			peer, err := localWireGuardPeer(nwCfg, instName, nwName, nw.StaticIP, strings.TrimSpace(string(b)), hostGateway)
+			if err != nil {
+				logrus.WithError(err).Warnf("Ignoring instance %q as a WireGuard peer", instName)
+				continue
+			}
+			peers = append(peers, peer)
+		}
+	}
+	return peers, nil
+}
+
+func localWireGuardPeer(nwCfg *networks.Config, instName, nwName, staticIP, privateKey, hostGateway string) (wireguard.Peer, error) {
+	ip, err := netip.ParseAddr(staticIP)
+	if err != nil {
+		return wireguard.Peer{}, err
+	}
+	port, err := nwCfg.WireGuardPort(nwName, ip)
+	if err != nil {
+		return wireguard.Peer{}, err
+	}
+	pub, err := wireguard.PublicKey(privateKey)
+	if err != nil {
+		return wireguard.Peer{}, fmt.Errorf("invalid WireGuard key: %w", err)
+	}
+	return wireguard.Peer{
+		Name:      instName,
+		PublicKey: pub,
+		Endpoint:  net.JoinHostPort(hostGateway, strconv.Itoa(port)),
+		Address:   ip.String(),
+	}, nil
+}
@@ -0,0 +1,257 @@
+// Package compose implements `limactl compose`, which manages a group of instances declared in a compose file
+// (lima-compose.yaml).
+//
+// Example:
+//
+//	name: myapp
+//	networks:
+//	- user-v2
+//	instances:
+//	  db:
+//	    template: template://default
+//	  web:
+//	    template: template://docker
+//	    overrides:
+//	    - ./web.override.yaml
+//	    set: .cpus = 4
+//	    dependsOn:
+//	    - db
+//
+// The instances are named "<project>-<instance>", e.g., "myapp-web".
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/containerd/containerd/identifiers"
+	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/fileutils"
+	"github.com/lima-vm/lima/pkg/limatmpl"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/yqutil"
+)
+
+// DefaultFile is the name of the compose file that is used when the file is not specified.
+const DefaultFile = "lima-compose.yaml"
+
+// Project is the content of the compose file.
+type Project struct {
+	// Name is the prefix of the instance names. Defaults to the name of the directory of the compose file.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Networks are the names of the networks in networks.yaml, e.g., "user-v2", shared by the instances.
+	Networks []string `yaml:"networks,omitempty" json:"networks,omitempty"`
+	// Instances are the instances, keyed by the name in the project.
+	Instances map[string]Instance `yaml:"instances" json:"instances"`
+
+	// dir is the directory of the compose file, for resolving the relative paths.
+	dir string
+}
+
+// Instance is an instance in the project.
+type Instance struct {
+	// Template is the locator of the template, e.g., "template://docker", "./lima.yaml". Defaults to "template://default".
+	// Relative paths are resolved from the directory of the compose file.
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+	// Overrides are merged into the template, in the same way as `limactl create --override`.
+	Overrides []string `yaml:"overrides,omitempty" json:"overrides,omitempty"`
+	// Set is the yq expression applied to the template, in the same way as `limactl create --set`.
+	Set string `yaml:"set,omitempty" json:"set,omitempty"`
+	// Networks are the networks of the project that the instance is attached to. Defaults to all the networks of the project.
+	Networks []string `yaml:"networks,omitempty" json:"networks,omitempty"`
+	// DependsOn are the instances that have to be started before this instance.
+	DependsOn []string `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+}
+
+// Load loads and validates the compose file.
+func Load(filePath string) (*Project, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var p Project
+	if err := yaml.UnmarshalWithOptions(b, &p, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", filePath, err)
+	}
+	p.dir = filepath.Dir(absPath)
+	if p.Name == "" {
+		p.Name = filepath.Base(p.dir)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid compose file %q: %w", filePath, err)
+	}
+	return &p, nil
+}
+
+// Validate validates the project.
+func (p *Project) Validate() error {
+	if err := identifiers.Validate(p.Name); err != nil {
+		return fmt.Errorf("field `name` is invalid (specify a valid name, as the name of the directory is not usable): %w", err)
+	}
+	if len(p.Instances) == 0 {
+		return errors.New("field `instances` must not be empty")
+	}
+	for key, inst := range p.Instances {
+		if err := identifiers.Validate(p.InstanceName(key)); err != nil {
+			return fmt.Errorf("field `instances.%s` has an invalid name: %w", key, err)
+		}
+		for _, nw := range inst.Networks {
+			if !slices.Contains(p.Networks, nw) {
+				return fmt.Errorf("field `instances.%s.networks` refers to %q, which is not in `networks`", key, nw)
+			}
+		}
+		for _, dep := range inst.DependsOn {
+			if _, ok := p.Instances[dep]; !ok {
+				return fmt.Errorf("field `instances.%s.dependsOn` refers to an unknown instance %q", key, dep)
+			}
+		}
+	}
+	_, err := p.Order()
+	return err
+}
+
+// ValidateNetworks checks that the networks of the project are defined in networks.yaml.
+func (p *Project) ValidateNetworks() error {
+	if len(p.Networks) == 0 {
+		return nil
+	}
+	cfg, err := networks.LoadConfig()
+	if err != nil {
+		return err
+	}
+	for _, nw := range p.Networks {
+		if _, ok := cfg.Networks[nw]; !ok {
+			cfgFile, _ := networks.ConfigFile()
+			return fmt.Errorf("network %q is not defined in %q", nw, cfgFile)
+		}
+	}
+	return nil
+}
+
+// InstanceName returns the name of the Lima instance, "<project>-<key>".
+func (p *Project) InstanceName(key string) string {
+	return p.Name + "-" + key
+}
+
+// Order returns the keys of the instances in the order to be started.
+// The instances are started after their dependencies; the order is alphabetical otherwise.
+func (p *Project) Order() ([]string, error) {
+	keys := make([]string, 0, len(p.Instances))
+	for key := range p.Instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var (
+		order    []string
+		visited  = make(map[string]bool)
+		visiting = make(map[string]bool)
+		visit    func(key string) error
+	)
+	visit = func(key string) error {
+		if visited[key] {
+			return nil
+		}
+		if visiting[key] {
+			return fmt.Errorf("field `instances.%s.dependsOn` has a circular dependency", key)
+		}
+		visiting[key] = true
+		deps := slices.Clone(p.Instances[key].DependsOn)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		visiting[key] = false
+		visited[key] = true
+		order = append(order, key)
+		return nil
+	}
+	for _, key := range keys {
+		if err := visit(key); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Template returns the template of the instance, with the overrides, the networks, and the yq expression applied.
+func (p *Project) Template(ctx context.Context, key string) (*limatmpl.Template, error) {
+	inst, ok := p.Instances[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown instance %q", key)
+	}
+	locator := inst.Template
+	if locator == "" {
+		locator = "template://default"
+	}
+	name := p.InstanceName(key)
+	tmpl, err := limatmpl.Read(ctx, name, p.resolve(locator))
+	if err != nil {
+		return nil, fmt.Errorf("instance %q: failed to read the template %q: %w", key, locator, err)
+	}
+	if len(tmpl.Bytes) == 0 {
+		return nil, fmt.Errorf("instance %q: template %q must be a non-empty YAML file or URL", key, locator)
+	}
+	for _, locator := range inst.Overrides {
+		o, err := limatmpl.Read(ctx, name, p.resolve(locator))
+		if err != nil {
+			return nil, fmt.Errorf("instance %q: failed to read the override %q: %w", key, locator, err)
+		}
+		if len(o.Bytes) == 0 {
+			return nil, fmt.Errorf("instance %q: override %q must be a non-empty YAML file or URL", key, locator)
+		}
+		if err := tmpl.ApplyOverride(o.Bytes); err != nil {
+			return nil, fmt.Errorf("instance %q: failed to apply the override %q: %w", key, locator, err)
+		}
+	}
+	nws := inst.Networks
+	if nws == nil {
+		nws = p.Networks
+	}
+	if len(nws) > 0 {
+		type network struct {
+			Lima string `yaml:"lima"`
+		}
+		var o struct {
+			Networks []network `yaml:"networks"`
+		}
+		for _, nw := range nws {
+			o.Networks = append(o.Networks, network{Lima: nw})
+		}
+		b, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.ApplyOverride(b); err != nil {
+			return nil, fmt.Errorf("instance %q: failed to apply the networks: %w", key, err)
+		}
+	}
+	if inst.Set != "" {
+		if tmpl.Bytes, err = yqutil.EvaluateExpression(inst.Set, tmpl.Bytes); err != nil {
+			return nil, fmt.Errorf("instance %q: failed to evaluate `set`: %w", key, err)
+		}
+	}
+	tmpl.Name = name
+	return tmpl, nil
+}
+
+// resolve resolves the relative path of a local file from the directory of the compose file.
+func (p *Project) resolve(locator string) string {
+	if isURL, _ := limatmpl.SeemsTemplateURL(locator); isURL {
+		return locator
+	}
+	if limatmpl.SeemsHTTPURL(locator) || limatmpl.SeemsFileURL(locator) || fileutils.IsOCI(locator) || filepath.IsAbs(locator) {
+		return locator
+	}
+	return filepath.Join(p.dir, locator)
+}
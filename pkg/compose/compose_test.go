@@ -0,0 +1,81 @@
+package compose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func writeProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "myapp")
+	assert.NilError(t, os.Mkdir(dir, 0o755))
+	for name, content := range files {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return filepath.Join(dir, DefaultFile)
+}
+
+func TestLoad(t *testing.T) {
+	file := writeProject(t, map[string]string{
+		DefaultFile: `
+networks: [user-v2]
+instances:
+  web:
+    template: ./web.yaml
+    overrides: [./me.yaml]
+    set: .cpus = 4
+    dependsOn: [db]
+  db:
+    template: ./db.yaml
+    networks: []
+  cache:
+    template: ./db.yaml
+`,
+		"web.yaml": "images: [{location: /web.img}]\ncpus: 2\nmemory: 2GiB\n",
+		"me.yaml":  "memory: 8GiB\n",
+		"db.yaml":  "images: [{location: /db.img}]\n",
+	})
+	p, err := Load(file)
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "myapp")
+	assert.Equal(t, p.InstanceName("web"), "myapp-web")
+
+	order, err := p.Order()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, order, []string{"cache", "db", "web"})
+
+	tmpl, err := p.Template(context.Background(), "web")
+	assert.NilError(t, err)
+	assert.Equal(t, tmpl.Name, "myapp-web")
+	assert.Equal(t, string(tmpl.Bytes), `images: [{location: /web.img}]
+cpus: 4
+memory: 8GiB
+networks:
+- lima: user-v2
+`)
+
+	tmpl, err = p.Template(context.Background(), "db")
+	assert.NilError(t, err)
+	assert.Equal(t, string(tmpl.Bytes), "images: [{location: /db.img}]\n")
+}
+
+func TestLoadInvalid(t *testing.T) {
+	testCases := map[string]string{
+		"instances: {}":                                         "field `instances` must not be empty",
+		"instances: {web: {dependsOn: [db]}}":                   "unknown instance \"db\"",
+		"instances: {web: {networks: [shared]}}":                "which is not in `networks`",
+		"instances: {a: {dependsOn: [b]}, b: {dependsOn: [a]}}": "circular dependency",
+		"instances: {web: {templates: foo}}":                    "unknown field",
+		"name: my/app\ninstances: {web: {}}":                    "field `name` is invalid",
+	}
+	for content, expected := range testCases {
+		t.Run(expected, func(t *testing.T) {
+			_, err := Load(writeProject(t, map[string]string{DefaultFile: content}))
+			assert.ErrorContains(t, err, expected)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package copyutil copies files between the host and the guests, and between two guests, as `limactl copy` does.
+package copyutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/progress"
+	"github.com/sirupsen/logrus"
+)
+
+// Path is a path on FS.
+type Path struct {
+	FS   FS
+	Path string
+	// Name is the name of Path for messages, e.g., "default:/etc/os-release".
+	Name string
+}
+
+type Options struct {
+	// Recursive copies the directories recursively.
+	Recursive bool
+	// Resume continues copying the files that were partially copied, assuming that the existing content of
+	// a target file is the beginning of the source file. Target files of the same size are skipped.
+	Resume bool
+	// Verbose logs the copied files.
+	Verbose bool
+}
+
+// job copies a file, or creates a directory.
+type job struct {
+	src, dst Path
+	info     fs.FileInfo
+}
+
+// Copy copies srcs to dst, as cp(1) does: when dst is an existing directory, the sources are copied into dst.
+// The files are streamed through the host when both srcs and dst are on the guests.
+func Copy(ctx context.Context, srcs []Path, dst Path, opts Options) error {
+	dstInfo, err := dst.FS.Stat(dst.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	intoDir := err == nil && dstInfo.IsDir()
+	if len(srcs) > 1 && !intoDir {
+		return fmt.Errorf("target %q is not a directory", dst.Name)
+	}
+
+	var (
+		jobs  []job
+		total int64
+	)
+	for _, src := range srcs {
+		info, err := src.FS.Stat(src.Path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && !opts.Recursive {
+			return fmt.Errorf("%q is a directory, specify --recursive to copy it", src.Name)
+		}
+		target := dst
+		if intoDir {
+			target = join(dst, src.FS.Base(src.Path))
+		}
+		planned, size, err := plan(src, target, info)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, planned...)
+		total += size
+	}
+
+	bar := progress.New("Copying", total)
+	bar.Start()
+	defer bar.Finish()
+	for _, j := range jobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if opts.Verbose {
+			logrus.Infof("Copying %q to %q", j.src.Name, j.dst.Name)
+		}
+		if j.info.IsDir() {
+			err = mkdir(j.dst, j.info.Mode().Perm())
+		} else {
+			err = copyFile(ctx, j, bar, opts.Resume)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy %q to %q: %w", j.src.Name, j.dst.Name, err)
+		}
+	}
+	return nil
+}
+
+func join(p Path, name string) Path {
+	return Path{FS: p.FS, Path: p.FS.Join(p.Path, name), Name: p.FS.Join(p.Name, name)}
+}
+
+// plan returns the jobs for copying src to dst, and the total size of the files.
+func plan(src, dst Path, info fs.FileInfo) ([]job, int64, error) {
+	if info.Mode().IsRegular() {
+		return []job{{src: src, dst: dst, info: info}}, info.Size(), nil
+	}
+	if !info.IsDir() {
+		logrus.Warnf("Skipping %q, which is not a regular file nor a directory", src.Name)
+		return nil, 0, nil
+	}
+	jobs := []job{{src: src, dst: dst, info: info}}
+	var total int64
+	entries, err := src.FS.ReadDir(src.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, e := range entries {
+		child := join(src, e.Name())
+		if e.Mode()&fs.ModeSymlink != 0 {
+			// follow the symbolic link, as scp does
+			if e, err = src.FS.Stat(child.Path); err != nil {
+				logrus.WithError(err).Warnf("Skipping %q", child.Name)
+				continue
+			}
+		}
+		childJobs, size, err := plan(child, join(dst, e.Name()), e)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, childJobs...)
+		total += size
+	}
+	return jobs, total, nil
+}
+
+func mkdir(dst Path, perm fs.FileMode) error {
+	if err := dst.FS.Mkdir(dst.Path, perm); err != nil {
+		if info, statErr := dst.FS.Stat(dst.Path); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func copyFile(ctx context.Context, j job, bar *progress.Bar, resume bool) error {
+	size := j.info.Size()
+	var offset int64
+	if resume {
+		if dstInfo, err := j.dst.FS.Stat(j.dst.Path); err == nil && dstInfo.Mode().IsRegular() && dstInfo.Size() <= size {
+			offset = dstInfo.Size()
+		}
+	}
+	bar.Add64(offset)
+	if offset == size && resume {
+		logrus.Debugf("Skipping %q, which has already been copied", j.src.Name)
+		return nil
+	}
+
+	in, err := j.src.FS.Open(j.src.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		logrus.Infof("Resuming copying %q from %d bytes", j.src.Name, offset)
+		flag = os.O_WRONLY
+	}
+	out, err := j.dst.FS.OpenFile(j.dst.Path, flag, j.info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			out.Close()
+			return err
+		}
+		if _, err := out.Seek(offset, io.SeekStart); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	r := &progressReader{ctx: ctx, r: in, bar: bar}
+	if _, err := io.CopyBuffer(out, r, make([]byte, 1<<20)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// progressReader updates bar, and stops reading when ctx is canceled.
+type progressReader struct {
+	ctx context.Context
+	r   io.Reader
+	bar *progress.Bar
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	r.bar.Update(int64(n))
+	return n, err
+}
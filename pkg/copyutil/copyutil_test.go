@@ -0,0 +1,72 @@
+package copyutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func hostPath(p string) Path {
+	return Path{FS: HostFS{}, Path: p, Name: p}
+}
+
+func TestCopyRecursive(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	assert.NilError(t, os.MkdirAll(filepath.Join(src, "sub"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(src, "sub", "b"), []byte("bb"), 0o600))
+	dst := t.TempDir()
+
+	err := Copy(context.Background(), []Path{hostPath(src)}, hostPath(dst), Options{})
+	assert.ErrorContains(t, err, "specify --recursive")
+
+	assert.NilError(t, Copy(context.Background(), []Path{hostPath(src)}, hostPath(dst), Options{Recursive: true}))
+	b, err := os.ReadFile(filepath.Join(dst, "src", "sub", "b"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "bb")
+	info, err := os.Stat(filepath.Join(dst, "src", "sub", "b"))
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0o600))
+
+	// copying again overwrites the files
+	assert.NilError(t, Copy(context.Background(), []Path{hostPath(src)}, hostPath(dst), Options{Recursive: true}))
+}
+
+func TestCopyMultipleSources(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	assert.NilError(t, os.WriteFile(a, []byte("a"), 0o644))
+	assert.NilError(t, os.WriteFile(b, []byte("b"), 0o644))
+
+	err := Copy(context.Background(), []Path{hostPath(a), hostPath(b)}, hostPath(filepath.Join(dir, "c")), Options{})
+	assert.ErrorContains(t, err, "is not a directory")
+
+	dst := filepath.Join(dir, "dst")
+	assert.NilError(t, os.Mkdir(dst, 0o755))
+	assert.NilError(t, Copy(context.Background(), []Path{hostPath(a), hostPath(b)}, hostPath(dst), Options{}))
+	got, err := os.ReadFile(filepath.Join(dst, "b"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), "b")
+}
+
+func TestCopyResume(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	assert.NilError(t, os.WriteFile(src, []byte("0123456789"), 0o644))
+	assert.NilError(t, os.WriteFile(dst, []byte("0123"), 0o644))
+
+	assert.NilError(t, Copy(context.Background(), []Path{hostPath(src)}, hostPath(dst), Options{Resume: true}))
+	got, err := os.ReadFile(dst)
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), "0123456789")
+
+	// without --resume, the file is copied from the beginning
+	assert.NilError(t, os.WriteFile(dst, []byte("xxxx"), 0o644))
+	assert.NilError(t, Copy(context.Background(), []Path{hostPath(src)}, hostPath(dst), Options{}))
+	got, err = os.ReadFile(dst)
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), "0123456789")
+}
@@ -0,0 +1,155 @@
+package copyutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+)
+
+// FS is the filesystem of an endpoint of a copy: the host, or a guest.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.FileInfo, error)
+	// Open opens the file for reading.
+	Open(name string) (File, error)
+	// OpenFile opens the file for writing with flag, e.g., os.O_WRONLY|os.O_CREATE|os.O_TRUNC.
+	// perm is set when the file is created.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Mkdir(name string, perm fs.FileMode) error
+	Join(elem ...string) string
+	Base(name string) string
+}
+
+// File is an open file of FS.
+type File interface {
+	io.ReadWriteSeeker
+	io.Closer
+}
+
+// HostFS is the filesystem of the host.
+type HostFS struct{}
+
+var _ FS = HostFS{}
+
+func (HostFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (HostFS) ReadDir(name string) ([]fs.FileInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdir(-1)
+}
+
+func (HostFS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (HostFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (HostFS) Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (HostFS) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+func (HostFS) Base(name string) string {
+	return filepath.Base(name)
+}
+
+// SFTPFS is the filesystem of a guest, accessed via SFTP.
+type SFTPFS struct {
+	client *sftp.Client
+	cmd    *exec.Cmd
+}
+
+var _ FS = (*SFTPFS)(nil)
+
+// NewSFTPFS starts cmd, e.g., `ssh -s ... sftp`, and speaks SFTP over its stdin and stdout.
+// Running ssh with the options of the instance reuses the connection of the SSH control master.
+func NewSFTPFS(cmd *exec.Cmd) (*SFTPFS, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClientPipe(stdout, stdin, sftp.UseConcurrentReads(true), sftp.UseConcurrentWrites(true))
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+	return &SFTPFS{client: client, cmd: cmd}, nil
+}
+
+// Close closes the SFTP session and waits for cmd to exit.
+func (s *SFTPFS) Close() error {
+	err := s.client.Close()
+	var exitErr *exec.ExitError
+	if waitErr := s.cmd.Wait(); waitErr != nil && !errors.As(waitErr, &exitErr) {
+		err = errors.Join(err, waitErr)
+	}
+	return err
+}
+
+func (s *SFTPFS) Stat(name string) (fs.FileInfo, error) {
+	return s.client.Stat(name)
+}
+
+func (s *SFTPFS) ReadDir(name string) ([]fs.FileInfo, error) {
+	return s.client.ReadDir(name)
+}
+
+func (s *SFTPFS) Open(name string) (File, error) {
+	return s.client.Open(name)
+}
+
+func (s *SFTPFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	_, statErr := s.client.Stat(name)
+	f, err := s.client.OpenFile(name, flag)
+	if err != nil {
+		return nil, err
+	}
+	if errors.Is(statErr, fs.ErrNotExist) {
+		// SFTP creates the file with the default permission of the server
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (s *SFTPFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := s.client.Mkdir(name); err != nil {
+		return err
+	}
+	return s.client.Chmod(name, perm)
+}
+
+func (*SFTPFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (*SFTPFS) Base(name string) string {
+	return path.Base(name)
+}
@@ -0,0 +1,180 @@
+// Package credentials looks up the credentials for downloading the templates and the images
+// from the private servers, without embedding the tokens in the URLs.
+//
+// The credentials are looked up in the following order:
+//   - the helpers configured in $LIMA_HOME/_config/credentials.yaml
+//   - the netrc file ($NETRC, or ~/.netrc; ~/_netrc on Windows)
+//
+// The credentials are only sent over HTTPS.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// Credential is a pair of the username and the secret.
+// An empty username means that the secret is a bearer token.
+type Credential struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// IsToken returns true if the secret is a bearer token.
+func (c *Credential) IsToken() bool {
+	return c.Username == "" || c.Username == "<token>"
+}
+
+// Config is the content of $LIMA_HOME/_config/credentials.yaml.
+type Config struct {
+	// Netrc enables reading the netrc file. Defaults to true.
+	Netrc *bool `yaml:"netrc,omitempty" json:"netrc,omitempty"`
+	// Helpers are consulted in order, before the netrc file.
+	Helpers []Helper `yaml:"helpers,omitempty" json:"helpers,omitempty"`
+}
+
+// Helper is an external program that provides the credentials.
+// Exactly one of Docker and Exec has to be set.
+type Helper struct {
+	// Hosts are the glob patterns of the host names, e.g., "*.example.com".
+	// Empty means all hosts.
+	Hosts []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	// Docker is the name of the Docker credential helper, e.g., "osxkeychain" for "docker-credential-osxkeychain".
+	Docker string `yaml:"docker,omitempty" json:"docker,omitempty"`
+	// Exec is the command that implements the "get" command of the Docker credential helper protocol:
+	// the host is written to the stdin, and `{"Username":"...","Secret":"..."}` is read from the stdout.
+	Exec []string `yaml:"exec,omitempty" json:"exec,omitempty"`
+}
+
+// matches returns true if the helper is configured for the host.
+func (h *Helper) matches(host string) bool {
+	if len(h.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range h.Hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// command returns the argv of the helper.
+func (h *Helper) command() []string {
+	if h.Docker != "" {
+		return []string{"docker-credential-" + h.Docker, "get"}
+	}
+	return h.Exec
+}
+
+// Validate validates the config.
+func (c *Config) Validate() error {
+	var errs []error
+	for i, h := range c.Helpers {
+		if (h.Docker == "") == (len(h.Exec) == 0) {
+			errs = append(errs, fmt.Errorf("helpers[%d]: exactly one of `docker` and `exec` has to be set", i))
+		}
+		if strings.ContainsAny(h.Docker, `/\`) {
+			errs = append(errs, fmt.Errorf("helpers[%d]: `docker` must be the name of the helper without %q, got %q", i, "docker-credential-", h.Docker))
+		}
+		for _, pattern := range h.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("helpers[%d]: invalid host pattern %q: %w", i, pattern, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ConfigPath returns the path of $LIMA_HOME/_config/credentials.yaml.
+func ConfigPath() (string, error) {
+	configDir, err := dirnames.LimaConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, filenames.Credentials), nil
+}
+
+// LoadConfig loads $LIMA_HOME/_config/credentials.yaml.
+// The default config is returned when the file does not exist.
+func LoadConfig() (*Config, error) {
+	var config Config
+	configPath, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &config, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %q: %w", configPath, err)
+	}
+	return &config, nil
+}
+
+// Lookup returns the credential for the host (the host name, without the port).
+// nil is returned when no credential is found.
+func (c *Config) Lookup(ctx context.Context, host string) (*Credential, error) {
+	for _, h := range c.Helpers {
+		if !h.matches(host) {
+			continue
+		}
+		cred, err := runHelper(ctx, h.command(), host)
+		if err != nil {
+			return nil, err
+		}
+		if cred != nil {
+			return cred, nil
+		}
+	}
+	if c.Netrc == nil || *c.Netrc {
+		return lookupNetrc(host)
+	}
+	return nil, nil
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]*Credential)
+)
+
+// Lookup looks up the credential for the host with the config loaded from $LIMA_HOME/_config/credentials.yaml.
+// The results are cached for the lifetime of the process, so as to avoid running the helpers repeatedly.
+func Lookup(ctx context.Context, host string) (*Credential, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cred, ok := cache[host]; ok {
+		return cred, nil
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	cred, err := config.Lookup(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the credential for %q: %w", host, err)
+	}
+	if cred != nil {
+		logrus.Debugf("Using the credential for %q", host)
+	}
+	cache[host] = cred
+	return cred, nil
+}
@@ -0,0 +1,156 @@
+package credentials
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseNetrc(t *testing.T) {
+	const netrc = `# comment
+machine example.com login alice password secret1
+machine token.example.com
+  password tok
+macdef init
+  cd /pub
+  machine evil.example.com login mallory password x
+
+machine example.com login bob password secret2
+default login anonymous password guest
+`
+	cred, err := parseNetrc(strings.NewReader(netrc), "example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cred, &Credential{Username: "alice", Secret: "secret1"})
+	assert.Assert(t, !cred.IsToken())
+
+	cred, err = parseNetrc(strings.NewReader(netrc), "token.example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cred, &Credential{Secret: "tok"})
+	assert.Assert(t, cred.IsToken())
+
+	cred, err = parseNetrc(strings.NewReader(netrc), "evil.example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cred, &Credential{Username: "anonymous", Secret: "guest"})
+
+	cred, err = parseNetrc(strings.NewReader("machine example.com login alice\n"), "example.com")
+	assert.NilError(t, err)
+	assert.Assert(t, cred == nil)
+
+	_, err = parseNetrc(strings.NewReader("machine example.com login\n"), "example.com")
+	assert.ErrorContains(t, err, "missing the value")
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NilError(t, (&Config{Helpers: []Helper{{Docker: "osxkeychain"}, {Hosts: []string{"*.example.com"}, Exec: []string{"foo"}}}}).Validate())
+	assert.ErrorContains(t, (&Config{Helpers: []Helper{{}}}).Validate(), "exactly one of")
+	assert.ErrorContains(t, (&Config{Helpers: []Helper{{Docker: "a", Exec: []string{"b"}}}}).Validate(), "exactly one of")
+	assert.ErrorContains(t, (&Config{Helpers: []Helper{{Docker: "docker-credential-foo/bar"}}}).Validate(), "must be the name")
+	assert.ErrorContains(t, (&Config{Helpers: []Helper{{Hosts: []string{"["}, Docker: "a"}}}).Validate(), "invalid host pattern")
+}
+
+// writeHelper writes a credential helper that prints the credential for "example.com".
+func writeHelper(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test helper is a shell script")
+	}
+	p := filepath.Join(t.TempDir(), "helper")
+	script := `#!/bin/sh
+read -r host
+case "$host" in
+example.com) echo '{"Username":"alice","Secret":"s3cr3t"}' ;;
+fail.example.com) echo "boom" >&2; exit 1 ;;
+*) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	assert.NilError(t, os.WriteFile(p, []byte(script), 0o755))
+	return p
+}
+
+func TestConfigLookup(t *testing.T) {
+	helper := writeHelper(t)
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	assert.NilError(t, os.WriteFile(netrc, []byte("machine example.com login bob password pw\nmachine other.example.com login carol password pw2\n"), 0o600))
+	t.Setenv("NETRC", netrc)
+
+	config := &Config{Helpers: []Helper{{Hosts: []string{"*example.com"}, Exec: []string{helper}}}}
+	ctx := context.Background()
+	cred, err := config.Lookup(ctx, "example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cred, &Credential{Username: "alice", Secret: "s3cr3t"})
+
+	// Falls back to netrc when the helper has no credential
+	cred, err = config.Lookup(ctx, "other.example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cred, &Credential{Username: "carol", Secret: "pw2"})
+
+	_, err = config.Lookup(ctx, "fail.example.com")
+	assert.ErrorContains(t, err, "boom")
+
+	// The helper is not used for the hosts that do not match
+	cred, err = config.Lookup(ctx, "fail.example.org")
+	assert.NilError(t, err)
+	assert.Assert(t, cred == nil)
+
+	disabled := false
+	config = &Config{Netrc: &disabled}
+	cred, err = config.Lookup(ctx, "example.com")
+	assert.NilError(t, err)
+	assert.Assert(t, cred == nil)
+}
+
+func TestLookupRegistry(t *testing.T) {
+	helper := writeHelper(t)
+	t.Setenv("PATH", filepath.Dir(helper)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	assert.NilError(t, os.Rename(helper, filepath.Join(filepath.Dir(helper), "docker-credential-test")))
+	dockerConfig := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+	assert.NilError(t, os.WriteFile(filepath.Join(dockerConfig, "config.json"),
+		[]byte(`{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}},"credHelpers":{"example.com":"test"}}`), 0o600))
+	t.Setenv("LIMA_HOME", t.TempDir())
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+
+	ctx := context.Background()
+	cred, err := LookupRegistry(ctx, "example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cred, &Credential{Username: "alice", Secret: "s3cr3t"})
+
+	cred, err = LookupRegistry(ctx, "registry.example.com")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cred, &Credential{Username: "user", Secret: "pass"})
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	t.Cleanup(srv.Close)
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	assert.NilError(t, os.WriteFile(netrc, []byte("machine 127.0.0.1 login user password pass\n"), 0o600))
+	t.Setenv("NETRC", netrc)
+	t.Setenv("LIMA_HOME", t.TempDir())
+
+	client := &http.Client{Transport: &Transport{Base: srv.Client().Transport}}
+	get := func(header string) string {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, http.NoBody)
+		assert.NilError(t, err)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := client.Do(req)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, get(""), "Basic dXNlcjpwYXNz")
+	assert.Equal(t, get("Bearer foo"), "Bearer foo")
+}
@@ -0,0 +1,83 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dockerConfig is the subset of $DOCKER_CONFIG/config.json.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+func loadDockerConfig() (*dockerConfig, error) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		configDir = filepath.Join(homeDir, ".docker")
+	}
+	var config dockerConfig
+	b, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the Docker config: %w", err)
+	}
+	return &config, nil
+}
+
+// LookupRegistry returns the credential for the OCI registry host from the Docker config
+// ($DOCKER_CONFIG/config.json, or ~/.docker/config.json), using "credHelpers", "credsStore", and "auths"
+// in this order as Docker does. Lookup is used when the Docker config has no credential for the host.
+// nil is returned for anonymous pulls.
+func LookupRegistry(ctx context.Context, host string) (*Credential, error) {
+	config, err := loadDockerConfig()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{host, "https://" + host}
+	if host == "registry-1.docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/")
+	}
+	for _, k := range keys {
+		if helper, ok := config.CredHelpers[k]; ok {
+			return runHelper(ctx, []string{"docker-credential-" + helper, "get"}, k)
+		}
+	}
+	if config.CredsStore != "" {
+		for _, k := range keys {
+			cred, err := runHelper(ctx, []string{"docker-credential-" + config.CredsStore, "get"}, k)
+			if err != nil || cred != nil {
+				return cred, err
+			}
+		}
+	}
+	for _, k := range keys {
+		if auth, ok := config.Auths[k]; ok && auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode the credentials for %q in the Docker config: %w", host, err)
+			}
+			user, secret, _ := strings.Cut(string(decoded), ":")
+			return &Credential{Username: user, Secret: secret}, nil
+		}
+	}
+	return Lookup(ctx, host)
+}
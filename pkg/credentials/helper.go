@@ -0,0 +1,46 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errCredentialsNotFound is printed by the Docker credential helpers when the credential is not found.
+// https://github.com/docker/docker-credential-helpers/blob/v0.8.2/credentials/error.go
+const errCredentialsNotFound = "credentials not found in native keychain"
+
+// runHelper runs the "get" command of the Docker credential helper protocol.
+// nil is returned when the helper has no credential for the server.
+func runHelper(ctx context.Context, argv []string, server string) (*Credential, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), errCredentialsNotFound) {
+			return nil, nil
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("credential helper %v failed: stdout=%q, stderr=%q: %w", argv, stdout.String(), stderr.String(), err)
+		}
+		return nil, fmt.Errorf("failed to run credential helper %v: %w", argv, err)
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil
+	}
+	var cred Credential
+	if err := json.Unmarshal(stdout.Bytes(), &cred); err != nil {
+		return nil, fmt.Errorf("failed to parse the output of credential helper %v: %w", argv, err)
+	}
+	if cred.Secret == "" {
+		return nil, nil
+	}
+	return &cred, nil
+}
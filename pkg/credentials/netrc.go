@@ -0,0 +1,117 @@
+package credentials
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcPath returns $NETRC, or ~/.netrc (~/_netrc on Windows, as curl does).
+func netrcPath() (string, error) {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(homeDir, name), nil
+}
+
+func lookupNetrc(host string) (*Credential, error) {
+	p, err := netrcPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	cred, err := parseNetrc(f, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", p, err)
+	}
+	return cred, nil
+}
+
+// parseNetrc returns the credential of the first "machine" entry for the host,
+// or of the "default" entry. The "macdef" entries are skipped.
+func parseNetrc(r io.Reader, host string) (*Credential, error) {
+	var tokens []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "macdef" {
+			// The macro continues until an empty line
+			for sc.Scan() && strings.TrimSpace(sc.Text()) != "" {
+			}
+			continue
+		}
+		tokens = append(tokens, fields...)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		cred     *Credential
+		matching bool
+	)
+loop:
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine", "default":
+			if cred != nil {
+				// The first matching entry wins
+				break loop
+			}
+			if tokens[i] == "default" {
+				matching = true
+			} else {
+				if i+1 >= len(tokens) {
+					return nil, errors.New("missing the value of \"machine\"")
+				}
+				i++
+				matching = tokens[i] == host
+			}
+			if matching {
+				cred = &Credential{}
+			}
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("missing the value of %q", tokens[i])
+			}
+			i++
+			if !matching {
+				continue
+			}
+			switch tokens[i-1] {
+			case "login":
+				cred.Username = tokens[i]
+			case "password":
+				cred.Secret = tokens[i]
+			}
+		}
+	}
+	if cred != nil && cred.Secret == "" {
+		return nil, nil
+	}
+	return cred, nil
+}
@@ -0,0 +1,46 @@
+package credentials
+
+import (
+	"net/http"
+)
+
+// Transport adds the Authorization header to the HTTPS requests, with the credential returned by Lookup.
+// The requests that already have the Authorization header are sent as they are.
+type Transport struct {
+	// Base is the underlying transport. http.DefaultTransport is used when nil.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return base.RoundTrip(req)
+	}
+	cred, err := Lookup(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		return base.RoundTrip(req)
+	}
+	// RoundTrip must not modify the request
+	req = req.Clone(req.Context())
+	SetAuthorization(req, cred)
+	return base.RoundTrip(req)
+}
+
+// SetAuthorization sets the Authorization header of the request.
+func SetAuthorization(req *http.Request, cred *Credential) {
+	if cred.IsToken() {
+		req.Header.Set("Authorization", "Bearer "+cred.Secret)
+	} else {
+		req.SetBasicAuth(cred.Username, cred.Secret)
+	}
+}
+
+// Client is the HTTP client that uses Transport.
+var Client = &http.Client{Transport: &Transport{}}
@@ -0,0 +1,72 @@
+// Package doctor diagnoses the host environment and the instances for `limactl doctor`.
+// The checks surface the requirements that are otherwise only checked by the drivers on `limactl start`.
+package doctor
+
+import (
+	"fmt"
+)
+
+type Severity = string
+
+const (
+	SeverityOK      Severity = "ok"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Check names.
+const (
+	CheckLimaHome             = "lima-home"
+	CheckQEMU                 = "qemu"
+	CheckFirmware             = "firmware"
+	CheckKVM                  = "kvm"
+	CheckVZ                   = "vz"
+	CheckNestedVirtualization = "nested-virtualization"
+	CheckRosetta              = "rosetta"
+	CheckSocketVMNet          = "socket_vmnet"
+	CheckInstance             = "instance"
+	CheckPorts                = "ports"
+	CheckGuestAgent           = "guest-agent"
+)
+
+// Finding is a result of a check.
+type Finding struct {
+	Check string `json:"check"`
+	// Instance is empty for the checks of the host
+	Instance string   `json:"instance,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Hint is the action to resolve the warning or the error
+	Hint string `json:"hint,omitempty"`
+}
+
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s: %s", f.Check, f.Message)
+	if f.Instance != "" {
+		s = fmt.Sprintf("instance %q: %s", f.Instance, s)
+	}
+	return s
+}
+
+func ok(check, format string, args ...any) Finding {
+	return Finding{Check: check, Severity: SeverityOK, Message: fmt.Sprintf(format, args...)}
+}
+
+func warning(check, hint, format string, args ...any) Finding {
+	return Finding{Check: check, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+func failure(check, hint, format string, args ...any) Finding {
+	return Finding{Check: check, Severity: SeverityError, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+// Count returns the number of the findings with the severity.
+func Count(findings []Finding, severity Severity) int {
+	var n int
+	for _, f := range findings {
+		if f.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
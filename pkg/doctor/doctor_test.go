@@ -0,0 +1,38 @@
+package doctor
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"gotest.tools/v3/assert"
+)
+
+func TestDuplicateSSHPorts(t *testing.T) {
+	all := []*store.Instance{
+		{Name: "default", SSHLocalPort: 60022},
+		{Name: "docker", SSHLocalPort: 60022},
+		{Name: "podman", SSHLocalPort: 60023},
+		{Name: "stopped"},
+		{Name: "new"},
+	}
+	assert.DeepEqual(t, duplicateSSHPorts(all[0], all), []string{"docker"})
+	assert.DeepEqual(t, duplicateSSHPorts(all[1], all), []string{"default"})
+	assert.Equal(t, len(duplicateSSHPorts(all[2], all)), 0)
+	// Port 0 is assigned on start
+	assert.Equal(t, len(duplicateSSHPorts(all[3], all)), 0)
+}
+
+func TestCount(t *testing.T) {
+	findings := []Finding{
+		ok(CheckQEMU, "QEMU %s", "9.2.0"),
+		warning(CheckFirmware, "install the firmware", "not found"),
+		failure(CheckPorts, "", "SSH port %d is already in use", 60022),
+		failure(CheckGuestAgent, "", "not connected"),
+	}
+	assert.Equal(t, Count(findings, SeverityOK), 1)
+	assert.Equal(t, Count(findings, SeverityWarning), 1)
+	assert.Equal(t, Count(findings, SeverityError), 2)
+	assert.Equal(t, findings[2].String(), "ports: SSH port 60022 is already in use")
+	findings[2].Instance = "default"
+	assert.Equal(t, findings[2].String(), `instance "default": ports: SSH port 60022 is already in use`)
+}
@@ -0,0 +1,163 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/fsutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/qemu"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/vz"
+)
+
+// Host checks the host environment.
+func Host(_ context.Context) []Finding {
+	var res []Finding
+	res = append(res, checkLimaHome()...)
+	res = append(res, checkQEMU()...)
+	switch runtime.GOOS {
+	case "darwin":
+		res = append(res, checkVZ()...)
+		if runtime.GOARCH == "arm64" {
+			res = append(res, checkRosetta()...)
+		}
+		res = append(res, checkSocketVMNet()...)
+	case "linux":
+		res = append(res, checkKVM()...)
+	}
+	return res
+}
+
+func checkLimaHome() []Finding {
+	dir, err := dirnames.LimaDir()
+	if err != nil {
+		return []Finding{failure(CheckLimaHome, "set $HOME or $LIMA_HOME", "%v", err)}
+	}
+	// Same as the check of limactl; the home directory is checked if LIMA_HOME does not exist yet
+	nfsDir := dir
+	if _, err := os.Stat(nfsDir); errors.Is(err, os.ErrNotExist) {
+		nfsDir = filepath.Dir(nfsDir)
+	}
+	nfs, err := fsutil.IsNFS(nfsDir)
+	if err != nil {
+		return []Finding{failure(CheckLimaHome, "", "failed to inspect the filesystem of %q: %v", nfsDir, err)}
+	}
+	if nfs {
+		return []Finding{failure(CheckLimaHome, "set $LIMA_HOME to a directory on a local filesystem", "%q is on NFS", nfsDir)}
+	}
+	return []Finding{ok(CheckLimaHome, "%q", dir)}
+}
+
+func checkQEMU() []Finding {
+	arch := limayaml.ResolveArch(nil)
+	exe, _, err := qemu.Exe(arch)
+	if err != nil {
+		return []Finding{warning(CheckQEMU, "install QEMU, e.g., `brew install qemu`, `sudo apt-get install qemu-system`; not needed if the instances use `vmType: vz`",
+			"QEMU for %s is not found: %v", arch, err)}
+	}
+	var res []Finding
+	version, err := qemu.Version(exe)
+	switch {
+	case err != nil:
+		res = append(res, warning(CheckQEMU, "", "failed to detect the version of %q: %v", exe, err))
+	case qemu.CheckVersion(version) != nil:
+		res = append(res, failure(CheckQEMU, "upgrade QEMU", "%v (%q)", qemu.CheckVersion(version), exe))
+	default:
+		res = append(res, ok(CheckQEMU, "QEMU %s (%q), accelerator %q", version, exe, qemu.Accel(arch)))
+	}
+	if firmware, err := qemu.Firmware(exe, arch); err != nil {
+		res = append(res, warning(CheckFirmware, "install the EDK2 firmware package of the distro, or set `firmware.legacyBIOS: true` for x86_64", "%v", err))
+	} else {
+		res = append(res, ok(CheckFirmware, "%q", firmware))
+	}
+	return res
+}
+
+func checkKVM() []Finding {
+	var res []Finding
+	if f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0); err != nil {
+		res = append(res, warning(CheckKVM, "load the kvm module, and add the user to the \"kvm\" group; QEMU falls back to the slow \"tcg\" accelerator",
+			"/dev/kvm is not accessible: %v", err))
+	} else {
+		f.Close()
+		res = append(res, ok(CheckKVM, "/dev/kvm is accessible"))
+	}
+	for _, module := range []string{"kvm_intel", "kvm_amd"} {
+		b, err := os.ReadFile(filepath.Join("/sys/module", module, "parameters", "nested"))
+		if err != nil {
+			continue
+		}
+		if nested := strings.TrimSpace(string(b)); nested == "Y" || nested == "1" {
+			res = append(res, ok(CheckNestedVirtualization, "enabled in %s", module))
+		} else {
+			res = append(res, warning(CheckNestedVirtualization, "set `options "+module+" nested=1` in /etc/modprobe.d, and reload the module; only needed for running VMs in the instances",
+				"disabled in %s", module))
+		}
+	}
+	return res
+}
+
+func checkVZ() []Finding {
+	if !slices.Contains(driverutil.Drivers(), limayaml.VZ) {
+		return []Finding{warning(CheckVZ, "build Lima with macOS 13 SDK or later, without the `no_vz` tag", "vmType %q is not compiled in", limayaml.VZ)}
+	}
+	version, err := osutil.ProductVersion()
+	if err != nil {
+		return []Finding{warning(CheckVZ, "", "failed to detect the macOS version: %v", err)}
+	}
+	var res []Finding
+	switch {
+	case version.LessThan(*semver.New("13.0.0")):
+		res = append(res, failure(CheckVZ, "upgrade macOS, or use `vmType: qemu`", "vmType %q requires macOS 13 or later, got %s", limayaml.VZ, version))
+	case version.LessThan(*semver.New("13.5.0")):
+		res = append(res, ok(CheckVZ, "available on macOS %s; vmType %q is the default on macOS 13.5 and later", version, limayaml.QEMU))
+	default:
+		res = append(res, ok(CheckVZ, "available on macOS %s", version))
+	}
+	if err := vz.CheckNestedVirtualization(); err != nil {
+		res = append(res, warning(CheckNestedVirtualization, "`nestedVirtualization` needs macOS 15 and M3 or later", "%v", err))
+	} else {
+		res = append(res, ok(CheckNestedVirtualization, "supported"))
+	}
+	return res
+}
+
+func checkRosetta() []Finding {
+	version, err := osutil.RosettaVersion()
+	if err != nil {
+		return []Finding{warning(CheckRosetta, "run `softwareupdate --install-rosetta`; only needed for `rosetta.enabled`", "%v", err)}
+	}
+	return []Finding{ok(CheckRosetta, "Rosetta %s", version)}
+}
+
+func checkSocketVMNet() []Finding {
+	cfg, err := networks.LoadConfig()
+	if err != nil {
+		return []Finding{failure(CheckSocketVMNet, "fix networks.yaml", "failed to load networks.yaml: %v", err)}
+	}
+	installed, err := cfg.IsDaemonInstalled(networks.SocketVMNet)
+	if err != nil {
+		return []Finding{failure(CheckSocketVMNet, "fix `paths.socketVMNet` in networks.yaml", "%v", err)}
+	}
+	if !installed {
+		return []Finding{ok(CheckSocketVMNet, "not installed; only needed for the %q, %q, and %q networks",
+			networks.ModeShared, networks.ModeBridged, networks.ModeHost)}
+	}
+	if err := cfg.Validate(); err != nil {
+		return []Finding{failure(CheckSocketVMNet, "fix `paths` in networks.yaml", "%v", err)}
+	}
+	if err := cfg.VerifySudoAccess(cfg.Paths.Sudoers); err != nil {
+		return []Finding{failure(CheckSocketVMNet, "run `limactl sudoers >etc_sudoers.d_lima && sudo install -o root etc_sudoers.d_lima "+cfg.Paths.Sudoers+"`", "%v", err)}
+	}
+	return []Finding{ok(CheckSocketVMNet, "%q, with sudoers %q", cfg.Paths.SocketVMNet, cfg.Paths.Sudoers)}
+}
@@ -0,0 +1,158 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/instance"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// guestAgentTimeout is short, as the events since the host agent was started are replayed by instance.Wait.
+const guestAgentTimeout = 3 * time.Second
+
+// Instance checks the instance.
+// all is the list of all the instances, for detecting the collisions of the ports.
+func Instance(ctx context.Context, inst *store.Instance, all []*store.Instance) []Finding {
+	var res []Finding
+	res = append(res, checkInstance(inst)...)
+	if inst.Config != nil {
+		res = append(res, checkPorts(inst, all)...)
+		res = append(res, checkNetworks(inst)...)
+		if inst.Status == store.StatusRunning {
+			res = append(res, checkInstanceRosetta(ctx, inst)...)
+			res = append(res, checkGuestAgent(ctx, inst)...)
+		}
+	}
+	for i := range res {
+		res[i].Instance = inst.Name
+	}
+	return res
+}
+
+func checkInstance(inst *store.Instance) []Finding {
+	var res []Finding
+	for _, err := range inst.Errors {
+		res = append(res, failure(CheckInstance, fmt.Sprintf("see %q", filepath.Join(inst.Dir, filenames.HostAgentStderrLog)), "%v", err))
+	}
+	if inst.Config == nil {
+		return res
+	}
+	if err := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{Instance: inst}).Validate(); err != nil {
+		res = append(res, failure(CheckInstance, "run `limactl edit "+inst.Name+"`", "vmType %q: %v", inst.VMType, err))
+	}
+	if len(res) == 0 {
+		res = append(res, ok(CheckInstance, "vmType %q, status %q", inst.VMType, inst.Status))
+	}
+	return res
+}
+
+// duplicateSSHPorts returns the names of the other instances that use the same SSH port as inst.
+func duplicateSSHPorts(inst *store.Instance, all []*store.Instance) []string {
+	var res []string
+	if inst.SSHLocalPort == 0 {
+		return res
+	}
+	for _, other := range all {
+		if other.Name != inst.Name && other.SSHLocalPort == inst.SSHLocalPort {
+			res = append(res, other.Name)
+		}
+	}
+	return res
+}
+
+func checkPorts(inst *store.Instance, all []*store.Instance) []Finding {
+	if inst.SSHLocalPort == 0 {
+		return []Finding{ok(CheckPorts, "SSH port is assigned on start")}
+	}
+	if dups := duplicateSSHPorts(inst, all); len(dups) > 0 {
+		return []Finding{failure(CheckPorts, "set `ssh.localPort: 0` to assign a free port automatically",
+			"SSH port %d is also used by %s", inst.SSHLocalPort, strings.Join(dups, ", "))}
+	}
+	if inst.Status == store.StatusRunning {
+		return []Finding{ok(CheckPorts, "SSH port %d", inst.SSHLocalPort)}
+	}
+	addr := net.JoinHostPort(inst.SSHAddress, strconv.Itoa(inst.SSHLocalPort))
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return []Finding{failure(CheckPorts, "stop the process that listens on the port, or set `ssh.localPort: 0`",
+			"SSH port %d is already in use: %v", inst.SSHLocalPort, err)}
+	}
+	l.Close()
+	return []Finding{ok(CheckPorts, "SSH port %d is available", inst.SSHLocalPort)}
+}
+
+func checkNetworks(inst *store.Instance) []Finding {
+	var names []string
+	for _, nw := range inst.Config.Networks {
+		if nw.Lima != "" {
+			names = append(names, nw.Lima)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	cfg, err := networks.LoadConfig()
+	if err != nil {
+		return []Finding{failure(CheckSocketVMNet, "fix networks.yaml", "failed to load networks.yaml: %v", err)}
+	}
+	var res []Finding
+	for _, name := range names {
+		nw, found := cfg.Networks[name]
+		if !found {
+			res = append(res, failure(CheckSocketVMNet, "define the network in networks.yaml", "network %q is not defined", name))
+			continue
+		}
+		switch nw.Mode {
+		case networks.ModeShared, networks.ModeBridged, networks.ModeHost:
+		default:
+			continue
+		}
+		installed, err := cfg.IsDaemonInstalled(networks.SocketVMNet)
+		if err != nil || !installed {
+			res = append(res, failure(CheckSocketVMNet, "install socket_vmnet, see https://lima-vm.io/docs/config/network/#socket_vmnet",
+				"network %q (mode %q) requires socket_vmnet", name, nw.Mode))
+			continue
+		}
+		res = append(res, ok(CheckSocketVMNet, "network %q (mode %q)", name, nw.Mode))
+	}
+	return res
+}
+
+func checkInstanceRosetta(ctx context.Context, inst *store.Instance) []Finding {
+	if inst.VMType != limayaml.VZ || !*inst.Config.Rosetta.Enabled {
+		return nil
+	}
+	st, err := instance.InspectRosetta(ctx, inst)
+	if err != nil {
+		return []Finding{warning(CheckRosetta, "", "%v", err)}
+	}
+	problems := st.Problems(*inst.Config.Rosetta.BinFmt)
+	if len(problems) == 0 {
+		return []Finding{ok(CheckRosetta, "enabled (binfmt: %v)", *inst.Config.Rosetta.BinFmt)}
+	}
+	var res []Finding
+	for _, p := range problems {
+		res = append(res, failure(CheckRosetta, "run `limactl doctor rosetta "+inst.Name+"`", "%s", p))
+	}
+	return res
+}
+
+func checkGuestAgent(ctx context.Context, inst *store.Instance) []Finding {
+	cond := instance.WaitCondition{Kind: hostagentevents.ReadyGuestAgent}
+	if err := instance.Wait(ctx, inst, []instance.WaitCondition{cond}, guestAgentTimeout); err != nil {
+		return []Finding{failure(CheckGuestAgent, fmt.Sprintf("see %q", filepath.Join(inst.Dir, filenames.HostAgentStderrLog)), "not connected: %v", err)}
+	}
+	return []Finding{ok(CheckGuestAgent, "connected")}
+}
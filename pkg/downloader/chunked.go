@@ -0,0 +1,357 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/credentials"
+	"github.com/lima-vm/lima/pkg/httpclientutil"
+	"github.com/lima-vm/lima/pkg/progress"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// minChunkedSize is the minimum size of a remote file to be downloaded in chunks.
+	minChunkedSize int64 = 32 << 20
+	// chunkSize is the size of a chunk, which is also the unit of resuming a download.
+	chunkSize int64 = 16 << 20
+	// chunkRetryInterval is multiplied by the number of the attempts.
+	chunkRetryInterval = time.Second
+)
+
+const (
+	// chunkConnections is the number of the parallel connections of a chunked download.
+	chunkConnections = 4
+	// chunkRetries is the number of the retries of a chunk, continuing from the last received byte.
+	chunkRetries = 3
+)
+
+var rateLimiter atomic.Pointer[rate.Limiter]
+
+// SetRateLimit limits the total bandwidth of the downloads of the process, in bytes per second.
+// 0 means unlimited.
+func SetRateLimit(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		rateLimiter.Store(nil)
+		return
+	}
+	rateLimiter.Store(rate.NewLimiter(rate.Limit(bytesPerSec), int(max(bytesPerSec, 32<<10))))
+}
+
+// limitReader returns r limited by SetRateLimit.
+func limitReader(ctx context.Context, r io.Reader) io.Reader {
+	l := rateLimiter.Load()
+	if l == nil {
+		return r
+	}
+	return &rateLimitedReader{ctx: ctx, r: r, l: l}
+}
+
+type rateLimitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.l.Burst() {
+		p = p[:r.l.Burst()]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.l.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// remoteInfo is the information of a remote file, retrieved with HEAD.
+type remoteInfo struct {
+	size         int64
+	acceptRanges bool
+	etag         string
+	lastModified string
+	contentType  string
+}
+
+func probeRemote(ctx context.Context, url string) (*remoteInfo, error) {
+	resp, err := httpclientutil.Head(ctx, credentials.Client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return &remoteInfo{
+		size:         resp.ContentLength,
+		acceptRanges: strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes"),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		contentType:  resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// partialState is the state of a chunked download, stored next to the partially downloaded file
+// so that the download can be resumed by the next run.
+type partialState struct {
+	URL          string `json:"url"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	ChunkSize    int64  `json:"chunkSize"`
+	Done         []bool `json:"done"`
+}
+
+func newPartialState(url string, info *remoteInfo) *partialState {
+	return &partialState{
+		URL:          url,
+		Size:         info.size,
+		ETag:         info.etag,
+		LastModified: info.lastModified,
+		ChunkSize:    chunkSize,
+		Done:         make([]bool, (info.size+chunkSize-1)/chunkSize),
+	}
+}
+
+// resumable returns true if the remote file can be identified by ETag or Last-Modified,
+// so that a change of the remote file is detected on resuming.
+func (s *partialState) resumable() bool {
+	return s.ETag != "" || s.LastModified != ""
+}
+
+// sameRemote returns true if o was created for the same remote file as s.
+func (s *partialState) sameRemote(o *partialState) bool {
+	return s.URL == o.URL && s.Size == o.Size && s.ETag == o.ETag && s.LastModified == o.LastModified &&
+		s.ChunkSize == o.ChunkSize && len(s.Done) == len(o.Done)
+}
+
+func (s *partialState) chunk(i int) (start, end int64) {
+	start = int64(i) * s.ChunkSize
+	return start, min(start+s.ChunkSize, s.Size) - 1
+}
+
+func loadPartialState(path string) (*partialState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s partialState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *partialState) save(path string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// downloadChunked downloads url into localPath with parallel range requests.
+// When resume is true, the partially downloaded file is kept on failure, and is resumed by the next call.
+// The caller has to ensure that localPath is not downloaded by other processes concurrently when resume is true.
+// Returns the number of the bytes transferred.
+func downloadChunked(ctx context.Context, localPath, lastModified, contentType, url, description string,
+	expectedDigest digest.Digest, info *remoteInfo, resume bool,
+) (int64, error) {
+	state := newPartialState(url, info)
+	resume = resume && state.resumable()
+	partial := localPath + ".partial"
+	statePath := partial + ".json"
+	if resume {
+		if saved, err := loadPartialState(statePath); err == nil && saved.sameRemote(state) {
+			state = saved
+		} else {
+			_ = os.Remove(partial)
+		}
+	} else {
+		partial = perProcessTempfile(localPath)
+		defer os.RemoveAll(partial)
+	}
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := f.Truncate(state.Size); err != nil {
+		return 0, err
+	}
+
+	var (
+		pending   []int
+		doneBytes int64
+	)
+	for i, done := range state.Done {
+		if done {
+			start, end := state.chunk(i)
+			doneBytes += end - start + 1
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	if doneBytes > 0 {
+		logrus.Infof("Resuming the download of %q (%s / %s)", url,
+			units.BytesSize(float64(doneBytes)), units.BytesSize(float64(state.Size)))
+	}
+	logrus.Debugf("downloading %q into %q with %d connections (%d chunks)", url, localPath, chunkConnections, len(pending))
+	if description == "" {
+		description = url
+	}
+	bar := progress.New("Downloading "+description, state.Size)
+	bar.Add64(doneBytes)
+	bar.Start()
+	defer bar.Finish()
+
+	var (
+		transferred atomic.Int64
+		mu          sync.Mutex
+	)
+	queue := make(chan int)
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		defer close(queue)
+		for _, i := range pending {
+			select {
+			case queue <- i:
+			case <-egCtx.Done():
+				return egCtx.Err()
+			}
+		}
+		return nil
+	})
+	for range chunkConnections {
+		eg.Go(func() error {
+			for i := range queue {
+				start, end := state.chunk(i)
+				if err := downloadChunk(egCtx, f, url, start, end, bar, &transferred); err != nil {
+					return err
+				}
+				if !resume {
+					continue
+				}
+				// the data has to be persisted before the chunk is recorded as done
+				if err := f.Sync(); err != nil {
+					return err
+				}
+				mu.Lock()
+				state.Done[i] = true
+				err := state.save(statePath)
+				mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return transferred.Load(), err
+	}
+	bar.Finish()
+
+	if expectedDigest != "" {
+		if err := validateLocalFileDigest(partial, expectedDigest); err != nil {
+			// the chunks cannot be told apart, so the whole download has to be restarted
+			_ = os.Remove(partial)
+			_ = os.Remove(statePath)
+			return transferred.Load(), err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return transferred.Load(), err
+	}
+	if err := f.Close(); err != nil {
+		return transferred.Load(), err
+	}
+	if lastModified != "" {
+		if err := os.WriteFile(lastModified, []byte(info.lastModified), 0o644); err != nil {
+			return transferred.Load(), err
+		}
+	}
+	if contentType != "" {
+		if err := os.WriteFile(contentType, []byte(info.contentType), 0o644); err != nil {
+			return transferred.Load(), err
+		}
+	}
+	if err := os.Rename(partial, localPath); err != nil {
+		return transferred.Load(), err
+	}
+	if resume {
+		_ = os.Remove(statePath)
+	}
+	return transferred.Load(), nil
+}
+
+// downloadChunk downloads the byte range [start, end] of url into f.
+// A failed request is retried from the last received byte.
+func downloadChunk(ctx context.Context, f *os.File, url string, start, end int64, bar *progress.Bar, transferred *atomic.Int64) error {
+	var err error
+	for attempt := 0; attempt <= chunkRetries; attempt++ {
+		if attempt > 0 {
+			logrus.WithError(err).Debugf("retrying the range %d-%d of %q (attempt %d)", start, end, url, attempt)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * chunkRetryInterval):
+			}
+		}
+		var n int64
+		n, err = fetchRange(ctx, f, url, start, end, bar)
+		transferred.Add(n)
+		start += n
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func fetchRange(ctx context.Context, f *os.File, url string, start, end int64, bar *progress.Bar) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := credentials.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := httpclientutil.Successful(resp); err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("expected status %d for range %d-%d, got %d", http.StatusPartialContent, start, end, resp.StatusCode)
+	}
+	if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-%d/", start, end)) {
+		return 0, fmt.Errorf("unexpected Content-Range %q for range %d-%d", cr, start, end)
+	}
+	w := io.NewOffsetWriter(f, start)
+	r := bar.NewProxyReader(limitReader(ctx, io.LimitReader(resp.Body, end-start+1)))
+	n, err := io.Copy(w, r)
+	if err == nil && n != end-start+1 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -16,24 +16,16 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/cheggaaa/pb/v3"
 	"github.com/containerd/continuity/fs"
+	"github.com/lima-vm/lima/pkg/credentials"
 	"github.com/lima-vm/lima/pkg/httpclientutil"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/lockutil"
-	"github.com/lima-vm/lima/pkg/progressbar"
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
-// HideProgress is used only for testing.
-var HideProgress bool
-
-// hideBar is used only for testing.
-func hideBar(bar *progressbar.ProgressBar) {
-	bar.Set(pb.Static, true)
-}
-
 type Status = string
 
 const (
@@ -53,6 +45,7 @@ type Result struct {
 
 type options struct {
 	cacheDir       string // default: empty (disables caching)
+	sharedCacheDir string // default: empty (disables the read-only shared cache)
 	decompress     bool   // default: false (keep compression)
 	description    string // default: url
 	expectedDigest digest.Digest
@@ -70,6 +63,8 @@ func (o *options) apply(opts []Opt) error {
 type Opt func(*options) error
 
 // WithCache enables caching using filepath.Join(os.UserCacheDir(), "lima") as the cache dir.
+//
+// WithCache also enables the read-only shared cache dir specified in $LIMA_SHARED_CACHE_DIR, if set.
 func WithCache() Opt {
 	return func(o *options) error {
 		ucd, err := os.UserCacheDir()
@@ -77,6 +72,9 @@ func WithCache() Opt {
 			return err
 		}
 		cacheDir := filepath.Join(ucd, "lima")
+		if err := WithSharedCacheDir(os.Getenv("LIMA_SHARED_CACHE_DIR"))(o); err != nil {
+			return err
+		}
 		return WithCacheDir(cacheDir)(o)
 	}
 }
@@ -90,6 +88,19 @@ func WithCacheDir(cacheDir string) Opt {
 	}
 }
 
+// WithSharedCacheDir enables the read-only shared cache using the specified dir.
+// Empty value disables the shared cache.
+//
+// The shared cache has the same layout as the cache dir, and is typically populated by an administrator
+// of a multi-user machine. The shared cache is consulted before the cache dir, and is never written to,
+// so it does not need to be writable by the current user.
+func WithSharedCacheDir(sharedCacheDir string) Opt {
+	return func(o *options) error {
+		o.sharedCacheDir = sharedCacheDir
+		return nil
+	}
+}
+
 // WithDescription adds a user description of the download.
 func WithDescription(description string) Opt {
 	return func(o *options) error {
@@ -219,7 +230,7 @@ func Download(ctx context.Context, local, remote string, opts ...Opt) (*Result,
 	}
 
 	if o.cacheDir == "" {
-		if err := downloadHTTP(ctx, localPath, "", "", remote, o.description, o.expectedDigest); err != nil {
+		if _, err := downloadHTTP(ctx, localPath, "", "", remote, o.description, o.expectedDigest, false); err != nil {
 			return nil, err
 		}
 		res := &Result{
@@ -229,6 +240,15 @@ func Download(ctx context.Context, local, remote string, opts ...Opt) (*Result,
 		return res, nil
 	}
 
+	if o.sharedCacheDir != "" {
+		res, err := getSharedCached(ctx, localPath, remote, o)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to use the shared cache %q; falling back to the per-user cache", o.sharedCacheDir)
+		} else if res != nil {
+			return res, nil
+		}
+	}
+
 	shad := cacheDirectoryPath(o.cacheDir, remote)
 	if err := os.MkdirAll(shad, 0o700); err != nil {
 		return nil, err
@@ -242,6 +262,7 @@ func Download(ctx context.Context, local, remote string, opts ...Opt) (*Result,
 			return err
 		}
 		if res != nil {
+			markCacheUsed(shad)
 			return nil
 		}
 		res, err = fetch(ctx, localPath, remote, o)
@@ -298,6 +319,15 @@ func getCached(ctx context.Context, localPath, remote string, o options) (*Resul
 	return res, nil
 }
 
+// getSharedCached is similar to getCached, but reads the read-only shared cache.
+// The shared cache is not locked, as the current user is not expected to have
+// write permission on it, and Lima never writes to it.
+func getSharedCached(ctx context.Context, localPath, remote string, o options) (*Result, error) {
+	so := o
+	so.cacheDir = o.sharedCacheDir
+	return getCached(ctx, localPath, remote, so)
+}
+
 // fetch downloads remote to the cache and copy the cached file to local path.
 func fetch(ctx context.Context, localPath, remote string, o options) (*Result, error) {
 	shad := cacheDirectoryPath(o.cacheDir, remote)
@@ -313,7 +343,10 @@ func fetch(ctx context.Context, localPath, remote string, o options) (*Result, e
 	if err := os.WriteFile(shadURL, []byte(remote), 0o644); err != nil {
 		return nil, err
 	}
-	if err := downloadHTTP(ctx, shadData, shadTime, shadType, remote, o.description, o.expectedDigest); err != nil {
+	started := time.Now()
+	transferred, err := downloadHTTP(ctx, shadData, shadTime, shadType, remote, o.description, o.expectedDigest, true)
+	recordMirror(o.cacheDir, remote, transferred, time.Since(started), err)
+	if err != nil {
 		return nil, err
 	}
 	if shadDigest != "" && o.expectedDigest != "" {
@@ -525,19 +558,16 @@ func decompressorByMagic(file string) string {
 }
 
 func decompressLocal(ctx context.Context, decompressCmd, dst, src, ext, description string) error {
-	logrus.Infof("decompressing %s with %v", ext, decompressCmd)
+	logrus.Debugf("decompressing %s with %v", ext, decompressCmd)
 
 	st, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
-	bar, err := progressbar.New(st.Size())
-	if err != nil {
-		return err
-	}
-	if HideProgress {
-		hideBar(bar)
+	if description == "" {
+		description = filepath.Base(src)
 	}
+	bar := progress.New("Decompressing "+description, st.Size())
 
 	in, err := os.Open(src)
 	if err != nil {
@@ -554,12 +584,6 @@ func decompressLocal(ctx context.Context, decompressCmd, dst, src, ext, descript
 	cmd.Stdin = bar.NewProxyReader(in)
 	cmd.Stdout = out
 	cmd.Stderr = buf
-	if !HideProgress {
-		if description == "" {
-			description = filepath.Base(src)
-		}
-		logrus.Infof("Decompressing %s\n", description)
-	}
 	bar.Start()
 	err = cmd.Run()
 	if err != nil {
@@ -627,7 +651,7 @@ func matchLastModified(ctx context.Context, lastModifiedPath, url string) (match
 	if lmCached == "" {
 		return false, "<not cached>", "<not checked>", nil
 	}
-	resp, err := httpclientutil.Head(ctx, http.DefaultClient, url)
+	resp, err := httpclientutil.Head(ctx, credentials.Client, url)
 	if err != nil {
 		return false, lmCached, "<failed to fetch remote>", err
 	}
@@ -649,41 +673,47 @@ func matchLastModified(ctx context.Context, lastModifiedPath, url string) (match
 	return false, lmCached, lmRemote, nil
 }
 
-func downloadHTTP(ctx context.Context, localPath, lastModified, contentType, url, description string, expectedDigest digest.Digest) error {
+// downloadHTTP downloads url into localPath, with parallel range requests when the server supports them
+// and the file is large enough.
+// When resume is true, a partially downloaded file is kept on failure, and is resumed by the next call.
+// Returns the number of the bytes transferred.
+func downloadHTTP(ctx context.Context, localPath, lastModified, contentType, url, description string, expectedDigest digest.Digest, resume bool) (int64, error) {
 	if localPath == "" {
-		return errors.New("downloadHTTP: got empty localPath")
+		return 0, errors.New("downloadHTTP: got empty localPath")
+	}
+	if info, err := probeRemote(ctx, url); err != nil {
+		logrus.WithError(err).Debugf("failed to probe %q, downloading without range requests", url)
+	} else if info.acceptRanges && info.size >= minChunkedSize {
+		return downloadChunked(ctx, localPath, lastModified, contentType, url, description, expectedDigest, info, resume)
 	}
 	logrus.Debugf("downloading %q into %q", url, localPath)
 
-	resp, err := httpclientutil.Get(ctx, http.DefaultClient, url)
+	resp, err := httpclientutil.Get(ctx, credentials.Client, url)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if lastModified != "" {
 		lm := resp.Header.Get("Last-Modified")
 		if err := os.WriteFile(lastModified, []byte(lm), 0o644); err != nil {
-			return err
+			return 0, err
 		}
 	}
 	if contentType != "" {
 		ct := resp.Header.Get("Content-Type")
 		if err := os.WriteFile(contentType, []byte(ct), 0o644); err != nil {
-			return err
+			return 0, err
 		}
 	}
 	defer resp.Body.Close()
-	bar, err := progressbar.New(resp.ContentLength)
-	if err != nil {
-		return err
-	}
-	if HideProgress {
-		hideBar(bar)
+	if description == "" {
+		description = url
 	}
+	bar := progress.New("Downloading "+description, resp.ContentLength)
 
 	localPathTmp := perProcessTempfile(localPath)
 	fileWriter, err := os.Create(localPathTmp)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer fileWriter.Close()
 	defer os.RemoveAll(localPathTmp)
@@ -693,7 +723,7 @@ func downloadHTTP(ctx context.Context, localPath, lastModified, contentType, url
 	if expectedDigest != "" {
 		algo := expectedDigest.Algorithm()
 		if !algo.Available() {
-			return fmt.Errorf("unsupported digest algorithm %q", algo)
+			return 0, fmt.Errorf("unsupported digest algorithm %q", algo)
 		}
 		digester = algo.Digester()
 		hasher := digester.Hash()
@@ -701,34 +731,29 @@ func downloadHTTP(ctx context.Context, localPath, lastModified, contentType, url
 	}
 	multiWriter := io.MultiWriter(writers...)
 
-	if !HideProgress {
-		if description == "" {
-			description = url
-		}
-		// stderr corresponds to the progress bar output
-		fmt.Fprintf(os.Stderr, "Downloading %s\n", description)
-	}
 	bar.Start()
-	if _, err := io.Copy(multiWriter, bar.NewProxyReader(resp.Body)); err != nil {
-		return err
+	defer bar.Finish()
+	n, err := io.Copy(multiWriter, bar.NewProxyReader(limitReader(ctx, resp.Body)))
+	if err != nil {
+		return n, err
 	}
 	bar.Finish()
 
 	if digester != nil {
 		actualDigest := digester.Digest()
 		if actualDigest != expectedDigest {
-			return fmt.Errorf("expected digest %q, got %q", expectedDigest, actualDigest)
+			return n, fmt.Errorf("expected digest %q, got %q", expectedDigest, actualDigest)
 		}
 	}
 
 	if err := fileWriter.Sync(); err != nil {
-		return err
+		return n, err
 	}
 	if err := fileWriter.Close(); err != nil {
-		return err
+		return n, err
 	}
 
-	return os.Rename(localPathTmp, localPath)
+	return n, os.Rename(localPathTmp, localPath)
 }
 
 var tempfileCount atomic.Uint64
@@ -773,6 +798,57 @@ func CacheEntries(opts ...Opt) (map[string]string, error) {
 	return entries, nil
 }
 
+// CacheEntry is an entry of the download cache.
+type CacheEntry struct {
+	Key  string
+	Path string
+	// URL is empty for the entries without the "url" file, e.g., the entries being downloaded
+	URL  string
+	Size int64
+	// LastUsed is the time when the entry was downloaded or used lately.
+	// For the entries without the data (e.g., being downloaded), it is the time when the entry was created.
+	LastUsed time.Time
+}
+
+// InspectCacheEntry returns the information of the cache entry at path, as returned by CacheEntries.
+func InspectCacheEntry(key, path string) (*CacheEntry, error) {
+	entry := &CacheEntry{
+		Key:  key,
+		Path: path,
+		URL:  strings.TrimSpace(readFile(filepath.Join(path, "url"))),
+	}
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			entry.Size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(filepath.Join(path, "data"))
+	if errors.Is(err, os.ErrNotExist) {
+		st, err = os.Stat(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.LastUsed = st.ModTime()
+	return entry, nil
+}
+
+// markCacheUsed updates the modification time of the cached data, which is used as the last used time of the entry.
+// The time of the last modification on the remote is stored in the "time" file separately.
+func markCacheUsed(shad string) {
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(shad, "data"), now, now); err != nil {
+		logrus.WithError(err).Debugf("failed to update the modification time of %q", shad)
+	}
+}
+
 // CacheKey returns the key for a cache entry of the remote URL.
 func CacheKey(remote string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(remote)))
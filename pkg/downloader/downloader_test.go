@@ -1,7 +1,10 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -9,15 +12,17 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/opencontainers/go-digest"
 	"gotest.tools/v3/assert"
 )
 
 func TestMain(m *testing.M) {
-	HideProgress = true
+	_ = progress.SetMode(progress.ModeQuiet)
 	m.Run()
 }
 
@@ -141,6 +146,24 @@ func TestDownloadRemote(t *testing.T) {
 			assert.Equal(t, cached, parallelDownloads-1)
 		})
 	})
+	t.Run("shared cache", func(t *testing.T) {
+		sharedCacheDir := filepath.Join(t.TempDir(), "shared")
+		r, err := Download(context.Background(), "", dummyRemoteFileURL, WithExpectedDigest(dummyRemoteFileDigest),
+			WithCacheDir(sharedCacheDir))
+		assert.NilError(t, err)
+		assert.Equal(t, StatusDownloaded, r.Status)
+
+		cacheDir := filepath.Join(t.TempDir(), "cache")
+		localPath := filepath.Join(t.TempDir(), t.Name())
+		r, err = Download(context.Background(), localPath, dummyRemoteFileURL, WithExpectedDigest(dummyRemoteFileDigest),
+			WithCacheDir(cacheDir), WithSharedCacheDir(sharedCacheDir))
+		assert.NilError(t, err)
+		assert.Equal(t, StatusUsedCache, r.Status)
+		assert.Assert(t, strings.HasPrefix(r.CachePath, sharedCacheDir), "expected %s to be in %s", r.CachePath, sharedCacheDir)
+		// the per-user cache is not populated
+		_, err = os.Stat(cacheDir)
+		assert.Assert(t, os.IsNotExist(err))
+	})
 	t.Run("cached", func(t *testing.T) {
 		_, err := Cached(dummyRemoteFileURL, WithExpectedDigest(dummyRemoteFileDigest))
 		assert.ErrorContains(t, err, "cache directory to be specified")
@@ -170,6 +193,31 @@ func TestDownloadRemote(t *testing.T) {
 		assert.Equal(t, dummyRemoteFileStat.ModTime().Truncate(time.Second).UTC(), r.LastModified)
 		assert.Equal(t, "text/plain; charset=utf-8", r.ContentType)
 	})
+	t.Run("cache entry", func(t *testing.T) {
+		cacheDir := filepath.Join(t.TempDir(), "cache")
+		r, err := Download(context.Background(), "", dummyRemoteFileURL, WithExpectedDigest(dummyRemoteFileDigest), WithCacheDir(cacheDir))
+		assert.NilError(t, err)
+		assert.Equal(t, StatusDownloaded, r.Status)
+		old := time.Now().Add(-48 * time.Hour)
+		assert.NilError(t, os.Chtimes(r.CachePath, old, old))
+
+		entries, err := CacheEntries(WithCacheDir(cacheDir))
+		assert.NilError(t, err)
+		key := CacheKey(dummyRemoteFileURL)
+		entry, err := InspectCacheEntry(key, entries[key])
+		assert.NilError(t, err)
+		assert.Equal(t, dummyRemoteFileURL, entry.URL)
+		assert.Assert(t, entry.Size >= dummyRemoteFileStat.Size())
+		assert.Assert(t, entry.LastUsed.Before(time.Now().Add(-time.Hour)))
+
+		// using the cache updates the last used time
+		r, err = Download(context.Background(), "", dummyRemoteFileURL, WithExpectedDigest(dummyRemoteFileDigest), WithCacheDir(cacheDir))
+		assert.NilError(t, err)
+		assert.Equal(t, StatusUsedCache, r.Status)
+		entry, err = InspectCacheEntry(key, entries[key])
+		assert.NilError(t, err)
+		assert.Assert(t, entry.LastUsed.After(time.Now().Add(-time.Hour)))
+	})
 }
 
 func countResults(t *testing.T, results chan downloadResult) (downloaded, cached int) {
@@ -360,3 +408,93 @@ func TestDownloadCompressed(t *testing.T) {
 		assert.Equal(t, string(got), string(testDownloadCompressedContents))
 	})
 }
+
+func TestDownloadChunked(t *testing.T) {
+	origMinChunkedSize, origChunkSize, origChunkRetryInterval := minChunkedSize, chunkSize, chunkRetryInterval
+	minChunkedSize, chunkSize, chunkRetryInterval = 1024, 1000, time.Millisecond
+	t.Cleanup(func() {
+		minChunkedSize, chunkSize, chunkRetryInterval = origMinChunkedSize, origChunkSize, origChunkRetryInterval
+	})
+
+	content := make([]byte, 10*1000+123)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	dgst := digest.SHA256.FromBytes(content)
+	modTime := time.Now().Add(-time.Hour)
+	var (
+		failFrom int64 // the ranges starting from failFrom fail, unless 0
+		served   int64
+		mu       sync.Mutex
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		start, end := int64(0), int64(len(content)-1)
+		if rng := r.Header.Get("Range"); rng != "" {
+			_, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			assert.Check(t, err)
+			if failFrom > 0 && start >= failFrom {
+				http.Error(w, "injected failure", http.StatusInternalServerError)
+				return
+			}
+		}
+		if r.Method == http.MethodGet {
+			served += end - start + 1
+		}
+		http.ServeContent(w, r, "image", modTime, bytes.NewReader(content))
+	}))
+	t.Cleanup(ts.Close)
+	remote := ts.URL + "/image"
+	cacheDir := t.TempDir()
+	opts := []Opt{WithCacheDir(cacheDir), WithExpectedDigest(dgst)}
+
+	// the download fails in the middle, and the completed chunks are kept
+	failFrom = 5000
+	_, err := Download(context.Background(), filepath.Join(t.TempDir(), "1"), remote, opts...)
+	assert.ErrorContains(t, err, "injected failure")
+	state, err := loadPartialState(filepath.Join(cacheDirectoryPath(cacheDir, remote), "data.partial.json"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, state.Done[:5], []bool{true, true, true, true, true})
+	assert.Equal(t, state.Done[5], false)
+
+	// the download is resumed
+	failFrom = 0
+	served = 0
+	localPath := filepath.Join(t.TempDir(), "2")
+	r, err := Download(context.Background(), localPath, remote, opts...)
+	assert.NilError(t, err)
+	assert.Equal(t, r.Status, StatusDownloaded)
+	assert.Assert(t, served < int64(len(content)), "served %d bytes, expected less than %d bytes", served, len(content))
+	b, err := os.ReadFile(localPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, b, content)
+	_, err = os.Stat(filepath.Join(cacheDirectoryPath(cacheDir, remote), "data.partial.json"))
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	// the host has succeeded lately
+	scores, err := MirrorScores([]string{remote, "https://example.com/image", "/local/image"}, WithCacheDir(cacheDir))
+	assert.NilError(t, err)
+	assert.Assert(t, scores[0] > 0)
+	assert.Equal(t, scores[1], float64(0))
+	assert.Equal(t, scores[2], float64(0))
+}
+
+func TestMirrorScore(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, MirrorStats{BytesPerSec: 100}.Score(now), float64(100))
+	assert.Equal(t, MirrorStats{BytesPerSec: 100, LastFailure: now.Add(-time.Minute)}.Score(now), float64(-1))
+	assert.Equal(t, MirrorStats{BytesPerSec: 100, LastFailure: now.Add(-2 * time.Hour)}.Score(now), float64(100))
+
+	cacheDir := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(cacheDir, "download"), 0o755))
+	recordMirror(cacheDir, "https://fast.example.com/a", 2000, time.Second, nil)
+	recordMirror(cacheDir, "https://slow.example.com/a", 1000, time.Second, nil)
+	recordMirror(cacheDir, "https://broken.example.com/a", 0, time.Second, errors.New("connection refused"))
+	recordMirror(cacheDir, "https://canceled.example.com/a", 0, time.Second, context.Canceled)
+	scores, err := MirrorScores([]string{
+		"https://fast.example.com/b", "https://slow.example.com/b", "https://broken.example.com/b", "https://canceled.example.com/b",
+	}, WithCacheDir(cacheDir))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scores, []float64{2000, 1000, -1, 0})
+}
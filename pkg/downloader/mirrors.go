@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/sirupsen/logrus"
+)
+
+// mirrorFailurePenalty is the duration for which a host is ranked last after a failed download.
+const mirrorFailurePenalty = time.Hour
+
+// MirrorStats is the statistics of the downloads from a host,
+// stored in "download/mirrors.json" of the cache dir.
+type MirrorStats struct {
+	Successes int `json:"successes"`
+	Failures  int `json:"failures"`
+	// BytesPerSec is the exponential moving average of the throughput of the successful downloads
+	BytesPerSec float64   `json:"bytesPerSec"`
+	LastFailure time.Time `json:"lastFailure,omitempty"`
+}
+
+// Score returns the score of the host: -1 if a download from the host failed within the last hour,
+// otherwise the throughput in bytes per second (0 if unknown).
+func (s MirrorStats) Score(now time.Time) float64 {
+	if !s.LastFailure.IsZero() && now.Sub(s.LastFailure) < mirrorFailurePenalty {
+		return -1
+	}
+	return s.BytesPerSec
+}
+
+func mirrorStatsPath(cacheDir string) string {
+	return filepath.Join(cacheDir, "download", "mirrors.json")
+}
+
+func mirrorHost(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func loadMirrorStats(cacheDir string) (map[string]MirrorStats, error) {
+	stats := make(map[string]MirrorStats)
+	b, err := os.ReadFile(mirrorStatsPath(cacheDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// recordMirror records the result of a download from remote, for MirrorScores.
+// transferred is the number of the bytes transferred in elapsed, excluding the resumed part.
+func recordMirror(cacheDir, remote string, transferred int64, elapsed time.Duration, downloadErr error) {
+	host := mirrorHost(remote)
+	if cacheDir == "" || host == "" || errors.Is(downloadErr, context.Canceled) {
+		return
+	}
+	dir := filepath.Dir(mirrorStatsPath(cacheDir))
+	err := lockutil.WithDirLock(dir, func() error {
+		stats, err := loadMirrorStats(cacheDir)
+		if err != nil {
+			logrus.WithError(err).Debug("discarding the broken mirror statistics")
+			stats = make(map[string]MirrorStats)
+		}
+		s := stats[host]
+		if downloadErr != nil {
+			s.Failures++
+			s.LastFailure = time.Now()
+		} else {
+			s.Successes++
+			s.LastFailure = time.Time{}
+			if elapsed > 0 && transferred > 0 {
+				bps := float64(transferred) / elapsed.Seconds()
+				if s.BytesPerSec == 0 {
+					s.BytesPerSec = bps
+				} else {
+					s.BytesPerSec = 0.7*s.BytesPerSec + 0.3*bps
+				}
+			}
+		}
+		stats[host] = s
+		b, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		tmp := mirrorStatsPath(cacheDir) + ".tmp"
+		if err := os.WriteFile(tmp, b, 0o644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, mirrorStatsPath(cacheDir))
+	})
+	if err != nil {
+		logrus.WithError(err).Debugf("failed to record the mirror statistics of %q", host)
+	}
+}
+
+// MirrorScores returns the scores (see MirrorStats.Score) of the hosts of the remote URLs,
+// from the statistics of the past downloads in the cache dir.
+// The score is 0 for the local files, and for the hosts without statistics.
+func MirrorScores(remotes []string, opts ...Opt) ([]float64, error) {
+	var o options
+	if err := o.apply(opts); err != nil {
+		return nil, err
+	}
+	scores := make([]float64, len(remotes))
+	if o.cacheDir == "" {
+		return scores, nil
+	}
+	stats, err := loadMirrorStats(o.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i, remote := range remotes {
+		if IsLocal(remote) {
+			continue
+		}
+		if s, ok := stats[mirrorHost(remote)]; ok {
+			scores[i] = s.Score(now)
+		}
+	}
+	return scores, nil
+}
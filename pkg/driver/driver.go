@@ -30,6 +30,10 @@ type Driver interface {
 	// Start is used for booting the vm using driver instance
 	// It returns a chan error on successful boot
 	// The second argument may contain error occurred while starting driver
+	//
+	// The chan receives nil when the guest has shut down by itself, and a non-nil error
+	// when the driver has failed unexpectedly (e.g., the QEMU process has crashed).
+	// The host agent may call Start again after Stop, to apply `restartPolicy`.
 	Start(_ context.Context) (chan error, error)
 
 	// CanRunGUI returns bool to indicate if the hostagent need to run GUI synchronously
@@ -63,6 +67,31 @@ type Driver interface {
 
 	ListSnapshots(_ context.Context) (string, error)
 
+	// ChangeCPUs changes the number of the CPUs of the running vm instance.
+	ChangeCPUs(_ context.Context, cpus int) error
+
+	// ResizeDisk grows the disk (diffdisk) of the stopped vm instance to the size in bytes.
+	// ResizeDisk is a NOP if the disk has not been created yet.
+	ResizeDisk(_ context.Context, size int64) error
+
+	// DumpGuestMemory writes the memory of the running vm instance to path, as a kdump-compressed vmcore.
+	DumpGuestMemory(_ context.Context, path string) error
+
+	// Pause pauses the vCPUs of the running vm instance, without saving the state to the disk.
+	Pause(_ context.Context) error
+
+	// Resume resumes the vm instance paused by Pause.
+	Resume(_ context.Context) error
+
+	// SaveState saves the whole state of the running vm instance to path, and terminates the vm.
+	// The state is restored by the next Start with BaseDriver.RestoreState set to path.
+	SaveState(_ context.Context, path string) error
+
+	// SnapshotDisk starts writing a crash-consistent copy of the disk of the running vm instance to dst.
+	// It returns once the point in time of the copy has been fixed, so that the guest can modify the disk again;
+	// wait blocks until the copy has been completed.
+	SnapshotDisk(_ context.Context, dst string) (wait func() error, err error)
+
 	// ForwardGuestAgent returns if the guest agent sock needs forwarding by host agent.
 	ForwardGuestAgent() bool
 
@@ -76,6 +105,10 @@ type BaseDriver struct {
 	SSHLocalPort int
 	VSockPort    int
 	VirtioPort   string
+
+	// RestoreState is the path of the state saved by SaveState.
+	// When set, Start restores the state instead of booting the vm.
+	RestoreState string
 }
 
 var _ Driver = (*BaseDriver)(nil)
@@ -140,6 +173,34 @@ func (d *BaseDriver) ListSnapshots(_ context.Context) (string, error) {
 	return "", errors.New("unimplemented")
 }
 
+func (d *BaseDriver) ChangeCPUs(_ context.Context, _ int) error {
+	return errors.New("unimplemented")
+}
+
+func (d *BaseDriver) ResizeDisk(_ context.Context, _ int64) error {
+	return errors.New("unimplemented")
+}
+
+func (d *BaseDriver) DumpGuestMemory(_ context.Context, _ string) error {
+	return errors.New("unimplemented")
+}
+
+func (d *BaseDriver) Pause(_ context.Context) error {
+	return errors.New("unimplemented")
+}
+
+func (d *BaseDriver) Resume(_ context.Context) error {
+	return errors.New("unimplemented")
+}
+
+func (d *BaseDriver) SaveState(_ context.Context, _ string) error {
+	return errors.New("unimplemented")
+}
+
+func (d *BaseDriver) SnapshotDisk(_ context.Context, _ string) (func() error, error) {
+	return nil, errors.New("unimplemented")
+}
+
 func (d *BaseDriver) ForwardGuestAgent() bool {
 	// if driver is not providing, use host agent
 	return d.VSockPort == 0 && d.VirtioPort == ""
@@ -0,0 +1,3 @@
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mount.proto --descriptor_set_out=mount.pb.desc
+
+package external
@@ -0,0 +1,163 @@
+// Package external implements the external mount drivers.
+//
+// An external mount driver is an executable named "lima-mount-NAME" in $PATH, used for `mountType: NAME`
+// when NAME is not a builtin mount type. e.g., "lima-mount-smb" for `mountType: smb`.
+//
+// The host agent starts the driver as `lima-mount-NAME --socket SOCKET` during the startup,
+// and calls the MountDriver gRPC service on the UNIX socket for each of the `mounts`.
+// The scripts returned by Mount are executed in the guest over SSH.
+// The driver is terminated with SIGINT (or killed on Windows) after Unmount is called for all the mounts.
+//
+// The drivers written in Go may use Serve to implement the service.
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// SocketFlag is the flag for the path of the socket, passed to the driver.
+const SocketFlag = "--socket"
+
+const (
+	// startTimeout is the timeout for the driver to create the socket.
+	startTimeout = 30 * time.Second
+	// stopTimeout is the timeout for the driver to exit on SIGINT.
+	stopTimeout = 10 * time.Second
+)
+
+// LookMountDriver returns the path of the external mount driver for the mount type.
+func LookMountDriver(mountType limayaml.MountType) (string, error) {
+	if !limayaml.IsExternalMountType(mountType) {
+		return "", fmt.Errorf("mount type %q is not an external mount type", mountType)
+	}
+	return exec.LookPath(limayaml.ExternalMountDriverPrefix + mountType)
+}
+
+// MountDriverProcess is a running external mount driver.
+type MountDriverProcess struct {
+	MountDriverClient
+	Info *MountDriverInfo
+
+	cmd    *exec.Cmd
+	conn   *grpc.ClientConn
+	waitCh chan error
+}
+
+// StartMountDriver starts the external mount driver for the mount type, with the socket in instDir.
+func StartMountDriver(ctx context.Context, mountType limayaml.MountType, instDir string) (*MountDriverProcess, error) {
+	exe, err := LookMountDriver(mountType)
+	if err != nil {
+		return nil, err
+	}
+	sock := filepath.Join(instDir, filenames.MountDriverSock)
+	if err := os.RemoveAll(sock); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, SocketFlag, sock)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	logrus.Infof("Starting the external mount driver %q", exe)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the external mount driver %q: %w", exe, err)
+	}
+	p := &MountDriverProcess{cmd: cmd, waitCh: make(chan error, 1)}
+	go func() {
+		p.waitCh <- cmd.Wait()
+		close(p.waitCh)
+	}()
+	if err := p.waitSocket(ctx, sock); err != nil {
+		_ = p.kill()
+		return nil, fmt.Errorf("external mount driver %q: %w", exe, err)
+	}
+	p.conn, err = grpc.NewClient("unix://"+sock, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		_ = p.kill()
+		return nil, err
+	}
+	p.MountDriverClient = NewMountDriverClient(p.conn)
+	p.Info, err = p.GetInfo(ctx, &emptypb.Empty{})
+	if err != nil {
+		_ = p.Close()
+		return nil, fmt.Errorf("failed to get the info of the external mount driver %q: %w", exe, err)
+	}
+	logrus.Infof("External mount driver %q (version %q) is running", p.Info.Name, p.Info.Version)
+	return p, nil
+}
+
+func (p *MountDriverProcess) waitSocket(ctx context.Context, sock string) error {
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(sock); err == nil {
+			return nil
+		}
+		select {
+		case err := <-p.waitCh:
+			return fmt.Errorf("exited before creating the socket %q: %v", sock, err)
+		case <-ctx.Done():
+			return fmt.Errorf("the socket %q was not created: %w", sock, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the connection, and stops the driver.
+func (p *MountDriverProcess) Close() error {
+	var errs []error
+	if p.conn != nil {
+		if err := p.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := p.cmd.Process.Signal(os.Interrupt); err != nil {
+		// os.Interrupt is not implemented on Windows
+		return errors.Join(append(errs, p.kill())...)
+	}
+	select {
+	case <-p.waitCh:
+	case <-time.After(stopTimeout):
+		logrus.Warnf("External mount driver did not exit in %v, killing it", stopTimeout)
+		errs = append(errs, p.kill())
+	}
+	return errors.Join(errs...)
+}
+
+func (p *MountDriverProcess) kill() error {
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-p.waitCh
+	return nil
+}
+
+// Serve serves the MountDriver service on the socket until ctx is cancelled.
+// The socket is the value of the "--socket" flag.
+func Serve(ctx context.Context, sock string, srv MountDriverServer) error {
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	RegisterMountDriverServer(server, srv)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	return server.Serve(l)
+}
@@ -0,0 +1,184 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v5.27.1
+// source: mount.proto
+
+package external
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// MountDriverClient is the client API for MountDriver service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MountDriverClient interface {
+	GetInfo(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*MountDriverInfo, error)
+	// Mount prepares the host side of a mount, e.g., exports the directory,
+	// and returns the scripts for mounting and unmounting it in the guest.
+	Mount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*MountResponse, error)
+	// Unmount releases the host side of a mount.
+	Unmount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type mountDriverClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMountDriverClient(cc grpc.ClientConnInterface) MountDriverClient {
+	return &mountDriverClient{cc}
+}
+
+func (c *mountDriverClient) GetInfo(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*MountDriverInfo, error) {
+	out := new(MountDriverInfo)
+	err := c.cc.Invoke(ctx, "/MountDriver/GetInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mountDriverClient) Mount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*MountResponse, error) {
+	out := new(MountResponse)
+	err := c.cc.Invoke(ctx, "/MountDriver/Mount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mountDriverClient) Unmount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/MountDriver/Unmount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MountDriverServer is the server API for MountDriver service.
+// All implementations must embed UnimplementedMountDriverServer
+// for forward compatibility
+type MountDriverServer interface {
+	GetInfo(context.Context, *emptypb.Empty) (*MountDriverInfo, error)
+	// Mount prepares the host side of a mount, e.g., exports the directory,
+	// and returns the scripts for mounting and unmounting it in the guest.
+	Mount(context.Context, *MountRequest) (*MountResponse, error)
+	// Unmount releases the host side of a mount.
+	Unmount(context.Context, *MountRequest) (*emptypb.Empty, error)
+	mustEmbedUnimplementedMountDriverServer()
+}
+
+// UnimplementedMountDriverServer must be embedded to have forward compatible implementations.
+type UnimplementedMountDriverServer struct {
+}
+
+func (UnimplementedMountDriverServer) GetInfo(context.Context, *emptypb.Empty) (*MountDriverInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInfo not implemented")
+}
+func (UnimplementedMountDriverServer) Mount(context.Context, *MountRequest) (*MountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Mount not implemented")
+}
+func (UnimplementedMountDriverServer) Unmount(context.Context, *MountRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unmount not implemented")
+}
+func (UnimplementedMountDriverServer) mustEmbedUnimplementedMountDriverServer() {}
+
+// UnsafeMountDriverServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MountDriverServer will
+// result in compilation errors.
+type UnsafeMountDriverServer interface {
+	mustEmbedUnimplementedMountDriverServer()
+}
+
+func RegisterMountDriverServer(s grpc.ServiceRegistrar, srv MountDriverServer) {
+	s.RegisterService(&MountDriver_ServiceDesc, srv)
+}
+
+func _MountDriver_GetInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MountDriverServer).GetInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/MountDriver/GetInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MountDriverServer).GetInfo(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MountDriver_Mount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MountDriverServer).Mount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/MountDriver/Mount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MountDriverServer).Mount(ctx, req.(*MountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MountDriver_Unmount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MountDriverServer).Unmount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/MountDriver/Unmount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MountDriverServer).Unmount(ctx, req.(*MountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MountDriver_ServiceDesc is the grpc.ServiceDesc for MountDriver service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MountDriver_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "MountDriver",
+	HandlerType: (*MountDriverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetInfo",
+			Handler:    _MountDriver_GetInfo_Handler,
+		},
+		{
+			MethodName: "Mount",
+			Handler:    _MountDriver_Mount_Handler,
+		},
+		{
+			MethodName: "Unmount",
+			Handler:    _MountDriver_Unmount_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "mount.proto",
+}
@@ -0,0 +1,102 @@
+package external
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gotest.tools/v3/assert"
+)
+
+type testMountDriver struct {
+	UnimplementedMountDriverServer
+	unmounted []string
+}
+
+func (d *testMountDriver) GetInfo(context.Context, *emptypb.Empty) (*MountDriverInfo, error) {
+	return &MountDriverInfo{Name: "test", Version: "0.1.0"}, nil
+}
+
+func (d *testMountDriver) Mount(_ context.Context, req *MountRequest) (*MountResponse, error) {
+	return &MountResponse{
+		GuestScript: "mount -t nfs " + req.HostAddress + ":" + req.Location + " " + req.MountPoint,
+	}, nil
+}
+
+func (d *testMountDriver) Unmount(_ context.Context, req *MountRequest) (*emptypb.Empty, error) {
+	d.unmounted = append(d.unmounted, req.Location)
+	return &emptypb.Empty{}, nil
+}
+
+func TestServe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("UNIX sockets are not tested on Windows")
+	}
+	sock := filepath.Join(t.TempDir(), "mount.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	drv := &testMountDriver{}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, sock, drv)
+	}()
+	assert.NilError(t, waitFile(sock))
+
+	conn, err := grpc.NewClient("unix://"+sock, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	defer conn.Close()
+	client := NewMountDriverClient(conn)
+
+	info, err := client.GetInfo(ctx, &emptypb.Empty{})
+	assert.NilError(t, err)
+	assert.Equal(t, info.Name, "test")
+
+	req := &MountRequest{Location: "/Users/foo", MountPoint: "/mnt/foo", HostAddress: "192.168.5.2"}
+	res, err := client.Mount(ctx, req)
+	assert.NilError(t, err)
+	assert.Equal(t, res.GuestScript, "mount -t nfs 192.168.5.2:/Users/foo /mnt/foo")
+	assert.Equal(t, res.GuestUnmountScript, "")
+
+	_, err = client.Unmount(ctx, req)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, drv.unmounted, []string{"/Users/foo"})
+
+	cancel()
+	assert.NilError(t, <-errCh)
+}
+
+func TestLookMountDriver(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test driver is a shell script")
+	}
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "lima-mount-smb")
+	assert.NilError(t, os.WriteFile(exe, []byte("#!/bin/sh\n"), 0o755))
+	t.Setenv("PATH", dir)
+
+	got, err := LookMountDriver("smb")
+	assert.NilError(t, err)
+	assert.Equal(t, got, exe)
+
+	_, err = LookMountDriver("webdav")
+	assert.ErrorContains(t, err, "lima-mount-webdav")
+
+	_, err = LookMountDriver("virtiofs")
+	assert.ErrorContains(t, err, "not an external mount type")
+}
+
+func waitFile(path string) error {
+	var err error
+	for range 50 {
+		if _, err = os.Stat(path); err == nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package driverutil
+
+import (
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/qemu"
+	"github.com/lima-vm/lima/pkg/vz"
+	"github.com/lima-vm/lima/pkg/wsl2"
+)
+
+func init() {
+	limayaml.RegisterDriverCapabilities(limayaml.QEMU, qemu.Capabilities())
+	limayaml.RegisterDriverCapabilities(limayaml.VZ, vz.Capabilities())
+	limayaml.RegisterDriverCapabilities(limayaml.WSL2, wsl2.Capabilities())
+}
+
+// Capabilities returns the capability manifests of the available drivers.
+func Capabilities() map[string]limayaml.DriverCapabilities {
+	res := make(map[string]limayaml.DriverCapabilities)
+	for _, d := range Drivers() {
+		if caps, ok := limayaml.LookupDriverCapabilities(d); ok {
+			res[d] = caps
+		}
+	}
+	return res
+}
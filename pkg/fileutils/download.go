@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"sort"
 
 	"github.com/lima-vm/lima/pkg/downloader"
 	"github.com/lima-vm/lima/pkg/limayaml"
@@ -21,6 +22,9 @@ func DownloadFile(ctx context.Context, dest string, f limayaml.File, decompress
 	}
 	fields := logrus.Fields{"location": f.Location, "arch": f.Arch, "digest": f.Digest}
 	logrus.WithFields(fields).Infof("Attempting to download %s", description)
+	if IsOCI(f.Location) {
+		return downloadOCI(ctx, dest, f, decompress, description, expectedArch)
+	}
 	res, err := downloader.Download(ctx, dest, f.Location,
 		downloader.WithCache(),
 		downloader.WithDecompress(decompress),
@@ -44,6 +48,9 @@ func DownloadFile(ctx context.Context, dest string, f limayaml.File, decompress
 
 // CachedFile checks if a file is in the cache, validating the digest if it is available. Returns path in cache.
 func CachedFile(f limayaml.File) (string, error) {
+	if IsOCI(f.Location) {
+		return cachedOCIFile(f)
+	}
 	res, err := downloader.Cached(f.Location,
 		downloader.WithCache(),
 		downloader.WithExpectedDigest(f.Digest))
@@ -70,3 +77,52 @@ func Errors(errs []error) error {
 	}
 	return finalErr
 }
+
+// ImagesByMirrorScore returns the images reordered by FilesByMirrorScore.
+func ImagesByMirrorScore(images []limayaml.Image) []limayaml.Image {
+	return byMirrorScore(images, func(img limayaml.Image) limayaml.File { return img.File })
+}
+
+// FilesByMirrorScore returns the files reordered so that the mirrors of the same file, i.e., the files with the same digest,
+// are attempted in the descending order of the scores of their hosts (see downloader.MirrorScores).
+// The order of the files with different digests is kept, as they may have different contents.
+func FilesByMirrorScore(files []limayaml.File) []limayaml.File {
+	return byMirrorScore(files, func(f limayaml.File) limayaml.File { return f })
+}
+
+func byMirrorScore[T any](items []T, fileOf func(T) limayaml.File) []T {
+	locations := make([]string, len(items))
+	for i, item := range items {
+		locations[i] = fileOf(item).Location
+	}
+	scores, err := downloader.MirrorScores(locations, downloader.WithCache())
+	if err != nil {
+		logrus.WithError(err).Debug("failed to load the mirror scores")
+		return items
+	}
+	groups := make(map[string][]int)
+	for i, item := range items {
+		f := fileOf(item)
+		if f.Digest == "" {
+			continue
+		}
+		key := string(f.Arch) + "@" + f.Digest.String()
+		groups[key] = append(groups[key], i)
+	}
+	res := make([]T, len(items))
+	copy(res, items)
+	for _, positions := range groups {
+		if len(positions) < 2 {
+			continue
+		}
+		sorted := make([]int, len(positions))
+		copy(sorted, positions)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return scores[sorted[i]] > scores[sorted[j]]
+		})
+		for k, pos := range positions {
+			res[pos] = items[sorted[k]]
+		}
+	}
+	return res
+}
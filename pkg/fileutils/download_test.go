@@ -0,0 +1,45 @@
+package fileutils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestFilesByMirrorScore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the cache dir can be overridden with $XDG_CACHE_HOME only on Linux")
+	}
+	cacheHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+	t.Setenv("LIMA_SHARED_CACHE_DIR", "")
+	statsPath := filepath.Join(cacheHome, "lima", "download", "mirrors.json")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(statsPath), 0o755))
+	assert.NilError(t, os.WriteFile(statsPath, []byte(`{"slow.example.com":{"bytesPerSec":1000},"fast.example.com":{"bytesPerSec":2000}}`), 0o644))
+
+	const (
+		dgstA = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		dgstB = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	files := []limayaml.File{
+		{Location: "https://slow.example.com/a", Arch: limayaml.X8664, Digest: dgstA},
+		{Location: "https://other.example.com/b", Arch: limayaml.X8664, Digest: dgstB},
+		{Location: "https://fast.example.com/a", Arch: limayaml.X8664, Digest: dgstA},
+		{Location: "https://fast.example.com/c", Arch: limayaml.X8664},
+	}
+	var locations []string
+	for _, f := range FilesByMirrorScore(files) {
+		locations = append(locations, f.Location)
+	}
+	// only the mirrors of dgstA are swapped
+	assert.DeepEqual(t, locations, []string{
+		"https://fast.example.com/a",
+		"https://other.example.com/b",
+		"https://slow.example.com/a",
+		"https://fast.example.com/c",
+	})
+}
@@ -0,0 +1,294 @@
+package fileutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	dockerremote "github.com/containerd/containerd/remotes/docker"
+	"github.com/lima-vm/lima/pkg/credentials"
+	"github.com/lima-vm/lima/pkg/downloader"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/progress"
+	"github.com/lima-vm/lima/pkg/templatestore"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// OCIScheme is the scheme of the image locations that refer to OCI artifacts, e.g., "oci://ghcr.io/org/image:tag".
+const OCIScheme = "oci://"
+
+const manifestBytesLimit = 4 * 1024 * 1024 // 4MiB
+
+// IsOCI returns true if the location refers to an OCI artifact.
+func IsOCI(location string) bool {
+	return strings.HasPrefix(location, OCIScheme)
+}
+
+// downloadOCI pulls the disk image packaged as an OCI artifact, e.g., pushed with `oras push ghcr.io/org/image:tag image.qcow2`.
+// The artifact is expected to have the disk image as the single layer, or as the layer of DiskMediaType
+// (pushed with `limactl image push`); the largest layer is used otherwise.
+// An image index is resolved to the manifest for expectedArch.
+//
+// The layer is verified against its digest, and against f.Digest when specified.
+// The layer is cached by its digest, so the registry is only accessed to resolve the tag when the layer is in the cache.
+func downloadOCI(ctx context.Context, dest string, f limayaml.File, decompress bool, description string, expectedArch limayaml.Arch) (string, error) {
+	layer, fetcher, err := resolveOCILayer(ctx, strings.TrimPrefix(f.Location, OCIScheme), expectedArch)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w", f.Location, err)
+	}
+	if f.Digest != "" && f.Digest != layer.Digest {
+		return "", fmt.Errorf("failed to download %q: expected digest %q, got %q", f.Location, f.Digest, layer.Digest)
+	}
+	blobDir, err := ociBlobCacheDir(layer.Digest)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(blobDir, 0o700); err != nil {
+		return "", err
+	}
+	blob := filepath.Join(blobDir, "data")
+	err = lockutil.WithDirLock(blobDir, func() error {
+		if _, err := os.Stat(blob); err == nil {
+			logrus.Infof("Using cache %q", blob)
+			return nil
+		}
+		if err := fetchOCIBlob(ctx, fetcher, layer, blob, description); err != nil {
+			return fmt.Errorf("failed to download %q: %w", f.Location, err)
+		}
+		logrus.Infof("Downloaded %s from %q", description, f.Location)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if dest == "" {
+		// caching-only mode
+		return blob, nil
+	}
+	// no need to pass the digest, as the blob was verified on downloading
+	if _, err := downloader.Download(ctx, dest, blob, downloader.WithDecompress(decompress)); err != nil {
+		return "", err
+	}
+	return blob, nil
+}
+
+// cachedOCIFile returns the cached layer of the OCI artifact, which can only be looked up by f.Digest.
+func cachedOCIFile(f limayaml.File) (string, error) {
+	if f.Digest == "" {
+		return "", fmt.Errorf("cache did not contain %q: the digest of the layer has to be specified to look up the cache", f.Location)
+	}
+	blobDir, err := ociBlobCacheDir(f.Digest)
+	if err != nil {
+		return "", err
+	}
+	blob := filepath.Join(blobDir, "data")
+	if _, err := os.Stat(blob); err != nil {
+		return "", fmt.Errorf("cache did not contain %q: %w", f.Location, err)
+	}
+	return blob, nil
+}
+
+// ociBlobCacheDir returns "<CACHE>/lima/download/by-oci-digest/<ALGORITHM>/<ENCODED>".
+func ociBlobCacheDir(dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", err
+	}
+	ucd, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(ucd, "lima", "download", "by-oci-digest", dgst.Algorithm().String(), dgst.Encoded()), nil
+}
+
+func newOCIResolver() remotes.Resolver {
+	authorizer := dockerremote.NewDockerAuthorizer(dockerremote.WithAuthCreds(registryCredentials))
+	return dockerremote.NewResolver(dockerremote.ResolverOptions{
+		Hosts: dockerremote.ConfigureDefaultRegistries(
+			dockerremote.WithAuthorizer(authorizer),
+			dockerremote.WithPlainHTTP(dockerremote.MatchLocalhost),
+		),
+	})
+}
+
+// resolveOCILayer resolves the reference to the layer that contains the disk image.
+func resolveOCILayer(ctx context.Context, ref string, expectedArch limayaml.Arch) (*ocispec.Descriptor, remotes.Fetcher, error) {
+	manifest, fetcher, err := resolveOCIManifest(ctx, ref, expectedArch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, nil, errors.New("the artifact has no layer")
+	}
+	layer := manifest.Layers[0]
+	for _, l := range manifest.Layers[1:] {
+		if layer.MediaType == DiskMediaType {
+			break
+		}
+		if l.MediaType == DiskMediaType || l.Size > layer.Size {
+			layer = l
+		}
+	}
+	return &layer, fetcher, nil
+}
+
+// ReadOCITemplate reads the template from the layer of templatestore.TemplateMediaType of the OCI artifact,
+// e.g., "oci://ghcr.io/org/image:tag" pushed with `limactl image push`.
+func ReadOCITemplate(ctx context.Context, location string) ([]byte, error) {
+	manifest, fetcher, err := resolveOCIManifest(ctx, strings.TrimPrefix(location, OCIScheme), limayaml.NewArch(runtime.GOARCH))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", location, err)
+	}
+	for _, l := range manifest.Layers {
+		if l.MediaType == templatestore.TemplateMediaType {
+			// The template is as small as a manifest
+			return fetchOCIManifest(ctx, fetcher, l)
+		}
+	}
+	return nil, fmt.Errorf("%q has no layer of %q", location, templatestore.TemplateMediaType)
+}
+
+// resolveOCIManifest resolves the reference to the manifest. An image index is resolved to the manifest for expectedArch.
+func resolveOCIManifest(ctx context.Context, ref string, expectedArch limayaml.Arch) (*ocispec.Manifest, remotes.Fetcher, error) {
+	named, err := docker.ParseDockerRef(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolver := newOCIResolver()
+	name, desc, err := resolver.Resolve(ctx, named.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := fetchOCIManifest(ctx, fetcher, desc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if images.IsIndexType(desc.MediaType) {
+		var index ocispec.Index
+		if err := json.Unmarshal(b, &index); err != nil {
+			return nil, nil, err
+		}
+		manifestDesc, err := manifestForArch(index.Manifests, expectedArch)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b, err = fetchOCIManifest(ctx, fetcher, *manifestDesc); err != nil {
+			return nil, nil, err
+		}
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, nil, err
+	}
+	return &manifest, fetcher, nil
+}
+
+// ociArchs maps the architectures of Lima to the architectures of OCI.
+var ociArchs = map[limayaml.Arch]string{
+	limayaml.X8664:       "amd64",
+	limayaml.AARCH64:     "arm64",
+	limayaml.ARMV6L:      "arm",
+	limayaml.ARMV7L:      "arm",
+	limayaml.RISCV64:     "riscv64",
+	limayaml.LOONGARCH64: "loong64",
+}
+
+// ociVariants maps the architectures of Lima to the variants of OCI, when the OCI architecture is ambiguous.
+var ociVariants = map[limayaml.Arch]string{
+	limayaml.ARMV6L: "v6",
+	limayaml.ARMV7L: "v7",
+}
+
+func manifestForArch(manifests []ocispec.Descriptor, arch limayaml.Arch) (*ocispec.Descriptor, error) {
+	for _, m := range manifests {
+		if m.Platform == nil || m.Platform.Architecture != ociArchs[arch] {
+			continue
+		}
+		if m.Platform.Variant != "" && ociVariants[arch] != "" && m.Platform.Variant != ociVariants[arch] {
+			continue
+		}
+		return &m, nil
+	}
+	if len(manifests) == 1 && manifests[0].Platform == nil {
+		return &manifests[0], nil
+	}
+	return nil, fmt.Errorf("the image index has no manifest for arch %q", arch)
+}
+
+func fetchOCIManifest(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) ([]byte, error) {
+	if desc.Size > manifestBytesLimit {
+		return nil, fmt.Errorf("the manifest %q is too large (%d bytes)", desc.Digest, desc.Size)
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, manifestBytesLimit))
+	if err != nil {
+		return nil, err
+	}
+	if actual := desc.Digest.Algorithm().FromBytes(b); actual != desc.Digest {
+		return nil, fmt.Errorf("expected digest %q, got %q", desc.Digest, actual)
+	}
+	return b, nil
+}
+
+func fetchOCIBlob(ctx context.Context, fetcher remotes.Fetcher, desc *ocispec.Descriptor, dst, description string) error {
+	rc, err := fetcher.Fetch(ctx, *desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tmp := dst + ".tmp"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	defer w.Close()
+	bar := progress.New("Downloading "+description, desc.Size)
+	bar.Start()
+	defer bar.Finish()
+	digester := desc.Digest.Algorithm().Digester()
+	if _, err := io.Copy(io.MultiWriter(w, digester.Hash()), bar.NewProxyReader(rc)); err != nil {
+		return err
+	}
+	bar.Finish()
+	if actual := digester.Digest(); actual != desc.Digest {
+		return fmt.Errorf("expected digest %q, got %q", desc.Digest, actual)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// registryCredentials returns the credentials for the registry host, see credentials.LookupRegistry.
+// Empty credentials are returned for anonymous pulls.
+func registryCredentials(host string) (string, string, error) {
+	cred, err := credentials.LookupRegistry(context.Background(), host)
+	if err != nil || cred == nil {
+		return "", "", err
+	}
+	if cred.Username == "<token>" {
+		// Identity token, used as the refresh token by the authorizer
+		return "", cred.Secret, nil
+	}
+	return cred.Username, cred.Secret, nil
+}
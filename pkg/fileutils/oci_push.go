@@ -0,0 +1,177 @@
+package fileutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/lima-vm/lima/pkg/progress"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ImageArtifactType is the artifact type of the OCI artifacts pushed with `limactl image push`.
+	ImageArtifactType = "application/vnd.lima.image.v1"
+	// DiskMediaType is the media type of the layer that contains the disk image.
+	// When the artifact has a layer of this media type, the layer is pulled regardless of its size.
+	DiskMediaType = "application/vnd.lima.disk.v1"
+)
+
+// OCILayer is a file to be pushed as a layer of an OCI artifact.
+type OCILayer struct {
+	MediaType string
+	Path      string
+	// Digest is computed with ComputeDigest when empty.
+	Digest digest.Digest
+}
+
+// PushOCI pushes the files as the layers of an OCI artifact to ref, e.g., "ghcr.io/org/image:tag" (OCIScheme is optional).
+// The tag defaults to "latest", and ref must not contain a digest.
+// The blobs that already exist in the repository are skipped.
+//
+// The descriptors of the manifest and the layers are returned, so that the caller can pin them with digests.
+func PushOCI(ctx context.Context, ref string, layers []OCILayer) (*ocispec.Descriptor, []ocispec.Descriptor, error) {
+	named, err := docker.ParseDockerRef(strings.TrimPrefix(ref, OCIScheme))
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := named.(docker.Digested); ok {
+		return nil, nil, fmt.Errorf("cannot push to %q: the reference must not contain a digest", ref)
+	}
+	pusher, err := newOCIResolver().Pusher(ctx, named.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	descs := make([]ocispec.Descriptor, len(layers))
+	for i, l := range layers {
+		desc, err := fileDescriptor(l)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Suppress the "reference for unknown type" warning of containerd for the custom media types
+		ctx = remotes.WithMediaTypeKeyPrefix(ctx, desc.MediaType, "layer")
+		if err := pushOCIFile(ctx, pusher, desc, l.Path); err != nil {
+			return nil, nil, fmt.Errorf("failed to push %q to %q: %w", l.Path, named, err)
+		}
+		descs[i] = desc
+	}
+	config := ocispec.DescriptorEmptyJSON
+	ctx = remotes.WithMediaTypeKeyPrefix(ctx, config.MediaType, "config")
+	if err := pushOCIBlob(ctx, pusher, config, bytes.NewReader(config.Data), ""); err != nil {
+		return nil, nil, fmt.Errorf("failed to push the config to %q: %w", named, err)
+	}
+
+	manifest := ocispec.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: ImageArtifactType,
+		Config:       config,
+		Layers:       descs,
+		Annotations: map[string]string{
+			ocispec.AnnotationCreated: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifestDesc := ocispec.Descriptor{
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: ImageArtifactType,
+		Digest:       digest.FromBytes(b),
+		Size:         int64(len(b)),
+	}
+	if err := pushOCIBlob(ctx, pusher, manifestDesc, bytes.NewReader(b), ""); err != nil {
+		return nil, nil, fmt.Errorf("failed to push the manifest to %q: %w", named, err)
+	}
+	return &manifestDesc, descs, nil
+}
+
+// fileDescriptor computes the descriptor of the layer, with the file name as the title, as `oras push` does.
+func fileDescriptor(l OCILayer) (ocispec.Descriptor, error) {
+	st, err := os.Stat(l.Path)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	dgst := l.Digest
+	if dgst == "" {
+		if dgst, err = ComputeDigest(l.Path); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+	mediaType := l.MediaType
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	return ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      st.Size(),
+		Annotations: map[string]string{
+			ocispec.AnnotationTitle: filepath.Base(l.Path),
+		},
+	}, nil
+}
+
+// ComputeDigest computes the sha256 digest of the file, with a progress bar.
+func ComputeDigest(file string) (digest.Digest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	bar := progress.New("Computing the digest of "+filepath.Base(file), st.Size())
+	bar.Start()
+	defer bar.Finish()
+	return digest.SHA256.FromReader(bar.NewProxyReader(f))
+}
+
+func pushOCIFile(ctx context.Context, pusher remotes.Pusher, desc ocispec.Descriptor, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return pushOCIBlob(ctx, pusher, desc, f, "Pushing "+filepath.Base(file))
+}
+
+// pushOCIBlob pushes the blob, with a progress bar when description is not empty.
+func pushOCIBlob(ctx context.Context, pusher remotes.Pusher, desc ocispec.Descriptor, r io.Reader, description string) error {
+	w, err := pusher.Push(ctx, desc)
+	if err != nil {
+		if errors.Is(err, errdefs.ErrAlreadyExists) {
+			logrus.Debugf("Skipped pushing %q, as it already exists", desc.Digest)
+			return nil
+		}
+		return err
+	}
+	defer w.Close()
+	if description != "" {
+		bar := progress.New(description, desc.Size)
+		bar.Start()
+		defer bar.Finish()
+		r = bar.NewProxyReader(r)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Commit(ctx, desc.Size, desc.Digest)
+}
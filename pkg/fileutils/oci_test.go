@@ -0,0 +1,227 @@
+package fileutils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/progress"
+	"github.com/lima-vm/lima/pkg/templatestore"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"gotest.tools/v3/assert"
+)
+
+// newTestRegistry serves the blobs as "/v2/lima/image" with the tag "latest".
+func newTestRegistry(t *testing.T, manifest []byte, manifestMediaType string, blobs map[digest.Digest][]byte) *httptest.Server {
+	manifestDigest := digest.FromBytes(manifest)
+	blobs[manifestDigest] = manifest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b []byte
+		switch {
+		case r.URL.Path == "/v2/lima/image/manifests/latest":
+			b = manifest
+			w.Header().Set("Content-Type", manifestMediaType)
+			w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+		case strings.HasPrefix(r.URL.Path, "/v2/lima/image/manifests/"), strings.HasPrefix(r.URL.Path, "/v2/lima/image/blobs/"):
+			var ok bool
+			if b, ok = blobs[digest.Digest(filepath.Base(r.URL.Path))]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(b)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDownloadOCI(t *testing.T) {
+	assert.NilError(t, progress.SetMode(progress.ModeQuiet))
+	t.Cleanup(func() { _ = progress.SetMode(progress.ModeAuto) })
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	disk := []byte("disk image")
+	diskDigest := digest.FromBytes(disk)
+	readme := []byte("readme")
+	manifest, err := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.DescriptorEmptyJSON,
+		Layers: []ocispec.Descriptor{
+			{MediaType: "text/plain", Digest: digest.FromBytes(readme), Size: int64(len(readme))},
+			{MediaType: "application/octet-stream", Digest: diskDigest, Size: int64(len(disk))},
+		},
+	})
+	assert.NilError(t, err)
+	index, err := json.Marshal(ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{
+			{
+				MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromBytes(manifest), Size: int64(len(manifest)),
+				Platform: &ocispec.Platform{OS: "linux", Architecture: "arm64"},
+			},
+		},
+	})
+	assert.NilError(t, err)
+	srv := newTestRegistry(t, index, ocispec.MediaTypeImageIndex, map[digest.Digest][]byte{
+		digest.FromBytes(manifest): manifest,
+		digest.FromBytes(readme):   readme,
+		diskDigest:                 disk,
+	})
+	location := "oci://" + strings.TrimPrefix(srv.URL, "http://") + "/lima/image"
+
+	f := limayaml.File{Location: location, Arch: limayaml.AARCH64, Digest: diskDigest}
+	dest := filepath.Join(t.TempDir(), "basedisk")
+	cachePath, err := DownloadFile(context.Background(), dest, f, true, "the image", limayaml.AARCH64)
+	assert.NilError(t, err)
+	b, err := os.ReadFile(dest)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, b, disk)
+	cached, err := CachedFile(f)
+	assert.NilError(t, err)
+	assert.Equal(t, cached, cachePath)
+
+	f.Digest = digest.FromString("other")
+	_, err = DownloadFile(context.Background(), filepath.Join(t.TempDir(), "basedisk"), f, true, "the image", limayaml.AARCH64)
+	assert.ErrorContains(t, err, "expected digest")
+
+	f = limayaml.File{Location: location, Arch: limayaml.X8664}
+	_, err = DownloadFile(context.Background(), filepath.Join(t.TempDir(), "basedisk"), f, true, "the image", limayaml.X8664)
+	assert.ErrorContains(t, err, "no manifest for arch")
+}
+
+func TestManifestForArch(t *testing.T) {
+	manifests := []ocispec.Descriptor{
+		{Digest: digest.FromString("amd64"), Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		{Digest: digest.FromString("armv6"), Platform: &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}},
+		{Digest: digest.FromString("armv7"), Platform: &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{Digest: digest.FromString("loong64"), Platform: &ocispec.Platform{OS: "linux", Architecture: "loong64"}},
+	}
+	for arch, expected := range map[limayaml.Arch]string{
+		limayaml.X8664:       "amd64",
+		limayaml.ARMV6L:      "armv6",
+		limayaml.ARMV7L:      "armv7",
+		limayaml.LOONGARCH64: "loong64",
+	} {
+		m, err := manifestForArch(manifests, arch)
+		assert.NilError(t, err)
+		assert.Equal(t, m.Digest, digest.FromString(expected), arch)
+	}
+	_, err := manifestForArch(manifests, limayaml.RISCV64)
+	assert.ErrorContains(t, err, "no manifest for arch")
+}
+
+// newTestPushRegistry serves an in-memory registry that accepts the monolithic uploads.
+func newTestPushRegistry(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	blobs := make(map[string][]byte)     // digest -> content
+	manifests := make(map[string][]byte) // tag or digest -> content
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		p := strings.TrimPrefix(r.URL.Path, "/v2/lima/image/")
+		switch {
+		case r.Method == http.MethodPost && p == "blobs/uploads/":
+			w.Header().Set("Location", "/v2/lima/image/blobs/uploads/0")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && strings.HasPrefix(p, "blobs/uploads/"):
+			b, err := io.ReadAll(r.Body)
+			assert.Check(t, err)
+			dgst := r.URL.Query().Get("digest")
+			assert.Check(t, digest.FromBytes(b).String() == dgst)
+			blobs[dgst] = b
+			w.Header().Set("Docker-Content-Digest", dgst)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(p, "manifests/"):
+			b, err := io.ReadAll(r.Body)
+			assert.Check(t, err)
+			manifests[strings.TrimPrefix(p, "manifests/")] = b
+			manifests[digest.FromBytes(b).String()] = b
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(b).String())
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasPrefix(p, "manifests/"):
+			b, ok := manifests[strings.TrimPrefix(p, "manifests/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(b).String())
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(b)
+			}
+		case strings.HasPrefix(p, "blobs/"):
+			b, ok := blobs[strings.TrimPrefix(p, "blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(b)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPushOCI(t *testing.T) {
+	assert.NilError(t, progress.SetMode(progress.ModeQuiet))
+	t.Cleanup(func() { _ = progress.SetMode(progress.ModeAuto) })
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	srv := newTestPushRegistry(t)
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/lima/image:v1"
+
+	dir := t.TempDir()
+	disk := filepath.Join(dir, "disk.img")
+	assert.NilError(t, os.WriteFile(disk, []byte("disk image"), 0o644))
+	tmpl := filepath.Join(dir, "lima.yaml")
+	// The template is smaller than the disk in the real world, but the media type takes precedence over the size
+	assert.NilError(t, os.WriteFile(tmpl, []byte("images: [{location: oci://"+ref+"}]"), 0o644))
+	manifest, descs, err := PushOCI(context.Background(), OCIScheme+ref, []OCILayer{
+		{MediaType: DiskMediaType, Path: disk},
+		{MediaType: templatestore.TemplateMediaType, Path: tmpl},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(descs), 2)
+	assert.Equal(t, descs[0].Digest, digest.FromString("disk image"))
+	assert.Equal(t, descs[0].Annotations[ocispec.AnnotationTitle], "disk.img")
+
+	// Pull the disk, pinned by the digest of the manifest
+	f := limayaml.File{Location: OCIScheme + ref + "@" + manifest.Digest.String(), Arch: limayaml.X8664, Digest: descs[0].Digest}
+	dest := filepath.Join(t.TempDir(), "basedisk")
+	_, err = DownloadFile(context.Background(), dest, f, true, "the image", limayaml.X8664)
+	assert.NilError(t, err)
+	b, err := os.ReadFile(dest)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "disk image")
+
+	b, err = ReadOCITemplate(context.Background(), OCIScheme+ref)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "images: [{location: oci://"+ref+"}]")
+
+	_, _, err = PushOCI(context.Background(), ref+"@"+manifest.Digest.String(), nil)
+	assert.ErrorContains(t, err, "must not contain a digest")
+}
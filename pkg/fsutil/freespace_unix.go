@@ -0,0 +1,16 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// FreeSpace returns the bytes available to the unprivileged user on the filesystem of path.
+func FreeSpace(path string) (uint64, error) {
+	var sf unix.Statfs_t
+	if err := unix.Statfs(path, &sf); err != nil {
+		return 0, err
+	}
+	return uint64(sf.Bavail) * uint64(sf.Bsize), nil
+}
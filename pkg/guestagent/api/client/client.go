@@ -2,12 +2,17 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"net"
+	"time"
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -18,13 +23,15 @@ type GuestAgentClient struct {
 func NewGuestAgentClient(dialFn func(ctx context.Context) (net.Conn, error)) (*GuestAgentClient, error) {
 	opts := []grpc.DialOption{
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt64),
-			grpc.MaxCallSendMsgSize(math.MaxInt64),
+			grpc.MaxCallRecvMsgSize(math.MaxInt),
+			grpc.MaxCallSendMsgSize(math.MaxInt),
 		),
 		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
 			return dialFn(ctx)
 		}),
 		grpc.WithTransportCredentials(NewCredentials()),
+		grpc.WithUnaryInterceptor(unaryUnimplementedInterceptor),
+		grpc.WithStreamInterceptor(streamUnimplementedInterceptor),
 	}
 
 	resolver.SetDefaultScheme("passthrough")
@@ -65,6 +72,60 @@ func (c *GuestAgentClient) Inotify(ctx context.Context) (api.GuestService_PostIn
 	return inotify, nil
 }
 
+// LimitProcess moves the process into a transient systemd scope with the resource limits.
+func (c *GuestAgentClient) LimitProcess(ctx context.Context, req *api.LimitProcessRequest) error {
+	_, err := c.cli.LimitProcess(ctx, req)
+	return err
+}
+
+// SetPowerSaving sets the interval of polling the guest events in the power saving mode.
+// 0 leaves the power saving mode.
+func (c *GuestAgentClient) SetPowerSaving(ctx context.Context, tick time.Duration) error {
+	req := &api.PowerSavingRequest{}
+	if tick > 0 {
+		req.Tick = durationpb.New(tick)
+	}
+	_, err := c.cli.SetPowerSaving(ctx, req)
+	return err
+}
+
+// ApplyKernelConfig loads the kernel modules, and sets the sysctl values.
+func (c *GuestAgentClient) ApplyKernelConfig(ctx context.Context, req *api.KernelConfigRequest) error {
+	_, err := c.cli.ApplyKernelConfig(ctx, req)
+	return err
+}
+
+// Freeze freezes the filesystems of the guest, until Thaw is called or the timeout expires.
+func (c *GuestAgentClient) Freeze(ctx context.Context, timeout time.Duration) error {
+	_, err := c.cli.Freeze(ctx, &api.FreezeRequest{Timeout: durationpb.New(timeout)})
+	return err
+}
+
+// Thaw thaws the filesystems frozen by Freeze.
+func (c *GuestAgentClient) Thaw(ctx context.Context) error {
+	_, err := c.cli.Thaw(ctx, &emptypb.Empty{})
+	return err
+}
+
+// Metrics returns the resource usage of the guest.
+func (c *GuestAgentClient) Metrics(ctx context.Context) (*api.Metrics, error) {
+	return c.cli.GetMetrics(ctx, &emptypb.Empty{})
+}
+
+// Exec runs the script in the guest as the user. A non-zero exit status is returned as ExitCode, not as an error.
+func (c *GuestAgentClient) Exec(ctx context.Context, req *api.ExecRequest) (*api.ExecResponse, error) {
+	return c.cli.Exec(ctx, req)
+}
+
+// Telemetry returns the resource usage counters of the guest for `limactl stats`.
+func (c *GuestAgentClient) Telemetry(ctx context.Context, processes bool) (string, error) {
+	res, err := c.cli.GetTelemetry(ctx, &api.TelemetryRequest{Processes: processes})
+	if err != nil {
+		return "", err
+	}
+	return res.GetCounters(), nil
+}
+
 func (c *GuestAgentClient) Tunnel(ctx context.Context) (api.GuestService_TunnelClient, error) {
 	stream, err := c.cli.Tunnel(ctx)
 	if err != nil {
@@ -72,3 +133,40 @@ func (c *GuestAgentClient) Tunnel(ctx context.Context) (api.GuestService_TunnelC
 	}
 	return stream, nil
 }
+
+// wrapUnimplemented explains the Unimplemented error of the method, which is returned by
+// a guest agent that is older than the host agent.
+func wrapUnimplemented(method string, err error) error {
+	if status.Code(err) != codes.Unimplemented {
+		return err
+	}
+	return fmt.Errorf("the guest agent does not implement %s, probably because the guest agent is older than the host agent "+
+		"(protocol version %d) (hint: restart the instance to update the guest agent): %w", method, api.ProtocolVersion, err)
+}
+
+func unaryUnimplementedInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return wrapUnimplemented(method, invoker(ctx, method, req, reply, cc, opts...))
+}
+
+func streamUnimplementedInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, wrapUnimplemented(method, err)
+	}
+	return &unimplementedClientStream{ClientStream: stream, method: method}, nil
+}
+
+// unimplementedClientStream wraps the errors of a stream, as the Unimplemented error of a stream
+// is returned on receiving a message rather than on opening the stream.
+type unimplementedClientStream struct {
+	grpc.ClientStream
+	method string
+}
+
+func (s *unimplementedClientStream) SendMsg(m any) error {
+	return wrapUnimplemented(s.method, s.ClientStream.SendMsg(m))
+}
+
+func (s *unimplementedClientStream) RecvMsg(m any) error {
+	return wrapUnimplemented(s.method, s.ClientStream.RecvMsg(m))
+}
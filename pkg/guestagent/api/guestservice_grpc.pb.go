@@ -27,6 +27,14 @@ type GuestServiceClient interface {
 	GetEvents(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (GuestService_GetEventsClient, error)
 	PostInotify(ctx context.Context, opts ...grpc.CallOption) (GuestService_PostInotifyClient, error)
 	Tunnel(ctx context.Context, opts ...grpc.CallOption) (GuestService_TunnelClient, error)
+	LimitProcess(ctx context.Context, in *LimitProcessRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	SetPowerSaving(ctx context.Context, in *PowerSavingRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ApplyKernelConfig(ctx context.Context, in *KernelConfigRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Freeze(ctx context.Context, in *FreezeRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Thaw(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetMetrics(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Metrics, error)
+	Exec(ctx context.Context, in *ExecRequest, opts ...grpc.CallOption) (*ExecResponse, error)
+	GetTelemetry(ctx context.Context, in *TelemetryRequest, opts ...grpc.CallOption) (*Telemetry, error)
 }
 
 type guestServiceClient struct {
@@ -143,6 +151,78 @@ func (x *guestServiceTunnelClient) Recv() (*TunnelMessage, error) {
 	return m, nil
 }
 
+func (c *guestServiceClient) LimitProcess(ctx context.Context, in *LimitProcessRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/GuestService/LimitProcess", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) SetPowerSaving(ctx context.Context, in *PowerSavingRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/GuestService/SetPowerSaving", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) ApplyKernelConfig(ctx context.Context, in *KernelConfigRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/GuestService/ApplyKernelConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) Freeze(ctx context.Context, in *FreezeRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/GuestService/Freeze", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) Thaw(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/GuestService/Thaw", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) GetMetrics(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Metrics, error) {
+	out := new(Metrics)
+	err := c.cc.Invoke(ctx, "/GuestService/GetMetrics", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) Exec(ctx context.Context, in *ExecRequest, opts ...grpc.CallOption) (*ExecResponse, error) {
+	out := new(ExecResponse)
+	err := c.cc.Invoke(ctx, "/GuestService/Exec", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestServiceClient) GetTelemetry(ctx context.Context, in *TelemetryRequest, opts ...grpc.CallOption) (*Telemetry, error) {
+	out := new(Telemetry)
+	err := c.cc.Invoke(ctx, "/GuestService/GetTelemetry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GuestServiceServer is the server API for GuestService service.
 // All implementations must embed UnimplementedGuestServiceServer
 // for forward compatibility
@@ -151,6 +231,14 @@ type GuestServiceServer interface {
 	GetEvents(*emptypb.Empty, GuestService_GetEventsServer) error
 	PostInotify(GuestService_PostInotifyServer) error
 	Tunnel(GuestService_TunnelServer) error
+	LimitProcess(context.Context, *LimitProcessRequest) (*emptypb.Empty, error)
+	SetPowerSaving(context.Context, *PowerSavingRequest) (*emptypb.Empty, error)
+	ApplyKernelConfig(context.Context, *KernelConfigRequest) (*emptypb.Empty, error)
+	Freeze(context.Context, *FreezeRequest) (*emptypb.Empty, error)
+	Thaw(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	GetMetrics(context.Context, *emptypb.Empty) (*Metrics, error)
+	Exec(context.Context, *ExecRequest) (*ExecResponse, error)
+	GetTelemetry(context.Context, *TelemetryRequest) (*Telemetry, error)
 	mustEmbedUnimplementedGuestServiceServer()
 }
 
@@ -170,6 +258,30 @@ func (UnimplementedGuestServiceServer) PostInotify(GuestService_PostInotifyServe
 func (UnimplementedGuestServiceServer) Tunnel(GuestService_TunnelServer) error {
 	return status.Errorf(codes.Unimplemented, "method Tunnel not implemented")
 }
+func (UnimplementedGuestServiceServer) LimitProcess(context.Context, *LimitProcessRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LimitProcess not implemented")
+}
+func (UnimplementedGuestServiceServer) SetPowerSaving(context.Context, *PowerSavingRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPowerSaving not implemented")
+}
+func (UnimplementedGuestServiceServer) ApplyKernelConfig(context.Context, *KernelConfigRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApplyKernelConfig not implemented")
+}
+func (UnimplementedGuestServiceServer) Freeze(context.Context, *FreezeRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Freeze not implemented")
+}
+func (UnimplementedGuestServiceServer) Thaw(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Thaw not implemented")
+}
+func (UnimplementedGuestServiceServer) GetMetrics(context.Context, *emptypb.Empty) (*Metrics, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetrics not implemented")
+}
+func (UnimplementedGuestServiceServer) Exec(context.Context, *ExecRequest) (*ExecResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exec not implemented")
+}
+func (UnimplementedGuestServiceServer) GetTelemetry(context.Context, *TelemetryRequest) (*Telemetry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTelemetry not implemented")
+}
 func (UnimplementedGuestServiceServer) mustEmbedUnimplementedGuestServiceServer() {}
 
 // UnsafeGuestServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -274,6 +386,150 @@ func (x *guestServiceTunnelServer) Recv() (*TunnelMessage, error) {
 	return m, nil
 }
 
+func _GuestService_LimitProcess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LimitProcessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).LimitProcess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/LimitProcess",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).LimitProcess(ctx, req.(*LimitProcessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_SetPowerSaving_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PowerSavingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).SetPowerSaving(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/SetPowerSaving",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).SetPowerSaving(ctx, req.(*PowerSavingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_ApplyKernelConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KernelConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).ApplyKernelConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/ApplyKernelConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).ApplyKernelConfig(ctx, req.(*KernelConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_Freeze_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FreezeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).Freeze(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/Freeze",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).Freeze(ctx, req.(*FreezeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_Thaw_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).Thaw(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/Thaw",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).Thaw(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_GetMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).GetMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/GetMetrics",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).GetMetrics(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_Exec_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).Exec(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/Exec",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).Exec(ctx, req.(*ExecRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestService_GetTelemetry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TelemetryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestServiceServer).GetTelemetry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/GuestService/GetTelemetry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestServiceServer).GetTelemetry(ctx, req.(*TelemetryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // GuestService_ServiceDesc is the grpc.ServiceDesc for GuestService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -285,6 +541,38 @@ var GuestService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetInfo",
 			Handler:    _GuestService_GetInfo_Handler,
 		},
+		{
+			MethodName: "LimitProcess",
+			Handler:    _GuestService_LimitProcess_Handler,
+		},
+		{
+			MethodName: "SetPowerSaving",
+			Handler:    _GuestService_SetPowerSaving_Handler,
+		},
+		{
+			MethodName: "ApplyKernelConfig",
+			Handler:    _GuestService_ApplyKernelConfig_Handler,
+		},
+		{
+			MethodName: "Freeze",
+			Handler:    _GuestService_Freeze_Handler,
+		},
+		{
+			MethodName: "Thaw",
+			Handler:    _GuestService_Thaw_Handler,
+		},
+		{
+			MethodName: "GetMetrics",
+			Handler:    _GuestService_GetMetrics_Handler,
+		},
+		{
+			MethodName: "Exec",
+			Handler:    _GuestService_Exec_Handler,
+		},
+		{
+			MethodName: "GetTelemetry",
+			Handler:    _GuestService_GetTelemetry_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MetricsPrefix is the prefix of the names of the metrics of the guest.
+const MetricsPrefix = "lima_guest_"
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (x *Metrics) WritePrometheus(w io.Writer) error {
+	p := &promWriter{w: w}
+
+	p.header("cpu_seconds_total", "counter", "CPU time spent in each mode, summed over all the CPUs.")
+	modes := make([]string, 0, len(x.GetCpuSeconds()))
+	for mode := range x.GetCpuSeconds() {
+		modes = append(modes, mode)
+	}
+	slices.Sort(modes)
+	for _, mode := range modes {
+		p.sample("cpu_seconds_total", []string{"mode", mode}, x.GetCpuSeconds()[mode])
+	}
+
+	p.header("memory_total_bytes", "gauge", "Total usable memory.")
+	p.sample("memory_total_bytes", nil, float64(x.GetMemoryTotalBytes()))
+	p.header("memory_available_bytes", "gauge", "Memory available for starting new applications.")
+	p.sample("memory_available_bytes", nil, float64(x.GetMemoryAvailableBytes()))
+
+	p.header("filesystem_size_bytes", "gauge", "Size of the filesystem.")
+	for _, d := range x.GetDisks() {
+		p.sample("filesystem_size_bytes", []string{"device", d.GetDevice(), "mountpoint", d.GetMountPoint()}, float64(d.GetSizeBytes()))
+	}
+	p.header("filesystem_available_bytes", "gauge", "Space of the filesystem available to non-root users.")
+	for _, d := range x.GetDisks() {
+		p.sample("filesystem_available_bytes", []string{"device", d.GetDevice(), "mountpoint", d.GetMountPoint()}, float64(d.GetAvailableBytes()))
+	}
+
+	p.header("tcp_connections", "gauge", "Established TCP connections of the listening port.")
+	for _, port := range x.GetPorts() {
+		labels := []string{"ip", port.GetPort().GetIp(), "port", strconv.Itoa(int(port.GetPort().GetPort()))}
+		p.sample("tcp_connections", labels, float64(port.GetConnections()))
+	}
+
+	inotify := x.GetInotifyStats()
+	for _, c := range []struct {
+		name, help string
+		value      uint64
+	}{
+		{"inotify_events_received_total", "Inotify events received from the host.", inotify.GetReceived()},
+		{"inotify_events_applied_total", "Inotify events applied to the guest files.", inotify.GetApplied()},
+		{"inotify_events_failed_total", "Inotify events that failed to be applied.", inotify.GetFailed()},
+		{"inotify_events_filtered_total", "Inotify events dropped by mounts[].inotify.include and exclude.", inotify.GetFiltered()},
+		{"inotify_events_rate_limited_total", "Inotify events dropped by mounts[].inotify.maxEventsPerSecond.", inotify.GetRateLimited()},
+	} {
+		p.header(c.name, "counter", c.help)
+		p.sample(c.name, nil, float64(c.value))
+	}
+	return p.err
+}
+
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) printf(format string, a ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, a...)
+	}
+}
+
+func (p *promWriter) header(name, typ, help string) {
+	p.printf("# HELP %s%s %s\n# TYPE %s%s %s\n", MetricsPrefix, name, help, MetricsPrefix, name, typ)
+}
+
+// sample writes a sample. labels are the pairs of the names and the values.
+func (p *promWriter) sample(name string, labels []string, value float64) {
+	var sb strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if sb.Len() > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(labels[i] + `="` + labelValueReplacer.Replace(labels[i+1]) + `"`)
+	}
+	if sb.Len() > 0 {
+		p.printf("%s%s{%s} %s\n", MetricsPrefix, name, sb.String(), strconv.FormatFloat(value, 'f', -1, 64))
+	} else {
+		p.printf("%s%s %s\n", MetricsPrefix, name, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+}
+
+// labelValueReplacer escapes the label value, as defined in the text exposition format.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMetricsWritePrometheus(t *testing.T) {
+	m := &Metrics{
+		CpuSeconds:           map[string]float64{"user": 101321.53, "idle": 468284.83},
+		MemoryTotalBytes:     4101636096,
+		MemoryAvailableBytes: 3491934208,
+		Disks: []*DiskMetrics{
+			{Device: "/dev/vda1", MountPoint: "/", SizeBytes: 104091082752, AvailableBytes: 95467110400},
+			{Device: "/dev/vdb1", MountPoint: `/mnt/a "quoted" dir`, SizeBytes: 1024, AvailableBytes: 512},
+		},
+		Ports:        []*PortMetrics{{Port: &IPPort{Protocol: "tcp", Ip: "0.0.0.0", Port: 80}, Connections: 2}},
+		InotifyStats: &InotifyStats{Received: 10, Applied: 9, Failed: 1},
+	}
+	var sb strings.Builder
+	assert.NilError(t, m.WritePrometheus(&sb))
+	out := sb.String()
+	for _, line := range []string{
+		"# TYPE lima_guest_cpu_seconds_total counter",
+		`lima_guest_cpu_seconds_total{mode="idle"} 468284.83`,
+		`lima_guest_cpu_seconds_total{mode="user"} 101321.53`,
+		"lima_guest_memory_total_bytes 4101636096",
+		"lima_guest_memory_available_bytes 3491934208",
+		`lima_guest_filesystem_size_bytes{device="/dev/vda1",mountpoint="/"} 104091082752`,
+		`lima_guest_filesystem_available_bytes{device="/dev/vdb1",mountpoint="/mnt/a \"quoted\" dir"} 512`,
+		`lima_guest_tcp_connections{ip="0.0.0.0",port="80"} 2`,
+		"lima_guest_inotify_events_received_total 10",
+		"lima_guest_inotify_events_rate_limited_total 0",
+	} {
+		assert.Assert(t, strings.Contains(out, line+"\n"), "missing %q in:\n%s", line, out)
+	}
+	// The modes are sorted
+	assert.Assert(t, strings.Index(out, `mode="idle"`) < strings.Index(out, `mode="user"`))
+}
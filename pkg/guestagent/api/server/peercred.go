@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/peer"
+)
+
+// PeerCredAddr is the address of a peer on a UNIX socket, with the credentials of the peer.
+type PeerCredAddr struct {
+	net.Addr
+	UID uint32
+}
+
+// peerUID returns the UID of the peer of the request.
+// false is returned when the peer is not connected over a listener created by NewPeerCredListener,
+// e.g., when the peer is the host agent connected over vsock.
+func peerUID(ctx context.Context) (uint32, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	addr, ok := p.Addr.(*PeerCredAddr)
+	if !ok {
+		return 0, false
+	}
+	return addr.UID, true
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewPeerCredListener wraps a listener of a UNIX socket so that the requests carry the credentials of the peers.
+func NewPeerCredListener(l net.Listener) net.Listener {
+	return &peerCredListener{Listener: l}
+}
+
+type peerCredListener struct {
+	net.Listener
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, nil
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var (
+		cred    *unix.Ucred
+		credErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if credErr != nil {
+		conn.Close()
+		return nil, credErr
+	}
+	return &peerCredConn{Conn: conn, addr: &PeerCredAddr{Addr: conn.RemoteAddr(), UID: cred.Uid}}, nil
+}
+
+type peerCredConn struct {
+	net.Conn
+	addr *PeerCredAddr
+}
+
+func (c *peerCredConn) RemoteAddr() net.Addr {
+	return c.addr
+}
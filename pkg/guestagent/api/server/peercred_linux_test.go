@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPeerCredListener(t *testing.T) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	assert.NilError(t, err)
+	l = NewPeerCredListener(l)
+	defer l.Close()
+
+	go func() {
+		if conn, err := net.Dial("unix", l.Addr().String()); err == nil {
+			defer conn.Close()
+			_, _ = conn.Read(make([]byte, 1))
+		}
+	}()
+	conn, err := l.Accept()
+	assert.NilError(t, err)
+	defer conn.Close()
+	addr, ok := conn.RemoteAddr().(*PeerCredAddr)
+	assert.Assert(t, ok)
+	assert.Equal(t, addr.UID, uint32(os.Getuid()))
+}
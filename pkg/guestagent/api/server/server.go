@@ -3,11 +3,20 @@ package server
 import (
 	"context"
 	"net"
+	"os/user"
+	"strconv"
+	"time"
 
 	"github.com/lima-vm/lima/pkg/guestagent"
 	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/guestagent/execscript"
+	"github.com/lima-vm/lima/pkg/guestagent/fsfreeze"
+	"github.com/lima-vm/lima/pkg/guestagent/kernelconfig"
+	"github.com/lima-vm/lima/pkg/guestagent/telemetry"
 	"github.com/lima-vm/lima/pkg/portfwdserver"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -21,6 +30,7 @@ type GuestServer struct {
 	api.UnimplementedGuestServiceServer
 	Agent   guestagent.Agent
 	TunnelS *portfwdserver.TunnelServer
+	freezer fsfreeze.Freezer
 }
 
 func (s *GuestServer) GetInfo(ctx context.Context, _ *emptypb.Empty) (*api.Info, error) {
@@ -49,6 +59,100 @@ func (s *GuestServer) PostInotify(server api.GuestService_PostInotifyServer) err
 	}
 }
 
+func (s *GuestServer) LimitProcess(ctx context.Context, req *api.LimitProcessRequest) (*emptypb.Empty, error) {
+	uid, ok := peerUID(ctx)
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "the requester must connect over the UNIX socket of the guest agent")
+	}
+	if err := s.Agent.LimitProcess(ctx, req, uid); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GuestServer) SetPowerSaving(_ context.Context, req *api.PowerSavingRequest) (*emptypb.Empty, error) {
+	var tick time.Duration
+	if req.GetTick() != nil {
+		if err := req.GetTick().CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		tick = req.GetTick().AsDuration()
+	}
+	s.Agent.SetPowerSaving(tick)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GuestServer) ApplyKernelConfig(ctx context.Context, req *api.KernelConfigRequest) (*emptypb.Empty, error) {
+	// The requests over the UNIX socket are allowed only for root, as the sysctl values affect the whole guest.
+	if uid, ok := peerUID(ctx); ok && uid != 0 {
+		return nil, status.Error(codes.PermissionDenied, "only root is allowed to apply the kernel config")
+	}
+	cfg := &kernelconfig.Config{Modules: req.GetModules(), Sysctl: req.GetSysctl()}
+	if err := cfg.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := kernelconfig.Apply(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GuestServer) Freeze(ctx context.Context, req *api.FreezeRequest) (*emptypb.Empty, error) {
+	// Only root is allowed to freeze the filesystems over the UNIX socket, as it blocks all the writers of the guest
+	if uid, ok := peerUID(ctx); ok && uid != 0 {
+		return nil, status.Error(codes.PermissionDenied, "only root is allowed to freeze the filesystems")
+	}
+	var timeout time.Duration
+	if req.GetTimeout() != nil {
+		if err := req.GetTimeout().CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		timeout = req.GetTimeout().AsDuration()
+	}
+	if err := s.freezer.Freeze(timeout); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GuestServer) Thaw(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	if uid, ok := peerUID(ctx); ok && uid != 0 {
+		return nil, status.Error(codes.PermissionDenied, "only root is allowed to thaw the filesystems")
+	}
+	if err := s.freezer.Thaw(); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GuestServer) GetMetrics(ctx context.Context, _ *emptypb.Empty) (*api.Metrics, error) {
+	return s.Agent.Metrics(ctx)
+}
+
+func (s *GuestServer) Exec(ctx context.Context, req *api.ExecRequest) (*api.ExecResponse, error) {
+	u, err := user.Lookup(req.GetUser())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Over the UNIX socket, the script can only be run as the requester itself, as with SSH.
+	if uid, ok := peerUID(ctx); ok && uid != 0 && strconv.FormatUint(uint64(uid), 10) != u.Uid {
+		return nil, status.Errorf(codes.PermissionDenied, "the script can only be run as the requester itself, not as %q", u.Username)
+	}
+	res, err := execscript.Run(ctx, req.GetScript(), u)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return res, nil
+}
+
+func (s *GuestServer) GetTelemetry(_ context.Context, req *api.TelemetryRequest) (*api.Telemetry, error) {
+	counters, err := telemetry.Read(req.GetProcesses())
+	if err != nil {
+		return nil, err
+	}
+	return &api.Telemetry{Counters: counters}, nil
+}
+
 func (s *GuestServer) Tunnel(stream api.GuestService_TunnelServer) error {
 	return s.TunnelS.Start(stream)
 }
@@ -0,0 +1,64 @@
+package api
+
+import "slices"
+
+// ProtocolVersion is the version of the protocol between the host agent and the guest agent.
+// Increment it on an incompatible change of the protocol.
+// Compatible additions are advertised as capabilities instead.
+const ProtocolVersion = 1
+
+const (
+	// CapabilityInotify is the capability to receive the inotify events of the host mounts (PostInotify).
+	CapabilityInotify = "inotify"
+	// CapabilityTunnel is the capability to forward the ports over the gRPC tunnel (Tunnel).
+	CapabilityTunnel = "tunnel"
+	// CapabilityUDPRelay is the capability to relay UDP multicast and broadcast datagrams over the tunnel (`udpRelays`).
+	CapabilityUDPRelay = "udp-relay"
+	// CapabilityLimitProcess is the capability to limit the resources of a process in a transient systemd scope (LimitProcess).
+	CapabilityLimitProcess = "limit-process"
+	// CapabilityLocalSockets is the capability to report the listening UNIX sockets in the events (`socketForwards`).
+	CapabilityLocalSockets = "local-sockets"
+	// CapabilityPowerSaving is the capability to reduce the frequency of polling the guest events (SetPowerSaving).
+	CapabilityPowerSaving = "power-saving"
+	// CapabilityKernelConfig is the capability to load the kernel modules and to set the sysctl values (ApplyKernelConfig).
+	CapabilityKernelConfig = "kernel-config"
+	// CapabilityFSFreeze is the capability to freeze the filesystems while the disk is being snapshotted (Freeze and Thaw).
+	CapabilityFSFreeze = "fsfreeze"
+	// CapabilityMetrics is the capability to report the resource usage of the guest (GetMetrics).
+	CapabilityMetrics = "metrics"
+	// CapabilityExec is the capability to run the scripts of the host agent without SSH (Exec).
+	CapabilityExec = "exec"
+	// CapabilityTelemetry is the capability to read the resource usage counters for `limactl stats` without SSH (GetTelemetry).
+	CapabilityTelemetry = "telemetry"
+)
+
+// Capabilities are the capabilities implemented by this version of Lima.
+var Capabilities = []string{CapabilityInotify, CapabilityTunnel, CapabilityUDPRelay, CapabilityLimitProcess, CapabilityLocalSockets, CapabilityPowerSaving, CapabilityKernelConfig, CapabilityFSFreeze, CapabilityMetrics, CapabilityExec, CapabilityTelemetry}
+
+// legacyCapabilities are the capabilities of the guest agents that predate the protocol versioning.
+var legacyCapabilities = []string{CapabilityInotify, CapabilityTunnel}
+
+// GuestCapabilities returns the capabilities of the guest agent.
+// For the guest agents that predate the protocol versioning, the capabilities are assumed from the version.
+func (x *Info) GuestCapabilities() []string {
+	if x.GetProtocolVersion() == 0 {
+		return legacyCapabilities
+	}
+	return x.GetCapabilities()
+}
+
+// HasCapability returns true if the guest agent supports the capability.
+func (x *Info) HasCapability(capability string) bool {
+	return slices.Contains(x.GuestCapabilities(), capability)
+}
+
+// MissingCapabilities returns the capabilities of the host agent that are not supported by the guest agent.
+func (x *Info) MissingCapabilities() []string {
+	var missing []string
+	for _, c := range Capabilities {
+		if !x.HasCapability(c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
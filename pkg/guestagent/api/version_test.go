@@ -0,0 +1,21 @@
+package api
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	legacy := &Info{}
+	assert.Assert(t, legacy.HasCapability(CapabilityTunnel))
+	assert.DeepEqual(t, legacy.MissingCapabilities(), []string{CapabilityUDPRelay, CapabilityLimitProcess, CapabilityLocalSockets, CapabilityPowerSaving, CapabilityKernelConfig, CapabilityFSFreeze, CapabilityMetrics, CapabilityExec, CapabilityTelemetry})
+
+	current := &Info{ProtocolVersion: ProtocolVersion, Capabilities: Capabilities}
+	assert.Assert(t, current.HasCapability(CapabilityUDPRelay))
+	assert.Assert(t, current.MissingCapabilities() == nil)
+
+	newer := &Info{ProtocolVersion: ProtocolVersion + 1, Capabilities: []string{CapabilityTunnel, "unknown"}}
+	assert.Assert(t, !newer.HasCapability(CapabilityInotify))
+	assert.DeepEqual(t, newer.MissingCapabilities(), []string{CapabilityInotify, CapabilityUDPRelay, CapabilityLimitProcess, CapabilityLocalSockets, CapabilityPowerSaving, CapabilityKernelConfig, CapabilityFSFreeze, CapabilityMetrics, CapabilityExec, CapabilityTelemetry})
+}
@@ -0,0 +1,54 @@
+// Package execscript runs the scripts of the host agent in the guest (Exec), as an alternative to running them over SSH.
+package execscript
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"os/user"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+)
+
+// defaultPath is the PATH of the scripts, as the guest agent does not have the login environment of the user.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Run runs the script as the user, with the interpreter of the "#!" line, and the script as the stdin,
+// like `ssh HOST -- INTERPRETER`.
+// A non-zero exit status of the script is returned as ExitCode, not as an error.
+func Run(ctx context.Context, script string, u *user.User) (*api.ExecResponse, error) {
+	interpreter, err := ssh.ParseScriptInterpreter(script)
+	if err != nil {
+		return nil, err
+	}
+	// The interpreter line is split by the login shell of the user with SSH, e.g., "/usr/bin/env bash"
+	args := strings.Fields(interpreter)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if err := setCredential(cmd, u); err != nil {
+		return nil, err
+	}
+	cmd.Dir = u.HomeDir
+	cmd.Env = []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+		"PATH=" + defaultPath,
+	}
+	cmd.Stdin = strings.NewReader(script)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	res := &api.ExecResponse{}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() < 0 {
+			return nil, err
+		}
+		res.ExitCode = int32(exitErr.ExitCode())
+	}
+	res.Stdout, res.Stderr = stdout.Bytes(), stderr.Bytes()
+	return res, nil
+}
@@ -0,0 +1,27 @@
+package execscript
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRun(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root, as the guest agent")
+	}
+	u, err := user.Current()
+	assert.NilError(t, err)
+
+	res, err := Run(context.Background(), "#!/bin/sh -eu\necho \"$USER $HOME $(pwd)\"\necho err >&2\nexit 3\n", u)
+	assert.NilError(t, err)
+	assert.Equal(t, string(res.GetStdout()), u.Username+" "+u.HomeDir+" "+u.HomeDir+"\n")
+	assert.Equal(t, string(res.GetStderr()), "err\n")
+	assert.Equal(t, res.GetExitCode(), int32(3))
+
+	_, err = Run(context.Background(), "echo no interpreter\n", u)
+	assert.ErrorContains(t, err, "the first line lacks `#!`")
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package execscript
+
+import (
+	"errors"
+	"os/exec"
+	"os/user"
+)
+
+func setCredential(_ *exec.Cmd, _ *user.User) error {
+	return errors.ErrUnsupported
+}
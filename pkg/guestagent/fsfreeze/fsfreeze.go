@@ -0,0 +1,162 @@
+// Package fsfreeze freezes the filesystems of the guest, so that a snapshot of the disk taken
+// by the host (`limactl clone --quiesce`) is consistent at the filesystem level.
+package fsfreeze
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/mountinfo"
+	"github.com/sirupsen/logrus"
+)
+
+// MaxTimeout is the maximum duration of a freeze.
+// The filesystems are thawed after the timeout even when the host agent fails to call Thaw,
+// as the guest cannot write to the filesystems while they are frozen.
+const MaxTimeout = 5 * time.Minute
+
+// mount is a filesystem to be frozen.
+type mount struct {
+	Device     string // "major:minor"
+	MountPoint string
+}
+
+// excludedFSTypes are the filesystem types that are never frozen: read-only by nature, or not backed by the disk.
+var excludedFSTypes = []string{"iso9660", "squashfs", "erofs", "udf"}
+
+// parseMountInfo returns the filesystems backed by the block devices from /proc/self/mountinfo, in the mount order.
+// Each device appears only once, as a filesystem mounted on multiple points is frozen only once.
+func parseMountInfo(r io.Reader) ([]mount, error) {
+	var mounts []mount
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		// See proc(5).
+		fields := strings.Fields(sc.Text())
+		sep := slices.Index(fields, "-")
+		if sep < 6 || len(fields) < sep+3 {
+			return nil, fmt.Errorf("unexpected line in mountinfo: %q", sc.Text())
+		}
+		dev, mountPoint, mountOpts := fields[2], mountinfo.Unescape(fields[4]), fields[5]
+		fsType, source := fields[sep+1], fields[sep+2]
+		if !strings.HasPrefix(source, "/dev/") || slices.Contains(excludedFSTypes, fsType) {
+			continue
+		}
+		if slices.Contains(strings.Split(mountOpts, ","), "ro") || seen[dev] {
+			continue
+		}
+		seen[dev] = true
+		mounts = append(mounts, mount{Device: dev, MountPoint: mountPoint})
+	}
+	return mounts, sc.Err()
+}
+
+var (
+	// mountInfo is replaced in the tests.
+	mountInfo = "/proc/self/mountinfo"
+	// freeze and thaw are replaced in the tests.
+	freeze = freezeMountPoint
+	thaw   = thawMountPoint
+)
+
+// Freezer freezes and thaws the filesystems. The zero value is ready to use.
+type Freezer struct {
+	mu     sync.Mutex
+	frozen []mount
+	timer  *time.Timer
+}
+
+// Freeze freezes the filesystems backed by the block devices, until Thaw is called or the timeout expires.
+// The filesystems that do not support freezing are skipped.
+// On failure, the filesystems that have been frozen are thawed.
+func (f *Freezer) Freeze(timeout time.Duration) error {
+	if timeout <= 0 || timeout > MaxTimeout {
+		timeout = MaxTimeout
+	}
+	file, err := os.Open(mountInfo)
+	if err != nil {
+		return err
+	}
+	mounts, err := parseMountInfo(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.frozen != nil {
+		return errors.New("the filesystems are already frozen")
+	}
+	frozen := []mount{}
+	// The mounts are frozen in the reverse order, so that the nested mounts are frozen before their parents
+	for i := len(mounts) - 1; i >= 0; i-- {
+		m := mounts[i]
+		if err := freeze(m.MountPoint); err != nil {
+			if errors.Is(err, errors.ErrUnsupported) {
+				logrus.Debugf("filesystem %q does not support freezing", m.MountPoint)
+				continue
+			}
+			return errors.Join(fmt.Errorf("failed to freeze %q: %w", m.MountPoint, err), thawAll(frozen))
+		}
+		frozen = append(frozen, m)
+	}
+	logrus.Infof("Froze %d filesystems for up to %v", len(frozen), timeout)
+	f.frozen = frozen
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		// The timer may fire after the filesystems have been thawed and frozen again
+		if f.timer != timer {
+			return
+		}
+		logrus.Warnf("Thawing the filesystems, as they have been frozen for %v", timeout)
+		if err := f.thaw(); err != nil {
+			logrus.WithError(err).Error("Failed to thaw the filesystems")
+		}
+	})
+	f.timer = timer
+	return nil
+}
+
+// Thaw thaws the filesystems frozen by Freeze.
+// Thaw is a no-op when the filesystems are not frozen.
+func (f *Freezer) Thaw() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.thaw()
+}
+
+func (f *Freezer) thaw() error {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	frozen := f.frozen
+	f.frozen = nil
+	if len(frozen) > 0 {
+		logrus.Infof("Thawing %d filesystems", len(frozen))
+	}
+	return thawAll(frozen)
+}
+
+// thawAll thaws the mounts in the reverse order of freezing.
+func thawAll(frozen []mount) error {
+	var errs []error
+	for i := len(frozen) - 1; i >= 0; i-- {
+		m := frozen[i]
+		if err := thaw(m.MountPoint); err != nil {
+			errs = append(errs, fmt.Errorf("failed to thaw %q: %w", m.MountPoint, err))
+		}
+	}
+	return errors.Join(errs...)
+}
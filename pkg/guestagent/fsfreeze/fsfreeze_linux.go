@@ -0,0 +1,43 @@
+package fsfreeze
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// The ioctls of linux/fs.h, not defined in x/sys/unix.
+const (
+	fiFreeze = 0xC0045877 // _IOWR('X', 119, int)
+	fiThaw   = 0xC0045878 // _IOWR('X', 120, int)
+)
+
+func freezeMountPoint(mountPoint string) error {
+	return ioctlMountPoint(mountPoint, fiFreeze)
+}
+
+func thawMountPoint(mountPoint string) error {
+	err := ioctlMountPoint(mountPoint, fiThaw)
+	if errors.Is(err, unix.EINVAL) {
+		// Already thawed, e.g., by `fsfreeze -u`
+		return nil
+	}
+	return err
+}
+
+func ioctlMountPoint(mountPoint string, req uint) error {
+	f, err := os.Open(mountPoint)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = unix.IoctlSetInt(int(f.Fd()), req, 0)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOTTY) {
+		return errors.ErrUnsupported
+	}
+	if err != nil {
+		return &os.PathError{Op: "ioctl", Path: mountPoint, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fsfreeze
+
+import "errors"
+
+func freezeMountPoint(_ string) error {
+	return errors.ErrUnsupported
+}
+
+func thawMountPoint(_ string) error {
+	return errors.ErrUnsupported
+}
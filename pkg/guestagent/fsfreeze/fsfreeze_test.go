@@ -0,0 +1,103 @@
+package fsfreeze
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const testMountInfo = `22 1 253:1 / / rw,relatime shared:1 - ext4 /dev/vda1 rw,discard,errors=remount-ro
+23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+24 22 253:15 / /boot/efi rw,relatime shared:2 - vfat /dev/vda15 rw,fmask=0077
+25 22 11:0 / /mnt/lima-cidata ro,relatime shared:3 - iso9660 /dev/sr0 ro
+26 22 0:45 / /Users/foo rw,relatime shared:4 - virtiofs mount0 rw
+27 22 253:1 /srv /mnt/bind\040dir rw,relatime shared:1 - ext4 /dev/vda1 rw,discard,errors=remount-ro
+28 22 253:17 / /mnt/data\040disk rw,relatime shared:5 - xfs /dev/vdb1 rw
+29 22 253:18 / /mnt/ro rw,relatime shared:6 - ext4 /dev/vdc1 ro
+30 22 253:19 / /mnt/ro-mount ro,relatime shared:7 - ext4 /dev/vdd1 rw
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(testMountInfo))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, mounts, []mount{
+		{Device: "253:1", MountPoint: "/"},
+		{Device: "253:15", MountPoint: "/boot/efi"},
+		{Device: "253:17", MountPoint: "/mnt/data disk"},
+		{Device: "253:18", MountPoint: "/mnt/ro"},
+	})
+
+	_, err = parseMountInfo(strings.NewReader("22 1 253:1 / / rw\n"))
+	assert.ErrorContains(t, err, "unexpected line")
+}
+
+func TestFreezer(t *testing.T) {
+	mountInfo = filepath.Join(t.TempDir(), "mountinfo")
+	assert.NilError(t, os.WriteFile(mountInfo, []byte(testMountInfo), 0o644))
+	origFreeze, origThaw := freeze, thaw
+	t.Cleanup(func() {
+		mountInfo = "/proc/self/mountinfo"
+		freeze, thaw = origFreeze, origThaw
+	})
+	var ops []string
+	freeze = func(mountPoint string) error {
+		if mountPoint == "/boot/efi" {
+			return errors.ErrUnsupported
+		}
+		ops = append(ops, "freeze "+mountPoint)
+		return nil
+	}
+	thaw = func(mountPoint string) error {
+		ops = append(ops, "thaw "+mountPoint)
+		return nil
+	}
+
+	var f Freezer
+	assert.NilError(t, f.Freeze(time.Minute))
+	assert.ErrorContains(t, f.Freeze(time.Minute), "already frozen")
+	assert.NilError(t, f.Thaw())
+	assert.DeepEqual(t, ops, []string{
+		"freeze /mnt/ro", "freeze /mnt/data disk", "freeze /",
+		"thaw /", "thaw /mnt/data disk", "thaw /mnt/ro",
+	})
+	// thawing twice is a no-op
+	assert.NilError(t, f.Thaw())
+	assert.Equal(t, len(ops), 6)
+
+	// a failure thaws the filesystems that have been frozen
+	ops = nil
+	freeze = func(mountPoint string) error {
+		if mountPoint == "/" {
+			return errors.New("device busy")
+		}
+		ops = append(ops, "freeze "+mountPoint)
+		return nil
+	}
+	assert.ErrorContains(t, f.Freeze(time.Minute), `failed to freeze "/"`)
+	assert.DeepEqual(t, ops, []string{
+		"freeze /mnt/ro", "freeze /mnt/data disk", "freeze /boot/efi",
+		"thaw /boot/efi", "thaw /mnt/data disk", "thaw /mnt/ro",
+	})
+
+	// the filesystems are thawed after the timeout
+	freeze = func(string) error { return nil }
+	thawed := make(chan string, 4)
+	thaw = func(mountPoint string) error {
+		thawed <- mountPoint
+		return nil
+	}
+	assert.NilError(t, f.Freeze(10*time.Millisecond))
+	select {
+	case mountPoint := <-thawed:
+		assert.Equal(t, mountPoint, "/")
+	case <-time.After(10 * time.Second):
+		t.Fatal("the filesystems were not thawed after the timeout")
+	}
+	// waits for the timer to release the lock
+	assert.NilError(t, f.Thaw())
+}
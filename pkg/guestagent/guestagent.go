@@ -2,6 +2,7 @@ package guestagent
 
 import (
 	"context"
+	"time"
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
 )
@@ -10,5 +11,15 @@ type Agent interface {
 	Info(ctx context.Context) (*api.Info, error)
 	Events(ctx context.Context, ch chan *api.Event)
 	LocalPorts(ctx context.Context) ([]*api.IPPort, error)
+	// LocalSockets returns the paths of the listening UNIX sockets.
+	LocalSockets(ctx context.Context) ([]string, error)
 	HandleInotify(event *api.Inotify)
+	// LimitProcess moves the process into a transient systemd scope with the resource limits.
+	// uid is the UID of the requester, who has to own the process unless the requester is root.
+	LimitProcess(ctx context.Context, req *api.LimitProcessRequest, uid uint32) error
+	// SetPowerSaving sets the interval of polling the events in the power saving mode.
+	// 0 leaves the power saving mode.
+	SetPowerSaving(tick time.Duration)
+	// Metrics returns the resource usage of the guest.
+	Metrics(ctx context.Context) (*api.Metrics, error)
 }
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"os"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -14,7 +17,9 @@ import (
 	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"github.com/lima-vm/lima/pkg/guestagent/iptables"
 	"github.com/lima-vm/lima/pkg/guestagent/kubernetesservice"
+	"github.com/lima-vm/lima/pkg/guestagent/metrics"
 	"github.com/lima-vm/lima/pkg/guestagent/procnettcp"
+	"github.com/lima-vm/lima/pkg/guestagent/procnetunix"
 	"github.com/lima-vm/lima/pkg/guestagent/timesync"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/cpu"
@@ -99,6 +104,26 @@ type agent struct {
 	latestIPTables           []iptables.Entry
 	latestIPTablesMu         sync.RWMutex
 	kubernetesServiceWatcher *kubernetesservice.ServiceWatcher
+
+	inotifyStats inotifyStats
+
+	// powerSavingTick is the time.Duration of SetPowerSaving.
+	powerSavingTick atomic.Int64
+}
+
+// inotifyStats are the counters of HandleInotify, reported in Info and Metrics.
+type inotifyStats struct {
+	received, applied, failed, filtered, rateLimited atomic.Uint64
+}
+
+func (s *inotifyStats) proto() *api.InotifyStats {
+	return &api.InotifyStats{
+		Received:    s.received.Load(),
+		Applied:     s.applied.Load(),
+		Failed:      s.failed.Load(),
+		Filtered:    s.filtered.Load(),
+		RateLimited: s.rateLimited.Load(),
+	}
 }
 
 // setWorthCheckingIPTablesRoutine sets worthCheckingIPTables to be true
@@ -139,7 +164,8 @@ func (a *agent) setWorthCheckingIPTablesRoutine(auditClient *libaudit.AuditClien
 }
 
 type eventState struct {
-	ports []*api.IPPort
+	ports   []*api.IPPort
+	sockets []string
 }
 
 func comparePorts(old, neww []*api.IPPort) (added, removed []*api.IPPort) {
@@ -169,6 +195,20 @@ func comparePorts(old, neww []*api.IPPort) (added, removed []*api.IPPort) {
 	return
 }
 
+func compareSockets(old, neww []string) (added, removed []string) {
+	for _, f := range neww {
+		if !slices.Contains(old, f) {
+			added = append(added, f)
+		}
+	}
+	for _, f := range old {
+		if !slices.Contains(neww, f) {
+			removed = append(removed, f)
+		}
+	}
+	return
+}
+
 func (a *agent) collectEvent(ctx context.Context, st eventState) (*api.Event, eventState) {
 	var (
 		ev  = &api.Event{}
@@ -182,6 +222,12 @@ func (a *agent) collectEvent(ctx context.Context, st eventState) (*api.Event, ev
 		return ev, newSt
 	}
 	ev.LocalPortsAdded, ev.LocalPortsRemoved = comparePorts(st.ports, newSt.ports)
+	if sockets, err := a.LocalSockets(ctx); err != nil {
+		ev.Errors = append(ev.Errors, err.Error())
+	} else {
+		newSt.sockets = sockets
+		ev.LocalSocketsAdded, ev.LocalSocketsRemoved = compareSockets(st.sockets, newSt.sockets)
+	}
 	ev.Time = timestamppb.Now()
 	return ev, newSt
 }
@@ -197,21 +243,42 @@ func (a *agent) Events(ctx context.Context, ch chan *api.Event) {
 	defer close(ch)
 	tickerCh, tickerClose := a.newTicker()
 	defer tickerClose()
-	var st eventState
+	var (
+		st            eventState
+		lastCollected time.Time
+	)
 	for {
 		var ev *api.Event
 		ev, st = a.collectEvent(ctx, st)
+		lastCollected = time.Now()
 		if !isEventEmpty(ev) {
 			ch <- ev
 		}
-		select {
-		case <-ctx.Done():
-			return
-		case _, ok := <-tickerCh:
-			if !ok {
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
 				return
+			case _, ok := <-tickerCh:
+				if !ok {
+					return
+				}
+				logrus.Debug("tick!")
+				// In the power saving mode, skip the ticks until the power saving tick elapses
+				if powerSavingTick := time.Duration(a.powerSavingTick.Load()); time.Since(lastCollected) >= powerSavingTick {
+					break wait
+				}
 			}
-			logrus.Debug("tick!")
+		}
+	}
+}
+
+func (a *agent) SetPowerSaving(tick time.Duration) {
+	if old := time.Duration(a.powerSavingTick.Swap(int64(tick))); old != tick {
+		if tick > 0 {
+			logrus.Infof("Entering the power saving mode (event tick: %v)", tick)
+		} else {
+			logrus.Info("Leaving the power saving mode")
 		}
 	}
 }
@@ -313,6 +380,22 @@ func (a *agent) LocalPorts(_ context.Context) ([]*api.IPPort, error) {
 	return res, nil
 }
 
+// LocalSockets returns the sorted paths of the listening UNIX sockets, excluding the abstract sockets.
+func (a *agent) LocalSockets(_ context.Context) ([]string, error) {
+	entries, err := procnetunix.ParseFile()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, ent := range entries {
+		if ent.Listening() && strings.HasPrefix(ent.Path, "/") {
+			res = append(res, ent.Path)
+		}
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
+
 func (a *agent) Info(ctx context.Context) (*api.Info, error) {
 	var (
 		info api.Info
@@ -322,9 +405,21 @@ func (a *agent) Info(ctx context.Context) (*api.Info, error) {
 	if err != nil {
 		return nil, err
 	}
+	info.ProtocolVersion = api.ProtocolVersion
+	info.Capabilities = api.Capabilities
+	info.InotifyStats = a.inotifyStats.proto()
 	return &info, nil
 }
 
+func (a *agent) Metrics(_ context.Context) (*api.Metrics, error) {
+	m, err := metrics.Collect()
+	if err != nil {
+		return nil, err
+	}
+	m.InotifyStats = a.inotifyStats.proto()
+	return m, nil
+}
+
 const deltaLimit = 2 * time.Second
 
 func (a *agent) fixSystemTimeSkew() {
@@ -360,12 +455,22 @@ func (a *agent) fixSystemTimeSkew() {
 }
 
 func (a *agent) HandleInotify(event *api.Inotify) {
+	a.inotifyStats.filtered.Add(event.Filtered)
+	a.inotifyStats.rateLimited.Add(event.RateLimited)
 	location := event.MountPath
+	if location == "" {
+		// Only carries the counters
+		return
+	}
+	a.inotifyStats.received.Add(1)
 	if _, err := os.Stat(location); err == nil {
 		local := event.Time.AsTime().Local()
 		err := os.Chtimes(location, local, local)
 		if err != nil {
+			a.inotifyStats.failed.Add(1)
 			logrus.Errorf("error in inotify handle. Event: %s, Error: %s", event, err)
+			return
 		}
+		a.inotifyStats.applied.Add(1)
 	}
 }
@@ -0,0 +1,160 @@
+// Package kernelconfig applies `kernel.modules` and `sysctl` of lima.yaml to the guest.
+package kernelconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the kernel configuration of an instance.
+// It is stored in "kernel-config.json" of the cidata, and sent to the guest agent on `limactl edit --live`.
+type Config struct {
+	Modules []string          `json:"modules,omitempty"`
+	Sysctl  map[string]string `json:"sysctl,omitempty"`
+}
+
+var moduleRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateModule validates the name of a kernel module.
+func ValidateModule(name string) error {
+	if !moduleRegexp.MatchString(name) {
+		return fmt.Errorf("invalid kernel module name %q", name)
+	}
+	return nil
+}
+
+// sysctlKeyRegexp does not match "." and ".." as a component, so the key can be safely converted to a path under /proc/sys.
+var sysctlKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+([./][A-Za-z0-9_@:+-]+)+$`)
+
+// dangerousSysctls are the sysctl keys rejected by ValidateSysctl, with the reasons.
+var dangerousSysctls = map[string]string{
+	"kernel.modprobe":            "runs the specified program as root",
+	"kernel.hotplug":             "runs the specified program as root",
+	"kernel.poweroff_cmd":        "runs the specified program as root",
+	"kernel.modules_disabled":    "cannot be reverted without a reboot, and prevents `kernel.modules` from being loaded",
+	"kernel.kexec_load_disabled": "cannot be reverted without a reboot",
+}
+
+// NormalizeSysctlKey converts the slash-separated form of a key to the dot-separated form.
+func NormalizeSysctlKey(key string) string {
+	if strings.Contains(key, "/") {
+		return strings.ReplaceAll(key, "/", ".")
+	}
+	return key
+}
+
+// ValidateSysctl validates a key and a value of sysctl.
+// The key is either dot-separated ("vm.max_map_count") or slash-separated ("net/ipv4/conf/eth0.100/rp_filter"),
+// as in sysctl(8). The keys that can run a program as root, or that cannot be reverted, are rejected.
+func ValidateSysctl(key, value string) error {
+	if !sysctlKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid sysctl key %q", key)
+	}
+	if value == "" || strings.ContainsAny(value, "\n\r\x00") {
+		return fmt.Errorf("invalid value of sysctl %q: %q", key, value)
+	}
+	normalized := NormalizeSysctlKey(key)
+	if reason, ok := dangerousSysctls[normalized]; ok {
+		return fmt.Errorf("sysctl %q is not allowed, as it %s", key, reason)
+	}
+	if normalized == "kernel.core_pattern" && strings.HasPrefix(strings.TrimSpace(value), "|") {
+		return fmt.Errorf("sysctl %q is not allowed to pipe the core dumps to a program, as the program runs as root", key)
+	}
+	return nil
+}
+
+// Validate validates the modules and the sysctl keys of cfg.
+func (cfg *Config) Validate() error {
+	for _, m := range cfg.Modules {
+		if err := ValidateModule(m); err != nil {
+			return err
+		}
+	}
+	for _, k := range cfg.sortedSysctlKeys() {
+		if err := ValidateSysctl(k, cfg.Sysctl[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) sortedSysctlKeys() []string {
+	keys := make([]string, 0, len(cfg.Sysctl))
+	for k := range cfg.Sysctl {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+var (
+	// procSys is replaced in the tests.
+	procSys = "/proc/sys"
+	// modprobe is replaced in the tests.
+	modprobe = func(ctx context.Context, name string) ([]byte, error) {
+		return exec.CommandContext(ctx, "modprobe", name).CombinedOutput()
+	}
+)
+
+// sysctlPath returns the path of the key under /proc/sys.
+// In the dot-separated form, the dots are the separators; in the slash-separated form, the dots are a part of the names.
+func sysctlPath(key string) string {
+	if strings.Contains(key, "/") {
+		return filepath.Join(procSys, key)
+	}
+	return filepath.Join(procSys, strings.ReplaceAll(key, ".", "/"))
+}
+
+// Apply loads the modules, and sets the sysctl values that differ from the current values.
+// The modules are loaded first, as the sysctl keys of a module (e.g., "net.bridge.*" of br_netfilter)
+// do not exist until the module is loaded.
+// Apply continues on an error, and returns all the errors.
+func Apply(ctx context.Context, cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, m := range cfg.Modules {
+		logrus.Debugf("loading kernel module %q", m)
+		if out, err := modprobe(ctx, m); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load kernel module %q: %w (out=%q)", m, err, string(out)))
+		}
+	}
+	for _, k := range cfg.sortedSysctlKeys() {
+		changed, err := setSysctl(k, cfg.Sysctl[k])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if changed {
+			logrus.Infof("Set sysctl %q to %q", k, cfg.Sysctl[k])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setSysctl writes value to the key, unless the current value is already the same.
+// The values are compared with the whitespaces normalized, as the kernel prints the vectors separated by tabs.
+func setSysctl(key, value string) (bool, error) {
+	p := sysctlPath(key)
+	current, err := os.ReadFile(p)
+	if err != nil {
+		return false, fmt.Errorf("failed to read sysctl %q: %w", key, err)
+	}
+	if slices.Equal(strings.Fields(string(current)), strings.Fields(value)) {
+		return false, nil
+	}
+	if err := os.WriteFile(p, []byte(value), 0o644); err != nil {
+		return false, fmt.Errorf("failed to set sysctl %q to %q: %w", key, value, err)
+	}
+	return true, nil
+}
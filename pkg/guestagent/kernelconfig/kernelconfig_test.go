@@ -0,0 +1,75 @@
+package kernelconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestApply(t *testing.T) {
+	procSys = t.TempDir()
+	t.Cleanup(func() { procSys = "/proc/sys" })
+	var loaded []string
+	origModprobe := modprobe
+	t.Cleanup(func() { modprobe = origModprobe })
+	modprobe = func(_ context.Context, name string) ([]byte, error) {
+		if name == "missing" {
+			return []byte("modprobe: FATAL: Module missing not found"), errors.New("exit status 1")
+		}
+		loaded = append(loaded, name)
+		return nil, nil
+	}
+
+	files := map[string]string{
+		"vm/max_map_count":                 "65530\n",
+		"net/ipv4/ip_local_port_range":     "32768\t60999\n",
+		"net/ipv4/conf/eth0.100/rp_filter": "2\n",
+	}
+	for p, v := range files {
+		p = filepath.Join(procSys, p)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NilError(t, os.WriteFile(p, []byte(v), 0o644))
+	}
+	cfg := &Config{
+		Modules: []string{"br_netfilter"},
+		Sysctl: map[string]string{
+			"vm.max_map_count":                 "262144",
+			"net.ipv4.ip_local_port_range":     "32768 60999",
+			"net/ipv4/conf/eth0.100/rp_filter": "0",
+		},
+	}
+	assert.NilError(t, Apply(context.Background(), cfg))
+	assert.DeepEqual(t, loaded, []string{"br_netfilter"})
+	b, err := os.ReadFile(filepath.Join(procSys, "vm/max_map_count"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "262144")
+	b, err = os.ReadFile(filepath.Join(procSys, "net/ipv4/conf/eth0.100/rp_filter"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "0")
+	// the same value is not written
+	b, err = os.ReadFile(filepath.Join(procSys, "net/ipv4/ip_local_port_range"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "32768\t60999\n")
+
+	// the errors are joined, and the rest is applied
+	cfg = &Config{
+		Modules: []string{"missing", "overlay"},
+		Sysctl:  map[string]string{"vm.nonexistent": "1", "vm.max_map_count": "1048576"},
+	}
+	err = Apply(context.Background(), cfg)
+	assert.ErrorContains(t, err, `failed to load kernel module "missing"`)
+	assert.ErrorContains(t, err, `failed to read sysctl "vm.nonexistent"`)
+	assert.DeepEqual(t, loaded, []string{"br_netfilter", "overlay"})
+	b, err = os.ReadFile(filepath.Join(procSys, "vm/max_map_count"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "1048576")
+
+	// invalid keys are rejected before anything is applied
+	err = Apply(context.Background(), &Config{Modules: []string{"overlay"}, Sysctl: map[string]string{"vm/../../../etc/passwd": "x"}})
+	assert.Error(t, err, `invalid sysctl key "vm/../../../etc/passwd"`)
+	assert.DeepEqual(t, loaded, []string{"br_netfilter", "overlay"})
+}
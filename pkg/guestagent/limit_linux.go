@@ -0,0 +1,114 @@
+package guestagent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/sirupsen/logrus"
+)
+
+func (a *agent) LimitProcess(ctx context.Context, req *api.LimitProcessRequest, uid uint32) error {
+	pid := int(req.GetPid())
+	if pid <= 1 {
+		return fmt.Errorf("invalid pid %d", pid)
+	}
+	if req.GetCpus() < 0 || req.GetMemoryBytes() < 0 || req.GetTimeout().AsDuration() < 0 {
+		return errors.New("the limits must not be negative")
+	}
+	owner, err := processUID(pid)
+	if err != nil {
+		return err
+	}
+	if uid != 0 && uid != owner {
+		return fmt.Errorf("process %d is not owned by the requester (UID %d)", pid, uid)
+	}
+	// Same as sd_booted(3)
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return errors.New("limiting the resources requires systemd")
+	}
+	unit := fmt.Sprintf("lima-limit-%d.scope", pid)
+	args := startTransientScopeArgs(unit, req)
+	logrus.Debugf("executing busctl %v", args)
+	cmd := exec.CommandContext(ctx, "busctl", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create %q: %w (out=%q)", unit, err, string(out))
+	}
+	// The process is moved into the scope asynchronously by the job of systemd.
+	return waitProcessInUnit(ctx, pid, unit, 5*time.Second)
+}
+
+// startTransientScopeArgs returns the arguments of busctl(1) for creating the scope with the limits of req.
+func startTransientScopeArgs(unit string, req *api.LimitProcessRequest) []string {
+	props := [][]string{
+		{"Description", "s", "Lima resource limits for process " + strconv.Itoa(int(req.GetPid()))},
+		{"CollectMode", "s", "inactive-or-failed"},
+		{"PIDs", "au", "1", strconv.Itoa(int(req.GetPid()))},
+	}
+	if cpus := req.GetCpus(); cpus > 0 {
+		props = append(props, []string{"CPUQuotaPerSecUSec", "t", strconv.FormatInt(int64(cpus*float64(time.Second/time.Microsecond)), 10)})
+	}
+	if mem := req.GetMemoryBytes(); mem > 0 {
+		props = append(props, []string{"MemoryMax", "t", strconv.FormatInt(mem, 10)})
+	}
+	if timeout := req.GetTimeout().AsDuration(); timeout > 0 {
+		props = append(props, []string{"RuntimeMaxUSec", "t", strconv.FormatInt(timeout.Microseconds(), 10)})
+	}
+	args := []string{
+		"call", "org.freedesktop.systemd1", "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager",
+		"StartTransientUnit", "ssa(sv)a(sa(sv))", unit, "fail", strconv.Itoa(len(props)),
+	}
+	for _, p := range props {
+		args = append(args, p...)
+	}
+	// no auxiliary units
+	return append(args, "0")
+}
+
+// processUID returns the real UID of the process.
+func processUID(pid int) (uint32, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "Uid:" {
+			uid, err := strconv.ParseUint(fields[1], 10, 32)
+			return uint32(uid), err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no UID in the status of process %d", pid)
+}
+
+func waitProcessInUnit(ctx context.Context, pid int, unit string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(b), "/"+unit) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("process %d was not moved into %q: %w", pid, unit, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package guestagent
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gotest.tools/v3/assert"
+)
+
+func TestStartTransientScopeArgs(t *testing.T) {
+	req := &api.LimitProcessRequest{Pid: 42, Cpus: 1.5, MemoryBytes: 1 << 30, Timeout: durationpb.New(10 * time.Minute)}
+	assert.DeepEqual(t, startTransientScopeArgs("lima-limit-42.scope", req), []string{
+		"call", "org.freedesktop.systemd1", "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager",
+		"StartTransientUnit", "ssa(sv)a(sa(sv))", "lima-limit-42.scope", "fail", "6",
+		"Description", "s", "Lima resource limits for process 42",
+		"CollectMode", "s", "inactive-or-failed",
+		"PIDs", "au", "1", "42",
+		"CPUQuotaPerSecUSec", "t", "1500000",
+		"MemoryMax", "t", "1073741824",
+		"RuntimeMaxUSec", "t", "600000000",
+		"0",
+	})
+
+	// unset limits are omitted
+	args := startTransientScopeArgs("lima-limit-42.scope", &api.LimitProcessRequest{Pid: 42})
+	assert.Equal(t, args[8], "3")
+}
+
+func TestProcessUID(t *testing.T) {
+	uid, err := processUID(os.Getpid())
+	assert.NilError(t, err)
+	assert.Equal(t, uid, uint32(os.Getuid()))
+}
@@ -0,0 +1,131 @@
+// Package metrics collects the resource usage of the guest, which is exposed in the Prometheus format
+// by the host agent (`limactl start --metrics-port`).
+package metrics
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/guestagent/mountinfo"
+	"github.com/lima-vm/lima/pkg/guestagent/procnettcp"
+)
+
+// userHZ is the unit of the CPU times in /proc/stat.
+// USER_HZ is 100 on all the architectures supported by Lima.
+const userHZ = 100
+
+// cpuModes are the columns of the "cpu" line of /proc/stat. See proc(5).
+// "guest" and "guest_nice" are omitted, as they are included in "user" and "nice".
+var cpuModes = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+
+// parseProcStat returns the CPU times in seconds summed over all the CPUs, by the mode.
+func parseProcStat(r io.Reader) (map[string]float64, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		res := make(map[string]float64, len(cpuModes))
+		for i, mode := range cpuModes {
+			if i+1 >= len(fields) {
+				break
+			}
+			ticks, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected line in /proc/stat: %q: %w", sc.Text(), err)
+			}
+			res[mode] = float64(ticks) / userHZ
+		}
+		return res, nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("line %q not found in /proc/stat", "cpu")
+}
+
+// parseMemInfo returns MemTotal and MemAvailable of /proc/meminfo in bytes.
+func parseMemInfo(r io.Reader) (total, available uint64, err error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		// MemTotal:        4005504 kB
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 || fields[2] != "kB" {
+			continue
+		}
+		var dst *uint64
+		switch fields[0] {
+		case "MemTotal:":
+			dst = &total
+		case "MemAvailable:":
+			dst = &available
+		default:
+			continue
+		}
+		kib, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unexpected line in /proc/meminfo: %q: %w", sc.Text(), err)
+		}
+		*dst = kib * 1024
+	}
+	return total, available, sc.Err()
+}
+
+// excludedFSTypes are the filesystem types that are not reported, as they are always full.
+var excludedFSTypes = []string{"iso9660", "squashfs", "erofs", "udf"}
+
+// parseMounts returns the filesystems mounted from the block devices from /proc/self/mounts.
+// Each device appears only once, on the first mount point.
+func parseMounts(r io.Reader) ([]*api.DiskMetrics, error) {
+	var res []*api.DiskMetrics
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		// /dev/vda1 / ext4 rw,relatime,discard,errors=remount-ro 0 0
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected line in mounts: %q", sc.Text())
+		}
+		device, mountPoint, fsType := fields[0], mountinfo.Unescape(fields[1]), fields[2]
+		if !strings.HasPrefix(device, "/dev/") || slices.Contains(excludedFSTypes, fsType) || seen[device] {
+			continue
+		}
+		seen[device] = true
+		res = append(res, &api.DiskMetrics{Device: device, MountPoint: mountPoint})
+	}
+	return res, sc.Err()
+}
+
+// portConnections returns the number of the established TCP connections of each listening TCP port, sorted by the port.
+func portConnections(entries []procnettcp.Entry) []*api.PortMetrics {
+	var res []*api.PortMetrics
+	for _, l := range entries {
+		if l.State != procnettcp.TCPListen || (l.Kind != procnettcp.TCP && l.Kind != procnettcp.TCP6) {
+			continue
+		}
+		var conns uint32
+		for _, e := range entries {
+			if e.State != procnettcp.TCPEstablished || e.Kind != l.Kind || e.Port != l.Port {
+				continue
+			}
+			if l.IP.IsUnspecified() || l.IP.Equal(e.IP) {
+				conns++
+			}
+		}
+		res = append(res, &api.PortMetrics{
+			Port:        &api.IPPort{Protocol: "tcp", Ip: l.IP.String(), Port: int32(l.Port)},
+			Connections: conns,
+		})
+	}
+	slices.SortStableFunc(res, func(a, b *api.PortMetrics) int {
+		return cmp.Or(cmp.Compare(a.Port.Port, b.Port.Port), cmp.Compare(a.Port.Ip, b.Port.Ip))
+	})
+	return res
+}
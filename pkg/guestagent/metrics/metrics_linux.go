@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"os"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/guestagent/procnettcp"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/cpu"
+	"golang.org/x/sys/unix"
+)
+
+// Collect returns the CPU, memory, disk, and port metrics of the guest.
+// The inotify stats are filled by the caller.
+func Collect() (*api.Metrics, error) {
+	var m api.Metrics
+	stat, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	m.CpuSeconds, err = parseProcStat(stat)
+	stat.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	memInfo, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	m.MemoryTotalBytes, m.MemoryAvailableBytes, err = parseMemInfo(memInfo)
+	memInfo.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	disks, err := parseMounts(mounts)
+	mounts.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range disks {
+		var st unix.Statfs_t
+		if err := unix.Statfs(d.MountPoint, &st); err != nil {
+			logrus.WithError(err).Debugf("Failed to statfs %q", d.MountPoint)
+			continue
+		}
+		d.SizeBytes = st.Blocks * uint64(st.Bsize)
+		d.AvailableBytes = st.Bavail * uint64(st.Bsize)
+		m.Disks = append(m.Disks, d)
+	}
+
+	// The format of /proc/net/tcp on big endian hosts is not known
+	if !cpu.IsBigEndian {
+		entries, err := procnettcp.ParseFiles()
+		if err != nil {
+			return nil, err
+		}
+		m.Ports = portConnections(entries)
+	}
+	return &m, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package metrics
+
+import (
+	"errors"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+)
+
+func Collect() (*api.Metrics, error) {
+	return nil, errors.ErrUnsupported
+}
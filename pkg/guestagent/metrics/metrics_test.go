@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/guestagent/procnettcp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseProcStat(t *testing.T) {
+	const procStat = `cpu  10132153 290696 3084719 46828483 16683 0 25195 0 175628 0
+cpu0 1393280 32966 572056 13343292 6130 0 17875 0 23933 0
+intr 1462898 0 0
+`
+	cpu, err := parseProcStat(strings.NewReader(procStat))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cpu, map[string]float64{
+		"user":    101321.53,
+		"nice":    2906.96,
+		"system":  30847.19,
+		"idle":    468284.83,
+		"iowait":  166.83,
+		"irq":     0,
+		"softirq": 251.95,
+		"steal":   0,
+	})
+
+	_, err = parseProcStat(strings.NewReader("intr 1462898 0 0\n"))
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestParseMemInfo(t *testing.T) {
+	const memInfo = `MemTotal:        4005504 kB
+MemFree:         2502528 kB
+MemAvailable:    3410092 kB
+HugePages_Total:       0
+`
+	total, available, err := parseMemInfo(strings.NewReader(memInfo))
+	assert.NilError(t, err)
+	assert.Equal(t, total, uint64(4005504*1024))
+	assert.Equal(t, available, uint64(3410092*1024))
+}
+
+func TestParseMounts(t *testing.T) {
+	const mounts = `/dev/vda1 / ext4 rw,relatime,discard,errors=remount-ro 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sr0 /mnt/lima-cidata iso9660 ro,relatime 0 0
+mount0 /Users/foo virtiofs rw,relatime 0 0
+/dev/vda1 /mnt/bind ext4 rw,relatime 0 0
+/dev/vdb1 /mnt/lima-data\040disk xfs rw,relatime 0 0
+`
+	disks, err := parseMounts(strings.NewReader(mounts))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, disks, []*api.DiskMetrics{
+		{Device: "/dev/vda1", MountPoint: "/"},
+		{Device: "/dev/vdb1", MountPoint: "/mnt/lima-data disk"},
+	}, protocmp.Transform())
+}
+
+func TestPortConnections(t *testing.T) {
+	entries := []procnettcp.Entry{
+		{Kind: procnettcp.TCP, IP: net.IPv4zero, Port: 80, State: procnettcp.TCPListen},
+		{Kind: procnettcp.TCP, IP: net.IPv4(127, 0, 0, 1), Port: 8080, State: procnettcp.TCPListen},
+		{Kind: procnettcp.TCP, IP: net.IPv4(192, 168, 5, 15), Port: 80, State: procnettcp.TCPEstablished},
+		{Kind: procnettcp.TCP, IP: net.IPv4(127, 0, 0, 1), Port: 80, State: procnettcp.TCPEstablished},
+		{Kind: procnettcp.TCP, IP: net.IPv4(192, 168, 5, 15), Port: 8080, State: procnettcp.TCPEstablished},
+		// outgoing connection, from an ephemeral port
+		{Kind: procnettcp.TCP, IP: net.IPv4(192, 168, 5, 15), Port: 43210, State: procnettcp.TCPEstablished},
+		{Kind: procnettcp.UDP, IP: net.IPv4zero, Port: 53, State: procnettcp.UDPEstablished},
+	}
+	assert.DeepEqual(t, portConnections(entries), []*api.PortMetrics{
+		{Port: &api.IPPort{Protocol: "tcp", Ip: "0.0.0.0", Port: 80}, Connections: 2},
+		{Port: &api.IPPort{Protocol: "tcp", Ip: "127.0.0.1", Port: 8080}, Connections: 0},
+	}, protocmp.Transform())
+}
@@ -0,0 +1,26 @@
+// Package mountinfo provides the helpers shared by the parsers of /proc/self/mountinfo and /proc/self/mounts.
+package mountinfo
+
+import "strings"
+
+// Unescape unescapes the octal escapes of the fields of /proc/self/mountinfo and /proc/self/mounts,
+// e.g., "\040" for a space.
+func Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			sb.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
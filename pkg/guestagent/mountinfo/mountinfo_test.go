@@ -0,0 +1,21 @@
+package mountinfo
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestUnescape(t *testing.T) {
+	cases := map[string]string{
+		"/":                 "/",
+		`/mnt/my\040disk`:   "/mnt/my disk",
+		`/mnt/a\011b\134c`:  "/mnt/a\tb\\c",
+		`/mnt/trailing\04`:  `/mnt/trailing\04`,
+		`/mnt/not\089octal`: `/mnt/not\089octal`,
+		`/mnt/end\040`:      "/mnt/end ",
+	}
+	for in, expected := range cases {
+		assert.Equal(t, expected, Unescape(in), in)
+	}
+}
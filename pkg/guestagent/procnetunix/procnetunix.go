@@ -0,0 +1,73 @@
+// Package procnetunix parses /proc/net/unix.
+package procnetunix
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Type = int
+
+const (
+	Stream    Type = 0x1
+	Datagram  Type = 0x2
+	SeqPacket Type = 0x5
+)
+
+// FlagAcceptCon is the flag of the listening sockets (__SO_ACCEPTCON).
+const FlagAcceptCon = 0x10000
+
+type Entry struct {
+	Type  Type   `json:"type"`
+	Flags uint32 `json:"flags"`
+	// Path is empty for the unnamed sockets, and starts with "@" for the abstract sockets.
+	Path string `json:"path"`
+}
+
+// Listening returns true if the entry is a listening stream socket.
+func (e Entry) Listening() bool {
+	return (e.Type == Stream || e.Type == SeqPacket) && e.Flags&FlagAcceptCon != 0
+}
+
+// Parse parses /proc/net/unix, e.g.,
+//
+//	Num       RefCount Protocol Flags    Type St Inode Path
+//	0000000000000000: 00000002 00000000 00010000 0001 01 21337 /run/systemd/private
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	for i := 0; sc.Scan(); i++ {
+		line := strings.TrimSpace(sc.Text())
+		if i == 0 || line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			return entries, fmt.Errorf("unparsable line %q", line)
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil {
+			return entries, fmt.Errorf("unparsable flags %q: %w", fields[3], err)
+		}
+		typ, err := strconv.ParseUint(fields[4], 16, 16)
+		if err != nil {
+			return entries, fmt.Errorf("unparsable type %q: %w", fields[4], err)
+		}
+		ent := Entry{
+			Type:  int(typ),
+			Flags: uint32(flags),
+		}
+		if len(fields) > 7 {
+			// The path may contain spaces
+			_, ent.Path, _ = strings.Cut(line, " "+fields[6]+" ")
+		}
+		entries = append(entries, ent)
+	}
+	if err := sc.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,44 @@
+package procnetunix
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParse(t *testing.T) {
+	procNetUnix := `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 21337 /run/systemd/private
+0000000000000000: 00000003 00000000 00000000 0001 03 21338
+0000000000000000: 00000002 00000000 00010000 0001 01 21339 @/tmp/.X11-unix/X0
+0000000000000000: 00000002 00000000 00000000 0002 01 21340 /run/systemd/notify
+0000000000000000: 00000002 00000000 00010000 0005 01 21341 /run/udev/control
+0000000000000000: 00000002 00000000 00010000 0001 01 21342 /home/foo/my project/app.sock
+`
+	entries, err := Parse(strings.NewReader(procNetUnix))
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 6)
+
+	assert.Equal(t, entries[0].Path, "/run/systemd/private")
+	assert.Equal(t, entries[0].Type, Stream)
+	assert.Check(t, entries[0].Listening())
+
+	assert.Equal(t, entries[1].Path, "")
+	assert.Check(t, !entries[1].Listening())
+
+	assert.Equal(t, entries[2].Path, "@/tmp/.X11-unix/X0")
+
+	assert.Equal(t, entries[3].Type, Datagram)
+	assert.Check(t, !entries[3].Listening())
+
+	assert.Equal(t, entries[4].Type, SeqPacket)
+	assert.Check(t, entries[4].Listening())
+
+	assert.Equal(t, entries[5].Path, "/home/foo/my project/app.sock")
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(strings.NewReader("Num RefCount Protocol Flags Type St Inode Path\n0000: 00000002 00000000\n"))
+	assert.ErrorContains(t, err, "unparsable line")
+}
@@ -0,0 +1,65 @@
+// Package telemetry reads the resource usage counters of the guest for `limactl stats` (GetTelemetry),
+// as an alternative to reading them over SSH.
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// procfs is the mount point of procfs. Replaced in the tests.
+var procfs = "/proc"
+
+// files are the files of procfs needed for `limactl stats`.
+var files = []string{"stat", "meminfo", "diskstats", "net/dev"}
+
+// Read returns the contents of the files needed for `limactl stats`, each preceded by a "==> /proc/FILE" line.
+// When processes is true, the page size and the stat and the last line of the cgroup of each process, separated by a tab,
+// are appended in the "pagesize" and "processes" sections.
+// The format is the same as the output of the script that reads them over SSH.
+func Read(processes bool) (string, error) {
+	var sb strings.Builder
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(procfs, f))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "==> /proc/%s\n", f)
+		sb.Write(b)
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			sb.WriteByte('\n')
+		}
+	}
+	if !processes {
+		return sb.String(), nil
+	}
+	fmt.Fprintf(&sb, "==> pagesize\n%d\n==> processes\n", os.Getpagesize())
+	entries, err := os.ReadDir(procfs)
+	if err != nil {
+		return "", err
+	}
+	var pids []int
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	slices.Sort(pids)
+	for _, pid := range pids {
+		dir := filepath.Join(procfs, strconv.Itoa(pid))
+		stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			// The process has exited
+			continue
+		}
+		// The error is ignored, as with `tail -n 1 "$d/cgroup" 2>/dev/null`
+		cgroup, _ := os.ReadFile(filepath.Join(dir, "cgroup"))
+		cgroupLines := strings.Split(strings.TrimRight(string(cgroup), "\n"), "\n")
+		fmt.Fprintf(&sb, "%s\t%s\n", strings.TrimRight(string(stat), "\n"), cgroupLines[len(cgroupLines)-1])
+	}
+	return sb.String(), nil
+}
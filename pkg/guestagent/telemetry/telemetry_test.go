@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRead(t *testing.T) {
+	procfs = t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(procfs, name)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NilError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	write("stat", "cpu  1 2 3 4 5 6 7 8 0 0\n")
+	write("meminfo", "MemTotal: 1024 kB\n")
+	write("diskstats", "")
+	write("net/dev", "eth0: 1 2")
+	write("1/stat", "1 (systemd) S 0\n")
+	write("1/cgroup", "0::/init.scope\n")
+	write("20/stat", "20 (bash) S 1\n")
+	write("20/cgroup", "12:cpu:/\n0::/user.slice\n")
+	write("3/stat", "3 (kthreadd) S 0\n")
+	write("self/stat", "99 (self) R 1\n")
+
+	counters, err := Read(false)
+	assert.NilError(t, err)
+	expected := "==> /proc/stat\ncpu  1 2 3 4 5 6 7 8 0 0\n" +
+		"==> /proc/meminfo\nMemTotal: 1024 kB\n" +
+		"==> /proc/diskstats\n" +
+		"==> /proc/net/dev\neth0: 1 2\n"
+	assert.Equal(t, counters, expected)
+
+	counters, err = Read(true)
+	assert.NilError(t, err)
+	expected += fmt.Sprintf("==> pagesize\n%d\n==> processes\n", os.Getpagesize()) +
+		"1 (systemd) S 0\t0::/init.scope\n" +
+		"3 (kthreadd) S 0\t\n" +
+		"20 (bash) S 1\t0::/user.slice\n"
+	assert.Equal(t, counters, expected)
+}
@@ -0,0 +1,204 @@
+// Package guiforward sets up the forwarding of the GUI applications of the guest to the display server of the host,
+// for `limactl gui-run`.
+package guiforward
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// Backend is the way to forward the GUI applications.
+type Backend string
+
+const (
+	// X11 forwards X11 over ssh (ssh -X).
+	// The display server of the host is XQuartz on macOS.
+	X11 Backend = "x11"
+	// Wayland forwards Wayland with waypipe over ssh.
+	Wayland Backend = "wayland"
+	// WSLg uses the display server of WSLg, which is available in the WSL2 guest without forwarding.
+	WSLg Backend = "wslg"
+)
+
+// Backends are the valid backends.
+var Backends = []Backend{X11, Wayland, WSLg}
+
+// ParseBackend parses the backend name. An empty string is returned for "auto".
+func ParseBackend(s string) (Backend, error) {
+	if s == "" || s == "auto" {
+		return "", nil
+	}
+	for _, b := range Backends {
+		if Backend(s) == b {
+			return b, nil
+		}
+	}
+	return "", fmt.Errorf("invalid backend %q, must be one of: auto, x11, wayland, wslg", s)
+}
+
+// Host is the display environment of the host.
+type Host struct {
+	GOOS string
+	// Display is $DISPLAY
+	Display string
+	// WaylandDisplay is $WAYLAND_DISPLAY
+	WaylandDisplay string
+	// Waypipe is true when the waypipe command is installed
+	Waypipe bool
+	// XQuartz is true when XQuartz is installed (macOS)
+	XQuartz bool
+}
+
+// DetectHost detects the display environment of the host.
+func DetectHost() Host {
+	h := Host{
+		GOOS:           runtime.GOOS,
+		Display:        os.Getenv("DISPLAY"),
+		WaylandDisplay: os.Getenv("WAYLAND_DISPLAY"),
+	}
+	if _, err := exec.LookPath("waypipe"); err == nil {
+		h.Waypipe = true
+	}
+	if runtime.GOOS == "darwin" {
+		for _, app := range xquartzApps {
+			if _, err := os.Stat(app); err == nil {
+				h.XQuartz = true
+				break
+			}
+		}
+	}
+	return h
+}
+
+// Backend returns the backend to be used for the vmType.
+// When want is empty, the backend is chosen in the order of WSLg (for WSL2), Wayland, and X11.
+func (h Host) Backend(vmType limayaml.VMType, want Backend) (Backend, error) {
+	canX11 := h.Display != "" || h.XQuartz
+	canWayland := h.WaylandDisplay != "" && h.Waypipe
+	switch want {
+	case "":
+		switch {
+		case vmType == limayaml.WSL2:
+			return WSLg, nil
+		case canWayland:
+			return Wayland, nil
+		case canX11:
+			return X11, nil
+		}
+		return "", errors.New(h.noDisplayHint())
+	case X11:
+		if !canX11 {
+			return "", errors.New(h.noDisplayHint())
+		}
+	case Wayland:
+		if h.WaylandDisplay == "" {
+			return "", errors.New("backend wayland requires a Wayland session on the host ($WAYLAND_DISPLAY is not set)")
+		}
+		if !h.Waypipe {
+			return "", errors.New("backend wayland requires waypipe to be installed on the host")
+		}
+	case WSLg:
+		if vmType != limayaml.WSL2 {
+			return "", fmt.Errorf("backend wslg requires vmType %q, got %q", limayaml.WSL2, vmType)
+		}
+	default:
+		return "", fmt.Errorf("unknown backend %q", want)
+	}
+	return want, nil
+}
+
+func (h Host) noDisplayHint() string {
+	if h.GOOS == "darwin" {
+		return "no X11 display server was found on the host, install XQuartz (https://www.xquartz.org/) to run GUI applications"
+	}
+	return "no display server was found on the host ($DISPLAY and $WAYLAND_DISPLAY are not set), run in a graphical session"
+}
+
+// guestPackage is a package to be installed in the guest, with the package names for each package manager.
+type guestPackage struct {
+	command string
+	apt     string
+	dnf     string
+	zypper  string
+	apk     string
+	pacman  string
+}
+
+var (
+	xauthPackage   = guestPackage{command: "xauth", apt: "xauth", dnf: "xorg-x11-xauth", zypper: "xauth", apk: "xauth", pacman: "xorg-xauth"}
+	waypipePackage = guestPackage{command: "waypipe", apt: "waypipe", dnf: "waypipe", zypper: "waypipe", apk: "waypipe", pacman: "waypipe"}
+)
+
+func (b Backend) guestPackages() []guestPackage {
+	switch b {
+	case X11:
+		// sshd sets $DISPLAY only when xauth is installed
+		return []guestPackage{xauthPackage}
+	case Wayland:
+		return []guestPackage{waypipePackage}
+	}
+	return nil
+}
+
+// PrepareScript returns the script that installs the commands required in the guest for the backend,
+// using the package manager of the guest.
+// An empty string is returned when nothing is required.
+func PrepareScript(b Backend) string {
+	pkgs := b.guestPackages()
+	if len(pkgs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("set -e\n")
+	for _, p := range pkgs {
+		fmt.Fprintf(&sb, `if ! command -v %[1]s >/dev/null 2>&1; then
+  echo "Installing %[1]s in the guest" >&2
+  if command -v apt-get >/dev/null 2>&1; then
+    sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq %[2]s >/dev/null || { sudo apt-get update -qq && sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -qq %[2]s >/dev/null; }
+  elif command -v dnf >/dev/null 2>&1; then
+    sudo dnf install -y -q %[3]s
+  elif command -v zypper >/dev/null 2>&1; then
+    sudo zypper --non-interactive --quiet install %[4]s
+  elif command -v apk >/dev/null 2>&1; then
+    sudo apk add -q %[5]s
+  elif command -v pacman >/dev/null 2>&1; then
+    sudo pacman -S --noconfirm --needed %[6]s
+  else
+    echo "%[1]s is not installed in the guest, and no supported package manager was found" >&2
+    exit 1
+  fi
+fi
+`, p.command, p.apt, p.dnf, p.zypper, p.apk, p.pacman)
+	}
+	return sb.String()
+}
+
+// RunScript returns the script that runs the command in the guest, with the environment variables
+// that make the GUI toolkits use the backend.
+func RunScript(b Backend, args []string) string {
+	var sb strings.Builder
+	switch b {
+	case X11:
+		sb.WriteString(`if [ -z "$DISPLAY" ]; then echo "DISPLAY is not set in the guest, make sure that xauth is installed and X11Forwarding is enabled in /etc/ssh/sshd_config" >&2; exit 1; fi; `)
+		sb.WriteString("unset WAYLAND_DISPLAY; export GDK_BACKEND=x11 QT_QPA_PLATFORM=xcb MOZ_ENABLE_WAYLAND=0; ")
+	case Wayland:
+		// $WAYLAND_DISPLAY is set by `waypipe server`
+		sb.WriteString("unset DISPLAY; export GDK_BACKEND=wayland QT_QPA_PLATFORM=wayland MOZ_ENABLE_WAYLAND=1 SDL_VIDEODRIVER=wayland; ")
+	case WSLg:
+		// The ssh session does not inherit the variables set by WSL for the processes launched by wsl.exe
+		sb.WriteString(`export DISPLAY="${DISPLAY:-:0}" WAYLAND_DISPLAY="${WAYLAND_DISPLAY:-/mnt/wslg/runtime-dir/wayland-0}" PULSE_SERVER="${PULSE_SERVER:-unix:/mnt/wslg/PulseServer}"; `)
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellescape.Quote(arg)
+	}
+	sb.WriteString("exec " + strings.Join(quoted, " "))
+	return sb.String()
+}
@@ -0,0 +1,61 @@
+package guiforward
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseBackend(t *testing.T) {
+	b, err := ParseBackend("auto")
+	assert.NilError(t, err)
+	assert.Equal(t, b, Backend(""))
+	b, err = ParseBackend("wayland")
+	assert.NilError(t, err)
+	assert.Equal(t, b, Wayland)
+	_, err = ParseBackend("vnc")
+	assert.ErrorContains(t, err, "must be one of")
+}
+
+func TestHostBackend(t *testing.T) {
+	cases := []struct {
+		name   string
+		host   Host
+		vmType limayaml.VMType
+		want   Backend
+		exp    Backend
+		err    string
+	}{
+		{name: "wsl2", host: Host{GOOS: "windows"}, vmType: limayaml.WSL2, exp: WSLg},
+		{name: "wayland", host: Host{GOOS: "linux", Display: ":0", WaylandDisplay: "wayland-0", Waypipe: true}, vmType: limayaml.QEMU, exp: Wayland},
+		{name: "wayland without waypipe", host: Host{GOOS: "linux", Display: ":0", WaylandDisplay: "wayland-0"}, vmType: limayaml.QEMU, exp: X11},
+		{name: "xquartz", host: Host{GOOS: "darwin", XQuartz: true}, vmType: limayaml.VZ, exp: X11},
+		{name: "no xquartz", host: Host{GOOS: "darwin"}, vmType: limayaml.VZ, err: "install XQuartz"},
+		{name: "no display", host: Host{GOOS: "linux"}, vmType: limayaml.QEMU, err: "no display server"},
+		{name: "explicit x11", host: Host{GOOS: "linux", Display: ":0", WaylandDisplay: "wayland-0", Waypipe: true}, vmType: limayaml.QEMU, want: X11, exp: X11},
+		{name: "explicit wayland without waypipe", host: Host{GOOS: "linux", WaylandDisplay: "wayland-0"}, vmType: limayaml.QEMU, want: Wayland, err: "waypipe"},
+		{name: "explicit wslg", host: Host{GOOS: "darwin"}, vmType: limayaml.VZ, want: WSLg, err: "requires vmType"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := tc.host.Backend(tc.vmType, tc.want)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, b, tc.exp)
+		})
+	}
+}
+
+func TestScripts(t *testing.T) {
+	assert.Equal(t, PrepareScript(WSLg), "")
+	assert.Assert(t, strings.Contains(PrepareScript(X11), "sudo dnf install -y -q xorg-x11-xauth"))
+
+	script := RunScript(X11, []string{"firefox", "--new-window", "https://example.com/?a=1&b=2"})
+	assert.Assert(t, strings.Contains(script, "export GDK_BACKEND=x11"))
+	assert.Assert(t, strings.Contains(script, "exec firefox --new-window 'https://example.com/?a=1&b=2'"))
+}
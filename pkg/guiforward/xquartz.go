@@ -0,0 +1,47 @@
+package guiforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var xquartzApps = []string{
+	"/Applications/Utilities/XQuartz.app",
+	"/Applications/XQuartz.app",
+}
+
+// xquartzSocket is the socket of display ":0" of XQuartz.
+const xquartzSocket = "/tmp/.X11-unix/X0"
+
+// StartXQuartz launches XQuartz, and returns the display when XQuartz is ready to accept connections.
+// StartXQuartz is used when $DISPLAY is not set, e.g., XQuartz was installed after logging in to macOS.
+func StartXQuartz(ctx context.Context) (string, error) {
+	if runtime.GOOS != "darwin" {
+		return "", errors.New("XQuartz is only available on macOS")
+	}
+	logrus.Info("Launching XQuartz")
+	if out, err := exec.CommandContext(ctx, "open", "-a", "XQuartz").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to launch XQuartz: %w (out=%q)", err, string(out))
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(xquartzSocket); err == nil {
+			return ":0", nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("XQuartz did not create %q: %w", xquartzSocket, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -3,3 +3,33 @@ package api
 type Info struct {
 	SSHLocalPort int `json:"sshLocalPort,omitempty"`
 }
+
+// Hosts is the request body of POST /v1/hosts.
+type Hosts struct {
+	// Hosts replaces `hostResolver.hosts` of the running instance.
+	Hosts map[string]string `json:"hosts"`
+	// EtcHosts also writes the hosts with IP addresses to /etc/hosts in the guest.
+	EtcHosts bool `json:"etcHosts,omitempty"`
+}
+
+// KernelConfig is the request body of POST /v1/kernel-config.
+type KernelConfig struct {
+	// Modules are the kernel modules to be loaded (`kernel.modules`).
+	Modules []string `json:"modules,omitempty"`
+	// Sysctl are the sysctl values to be set (`sysctl`).
+	Sysctl map[string]string `json:"sysctl,omitempty"`
+}
+
+// SnapshotDisk is the request body of POST /v1/snapshot-disk.
+type SnapshotDisk struct {
+	// Path is the path of the copy of the disk to be written.
+	Path string `json:"path"`
+	// Quiesce freezes the filesystems of the guest while the point in time of the copy is fixed.
+	Quiesce bool `json:"quiesce,omitempty"`
+}
+
+// Telemetry is the response body of GET /v1/telemetry.
+type Telemetry struct {
+	// Counters are the resource usage counters of the guest, in the format parsed by `limactl stats`.
+	Counters string `json:"counters"`
+}
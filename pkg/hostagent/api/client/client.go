@@ -4,18 +4,29 @@ package client
 // Apache License 2.0
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/lima-vm/lima/pkg/hostagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/httpclientutil"
 )
 
 type HostAgentClient interface {
 	HTTPClient() *http.Client
 	Info(context.Context) (*api.Info, error)
+	SetHosts(context.Context, *api.Hosts) error
+	ApplyKernelConfig(context.Context, *api.KernelConfig) error
+	Suspend(context.Context) error
+	SnapshotDisk(context.Context, *api.SnapshotDisk) error
+	Telemetry(ctx context.Context, processes bool) (*api.Telemetry, error)
+	Events(ctx context.Context, follow bool, onEvent func(events.Event) bool) error
 }
 
 // NewHostAgentClient creates a client.
@@ -62,3 +73,94 @@ func (c *client) Info(ctx context.Context) (*api.Info, error) {
 	}
 	return &info, nil
 }
+
+func (c *client) SetHosts(ctx context.Context, hosts *api.Hosts) error {
+	b, err := json.Marshal(hosts)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("http://%s/%s/hosts", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) ApplyKernelConfig(ctx context.Context, cfg *api.KernelConfig) error {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("http://%s/%s/kernel-config", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) Suspend(ctx context.Context) error {
+	u := fmt.Sprintf("http://%s/%s/suspend", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, http.NoBody)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) SnapshotDisk(ctx context.Context, req *api.SnapshotDisk) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("http://%s/%s/snapshot-disk", c.dummyHost, c.version)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *client) Telemetry(ctx context.Context, processes bool) (*api.Telemetry, error) {
+	u := fmt.Sprintf("http://%s/%s/telemetry?processes=%s", c.dummyHost, c.version, strconv.FormatBool(processes))
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var telemetry api.Telemetry
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&telemetry); err != nil {
+		return nil, err
+	}
+	return &telemetry, nil
+}
+
+// Events calls onEvent for the events since the host agent was started.
+// When follow is true, onEvent is called for the new events too, until onEvent returns true,
+// ctx is cancelled, or the host agent exits.
+func (c *client) Events(ctx context.Context, follow bool, onEvent func(events.Event) bool) error {
+	u := fmt.Sprintf("http://%s/%s/events?follow=%s", c.dummyHost, c.version, strconv.FormatBool(follow))
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev events.Event
+		if err := dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if stop := onEvent(ev); stop {
+			return nil
+		}
+	}
+}
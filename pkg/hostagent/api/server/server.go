@@ -3,9 +3,13 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"path/filepath"
+	"strconv"
 
 	"github.com/lima-vm/lima/pkg/hostagent"
+	"github.com/lima-vm/lima/pkg/hostagent/api"
 	"github.com/lima-vm/lima/pkg/httputil"
 )
 
@@ -50,6 +54,179 @@ func (b *Backend) GetInfo(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(m)
 }
 
+// PostHosts is the handler for POST /v1/hosts.
+func (b *Backend) PostHosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var hosts api.Hosts
+	if err := json.NewDecoder(r.Body).Decode(&hosts); err != nil {
+		b.onError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := b.Agent.SetHosts(r.Context(), hosts.Hosts, hosts.EtcHosts); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostKernelConfig is the handler for POST /v1/kernel-config.
+func (b *Backend) PostKernelConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var cfg api.KernelConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		b.onError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := b.Agent.ApplyKernelConfig(r.Context(), cfg.Modules, cfg.Sysctl); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostSuspend is the handler for POST /v1/suspend.
+// The response is sent after the VM state has been saved; the host agent exits soon after that.
+func (b *Backend) PostSuspend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The migration is not cancelled by a disconnection of the client
+	if err := b.Agent.Suspend(context.WithoutCancel(r.Context())); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostSnapshotDisk is the handler for POST /v1/snapshot-disk.
+// The response is sent after the copy of the disk has been written.
+func (b *Backend) PostSnapshotDisk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req api.SnapshotDisk
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		b.onError(w, err, http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsAbs(req.Path) {
+		b.onError(w, fmt.Errorf("expected an absolute path, got %q", req.Path), http.StatusBadRequest)
+		return
+	}
+	if err := b.Agent.SnapshotDisk(r.Context(), req.Path, req.Quiesce); err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTelemetry is the handler for GET /v1/telemetry.
+// When the query parameter "processes" is true, the counters of the processes are included too.
+func (b *Backend) GetTelemetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var processes bool
+	if s := r.URL.Query().Get("processes"); s != "" {
+		var err error
+		processes, err = strconv.ParseBool(s)
+		if err != nil {
+			b.onError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	telemetry, err := b.Agent.Telemetry(r.Context(), processes)
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	m, err := json.Marshal(telemetry)
+	if err != nil {
+		b.onError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(m)
+}
+
+// GetEvents is the handler for GET /v1/events.
+// The events since the host agent was started are streamed as JSON lines.
+// When the query parameter "follow" is true, the new events are streamed too, until the host agent exits.
+func (b *Backend) GetEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var follow bool
+	if s := r.URL.Query().Get("follow"); s != "" {
+		var err error
+		follow, err = strconv.ParseBool(s)
+		if err != nil {
+			b.onError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, ch, unsubscribe := b.Agent.SubscribeEvents()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, ev := range history {
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+	}
+	if !follow {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				// The client did not keep up with the events; it can reconnect to receive the history again
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			if ev.Status.Exiting {
+				if flusher != nil {
+					flusher.Flush()
+				}
+				return
+			}
+		}
+	}
+}
+
 func AddRoutes(r *http.ServeMux, b *Backend) {
 	r.Handle("/v1/info", http.HandlerFunc(b.GetInfo))
+	r.Handle("/v1/hosts", http.HandlerFunc(b.PostHosts))
+	r.Handle("/v1/kernel-config", http.HandlerFunc(b.PostKernelConfig))
+	r.Handle("/v1/suspend", http.HandlerFunc(b.PostSuspend))
+	r.Handle("/v1/snapshot-disk", http.HandlerFunc(b.PostSnapshotDisk))
+	r.Handle("/v1/telemetry", http.HandlerFunc(b.GetTelemetry))
+	r.Handle("/v1/events", http.HandlerFunc(b.GetEvents))
 }
@@ -0,0 +1,70 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// freezeTimeout is the maximum duration of freezing the filesystems of the guest for SnapshotDisk.
+// The guest agent thaws the filesystems after it, even when the host agent fails to thaw them.
+const freezeTimeout = time.Minute
+
+// SnapshotDisk writes a crash-consistent copy of the disk of the running instance to dst, for `limactl clone`.
+// With quiesce, the filesystems of the guest are frozen via the guest agent until the point in time
+// of the copy has been fixed, so that the copy is consistent at the filesystem level too.
+func (a *HostAgent) SnapshotDisk(ctx context.Context, dst string, quiesce bool) error {
+	if caps, ok := limayaml.LookupDriverCapabilities(*a.instConfig.VMType); ok && !caps.LiveClone {
+		return fmt.Errorf("vmType %s does not support cloning the running instance", *a.instConfig.VMType)
+	}
+	if a.suspending.Load() {
+		return errors.New("the instance is being suspended")
+	}
+	thaw := func() {}
+	if quiesce {
+		a.clientMu.RLock()
+		client := a.client
+		a.clientMu.RUnlock()
+		if client == nil {
+			return errors.New("the guest agent is not connected yet")
+		}
+		info, err := client.Info(ctx)
+		if err != nil {
+			return err
+		}
+		if !info.HasCapability(guestagentapi.CapabilityFSFreeze) {
+			return fmt.Errorf("the guest agent does not support %q; restart the instance to update the guest agent, or clone without quiescing", guestagentapi.CapabilityFSFreeze)
+		}
+		if err := client.Freeze(ctx, freezeTimeout); err != nil {
+			return fmt.Errorf("failed to freeze the filesystems of the guest: %w", err)
+		}
+		thawed := false
+		thaw = func() {
+			if thawed {
+				return
+			}
+			thawed = true
+			// Thawed even when ctx is cancelled, as the guest cannot write to the filesystems until then
+			if err := client.Thaw(context.WithoutCancel(ctx)); err != nil {
+				logrus.WithError(err).Error("Failed to thaw the filesystems of the guest")
+			}
+		}
+		defer thaw()
+	}
+	wait, err := a.driver.SnapshotDisk(ctx, dst)
+	if err != nil {
+		return err
+	}
+	// The guest does not need to be frozen while the rest of the copy is being written
+	thaw()
+	if err := wait(); err != nil {
+		return err
+	}
+	logrus.Infof("Snapshotted the disk to %q", dst)
+	return nil
+}
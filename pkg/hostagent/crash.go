@@ -0,0 +1,193 @@
+package hostagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// crashLogs are the serial console logs that are scanned for kernel panics.
+// The kernel prints a panic to all of its consoles, so the same panic may appear in more than one log.
+var crashLogs = filenames.SerialLogs()
+
+const (
+	// crashLogTail is the number of the last bytes of each serial console log that are preserved on a panic.
+	crashLogTail = 1 << 20
+	// crashSettleDelay is the time to wait for the rest of the panic trace to be written to the logs.
+	crashSettleDelay = 3 * time.Second
+
+	panicMarker = "Kernel panic - not syncing"
+)
+
+// bootLineRegexp matches the banner printed by the kernel at the very beginning of a boot.
+var bootLineRegexp = regexp.MustCompile(`\[\s*0\.0+\] Linux version `)
+
+// panicMessage returns the panic message in a line of a serial console log, e.g.,
+// "[   42.123456] Kernel panic - not syncing: sysrq triggered crash".
+func panicMessage(line string) (string, bool) {
+	i := strings.Index(line, panicMarker)
+	if i < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(line[i:]), true
+}
+
+// serialLogScanner reads the lines appended to a serial console log since the last scan.
+type serialLogScanner struct {
+	path   string
+	offset int64
+}
+
+// scan returns the complete lines appended since the last scan.
+// The log is read from the beginning again when it has been truncated, e.g., on the restart of the driver.
+func (s *serialLogScanner) scan() ([]string, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < s.offset {
+		s.offset = 0
+	}
+	b, err := io.ReadAll(io.NewSectionReader(f, s.offset, st.Size()-s.offset))
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndexByte(b, '\n')
+	if i < 0 {
+		return nil, nil
+	}
+	s.offset += int64(i + 1)
+	return strings.Split(string(b[:i]), "\n"), nil
+}
+
+// watchCrash watches the serial console logs for kernel panics, and captures the artifacts of each panic.
+// A panic is not captured again until the guest has booted after it.
+func (a *HostAgent) watchCrash(ctx context.Context) {
+	scanners := make([]*serialLogScanner, len(crashLogs))
+	for i, name := range crashLogs {
+		scanners[i] = &serialLogScanner{path: filepath.Join(a.instDir, name)}
+	}
+	var crash *events.Crash
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, s := range scanners {
+			lines, err := s.scan()
+			if err != nil {
+				logrus.WithError(err).Debugf("failed to scan %q", s.path)
+				continue
+			}
+			for _, line := range lines {
+				if msg, ok := panicMessage(line); ok && (crash == nil || crash.Rebooted) {
+					crash = a.captureCrash(ctx, msg)
+				} else if crash != nil && !crash.Rebooted && bootLineRegexp.MatchString(line) {
+					logrus.Info("The guest has booted again after the kernel panic")
+					crash.Rebooted = true
+					a.recordCrash(ctx, crash)
+				}
+			}
+		}
+	}
+}
+
+// captureCrash preserves the serial console logs, and the vmcore when `crashCapture.vmcore` is set,
+// under a new subdirectory of the CrashDir, and records the crash.
+func (a *HostAgent) captureCrash(ctx context.Context, message string) *events.Crash {
+	logrus.Errorf("The guest kernel panicked: %q", message)
+	now := time.Now()
+	crash := &events.Crash{
+		Time:    now,
+		Message: message,
+		Dir:     filepath.Join(a.instDir, filenames.CrashDir, now.UTC().Format("20060102T150405Z")),
+	}
+	if err := os.MkdirAll(crash.Dir, 0o755); err != nil {
+		logrus.WithError(err).Warn("failed to create the crash directory")
+		a.recordCrash(ctx, crash)
+		return crash
+	}
+	if *a.instConfig.CrashCapture.VMCore {
+		// Dump the memory first, as the guest may reboot by itself, depending on the `kernel.panic` sysctl.
+		// The dump takes longer than crashSettleDelay.
+		vmcore := filepath.Join(crash.Dir, filenames.VMCore)
+		if err := a.driver.DumpGuestMemory(ctx, vmcore); err != nil {
+			logrus.WithError(err).Warn("failed to dump the guest memory")
+		} else {
+			crash.VMCore = vmcore
+		}
+	} else {
+		select {
+		case <-ctx.Done():
+		case <-time.After(crashSettleDelay):
+		}
+	}
+	for _, name := range crashLogs {
+		err := copyTail(filepath.Join(a.instDir, name), filepath.Join(crash.Dir, name), crashLogTail)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.WithError(err).Warnf("failed to preserve %q", name)
+		}
+	}
+	logrus.Infof("The artifacts of the kernel panic are saved in %q", crash.Dir)
+	a.recordCrash(ctx, crash)
+	return crash
+}
+
+// recordCrash emits the crash as an event, and persists it for `limactl list`.
+func (a *HostAgent) recordCrash(ctx context.Context, crash *events.Crash) {
+	a.emitEvent(ctx, events.Event{Crash: crash})
+	b, err := json.Marshal(crash)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to marshal the crash")
+		return
+	}
+	if err := os.WriteFile(filepath.Join(a.instDir, filenames.Crash), b, 0o644); err != nil {
+		logrus.WithError(err).Warn("failed to record the crash")
+	}
+}
+
+// copyTail copies the last n bytes of src to dst.
+func copyTail(src, dst string, n int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if off := st.Size() - n; off > 0 {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, f)
+	return errors.Join(err, out.Close())
+}
@@ -5,9 +5,11 @@ package dns
 import (
 	"fmt"
 	"net"
+	"net/http"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
@@ -35,6 +37,8 @@ type HandlerOptions struct {
 	StaticHosts     map[string]string
 	UpstreamServers []string
 	TruncateReply   bool
+	// Rules route the queries for the domains to explicit upstream servers
+	Rules []Rule
 }
 
 type ServerOptions struct {
@@ -49,13 +53,25 @@ type Handler struct {
 	clientConfig *dns.ClientConfig
 	clients      []*dns.Client
 	ipv6         bool
-	cnameToHost  map[string]string
-	hostToIP     map[string]net.IP
+	rules        []Rule
+	httpClient   *http.Client
+
+	mu          sync.RWMutex
+	cnameToHost map[string]string
+	hostToIP    map[string]net.IP
 }
 
 type Server struct {
-	udp *dns.Server
-	tcp *dns.Server
+	udp      *dns.Server
+	tcp      *dns.Server
+	handlers []*Handler
+}
+
+// SetStaticHosts replaces the static hosts of the running server.
+func (s *Server) SetStaticHosts(hosts map[string]string) {
+	for _, h := range s.handlers {
+		h.SetStaticHosts(hosts)
+	}
 }
 
 func (s *Server) Shutdown() {
@@ -77,16 +93,16 @@ func newStaticClientConfig(ips []string) (*dns.ClientConfig, error) {
 	return dns.ClientConfigFromReader(r)
 }
 
-func (h *Handler) lookupCnameToHost(cname string) string {
+func lookupCnameToHost(cnameToHost map[string]string, cname string) string {
 	seen := make(map[string]bool)
 	for {
 		// break cyclic definition
 		if seen[cname] {
 			break
 		}
-		if _, ok := h.cnameToHost[cname]; ok {
+		if _, ok := cnameToHost[cname]; ok {
 			seen[cname] = true
-			cname = h.cnameToHost[cname]
+			cname = cnameToHost[cname]
 			continue
 		}
 		break
@@ -94,7 +110,36 @@ func (h *Handler) lookupCnameToHost(cname string) string {
 	return cname
 }
 
+// SetStaticHosts replaces the static hosts.
+// Values can be either other hostnames, or IP addresses.
+func (h *Handler) SetStaticHosts(hosts map[string]string) {
+	cnameToHost := make(map[string]string)
+	hostToIP := make(map[string]net.IP)
+	for host, address := range hosts {
+		cname := dns.CanonicalName(host)
+		if ip := net.ParseIP(address); ip != nil {
+			hostToIP[cname] = ip
+		} else {
+			cnameToHost[cname] = dns.CanonicalName(address)
+		}
+	}
+	h.mu.Lock()
+	h.cnameToHost, h.hostToIP = cnameToHost, hostToIP
+	h.mu.Unlock()
+}
+
+// staticHosts returns the current static hosts, which must not be modified.
+func (h *Handler) staticHosts() (cnameToHost map[string]string, hostToIP map[string]net.IP) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cnameToHost, h.hostToIP
+}
+
 func NewHandler(opts HandlerOptions) (dns.Handler, error) {
+	return newHandler(opts)
+}
+
+func newHandler(opts HandlerOptions) (*Handler, error) {
 	var cc *dns.ClientConfig
 	var err error
 	if len(opts.UpstreamServers) == 0 {
@@ -127,22 +172,19 @@ func NewHandler(opts HandlerOptions) (dns.Handler, error) {
 		{}, // UDP
 		{Net: "tcp"},
 	}
+	rules, err := newRules(opts.Rules)
+	if err != nil {
+		return nil, err
+	}
 	h := &Handler{
 		truncate:     opts.TruncateReply,
 		clientConfig: cc,
 		clients:      clients,
 		ipv6:         opts.IPv6,
-		cnameToHost:  make(map[string]string),
-		hostToIP:     make(map[string]net.IP),
-	}
-	for host, address := range opts.StaticHosts {
-		cname := dns.CanonicalName(host)
-		if ip := net.ParseIP(address); ip != nil {
-			h.hostToIP[cname] = ip
-		} else {
-			h.cnameToHost[cname] = dns.CanonicalName(address)
-		}
+		rules:        rules,
+		httpClient:   &http.Client{Timeout: dohTimeout},
 	}
+	h.SetStaticHosts(opts.StaticHosts)
 	return h, nil
 }
 
@@ -154,6 +196,7 @@ func (h *Handler) handleQuery(w dns.ResponseWriter, req *dns.Msg) {
 	defer w.Close()
 	reply.SetReply(req)
 	logrus.Tracef("handleQuery received DNS query: %v", req)
+	cnameToHost, hostToIP := h.staticHosts()
 	for _, q := range req.Question {
 		hdr := dns.RR_Header{
 			Name:   q.Name,
@@ -182,9 +225,9 @@ func (h *Handler) handleQuery(w dns.ResponseWriter, req *dns.Msg) {
 		case dns.TypeA:
 			var err error
 			var addrs []net.IP
-			cname := h.lookupCnameToHost(q.Name)
-			if _, ok := h.hostToIP[cname]; ok {
-				addrs = []net.IP{h.hostToIP[cname]}
+			cname := lookupCnameToHost(cnameToHost, q.Name)
+			if _, ok := hostToIP[cname]; ok {
+				addrs = []net.IP{hostToIP[cname]}
 			} else {
 				addrs, err = net.LookupIP(cname)
 				if err != nil {
@@ -214,9 +257,9 @@ func (h *Handler) handleQuery(w dns.ResponseWriter, req *dns.Msg) {
 				handled = true
 			}
 		case dns.TypeCNAME:
-			cname := h.lookupCnameToHost(q.Name)
+			cname := lookupCnameToHost(cnameToHost, q.Name)
 			var err error
-			if _, ok := h.hostToIP[cname]; !ok {
+			if _, ok := hostToIP[cname]; !ok {
 				cname, err = net.LookupCNAME(cname)
 				if err != nil {
 					logrus.WithError(err).Debug("handleQuery lookup CNAME failed")
@@ -349,6 +392,10 @@ func (h *Handler) handleDefault(w dns.ResponseWriter, req *dns.Msg) {
 func (h *Handler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
 	switch req.Opcode {
 	case dns.OpcodeQuery:
+		if rule := h.ruleForQuery(req); rule != nil {
+			h.handleRule(w, req, rule)
+			return
+		}
 		h.handleQuery(w, req)
 	default:
 		h.handleDefault(w, req)
@@ -358,23 +405,25 @@ func (h *Handler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
 func Start(opts ServerOptions) (*Server, error) {
 	server := &Server{}
 	if opts.UDPPort > 0 {
-		udpSrv, err := listenAndServe(UDP, opts)
+		udpSrv, h, err := listenAndServe(UDP, opts)
 		if err != nil {
 			return nil, err
 		}
 		server.udp = udpSrv
+		server.handlers = append(server.handlers, h)
 	}
 	if opts.TCPPort > 0 {
-		tcpSrv, err := listenAndServe(TCP, opts)
+		tcpSrv, h, err := listenAndServe(TCP, opts)
 		if err != nil {
 			return nil, err
 		}
 		server.tcp = tcpSrv
+		server.handlers = append(server.handlers, h)
 	}
 	return server, nil
 }
 
-func listenAndServe(network Network, opts ServerOptions) (*dns.Server, error) {
+func listenAndServe(network Network, opts ServerOptions) (*dns.Server, *Handler, error) {
 	var addr string
 	// always enable reply truncate for UDP
 	if network == UDP {
@@ -383,9 +432,9 @@ func listenAndServe(network Network, opts ServerOptions) (*dns.Server, error) {
 	} else {
 		addr = net.JoinHostPort(opts.Address, strconv.Itoa(opts.TCPPort))
 	}
-	h, err := NewHandler(opts.HandlerOptions)
+	h, err := newHandler(opts.HandlerOptions)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	s := &dns.Server{Net: string(network), Addr: addr, Handler: h}
 	go func() {
@@ -395,7 +444,7 @@ func listenAndServe(network Network, opts ServerOptions) (*dns.Server, error) {
 		}
 	}()
 
-	return s, nil
+	return s, h, nil
 }
 
 func chunkify(buffer string, limit int) []string {
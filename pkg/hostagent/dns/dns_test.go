@@ -117,6 +117,22 @@ func TestDNSRecords(t *testing.T) {
 			assert.Assert(t, regexMatch(dnsResult.String(), tc.expectedCNAME))
 		}
 	})
+
+	t.Run("test SetStaticHosts", func(t *testing.T) {
+		h.(*Handler).SetStaticHosts(map[string]string{
+			"my.domain.com": "192.168.0.24",
+			"new.host":      "my.domain.com",
+		})
+		req := new(dns.Msg)
+		req.SetQuestion("my.domain.com.", dns.TypeA)
+		h.ServeDNS(w, req)
+		assert.Assert(t, regexMatch(dnsResult.String(), `my.domain.com.\s+5\s+IN\s+A\s+192.168.0.24`))
+
+		req = new(dns.Msg)
+		req.SetQuestion("new.host.", dns.TypeCNAME)
+		h.ServeDNS(w, req)
+		assert.Assert(t, regexMatch(dnsResult.String(), `new.host.\s+5\s+IN\s+CNAME\s+my.domain.com.`))
+	})
 }
 
 type TestResponseWriter struct{}
@@ -0,0 +1,164 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dohContentType = "application/dns-message"
+	dohTimeout     = 5 * time.Second
+)
+
+// Rule routes the queries for Domain and its subdomains to Servers, instead of the host resolver.
+type Rule struct {
+	// Domain is the domain suffix, e.g., "corp.example.com".
+	Domain string
+	// Servers are tried in order: "IP", "IP:PORT", or a DNS-over-HTTPS URL, e.g., "https://dns.example.com/dns-query".
+	Servers []string
+}
+
+// newRules returns the rules with the canonical domains and the servers with the ports,
+// sorted by the length of the domain, so that the most specific rule is matched first.
+func newRules(rules []Rule) ([]Rule, error) {
+	res := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		r := Rule{Domain: dns.CanonicalName(rule.Domain)}
+		for _, server := range rule.Servers {
+			if !strings.HasPrefix(server, "https://") {
+				if net.ParseIP(server) != nil {
+					server = net.JoinHostPort(server, "53")
+				} else if _, _, err := net.SplitHostPort(server); err != nil {
+					return nil, fmt.Errorf("invalid upstream server %q for domain %q: %w", server, rule.Domain, err)
+				}
+			}
+			r.Servers = append(r.Servers, server)
+		}
+		res = append(res, r)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return dns.CountLabel(res[i].Domain) > dns.CountLabel(res[j].Domain)
+	})
+	return res, nil
+}
+
+// matchRule returns the rule for the name, or nil.
+func (h *Handler) matchRule(name string) *Rule {
+	name = dns.CanonicalName(name)
+	for i := range h.rules {
+		if dns.IsSubDomain(h.rules[i].Domain, name) {
+			return &h.rules[i]
+		}
+	}
+	return nil
+}
+
+// ruleForQuery returns the rule for the query, unless the name is one of the static hosts.
+func (h *Handler) ruleForQuery(req *dns.Msg) *Rule {
+	if len(h.rules) == 0 || len(req.Question) != 1 {
+		return nil
+	}
+	name := dns.CanonicalName(req.Question[0].Name)
+	cnameToHost, hostToIP := h.staticHosts()
+	if _, ok := hostToIP[name]; ok {
+		return nil
+	}
+	if _, ok := cnameToHost[name]; ok {
+		return nil
+	}
+	return h.matchRule(name)
+}
+
+// handleRule forwards the query to the servers of the rule, and replies with SERVFAIL when none of them answers.
+func (h *Handler) handleRule(w dns.ResponseWriter, req *dns.Msg, rule *Rule) {
+	logrus.Tracef("handleRule for %v via %v", req, rule.Servers)
+	for _, server := range rule.Servers {
+		var (
+			reply *dns.Msg
+			err   error
+		)
+		if strings.HasPrefix(server, "https://") {
+			reply, err = h.exchangeDoH(server, req)
+		} else {
+			reply, err = h.exchange(server, req)
+		}
+		if err != nil {
+			logrus.WithError(err).Debugf("handleRule failed to query [%v] for domain %q", server, rule.Domain)
+			continue
+		}
+		if h.truncate {
+			reply.Truncate(truncateSize)
+		}
+		if err := w.WriteMsg(reply); err != nil {
+			logrus.WithError(err).Debugf("handleRule failed writing DNS reply from [%v]", server)
+		}
+		return
+	}
+	var reply dns.Msg
+	reply.SetRcode(req, dns.RcodeServerFailure)
+	if err := w.WriteMsg(&reply); err != nil {
+		logrus.WithError(err).Debug("handleRule failed writing DNS reply")
+	}
+}
+
+// exchange queries the server over UDP, and retries over TCP when the reply is truncated.
+func (h *Handler) exchange(server string, req *dns.Msg) (*dns.Msg, error) {
+	var (
+		reply *dns.Msg
+		err   error
+	)
+	for _, client := range h.clients {
+		reply, _, err = client.Exchange(req, server)
+		if err == nil && !reply.Truncated {
+			break
+		}
+	}
+	return reply, err
+}
+
+// exchangeDoH queries the DNS-over-HTTPS server (RFC 8484).
+func (h *Handler) exchangeDoH(url string, req *dns.Msg) (*dns.Msg, error) {
+	// The ID should be 0 for the HTTP cache (RFC 8484 section 4.1)
+	msg := req.Copy()
+	msg.Id = 0
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dohTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", dohContentType)
+	httpReq.Header.Set("Accept", dohContentType)
+	resp, err := h.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %q", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	var reply dns.Msg
+	if err := reply.Unpack(body); err != nil {
+		return nil, err
+	}
+	reply.Id = req.Id
+	return &reply, nil
+}
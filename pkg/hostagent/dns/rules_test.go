@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"gotest.tools/v3/assert"
+)
+
+// startUpstream starts a UDP DNS server that answers every A query with ip.
+func startUpstream(t *testing.T, ip string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		reply := new(dns.Msg)
+		reply.SetReply(req)
+		reply.Answer = append(reply.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 5},
+			A:   net.ParseIP(ip),
+		})
+		_ = w.WriteMsg(reply)
+	})}
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestRules(t *testing.T) {
+	upstream := startUpstream(t, "10.0.0.1")
+	upstreamSub := startUpstream(t, "10.0.0.2")
+
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("Content-Type"), dohContentType)
+		b, err := io.ReadAll(r.Body)
+		assert.NilError(t, err)
+		var req dns.Msg
+		assert.NilError(t, req.Unpack(b))
+		assert.Equal(t, req.Id, uint16(0))
+		reply := new(dns.Msg)
+		reply.SetReply(&req)
+		reply.Answer = append(reply.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 5},
+			A:   net.ParseIP("10.0.0.3"),
+		})
+		b, err = reply.Pack()
+		assert.NilError(t, err)
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(doh.Close)
+
+	h, err := newHandler(HandlerOptions{
+		StaticHosts: map[string]string{"static.corp.example.com": "10.0.0.4"},
+		Rules: []Rule{
+			{Domain: "corp.example.com", Servers: []string{"127.0.0.1:1", upstream}},
+			{Domain: "sub.corp.example.com.", Servers: []string{upstreamSub}},
+			{Domain: "doh.example.com", Servers: []string{doh.URL}},
+			{Domain: "broken.example.com", Servers: []string{"127.0.0.1:1"}},
+		},
+	})
+	assert.NilError(t, err)
+	h.httpClient = doh.Client()
+
+	w := new(TestResponseWriter)
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		h.ServeDNS(w, req)
+		assert.Equal(t, dnsResult.Id, req.Id)
+		return dnsResult
+	}
+	answer := func(reply *dns.Msg) string {
+		assert.Equal(t, len(reply.Answer), 1)
+		return reply.Answer[0].(*dns.A).A.String()
+	}
+
+	assert.Equal(t, answer(query("host.corp.example.com.")), "10.0.0.1")
+	assert.Equal(t, answer(query("CORP.example.com.")), "10.0.0.1")
+	assert.Equal(t, answer(query("host.sub.corp.example.com.")), "10.0.0.2")
+	assert.Equal(t, answer(query("host.doh.example.com.")), "10.0.0.3")
+	assert.Equal(t, answer(query("static.corp.example.com.")), "10.0.0.4")
+	assert.Equal(t, query("host.broken.example.com.").Rcode, dns.RcodeServerFailure)
+	assert.Assert(t, h.matchRule("notcorp.example.com.") == nil)
+}
+
+func TestNewRulesInvalidServer(t *testing.T) {
+	_, err := newRules([]Rule{{Domain: "corp.example.com", Servers: []string{"dns.example.com"}}})
+	assert.ErrorContains(t, err, "invalid upstream server")
+}
@@ -16,7 +16,145 @@ type Status struct {
 	SSHLocalPort int `json:"sshLocalPort,omitempty"`
 }
 
+// ProbeStatus is the result of a readiness probe.
+type ProbeStatus struct {
+	// Name is the name of the probe, or the description if the name is not set
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Duration is the time spent for the probe, including the retries
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// DriverFailure is the unexpected exit of the driver, e.g., a crash of the QEMU process.
+type DriverFailure struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	// Restarts is the number of the automatic restarts so far, including the pending one
+	Restarts int `json:"restarts,omitempty"`
+	// Restarting is true when the instance is being restarted by `restartPolicy`
+	Restarting bool `json:"restarting,omitempty"`
+}
+
+// Crash is a panic of the guest kernel, detected in the serial console logs.
+type Crash struct {
+	Time time.Time `json:"time"`
+	// Message is the panic message, e.g., "Kernel panic - not syncing: sysrq triggered crash"
+	Message string `json:"message"`
+	// Dir is the directory that contains the artifacts, i.e., the serial console logs and the vmcore
+	Dir string `json:"dir"`
+	// VMCore is the path of the kdump-compressed vmcore; empty unless `crashCapture.vmcore` is set
+	VMCore string `json:"vmcore,omitempty"`
+	// Rebooted is true when the guest has booted again after the panic
+	Rebooted bool `json:"rebooted,omitempty"`
+}
+
+// Limits of `portForwardLimits`.
+const (
+	LimitMaxForwards           = "maxForwards"
+	LimitMaxConnectionsPerPort = "maxConnectionsPerPort"
+	LimitBandwidth             = "bandwidth"
+)
+
+// PortForwardLimit is a limit of `portForwardLimits` being hit.
+// The event is emitted at most once a minute for each limit and host address.
+type PortForwardLimit struct {
+	// Limit is one of LimitMaxForwards, LimitMaxConnectionsPerPort, and LimitBandwidth
+	Limit string `json:"limit"`
+	// Value is the configured value of the limit, e.g., "1000", or "10MiB" for LimitBandwidth
+	Value        string `json:"value"`
+	HostAddress  string `json:"hostAddress,omitempty"`
+	GuestAddress string `json:"guestAddress,omitempty"`
+	// Rejected is the number of the forwards or the connections rejected since the previous event;
+	// zero for LimitBandwidth, as the connections are throttled rather than rejected
+	Rejected int `json:"rejected,omitempty"`
+}
+
+const (
+	// ReadySSH is the Ready value for the user session of the guest becoming accessible over SSH.
+	ReadySSH = "ssh"
+	// ReadyGuestAgent is the Ready value for the guest agent getting connected.
+	ReadyGuestAgent = "guest-agent"
+	// ReadyMounts is the Ready value for the mounts of the host directories becoming available in the guest.
+	ReadyMounts = "mounts"
+)
+
+// Phases of the boot, emitted in this order after the "booting" status.
+// Each phase waits for the requirements of the group, e.g., the "essential" requirements.
+const (
+	PhaseEssential = "essential"
+	PhaseOptional  = "optional"
+	PhaseFinal     = "final"
+)
+
+// GuestPort is a port that the guest is listening on.
+type GuestPort struct {
+	Protocol string `json:"protocol"`
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+}
+
+// GuestPorts is the change of the ports that the guest is listening on.
+// The event is emitted after the port forwarding has been updated.
+type GuestPorts struct {
+	Added   []GuestPort `json:"added,omitempty"`
+	Removed []GuestPort `json:"removed,omitempty"`
+}
+
+// PowerSaving is the state of the power saving mode.
+type PowerSaving struct {
+	Enabled bool `json:"enabled"`
+	// OnBattery is true when the host is running on battery
+	OnBattery bool `json:"onBattery,omitempty"`
+	// Paused is true when the instance has been paused by `powerSaving.pause`
+	Paused bool `json:"paused,omitempty"`
+}
+
+// HostIPChange is the change of the address of the host interface that `portForwards[].hostIP` is bound to,
+// e.g., on the renewal of the DHCP lease, or on switching the network.
+// The event is emitted after the port forwards have been rebound.
+type HostIPChange struct {
+	// Interface is the name of the host interface, or empty when the interface is unknown
+	Interface string `json:"interface,omitempty"`
+	// Old is the address that the port forwards were bound to
+	Old string `json:"old"`
+	// New is the address that the port forwards have been rebound to (same as Old when the address has come back),
+	// or empty when the address has been lost without a replacement
+	New string `json:"new,omitempty"`
+}
+
 type Event struct {
 	Time   time.Time `json:"time,omitempty"`
 	Status Status    `json:"status,omitempty"`
+	// Probe is set when a readiness probe has passed or failed.
+	// The Status of such an event is left empty.
+	Probe *ProbeStatus `json:"probe,omitempty"`
+	// DriverFailure is set when the driver has failed unexpectedly.
+	// The Status of such an event is left empty.
+	DriverFailure *DriverFailure `json:"driverFailure,omitempty"`
+	// Crash is set when the guest kernel has panicked, and again when the guest has booted after the panic.
+	// The Status of such an event is left empty.
+	Crash *Crash `json:"crash,omitempty"`
+	// Ready is set when a component of the instance has become ready, e.g., ReadySSH.
+	// The Status of such an event is left empty.
+	Ready string `json:"ready,omitempty"`
+	// Unready is set when a component of the instance that has become ready is no longer available,
+	// e.g., ReadyGuestAgent when the connection to the guest agent was lost.
+	// The Status of such an event is left empty.
+	Unready string `json:"unready,omitempty"`
+	// GuestPorts is set when the guest has started or stopped listening on ports.
+	// The Status of such an event is left empty.
+	GuestPorts *GuestPorts `json:"guestPorts,omitempty"`
+	// Phase is set when a phase of the boot has started, e.g., PhaseEssential.
+	// The Status of such an event is left empty.
+	Phase string `json:"phase,omitempty"`
+	// PortForwardLimit is set when a limit of `portForwardLimits` has been hit.
+	// The Status of such an event is left empty.
+	PortForwardLimit *PortForwardLimit `json:"portForwardLimit,omitempty"`
+	// PowerSaving is set when the instance has entered or left the power saving mode (`powerSaving`).
+	// The Status of such an event is left empty.
+	PowerSaving *PowerSaving `json:"powerSaving,omitempty"`
+	// HostIPChange is set when the address of the host interface that `portForwards[].hostIP` is bound to has changed.
+	// The Status of such an event is left empty.
+	HostIPChange *HostIPChange `json:"hostIPChange,omitempty"`
 }
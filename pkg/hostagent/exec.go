@@ -0,0 +1,64 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// executeScript executes the script in the guest as the user, over the connection of the guest agent
+// (vsock, virtio-serial, or the socket forwarded over SSH) when the guest agent supports it, otherwise over SSH.
+// The values and the error are compatible with ssh.ExecuteScript.
+func (a *HostAgent) executeScript(ctx context.Context, script, scriptName string) (string, string, error) {
+	a.clientMu.RLock()
+	client := a.client
+	a.clientMu.RUnlock()
+	if client != nil {
+		info, err := client.Info(ctx)
+		if err == nil && info.HasCapability(guestagentapi.CapabilityExec) {
+			res, err := client.Exec(ctx, &guestagentapi.ExecRequest{Script: script, User: *a.instConfig.User.Name})
+			switch {
+			case err == nil:
+				stdout, stderr := string(res.GetStdout()), string(res.GetStderr())
+				if res.GetExitCode() != 0 {
+					return stdout, stderr, fmt.Errorf("failed to execute script %q: stdout=%q, stderr=%q: exit status %d",
+						scriptName, stdout, stderr, res.GetExitCode())
+				}
+				return stdout, stderr, nil
+			case status.Code(err) != codes.Unavailable:
+				return "", "", fmt.Errorf("failed to execute script %q: %w", scriptName, err)
+			}
+			logrus.WithError(err).Debugf("failed to execute script %q over the guest agent connection, falling back to SSH", scriptName)
+		}
+	}
+	return ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, script, scriptName)
+}
+
+// Telemetry returns the resource usage counters of the guest from the guest agent, for `limactl stats`.
+func (a *HostAgent) Telemetry(ctx context.Context, processes bool) (*hostagentapi.Telemetry, error) {
+	a.clientMu.RLock()
+	client := a.client
+	a.clientMu.RUnlock()
+	if client == nil {
+		return nil, errors.New("the guest agent is not connected yet")
+	}
+	info, err := client.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !info.HasCapability(guestagentapi.CapabilityTelemetry) {
+		return nil, fmt.Errorf("the guest agent does not support %q; restart the instance to update the guest agent", guestagentapi.CapabilityTelemetry)
+	}
+	counters, err := client.Telemetry(ctx, processes)
+	if err != nil {
+		return nil, err
+	}
+	return &hostagentapi.Telemetry{Counters: counters}, nil
+}
@@ -0,0 +1,135 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// guestAgentUnavailableTimeout is the duration of the unavailability of the guest agent
+	// after which the guest agent is restarted.
+	guestAgentUnavailableTimeout = 30 * time.Second
+	// guestAgentMaxRestarts is the maximum number of the restarts of the guest agent for an outage,
+	// after which the instance is marked as degraded.
+	guestAgentMaxRestarts = 3
+)
+
+// guestAgentHealth tracks the availability of the guest agent that has been connected once.
+type guestAgentHealth struct {
+	mu sync.Mutex
+	// lastSeen is the last time the guest agent was known to be alive, or the time of the last restart
+	lastSeen time.Time
+	restarts int
+	degraded bool
+	// running is the last "running" status, restored when the guest agent has recovered
+	running *events.Status
+	// restart restarts the guest agent; HostAgent.restartGuestAgent, replaced in the tests
+	restart func() error
+}
+
+// reset forgets the guest agent, on (re)starting the driver.
+func (h *guestAgentHealth) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSeen = time.Time{}
+	h.restarts = 0
+	h.degraded = false
+	h.running = nil
+}
+
+// setRunning records the "running" status emitted after the boot.
+func (h *guestAgentHealth) setRunning(st events.Status) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running = &st
+}
+
+// markGuestAgentAlive records that the guest agent is alive,
+// and restores the "running" status if the instance had been degraded due to the guest agent.
+func (a *HostAgent) markGuestAgentAlive(ctx context.Context) {
+	h := &a.guestAgentHealth
+	h.mu.Lock()
+	h.lastSeen = time.Now()
+	h.restarts = 0
+	recovered := h.degraded
+	h.degraded = false
+	running := h.running
+	h.mu.Unlock()
+	if recovered {
+		logrus.Info("The guest agent has recovered")
+		if running != nil {
+			a.emitEvent(ctx, events.Event{Status: *running})
+		}
+	}
+}
+
+// superviseGuestAgent is called while the guest agent is unavailable.
+// When the guest agent has been unavailable for guestAgentUnavailableTimeout, it is restarted over SSH,
+// and the instance is marked as degraded when the guest agent does not recover after guestAgentMaxRestarts restarts.
+// Nothing is done until the guest agent has been connected once, as the guest agent is not installed yet during the first boot.
+func (a *HostAgent) superviseGuestAgent(ctx context.Context) {
+	h := &a.guestAgentHealth
+	h.mu.Lock()
+	if h.lastSeen.IsZero() || h.degraded || time.Since(h.lastSeen) < guestAgentUnavailableTimeout || ctx.Err() != nil {
+		h.mu.Unlock()
+		return
+	}
+	unavailable := time.Since(h.lastSeen).Round(time.Second)
+	restart := h.restarts < guestAgentMaxRestarts && *a.instConfig.Security.Sudo != limayaml.SudoNone
+	if restart {
+		h.restarts++
+		h.lastSeen = time.Now()
+	} else {
+		h.degraded = true
+	}
+	restarts := h.restarts
+	running := h.running
+	h.mu.Unlock()
+
+	if restart {
+		logrus.Warnf("The guest agent has been unavailable for %v, restarting it (attempt %d/%d)", unavailable, restarts, guestAgentMaxRestarts)
+		if err := h.restart(); err != nil {
+			logrus.WithError(err).Warn("failed to restart the guest agent")
+		}
+		return
+	}
+	msg := "the guest agent is not running, port forwarding is unavailable"
+	if restarts > 0 {
+		msg = fmt.Sprintf("the guest agent did not recover after %d restarts, port forwarding is unavailable", restarts)
+	}
+	logrus.Error(msg)
+	if running == nil {
+		return
+	}
+	st := *running
+	st.Degraded = true
+	st.Errors = append(slices.Clone(st.Errors), msg)
+	a.emitEvent(ctx, events.Event{Status: st})
+}
+
+// restartGuestAgent restarts the lima-guestagent service in the guest.
+func (a *HostAgent) restartGuestAgent() error {
+	sudo := a.sudoPrefix()
+	script := fmt.Sprintf(`#!/bin/sh
+set -eu
+if [ -f /sbin/openrc-run ]; then
+	%[1]src-service lima-guestagent restart
+else
+	%[1]ssystemctl restart lima-guestagent
+fi
+`, sudo)
+	stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, script, "restarting the guest agent")
+	logrus.Debugf("restarting the guest agent: stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+	if err != nil {
+		return fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return nil
+}
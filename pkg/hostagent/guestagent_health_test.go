@@ -0,0 +1,199 @@
+package hostagent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"gotest.tools/v3/assert"
+)
+
+func newHealthTestHostAgent(sudo limayaml.SudoPolicy, restarted *int) *HostAgent {
+	a := &HostAgent{
+		instConfig: &limayaml.LimaYAML{Security: limayaml.Security{Sudo: ptr.Of(sudo)}},
+		eventEnc:   json.NewEncoder(io.Discard),
+	}
+	a.guestAgentHealth.restart = func() error {
+		*restarted++
+		return nil
+	}
+	return a
+}
+
+func TestSuperviseGuestAgent(t *testing.T) {
+	running := events.Status{Running: true, SSHLocalPort: 60022}
+	cases := []struct {
+		name        string
+		sudo        limayaml.SudoPolicy
+		unavailable time.Duration // zero when the guest agent has never been connected
+		restarts    int
+		degraded    bool
+		running     *events.Status
+
+		expectedRestarted int
+		expectedRestarts  int
+		expectedDegraded  bool
+		expectedEvent     *events.Status
+	}{
+		{
+			name:    "never connected",
+			sudo:    limayaml.SudoFull,
+			running: &running,
+		},
+		{
+			name:             "before the timeout",
+			sudo:             limayaml.SudoFull,
+			unavailable:      guestAgentUnavailableTimeout - 5*time.Second,
+			restarts:         1,
+			running:          &running,
+			expectedRestarts: 1,
+		},
+		{
+			name:              "after the timeout",
+			sudo:              limayaml.SudoFull,
+			unavailable:       guestAgentUnavailableTimeout + time.Second,
+			running:           &running,
+			expectedRestarted: 1,
+			expectedRestarts:  1,
+		},
+		{
+			name:              "last restart",
+			sudo:              limayaml.SudoLimited,
+			unavailable:       guestAgentUnavailableTimeout + time.Second,
+			restarts:          guestAgentMaxRestarts - 1,
+			running:           &running,
+			expectedRestarted: 1,
+			expectedRestarts:  guestAgentMaxRestarts,
+		},
+		{
+			name:             "restart cap",
+			sudo:             limayaml.SudoFull,
+			unavailable:      guestAgentUnavailableTimeout + time.Second,
+			restarts:         guestAgentMaxRestarts,
+			running:          &running,
+			expectedRestarts: guestAgentMaxRestarts,
+			expectedDegraded: true,
+			expectedEvent: &events.Status{
+				Running:      true,
+				Degraded:     true,
+				Errors:       []string{"the guest agent did not recover after 3 restarts, port forwarding is unavailable"},
+				SSHLocalPort: 60022,
+			},
+		},
+		{
+			name:             "sudo none",
+			sudo:             limayaml.SudoNone,
+			unavailable:      guestAgentUnavailableTimeout + time.Second,
+			running:          &running,
+			expectedDegraded: true,
+			expectedEvent: &events.Status{
+				Running:      true,
+				Degraded:     true,
+				Errors:       []string{"the guest agent is not running, port forwarding is unavailable"},
+				SSHLocalPort: 60022,
+			},
+		},
+		{
+			name:             "already degraded",
+			sudo:             limayaml.SudoFull,
+			unavailable:      time.Hour,
+			restarts:         guestAgentMaxRestarts,
+			degraded:         true,
+			running:          &running,
+			expectedRestarts: guestAgentMaxRestarts,
+			expectedDegraded: true,
+		},
+		{
+			name:             "not running yet",
+			sudo:             limayaml.SudoNone,
+			unavailable:      guestAgentUnavailableTimeout + time.Second,
+			expectedDegraded: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var restarted int
+			a := newHealthTestHostAgent(tc.sudo, &restarted)
+			h := &a.guestAgentHealth
+			if tc.unavailable != 0 {
+				h.lastSeen = time.Now().Add(-tc.unavailable)
+			}
+			h.restarts = tc.restarts
+			h.degraded = tc.degraded
+			h.running = tc.running
+
+			a.superviseGuestAgent(context.Background())
+			assert.Equal(t, restarted, tc.expectedRestarted)
+			assert.Equal(t, h.restarts, tc.expectedRestarts)
+			assert.Equal(t, h.degraded, tc.expectedDegraded)
+			if tc.expectedRestarted > 0 {
+				// The timeout starts over after the restart
+				assert.Assert(t, time.Since(h.lastSeen) < guestAgentUnavailableTimeout)
+			}
+			if tc.expectedEvent == nil {
+				assert.Equal(t, len(a.eventHistory), 0)
+				return
+			}
+			assert.Equal(t, len(a.eventHistory), 1)
+			assert.DeepEqual(t, a.eventHistory[0].Status, *tc.expectedEvent)
+		})
+	}
+}
+
+func TestMarkGuestAgentAlive(t *testing.T) {
+	running := events.Status{Running: true, SSHLocalPort: 60022}
+	cases := []struct {
+		name          string
+		degraded      bool
+		running       *events.Status
+		expectedEvent *events.Status
+	}{
+		{
+			name:    "healthy",
+			running: &running,
+		},
+		{
+			name:          "recovered",
+			degraded:      true,
+			running:       &running,
+			expectedEvent: &running,
+		},
+		{
+			name:     "recovered before running",
+			degraded: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var restarted int
+			a := newHealthTestHostAgent(limayaml.SudoFull, &restarted)
+			h := &a.guestAgentHealth
+			h.lastSeen = time.Now().Add(-time.Hour)
+			h.restarts = guestAgentMaxRestarts
+			h.degraded = tc.degraded
+			h.running = tc.running
+
+			a.markGuestAgentAlive(context.Background())
+			assert.Equal(t, h.restarts, 0)
+			assert.Assert(t, !h.degraded)
+			assert.Assert(t, time.Since(h.lastSeen) < time.Minute)
+			if tc.expectedEvent == nil {
+				assert.Equal(t, len(a.eventHistory), 0)
+				return
+			}
+			assert.Equal(t, len(a.eventHistory), 1)
+			assert.DeepEqual(t, a.eventHistory[0].Status, *tc.expectedEvent)
+
+			// The supervision starts over after the recovery
+			h.lastSeen = time.Now().Add(-guestAgentUnavailableTimeout - time.Second)
+			a.superviseGuestAgent(context.Background())
+			assert.Equal(t, restarted, 1)
+			assert.Assert(t, !h.degraded)
+		})
+	}
+}
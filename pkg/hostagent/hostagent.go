@@ -11,9 +11,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc/codes"
@@ -28,14 +30,15 @@ import (
 	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
 	"github.com/lima-vm/lima/pkg/hostagent/dns"
 	"github.com/lima-vm/lima/pkg/hostagent/events"
-	"github.com/lima-vm/lima/pkg/identifierutil"
 	"github.com/lima-vm/lima/pkg/limayaml"
-	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/portfwd"
+	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sethvargo/go-password/password"
 	"github.com/sirupsen/logrus"
@@ -52,6 +55,12 @@ type HostAgent struct {
 	sshConfig         *ssh.SSHConfig
 	portForwarder     *portForwarder
 	grpcPortForwarder *portfwd.Forwarder
+	// portForwardRules are shared with the port forwarders, and rewritten when the address of `hostIP` changes
+	portForwardRules []limayaml.PortForward
+	// portForwardMu serializes the events of the port forwarders and the rewrites of portForwardRules
+	portForwardMu sync.Mutex
+	// socketForwarder is nil unless `socketForwards` is configured
+	socketForwarder *socketForwarder
 
 	onClose []func() error // LIFO
 
@@ -60,6 +69,9 @@ type HostAgent struct {
 
 	eventEnc   *json.Encoder
 	eventEncMu sync.Mutex
+	// eventHistory and eventSubs are guarded by eventEncMu
+	eventHistory []events.Event
+	eventSubs    map[chan events.Event]struct{}
 
 	vSockPort  int
 	virtioPort string
@@ -67,12 +79,38 @@ type HostAgent struct {
 	clientMu sync.RWMutex
 	client   *guestagentclient.GuestAgentClient
 
+	// guestAgentSockForwarded is true when the guest agent socket is forwarded over SSH,
+	// as a fallback for the failure of the vsock connection
+	guestAgentSockForwarded   bool
+	guestAgentSockForwardedMu sync.Mutex
+
 	guestAgentAliveCh     chan struct{} // closed on establishing the connection
 	guestAgentAliveChOnce sync.Once
+
+	// guestAgentHealth is used for restarting the guest agent when it is dead
+	guestAgentHealth guestAgentHealth
+
+	// dnsServer is nil unless `hostResolver` is served by the host agent
+	dnsServer   *dns.Server
+	dnsServerMu sync.Mutex
+
+	// powerSaving is true in the power saving mode (`powerSaving`)
+	powerSaving atomic.Bool
+
+	// suspending is true while the VM state is being saved, or has been saved (`limactl suspend`)
+	suspending atomic.Bool
+
+	// mounts are the mounts set up by the host agent (reverse-sshfs, NFS, and the external mount drivers)
+	mounts   []*mount
+	mountsMu sync.Mutex
+
+	// metricsPort is the port of the metrics server (`limactl start --metrics-port`), or 0
+	metricsPort int
 }
 
 type options struct {
 	nerdctlArchive string // local path, not URL
+	metricsPort    int
 }
 
 type Opt func(*options) error
@@ -84,6 +122,17 @@ func WithNerdctlArchive(s string) Opt {
 	}
 }
 
+// WithMetricsPort serves the metrics of the guest in the Prometheus format on http://127.0.0.1:PORT/metrics.
+func WithMetricsPort(port int) Opt {
+	return func(o *options) error {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid metrics port %d", port)
+		}
+		o.metricsPort = port
+		return nil
+	}
+}
+
 // New creates the HostAgent.
 //
 // stdout is for emitting JSON lines of Events.
@@ -108,8 +157,21 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		sshLocalPort = inst.SSHLocalPort
 	}
 
+	var restoreState string
+	var suspended *metadata.Suspended
+	if inst.Status == store.StatusSuspended {
+		restoreState = store.SuspendStatePath(inst.Dir, inst.Config)
+		md, err := metadata.Read(inst.Dir)
+		if err != nil {
+			return nil, err
+		}
+		suspended = md.Suspended
+	}
+
 	var udpDNSLocalPort, tcpDNSLocalPort int
-	if *inst.Config.HostResolver.Enabled {
+	if suspended != nil && suspended.UDPDNSLocalPort != 0 && suspended.TCPDNSLocalPort != 0 {
+		udpDNSLocalPort, tcpDNSLocalPort = suspended.UDPDNSLocalPort, suspended.TCPDNSLocalPort
+	} else if *inst.Config.HostResolver.Enabled {
 		udpDNSLocalPort, err = freeport.UDP()
 		if err != nil {
 			return nil, err
@@ -131,6 +193,11 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		}
 		vSockPort = port
 	} else if *inst.Config.VMType == limayaml.QEMU {
+		// vhost-vsock is used on Linux hosts, so that the guest agent does not depend on the SSH connection.
+		// Otherwise the guest agent socket is forwarded over SSH.
+		if qemu.VhostVsockAvailable(inst.Config) {
+			vSockPort = 2222
+		}
 		// virtserialport doesn't seem to work reliably: https://github.com/lima-vm/lima/issues/2064
 		virtioPort = "" // filenames.VirtioPort
 	}
@@ -152,7 +219,11 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 	if err != nil {
 		return nil, err
 	}
-	if err = writeSSHConfigFile(inst.Name, inst.Dir, inst.SSHAddress, sshLocalPort, sshOpts); err != nil {
+	var tags []string
+	if *inst.Config.InstanceTags {
+		tags = sshConfigTags(inst)
+	}
+	if err = writeSSHConfigFile(inst.Name, inst.Dir, inst.SSHAddress, sshLocalPort, sshOpts, tags); err != nil {
 		return nil, err
 	}
 	sshConfig := &ssh.SSHConfig{
@@ -186,7 +257,21 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		limayaml.FillPortForwardDefaults(&rule, inst.Dir, inst.Config.User, inst.Param)
 		rules = append(rules, rule)
 	}
-	rules = append(rules, inst.Config.PortForwards...)
+	wireGuardRules, err := wireGuardPortForwards(inst)
+	if err != nil {
+		return nil, err
+	}
+	if ignoreUDP && len(wireGuardRules) > 0 {
+		logrus.Warn("The WireGuard peers cannot reach the instance, as UDP port forwarding is disabled")
+	}
+	rules = append(rules, wireGuardRules...)
+	for _, rule := range inst.Config.PortForwards {
+		if rule.HostService {
+			// The host port is listened by the host service; see `limactl host-service`
+			rule.Ignore = true
+		}
+		rules = append(rules, rule)
+	}
 	// Default forwards for all non-privileged ports from "127.0.0.1" and "::1"
 	rule := limayaml.PortForward{}
 	limayaml.FillPortForwardDefaults(&rule, inst.Dir, inst.Config.User, inst.Param)
@@ -197,6 +282,7 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		SSHLocalPort: sshLocalPort,
 		VSockPort:    vSockPort,
 		VirtioPort:   virtioPort,
+		RestoreState: restoreState,
 	})
 
 	a := &HostAgent{
@@ -208,19 +294,48 @@ func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt
 		instName:          instName,
 		instSSHAddress:    inst.SSHAddress,
 		sshConfig:         sshConfig,
-		portForwarder:     newPortForwarder(sshConfig, sshLocalPort, rules, ignoreTCP, inst.VMType),
-		grpcPortForwarder: portfwd.NewPortForwarder(rules, ignoreTCP, ignoreUDP),
 		driver:            limaDriver,
 		signalCh:          signalCh,
 		eventEnc:          json.NewEncoder(stdout),
 		vSockPort:         vSockPort,
 		virtioPort:        virtioPort,
 		guestAgentAliveCh: make(chan struct{}),
+		metricsPort:       o.metricsPort,
+	}
+	limits, err := portfwd.NewLimits(inst.Config.PortForwardLimits, func(l events.PortForwardLimit) {
+		a.emitEvent(context.Background(), events.Event{PortForwardLimit: &l})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if limits.LimitsConnections() && sshPortForwarderEnabled() {
+		logrus.Warn("`portForwardLimits.maxConnectionsPerPort` and `portForwardLimits.bandwidth` are not enforced by the SSH port forwarder; " +
+			"set LIMA_SSH_PORT_FORWARDER=false to use the gRPC port forwarder")
+	}
+	a.guestAgentHealth.restart = a.restartGuestAgent
+	a.portForwardRules = rules
+	a.portForwarder = newPortForwarder(sshConfig, sshLocalPort, rules, ignoreTCP, inst.VMType, limits)
+	a.grpcPortForwarder = portfwd.NewPortForwarder(rules, ignoreTCP, ignoreUDP, limits)
+	if len(inst.Config.SocketForwards) > 0 {
+		if inst.VMType == limayaml.WSL2 {
+			logrus.Warnf("Ignoring `socketForwards`, as it is not supported for vmType %q", limayaml.WSL2)
+		} else {
+			a.socketForwarder = newSocketForwarder(sshConfig, sshLocalPort, inst.Config.SocketForwards)
+		}
 	}
 	return a, nil
 }
 
-func writeSSHConfigFile(instName, instDir, instSSHAddress string, sshLocalPort int, sshOpts []string) error {
+// sshConfigTags returns the comments that tell the instance apart in ssh.config (`instanceTags`).
+func sshConfigTags(inst *store.Instance) []string {
+	tags := []string{"Instance: " + inst.Name}
+	if tmpl := history.Template(inst.Dir); tmpl != "" {
+		tags = append(tags, "Template: "+tmpl)
+	}
+	return append(tags, "VMType: "+*inst.Config.VMType)
+}
+
+func writeSSHConfigFile(instName, instDir, instSSHAddress string, sshLocalPort int, sshOpts, tags []string) error {
 	if instDir == "" {
 		return fmt.Errorf("directory is unknown for the instance %q", instName)
 	}
@@ -231,6 +346,11 @@ func writeSSHConfigFile(instName, instDir, instSSHAddress string, sshLocalPort i
 `); err != nil {
 		return err
 	}
+	for _, tag := range tags {
+		if _, err := fmt.Fprintf(&b, "# %s\n", tag); err != nil {
+			return err
+		}
+	}
 	if err := sshutil.Format(&b, instName, sshutil.FormatConfig,
 		append(sshOpts,
 			fmt.Sprintf("Hostname=%s", instSSHAddress),
@@ -269,6 +389,45 @@ func (a *HostAgent) emitEvent(_ context.Context, ev events.Event) {
 	if err := a.eventEnc.Encode(ev); err != nil {
 		logrus.WithField("event", ev).WithError(err).Error("failed to emit an event")
 	}
+	if len(a.eventHistory) >= maxEventHistory {
+		a.eventHistory = a.eventHistory[1:]
+	}
+	a.eventHistory = append(a.eventHistory, ev)
+	for ch := range a.eventSubs {
+		select {
+		case ch <- ev:
+		default:
+			// The subscriber is too slow; closing the channel lets it know that it has missed the events
+			delete(a.eventSubs, ch)
+			close(ch)
+		}
+	}
+}
+
+// maxEventHistory is the number of the events kept for SubscribeEvents.
+const maxEventHistory = 1000
+
+// SubscribeEvents returns the events emitted since the host agent was started (at most maxEventHistory),
+// and a channel that receives the events emitted afterwards.
+// The channel is closed when the subscriber does not keep up with the events, or when the returned function is called.
+func (a *HostAgent) SubscribeEvents() ([]events.Event, <-chan events.Event, func()) {
+	a.eventEncMu.Lock()
+	defer a.eventEncMu.Unlock()
+	history := slices.Clone(a.eventHistory)
+	ch := make(chan events.Event, 64)
+	if a.eventSubs == nil {
+		a.eventSubs = make(map[chan events.Event]struct{})
+	}
+	a.eventSubs[ch] = struct{}{}
+	unsubscribe := func() {
+		a.eventEncMu.Lock()
+		defer a.eventEncMu.Unlock()
+		if _, ok := a.eventSubs[ch]; ok {
+			delete(a.eventSubs, ch)
+			close(ch)
+		}
+	}
+	return history, ch, unsubscribe
 }
 
 func generatePassword(length int) (string, error) {
@@ -287,11 +446,14 @@ func (a *HostAgent) Run(ctx context.Context) error {
 	}()
 	adjustNofileRlimit()
 
+	for _, f := range []string{filenames.DriverFailure, filenames.Crash} {
+		if err := os.RemoveAll(filepath.Join(a.instDir, f)); err != nil {
+			return err
+		}
+	}
+
 	if limayaml.FirstUsernetIndex(a.instConfig) == -1 && *a.instConfig.HostResolver.Enabled {
-		hosts := a.instConfig.HostResolver.Hosts
-		hosts["host.lima.internal"] = networks.SlirpGateway
-		hostname := identifierutil.HostnameFromInstName(a.instName) // TODO: support customization
-		hosts[hostname] = networks.SlirpIPAddress
+		hosts := a.staticHosts(a.instConfig.HostResolver.Hosts)
 		srvOpts := dns.ServerOptions{
 			UDPPort: a.udpDNSLocalPort,
 			TCPPort: a.tcpDNSLocalPort,
@@ -299,6 +461,7 @@ func (a *HostAgent) Run(ctx context.Context) error {
 			HandlerOptions: dns.HandlerOptions{
 				IPv6:        *a.instConfig.HostResolver.IPv6,
 				StaticHosts: hosts,
+				Rules:       dnsRules(a.instConfig.HostResolver.Rules),
 			},
 		}
 		dnsServer, err := dns.Start(srvOpts)
@@ -306,6 +469,17 @@ func (a *HostAgent) Run(ctx context.Context) error {
 			return fmt.Errorf("cannot start DNS server: %w", err)
 		}
 		defer dnsServer.Shutdown()
+		a.dnsServerMu.Lock()
+		a.dnsServer = dnsServer
+		a.dnsServerMu.Unlock()
+	}
+
+	if a.metricsPort != 0 {
+		stopMetricsServer, err := a.startMetricsServer(a.metricsPort)
+		if err != nil {
+			return err
+		}
+		defer stopMetricsServer()
 	}
 
 	errCh, err := a.driver.Start(ctx)
@@ -321,49 +495,16 @@ func (a *HostAgent) Run(ctx context.Context) error {
 		}
 		a.instSSHAddress = sshAddr
 	}
+	if err := metadata.Update(a.instDir, func(m *metadata.Metadata) error {
+		m.SSHAddress = a.instSSHAddress
+		m.SSHLocalPort = a.sshLocalPort
+		return nil
+	}); err != nil {
+		return err
+	}
 
-	if a.instConfig.Video.Display != nil && *a.instConfig.Video.Display == "vnc" {
-		vncdisplay, vncoptions, _ := strings.Cut(*a.instConfig.Video.VNC.Display, ",")
-		vnchost, vncnum, err := net.SplitHostPort(vncdisplay)
-		if err != nil {
-			return err
-		}
-		n, err := strconv.Atoi(vncnum)
-		if err != nil {
-			return err
-		}
-		vncport := strconv.Itoa(5900 + n)
-		vncpwdfile := filepath.Join(a.instDir, filenames.VNCPasswordFile)
-		vncpasswd, err := generatePassword(8)
-		if err != nil {
-			return err
-		}
-		if err := a.driver.ChangeDisplayPassword(ctx, vncpasswd); err != nil {
-			return err
-		}
-		if err := os.WriteFile(vncpwdfile, []byte(vncpasswd), 0o600); err != nil {
-			return err
-		}
-		if strings.Contains(vncoptions, "to=") {
-			vncport, err = a.driver.GetDisplayConnection(ctx)
-			if err != nil {
-				return err
-			}
-			p, err := strconv.Atoi(vncport)
-			if err != nil {
-				return err
-			}
-			vncnum = strconv.Itoa(p - 5900)
-			vncdisplay = net.JoinHostPort(vnchost, vncnum)
-		}
-		vncfile := filepath.Join(a.instDir, filenames.VNCDisplayFile)
-		if err := os.WriteFile(vncfile, []byte(vncdisplay), 0o600); err != nil {
-			return err
-		}
-		vncurl := "vnc://" + net.JoinHostPort(vnchost, vncport)
-		logrus.Infof("VNC server running at %s <%s>", vncdisplay, vncurl)
-		logrus.Infof("VNC Display: `%s`", vncfile)
-		logrus.Infof("VNC Password: `%s`", vncpwdfile)
+	if err := a.setupVNC(ctx); err != nil {
+		return err
 	}
 
 	if a.driver.CanRunGUI() {
@@ -378,32 +519,112 @@ func (a *HostAgent) Run(ctx context.Context) error {
 	return a.startRoutinesAndWait(ctx, errCh)
 }
 
+// setupVNC sets up the VNC password and the display files, when the VNC display is enabled.
+// It is called again after restarting the driver, as the driver removes these files on stopping.
+func (a *HostAgent) setupVNC(ctx context.Context) error {
+	if a.instConfig.Video.Display == nil || *a.instConfig.Video.Display != "vnc" {
+		return nil
+	}
+	vncdisplay, vncoptions, _ := strings.Cut(*a.instConfig.Video.VNC.Display, ",")
+	vnchost, vncnum, err := net.SplitHostPort(vncdisplay)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(vncnum)
+	if err != nil {
+		return err
+	}
+	vncport := strconv.Itoa(5900 + n)
+	vncpwdfile := filepath.Join(a.instDir, filenames.VNCPasswordFile)
+	vncpasswd, err := generatePassword(8)
+	if err != nil {
+		return err
+	}
+	if err := a.driver.ChangeDisplayPassword(ctx, vncpasswd); err != nil {
+		return err
+	}
+	if err := os.WriteFile(vncpwdfile, []byte(vncpasswd), 0o600); err != nil {
+		return err
+	}
+	if strings.Contains(vncoptions, "to=") {
+		vncport, err = a.driver.GetDisplayConnection(ctx)
+		if err != nil {
+			return err
+		}
+		p, err := strconv.Atoi(vncport)
+		if err != nil {
+			return err
+		}
+		vncnum = strconv.Itoa(p - 5900)
+		vncdisplay = net.JoinHostPort(vnchost, vncnum)
+	}
+	vncfile := filepath.Join(a.instDir, filenames.VNCDisplayFile)
+	if err := os.WriteFile(vncfile, []byte(vncdisplay), 0o600); err != nil {
+		return err
+	}
+	vncurl := "vnc://" + net.JoinHostPort(vnchost, vncport)
+	logrus.Infof("VNC server running at %s <%s>", vncdisplay, vncurl)
+	logrus.Infof("VNC Display: `%s`", vncfile)
+	logrus.Infof("VNC Password: `%s`", vncpwdfile)
+	return nil
+}
+
 func (a *HostAgent) startRoutinesAndWait(ctx context.Context, errCh <-chan error) error {
 	stBase := events.Status{
 		SSHLocalPort: a.sshLocalPort,
 	}
-	stBooting := stBase
-	a.emitEvent(ctx, events.Event{Status: stBooting})
-	ctxHA, cancelHA := context.WithCancel(ctx)
-	go func() {
-		stRunning := stBase
-		if haErr := a.startHostAgentRoutines(ctxHA); haErr != nil {
-			stRunning.Degraded = true
-			stRunning.Errors = append(stRunning.Errors, haErr.Error())
-		}
-		stRunning.Running = true
-		a.emitEvent(ctx, events.Event{Status: stRunning})
-	}()
+	cancelHA := a.startHostAgentRoutinesInBackground(ctx, stBase)
+	var restarts int
 	for {
 		select {
 		case driverErr := <-errCh:
-			logrus.Infof("Driver stopped due to error: %q", driverErr)
+			if driverErr == nil {
+				logrus.Info("Driver stopped")
+			} else {
+				logrus.Infof("Driver stopped due to error: %q", driverErr)
+			}
 			cancelHA()
 			if closeErr := a.close(); closeErr != nil {
 				logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
 			}
-			err := a.driver.Stop(ctx)
-			return err
+			a.onClose = nil
+			if driverErr == nil {
+				return a.driver.Stop(ctx)
+			}
+			restarting := a.shouldRestart(restarts)
+			if restarting {
+				restarts++
+			}
+			a.recordDriverFailure(ctx, &events.DriverFailure{
+				Time:       time.Now(),
+				Reason:     driverErr.Error(),
+				Restarts:   restarts,
+				Restarting: restarting,
+			})
+			stopErr := a.driver.Stop(ctx)
+			if !restarting {
+				return stopErr
+			}
+			if stopErr != nil {
+				logrus.WithError(stopErr).Warn("an error during stopping the driver before restarting")
+			}
+			delay := restartDelay(restarts)
+			logrus.Infof("Restarting the driver in %v (restart %d)", delay, restarts)
+			select {
+			case <-time.After(delay):
+			case sig := <-a.signalCh:
+				logrus.Infof("Received %s, shutting down the host agent", osutil.SignalName(sig))
+				return nil
+			}
+			var err error
+			errCh, err = a.driver.Start(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to restart the driver: %w", err)
+			}
+			if err := a.setupVNC(ctx); err != nil {
+				logrus.WithError(err).Warn("failed to set up VNC after restarting the driver")
+			}
+			cancelHA = a.startHostAgentRoutinesInBackground(ctx, stBase)
 		case sig := <-a.signalCh:
 			logrus.Infof("Received %s, shutting down the host agent", osutil.SignalName(sig))
 			cancelHA()
@@ -416,6 +637,76 @@ func (a *HostAgent) startRoutinesAndWait(ctx context.Context, errCh <-chan error
 	}
 }
 
+// startHostAgentRoutinesInBackground emits the "booting" event and starts the host agent routines
+// (SSH, mounts, port forwarding, etc.) in the background. The returned function cancels the routines.
+func (a *HostAgent) startHostAgentRoutinesInBackground(ctx context.Context, stBase events.Status) context.CancelFunc {
+	stBooting := stBase
+	a.emitEvent(ctx, events.Event{Status: stBooting})
+	ctxHA, cancelHA := context.WithCancel(ctx)
+	a.guestAgentHealth.reset()
+	go a.rotateSerialLogs(ctxHA)
+	if *a.instConfig.CrashCapture.Enabled {
+		go a.watchCrash(ctxHA)
+	}
+	if *a.instConfig.PowerSaving.Mode != limayaml.PowerSavingNever {
+		go a.watchPowerSource(ctxHA)
+	}
+	go func() {
+		stRunning := stBase
+		if haErr := a.startHostAgentRoutines(ctxHA); haErr != nil {
+			stRunning.Degraded = true
+			stRunning.Errors = append(stRunning.Errors, haErr.Error())
+		}
+		stRunning.Running = true
+		a.guestAgentHealth.setRunning(stRunning)
+		a.emitEvent(ctx, events.Event{Status: stRunning})
+	}()
+	return cancelHA
+}
+
+// shouldRestart returns true when the driver should be restarted by `restartPolicy`,
+// after restarting it for the specified times.
+func (a *HostAgent) shouldRestart(restarts int) bool {
+	onFailure, maxRestarts, err := limayaml.ParseRestartPolicy(*a.instConfig.RestartPolicy)
+	if err != nil {
+		logrus.WithError(err).Warn("invalid restart policy")
+		return false
+	}
+	if !onFailure {
+		return false
+	}
+	if a.driver.CanRunGUI() {
+		logrus.Warn("`restartPolicy` is not supported when the driver runs the GUI")
+		return false
+	}
+	if maxRestarts > 0 && restarts >= maxRestarts {
+		logrus.Warnf("Not restarting the driver, as it has been already restarted %d times", restarts)
+		return false
+	}
+	return true
+}
+
+// restartDelay returns the exponential backoff delay before the restart, up to a minute.
+func restartDelay(restarts int) time.Duration {
+	if restarts > 6 {
+		return time.Minute
+	}
+	return time.Second << (restarts - 1)
+}
+
+// recordDriverFailure emits the failure as an event, and persists it for `limactl list`.
+func (a *HostAgent) recordDriverFailure(ctx context.Context, failure *events.DriverFailure) {
+	a.emitEvent(ctx, events.Event{DriverFailure: failure})
+	b, err := json.Marshal(failure)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to marshal the driver failure")
+		return
+	}
+	if err := os.WriteFile(filepath.Join(a.instDir, filenames.DriverFailure), b, 0o644); err != nil {
+		logrus.WithError(err).Warn("failed to record the driver failure")
+	}
+}
+
 func (a *HostAgent) Info(_ context.Context) (*hostagentapi.Info, error) {
 	info := &hostagentapi.Info{
 		SSHLocalPort: a.sshLocalPort,
@@ -435,15 +726,20 @@ func (a *HostAgent) startHostAgentRoutines(ctx context.Context) error {
 		return nil
 	})
 	var errs []error
-	if err := a.waitForRequirements("essential", a.essentialRequirements()); err != nil {
+	if err := a.waitForRequirements(ctx, events.PhaseEssential, a.essentialRequirements()); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.registerSwitchHosts(ctx); err != nil {
 		errs = append(errs, err)
 	}
 	if *a.instConfig.SSH.ForwardAgent {
+		// With `security.sudo: none`, /run/host-services is created for the user by the boot scripts
+		sudo := a.sudoPrefix()
 		faScript := `#!/bin/bash
 set -eux -o pipefail
-sudo mkdir -p -m 700 /run/host-services
-sudo ln -sf "${SSH_AUTH_SOCK}" /run/host-services/ssh-auth.sock
-sudo chown -R "${USER}" /run/host-services`
+` + sudo + `mkdir -p -m 700 /run/host-services
+` + sudo + `ln -sf "${SSH_AUTH_SOCK}" /run/host-services/ssh-auth.sock
+` + sudo + `chown -R "${USER}" /run/host-services`
 		faDesc := "linking ssh auth socket to static location /run/host-services/ssh-auth.sock"
 		stdout, stderr, err := ssh.ExecuteScript(a.instSSHAddress, a.sshLocalPort, a.sshConfig, faScript, faDesc)
 		logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
@@ -451,20 +747,28 @@ sudo chown -R "${USER}" /run/host-services`
 			errs = append(errs, fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err))
 		}
 	}
-	if *a.instConfig.MountType == limayaml.REVSSHFS && !*a.instConfig.Plain {
-		mounts, err := a.setupMounts()
+	if !*a.instConfig.Plain {
+		var (
+			mounts []*mount
+			err    error
+		)
+		switch {
+		case *a.instConfig.MountType == limayaml.REVSSHFS:
+			mounts, err = a.setupMounts()
+		case *a.instConfig.MountType == limayaml.NFS:
+			mounts, err = a.setupNFSMounts(ctx)
+		case limayaml.IsExternalMountType(*a.instConfig.MountType) && len(a.instConfig.Mounts) > 0:
+			mounts, err = a.setupExternalMounts(ctx)
+		}
 		if err != nil {
 			errs = append(errs, err)
+		} else if len(mounts) > 0 {
+			a.emitEvent(ctx, events.Event{Ready: events.ReadyMounts})
 		}
-		a.onClose = append(a.onClose, func() error {
-			var unmountErrs []error
-			for _, m := range mounts {
-				if unmountErr := m.close(); unmountErr != nil {
-					unmountErrs = append(unmountErrs, unmountErr)
-				}
-			}
-			return errors.Join(unmountErrs...)
-		})
+		a.mountsMu.Lock()
+		a.mounts = mounts
+		a.mountsMu.Unlock()
+		a.onClose = append(a.onClose, a.closeMounts)
 	}
 	if len(a.instConfig.AdditionalDisks) > 0 {
 		a.onClose = append(a.onClose, func() error {
@@ -486,7 +790,7 @@ sudo chown -R "${USER}" /run/host-services`
 	if !*a.instConfig.Plain {
 		go a.watchGuestAgentEvents(ctx)
 	}
-	if err := a.waitForRequirements("optional", a.optionalRequirements()); err != nil {
+	if err := a.waitForRequirements(ctx, events.PhaseOptional, a.optionalRequirements()); err != nil {
 		errs = append(errs, err)
 	}
 	if !*a.instConfig.Plain {
@@ -498,12 +802,21 @@ sudo chown -R "${USER}" /run/host-services`
 			errs = append(errs, errors.New("guest agent does not seem to be running; port forwards will not work"))
 		}
 	}
-	if err := a.waitForRequirements("final", a.finalRequirements()); err != nil {
+	if err := a.waitForRequirements(ctx, events.PhaseFinal, a.finalRequirements()); err != nil {
 		errs = append(errs, err)
+	} else if len(a.instConfig.Mounts) > 0 && *a.instConfig.MountType != limayaml.REVSSHFS && *a.instConfig.MountType != limayaml.NFS &&
+		!limayaml.IsExternalMountType(*a.instConfig.MountType) && !*a.instConfig.Plain {
+		// The other mount types are mounted by cloud-init before the boot scripts finish
+		a.emitEvent(ctx, events.Event{Ready: events.ReadyMounts})
 	}
 	// Copy all config files _after_ the requirements are done
 	for _, rule := range a.instConfig.CopyToHost {
-		if err := copyToHost(ctx, a.sshConfig, a.sshLocalPort, rule.HostFile, rule.GuestFile); err != nil {
+		if err := copyToHost(ctx, a.sshConfig, a.sshLocalPort, rule.HostFile, rule.GuestFile, *a.instConfig.Security.Sudo != limayaml.SudoNone); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if *a.instConfig.Security.Sudo == limayaml.SudoLimited {
+		if err := a.revokeSudo(ctx); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -522,6 +835,21 @@ sudo chown -R "${USER}" /run/host-services`
 	return errors.Join(errs...)
 }
 
+// closeMounts unmounts the mounts set up by the host agent. It is a NOP when called again.
+func (a *HostAgent) closeMounts() error {
+	a.mountsMu.Lock()
+	mounts := a.mounts
+	a.mounts = nil
+	a.mountsMu.Unlock()
+	var unmountErrs []error
+	for _, m := range mounts {
+		if unmountErr := m.close(); unmountErr != nil {
+			unmountErrs = append(unmountErrs, unmountErr)
+		}
+	}
+	return errors.Join(unmountErrs...)
+}
+
 func (a *HostAgent) close() error {
 	logrus.Infof("Shutting down the host agent")
 	var errs []error
@@ -563,7 +891,16 @@ func (a *HostAgent) watchGuestAgentEvents(ctx context.Context) {
 				}
 			}
 		}
-		if a.driver.ForwardGuestAgent() {
+		if a.socketForwarder != nil {
+			if err := a.socketForwarder.close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		a.guestAgentSockForwardedMu.Lock()
+		forwarded := a.guestAgentSockForwarded
+		a.guestAgentSockForwarded = false
+		a.guestAgentSockForwardedMu.Unlock()
+		if a.driver.ForwardGuestAgent() || forwarded {
 			if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbCancel, false); err != nil {
 				errs = append(errs, err)
 			}
@@ -603,6 +940,7 @@ func (a *HostAgent) watchGuestAgentEvents(ctx context.Context) {
 				logrus.WithError(err).Warn("connection to the guest agent was closed unexpectedly")
 			}
 		}
+		a.superviseGuestAgent(ctx)
 		select {
 		case <-ctx.Done():
 			return
@@ -629,6 +967,14 @@ func (a *HostAgent) getOrCreateClient(ctx context.Context) (*guestagentclient.Gu
 
 func (a *HostAgent) createConnection(ctx context.Context) (net.Conn, error) {
 	conn, err := a.driver.GuestAgentConn(ctx)
+	if err != nil && a.canFallBackToForwardedGuestAgent() {
+		// The guest agent serves on the UNIX socket too, even when it serves on vsock
+		logrus.WithError(err).Debug("failed to connect to the guest agent via vsock, falling back to the socket forwarded over SSH")
+		if fwdErr := a.forwardGuestAgentSock(ctx); fwdErr != nil {
+			return nil, errors.Join(err, fwdErr)
+		}
+		conn, err = nil, nil
+	}
 	// default to forwarded sock
 	if conn == nil && err == nil {
 		var d net.Dialer
@@ -637,50 +983,181 @@ func (a *HostAgent) createConnection(ctx context.Context) (net.Conn, error) {
 	return conn, err
 }
 
+// canFallBackToForwardedGuestAgent returns true when the guest agent socket can be forwarded over SSH,
+// after failing to connect to the guest agent via vsock.
+func (a *HostAgent) canFallBackToForwardedGuestAgent() bool {
+	return !a.driver.ForwardGuestAgent() && a.virtioPort == "" && *a.instConfig.VMType != limayaml.WSL2
+}
+
+// forwardGuestAgentSock forwards the guest agent socket over SSH, unless it is already forwarded.
+func (a *HostAgent) forwardGuestAgentSock(ctx context.Context) error {
+	a.guestAgentSockForwardedMu.Lock()
+	defer a.guestAgentSockForwardedMu.Unlock()
+	if a.guestAgentSockForwarded {
+		return nil
+	}
+	localUnix := filepath.Join(a.instDir, filenames.GuestAgentSock)
+	remoteUnix := "/run/lima-guestagent.sock"
+	if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbForward, false); err != nil {
+		return err
+	}
+	logrus.Info("Forwarded the guest agent socket over SSH, as a fallback for vsock")
+	a.guestAgentSockForwarded = true
+	return nil
+}
+
 func (a *HostAgent) processGuestAgentEvents(ctx context.Context, client *guestagentclient.GuestAgentClient) error {
 	info, err := client.Info(ctx)
 	if err != nil {
 		return err
 	}
 	logrus.Info("Guest agent is running")
+	a.markGuestAgentAlive(ctx)
 	a.guestAgentAliveChOnce.Do(func() {
 		close(a.guestAgentAliveCh)
 	})
+	a.emitEvent(ctx, events.Event{Ready: events.ReadyGuestAgent})
 
 	logrus.Debugf("guest agent info: %+v", info)
+	checkGuestAgentProtocol(info)
 
-	onEvent := func(ev *guestagentapi.Event) {
-		logrus.Debugf("guest agent event: %+v", ev)
-		for _, f := range ev.Errors {
-			logrus.Warnf("received error from the guest: %q", f)
-		}
-		// useSSHFwd was false by default in v1.0, but reverted to true by default in v1.0.1
-		// due to stability issues
-		useSSHFwd := true
-		if envVar := os.Getenv("LIMA_SSH_PORT_FORWARDER"); envVar != "" {
-			b, err := strconv.ParseBool(os.Getenv("LIMA_SSH_PORT_FORWARDER"))
-			if err != nil {
-				logrus.WithError(err).Warnf("invalid LIMA_SSH_PORT_FORWARDER value %q", envVar)
-			} else {
-				useSSHFwd = b
-			}
+	relayCtx, cancelRelays := context.WithCancel(ctx)
+	defer cancelRelays()
+	if len(a.instConfig.UDPRelays) > 0 && !info.HasCapability(guestagentapi.CapabilityUDPRelay) {
+		logrus.Warnf("Ignoring `udpRelays`, as the guest agent does not support %q", guestagentapi.CapabilityUDPRelay)
+	} else {
+		a.startUDPRelays(relayCtx, client)
+	}
+
+	if a.socketForwarder != nil && !info.HasCapability(guestagentapi.CapabilityLocalSockets) {
+		logrus.Warnf("Ignoring `socketForwards`, as the guest agent does not support %q", guestagentapi.CapabilityLocalSockets)
+	}
+
+	if a.powerSaving.Load() {
+		if info.HasCapability(guestagentapi.CapabilityPowerSaving) {
+			a.applyGuestAgentPowerSaving(ctx)
+		} else {
+			logrus.Debugf("Not reducing the polling of the guest agent, as it does not support %q", guestagentapi.CapabilityPowerSaving)
 		}
+	}
+
+	useSSHFwd := sshPortForwarderEnabled()
+	if !useSSHFwd && !info.HasCapability(guestagentapi.CapabilityTunnel) {
+		logrus.Debugf("Using the SSH port forwarder, as the guest agent does not support %q", guestagentapi.CapabilityTunnel)
+		useSSHFwd = true
+	}
+	forward := func(ev *guestagentapi.Event) {
 		if useSSHFwd {
 			a.portForwarder.OnEvent(ctx, ev)
 		} else {
 			a.grpcPortForwarder.OnEvent(ctx, client, ev)
 		}
 	}
+	// openPorts are the ports currently open in the guest, for rebinding them on the change of `hostIP`
+	openPorts := make(map[string]*guestagentapi.IPPort)
+	go a.watchHostIPs(relayCtx, func(oldIP, newIP net.IP) {
+		a.portForwardMu.Lock()
+		defer a.portForwardMu.Unlock()
+		ports := make([]*guestagentapi.IPPort, 0, len(openPorts))
+		for _, p := range openPorts {
+			ports = append(ports, p)
+		}
+		a.rebindPorts(forward, ports, oldIP, newIP)
+	})
 
-	if err := client.Events(ctx, onEvent); err != nil {
-		if status.Code(err) == codes.Canceled {
-			return context.Canceled
+	onEvent := func(ev *guestagentapi.Event) {
+		logrus.Debugf("guest agent event: %+v", ev)
+		for _, f := range ev.Errors {
+			logrus.Warnf("received error from the guest: %q", f)
+		}
+		a.portForwardMu.Lock()
+		for _, p := range ev.LocalPortsRemoved {
+			delete(openPorts, p.Protocol+"/"+p.HostString())
 		}
+		for _, p := range ev.LocalPortsAdded {
+			openPorts[p.Protocol+"/"+p.HostString()] = p
+		}
+		forward(ev)
+		a.portForwardMu.Unlock()
+		if a.socketForwarder != nil {
+			a.socketForwarder.OnEvent(ctx, ev)
+		}
+		if len(ev.LocalPortsAdded) > 0 || len(ev.LocalPortsRemoved) > 0 {
+			a.emitEvent(ctx, events.Event{GuestPorts: &events.GuestPorts{
+				Added:   guestPorts(ev.LocalPortsAdded),
+				Removed: guestPorts(ev.LocalPortsRemoved),
+			}})
+		}
+	}
+
+	err = client.Events(ctx, onEvent)
+	if err != nil && status.Code(err) == codes.Canceled {
+		return context.Canceled
+	}
+	// The guest agent was alive until now
+	a.markGuestAgentAlive(ctx)
+	a.emitEvent(ctx, events.Event{Unready: events.ReadyGuestAgent})
+	if err != nil {
 		return err
 	}
 	return io.EOF
 }
 
+// sshPortForwarderEnabled returns true unless $LIMA_SSH_PORT_FORWARDER is false.
+func sshPortForwarderEnabled() bool {
+	// useSSHFwd was false by default in v1.0, but reverted to true by default in v1.0.1
+	// due to stability issues
+	useSSHFwd := true
+	if envVar := os.Getenv("LIMA_SSH_PORT_FORWARDER"); envVar != "" {
+		b, err := strconv.ParseBool(os.Getenv("LIMA_SSH_PORT_FORWARDER"))
+		if err != nil {
+			logrus.WithError(err).Warnf("invalid LIMA_SSH_PORT_FORWARDER value %q", envVar)
+		} else {
+			useSSHFwd = b
+		}
+	}
+	return useSSHFwd
+}
+
+func (a *HostAgent) startUDPRelays(ctx context.Context, client *guestagentclient.GuestAgentClient) {
+	for _, relay := range a.instConfig.UDPRelays {
+		addr := net.JoinHostPort(relay.IP.String(), strconv.Itoa(relay.Port))
+		go func() {
+			logrus.Infof("Relaying UDP datagrams of %s", addr)
+			if err := portfwd.HandleUDPRelay(ctx, client, addr); err != nil && ctx.Err() == nil {
+				logrus.WithError(err).Warnf("UDP relay of %s failed", addr)
+			}
+		}()
+	}
+}
+
+// checkGuestAgentProtocol reports the difference of the protocol versions of the host agent and the guest agent.
+// The guest agent may differ from the host agent when the guest agent was not updated on the boot,
+// e.g., when the instance was not restarted after upgrading Lima.
+func checkGuestAgentProtocol(info *guestagentapi.Info) {
+	guestVersion := info.GetProtocolVersion()
+	switch {
+	case guestVersion < guestagentapi.ProtocolVersion:
+		logrus.Warnf("The guest agent is older than the host agent (protocol version %d < %d), the following features are unavailable: %v "+
+			"(hint: restart the instance to update the guest agent)", guestVersion, guestagentapi.ProtocolVersion, info.MissingCapabilities())
+	case guestVersion > guestagentapi.ProtocolVersion:
+		logrus.Warnf("The guest agent is newer than the host agent (protocol version %d > %d), some features may not work as expected",
+			guestVersion, guestagentapi.ProtocolVersion)
+	default:
+		if missing := info.MissingCapabilities(); len(missing) > 0 {
+			logrus.Warnf("The guest agent does not support the following features: %v", missing)
+		}
+	}
+}
+
+func guestPorts(ipPorts []*guestagentapi.IPPort) []events.GuestPort {
+	var res []events.GuestPort
+	for _, f := range ipPorts {
+		res = append(res, events.GuestPort{Protocol: f.Protocol, IP: f.Ip, Port: int(f.Port)})
+	}
+	return res
+}
+
 const (
 	verbForward = "forward"
 	verbCancel  = "cancel"
@@ -728,8 +1205,10 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 		case verbForward:
 			if reverse {
 				logrus.Infof("Forwarding %q (host) to %q (guest)", local, remote)
-				if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
-					logrus.WithError(err).Warnf("Failed to clean up %q (guest) before setting up forwarding", remote)
+				if strings.HasPrefix(remote, "/") {
+					if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
+						logrus.WithError(err).Warnf("Failed to clean up %q (guest) before setting up forwarding", remote)
+					}
 				}
 			} else {
 				logrus.Infof("Forwarding %q (guest) to %q (host)", remote, local)
@@ -743,8 +1222,10 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 		case verbCancel:
 			if reverse {
 				logrus.Infof("Stopping forwarding %q (host) to %q (guest)", local, remote)
-				if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
-					logrus.WithError(err).Warnf("Failed to clean up %q (guest) after stopping forwarding", remote)
+				if strings.HasPrefix(remote, "/") {
+					if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
+						logrus.WithError(err).Warnf("Failed to clean up %q (guest) after stopping forwarding", remote)
+					}
 				}
 			} else {
 				logrus.Infof("Stopping forwarding %q (guest) to %q (host)", remote, local)
@@ -763,8 +1244,10 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 		if verb == verbForward && strings.HasPrefix(local, "/") {
 			if reverse {
 				logrus.WithError(err).Warnf("Failed to set up forward from %q (host) to %q (guest)", local, remote)
-				if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
-					logrus.WithError(err).Warnf("Failed to clean up %q (guest) after forwarding failed", remote)
+				if strings.HasPrefix(remote, "/") {
+					if err := executeSSH(ctx, sshConfig, port, "rm", "-f", remote); err != nil {
+						logrus.WithError(err).Warnf("Failed to clean up %q (guest) after forwarding failed", remote)
+					}
 				}
 			} else {
 				logrus.WithError(err).Warnf("Failed to set up forward from %q (guest) to %q (host)", remote, local)
@@ -778,15 +1261,36 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 	return nil
 }
 
-func copyToHost(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string) error {
+// revokeSudo removes the sudoers rule written by 05-sudo-policy.sh for `security.sudo: limited`.
+func (a *HostAgent) revokeSudo(ctx context.Context) error {
+	script := `#!/bin/bash
+set -eux -o pipefail
+sudo rm -f /etc/sudoers.d/99-lima-sudo-policy
+if sudo -n true 2>/dev/null; then
+	echo >&2 "sudo is still allowed"
+	exit 1
+fi
+`
+	logrus.Info("Revoking sudo (security.sudo: limited)")
+	stdout, stderr, err := a.executeScript(ctx, script, "revoking sudo")
+	logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sudo: stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return nil
+}
+
+func copyToHost(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string, sudo bool) error {
 	args := sshConfig.Args()
 	args = append(args,
 		"-p", strconv.Itoa(port),
 		"127.0.0.1",
 		"--",
 	)
+	if sudo {
+		args = append(args, "sudo")
+	}
 	args = append(args,
-		"sudo",
 		"cat",
 		remote,
 	)
@@ -0,0 +1,183 @@
+package hostagent
+
+import (
+	"context"
+	"net"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// hostIPPollInterval is the interval of checking the addresses of the host interfaces for `portForwards[].hostIP`.
+const hostIPPollInterval = 5 * time.Second
+
+// hostInterfaceAddrs returns the addresses of the host interfaces that are up, by the names of the interfaces.
+// Replaced in the tests.
+var hostInterfaceAddrs = func() (map[string][]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]net.IP, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			logrus.WithError(err).Debugf("failed to get the addresses of interface %q", iface.Name)
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				res[iface.Name] = append(res[iface.Name], ipNet.IP)
+			}
+		}
+	}
+	return res, nil
+}
+
+// hostIPWatch tracks the address of the host interface that `portForwards[].hostIP` is bound to.
+type hostIPWatch struct {
+	// ip is the address that the port forwards are currently bound to
+	ip net.IP
+	// iface is the name of the interface that had ip, or empty when ip has never been seen
+	iface string
+	// available is false while ip is missing without a replacement
+	available bool
+}
+
+// newHostIPWatches returns the watches for the distinct addresses of the rules bound to a specific host address,
+// excluding the loopback addresses, which never change.
+func newHostIPWatches(rules []limayaml.PortForward, addrs map[string][]net.IP) []*hostIPWatch {
+	var res []*hostIPWatch
+	for _, rule := range rules {
+		if rule.HostSocket != "" || rule.Ignore || rule.HostIP == nil || rule.HostIP.IsUnspecified() || rule.HostIP.IsLoopback() {
+			continue
+		}
+		seen := false
+		for _, w := range res {
+			seen = seen || w.ip.Equal(rule.HostIP)
+		}
+		if seen {
+			continue
+		}
+		iface := interfaceOf(addrs, rule.HostIP)
+		if iface == "" {
+			logrus.Warnf("The host address %s of `portForwards[].hostIP` is not assigned to any interface of the host", rule.HostIP)
+		}
+		res = append(res, &hostIPWatch{ip: rule.HostIP, iface: iface, available: iface != ""})
+	}
+	return res
+}
+
+// interfaceOf returns the name of the interface that has ip, or an empty string.
+func interfaceOf(addrs map[string][]net.IP, ip net.IP) string {
+	for iface, ips := range addrs {
+		for _, x := range ips {
+			if x.Equal(ip) {
+				return iface
+			}
+		}
+	}
+	return ""
+}
+
+// check checks the current addresses of the host interfaces, and returns the change, or nil.
+// When ip has been lost, the first address of the same family on the same interface is picked as the replacement.
+func (w *hostIPWatch) check(addrs map[string][]net.IP) *events.HostIPChange {
+	if iface := interfaceOf(addrs, w.ip); iface != "" {
+		w.iface = iface
+		if w.available {
+			return nil
+		}
+		// The address has come back
+		w.available = true
+		return &events.HostIPChange{Interface: iface, Old: w.ip.String(), New: w.ip.String()}
+	}
+	if w.iface == "" {
+		return nil
+	}
+	for _, ip := range addrs[w.iface] {
+		if (ip.To4() != nil) != (w.ip.To4() != nil) || ip.IsLoopback() || (ip.IsLinkLocalUnicast() && !w.ip.IsLinkLocalUnicast()) {
+			continue
+		}
+		change := &events.HostIPChange{Interface: w.iface, Old: w.ip.String(), New: ip.String()}
+		w.ip = ip
+		w.available = true
+		return change
+	}
+	if !w.available {
+		return nil
+	}
+	w.available = false
+	return &events.HostIPChange{Interface: w.iface, Old: w.ip.String()}
+}
+
+// watchHostIPs rebinds the port forwards when the addresses of the host interfaces specified in `portForwards[].hostIP`
+// have changed, e.g., on the renewal of the DHCP lease, or on switching the network.
+// The rules are updated in place with the new addresses, so the new forwards are bound to the new addresses as well.
+func (a *HostAgent) watchHostIPs(ctx context.Context, rebind func(oldIP, newIP net.IP)) {
+	addrs, err := hostInterfaceAddrs()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to get the addresses of the host interfaces")
+		return
+	}
+	a.portForwardMu.Lock()
+	watches := newHostIPWatches(a.portForwardRules, addrs)
+	a.portForwardMu.Unlock()
+	if len(watches) == 0 {
+		return
+	}
+	ticker := time.NewTicker(hostIPPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		addrs, err := hostInterfaceAddrs()
+		if err != nil {
+			logrus.WithError(err).Debug("failed to get the addresses of the host interfaces")
+			continue
+		}
+		for _, w := range watches {
+			oldIP := w.ip
+			change := w.check(addrs)
+			if change == nil {
+				continue
+			}
+			if change.New == "" {
+				logrus.Warnf("The host address %s of `portForwards[].hostIP` has been removed from interface %q; "+
+					"the port forwards will be rebound when the interface gets a new address", change.Old, change.Interface)
+			} else {
+				logrus.Infof("Rebinding the port forwards from %s to %s (interface %q)", change.Old, change.New, change.Interface)
+				rebind(oldIP, w.ip)
+			}
+			a.emitEvent(ctx, events.Event{HostIPChange: change})
+		}
+	}
+}
+
+// rebindPorts replays the removal and the addition of the guest ports forwarded to oldIP,
+// with the rules updated to forward them to newIP. portForwardMu must be held.
+func (a *HostAgent) rebindPorts(forward func(*guestagentapi.Event), ports []*guestagentapi.IPPort, oldIP, newIP net.IP) {
+	var affected []*guestagentapi.IPPort
+	for _, p := range ports {
+		host, _, err := net.SplitHostPort(a.grpcPortForwarder.HostAddress(p))
+		if err == nil && net.ParseIP(host).Equal(oldIP) {
+			affected = append(affected, p)
+		}
+	}
+	forward(&guestagentapi.Event{LocalPortsRemoved: affected})
+	for i := range a.portForwardRules {
+		if a.portForwardRules[i].HostIP.Equal(oldIP) {
+			a.portForwardRules[i].HostIP = newIP
+		}
+	}
+	forward(&guestagentapi.Event{LocalPortsAdded: affected})
+}
@@ -0,0 +1,96 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/hostagent/dns"
+	"github.com/lima-vm/lima/pkg/identifierutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	etcHostsBegin = "# BEGIN lima hostResolver.hosts"
+	etcHostsEnd   = "# END lima hostResolver.hosts"
+)
+
+// staticHosts returns the static hosts of the DNS server, i.e., `hostResolver.hosts`
+// with the predefined names of the host and the guest.
+func (a *HostAgent) staticHosts(hosts map[string]string) map[string]string {
+	res := maps.Clone(hosts)
+	if res == nil {
+		res = make(map[string]string)
+	}
+	res["host.lima.internal"] = networks.SlirpGateway
+	hostname := identifierutil.HostnameFromInstName(a.instName) // TODO: support customization
+	res[hostname] = networks.SlirpIPAddress
+	return res
+}
+
+func dnsRules(rules []limayaml.HostResolverRule) []dns.Rule {
+	res := make([]dns.Rule, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, dns.Rule{Domain: rule.Domain, Servers: rule.Servers})
+	}
+	return res
+}
+
+// SetHosts replaces `hostResolver.hosts` of the running instance.
+// When etcHosts is true, the hosts with IP addresses are also written to /etc/hosts in the guest,
+// which is needed when the guest does not use the DNS server of the host agent.
+func (a *HostAgent) SetHosts(ctx context.Context, hosts map[string]string, etcHosts bool) error {
+	a.dnsServerMu.Lock()
+	dnsServer := a.dnsServer
+	a.dnsServerMu.Unlock()
+	if dnsServer == nil && !etcHosts {
+		return errors.New("the hosts cannot be updated without etcHosts, as `hostResolver` is not served by the host agent")
+	}
+	if dnsServer != nil {
+		dnsServer.SetStaticHosts(a.staticHosts(hosts))
+		logrus.Infof("Updated the static hosts of the DNS server (%d entries)", len(hosts))
+	}
+	if etcHosts {
+		script := etcHostsScript(a.sudoPrefix(), hosts)
+		stdout, stderr, err := a.executeScript(ctx, script, "updating /etc/hosts")
+		logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+		if err != nil {
+			return fmt.Errorf("failed to update /etc/hosts: stdout=%q, stderr=%q: %w", stdout, stderr, err)
+		}
+	}
+	return nil
+}
+
+// etcHostsScript returns the script that replaces the block of the hosts in /etc/hosts.
+// Hosts that are aliases of other hostnames cannot be expressed in /etc/hosts, and are skipped.
+func etcHostsScript(sudo string, hosts map[string]string) string {
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	slices.Sort(names)
+	var block strings.Builder
+	block.WriteString(etcHostsBegin + "\n")
+	for _, host := range names {
+		ip := net.ParseIP(hosts[host])
+		if ip == nil || strings.ContainsAny(host, " \t\n#'") {
+			logrus.Debugf("Not writing %q to /etc/hosts", host)
+			continue
+		}
+		fmt.Fprintf(&block, "%s\t%s\n", ip, host)
+	}
+	block.WriteString(etcHostsEnd)
+	// /etc/hosts is rewritten in place (not with `sed -i`), as it may be a bind mount
+	return `#!/bin/bash
+set -eu -o pipefail
+hosts="$(sed '/^` + etcHostsBegin + `$/,/^` + etcHostsEnd + `$/d' /etc/hosts)"
+block='` + block.String() + `'
+printf '%s\n%s\n' "${hosts}" "${block}" | ` + sudo + `tee /etc/hosts >/dev/null
+`
+}
@@ -5,9 +5,14 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/rjeczalik/notify"
 	"github.com/sirupsen/logrus"
@@ -16,17 +21,16 @@ import (
 
 const CacheSize = 10000
 
-var (
-	inotifyCache  = make(map[string]int64)
-	mountSymlinks = make(map[string]string)
-)
-
 func (a *HostAgent) startInotify(ctx context.Context) error {
-	mountWatchCh := make(chan notify.EventInfo, 128)
-	err := a.setupWatchers(mountWatchCh)
+	mounts, err := a.setupWatchers()
 	if err != nil {
 		return err
 	}
+	defer func() {
+		for _, m := range mounts {
+			notify.Stop(m.events)
+		}
+	}()
 	client, err := a.getOrCreateClient(ctx)
 	if err != nil {
 		logrus.WithError(err).Error("failed to create client for inotify")
@@ -36,76 +40,212 @@ func (a *HostAgent) startInotify(ctx context.Context) error {
 		return err
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case watchEvent := <-mountWatchCh:
-			watchPath := watchEvent.Path()
-			stat, err := os.Stat(watchPath)
-			if err != nil {
-				continue
-			}
-
-			if filterEvents(watchEvent, stat) {
-				continue
-			}
-
-			for k, v := range mountSymlinks {
-				if strings.HasPrefix(watchPath, k) {
-					watchPath = strings.ReplaceAll(watchPath, k, v)
-				}
-			}
-			utcTimestamp := timestamppb.New(stat.ModTime().UTC())
-			event := &guestagentapi.Inotify{MountPath: watchPath, Time: utcTimestamp}
-			err = inotifyClient.Send(event)
-			if err != nil {
-				logrus.WithError(err).Warn("failed to send inotify")
-			}
+	// The stream is shared by the mounts
+	var sendMu sync.Mutex
+	send := func(event *guestagentapi.Inotify) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		if err := inotifyClient.Send(event); err != nil {
+			logrus.WithError(err).Warn("failed to send inotify")
 		}
 	}
+	var wg sync.WaitGroup
+	for _, m := range mounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.run(ctx, send)
+		}()
+	}
+	wg.Wait()
+	return nil
 }
 
-func (a *HostAgent) setupWatchers(events chan notify.EventInfo) error {
+func (a *HostAgent) setupWatchers() ([]*inotifyMount, error) {
+	var res []*inotifyMount
 	for _, m := range a.instConfig.Mounts {
 		if !*m.Writable {
 			continue
 		}
-		location, err := localpathutil.Expand(m.Location)
+		im, err := newInotifyMount(m)
 		if err != nil {
-			return err
+			return res, err
 		}
-		symlink, err := filepath.EvalSymlinks(location)
+		logrus.Infof("enable inotify for writable mount: %s", im.location)
+		err = notify.Watch(path.Join(im.location, "..."), im.events, GetNotifyEvent())
 		if err != nil {
-			return err
+			return res, err
 		}
-		if location != symlink {
-			mountSymlinks[symlink] = location
+		res = append(res, im)
+	}
+	return res, nil
+}
+
+// inotifyMount forwards the inotify events of a writable mount to the guest,
+// according to `mounts[].inotify`.
+type inotifyMount struct {
+	location string
+	// symlink is the location with the symlinks resolved, as reported by notify
+	symlink            string
+	mountPoint         string
+	include, exclude   []string
+	batchInterval      time.Duration
+	maxEventsPerSecond int
+	events             chan notify.EventInfo
+
+	// pending maps the guest paths to the modification times, until flushed
+	pending map[string]time.Time
+	// sent maps the guest paths to the last modification times sent to the guest, so as to
+	// ignore the events caused by the guest agent applying them
+	sent map[string]int64
+	// filtered and rateLimited are the counters since the last message
+	filtered, rateLimited uint64
+	windowStart           time.Time
+	windowCount           int
+}
+
+func newInotifyMount(m limayaml.Mount) (*inotifyMount, error) {
+	location, err := localpathutil.Expand(m.Location)
+	if err != nil {
+		return nil, err
+	}
+	symlink, err := filepath.EvalSymlinks(location)
+	if err != nil {
+		return nil, err
+	}
+	mountPoint, err := localpathutil.Expand(*m.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+	batchInterval, err := time.ParseDuration(*m.Inotify.BatchInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &inotifyMount{
+		location:           location,
+		symlink:            symlink,
+		mountPoint:         mountPoint,
+		include:            m.Inotify.Include,
+		exclude:            m.Inotify.Exclude,
+		batchInterval:      batchInterval,
+		maxEventsPerSecond: *m.Inotify.MaxEventsPerSecond,
+		events:             make(chan notify.EventInfo, 128),
+		pending:            make(map[string]time.Time),
+		sent:               make(map[string]int64),
+	}, nil
+}
+
+func (im *inotifyMount) run(ctx context.Context, send func(*guestagentapi.Inotify)) {
+	var tick <-chan time.Time
+	if im.batchInterval > 0 {
+		ticker := time.NewTicker(im.batchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case watchEvent := <-im.events:
+			stat, err := os.Stat(watchEvent.Path())
+			if err != nil {
+				continue
+			}
+			im.add(watchEvent.Path(), stat.ModTime())
+			if tick == nil {
+				im.flush(time.Now(), send)
+			}
+		case now := <-tick:
+			im.flush(now, send)
 		}
+	}
+}
 
-		logrus.Infof("enable inotify for writable mount: %s", location)
-		err = notify.Watch(path.Join(location, "..."), events, GetNotifyEvent())
-		if err != nil {
-			return err
+// relPath returns the slash-separated path of hostPath relative to the mount location.
+func (im *inotifyMount) relPath(hostPath string) (string, bool) {
+	for _, base := range []string{im.symlink, im.location} {
+		if rel, err := filepath.Rel(base, hostPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel), true
 		}
 	}
-	return nil
+	return "", false
 }
 
-func filterEvents(event notify.EventInfo, stat os.FileInfo) bool {
-	currTime := stat.ModTime()
-	eventPath := event.Path()
-	cacheMilli, ok := inotifyCache[eventPath]
-	if ok {
-		// Ignore repeated events for 10ms to exclude recursive inotify events
-		if currTime.UnixMilli()-cacheMilli < 10 {
-			return true
+// match returns true if the relative path is included and not excluded.
+func (im *inotifyMount) match(rel string) bool {
+	if len(im.include) > 0 {
+		var included bool
+		for _, pattern := range im.include {
+			if ok, _ := doublestar.Match(pattern, rel); ok {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
 		}
 	}
-	inotifyCache[eventPath] = currTime.UnixMilli()
+	for _, pattern := range im.exclude {
+		if ok, _ := doublestar.Match(pattern, rel); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (im *inotifyMount) add(hostPath string, modTime time.Time) {
+	rel, ok := im.relPath(hostPath)
+	if !ok {
+		return
+	}
+	if !im.match(rel) {
+		im.filtered++
+		return
+	}
+	guestPath := path.Join(filepath.ToSlash(im.mountPoint), rel)
+	if sent, ok := im.sent[guestPath]; ok && sent == modTime.UnixMilli() {
+		// Caused by the guest agent applying the previous event
+		return
+	}
+	im.pending[guestPath] = modTime
+}
 
-	if len(inotifyCache) >= CacheSize {
-		inotifyCache = make(map[string]int64)
+// flush sends the pending events, up to `maxEventsPerSecond`.
+func (im *inotifyMount) flush(now time.Time, send func(*guestagentapi.Inotify)) {
+	guestPaths := make([]string, 0, len(im.pending))
+	for p := range im.pending {
+		guestPaths = append(guestPaths, p)
+	}
+	sort.Strings(guestPaths)
+	if im.maxEventsPerSecond > 0 {
+		if now.Sub(im.windowStart) >= time.Second {
+			im.windowStart = now
+			im.windowCount = 0
+		}
+		if allowed := max(im.maxEventsPerSecond-im.windowCount, 0); len(guestPaths) > allowed {
+			im.rateLimited += uint64(len(guestPaths) - allowed)
+			guestPaths = guestPaths[:allowed]
+		}
+		im.windowCount += len(guestPaths)
+	}
+	// The counters are sent with the first event, or alone when no event is sent
+	counters := &guestagentapi.Inotify{Filtered: im.filtered, RateLimited: im.rateLimited}
+	for _, p := range guestPaths {
+		modTime := im.pending[p]
+		event := &guestagentapi.Inotify{MountPath: p, Time: timestamppb.New(modTime.UTC())}
+		if counters != nil {
+			event.Filtered, event.RateLimited = counters.Filtered, counters.RateLimited
+			counters = nil
+		}
+		send(event)
+		if len(im.sent) >= CacheSize {
+			im.sent = make(map[string]int64)
+		}
+		im.sent[p] = modTime.UnixMilli()
+	}
+	if counters != nil && (counters.Filtered > 0 || counters.RateLimited > 0) {
+		send(counters)
 	}
-	return false
+	im.filtered, im.rateLimited = 0, 0
+	clear(im.pending)
 }
@@ -0,0 +1,26 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/sirupsen/logrus"
+)
+
+// ApplyKernelConfig loads the kernel modules and sets the sysctl values in the guest, via the guest agent.
+// The sysctl keys that are not specified are left unchanged.
+func (a *HostAgent) ApplyKernelConfig(ctx context.Context, modules []string, sysctl map[string]string) error {
+	a.clientMu.RLock()
+	client := a.client
+	a.clientMu.RUnlock()
+	if client == nil {
+		return errors.New("the guest agent is not connected yet")
+	}
+	req := &guestagentapi.KernelConfigRequest{Modules: modules, Sysctl: sysctl}
+	if err := client.ApplyKernelConfig(ctx, req); err != nil {
+		return err
+	}
+	logrus.Infof("Applied the kernel config (%d modules, %d sysctl keys)", len(modules), len(sysctl))
+	return nil
+}
@@ -0,0 +1,77 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	guestagentapi "github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/sirupsen/logrus"
+)
+
+// metricsTimeout is the timeout of collecting the metrics from the guest agent for a scrape.
+const metricsTimeout = 10 * time.Second
+
+// startMetricsServer serves the metrics of the guest in the Prometheus format on http://127.0.0.1:PORT/metrics
+// (`limactl start --metrics-port`). The returned function stops the server.
+func (a *HostAgent) startMetricsServer(port int) (func(), error) {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on the metrics port: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", a.serveMetrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(l); err != http.ErrServerClosed {
+			logrus.WithError(err).Warn("metrics server exited with an error")
+		}
+	}()
+	logrus.Infof("Serving the metrics on http://%s/metrics", l.Addr())
+	return func() { _ = srv.Close() }, nil
+}
+
+func (a *HostAgent) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), metricsTimeout)
+	defer cancel()
+	m, err := a.guestMetrics(ctx)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	up := 1
+	if err != nil {
+		logrus.WithError(err).Debug("failed to collect the metrics of the guest")
+		up = 0
+	}
+	fmt.Fprintf(w, "# HELP %sagent_up Whether the metrics of the guest agent were collected.\n", guestagentapi.MetricsPrefix)
+	fmt.Fprintf(w, "# TYPE %sagent_up gauge\n", guestagentapi.MetricsPrefix)
+	fmt.Fprintf(w, "%sagent_up %d\n", guestagentapi.MetricsPrefix, up)
+	if m != nil {
+		if err := m.WritePrometheus(w); err != nil {
+			logrus.WithError(err).Debug("failed to write the metrics")
+		}
+	}
+}
+
+func (a *HostAgent) guestMetrics(ctx context.Context) (*guestagentapi.Metrics, error) {
+	a.clientMu.RLock()
+	client := a.client
+	a.clientMu.RUnlock()
+	if client == nil {
+		return nil, errors.New("the guest agent is not connected yet")
+	}
+	info, err := client.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !info.HasCapability(guestagentapi.CapabilityMetrics) {
+		return nil, fmt.Errorf("the guest agent does not support %q; restart the instance to update the guest agent", guestagentapi.CapabilityMetrics)
+	}
+	return client.Metrics(ctx)
+}
@@ -0,0 +1,93 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/driver/external"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/localpathutil"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/sirupsen/logrus"
+)
+
+// setupExternalMounts starts the external mount driver ("lima-mount-NAME"), and mounts the directories
+// by executing the scripts returned by the driver in the guest.
+// The returned mounts include the driver itself, to be closed after the other mounts.
+func (a *HostAgent) setupExternalMounts(ctx context.Context) ([]*mount, error) {
+	drv, err := external.StartMountDriver(ctx, *a.instConfig.MountType, a.instDir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		res  []*mount
+		errs []error
+	)
+	for _, f := range a.instConfig.Mounts {
+		m, err := a.setupExternalMount(ctx, drv, f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res = append(res, m)
+	}
+	res = append(res, &mount{
+		close: func() error {
+			logrus.Infof("Stopping the external mount driver %q", drv.Info.Name)
+			return drv.Close()
+		},
+	})
+	return res, errors.Join(errs...)
+}
+
+func (a *HostAgent) setupExternalMount(ctx context.Context, drv *external.MountDriverProcess, m limayaml.Mount) (*mount, error) {
+	location, err := localpathutil.Expand(m.Location)
+	if err != nil {
+		return nil, err
+	}
+	mountPoint, err := localpathutil.Expand(*m.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+	req := &external.MountRequest{
+		InstanceName: a.instName,
+		InstanceDir:  a.instDir,
+		Location:     location,
+		MountPoint:   mountPoint,
+		Writable:     *m.Writable,
+		HostAddress:  networks.SlirpGateway,
+	}
+	logrus.Infof("Mounting %q on %q with the external mount driver %q", location, mountPoint, drv.Info.Name)
+	res, err := drv.Mount(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("external mount driver %q failed to mount %q on %q: %w", drv.Info.Name, location, mountPoint, err)
+	}
+	desc := fmt.Sprintf("mounting %q on %q", location, mountPoint)
+	stdout, stderr, err := a.executeScript(ctx, res.GuestScript, desc)
+	logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+	if err != nil {
+		if _, unmountErr := drv.Unmount(context.Background(), req); unmountErr != nil {
+			logrus.WithError(unmountErr).Warnf("failed to unmount %q", location)
+		}
+		return nil, fmt.Errorf("failed to mount %q on %q: stdout=%q, stderr=%q: %w", location, mountPoint, stdout, stderr, err)
+	}
+	return &mount{
+		close: func() error {
+			logrus.Infof("Unmounting %q", location)
+			var errs []error
+			if res.GuestUnmountScript != "" {
+				desc := fmt.Sprintf("unmounting %q", mountPoint)
+				stdout, stderr, err := a.executeScript(context.Background(), res.GuestUnmountScript, desc)
+				logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("failed to unmount %q: stdout=%q, stderr=%q: %w", mountPoint, stdout, stderr, err))
+				}
+			}
+			if _, err := drv.Unmount(context.Background(), req); err != nil {
+				errs = append(errs, fmt.Errorf("external mount driver %q failed to unmount %q: %w", drv.Info.Name, location, err))
+			}
+			return errors.Join(errs...)
+		},
+	}, nil
+}
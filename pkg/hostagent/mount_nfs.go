@@ -0,0 +1,129 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/localpathutil"
+	"github.com/lima-vm/lima/pkg/nfsserver"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// setupNFSMounts serves the mounts over NFS for `mountType: nfs`.
+// The servers listen on the UNIX sockets in the instance directory, and are reverse-forwarded
+// to the guest TCP ports, so the host does not open any TCP port.
+// The mounts are written to /etc/fstab by cloud-init with "noauto", and are mounted here.
+func (a *HostAgent) setupNFSMounts(ctx context.Context) ([]*mount, error) {
+	var (
+		res  []*mount
+		errs []error
+	)
+	for i, f := range a.instConfig.Mounts {
+		m, err := a.setupNFSMount(ctx, i, f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res = append(res, m)
+	}
+	return res, errors.Join(errs...)
+}
+
+func (a *HostAgent) setupNFSMount(ctx context.Context, i int, m limayaml.Mount) (*mount, error) {
+	location, err := localpathutil.Expand(m.Location)
+	if err != nil {
+		return nil, err
+	}
+	mountPoint, err := localpathutil.Expand(*m.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(location, 0o755); err != nil {
+		return nil, err
+	}
+	logrus.Infof("Mounting %q on %q over NFS", location, mountPoint)
+
+	sock := filepath.Join(a.instDir, fmt.Sprintf(filenames.NFSSock, i))
+	if err := os.RemoveAll(sock); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	serveCtx, cancelServe := context.WithCancel(context.Background())
+	serveDone := make(chan struct{})
+	go func() {
+		defer close(serveDone)
+		if serveErr := nfsserver.Serve(serveCtx, l, location, *m.Writable); serveErr != nil {
+			logrus.WithError(serveErr).Errorf("NFS server for %q exited", location)
+		}
+	}()
+	stopServe := func() {
+		cancelServe()
+		<-serveDone
+		_ = os.RemoveAll(sock)
+	}
+
+	guest := fmt.Sprintf("127.0.0.1:%d", nfsserver.GuestPort(i))
+	if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, sock, guest, verbForward, true); err != nil {
+		stopServe()
+		return nil, fmt.Errorf("failed to forward the NFS server for %q: %w", location, err)
+	}
+	cancelForward := func() error {
+		// using ctx.Background() because ctx has already been cancelled
+		return forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, sock, guest, verbCancel, true)
+	}
+
+	sudo := a.sudoPrefix()
+	mp := shellescape.Quote(mountPoint)
+	script := `#!/bin/bash
+set -eux -o pipefail
+` + sudo + `mkdir -p ` + mp + `
+if ! mountpoint -q ` + mp + `; then
+	` + sudo + `mount ` + mp + `
+fi
+`
+	desc := fmt.Sprintf("mounting %q on %q over NFS", location, mountPoint)
+	stdout, stderr, err := a.executeScript(ctx, script, desc)
+	logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+	if err != nil {
+		if cancelErr := cancelForward(); cancelErr != nil {
+			logrus.WithError(cancelErr).Warnf("failed to stop forwarding the NFS server for %q", location)
+		}
+		stopServe()
+		return nil, fmt.Errorf("failed to mount %q on %q: stdout=%q, stderr=%q: %w", location, mountPoint, stdout, stderr, err)
+	}
+
+	return &mount{
+		close: func() error {
+			logrus.Infof("Unmounting %q", location)
+			var errs []error
+			// Lazy unmount, as the processes in the guest may still be using the mount
+			script := `#!/bin/bash
+set -eux -o pipefail
+if mountpoint -q ` + mp + `; then
+	` + sudo + `umount -l ` + mp + `
+fi
+`
+			desc := fmt.Sprintf("unmounting %q", mountPoint)
+			stdout, stderr, err := a.executeScript(context.Background(), script, desc)
+			logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to unmount %q: stdout=%q, stderr=%q: %w", mountPoint, stdout, stderr, err))
+			}
+			if err := cancelForward(); err != nil {
+				errs = append(errs, err)
+			}
+			stopServe()
+			return errors.Join(errs...)
+		},
+	}, nil
+}
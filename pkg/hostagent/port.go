@@ -6,6 +6,7 @@ import (
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/portfwd"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
 )
@@ -16,19 +17,22 @@ type portForwarder struct {
 	rules       []limayaml.PortForward
 	ignore      bool
 	vmType      limayaml.VMType
+	// limits may be nil; only `maxForwards` applies, as the connections are relayed by ssh
+	limits *portfwd.Limits
 }
 
 const sshGuestPort = 22
 
 var IPv4loopback1 = limayaml.IPv4loopback1
 
-func newPortForwarder(sshConfig *ssh.SSHConfig, sshHostPort int, rules []limayaml.PortForward, ignore bool, vmType limayaml.VMType) *portForwarder {
+func newPortForwarder(sshConfig *ssh.SSHConfig, sshHostPort int, rules []limayaml.PortForward, ignore bool, vmType limayaml.VMType, limits *portfwd.Limits) *portForwarder {
 	return &portForwarder{
 		sshConfig:   sshConfig,
 		sshHostPort: sshHostPort,
 		rules:       rules,
 		ignore:      ignore,
 		vmType:      vmType,
+		limits:      limits,
 	}
 }
 
@@ -94,6 +98,7 @@ func (pf *portForwarder) OnEvent(ctx context.Context, ev *api.Event) {
 		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbCancel); err != nil {
 			logrus.WithError(err).Warnf("failed to stop forwarding tcp port %d", f.Port)
 		}
+		pf.limits.ReleaseForward("tcp", local, remote)
 	}
 	for _, f := range ev.LocalPortsAdded {
 		if f.Protocol != "tcp" {
@@ -106,6 +111,10 @@ func (pf *portForwarder) OnEvent(ctx context.Context, ev *api.Event) {
 			}
 			continue
 		}
+		if !pf.limits.AcquireForward("tcp", local, remote) {
+			logrus.Debugf("Not forwarding TCP %s, as `portForwardLimits.maxForwards` has been hit", remote)
+			continue
+		}
 		logrus.Infof("Forwarding TCP from %s to %s", remote, local)
 		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbForward); err != nil {
 			logrus.WithError(err).Warnf("failed to set up forwarding tcp port %d (negligible if already forwarded)", f.Port)
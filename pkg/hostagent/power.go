@@ -0,0 +1,93 @@
+package hostagent
+
+import (
+	"context"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/powersource"
+	"github.com/sirupsen/logrus"
+)
+
+// powerSourceInterval is the interval of checking the power source of the host for `powerSaving.mode: auto`.
+const powerSourceInterval = 30 * time.Second
+
+// watchPowerSource enters the power saving mode when the host is running on battery (`powerSaving.mode: auto`),
+// or immediately (`powerSaving.mode: always`).
+func (a *HostAgent) watchPowerSource(ctx context.Context) {
+	mode := *a.instConfig.PowerSaving.Mode
+	if mode == limayaml.PowerSavingAlways {
+		a.setPowerSaving(ctx, true, false)
+		return
+	}
+	ticker := time.NewTicker(powerSourceInterval)
+	defer ticker.Stop()
+	for {
+		onBattery, err := powersource.OnBattery(ctx)
+		if err != nil {
+			logrus.WithError(err).Debug("failed to detect the power source of the host")
+		} else if onBattery != a.powerSaving.Load() {
+			a.setPowerSaving(ctx, onBattery, onBattery)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setPowerSaving enters or leaves the power saving mode.
+func (a *HostAgent) setPowerSaving(ctx context.Context, enabled, onBattery bool) {
+	if enabled {
+		logrus.Info("Entering the power saving mode")
+	} else {
+		logrus.Info("Leaving the power saving mode")
+	}
+	a.powerSaving.Store(enabled)
+	ev := &events.PowerSaving{Enabled: enabled, OnBattery: onBattery}
+	pause := *a.instConfig.PowerSaving.Pause
+	switch {
+	case enabled && pause:
+		// Set the guest agent before pausing, as the guest cannot respond while it is paused
+		a.applyGuestAgentPowerSaving(ctx)
+		if err := a.driver.Pause(ctx); err != nil {
+			logrus.WithError(err).Warn("failed to pause the instance")
+		} else {
+			logrus.Info("Paused the instance")
+			ev.Paused = true
+		}
+	case !enabled && pause:
+		if err := a.driver.Resume(ctx); err != nil {
+			logrus.WithError(err).Warn("failed to resume the instance")
+		} else {
+			logrus.Info("Resumed the instance")
+		}
+		a.applyGuestAgentPowerSaving(ctx)
+	default:
+		a.applyGuestAgentPowerSaving(ctx)
+	}
+	a.emitEvent(ctx, events.Event{PowerSaving: ev})
+}
+
+// applyGuestAgentPowerSaving reduces the frequency of polling the guest events in the power saving mode.
+// It is called again on every connection to the guest agent.
+func (a *HostAgent) applyGuestAgentPowerSaving(ctx context.Context) {
+	a.clientMu.RLock()
+	client := a.client
+	a.clientMu.RUnlock()
+	if client == nil {
+		return
+	}
+	var tick time.Duration
+	if a.powerSaving.Load() {
+		// Validated in limayaml
+		tick, _ = time.ParseDuration(*a.instConfig.PowerSaving.GuestAgentTick)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.SetPowerSaving(ctx, tick); err != nil {
+		logrus.WithError(err).Debug("failed to set the power saving mode of the guest agent")
+	}
+}
@@ -1,39 +1,49 @@
 package hostagent
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
 )
 
-func (a *HostAgent) waitForRequirements(label string, requirements []requirement) error {
+func (a *HostAgent) waitForRequirements(ctx context.Context, label string, requirements []requirement) error {
 	const (
 		retries       = 60
 		sleepDuration = 10 * time.Second
 	)
 	var errs []error
+	a.emitEvent(ctx, events.Event{Phase: label})
 
 	for i, req := range requirements {
+		begin := time.Now()
 	retryLoop:
 		for j := 0; j < retries; j++ {
 			logrus.Infof("Waiting for the %s requirement %d of %d: %q", label, i+1, len(requirements), req.description)
 			err := a.waitForRequirement(req)
 			if err == nil {
 				logrus.Infof("The %s requirement %d of %d is satisfied", label, i+1, len(requirements))
+				a.emitProbeEvent(ctx, req, begin, nil)
+				if req.ready != "" {
+					a.emitEvent(ctx, events.Event{Ready: req.ready})
+				}
 				break retryLoop
 			}
 			if req.fatal {
 				logrus.Infof("No further %s requirements will be checked", label)
 				errs = append(errs, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s; skipping further checks: %w", label, i+1, len(requirements), req.description, req.debugHint, err))
+				a.emitProbeEvent(ctx, req, begin, err)
 				return errors.Join(errs...)
 			}
 			if j == retries-1 {
 				errs = append(errs, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s: %w", label, i+1, len(requirements), req.description, req.debugHint, err))
+				a.emitProbeEvent(ctx, req, begin, err)
 				break retryLoop
 			}
 			time.Sleep(10 * time.Second)
@@ -42,10 +52,27 @@ func (a *HostAgent) waitForRequirements(label string, requirements []requirement
 	return errors.Join(errs...)
 }
 
+// emitProbeEvent emits the result of the requirement if it is a readiness probe.
+func (a *HostAgent) emitProbeEvent(ctx context.Context, req requirement, begin time.Time, err error) {
+	if req.probe == "" {
+		return
+	}
+	st := &events.ProbeStatus{
+		Name:     req.probe,
+		Passed:   err == nil,
+		Duration: time.Since(begin),
+	}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	a.emitEvent(ctx, events.Event{Probe: st})
+}
+
 // prefixExportParam will modify a script to be executed by ssh.ExecuteScript so that it exports
 // all the variables from /mnt/lima-cidata/param.env before invoking the actual interpreter.
 //
-//   - The script is executed in user mode, so needs to read the file using `sudo`.
+//   - The script is executed in user mode, so needs to read the file using `sudo`,
+//     unless `security.sudo` is "none" (see (*HostAgent).cidataFile).
 //
 //   - `sudo cat param.env | while …; do export …; done` does not work because the piping
 //     creates a subshell, and the exported variables are not visible to the parent process.
@@ -73,14 +100,13 @@ func (a *HostAgent) waitForRequirements(label string, requirements []requirement
 //
 // An earlier implementation used $'…' for quoting, but that isn't supported if the
 // user switched the default shell to fish.
-func prefixExportParam(script string) (string, error) {
+func prefixExportParam(script, sudo, paramEnv string) (string, error) {
 	interpreter, err := ssh.ParseScriptInterpreter(script)
 	if err != nil {
 		return "", err
 	}
 
-	// TODO we should have a symbolic constant for `/mnt/lima-cidata`
-	exportParam := `while read -r line; do [ -n "$line" ] && export "$line"; done<<EOF\n$(sudo cat /mnt/lima-cidata/param.env)\nEOF\n`
+	exportParam := `while read -r line; do [ -n "$line" ] && export "$line"; done<<EOF\n$(` + sudo + `cat ` + paramEnv + `)\nEOF\n`
 
 	// double up all '%' characters so we can pass them through unchanged in the format string of printf
 	interpreter = strings.ReplaceAll(interpreter, "%", "%%")
@@ -93,7 +119,8 @@ func prefixExportParam(script string) (string, error) {
 
 func (a *HostAgent) waitForRequirement(r requirement) error {
 	logrus.Debugf("executing script %q", r.description)
-	script, err := prefixExportParam(r.script)
+	sudo, paramEnv := a.cidataFile("param.env")
+	script, err := prefixExportParam(r.script, sudo, paramEnv)
 	if err != nil {
 		return err
 	}
@@ -105,14 +132,38 @@ func (a *HostAgent) waitForRequirement(r requirement) error {
 	return nil
 }
 
+// cidataFile returns the command prefix ("sudo " or "") and the path for reading a cidata file in the guest.
+// When `security.sudo` is "none", the copies published in /run by the boot scripts are read without sudo.
+//
+// TODO we should have a symbolic constant for `/mnt/lima-cidata`
+func (a *HostAgent) cidataFile(name string) (sudo, path string) {
+	if *a.instConfig.Security.Sudo == limayaml.SudoNone {
+		return "", "/run/lima-" + name
+	}
+	return a.sudoPrefix(), "/mnt/lima-cidata/" + name
+}
+
+// sudoPrefix returns "sudo ", or "" when `security.sudo` is "none".
+func (a *HostAgent) sudoPrefix() string {
+	if *a.instConfig.Security.Sudo == limayaml.SudoNone {
+		return ""
+	}
+	return "sudo "
+}
+
 type requirement struct {
 	description string
 	script      string
 	debugHint   string
 	fatal       bool
+	// probe is the name of the readiness probe, empty for the builtin requirements
+	probe string
+	// ready is the component that becomes ready when the requirement is satisfied, e.g., events.ReadySSH
+	ready string
 }
 
 func (a *HostAgent) essentialRequirements() []requirement {
+	sudo, metaData := a.cidataFile("meta-data")
 	req := make([]requirement, 0)
 	req = append(req,
 		requirement{
@@ -126,14 +177,16 @@ If any private key under ~/.ssh is protected with a passphrase, you need to have
 `,
 		})
 	if *a.instConfig.Plain {
+		req[0].ready = events.ReadySSH
 		return req
 	}
 	req = append(req,
 		requirement{
 			description: "user session is ready for ssh",
+			ready:       events.ReadySSH,
 			script: `#!/bin/bash
 set -eux -o pipefail
-if ! timeout 30s bash -c "until sudo diff -q /run/lima-ssh-ready /mnt/lima-cidata/meta-data 2>/dev/null; do sleep 3; done"; then
+if ! timeout 30s bash -c "until ` + sudo + `diff -q /run/lima-ssh-ready ` + metaData + ` 2>/dev/null; do sleep 3; done"; then
 	echo >&2 "not ready to start persistent ssh session"
 	exit 1
 fi
@@ -165,7 +218,7 @@ A possible workaround is to run "apt-get install sshfs" in the guest.
 			description: "fuse to \"allow_other\" as user",
 			script: `#!/bin/bash
 set -eux -o pipefail
-if ! timeout 30s bash -c "until sudo grep -q ^user_allow_other /etc/fuse*.conf; do sleep 3; done"; then
+if ! timeout 30s bash -c "until ` + sudo + `grep -q ^user_allow_other /etc/fuse*.conf; do sleep 3; done"; then
 	echo >&2 "/etc/fuse.conf (/etc/fuse3.conf) is not updated to contain \"user_allow_other\""
 	exit 1
 fi
@@ -173,6 +226,23 @@ fi
 			debugHint: `Append "user_allow_other" to /etc/fuse.conf (/etc/fuse3.conf) in the guest`,
 		})
 	}
+	if *a.instConfig.MountType == limayaml.NFS && len(a.instConfig.Mounts) > 0 {
+		req = append(req, requirement{
+			description: "mount.nfs binary to be installed",
+			script: `#!/bin/bash
+set -eux -o pipefail
+if ! timeout 30s bash -c "until command -v mount.nfs || [ -x /sbin/mount.nfs ] || [ -x /usr/sbin/mount.nfs ]; do sleep 3; done"; then
+	echo >&2 "mount.nfs is not installed yet"
+	exit 1
+fi
+`,
+			debugHint: `The mount.nfs binary was not installed in the guest.
+Make sure that you are using an officially supported image.
+Also see "/var/log/cloud-init-output.log" in the guest.
+A possible workaround is to run "apt-get install nfs-common" in the guest.
+`,
+		})
+	}
 	return req
 }
 
@@ -208,15 +278,53 @@ fi
 				debugHint: `The nerdctl binary was not installed in the guest.
 Make sure that you are using an officially supported image.
 Also see "/var/log/cloud-init-output.log" in the guest.
+`,
+			})
+	}
+	if *a.instConfig.Podman.User && !*a.instConfig.Plain {
+		req = append(req,
+			requirement{
+				description: "systemd must be available for podman",
+				fatal:       true,
+				script: `#!/bin/bash
+set -eux -o pipefail
+if ! command -v systemctl 2>&1 >/dev/null; then
+    echo >&2 "systemd is not available on this OS"
+    exit 1
+fi
+`,
+				debugHint: `systemd is required to run the podman socket, but does not seem to be available.
+Make sure that you use an image that supports systemd. If you do not want to run
+podman, please make sure that 'podman.user' is set to 'false' in the config file.
+`,
+			},
+			requirement{
+				description: "podman socket to be available",
+				script: `#!/bin/bash
+set -eux -o pipefail
+sock="/run/user/$(id -u)/podman/podman.sock"
+if ! timeout 30s bash -c "until [ -S \"${sock}\" ]; do sleep 3; done"; then
+	echo >&2 "podman socket is not available yet"
+	exit 1
+fi
+`,
+				debugHint: `The podman socket was not enabled in the guest.
+Make sure that podman is available for the distribution of the image.
+Also see "/var/log/cloud-init-output.log" in the guest.
 `,
 			})
 	}
 	for _, probe := range a.instConfig.Probes {
 		if probe.Mode == limayaml.ProbeModeReadiness {
+			name := probe.Name
+			if name == "" {
+				name = probe.Description
+			}
 			req = append(req, requirement{
 				description: probe.Description,
 				script:      probe.Script,
 				debugHint:   probe.Hint,
+				probe:       name,
 			})
 		}
 	}
@@ -224,13 +332,14 @@ Also see "/var/log/cloud-init-output.log" in the guest.
 }
 
 func (a *HostAgent) finalRequirements() []requirement {
+	sudo, metaData := a.cidataFile("meta-data")
 	req := make([]requirement, 0)
 	req = append(req,
 		requirement{
 			description: "boot scripts must have finished",
 			script: `#!/bin/bash
 set -eux -o pipefail
-if ! timeout 30s bash -c "until sudo diff -q /run/lima-boot-done /mnt/lima-cidata/meta-data 2>/dev/null; do sleep 3; done"; then
+if ! timeout 30s bash -c "until ` + sudo + `diff -q /run/lima-boot-done ` + metaData + ` 2>/dev/null; do sleep 3; done"; then
 	echo >&2 "boot scripts have not finished"
 	exit 1
 fi
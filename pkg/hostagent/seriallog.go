@@ -0,0 +1,65 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/logrotate"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// serialLogRotateInterval is the interval of checking the sizes of the serial console logs.
+const serialLogRotateInterval = 10 * time.Second
+
+// rotateSerialLogs rotates the serial console logs that have grown larger than `serialLog.maxSize`,
+// retaining `serialLog.maxFiles` rotated logs for each of them.
+// The rotated logs of the previous run are removed, as the drivers recreate the logs on start.
+func (a *HostAgent) rotateSerialLogs(ctx context.Context) {
+	paths := make([]string, 0, len(filenames.SerialLogs()))
+	for _, name := range filenames.SerialLogs() {
+		path := filepath.Join(a.instDir, name)
+		if err := logrotate.RemoveRotated(path); err != nil {
+			logrus.WithError(err).Warnf("failed to remove the rotated logs of %q", path)
+		}
+		paths = append(paths, path)
+	}
+	maxSize, err := units.RAMInBytes(*a.instConfig.SerialLog.MaxSize)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to parse `serialLog.maxSize`")
+		return
+	}
+	if maxSize == 0 {
+		return
+	}
+	maxFiles := *a.instConfig.SerialLog.MaxFiles
+	ticker := time.NewTicker(serialLogRotateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, path := range paths {
+			st, err := os.Stat(path)
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					logrus.WithError(err).Debugf("failed to stat %q", path)
+				}
+				continue
+			}
+			if st.Size() < maxSize {
+				continue
+			}
+			logrus.Debugf("Rotating %q (%d bytes)", path, st.Size())
+			if err := logrotate.Rotate(path, maxFiles); err != nil {
+				logrus.WithError(err).Warnf("failed to rotate %q", path)
+			}
+		}
+	}
+}
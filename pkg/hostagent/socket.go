@@ -0,0 +1,106 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// socketForwarder forwards the listening UNIX sockets reported by the guest agent, according to `socketForwards`.
+type socketForwarder struct {
+	sshConfig   *ssh.SSHConfig
+	sshHostPort int
+	rules       []limayaml.SocketForward
+
+	mu sync.Mutex
+	// forwarded maps the guest sockets to the host sockets
+	forwarded map[string]string
+}
+
+func newSocketForwarder(sshConfig *ssh.SSHConfig, sshHostPort int, rules []limayaml.SocketForward) *socketForwarder {
+	return &socketForwarder{
+		sshConfig:   sshConfig,
+		sshHostPort: sshHostPort,
+		rules:       rules,
+		forwarded:   make(map[string]string),
+	}
+}
+
+// hostSocket returns the host socket of the first rule that matches the guest socket.
+func (sf *socketForwarder) hostSocket(guestSocket string) (string, bool) {
+	for _, rule := range sf.rules {
+		if host, ok := rule.HostSocket(guestSocket); ok {
+			return host, true
+		}
+	}
+	return "", false
+}
+
+func (sf *socketForwarder) OnEvent(ctx context.Context, ev *api.Event) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for _, guest := range ev.LocalSocketsRemoved {
+		sf.cancelLocked(ctx, guest)
+	}
+	for _, guest := range ev.LocalSocketsAdded {
+		sf.forwardLocked(ctx, guest)
+	}
+}
+
+func (sf *socketForwarder) forwardLocked(ctx context.Context, guest string) {
+	if _, ok := sf.forwarded[guest]; ok {
+		// Reported again on reconnecting to the guest agent
+		return
+	}
+	host, ok := sf.hostSocket(guest)
+	if !ok {
+		return
+	}
+	if len(host) >= osutil.UnixPathMax {
+		logrus.Warnf("Not forwarding %q (guest), as the host socket path %q exceeds %d characters", guest, host, osutil.UnixPathMax)
+		return
+	}
+	for otherGuest, otherHost := range sf.forwarded {
+		if otherHost == host {
+			logrus.Warnf("Not forwarding %q (guest), as %q (host) is already forwarded from %q (guest)", guest, host, otherGuest)
+			return
+		}
+	}
+	if err := forwardSSH(ctx, sf.sshConfig, sf.sshHostPort, host, guest, verbForward, false); err != nil {
+		logrus.WithError(err).Warnf("Failed to forward %q (guest) to %q (host)", guest, host)
+		return
+	}
+	sf.forwarded[guest] = host
+}
+
+func (sf *socketForwarder) cancelLocked(ctx context.Context, guest string) {
+	host, ok := sf.forwarded[guest]
+	if !ok {
+		return
+	}
+	delete(sf.forwarded, guest)
+	if err := forwardSSH(ctx, sf.sshConfig, sf.sshHostPort, host, guest, verbCancel, false); err != nil {
+		logrus.WithError(err).Warnf("Failed to stop forwarding %q (guest) to %q (host)", guest, host)
+	}
+}
+
+// close stops all the forwards.
+func (sf *socketForwarder) close() error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	var errs []error
+	for guest, host := range sf.forwarded {
+		// using ctx.Background() because ctx has already been cancelled
+		if err := forwardSSH(context.Background(), sf.sshConfig, sf.sshHostPort, host, guest, verbCancel, false); err != nil {
+			errs = append(errs, err)
+		}
+		delete(sf.forwarded, guest)
+	}
+	return errors.Join(errs...)
+}
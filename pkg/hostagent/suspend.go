@@ -0,0 +1,56 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/sirupsen/logrus"
+)
+
+// Suspend saves the state of the VM to the disk, and terminates the VM without shutting down the guest.
+// The host agent exits as the driver has stopped, and the next start of the instance restores the state.
+//
+// The tunnels and the ports of the DNS server are recorded in the metadata, so that they are restored too.
+// On failure, the VM keeps running, but the mounts are not mounted again until the instance is restarted.
+func (a *HostAgent) Suspend(ctx context.Context) error {
+	if caps, ok := limayaml.LookupDriverCapabilities(*a.instConfig.VMType); ok && !caps.Suspend {
+		return fmt.Errorf("vmType %s does not support suspending the instance", *a.instConfig.VMType)
+	}
+	if !a.suspending.CompareAndSwap(false, true) {
+		return errors.New("the instance is already being suspended")
+	}
+	if err := metadata.Update(a.instDir, func(m *metadata.Metadata) error {
+		m.Suspended = &metadata.Suspended{
+			Time:            time.Now(),
+			Tunnels:         m.Tunnels,
+			UDPDNSLocalPort: a.udpDNSLocalPort,
+			TCPDNSLocalPort: a.tcpDNSLocalPort,
+		}
+		return nil
+	}); err != nil {
+		a.suspending.Store(false)
+		return err
+	}
+	// The mounts served by the host agent are unmounted before saving the state, as their connections
+	// do not survive the suspension. They are mounted again by the host agent on resuming.
+	if err := a.closeMounts(); err != nil {
+		logrus.WithError(err).Warn("Failed to unmount the mounts before suspending")
+	}
+	if err := a.driver.SaveState(ctx, store.SuspendStatePath(a.instDir, a.instConfig)); err != nil {
+		if mdErr := metadata.Update(a.instDir, func(m *metadata.Metadata) error {
+			m.Suspended = nil
+			return nil
+		}); mdErr != nil {
+			logrus.WithError(mdErr).Warn("Failed to clear the suspension from the metadata")
+		}
+		a.suspending.Store(false)
+		return err
+	}
+	logrus.Info("Suspended the instance")
+	return nil
+}
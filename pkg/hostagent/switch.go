@@ -0,0 +1,40 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/identifierutil"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/networks/usernet"
+	"github.com/sirupsen/logrus"
+)
+
+// registerSwitchHosts adds "lima-<NAME>.<NETWORK>.internal" to the DNS servers of the "switch" networks,
+// with the address leased to the instance, so that the other instances on the networks can resolve it.
+func (a *HostAgent) registerSwitchHosts(ctx context.Context) error {
+	var errs []error
+	for _, nw := range a.instConfig.Networks {
+		if nw.Lima == "" || !networks.IsSwitch(nw.Lima) {
+			continue
+		}
+		client := usernet.NewClientByName(nw.Lima)
+		if client == nil {
+			errs = append(errs, fmt.Errorf("failed to connect to network %q", nw.Lima))
+			continue
+		}
+		ipAddress, err := client.ResolveIPAddress(ctx, nw.MACAddress)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to resolve the address on network %q: %w", nw.Lima, err))
+			continue
+		}
+		name := identifierutil.HostnameFromInstName(a.instName) + "." + networks.SwitchDomain(nw.Lima)
+		if err := client.AddDNSHost(name, ipAddress); err != nil {
+			errs = append(errs, fmt.Errorf("failed to register %q on network %q: %w", name, nw.Lima, err))
+			continue
+		}
+		logrus.Infof("Registered %q (%s) on network %q", name, ipAddress, nw.Lima)
+	}
+	return errors.Join(errs...)
+}
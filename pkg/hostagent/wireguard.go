@@ -0,0 +1,42 @@
+package hostagent
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/store"
+)
+
+// wireGuardPortForwards returns the rules that forward the UDP ports of the "wireguard" networks
+// from all the addresses of the host, so that the peers on this host and on the other hosts can reach the guest.
+func wireGuardPortForwards(inst *store.Instance) ([]limayaml.PortForward, error) {
+	var rules []limayaml.PortForward
+	for _, nw := range inst.Config.Networks {
+		if nw.Lima == "" || !networks.IsWireGuard(nw.Lima) {
+			continue
+		}
+		nwCfg, err := networks.LoadConfig()
+		if err != nil {
+			return nil, err
+		}
+		ip, err := netip.ParseAddr(nw.StaticIP)
+		if err != nil {
+			return nil, err
+		}
+		port, err := nwCfg.WireGuardPort(nw.Lima, ip)
+		if err != nil {
+			return nil, err
+		}
+		rule := limayaml.PortForward{
+			GuestIP:   net.IPv4zero,
+			GuestPort: port,
+			HostIP:    net.IPv4zero,
+			Proto:     limayaml.ProtoUDP,
+		}
+		limayaml.FillPortForwardDefaults(&rule, inst.Dir, inst.Config.User, inst.Param)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
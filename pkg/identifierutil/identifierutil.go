@@ -1,9 +1,57 @@
 package identifierutil
 
-import "strings"
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"strings"
+	"text/template"
+)
 
 func HostnameFromInstName(instName string) string {
 	s := strings.ReplaceAll(instName, ".", "-")
 	s = strings.ReplaceAll(s, "_", "-")
 	return "lima-" + s
 }
+
+var regexInvalidNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// NameFromUsername converts a host username into a string that can be used as
+// (a part of) an instance name, e.g., "DOMAIN\John.Doe" becomes "john.doe".
+func NameFromUsername(username string) string {
+	if i := strings.LastIndex(username, `\`); i >= 0 {
+		username = username[i+1:]
+	}
+	s := regexInvalidNameChars.ReplaceAllString(strings.ToLower(username), "-")
+	s = strings.Trim(s, "._-")
+	if s == "" {
+		return "user"
+	}
+	return s
+}
+
+// ExpandHostUser executes s as a Go template with `{{.HostUser}}` set to
+// NameFromUsername of the current host user.
+//
+// Strings without "{{" are returned as-is.
+func ExpandHostUser(s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %q: %w", s, err)
+	}
+	data := map[string]string{
+		"HostUser": NameFromUsername(u.Username),
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to expand %q: %w", s, err)
+	}
+	return b.String(), nil
+}
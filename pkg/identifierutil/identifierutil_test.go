@@ -11,3 +11,10 @@ func TestHostnameFromInstName(t *testing.T) {
 	assert.Equal(t, "lima-ubuntu-24-04", HostnameFromInstName("ubuntu-24.04"))
 	assert.Equal(t, "lima-foo-bar-baz", HostnameFromInstName("foo_bar.baz"))
 }
+
+func TestNameFromUsername(t *testing.T) {
+	assert.Equal(t, "alice", NameFromUsername("alice"))
+	assert.Equal(t, "john.doe", NameFromUsername(`CORP\John.Doe`))
+	assert.Equal(t, "foo-bar", NameFromUsername("foo bar"))
+	assert.Equal(t, "user", NameFromUsername("$$$"))
+}
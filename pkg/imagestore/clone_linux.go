@@ -0,0 +1,29 @@
+package imagestore
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dst as a copy-on-write clone of src, with the FICLONE ioctl (reflink) of Btrfs, XFS, etc.
+func cloneFile(src, dst string) error {
+	srcF, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcF.Close()
+	st, err := srcF.Stat()
+	if err != nil {
+		return err
+	}
+	dstF, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlFileClone(int(dstF.Fd()), int(srcF.Fd())); err != nil {
+		dstF.Close()
+		return err
+	}
+	return dstF.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux
+
+package imagestore
+
+import "errors"
+
+func cloneFile(_, _ string) error {
+	return errors.ErrUnsupported
+}
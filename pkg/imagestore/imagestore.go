@@ -0,0 +1,159 @@
+// Package imagestore is the content-addressed store of the base disk images, $LIMA_HOME/_images.
+//
+// The base disk of an instance is hard-linked (or cloned, on the filesystems that support
+// copy-on-write) from the store, so that the instances created from the same image share
+// a single read-only copy of it, and the qcow2 diff disks of QEMU are backed by the shared copy.
+package imagestore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// Enabled returns true unless $LIMA_IMAGE_STORE is false.
+func Enabled() bool {
+	if s := os.Getenv("LIMA_IMAGE_STORE"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			logrus.WithError(err).Warnf("invalid LIMA_IMAGE_STORE value %q", s)
+			return true
+		}
+		return b
+	}
+	return true
+}
+
+// Image is an image in the store.
+type Image struct {
+	Digest digest.Digest
+	Path   string
+	Size   int64
+	// Links is the number of the hard links to the image, including the store itself.
+	// 0 when the number is unknown (Windows).
+	// Note that the cloned base disks are not counted, as they do not depend on the image in the store.
+	Links uint64
+}
+
+// Path returns the path of the image in the store dir.
+func Path(dir string, dgst digest.Digest) string {
+	return filepath.Join(dir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// Dedup replaces the base disk with a hard link (or a clone) of the same image in the store.
+// When the store does not have the image yet, the base disk is added to the store.
+// The base disk is left as is when neither hard links nor clones are supported, e.g., across filesystems.
+func Dedup(baseDisk string) error {
+	dir, err := dirnames.LimaImagesDir()
+	if err != nil {
+		return err
+	}
+	return dedup(dir, baseDisk)
+}
+
+func dedup(dir, baseDisk string) error {
+	f, err := os.Open(baseDisk)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("Computing the digest of %q", baseDisk)
+	dgst, err := digest.SHA256.FromReader(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to compute the digest of %q: %w", baseDisk, err)
+	}
+	p := Path(dir, dgst)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return lockutil.WithDirLock(dir, func() error {
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			if err := linkOrClone(baseDisk, p); err != nil {
+				logrus.WithError(err).Debugf("Not adding %q to the image store", baseDisk)
+				return nil
+			}
+			logrus.Infof("Added the base disk to the image store as %q", p)
+			return makeReadOnly(p)
+		} else if err != nil {
+			return err
+		}
+		tmp := baseDisk + ".imagestore.tmp"
+		if err := linkOrClone(p, tmp); err != nil {
+			logrus.WithError(err).Debugf("Not sharing %q with the image store", baseDisk)
+			return nil
+		}
+		if err := os.Rename(tmp, baseDisk); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+		logrus.Infof("Sharing the base disk with the image store (%q)", p)
+		return nil
+	})
+}
+
+// linkOrClone creates dst as a hard link of src, or as a clone of src when hard links are not supported.
+func linkOrClone(src, dst string) error {
+	linkErr := os.Link(src, dst)
+	if linkErr == nil {
+		return nil
+	}
+	if cloneErr := cloneFile(src, dst); cloneErr != nil {
+		_ = os.Remove(dst)
+		return errors.Join(linkErr, cloneErr)
+	}
+	return nil
+}
+
+// makeReadOnly removes the write permission of the image, so that the instances sharing it cannot modify it.
+// The permission is kept on Windows, where read-only files cannot be removed with os.RemoveAll.
+func makeReadOnly(p string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return os.Chmod(p, 0o444)
+}
+
+// List returns the images in the store.
+func List() ([]Image, error) {
+	dir, err := dirnames.LimaImagesDir()
+	if err != nil {
+		return nil, err
+	}
+	return list(dir)
+}
+
+func list(dir string) ([]Image, error) {
+	var images []Image
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		dgst := digest.NewDigestFromEncoded(digest.Algorithm(filepath.Base(filepath.Dir(path))), d.Name())
+		if dgst.Validate() != nil {
+			// e.g., the lock file
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		images = append(images, Image{Digest: dgst, Path: path, Size: info.Size(), Links: linkCount(info)})
+		return nil
+	})
+	return images, err
+}
@@ -0,0 +1,55 @@
+package imagestore
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/v3/assert"
+)
+
+func TestDedup(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "_images")
+	content := []byte("base disk image")
+	dgst := digest.SHA256.FromBytes(content)
+
+	var baseDisks []string
+	for _, inst := range []string{"foo", "bar"} {
+		instDir := filepath.Join(t.TempDir(), inst)
+		assert.NilError(t, os.MkdirAll(instDir, 0o755))
+		baseDisk := filepath.Join(instDir, "basedisk")
+		assert.NilError(t, os.WriteFile(baseDisk, content, 0o644))
+		assert.NilError(t, dedup(dir, baseDisk))
+		baseDisks = append(baseDisks, baseDisk)
+	}
+
+	p := Path(dir, dgst)
+	stored, err := os.Stat(p)
+	assert.NilError(t, err)
+	for _, baseDisk := range baseDisks {
+		st, err := os.Stat(baseDisk)
+		assert.NilError(t, err)
+		assert.Assert(t, os.SameFile(stored, st), "%q is not shared with %q", baseDisk, p)
+		b, err := os.ReadFile(baseDisk)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, b, content)
+	}
+
+	images, err := list(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(images), 1)
+	assert.Equal(t, images[0].Digest, dgst)
+	assert.Equal(t, images[0].Size, int64(len(content)))
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, images[0].Links, uint64(3))
+		assert.Equal(t, stored.Mode().Perm(), os.FileMode(0o444))
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	images, err := list(filepath.Join(t.TempDir(), "nonexistent"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(images), 0)
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package imagestore
+
+import (
+	"os"
+	"syscall"
+)
+
+func linkCount(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink) //nolint:unconvert // Nlink is uint16 on darwin
+	}
+	return 0
+}
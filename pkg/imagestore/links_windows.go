@@ -0,0 +1,7 @@
+package imagestore
+
+import "os"
+
+func linkCount(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,111 @@
+package infoutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrFieldNotFound is returned by Field when the path does not exist in the value.
+var ErrFieldNotFound = errors.New("field not found")
+
+// fieldSegment is a key of an object, or an index of an array.
+type fieldSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseFieldPath parses a dot-separated path with optional array indexes, e.g., "config.mounts[0].location".
+// The leading dot is optional, as in jq.
+func parseFieldPath(path string) ([]fieldSegment, error) {
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil, nil
+	}
+	var res []fieldSegment
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if rest != "" {
+			rest = "[" + rest
+		}
+		if key == "" && (rest == "" || len(res) > 0) {
+			return nil, fmt.Errorf("invalid field path %q: empty key", path)
+		}
+		if key != "" {
+			res = append(res, fieldSegment{key: key})
+		}
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if !strings.HasPrefix(rest, "[") || end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: malformed index in %q", path, part)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid field path %q: index must be a non-negative integer, got %q", path, rest[1:end])
+			}
+			res = append(res, fieldSegment{index: index, isIndex: true})
+			rest = rest[end+1:]
+		}
+	}
+	return res, nil
+}
+
+// Field returns the value at the path in the JSON representation of v,
+// e.g., "ssh.localPort", "mounts[0].location".
+// The value is one of the types decoded by encoding/json, with numbers decoded as json.Number.
+func Field(v any, path string) (any, error) {
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// Preserve large integers such as the memory size in bytes
+	dec.UseNumber()
+	var cur any
+	if err := dec.Decode(&cur); err != nil {
+		return nil, err
+	}
+	for _, seg := range segments {
+		var found bool
+		if seg.isIndex {
+			if arr, ok := cur.([]any); ok && seg.index < len(arr) {
+				cur, found = arr[seg.index], true
+			}
+		} else if obj, ok := cur.(map[string]any); ok {
+			cur, found = obj[seg.key]
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %q", ErrFieldNotFound, path)
+		}
+	}
+	return cur, nil
+}
+
+// FormatField formats the value returned by Field for the shell scripts.
+// Strings are printed without quotes, and objects and arrays are printed as JSON.
+func FormatField(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		b, err := json.MarshalIndent(v, "", "    ")
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
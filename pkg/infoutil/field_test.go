@@ -0,0 +1,69 @@
+package infoutil
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestField(t *testing.T) {
+	type mount struct {
+		Location string `json:"location"`
+		Writable *bool  `json:"writable"`
+	}
+	v := struct {
+		Name    string            `json:"name"`
+		Memory  int64             `json:"memory"`
+		Mounts  []mount           `json:"mounts"`
+		Matrix  [][]int           `json:"matrix"`
+		Labels  map[string]string `json:"labels"`
+		Enabled bool              `json:"enabled"`
+	}{
+		Name:    "default",
+		Memory:  4 << 30,
+		Mounts:  []mount{{Location: "~"}, {Location: "/tmp/lima"}},
+		Matrix:  [][]int{{1, 2}, {3, 4}},
+		Labels:  map[string]string{"foo": "bar"},
+		Enabled: true,
+	}
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"name", "default"},
+		{".name", "default"},
+		{"memory", "4294967296"},
+		{"mounts[1].location", "/tmp/lima"},
+		{"mounts[0].writable", "null"},
+		{"matrix[1][0]", "3"},
+		{"labels.foo", "bar"},
+		{"enabled", "true"},
+		{"matrix[0]", "[\n    1,\n    2\n]"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			got, err := Field(v, tc.path)
+			assert.NilError(t, err)
+			s, err := FormatField(got)
+			assert.NilError(t, err)
+			assert.Equal(t, s, tc.expected)
+		})
+	}
+
+	whole, err := Field(v, "")
+	assert.NilError(t, err)
+	assert.Equal(t, whole.(map[string]any)["name"], "default")
+	assert.Equal(t, whole.(map[string]any)["memory"], json.Number("4294967296"))
+
+	for _, path := range []string{"nonexistent", "mounts[2]", "name.foo", "labels[0]", "mounts.location"} {
+		_, err := Field(v, path)
+		assert.ErrorIs(t, err, ErrFieldNotFound, path)
+	}
+
+	for _, path := range []string{"mounts..location", "mounts[x]", "mounts[-1]", "mounts[0", "mounts[0]x", "mounts.[0]"} {
+		_, err := Field(v, path)
+		assert.ErrorContains(t, err, "invalid field path", path)
+	}
+}
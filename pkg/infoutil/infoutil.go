@@ -1,6 +1,8 @@
 package infoutil
 
 import (
+	"encoding/json"
+
 	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
@@ -14,6 +16,10 @@ type Info struct {
 	DefaultTemplate *limayaml.LimaYAML       `json:"defaultTemplate"`
 	LimaHome        string                   `json:"limaHome"`
 	VMTypes         []string                 `json:"vmTypes"` // since Lima v0.14.2
+	// DriverCapabilities maps the available vmTypes to their capability manifests.
+	DriverCapabilities map[string]limayaml.DriverCapabilities `json:"driverCapabilities"`
+	// Plugins maps plugin names to the sections contributed by `limactl-NAME lima-plugin-info`.
+	Plugins map[string]json.RawMessage `json:"plugins,omitempty"`
 }
 
 func GetInfo() (*Info, error) {
@@ -29,6 +35,8 @@ func GetInfo() (*Info, error) {
 		Version:         version.Version,
 		DefaultTemplate: y,
 		VMTypes:         driverutil.Drivers(),
+
+		DriverCapabilities: driverutil.Capabilities(),
 	}
 	info.Templates, err = templatestore.Templates()
 	if err != nil {
@@ -0,0 +1,234 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/lima-vm/lima/pkg/cidata"
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	hostagentapi "github.com/lima-vm/lima/pkg/hostagent/api"
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	"github.com/lima-vm/lima/pkg/imagestore"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/nativeimgutil"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/lima-vm/lima/pkg/yqutil"
+	"github.com/sirupsen/logrus"
+)
+
+// CloneOptions are the options of Clone.
+type CloneOptions struct {
+	// Quiesce freezes the filesystems of the running instance via the guest agent while its disk is snapshotted.
+	Quiesce bool
+}
+
+// clonedFiles are the files of the instance directory that are copied to the clone, except the disks.
+// The identifiers of the machine (e.g., vz-identifier) and the TPM state are not copied, so that they are
+// regenerated for the clone.
+var clonedFiles = []string{
+	filenames.LimaVersion,
+	filenames.Kernel,
+	filenames.KernelCmdline,
+	filenames.Initrd,
+	filenames.VzEfi,
+	filenames.QemuEfiCodeFD,
+}
+
+// Clone creates the instance newInstName as a copy of the stopped or running instance.
+// A running instance is cloned from a crash-consistent snapshot of its disk, taken by the host agent.
+//
+// The clone gets its own MAC addresses, as they are derived from the instance directory unless specified,
+// and its own SSH host keys and machine ID, as they are regenerated by the guest on the first boot of the clone.
+// The additional disks are not cloned.
+func Clone(ctx context.Context, oldInst *store.Instance, newInstName string, opts CloneOptions) (*store.Instance, error) {
+	switch oldInst.Status {
+	case store.StatusStopped:
+		if opts.Quiesce {
+			logrus.Warnf("Ignoring --quiesce, as instance %q is not running", oldInst.Name)
+		}
+	case store.StatusRunning:
+		if caps, ok := limayaml.LookupDriverCapabilities(oldInst.VMType); ok && !caps.LiveClone {
+			return nil, fmt.Errorf("vmType %s does not support cloning the running instance (hint: stop the instance with `limactl stop %s`)", oldInst.VMType, oldInst.Name)
+		}
+	default:
+		return nil, fmt.Errorf("expected status %q or %q, got %q", store.StatusStopped, store.StatusRunning, oldInst.Status)
+	}
+	if oldInst.Config == nil {
+		return nil, errors.New("the configuration of the instance is not loaded")
+	}
+	if oldInst.VMType == limayaml.WSL2 {
+		return nil, errors.New("cloning WSL2 instances is not supported")
+	}
+	newInstDir, err := store.InstanceDir(newInstName)
+	if err != nil {
+		return nil, err
+	}
+	maxSockName := filepath.Join(newInstDir, filenames.LongestSock)
+	if len(maxSockName) >= osutil.UnixPathMax {
+		return nil, fmt.Errorf("instance name %q too long: %q must be less than UNIX_PATH_MAX=%d characters, but is %d",
+			newInstName, maxSockName, osutil.UnixPathMax, len(maxSockName))
+	}
+	if _, err := os.Stat(newInstDir); !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("instance %q already exists (%q)", newInstName, newInstDir)
+	}
+	logrus.Infof("Cloning instance %q (%s) as %q", oldInst.Name, oldInst.Status, newInstName)
+	if err := os.MkdirAll(newInstDir, 0o700); err != nil {
+		return nil, err
+	}
+	inst, err := cloneInstance(ctx, oldInst, newInstName, newInstDir, opts)
+	if err != nil {
+		if inst != nil {
+			if storageDir := store.StorageDir(newInstDir, inst.Config); storageDir != newInstDir {
+				_ = os.RemoveAll(storageDir)
+			}
+		}
+		if rmErr := os.RemoveAll(newInstDir); rmErr != nil {
+			logrus.WithError(rmErr).Warnf("Failed to remove %q", newInstDir)
+		}
+		return nil, err
+	}
+	return inst, nil
+}
+
+// cloneInstance copies the instance into newInstDir.
+// On failure, it may return the partially cloned instance along with the error, so that the caller can remove its storage directory.
+func cloneInstance(ctx context.Context, oldInst *store.Instance, newInstName, newInstDir string, opts CloneOptions) (*store.Instance, error) {
+	yBytes, err := os.ReadFile(filepath.Join(oldInst.Dir, filenames.LimaYAML))
+	if err != nil {
+		return nil, err
+	}
+	yBytes, err = cloneYAML(yBytes, oldInst)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(newInstDir, filenames.LimaYAML), yBytes, 0o644); err != nil {
+		return nil, err
+	}
+	for _, f := range clonedFiles {
+		src := filepath.Join(oldInst.Dir, f)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		// continuity attempts clonefile
+		if err := fs.CopyFile(filepath.Join(newInstDir, f), src); err != nil {
+			return nil, fmt.Errorf("failed to copy %q: %w", src, err)
+		}
+	}
+	// Only the version of Lima used to create the instance is inherited from the cloned instance
+	oldMeta, err := metadata.Read(oldInst.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := metadata.Update(newInstDir, func(m *metadata.Metadata) error {
+		m.LimaVersion = oldMeta.LimaVersion
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	history.Record(newInstDir, history.Entry{
+		Event:   history.EventClone,
+		Message: fmt.Sprintf("from %q (%s)", oldInst.Name, oldInst.Status),
+	})
+
+	inst, err := store.Inspect(newInstName)
+	if err != nil {
+		return nil, err
+	}
+	if inst.Config == nil {
+		return nil, errors.Join(inst.Errors...)
+	}
+	if err := ensureStorageDir(inst); err != nil {
+		return nil, err
+	}
+	if err := cloneDisks(ctx, oldInst, inst, opts); err != nil {
+		return inst, err
+	}
+
+	if err := cidata.GenerateCloudConfig(newInstDir, newInstName, inst.Config); err != nil {
+		return inst, err
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+	})
+	if err := limaDriver.Register(ctx); err != nil {
+		return inst, err
+	}
+	return inst, nil
+}
+
+// cloneYAML removes the fields of lima.yaml that cannot be shared with the cloned instance:
+// the additional disks, which are locked by the running instance, and the MAC addresses.
+func cloneYAML(yBytes []byte, oldInst *store.Instance) ([]byte, error) {
+	var y limayaml.LimaYAML
+	if err := limayaml.Unmarshal(yBytes, &y, filenames.LimaYAML); err != nil {
+		return nil, err
+	}
+	var exprs []string
+	if len(y.AdditionalDisks) > 0 {
+		logrus.Warnf("The additional disks of instance %q are not cloned, and removed from the clone", oldInst.Name)
+		exprs = append(exprs, "del(.additionalDisks)")
+	}
+	if slices.ContainsFunc(y.Networks, func(nw limayaml.Network) bool { return nw.MACAddress != "" }) {
+		logrus.Info("The MAC addresses of the networks are regenerated for the clone")
+		exprs = append(exprs, "del(.networks[].macAddress)")
+	}
+	return yqutil.EvaluateExpression(yqutil.Join(exprs), yBytes)
+}
+
+// cloneDisks copies the base disk and the diff disk into the storage directory of the clone.
+// The diff disk of a running instance is written by the host agent from a snapshot.
+func cloneDisks(ctx context.Context, oldInst, inst *store.Instance, opts CloneOptions) error {
+	oldStorageDir := store.StorageDir(oldInst.Dir, oldInst.Config)
+	storageDir := store.StorageDir(inst.Dir, inst.Config)
+
+	baseDisk := filepath.Join(storageDir, filenames.BaseDisk)
+	if _, err := os.Stat(filepath.Join(oldStorageDir, filenames.BaseDisk)); err == nil {
+		logrus.Infof("Copying %q", filenames.BaseDisk)
+		if err := fs.CopyFile(baseDisk, filepath.Join(oldStorageDir, filenames.BaseDisk)); err != nil {
+			return fmt.Errorf("failed to copy %q: %w", filenames.BaseDisk, err)
+		}
+		if imagestore.Enabled() {
+			if err := imagestore.Dedup(baseDisk); err != nil {
+				logrus.WithError(err).Warn("Failed to share the base disk with the image store")
+			}
+		}
+	}
+
+	oldDiffDisk := filepath.Join(oldStorageDir, filenames.DiffDisk)
+	diffDisk := filepath.Join(storageDir, filenames.DiffDisk)
+	if _, err := os.Stat(oldDiffDisk); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if oldInst.Status == store.StatusRunning {
+		haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(oldInst.Dir, filenames.HostAgentSock))
+		if err != nil {
+			return err
+		}
+		if opts.Quiesce {
+			logrus.Info("Snapshotting the disk of the running instance, with the filesystems of the guest frozen")
+		} else {
+			logrus.Info("Snapshotting the disk of the running instance (crash-consistent; specify --quiesce to freeze the filesystems of the guest)")
+		}
+		if err := haClient.SnapshotDisk(ctx, &hostagentapi.SnapshotDisk{Path: diffDisk, Quiesce: opts.Quiesce}); err != nil {
+			return fmt.Errorf("failed to snapshot the disk of instance %q: %w", oldInst.Name, err)
+		}
+	} else {
+		logrus.Infof("Copying %q", filenames.DiffDisk)
+		// continuity attempts clonefile
+		if err := fs.CopyFile(diffDisk, oldDiffDisk); err != nil {
+			return fmt.Errorf("failed to copy %q: %w", filenames.DiffDisk, err)
+		}
+	}
+	// The backing file of a qcow2 diffdisk is the absolute path of the basedisk of the cloned instance
+	return nativeimgutil.RelativizeBackingFile(diffDisk)
+}
@@ -0,0 +1,59 @@
+package instance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"gotest.tools/v3/assert"
+)
+
+func TestClone(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	t.Setenv("LIMA_IMAGE_STORE", "false")
+	instDir, err := store.InstanceDir("original")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(filepath.Join(instDir, filenames.SwtpmStateDir), 0o700))
+	limaYAML := `vmType: qemu
+images: [{location: /dev/null}]
+user: {name: lima, uid: 1000}
+additionalDisks: [data]
+networks:
+- socket: /nonexistent/socket_vmnet
+  macAddress: "52:55:55:12:34:56"
+`
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), []byte(limaYAML), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.SwtpmStateDir, "tpm2-00.permall"), []byte("tpm"), 0o600))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.VzIdentifier), []byte("id"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.BaseDisk), []byte("base"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), []byte("diff"), 0o644))
+
+	inst, err := store.Inspect("original")
+	assert.NilError(t, err)
+	assert.Equal(t, inst.Status, store.StatusStopped, "%v", inst.Errors)
+	cloned, err := Clone(context.Background(), inst, "cloned", CloneOptions{})
+	assert.NilError(t, err)
+	for f, expected := range map[string]string{filenames.BaseDisk: "base", filenames.DiffDisk: "diff"} {
+		b, err := os.ReadFile(filepath.Join(cloned.Dir, f))
+		assert.NilError(t, err)
+		assert.Equal(t, string(b), expected)
+	}
+	// the identifiers are regenerated
+	for _, f := range []string{filenames.VzIdentifier, filenames.SwtpmStateDir} {
+		_, err = os.Stat(filepath.Join(cloned.Dir, f))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+	assert.Equal(t, len(cloned.Config.AdditionalDisks), 0)
+	assert.Equal(t, len(cloned.Config.Networks), 1)
+	assert.Assert(t, cloned.Config.Networks[0].MACAddress != inst.Config.Networks[0].MACAddress)
+	entries, err := history.Read(cloned.Dir)
+	assert.NilError(t, err)
+	assert.Equal(t, entries[0].Event, history.EventClone)
+
+	_, err = Clone(context.Background(), inst, "cloned", CloneOptions{})
+	assert.ErrorContains(t, err, "already exists")
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/lima-vm/lima/pkg/version"
 )
 
@@ -55,6 +56,12 @@ func Create(ctx context.Context, instName string, instConfig []byte, saveBrokenY
 		}
 		return nil, fmt.Errorf("the YAML is invalid, saved the buffer as %q: %w", rejectedYAML, err)
 	}
+	if err := CheckRequirements(loadedInstConfig, filepath.Dir(instDir)); err != nil {
+		return nil, err
+	}
+	if err := createAdditionalDisks(loadedInstConfig); err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(instDir, 0o700); err != nil {
 		return nil, err
 	}
@@ -64,7 +71,10 @@ func Create(ctx context.Context, instName string, instConfig []byte, saveBrokenY
 	if err := cidata.GenerateCloudConfig(instDir, instName, loadedInstConfig); err != nil {
 		return nil, err
 	}
-	if err := os.WriteFile(filepath.Join(instDir, filenames.LimaVersion), []byte(version.Version), 0o444); err != nil {
+	if err := metadata.Update(instDir, func(m *metadata.Metadata) error {
+		m.LimaVersion = version.Version
+		return nil
+	}); err != nil {
 		return nil, err
 	}
 
@@ -8,7 +8,9 @@ import (
 
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/macaddress"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
 )
 
 func Delete(ctx context.Context, inst *store.Instance, force bool) error {
@@ -25,9 +27,17 @@ func Delete(ctx context.Context, inst *store.Instance, force bool) error {
 		return fmt.Errorf("failed to unregister %q: %w", inst.Dir, err)
 	}
 
+	if storageDir := store.StorageDir(inst.Dir, inst.Config); storageDir != inst.Dir {
+		if err := os.RemoveAll(storageDir); err != nil {
+			return fmt.Errorf("failed to remove %q: %w", storageDir, err)
+		}
+	}
 	if err := os.RemoveAll(inst.Dir); err != nil {
 		return fmt.Errorf("failed to remove %q: %w", inst.Dir, err)
 	}
+	if err := macaddress.Release(inst.Dir); err != nil {
+		logrus.WithError(err).Warnf("Failed to release the MAC addresses of %q", inst.Name)
+	}
 
 	return nil
 }
@@ -0,0 +1,57 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/qemu"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+// createAdditionalDisks creates the additional disks that have `createIfMissing: true` and do not exist yet,
+// as `limactl disk create` does. Existing disks are used as they are, even when the size or the format differs.
+func createAdditionalDisks(y *limayaml.LimaYAML) error {
+	for _, d := range y.AdditionalDisks {
+		if d.CreateIfMissing == nil || !*d.CreateIfMissing {
+			continue
+		}
+		diskDir, err := store.DiskDir(d.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(diskDir); !errors.Is(err, fs.ErrNotExist) {
+			if err != nil {
+				return err
+			}
+			logrus.Debugf("Using the existing disk %q", d.Name)
+			continue
+		}
+		if d.Size == nil {
+			return fmt.Errorf("the size of disk %q is not specified", d.Name)
+		}
+		size, err := units.RAMInBytes(*d.Size)
+		if err != nil {
+			return err
+		}
+		format := "qcow2"
+		if d.DiskFormat != nil {
+			format = *d.DiskFormat
+		}
+		logrus.Infof("Creating %s disk %q with size %s", format, d.Name, units.BytesSize(float64(size)))
+		if err := os.MkdirAll(diskDir, 0o700); err != nil {
+			return err
+		}
+		if err := qemu.CreateDataDisk(diskDir, format, int(size)); err != nil {
+			if rerr := os.RemoveAll(diskDir); rerr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to remove a directory %q: %w", diskDir, rerr))
+			}
+			return fmt.Errorf("failed to create %s disk in %q: %w", format, diskDir, err)
+		}
+	}
+	return nil
+}
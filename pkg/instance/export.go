@@ -0,0 +1,476 @@
+package instance
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/lima-vm/go-qcow2reader"
+	"github.com/lima-vm/go-qcow2reader/image/raw"
+	"github.com/lima-vm/lima/pkg/cidata"
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/nativeimgutil"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/lima-vm/lima/pkg/version"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportManifestVersion is the version of the manifest format of the exported archives.
+const ExportManifestVersion = 1
+
+// exportManifestName is the name of the manifest in the archive. The manifest is always the first entry.
+const exportManifestName = "manifest.json"
+
+// ExportManifest describes an exported instance.
+type ExportManifest struct {
+	Version int `json:"version"`
+	// Name is the name of the exported instance, used as the default name on import
+	Name string `json:"name"`
+	// LimaVersion is the version of Lima that exported the instance
+	LimaVersion string          `json:"limaVersion"`
+	VMType      limayaml.VMType `json:"vmType"`
+	Arch        limayaml.Arch   `json:"arch"`
+	Created     time.Time       `json:"created"`
+	// Files are the paths of the files in the archive, relative to the instance directory
+	Files []string `json:"files"`
+}
+
+// exportedFiles are the files of the instance directory that are exported.
+// The other files (cidata.iso, ssh.config, logs, sockets, etc.) are regenerated on start.
+var exportedFiles = []string{
+	filenames.LimaYAML,
+	filenames.Metadata,
+	filenames.LimaVersion,
+	filenames.History,
+	filenames.BaseDisk,
+	filenames.DiffDisk,
+	filenames.Kernel,
+	filenames.KernelCmdline,
+	filenames.Initrd,
+	filenames.VzIdentifier,
+	filenames.VzEfi,
+	filenames.QemuEfiCodeFD,
+	filenames.SwtpmStateDir,
+}
+
+// Export writes the stopped instance into the archive.
+// The archive is compressed with zstd or gzip, depending on the extension of the file name
+// (".tar.zst", ".tzst", ".tar.gz", ".tgz", or ".tar" for no compression).
+func Export(_ context.Context, inst *store.Instance, archivePath string) error {
+	if inst.Status != store.StatusStopped {
+		return fmt.Errorf("expected status %q, got %q (hint: stop the instance with `limactl stop %s`)", store.StatusStopped, inst.Status, inst.Name)
+	}
+	if inst.VMType == limayaml.WSL2 {
+		return errors.New("exporting WSL2 instances is not supported")
+	}
+	if len(inst.AdditionalDisks) > 0 {
+		logrus.Warnf("The additional disks of instance %q are not exported", inst.Name)
+	}
+	manifest := ExportManifest{
+		Version:     ExportManifestVersion,
+		Name:        inst.Name,
+		LimaVersion: version.Version,
+		VMType:      inst.VMType,
+		Arch:        inst.Arch,
+		Created:     time.Now().UTC(),
+	}
+	storageDir := store.StorageDir(inst.Dir, inst.Config)
+	var paths []string
+	for _, name := range exportedFiles {
+		dir := inst.Dir
+		if slices.Contains(storageFiles, name) {
+			dir = storageDir
+		}
+		err := filepath.WalkDir(filepath.Join(dir, name), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() && !d.IsDir() {
+				logrus.Debugf("Not exporting %q (type %s)", rel, d.Type())
+				return nil
+			}
+			paths = append(paths, path)
+			manifest.Files = append(manifest.Files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	tmp := archivePath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	cw, err := compressor(bw, archivePath)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: exportManifestName, Mode: 0o644, Size: int64(len(b)), ModTime: manifest.Created}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return err
+	}
+	for i, path := range paths {
+		logrus.Infof("Exporting %q", manifest.Files[i])
+		if err := addTarFile(tw, path, manifest.Files[i]); err != nil {
+			return fmt.Errorf("failed to export %q: %w", path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, archivePath)
+}
+
+func compressor(w io.Writer, archivePath string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(archivePath, ".tar.zst"), strings.HasSuffix(archivePath, ".tzst"):
+		return zstd.NewWriter(w)
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(archivePath, ".tar"):
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive name %q, must end with .tar.zst, .tzst, .tar.gz, .tgz, or .tar", archivePath)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func addTarFile(tw *tar.Writer, path, name string) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(st, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	// Do not leak the user and the group of the host
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if st.IsDir() {
+		hdr.Name += "/"
+		return tw.WriteHeader(hdr)
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import creates an instance from the archive written by Export.
+// The name of the instance defaults to the name in the manifest.
+// When the driver of the new instance cannot use the disk format of the exported instance
+// (e.g., a qcow2 disk of QEMU imported as a VZ instance), the disk is converted.
+func Import(ctx context.Context, archivePath, instName string) (*store.Instance, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	dr, err := decompressor(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", archivePath, err)
+	}
+	defer dr.Close()
+	tr := tar.NewReader(dr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", archivePath, err)
+	}
+	if hdr.Name != exportManifestName {
+		return nil, fmt.Errorf("%q is not an exported instance: expected %q as the first entry, got %q", archivePath, exportManifestName, hdr.Name)
+	}
+	var manifest ExportManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest of %q: %w", archivePath, err)
+	}
+	if manifest.Version != ExportManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d of %q, expected %d", manifest.Version, archivePath, ExportManifestVersion)
+	}
+	if instName == "" {
+		instName = manifest.Name
+	}
+	instDir, err := store.InstanceDir(instName)
+	if err != nil {
+		return nil, err
+	}
+	maxSockName := filepath.Join(instDir, filenames.LongestSock)
+	if len(maxSockName) >= osutil.UnixPathMax {
+		return nil, fmt.Errorf("instance name %q too long: %q must be less than UNIX_PATH_MAX=%d characters, but is %d",
+			instName, maxSockName, osutil.UnixPathMax, len(maxSockName))
+	}
+	if _, err := os.Stat(instDir); !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("instance %q already exists (%q)", instName, instDir)
+	}
+	logrus.Infof("Importing instance %q (exported by Lima %s, %s, %s) as %q", manifest.Name, manifest.LimaVersion, manifest.VMType, manifest.Arch, instName)
+	if err := os.MkdirAll(instDir, 0o700); err != nil {
+		return nil, err
+	}
+	inst, err := importInstance(ctx, tr, &manifest, instName, instDir)
+	if err != nil {
+		if rmErr := os.RemoveAll(instDir); rmErr != nil {
+			logrus.WithError(rmErr).Warnf("Failed to remove %q", instDir)
+		}
+		return nil, err
+	}
+	return inst, nil
+}
+
+// validateImportedBackingFile rejects the qcow2 disk whose backing file is not the base disk of the instance,
+// as the archive is untrusted, and the backing file of the disk is readable from the guest.
+// The backing file is either the absolute path of the base disk on the exporting host, or the relative name of it.
+func validateImportedBackingFile(diffDisk string) error {
+	backingFile, err := nativeimgutil.BackingFile(diffDisk)
+	if err != nil {
+		return err
+	}
+	if backingFile == "" || backingFile == filenames.BaseDisk ||
+		(filepath.IsAbs(backingFile) && filepath.Base(backingFile) == filenames.BaseDisk) {
+		return nil
+	}
+	return fmt.Errorf("the backing file %q of %q is not %q", backingFile, filenames.DiffDisk, filenames.BaseDisk)
+}
+
+func importInstance(ctx context.Context, tr *tar.Reader, manifest *ExportManifest, instName, instDir string) (*store.Instance, error) {
+	known := make(map[string]bool, len(manifest.Files))
+	for _, name := range manifest.Files {
+		known[strings.TrimSuffix(name, "/")] = true
+	}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if !known[name] {
+			return nil, fmt.Errorf("unexpected file %q, not listed in the manifest", hdr.Name)
+		}
+		dst, err := securejoin.SecureJoin(instDir, name)
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0o700); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			logrus.Infof("Importing %q", name)
+			if err := writeSparseFile(tr, dst, hdr.FileInfo().Mode().Perm()); err != nil {
+				return nil, fmt.Errorf("failed to import %q: %w", name, err)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected type %q of %q", hdr.Typeflag, hdr.Name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(instDir, filenames.LimaYAML)); err != nil {
+		return nil, fmt.Errorf("the archive does not contain %q: %w", filenames.LimaYAML, err)
+	}
+
+	// Only the version of Lima used to create the instance is inherited from the exported instance
+	if err := metadata.Update(instDir, func(m *metadata.Metadata) error {
+		*m = metadata.Metadata{Generation: m.Generation, LimaVersion: m.LimaVersion}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	history.Record(instDir, history.Entry{
+		Event:   history.EventImport,
+		Message: fmt.Sprintf("from %q exported by Lima %s", manifest.Name, manifest.LimaVersion),
+	})
+
+	diffDisk := filepath.Join(instDir, filenames.DiffDisk)
+	if _, err := os.Stat(diffDisk); err == nil {
+		if err := validateImportedBackingFile(diffDisk); err != nil {
+			return nil, err
+		}
+		// The backing file of a qcow2 disk is an absolute path in the directory of the exported instance
+		if err := nativeimgutil.RelativizeBackingFile(diffDisk); err != nil {
+			return nil, err
+		}
+	}
+
+	inst, err := store.Inspect(instName)
+	if err != nil {
+		return nil, err
+	}
+	if inst.Config == nil {
+		return nil, errors.Join(inst.Errors...)
+	}
+	if store.StorageDir(instDir, inst.Config) != instDir {
+		// `storage.dir` of the exported instance (or the default of this host) is not used,
+		// as the disk images have been imported into the instance directory
+		if err := updateYAML(inst, `.storage.dir = ""`); err != nil {
+			return nil, err
+		}
+		logrus.Infof("The disk images were imported into %q; run `limactl storage move %s DIR` to relocate them", instDir, instName)
+		if inst, err = store.Inspect(instName); err != nil {
+			return nil, err
+		}
+	}
+	if inst.VMType == limayaml.VZ && inst.VMType != manifest.VMType {
+		if err := ensureRawDisk(diffDisk); err != nil {
+			return nil, err
+		}
+	}
+	if err := cidata.GenerateCloudConfig(instDir, instName, inst.Config); err != nil {
+		return nil, err
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+	})
+	if err := limaDriver.Register(ctx); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+// ensureRawDisk converts the disk into the raw format, as the VZ driver cannot use qcow2 disks.
+func ensureRawDisk(disk string) error {
+	f, err := os.Open(disk)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	img, err := qcow2reader.Open(f)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to detect the format of %q: %w", disk, err)
+	}
+	t := img.Type()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if t == raw.Type {
+		return nil
+	}
+	return nativeimgutil.ConvertToRaw(disk, disk, nil, true)
+}
+
+func decompressor(br *bufio.Reader) (io.ReadCloser, error) {
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case bytes.Equal(magic[:2], []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	}
+	return io.NopCloser(br), nil
+}
+
+// sparseBlockSize is the size of the blocks that are checked for zeros in writeSparseFile.
+const sparseBlockSize = 64 * 1024
+
+// writeSparseFile writes r into dst, leaving holes for the blocks filled with zeros,
+// so that the sparse disk images do not occupy the full size on the host.
+func writeSparseFile(r io.Reader, dst string, perm os.FileMode) error {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := make([]byte, sparseBlockSize)
+	var size int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if isZero(buf[:n]) {
+				if _, err := f.Seek(int64(n), io.SeekCurrent); err != nil {
+					return err
+				}
+			} else if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
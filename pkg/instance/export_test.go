@@ -0,0 +1,105 @@
+package instance
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/nativeimgutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir, err := store.InstanceDir("exported")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(filepath.Join(instDir, filenames.SwtpmStateDir), 0o700))
+	limaYAML := []byte("vmType: qemu\nimages: [{location: /dev/null}]\nuser: {name: lima, uid: 1000}\n")
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), limaYAML, 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.SwtpmStateDir, "tpm2-00.permall"), []byte("tpm"), 0o600))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.SerialLog), []byte("not exported"), 0o644))
+	disk := bytes.Repeat([]byte{0}, 4*sparseBlockSize)
+	copy(disk[sparseBlockSize+42:], "data")
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), disk, 0o644))
+
+	inst, err := store.Inspect("exported")
+	assert.NilError(t, err)
+	for _, archive := range []string{"exported.tar.zst", "exported.tgz", "exported.tar"} {
+		t.Run(archive, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), archive)
+			assert.NilError(t, Export(context.Background(), inst, archivePath))
+
+			imported, err := Import(context.Background(), archivePath, "imported")
+			assert.NilError(t, err)
+			defer os.RemoveAll(imported.Dir)
+			b, err := os.ReadFile(filepath.Join(imported.Dir, filenames.LimaYAML))
+			assert.NilError(t, err)
+			assert.DeepEqual(t, b, limaYAML)
+			b, err = os.ReadFile(filepath.Join(imported.Dir, filenames.DiffDisk))
+			assert.NilError(t, err)
+			assert.DeepEqual(t, b, disk)
+			b, err = os.ReadFile(filepath.Join(imported.Dir, filenames.SwtpmStateDir, "tpm2-00.permall"))
+			assert.NilError(t, err)
+			assert.Equal(t, string(b), "tpm")
+			_, err = os.Stat(filepath.Join(imported.Dir, filenames.SerialLog))
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			_, err = Import(context.Background(), archivePath, "imported")
+			assert.ErrorContains(t, err, "already exists")
+		})
+	}
+
+	assert.ErrorContains(t, Export(context.Background(), inst, filepath.Join(t.TempDir(), "exported.zip")), "unsupported archive name")
+}
+
+func TestImportBackingFile(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir, err := store.InstanceDir("exported")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(instDir, 0o700))
+	limaYAML := []byte("vmType: qemu\nimages: [{location: /dev/null}]\nuser: {name: lima, uid: 1000}\n")
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), limaYAML, 0o644))
+
+	for _, tc := range []struct {
+		backingFile string
+		expected    string // the error, or the backing file of the imported disk
+	}{
+		{filepath.Join(instDir, filenames.BaseDisk), filenames.BaseDisk},
+		{filenames.BaseDisk, filenames.BaseDisk},
+		{"../../../../Users/foo/secret.img", "is not \"basedisk\""},
+		{"/Users/foo/secret.img", "is not \"basedisk\""},
+	} {
+		t.Run(tc.backingFile, func(t *testing.T) {
+			// qcow2 v2 header with the backing file name, without the tables
+			hdr := make([]byte, 72)
+			copy(hdr, "QFI\xfb")
+			binary.BigEndian.PutUint32(hdr[4:8], 2)
+			binary.BigEndian.PutUint64(hdr[8:16], uint64(len(hdr)))
+			binary.BigEndian.PutUint32(hdr[16:20], uint32(len(tc.backingFile)))
+			binary.BigEndian.PutUint32(hdr[20:24], 16)
+			assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), append(hdr, tc.backingFile...), 0o644))
+			inst, err := store.Inspect("exported")
+			assert.NilError(t, err)
+			archivePath := filepath.Join(t.TempDir(), "exported.tar")
+			assert.NilError(t, Export(context.Background(), inst, archivePath))
+
+			imported, err := Import(context.Background(), archivePath, "imported")
+			if tc.expected != filenames.BaseDisk {
+				assert.ErrorContains(t, err, tc.expected)
+				_, err = store.Inspect("imported")
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				return
+			}
+			assert.NilError(t, err)
+			defer os.RemoveAll(imported.Dir)
+			backingFile, err := nativeimgutil.BackingFile(filepath.Join(imported.Dir, filenames.DiffDisk))
+			assert.NilError(t, err)
+			assert.Equal(t, backingFile, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package instance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/store"
+)
+
+// hostCPUTime returns the CPU time consumed on the host by the processes of the instance,
+// i.e., the VM process and the host agent (which is the same process for VZ).
+func hostCPUTime(inst *store.Instance) (time.Duration, error) {
+	pids := []int{inst.DriverPID}
+	if inst.HostAgentPID != inst.DriverPID {
+		pids = append(pids, inst.HostAgentPID)
+	}
+	var total time.Duration
+	for _, pid := range pids {
+		if pid <= 0 {
+			continue
+		}
+		d, err := processCPUTime(pid)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the CPU time of process %d: %w", pid, err)
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// parsePsCPUTime parses the cputime of `ps`, in the format of "[[dd-]hh:]mm:ss[.cc]".
+func parsePsCPUTime(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var days int
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected cputime %q", s)
+		}
+		s = rest
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("unexpected cputime %q", s)
+	}
+	sec, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected cputime %q", s)
+	}
+	d := time.Duration(days)*24*time.Hour + time.Duration(sec*float64(time.Second))
+	for i, unit := range []time.Duration{time.Minute, time.Hour} {
+		if i >= len(parts)-1 {
+			break
+		}
+		n, err := strconv.Atoi(parts[len(parts)-2-i])
+		if err != nil {
+			return 0, fmt.Errorf("unexpected cputime %q", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
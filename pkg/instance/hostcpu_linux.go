@@ -0,0 +1,35 @@
+package instance
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userHZ is the unit of utime and stime in /proc/PID/stat.
+// It is 100 on all the architectures supported by Lima.
+const userHZ = 100
+
+func processCPUTime(pid int) (time.Duration, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	stat := string(b)
+	// the command may contain spaces and parentheses
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected stat: %q", stat)
+	}
+	var ticks uint64
+	for _, idx := range []int{11, 12} { // utime, stime
+		n, err := strconv.ParseUint(fields[idx], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * time.Second / userHZ, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+
+package instance
+
+import (
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+func processCPUTime(pid int) (time.Duration, error) {
+	out, err := exec.Command("ps", "-o", "cputime=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, err
+	}
+	return parsePsCPUTime(string(out))
+}
@@ -0,0 +1,63 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/iso9660util"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/nativeimgutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/yqutil"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportDisk writes the disk of the stopped instance into dst as a standalone image, without the backing file,
+// so that the image can be used as `images[].location` of other instances.
+//
+// The image is written in the qcow2 format with `qemu-img convert` when qemu-img is available,
+// and in the raw format otherwise.
+func ExportDisk(ctx context.Context, inst *store.Instance, dst string) error {
+	if inst.Status != store.StatusStopped {
+		return fmt.Errorf("expected status %q, got %q (hint: stop the instance with `limactl stop %s`)", store.StatusStopped, inst.Status, inst.Name)
+	}
+	if inst.VMType == limayaml.WSL2 {
+		return errors.New("exporting the disk of WSL2 instances is not supported")
+	}
+	storageDir := store.StorageDir(inst.Dir, inst.Config)
+	baseDisk := filepath.Join(storageDir, filenames.BaseDisk)
+	if isISO, err := iso9660util.IsISO9660(baseDisk); err == nil && isISO {
+		return fmt.Errorf("instance %q was booted from an ISO image, which cannot be exported as a disk image", inst.Name)
+	}
+	diffDisk := filepath.Join(storageDir, filenames.DiffDisk)
+	if _, err := os.Stat(diffDisk); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("qemu-img"); err == nil {
+		logrus.Infof("Converting %q to a qcow2 image %q", diffDisk, dst)
+		cmd := exec.CommandContext(ctx, "qemu-img", "convert", "-O", "qcow2", diffDisk, dst)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+		}
+		return nil
+	}
+	logrus.Warn("qemu-img is not installed; exporting the disk in the raw format, which may be as large as the disk size")
+	return nativeimgutil.ConvertToRaw(diffDisk, dst, nil, true)
+}
+
+// ImageTemplate returns lima.yaml of the instance, with `images` replaced with the image at location,
+// so that the template creates instances from the disk exported with ExportDisk.
+func ImageTemplate(inst *store.Instance, location string, dgst digest.Digest) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(inst.Dir, filenames.LimaYAML))
+	if err != nil {
+		return nil, err
+	}
+	expr := fmt.Sprintf(`.images = [{"location": %q, "arch": %q, "digest": %q}]`, location, *inst.Config.Arch, dgst)
+	return yqutil.EvaluateExpression(expr, b)
+}
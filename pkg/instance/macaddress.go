@@ -0,0 +1,56 @@
+package instance
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/macaddress"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// allocateMACAddresses allocates the MAC addresses of the network interfaces of the instance in the host-wide
+// allocation table, and updates inst.Config.Networks with the allocated addresses.
+// The addresses specified in `networks[].macAddress` are reserved in the table, and fail when they collide.
+//
+// The owners of the addresses are the same unique IDs as limayaml.MACAddress is called with,
+// so that the host agent and the drivers see the allocated addresses.
+func allocateMACAddresses(inst *store.Instance) error {
+	// The default (slirp) interface
+	if _, err := macaddress.Allocate(inst.Dir, macaddress.DefaultPool()); err != nil {
+		return err
+	}
+	var nwCfg *networks.Config
+	for i, nw := range inst.Config.Networks {
+		owner := fmt.Sprintf("%s#%d", filepath.Join(inst.Dir, filenames.LimaYAML), i)
+		// An address that differs from the derived one has been specified by the user
+		if nw.MACAddress != macaddress.Lookup(owner) {
+			if err := macaddress.Reserve(owner, nw.MACAddress); err != nil {
+				return fmt.Errorf("field `networks[%d].macAddress` of instance %q collides: %w", i, inst.Name, err)
+			}
+			continue
+		}
+		pool := macaddress.DefaultPool()
+		if nw.Lima != "" {
+			if nwCfg == nil {
+				cfg, err := networks.LoadConfig()
+				if err != nil {
+					return err
+				}
+				nwCfg = &cfg
+			}
+			var err error
+			pool, err = nwCfg.MACAddressPool(nw.Lima)
+			if err != nil {
+				return err
+			}
+		}
+		mac, err := macaddress.Allocate(owner, pool)
+		if err != nil {
+			return err
+		}
+		inst.Config.Networks[i].MACAddress = mac
+	}
+	return nil
+}
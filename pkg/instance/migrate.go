@@ -0,0 +1,261 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/cidata"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/lima-vm/lima/pkg/version"
+	"github.com/lima-vm/lima/pkg/version/versionutil"
+)
+
+const (
+	// LegacyMarkerFiles is "lima-version" and "protected", which are replaced with "metadata.json".
+	LegacyMarkerFiles = "marker-files"
+	// LegacyHostAgentPID is "ha.pid" of a stopped instance, which is replaced with "metadata.json".
+	LegacyHostAgentPID = "ha-pid"
+	// LegacyDefaults is an instance created with Lima prior to v1.0, which depends on the defaults of the old versions.
+	LegacyDefaults = "defaults"
+	// LegacyFields is the fields of lima.yaml that were removed.
+	LegacyFields = "fields"
+	// LegacyCIDataVariables is the `LIMA_CIDATA_*` variables referred by the scripts, which are no longer set.
+	LegacyCIDataVariables = "cidata-variables"
+)
+
+// LegacyLayout is a part of an instance directory in the layout of an older version of Lima.
+type LegacyLayout struct {
+	// Kind is one of LegacyMarkerFiles, LegacyHostAgentPID, LegacyDefaults, LegacyFields, and LegacyCIDataVariables.
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	// Manual is the instruction to migrate the layout by hand; empty when MigrateLayouts migrates the layout.
+	Manual string `json:"manual,omitempty"`
+
+	// files are backed up before migrate is called; relative to the instance directory
+	files   []string
+	migrate func(inst *store.Instance) error
+}
+
+// DetectLegacyLayouts detects the parts of the instance directory in the layouts of the older versions of Lima.
+func DetectLegacyLayouts(inst *store.Instance) ([]LegacyLayout, error) {
+	if inst.Config == nil {
+		return nil, errors.New("the configuration of the instance is not loaded")
+	}
+	var res []LegacyLayout
+
+	if _, err := os.Stat(filepath.Join(inst.Dir, filenames.Metadata)); errors.Is(err, os.ErrNotExist) {
+		var markers []string
+		for _, f := range []string{filenames.LimaVersion, filenames.Protected} {
+			if _, err := os.Lstat(filepath.Join(inst.Dir, f)); err == nil {
+				markers = append(markers, f)
+			}
+		}
+		if len(markers) > 0 {
+			res = append(res, LegacyLayout{
+				Kind:        LegacyMarkerFiles,
+				Description: fmt.Sprintf("%q are replaced with %q", markers, filenames.Metadata),
+				files:       markers,
+				migrate: func(inst *store.Instance) error {
+					// Update migrates the marker files, and removes them
+					return metadata.Update(inst.Dir, func(*metadata.Metadata) error { return nil })
+				},
+			})
+		}
+	}
+
+	if inst.Status == store.StatusStopped {
+		if _, err := os.Stat(filepath.Join(inst.Dir, filenames.HostAgentPID)); err == nil {
+			res = append(res, LegacyLayout{
+				Kind:        LegacyHostAgentPID,
+				Description: fmt.Sprintf("%q of the stopped instance is stale, and is replaced with %q", filenames.HostAgentPID, filenames.Metadata),
+				files:       []string{filenames.HostAgentPID},
+				migrate: func(inst *store.Instance) error {
+					return os.Remove(filepath.Join(inst.Dir, filenames.HostAgentPID))
+				},
+			})
+		}
+	}
+
+	yContent, err := os.ReadFile(filepath.Join(inst.Dir, filenames.LimaYAML))
+	if err != nil {
+		return nil, err
+	}
+	var y limayaml.LimaYAML
+	if err := limayaml.Unmarshal(yContent, &y, fmt.Sprintf("main file %q", filepath.Join(inst.Dir, filenames.LimaYAML))); err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(yContent, &raw); err != nil {
+		return nil, err
+	}
+
+	if l := detectLegacyDefaults(inst, &y); l != nil {
+		res = append(res, *l)
+	}
+
+	if _, ok := raw["useHostResolver"]; ok {
+		expr := `.hostResolver.enabled = .useHostResolver | del(.useHostResolver)`
+		if y.HostResolver.Enabled != nil {
+			expr = `del(.useHostResolver)`
+		}
+		res = append(res, LegacyLayout{
+			Kind:        LegacyFields,
+			Description: "field `useHostResolver` was removed in Lima v0.14.0, and is replaced with `hostResolver.enabled`",
+			files:       []string{filenames.LimaYAML},
+			migrate: func(inst *store.Instance) error {
+				return updateYAML(inst, expr)
+			},
+		})
+	}
+	if _, ok := raw["network"]; ok {
+		res = append(res, LegacyLayout{
+			Kind:        LegacyFields,
+			Description: "field `network` was removed in Lima v0.14.0",
+			Manual:      fmt.Sprintf("remove `network` and add the networks to `networks` with `limactl edit %s`; see https://lima-vm.io/docs/config/network/", inst.Name),
+		})
+	}
+
+	vars, err := legacyCIDataVariables(&y)
+	if err != nil {
+		return nil, err
+	}
+	if len(vars) > 0 {
+		res = append(res, LegacyLayout{
+			Kind:        LegacyCIDataVariables,
+			Description: fmt.Sprintf("the scripts refer to %v, which are no longer set", vars),
+			Manual:      fmt.Sprintf("update `provision` and `probes` with `limactl edit %s`", inst.Name),
+		})
+	}
+	return res, nil
+}
+
+// detectLegacyDefaults detects an instance created with Lima prior to v1.0, which depends on the defaults of
+// `mountType` and `user.name` of the old versions. The effective values are pinned in lima.yaml,
+// so that the instance does not depend on the version recorded in the metadata.
+func detectLegacyDefaults(inst *store.Instance, y *limayaml.LimaYAML) *LegacyLayout {
+	md, err := metadata.Read(inst.Dir)
+	if err != nil || versionutil.GreaterEqual(md.LimaVersion, "1.0.0") {
+		return nil
+	}
+	var exprs []string
+	if y.MountType == nil && inst.Config.MountType != nil && *inst.Config.MountType == limayaml.REVSSHFS &&
+		inst.Config.VMType != nil && *inst.Config.VMType == limayaml.QEMU {
+		exprs = append(exprs, fmt.Sprintf(".mountType = %q", limayaml.REVSSHFS))
+	}
+	if y.User.Name == nil && inst.Config.User.Name != nil && *inst.Config.User.Name != osutil.LimaUser(version.Version, false).Username {
+		exprs = append(exprs, fmt.Sprintf(".user.name = %q", *inst.Config.User.Name))
+	}
+	if len(exprs) == 0 {
+		return nil
+	}
+	createdWith := md.LimaVersion
+	if createdWith == "" {
+		createdWith = "prior to v0.20"
+	}
+	expr := strings.Join(exprs, " | ")
+	return &LegacyLayout{
+		Kind:        LegacyDefaults,
+		Description: fmt.Sprintf("the instance was created with Lima %s, and depends on the defaults of that version (%s)", createdWith, expr),
+		files:       []string{filenames.LimaYAML},
+		migrate: func(inst *store.Instance) error {
+			return updateYAML(inst, expr)
+		},
+	}
+}
+
+var cidataVariableRegexp = regexp.MustCompile(`\bLIMA_CIDATA_[A-Z0-9_]+`)
+
+// legacyCIDataVariables returns the `LIMA_CIDATA_*` variables referred by the provisioning scripts and the probes,
+// which are not set by this version of Lima.
+func legacyCIDataVariables(y *limayaml.LimaYAML) ([]string, error) {
+	var scripts []string
+	for _, p := range y.Provision {
+		scripts = append(scripts, p.Script)
+	}
+	for _, p := range y.Probes {
+		scripts = append(scripts, p.Script)
+	}
+	var vars []string
+	for _, script := range scripts {
+		for _, name := range cidataVariableRegexp.FindAllString(script, -1) {
+			ok, err := cidata.IsEnvName(name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok && !slices.Contains(vars, name) {
+				vars = append(vars, name)
+			}
+		}
+	}
+	slices.Sort(vars)
+	return vars, nil
+}
+
+// MigrateLayouts migrates the legacy layouts of the stopped instance that can be migrated automatically,
+// after backing up the files to be modified under a new subdirectory of "migrate-backup" in the instance directory.
+// The backup directory is returned, or an empty string if nothing was migrated.
+func MigrateLayouts(inst *store.Instance, layouts []LegacyLayout) (string, error) {
+	var auto []LegacyLayout
+	for _, l := range layouts {
+		if l.migrate != nil {
+			auto = append(auto, l)
+		}
+	}
+	if len(auto) == 0 {
+		return "", nil
+	}
+	if inst.Status != store.StatusStopped {
+		return "", fmt.Errorf("instance %q is not stopped (status %q); run `limactl stop %s` first", inst.Name, inst.Status, inst.Name)
+	}
+	backupDir := filepath.Join(inst.Dir, filenames.MigrateBackupDir, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(backupDir, 0o755); err != nil {
+		return "", err
+	}
+	for _, l := range auto {
+		for _, f := range l.files {
+			if err := backupFile(filepath.Join(inst.Dir, f), filepath.Join(backupDir, f)); err != nil {
+				return backupDir, fmt.Errorf("failed to back up %q: %w", f, err)
+			}
+		}
+	}
+	for _, l := range auto {
+		if err := l.migrate(inst); err != nil {
+			return backupDir, fmt.Errorf("failed to migrate %q (%s): %w", l.Kind, l.Description, err)
+		}
+	}
+	return backupDir, nil
+}
+
+// backupFile copies src to dst, unless dst already exists.
+func backupFile(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return errors.Join(err, out.Close())
+}
@@ -0,0 +1,73 @@
+package instance
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestMigrateLayouts(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir, err := store.InstanceDir("legacy")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(instDir, 0o700))
+	yContent := `vmType: qemu
+images: [{location: /dev/null}]
+user: {name: lima, uid: 1000}
+useHostResolver: false
+provision:
+- mode: system
+  script: echo $LIMA_CIDATA_USER $LIMA_CIDATA_FOO
+`
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), []byte(yContent), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), []byte("diff"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaVersion), []byte("0.19.0\n"), 0o444))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.Protected), nil, 0o444))
+
+	inst, err := store.Inspect("legacy")
+	assert.NilError(t, err)
+	layouts, err := DetectLegacyLayouts(inst)
+	assert.NilError(t, err)
+	var kinds []string
+	for _, l := range layouts {
+		kinds = append(kinds, l.Kind)
+	}
+	assert.DeepEqual(t, kinds, []string{LegacyMarkerFiles, LegacyDefaults, LegacyFields, LegacyCIDataVariables})
+	assert.Assert(t, layouts[0].Manual == "")
+	assert.Assert(t, strings.Contains(layouts[3].Description, "LIMA_CIDATA_FOO"), layouts[3].Description)
+	assert.Assert(t, !strings.Contains(layouts[3].Description, "LIMA_CIDATA_USER"), layouts[3].Description)
+	assert.Assert(t, layouts[3].Manual != "")
+
+	backupDir, err := MigrateLayouts(inst, layouts)
+	assert.NilError(t, err)
+	b, err := os.ReadFile(filepath.Join(backupDir, filenames.LimaVersion))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "0.19.0\n")
+	b, err = os.ReadFile(filepath.Join(backupDir, filenames.LimaYAML))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), yContent)
+	_, err = os.Stat(filepath.Join(instDir, filenames.LimaVersion))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(instDir, filenames.Metadata))
+	assert.NilError(t, err)
+
+	inst, err = store.Inspect("legacy")
+	assert.NilError(t, err)
+	assert.Assert(t, inst.Protected)
+	assert.Equal(t, *inst.Config.MountType, "reverse-sshfs")
+	assert.Equal(t, *inst.Config.HostResolver.Enabled, false)
+
+	// only the manual migration is left
+	layouts, err = DetectLegacyLayouts(inst)
+	assert.NilError(t, err)
+	assert.Equal(t, len(layouts), 1)
+	assert.Equal(t, layouts[0].Kind, LegacyCIDataVariables)
+	backupDir, err = MigrateLayouts(inst, layouts)
+	assert.NilError(t, err)
+	assert.Equal(t, backupDir, "")
+}
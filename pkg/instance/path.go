@@ -0,0 +1,142 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/localpathutil"
+	"github.com/lima-vm/lima/pkg/store"
+)
+
+// ErrNotMounted is returned by HostToGuestPath and GuestToHostPath when the path is not under any mount.
+var ErrNotMounted = errors.New("path is not under any mount")
+
+// mountPair is a mount with the host location and the guest mount point in the canonical form.
+type mountPair struct {
+	// location is the absolute path of the mount on the host, as configured.
+	location string
+	// resolvedLocation is location with the symbolic links resolved, e.g., "/private/tmp" for "/tmp" on macOS.
+	resolvedLocation string
+	// mountPoint is the absolute path of the mount in the guest.
+	mountPoint string
+}
+
+func mountPairs(inst *store.Instance) ([]mountPair, error) {
+	if inst.Config == nil {
+		return nil, fmt.Errorf("instance %q has no valid configuration", inst.Name)
+	}
+	var pairs []mountPair
+	for _, m := range inst.Config.Mounts {
+		location, err := localpathutil.Expand(m.Location)
+		if err != nil {
+			return nil, err
+		}
+		mountPoint := location
+		if m.MountPoint != nil {
+			mountPoint = *m.MountPoint
+		}
+		resolved, err := filepath.EvalSymlinks(location)
+		if err != nil {
+			resolved = location
+		}
+		pairs = append(pairs, mountPair{
+			location:         location,
+			resolvedLocation: resolved,
+			mountPoint:       path.Clean(filepath.ToSlash(mountPoint)),
+		})
+	}
+	return pairs, nil
+}
+
+// HostToGuestPath translates hostPath to the path of the same file in the guest, using the mounts of the instance.
+// The mount points that differ from the locations are honored, and the symbolic links on the host are resolved
+// when hostPath is not under a mount as it is.
+// When multiple mounts contain hostPath, the innermost mount is used.
+// ErrNotMounted is returned when hostPath is not under any mount.
+func HostToGuestPath(inst *store.Instance, hostPath string) (string, error) {
+	pairs, err := mountPairs(inst)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(hostPath)
+	if err != nil {
+		return "", err
+	}
+	if guestPath, ok := hostToGuest(pairs, abs, false); ok {
+		return guestPath, nil
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		if guestPath, ok := hostToGuest(pairs, resolved, true); ok {
+			return guestPath, nil
+		}
+	}
+	return "", fmt.Errorf("%w of instance %q: %q", ErrNotMounted, inst.Name, hostPath)
+}
+
+func hostToGuest(pairs []mountPair, hostPath string, resolved bool) (string, bool) {
+	var (
+		best    string
+		bestLen = -1
+	)
+	for _, p := range pairs {
+		location := p.location
+		if resolved {
+			location = p.resolvedLocation
+		}
+		rel, ok := relPath(location, hostPath, filepath.Separator)
+		if !ok || len(location) <= bestLen {
+			continue
+		}
+		best, bestLen = path.Join(p.mountPoint, filepath.ToSlash(rel)), len(location)
+	}
+	return best, bestLen >= 0
+}
+
+// GuestToHostPath translates guestPath to the path of the same file on the host, using the mounts of the instance.
+// guestPath has to be an absolute path, as the working directory of the guest is unknown to the host.
+// When multiple mounts contain guestPath, the innermost mount is used.
+// ErrNotMounted is returned when guestPath is not under any mount.
+func GuestToHostPath(inst *store.Instance, guestPath string) (string, error) {
+	if !path.IsAbs(guestPath) {
+		return "", fmt.Errorf("guest path %q must be an absolute path", guestPath)
+	}
+	pairs, err := mountPairs(inst)
+	if err != nil {
+		return "", err
+	}
+	guestPath = path.Clean(guestPath)
+	var (
+		best    string
+		bestLen = -1
+	)
+	for _, p := range pairs {
+		rel, ok := relPath(p.mountPoint, guestPath, '/')
+		if !ok || len(p.mountPoint) <= bestLen {
+			continue
+		}
+		best, bestLen = filepath.Join(p.location, filepath.FromSlash(rel)), len(p.mountPoint)
+	}
+	if bestLen < 0 {
+		return "", fmt.Errorf("%w of instance %q: %q", ErrNotMounted, inst.Name, guestPath)
+	}
+	return best, nil
+}
+
+// relPath returns p relative to base, when p is base or under base.
+// Both base and p have to be clean absolute paths separated with sep.
+func relPath(base, p string, sep byte) (string, bool) {
+	if p == base {
+		return ".", true
+	}
+	prefix := base
+	if !strings.HasSuffix(prefix, string(sep)) {
+		prefix += string(sep)
+	}
+	if !strings.HasPrefix(p, prefix) {
+		return "", false
+	}
+	return p[len(prefix):], true
+}
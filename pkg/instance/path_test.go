@@ -0,0 +1,69 @@
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"github.com/lima-vm/lima/pkg/store"
+	"gotest.tools/v3/assert"
+)
+
+func TestPathTranslation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the guest paths are not the same as the host paths on Windows")
+	}
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	work := filepath.Join(home, "work")
+	assert.NilError(t, os.MkdirAll(work, 0o755))
+	inst := &store.Instance{
+		Name: "test",
+		Config: &limayaml.LimaYAML{
+			Mounts: []limayaml.Mount{
+				{Location: home, MountPoint: ptr.Of(home)},
+				{Location: work, MountPoint: ptr.Of("/mnt/work")},
+			},
+		},
+	}
+
+	p, err := HostToGuestPath(inst, filepath.Join(home, "foo"))
+	assert.NilError(t, err)
+	assert.Equal(t, p, filepath.Join(home, "foo"))
+
+	// the innermost mount is used
+	p, err = HostToGuestPath(inst, filepath.Join(work, "src", "main.go"))
+	assert.NilError(t, err)
+	assert.Equal(t, p, "/mnt/work/src/main.go")
+	p, err = HostToGuestPath(inst, work)
+	assert.NilError(t, err)
+	assert.Equal(t, p, "/mnt/work")
+
+	// symbolic links are resolved
+	link := filepath.Join(dir, "link")
+	assert.NilError(t, os.Symlink(work, link))
+	p, err = HostToGuestPath(inst, filepath.Join(link, "."))
+	assert.NilError(t, err)
+	assert.Equal(t, p, "/mnt/work")
+
+	_, err = HostToGuestPath(inst, dir)
+	assert.Assert(t, errors.Is(err, ErrNotMounted))
+	_, err = HostToGuestPath(inst, home+"2")
+	assert.Assert(t, errors.Is(err, ErrNotMounted))
+
+	p, err = GuestToHostPath(inst, "/mnt/work/src/../main.go")
+	assert.NilError(t, err)
+	assert.Equal(t, p, filepath.Join(work, "main.go"))
+	p, err = GuestToHostPath(inst, filepath.Join(home, "foo"))
+	assert.NilError(t, err)
+	assert.Equal(t, p, filepath.Join(home, "foo"))
+
+	_, err = GuestToHostPath(inst, "/mnt")
+	assert.Assert(t, errors.Is(err, ErrNotMounted))
+	_, err = GuestToHostPath(inst, "relative")
+	assert.ErrorContains(t, err, "must be an absolute path")
+}
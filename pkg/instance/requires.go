@@ -0,0 +1,69 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"slices"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/fsutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/pbnjay/memory"
+	"github.com/sirupsen/logrus"
+)
+
+// CheckRequirements verifies that the host satisfies the `requires` field of the template.
+// dir is the directory on the filesystem that will hold the instance, for checking `requires.disk`.
+// All the unsatisfied requirements are returned together.
+func CheckRequirements(y *limayaml.LimaYAML, dir string) error {
+	r := y.Requires
+	var errs []error
+	if len(r.VMTypes) > 0 && !slices.Contains(r.VMTypes, *y.VMType) {
+		errs = append(errs, fmt.Errorf("the template requires vmType to be one of %v, got %q (hint: set `--vm-type`)", r.VMTypes, *y.VMType))
+	}
+	if r.Memory != nil {
+		want, err := units.RAMInBytes(*r.Memory)
+		if err != nil {
+			return err
+		}
+		if have := memory.TotalMemory(); have > 0 && have < uint64(want) {
+			errs = append(errs, fmt.Errorf("the template requires %s of the host memory, but the host has only %s",
+				units.BytesSize(float64(want)), units.BytesSize(float64(have))))
+		}
+	}
+	if r.Disk != nil {
+		want, err := units.RAMInBytes(*r.Disk)
+		if err != nil {
+			return err
+		}
+		if have, err := fsutil.FreeSpace(dir); err != nil {
+			logrus.WithError(err).Warnf("failed to get the free space of %q, skipping `requires.disk`", dir)
+		} else if have < uint64(want) {
+			errs = append(errs, fmt.Errorf("the template requires %s of the free disk space, but %q has only %s (hint: free up the disk space, or use `limactl prune`)",
+				units.BytesSize(float64(want)), dir, units.BytesSize(float64(have))))
+		}
+	}
+	if r.MacOS != nil && runtime.GOOS == "darwin" {
+		want, err := limayaml.ParseMacOSVersion(*r.MacOS)
+		if err != nil {
+			return err
+		}
+		if have, err := osutil.ProductVersion(); err != nil {
+			logrus.WithError(err).Warn("failed to get the macOS version, skipping `requires.macOS`")
+		} else if have.LessThan(*want) {
+			errs = append(errs, fmt.Errorf("the template requires macOS %s or later, but the host is running macOS %s", *r.MacOS, have))
+		}
+	}
+	for _, b := range r.Binaries {
+		if _, err := exec.LookPath(b); err != nil {
+			errs = append(errs, fmt.Errorf("the template requires %q to be installed on the host: %w", b, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("the host does not satisfy the requirements of the template (`requires`):\n%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package instance
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckRequirements(t *testing.T) {
+	dir := t.TempDir()
+	y := &limayaml.LimaYAML{
+		VMType: ptr.Of(limayaml.QEMU),
+		Requires: limayaml.Requires{
+			Memory:   ptr.Of("1MiB"),
+			Disk:     ptr.Of("1KiB"),
+			Binaries: []string{"sh"},
+			VMTypes:  []limayaml.VMType{limayaml.QEMU, limayaml.VZ},
+		},
+	}
+	assert.NilError(t, CheckRequirements(y, dir))
+
+	y.Requires = limayaml.Requires{
+		Memory:   ptr.Of("1000PiB"),
+		Disk:     ptr.Of("1000PiB"),
+		Binaries: []string{"lima-nonexistent-binary"},
+		VMTypes:  []limayaml.VMType{limayaml.VZ},
+	}
+	err := CheckRequirements(y, dir)
+	assert.ErrorContains(t, err, "the template requires vmType to be one of [vz], got \"qemu\"")
+	assert.ErrorContains(t, err, "of the host memory, but the host has only")
+	assert.ErrorContains(t, err, "of the free disk space")
+	assert.ErrorContains(t, err, "the template requires \"lima-nonexistent-binary\" to be installed on the host")
+}
@@ -0,0 +1,237 @@
+package instance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store"
+)
+
+const (
+	rosettaMountPoint = "/mnt/lima-rosetta"
+	rosettaBinary     = rosettaMountPoint + "/rosetta"
+	// rosettaBinFmt is the binfmt_misc registration of Rosetta; same as boot/05-rosetta-volume.sh
+	rosettaBinFmt = `:rosetta:M::\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00:\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff:` + rosettaBinary + `:OCF`
+	// rosettaBinFmtMagic is the magic of the x86_64 executables, as printed in /proc/sys/fs/binfmt_misc/<ENTRY>
+	rosettaBinFmtMagic = "7f454c4602010100000000000000000002003e00"
+)
+
+// RosettaStatus is the state of Rosetta in the guest.
+type RosettaStatus struct {
+	Kernel string `json:"kernel"`
+	// Mounted is true when the Rosetta volume ("vz-rosetta") is mounted on /mnt/lima-rosetta
+	Mounted bool `json:"mounted"`
+	// Binary is true when /mnt/lima-rosetta/rosetta is executable
+	Binary bool `json:"binary"`
+	// BinFmtMisc is true when binfmt_misc is mounted on /proc/sys/fs/binfmt_misc
+	BinFmtMisc  bool   `json:"binfmtMisc"`
+	Registered  bool   `json:"registered"`
+	Enabled     bool   `json:"enabled"`
+	Interpreter string `json:"interpreter,omitempty"`
+	Flags       string `json:"flags,omitempty"`
+	// BinFmtD is true when the guest has /usr/lib/binfmt.d, i.e., uses systemd-binfmt.service
+	BinFmtD     bool `json:"binfmtD"`
+	BinFmtDConf bool `json:"binfmtDConf"`
+	// Conflicts is the other enabled binfmt_misc entries for the x86_64 executables, e.g., "qemu-x86_64"
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// rosettaStatusScript prints the fields of RosettaStatus as "KEY=VALUE" lines.
+const rosettaStatusScript = `binfmt_misc=/proc/sys/fs/binfmt_misc
+echo "kernel=$(uname -r)"
+grep -qs " ` + rosettaMountPoint + ` " /proc/mounts && echo mounted=true
+[ -x ` + rosettaBinary + ` ] && echo binary=true
+[ -e "$binfmt_misc/status" ] && echo binfmt_misc=true
+if [ -f "$binfmt_misc/rosetta" ]; then
+	echo registered=true
+	grep -qx enabled "$binfmt_misc/rosetta" && echo enabled=true
+	sed -n -e 's/^interpreter /interpreter=/p' -e 's/^flags: /flags=/p' "$binfmt_misc/rosetta"
+fi
+[ -d /usr/lib/binfmt.d ] && echo binfmtd=true
+[ -f /usr/lib/binfmt.d/rosetta.conf ] && echo binfmtd_conf=true
+for f in "$binfmt_misc"/*; do
+	name=$(basename "$f")
+	case "$name" in rosetta | register | status) continue ;; esac
+	grep -qx enabled "$f" 2>/dev/null && grep -qx "magic ` + rosettaBinFmtMagic + `" "$f" 2>/dev/null && echo "conflict=$name"
+done
+exit 0
+`
+
+// InspectRosetta inspects the state of Rosetta in the running instance over SSH.
+func InspectRosetta(ctx context.Context, inst *store.Instance) (*RosettaStatus, error) {
+	out, err := execGuestScript(ctx, inst, rosettaStatusScript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect Rosetta in instance %q: %w", inst.Name, err)
+	}
+	return parseRosettaStatus(out), nil
+}
+
+func parseRosettaStatus(s string) *RosettaStatus {
+	var st RosettaStatus
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "kernel":
+			st.Kernel = v
+		case "mounted":
+			st.Mounted = v == "true"
+		case "binary":
+			st.Binary = v == "true"
+		case "binfmt_misc":
+			st.BinFmtMisc = v == "true"
+		case "registered":
+			st.Registered = v == "true"
+		case "enabled":
+			st.Enabled = v == "true"
+		case "interpreter":
+			st.Interpreter = v
+		case "flags":
+			st.Flags = v
+		case "binfmtd":
+			st.BinFmtD = v == "true"
+		case "binfmtd_conf":
+			st.BinFmtDConf = v == "true"
+		case "conflict":
+			st.Conflicts = append(st.Conflicts, v)
+		}
+	}
+	return &st
+}
+
+// Problems returns the problems of Rosetta in the guest.
+// binFmt is the `rosetta.binfmt` of the instance.
+func (st *RosettaStatus) Problems(binFmt bool) []string {
+	var res []string
+	if !st.Mounted {
+		res = append(res, fmt.Sprintf("the Rosetta volume is not mounted on %q", rosettaMountPoint))
+	} else if !st.Binary {
+		res = append(res, fmt.Sprintf("%q is not executable", rosettaBinary))
+	}
+	if !binFmt {
+		if st.Registered {
+			res = append(res, "Rosetta is registered in binfmt_misc, although `rosetta.binfmt` is false")
+		}
+		if st.BinFmtDConf {
+			res = append(res, "/usr/lib/binfmt.d/rosetta.conf exists, although `rosetta.binfmt` is false")
+		}
+		return res
+	}
+	switch {
+	case !st.BinFmtMisc:
+		res = append(res, "binfmt_misc is not mounted on /proc/sys/fs/binfmt_misc")
+	case !st.Registered:
+		res = append(res, "Rosetta is not registered in binfmt_misc")
+	default:
+		if !st.Enabled {
+			res = append(res, "the binfmt_misc entry of Rosetta is disabled")
+		}
+		if st.Interpreter != rosettaBinary {
+			res = append(res, fmt.Sprintf("the binfmt_misc entry of Rosetta has the interpreter %q, expected %q", st.Interpreter, rosettaBinary))
+		}
+		if !strings.Contains(st.Flags, "F") {
+			res = append(res, fmt.Sprintf("the binfmt_misc entry of Rosetta has the flags %q, expected %q", st.Flags, "OCF"))
+		}
+	}
+	for _, c := range st.Conflicts {
+		res = append(res, fmt.Sprintf("the binfmt_misc entry %q also handles the x86_64 executables, and may take precedence over Rosetta", c))
+	}
+	if st.BinFmtD && !st.BinFmtDConf {
+		res = append(res, "/usr/lib/binfmt.d/rosetta.conf does not exist, so systemd-binfmt.service may register the other emulators over Rosetta")
+	}
+	return res
+}
+
+// rosettaRepairScript returns the script that mounts the Rosetta volume, and registers Rosetta in binfmt_misc
+// (or unregisters it when binFmt is false), like boot/05-rosetta-volume.sh.
+// The conflicting binfmt_misc entries are disabled.
+func rosettaRepairScript(binFmt bool) string {
+	script := `set -eux
+binfmt_misc=/proc/sys/fs/binfmt_misc
+rosetta_binfmt='` + rosettaBinFmt + `'
+if ! grep -qs " ` + rosettaMountPoint + ` " /proc/mounts; then
+	sudo mkdir -p ` + rosettaMountPoint + `
+	# Prefer the options in /etc/fstab (e.g., the SELinux context), see boot/05-lima-mounts.sh
+	sudo mount ` + rosettaMountPoint + ` || sudo mount -t virtiofs vz-rosetta ` + rosettaMountPoint + `
+fi
+`
+	if !binFmt {
+		return script + `[ ! -f "$binfmt_misc/rosetta" ] || echo -1 | sudo tee "$binfmt_misc/rosetta" >/dev/null
+sudo rm -f /usr/lib/binfmt.d/rosetta.conf
+`
+	}
+	return script + `[ -e "$binfmt_misc/status" ] || sudo mount -t binfmt_misc binfmt_misc "$binfmt_misc"
+# Re-register the entry, to update it. printf is used, as the echo of dash interprets the backslashes.
+[ ! -f "$binfmt_misc/rosetta" ] || echo -1 | sudo tee "$binfmt_misc/rosetta" >/dev/null
+printf "%s\n" "$rosetta_binfmt" | sudo tee "$binfmt_misc/register" >/dev/null
+for f in "$binfmt_misc"/*; do
+	case "$(basename "$f")" in rosetta | register | status) continue ;; esac
+	if grep -qx enabled "$f" && grep -qx "magic ` + rosettaBinFmtMagic + `" "$f"; then
+		echo 0 | sudo tee "$f" >/dev/null
+	fi
+done
+[ ! -d /usr/lib/binfmt.d ] || printf "%s\n" "$rosetta_binfmt" | sudo tee /usr/lib/binfmt.d/rosetta.conf >/dev/null
+`
+}
+
+// RepairRosetta mounts the Rosetta volume, and reinstalls the binfmt_misc entry of Rosetta in the running instance.
+// The instance must allow sudo (`security.sudo: full`).
+func RepairRosetta(ctx context.Context, inst *store.Instance) error {
+	if *inst.Config.Security.Sudo != limayaml.SudoFull {
+		return fmt.Errorf("cannot repair Rosetta in the running instance %q, as `security.sudo` is %q; "+
+			"the boot script repairs it on `limactl restart %s`", inst.Name, *inst.Config.Security.Sudo, inst.Name)
+	}
+	if _, err := execGuestScript(ctx, inst, rosettaRepairScript(*inst.Config.Rosetta.BinFmt)); err != nil {
+		return fmt.Errorf("failed to repair Rosetta in instance %q: %w", inst.Name, err)
+	}
+	return nil
+}
+
+// execGuestScript executes the sh script in the running instance over SSH, and returns the stdout.
+func execGuestScript(ctx context.Context, inst *store.Instance, script string) (string, error) {
+	return execGuestCommand(ctx, inst, strings.NewReader(script), "sh", "-s")
+}
+
+// execGuestCommand executes the command in the running instance over SSH with the stdin, and returns the stdout.
+// The command is interpreted by the login shell of the guest user.
+func execGuestCommand(ctx context.Context, inst *store.Instance, stdin io.Reader, command ...string) (string, error) {
+	if inst.Status != store.StatusRunning {
+		return "", fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	sshExe, err := exec.LookPath("ssh")
+	if err != nil {
+		return "", err
+	}
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *inst.Config.User.Name, false, false, false, false)
+	if err != nil {
+		return "", err
+	}
+	args := sshutil.SSHArgsFromOpts(sshOpts)
+	args = append(args,
+		"-q",
+		"-p", strconv.Itoa(inst.SSHLocalPort),
+		inst.SSHAddress,
+		"--",
+	)
+	args = append(args, command...)
+	cmd := exec.CommandContext(ctx, sshExe, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("stderr=%q: %w", stderr.String(), err)
+	}
+	return string(out), nil
+}
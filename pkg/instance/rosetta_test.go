@@ -0,0 +1,65 @@
+package instance
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRosettaStatus(t *testing.T) {
+	healthy := `kernel=6.8.0-51-generic
+mounted=true
+binary=true
+binfmt_misc=true
+registered=true
+enabled=true
+interpreter=/mnt/lima-rosetta/rosetta
+flags=OCF
+binfmtd=true
+binfmtd_conf=true
+`
+	st := parseRosettaStatus(healthy)
+	assert.DeepEqual(t, *st, RosettaStatus{
+		Kernel:      "6.8.0-51-generic",
+		Mounted:     true,
+		Binary:      true,
+		BinFmtMisc:  true,
+		Registered:  true,
+		Enabled:     true,
+		Interpreter: "/mnt/lima-rosetta/rosetta",
+		Flags:       "OCF",
+		BinFmtD:     true,
+		BinFmtDConf: true,
+	})
+	assert.Equal(t, len(st.Problems(true)), 0)
+	assert.DeepEqual(t, st.Problems(false), []string{
+		"Rosetta is registered in binfmt_misc, although `rosetta.binfmt` is false",
+		"/usr/lib/binfmt.d/rosetta.conf exists, although `rosetta.binfmt` is false",
+	})
+
+	// qemu-user-static was installed after the boot, and the Rosetta volume was unmounted
+	broken := `kernel=6.8.0-51-generic
+binfmt_misc=true
+binfmtd=true
+conflict=qemu-x86_64
+`
+	st = parseRosettaStatus(broken)
+	assert.DeepEqual(t, st.Conflicts, []string{"qemu-x86_64"})
+	assert.DeepEqual(t, st.Problems(true), []string{
+		`the Rosetta volume is not mounted on "/mnt/lima-rosetta"`,
+		"Rosetta is not registered in binfmt_misc",
+		`the binfmt_misc entry "qemu-x86_64" also handles the x86_64 executables, and may take precedence over Rosetta`,
+		"/usr/lib/binfmt.d/rosetta.conf does not exist, so systemd-binfmt.service may register the other emulators over Rosetta",
+	})
+	assert.Equal(t, len(st.Problems(false)), 1)
+}
+
+func TestRosettaRepairScript(t *testing.T) {
+	script := rosettaRepairScript(true)
+	assert.Assert(t, strings.Contains(script, `printf "%s\n" "$rosetta_binfmt" | sudo tee "$binfmt_misc/register"`), script)
+	assert.Assert(t, strings.Contains(script, `:/mnt/lima-rosetta/rosetta:OCF'`), script)
+	script = rosettaRepairScript(false)
+	assert.Assert(t, !strings.Contains(script, "/register"), script)
+	assert.Assert(t, strings.Contains(script, "sudo rm -f /usr/lib/binfmt.d/rosetta.conf"), script)
+}
@@ -4,12 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"syscall"
 	"text/template"
 	"time"
@@ -19,6 +23,7 @@ import (
 	"github.com/lima-vm/lima/pkg/driverutil"
 	"github.com/lima-vm/lima/pkg/executil"
 	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/qemu/entitlementutil"
 	"github.com/mattn/go-isatty"
@@ -29,6 +34,7 @@ import (
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/sirupsen/logrus"
 )
 
@@ -46,7 +52,7 @@ func ensureNerdctlArchiveCache(ctx context.Context, y *limayaml.LimaYAML, create
 	}
 
 	errs := make([]error, len(y.Containerd.Archives))
-	for i, f := range y.Containerd.Archives {
+	for i, f := range fileutils.FilesByMirrorScore(y.Containerd.Archives) {
 		// Skip downloading again if the file is already in the cache
 		if created && f.Arch == *y.Arch && !downloader.IsLocal(f.Location) {
 			path, err := fileutils.CachedFile(f)
@@ -78,6 +84,10 @@ type Prepared struct {
 
 // Prepare ensures the disk, the nerdctl archive, etc.
 func Prepare(ctx context.Context, inst *store.Instance) (*Prepared, error) {
+	if err := allocateMACAddresses(inst); err != nil {
+		return nil, err
+	}
+
 	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
 		Instance: inst,
 	})
@@ -90,14 +100,21 @@ func Prepare(ctx context.Context, inst *store.Instance) (*Prepared, error) {
 		return nil, err
 	}
 
+	if err := ensureStorageDir(inst); err != nil {
+		return nil, err
+	}
+
 	// Check if the instance has been created (the base disk already exists)
-	baseDisk := filepath.Join(inst.Dir, filenames.BaseDisk)
+	baseDisk := filepath.Join(store.StorageDir(inst.Dir, inst.Config), filenames.BaseDisk)
 	_, err := os.Stat(baseDisk)
 	created := err == nil
 
 	if err := limaDriver.CreateDisk(ctx); err != nil {
 		return nil, err
 	}
+	if err := createAdditionalDisks(inst.Config); err != nil {
+		return nil, err
+	}
 	nerdctlArchiveCache, err := ensureNerdctlArchiveCache(ctx, inst.Config, created)
 	if err != nil {
 		return nil, err
@@ -123,11 +140,10 @@ func Prepare(ctx context.Context, inst *store.Instance) (*Prepared, error) {
 //
 // Start calls Prepare by itself, so you do not need to call Prepare manually before calling Start.
 func Start(ctx context.Context, inst *store.Instance, limactl string, launchHostAgentForeground bool) error {
-	haPIDPath := filepath.Join(inst.Dir, filenames.HostAgentPID)
-	if _, err := os.Stat(haPIDPath); !errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("instance %q seems running (hint: remove %q if the instance is not actually running)", inst.Name, haPIDPath)
+	if inst.HostAgentPID != 0 {
+		return fmt.Errorf("instance %q seems running (host agent PID %d)", inst.Name, inst.HostAgentPID)
 	}
-	logrus.Infof("Starting the instance %q with VM driver %q", inst.Name, inst.VMType)
+	progress.Step("Starting the instance %q with VM driver %q", inst.Name, inst.VMType)
 
 	haSockPath := filepath.Join(inst.Dir, filenames.HostAgentSock)
 
@@ -186,7 +202,6 @@ func Start(ctx context.Context, inst *store.Instance, limactl string, launchHost
 	}
 	args = append(args,
 		"hostagent",
-		"--pidfile", haPIDPath,
 		"--socket", haSockPath)
 	if prepared.Driver.CanRunGUI() {
 		args = append(args, "--run-gui")
@@ -194,6 +209,9 @@ func Start(ctx context.Context, inst *store.Instance, limactl string, launchHost
 	if prepared.NerdctlArchiveCache != "" {
 		args = append(args, "--nerdctl-archive", prepared.NerdctlArchiveCache)
 	}
+	if port := metricsPort(ctx); port != 0 {
+		args = append(args, "--metrics-port", strconv.Itoa(port))
+	}
 	args = append(args, inst.Name)
 	haCmd := exec.CommandContext(ctx, limactl, args...)
 
@@ -208,6 +226,7 @@ func Start(ctx context.Context, inst *store.Instance, limactl string, launchHost
 
 	begin := time.Now() // used for logrus propagation
 
+	progress.Step("Launching the host agent")
 	if launchHostAgentForeground {
 		logrus.Info("Running the host agent in the foreground")
 		if isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd()) {
@@ -234,7 +253,7 @@ func Start(ctx context.Context, inst *store.Instance, limactl string, launchHost
 		return err
 	}
 
-	if err := waitHostAgentStart(ctx, haPIDPath, haStderrPath); err != nil {
+	if err := waitHostAgentStart(ctx, inst.Dir, haCmd.Process.Pid, haStderrPath); err != nil {
 		return err
 	}
 
@@ -260,18 +279,17 @@ func Start(ctx context.Context, inst *store.Instance, limactl string, launchHost
 	}
 }
 
-func waitHostAgentStart(_ context.Context, haPIDPath, haStderrPath string) error {
-	begin := time.Now()
+// waitHostAgentStart waits for the host agent process to record its PID in the metadata of the instance.
+func waitHostAgentStart(ctx context.Context, instDir string, haPID int, haStderrPath string) error {
 	deadlineDuration := 5 * time.Second
-	deadline := begin.Add(deadlineDuration)
-	for {
-		if _, err := os.Stat(haPIDPath); !errors.Is(err, os.ErrNotExist) {
+	ctx, cancel := context.WithTimeout(ctx, deadlineDuration)
+	defer cancel()
+	for md := range metadata.Watch(ctx, instDir, 50*time.Millisecond) {
+		if md.HostAgentPID == haPID {
 			return nil
 		}
-		if time.Now().After(deadline) {
-			return fmt.Errorf("hostagent (%q) did not start up in %v (hint: see %q)", haPIDPath, deadlineDuration, haStderrPath)
-		}
 	}
+	return fmt.Errorf("hostagent (PID %d) did not start up in %v (hint: see %q)", haPID, deadlineDuration, haStderrPath)
 }
 
 func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPath, haStderrPath string, begin time.Time) error {
@@ -281,9 +299,48 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 	var (
 		printedSSHLocalPort  bool
 		receivedRunningEvent bool
+		passedWaitedProbes   bool
 		err                  error
 	)
+	probeEventsW := probeEventsWriter(ctx)
+	waitedProbes := make(map[string]struct{})
+	for _, name := range waitForProbes(ctx) {
+		waitedProbes[name] = struct{}{}
+	}
 	onEvent := func(ev hostagentevents.Event) bool {
+		if f := ev.DriverFailure; f != nil {
+			if f.Restarting {
+				logrus.Warnf("The driver failed unexpectedly (%s), restarting (restart %d)", f.Reason, f.Restarts)
+			} else {
+				logrus.Errorf("The driver failed unexpectedly (%s) (hint: see %q)", f.Reason, haStderrPath)
+			}
+			return false
+		}
+		if ev.Ready != "" {
+			progress.Step("Ready: %s", ev.Ready)
+			return false
+		}
+		if ev.Probe != nil {
+			if probeEventsW != nil {
+				if b, xerr := json.Marshal(ev); xerr == nil {
+					fmt.Fprintln(probeEventsW, string(b))
+				}
+			}
+			if _, ok := waitedProbes[ev.Probe.Name]; ok {
+				if !ev.Probe.Passed {
+					err = fmt.Errorf("probe %q failed: %s", ev.Probe.Name, ev.Probe.Error)
+					return true
+				}
+				logrus.Infof("The probe %q passed in %v", ev.Probe.Name, ev.Probe.Duration.Round(time.Second))
+				delete(waitedProbes, ev.Probe.Name)
+				if len(waitedProbes) == 0 {
+					passedWaitedProbes = true
+					logrus.Info("All the waited probes passed. The host agent continues to start up the instance in the background.")
+					return true
+				}
+			}
+			return false
+		}
 		if !printedSSHLocalPort && ev.Status.SSHLocalPort != 0 {
 			logrus.Infof("SSH Local Port: %d", ev.Status.SSHLocalPort)
 			printedSSHLocalPort = true
@@ -303,14 +360,22 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 				return true
 			}
 
+			if len(waitedProbes) > 0 {
+				names := make([]string, 0, len(waitedProbes))
+				for name := range waitedProbes {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				logrus.Warnf("The instance is running, but the probes %v did not report their results", names)
+			}
 			if xerr := runAnsibleProvision(ctx, inst); xerr != nil {
 				err = xerr
 				return true
 			}
 			if *inst.Config.Plain {
-				logrus.Infof("READY. Run `ssh -F %q %s` to open the shell.", inst.SSHConfigFile, inst.Hostname)
+				progress.Step("READY. Run `ssh -F %q %s` to open the shell.", inst.SSHConfigFile, inst.Hostname)
 			} else {
-				logrus.Infof("READY. Run `%s` to open the shell.", LimactlShellCmd(inst.Name))
+				progress.Step("READY. Run `%s` to open the shell.", LimactlShellCmd(inst.Name))
 			}
 			_ = ShowMessage(inst)
 			err = nil
@@ -327,7 +392,7 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 		return err
 	}
 
-	if !receivedRunningEvent {
+	if !receivedRunningEvent && !passedWaitedProbes {
 		return errors.New("did not receive an event with the \"running\" status")
 	}
 
@@ -352,6 +417,45 @@ func watchHostAgentTimeout(ctx context.Context) time.Duration {
 	return DefaultWatchHostAgentEventsTimeout
 }
 
+type probeEventsWriterKey struct{}
+
+// WithProbeEventsWriter makes watchHostAgentEvents write the readiness probe events to w,
+// as JSON lines.
+func WithProbeEventsWriter(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, probeEventsWriterKey{}, w)
+}
+
+func probeEventsWriter(ctx context.Context) io.Writer {
+	w, _ := ctx.Value(probeEventsWriterKey{}).(io.Writer)
+	return w
+}
+
+type waitForProbesKey struct{}
+
+// WithWaitForProbes makes watchHostAgentEvents return as soon as the named readiness probes have passed,
+// without waiting for the instance to be running.
+func WithWaitForProbes(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, waitForProbesKey{}, names)
+}
+
+func waitForProbes(ctx context.Context) []string {
+	names, _ := ctx.Value(waitForProbesKey{}).([]string)
+	return names
+}
+
+type metricsPortKey struct{}
+
+// WithMetricsPort makes the host agent serve the metrics of the guest in the Prometheus format
+// on http://127.0.0.1:PORT/metrics.
+func WithMetricsPort(ctx context.Context, port int) context.Context {
+	return context.WithValue(ctx, metricsPortKey{}, port)
+}
+
+func metricsPort(ctx context.Context) int {
+	port, _ := ctx.Value(metricsPortKey{}).(int)
+	return port
+}
+
 func LimactlShellCmd(instName string) string {
 	shellCmd := fmt.Sprintf("limactl shell %s", instName)
 	if instName == "default" {
@@ -0,0 +1,408 @@
+package instance
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	"github.com/lima-vm/lima/pkg/sshutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// Sample is a snapshot of the resource usage counters of the guest.
+// The counters are cumulative since the boot of the guest.
+type Sample struct {
+	Time time.Time
+	// CPUs is the number of the online CPUs
+	CPUs int
+	// CPUTotal and CPUIdle are in USER_HZ
+	CPUTotal        uint64
+	CPUIdle         uint64
+	MemoryTotal     uint64
+	MemoryAvailable uint64
+	DiskReadBytes   uint64
+	DiskWriteBytes  uint64
+	NetRxBytes      uint64
+	NetTxBytes      uint64
+	// Processes is set only when requested
+	Processes map[int]ProcessSample
+	// HostCPUTime is the CPU time consumed on the host by the VM process and the host agent.
+	// Zero when it could not be read.
+	HostCPUTime time.Duration
+}
+
+// ProcessSample is a snapshot of the resource usage counters of a guest process.
+type ProcessSample struct {
+	Command string
+	// CPUTime is the sum of utime and stime, in USER_HZ
+	CPUTime uint64
+	RSS     uint64
+	// Container is the short ID of the container, derived from the cgroup of the process
+	Container string
+}
+
+// Stats is the resource usage of an instance, computed from two samples.
+type Stats struct {
+	Name string `json:"name"`
+	CPUs int    `json:"cpus"`
+	// CPUPercent is the CPU usage between the two samples, relative to the capacity of a single CPU
+	// (i.e., 200 means two CPUs are fully used), as in `docker stats`.
+	CPUPercent float64 `json:"cpuPercent"`
+	// HostCPUPercent is the CPU usage of the VM process and the host agent on the host, relative to the capacity of a single CPU.
+	// It includes the overhead of the virtualization, such as the emulation of the timers and the devices,
+	// and is the estimate of the power impact of the instance.
+	HostCPUPercent float64 `json:"hostCPUPercent"`
+	MemoryUsed     uint64  `json:"memoryUsed"`
+	MemoryTotal    uint64  `json:"memoryTotal"`
+	MemoryPercent  float64 `json:"memoryPercent"`
+	DiskReadBytes  uint64  `json:"diskReadBytes"`
+	DiskWriteBytes uint64  `json:"diskWriteBytes"`
+	NetRxBytes     uint64  `json:"netRxBytes"`
+	NetTxBytes     uint64  `json:"netTxBytes"`
+	// Processes is set only when the samples contain the processes
+	Processes []ProcessStats `json:"processes,omitempty"`
+}
+
+// ProcessStats is the resource usage of a guest process, computed from two samples.
+type ProcessStats struct {
+	PID       int    `json:"pid"`
+	Command   string `json:"command"`
+	Container string `json:"container,omitempty"`
+	// CPUPercent is relative to the capacity of a single CPU, as in Stats
+	CPUPercent    float64 `json:"cpuPercent"`
+	MemoryRSS     uint64  `json:"memoryRSS"`
+	MemoryPercent float64 `json:"memoryPercent"`
+}
+
+// NewStats computes the stats from the previous and the current samples.
+func NewStats(name string, prev, cur *Sample) *Stats {
+	st := &Stats{
+		Name:           name,
+		CPUs:           cur.CPUs,
+		MemoryTotal:    cur.MemoryTotal,
+		DiskReadBytes:  cur.DiskReadBytes,
+		DiskWriteBytes: cur.DiskWriteBytes,
+		NetRxBytes:     cur.NetRxBytes,
+		NetTxBytes:     cur.NetTxBytes,
+	}
+	if cur.MemoryTotal >= cur.MemoryAvailable {
+		st.MemoryUsed = cur.MemoryTotal - cur.MemoryAvailable
+	}
+	if cur.MemoryTotal > 0 {
+		st.MemoryPercent = float64(st.MemoryUsed) / float64(cur.MemoryTotal) * 100
+	}
+	// the counters are reset when the guest is rebooted
+	var total uint64
+	if prev != nil && cur.CPUTotal > prev.CPUTotal && cur.CPUIdle >= prev.CPUIdle {
+		total = cur.CPUTotal - prev.CPUTotal
+		idle := cur.CPUIdle - prev.CPUIdle
+		if idle <= total {
+			st.CPUPercent = float64(total-idle) / float64(total) * 100 * float64(cur.CPUs)
+		}
+	}
+	if prev != nil && prev.HostCPUTime > 0 && cur.HostCPUTime >= prev.HostCPUTime && cur.Time.After(prev.Time) {
+		st.HostCPUPercent = float64(cur.HostCPUTime-prev.HostCPUTime) / float64(cur.Time.Sub(prev.Time)) * 100
+	}
+	for pid, p := range cur.Processes {
+		ps := ProcessStats{
+			PID:       pid,
+			Command:   p.Command,
+			Container: p.Container,
+			MemoryRSS: p.RSS,
+		}
+		if cur.MemoryTotal > 0 {
+			ps.MemoryPercent = float64(p.RSS) / float64(cur.MemoryTotal) * 100
+		}
+		// the PID may have been reused by another process between the samples
+		if prevProc, ok := prev.processes()[pid]; ok && total > 0 && prevProc.Command == p.Command && p.CPUTime >= prevProc.CPUTime {
+			ps.CPUPercent = float64(p.CPUTime-prevProc.CPUTime) / float64(total) * 100 * float64(cur.CPUs)
+		}
+		st.Processes = append(st.Processes, ps)
+	}
+	return st
+}
+
+func (s *Sample) processes() map[int]ProcessSample {
+	if s == nil {
+		return nil
+	}
+	return s.Processes
+}
+
+// SortProcesses sorts the processes by "cpu" or "memory" in descending order, and keeps the first n processes.
+// n <= 0 keeps all the processes.
+func (st *Stats) SortProcesses(by string, n int) error {
+	var key func(ProcessStats) float64
+	switch by {
+	case "cpu":
+		key = func(p ProcessStats) float64 { return p.CPUPercent }
+	case "memory":
+		key = func(p ProcessStats) float64 { return float64(p.MemoryRSS) }
+	default:
+		return fmt.Errorf("unsupported sort key %q, must be one of: cpu, memory", by)
+	}
+	sort.SliceStable(st.Processes, func(i, j int) bool {
+		a, b := st.Processes[i], st.Processes[j]
+		if key(a) != key(b) {
+			return key(a) > key(b)
+		}
+		return a.PID < b.PID
+	})
+	if n > 0 && len(st.Processes) > n {
+		st.Processes = st.Processes[:n]
+	}
+	return nil
+}
+
+// statsScript prints the files needed for a Sample, each preceded by a "==> FILE" line.
+const statsScript = `for f in /proc/stat /proc/meminfo /proc/diskstats /proc/net/dev; do echo "==> $f"; cat "$f"; done`
+
+// processesScript prints the page size and the stat and the cgroup of each process, separated by a tab.
+const processesScript = `echo "==> pagesize"; getconf PAGESIZE; echo "==> processes"; ` +
+	`for d in /proc/[0-9]*; do s=$(cat "$d/stat" 2>/dev/null) || continue; printf '%s\t%s\n' "$s" "$(tail -n 1 "$d/cgroup" 2>/dev/null)"; done`
+
+// ReadSample reads the resource usage counters of the running instance from the guest agent via the host agent,
+// or over SSH when the guest agent does not support it.
+// When withProcesses is true, the counters of the guest processes are read too.
+func ReadSample(ctx context.Context, inst *store.Instance, withProcesses bool) (*Sample, error) {
+	if inst.Status != store.StatusRunning {
+		return nil, fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	t := time.Now()
+	out, err := readCounters(ctx, inst, withProcesses)
+	if err != nil {
+		logrus.WithError(err).Debugf("Failed to read the stats of instance %q from the guest agent, falling back to SSH", inst.Name)
+		t = time.Now()
+		if out, err = readCountersOverSSH(ctx, inst, withProcesses); err != nil {
+			return nil, err
+		}
+	}
+	sample, err := parseSample(out, t)
+	if err != nil {
+		return nil, err
+	}
+	if sample.HostCPUTime, err = hostCPUTime(inst); err != nil {
+		logrus.WithError(err).Debugf("Failed to read the host CPU time of instance %q", inst.Name)
+	}
+	return sample, nil
+}
+
+// readCounters reads the counters from the guest agent via the host agent.
+func readCounters(ctx context.Context, inst *store.Instance, withProcesses bool) (string, error) {
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return "", err
+	}
+	telemetry, err := haClient.Telemetry(ctx, withProcesses)
+	if err != nil {
+		return "", err
+	}
+	return telemetry.Counters, nil
+}
+
+// readCountersOverSSH reads the counters by running statsScript and processesScript over SSH.
+func readCountersOverSSH(ctx context.Context, inst *store.Instance, withProcesses bool) (string, error) {
+	sshExe, err := exec.LookPath("ssh")
+	if err != nil {
+		return "", err
+	}
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *inst.Config.User.Name, false, false, false, false)
+	if err != nil {
+		return "", err
+	}
+	script := statsScript
+	if withProcesses {
+		script += "; " + processesScript
+	}
+	args := sshutil.SSHArgsFromOpts(sshOpts)
+	args = append(args,
+		"-q",
+		"-p", strconv.Itoa(inst.SSHLocalPort),
+		inst.SSHAddress,
+		"--",
+		script,
+	)
+	cmd := exec.CommandContext(ctx, sshExe, args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the stats of instance %q: %w", inst.Name, err)
+	}
+	return string(out), nil
+}
+
+// diskRegexp matches the whole disks in /proc/diskstats, excluding the partitions, the loop devices, etc.
+var diskRegexp = regexp.MustCompile(`^((s|v|xv)d[a-z]+|nvme[0-9]+n[0-9]+|mmcblk[0-9]+)$`)
+
+// diskSectorSize is the unit of the sector counts in /proc/diskstats, regardless of the device.
+const diskSectorSize = 512
+
+func parseSample(s string, t time.Time) (*Sample, error) {
+	sample := &Sample{Time: t}
+	var file string
+	var hasCPU, hasMem bool
+	pageSize := uint64(4096)
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := sc.Text()
+		if f, ok := strings.CutPrefix(line, "==> "); ok {
+			file = f
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch file {
+		case "/proc/stat":
+			switch {
+			case fields[0] == "cpu":
+				// user nice system idle iowait irq softirq steal (guest and guest_nice are included in user and nice)
+				for i, v := range fields[1:min(len(fields), 9)] {
+					n, err := strconv.ParseUint(v, 10, 64)
+					if err != nil {
+						return nil, fmt.Errorf("failed to parse /proc/stat: %w", err)
+					}
+					sample.CPUTotal += n
+					if i == 3 || i == 4 {
+						sample.CPUIdle += n
+					}
+				}
+				hasCPU = true
+			case strings.HasPrefix(fields[0], "cpu"):
+				sample.CPUs++
+			}
+		case "/proc/meminfo":
+			if len(fields) < 2 {
+				continue
+			}
+			n, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch fields[0] {
+			case "MemTotal:":
+				sample.MemoryTotal = n * 1024
+				hasMem = true
+			case "MemAvailable:":
+				sample.MemoryAvailable = n * 1024
+			}
+		case "/proc/diskstats":
+			// major minor name reads reads_merged sectors_read ms_reading writes writes_merged sectors_written ...
+			if len(fields) < 10 || !diskRegexp.MatchString(fields[2]) {
+				continue
+			}
+			read, err := strconv.ParseUint(fields[5], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse /proc/diskstats: %w", err)
+			}
+			written, err := strconv.ParseUint(fields[9], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse /proc/diskstats: %w", err)
+			}
+			sample.DiskReadBytes += read * diskSectorSize
+			sample.DiskWriteBytes += written * diskSectorSize
+		case "/proc/net/dev":
+			// "IFACE: rx_bytes rx_packets ... (8 fields) tx_bytes ..."; the header lines do not contain ':'
+			iface, counters, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			iface = strings.TrimSpace(iface)
+			fields = strings.Fields(counters)
+			if iface == "lo" || len(fields) < 9 {
+				continue
+			}
+			rx, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse /proc/net/dev: %w", err)
+			}
+			tx, err := strconv.ParseUint(fields[8], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse /proc/net/dev: %w", err)
+			}
+			sample.NetRxBytes += rx
+			sample.NetTxBytes += tx
+		case "pagesize":
+			if n, err := strconv.ParseUint(fields[0], 10, 64); err == nil && n > 0 {
+				pageSize = n
+			}
+		case "processes":
+			pid, p, err := parseProcess(line, pageSize)
+			if err != nil {
+				// the process may have exited while reading
+				continue
+			}
+			if sample.Processes == nil {
+				sample.Processes = make(map[int]ProcessSample)
+			}
+			sample.Processes[pid] = p
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !hasCPU || !hasMem {
+		return nil, fmt.Errorf("unexpected output: %q", s)
+	}
+	return sample, nil
+}
+
+// parseProcess parses a line of /proc/PID/stat, followed by a tab and the last line of /proc/PID/cgroup.
+func parseProcess(line string, pageSize uint64) (int, ProcessSample, error) {
+	stat, cgroup, _ := strings.Cut(line, "\t")
+	// the command may contain spaces and parentheses
+	open, closing := strings.Index(stat, "("), strings.LastIndex(stat, ")")
+	if open < 0 || closing < open {
+		return 0, ProcessSample{}, fmt.Errorf("unexpected stat: %q", stat)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:open]))
+	if err != nil {
+		return 0, ProcessSample{}, err
+	}
+	// fields[0] is the state (the 3rd field of the stat)
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 22 {
+		return 0, ProcessSample{}, fmt.Errorf("unexpected stat: %q", stat)
+	}
+	var counters [3]uint64
+	for i, idx := range []int{11, 12, 21} { // utime, stime, rss
+		counters[i], err = strconv.ParseUint(fields[idx], 10, 64)
+		if err != nil {
+			return 0, ProcessSample{}, err
+		}
+	}
+	return pid, ProcessSample{
+		Command:   stat[open+1 : closing],
+		CPUTime:   counters[0] + counters[1],
+		RSS:       counters[2] * pageSize,
+		Container: containerFromCgroup(cgroup),
+	}, nil
+}
+
+// containerIDRegexp matches the container IDs in the cgroup paths of Docker, containerd (nerdctl, Kubernetes), CRI-O, and Podman,
+// e.g., "/system.slice/docker-<ID>.scope", "/kubepods/.../<ID>", "/default/<ID>".
+var containerIDRegexp = regexp.MustCompile(`(?:^|[-/])([0-9a-f]{64})(?:\.scope)?$`)
+
+// containerFromCgroup returns the short ID of the container, or an empty string.
+func containerFromCgroup(cgroup string) string {
+	// "HIERARCHY-ID:CONTROLLERS:PATH"
+	parts := strings.SplitN(strings.TrimSpace(cgroup), ":", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	m := containerIDRegexp.FindStringSubmatch(parts[2])
+	if m == nil {
+		return ""
+	}
+	return m[1][:12]
+}
@@ -0,0 +1,143 @@
+package instance
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const testStatsOutput = `==> /proc/stat
+cpu  1000 0 500 8000 500 0 0 0 0 0
+cpu0 500 0 250 4000 250 0 0 0 0 0
+cpu1 500 0 250 4000 250 0 0 0 0 0
+intr 12345
+ctxt 6789
+==> /proc/meminfo
+MemTotal:        4000000 kB
+MemFree:         1000000 kB
+MemAvailable:    3000000 kB
+==> /proc/diskstats
+ 253       0 vda 100 0 2000 50 200 0 4000 100 0 150 150 0 0 0 0
+ 253       1 vda1 90 0 1800 40 190 0 3800 90 0 130 130 0 0 0 0
+   7       0 loop0 10 0 80 0 0 0 0 0 0 0 0 0 0 0 0
+ 253      16 vdb 10 0 100 5 20 0 200 10 0 15 15 0 0 0 0
+==> /proc/net/dev
+Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:   1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0: 500000    400    0    0    0     0          0         0    20000     300    0    0    0     0       0          0
+  eth1:   1000     10    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+`
+
+func TestParseSample(t *testing.T) {
+	now := time.Now()
+	sample, err := parseSample(testStatsOutput, now)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sample, &Sample{
+		Time:            now,
+		CPUs:            2,
+		CPUTotal:        10000,
+		CPUIdle:         8500,
+		MemoryTotal:     4000000 * 1024,
+		MemoryAvailable: 3000000 * 1024,
+		DiskReadBytes:   2100 * 512,
+		DiskWriteBytes:  4200 * 512,
+		NetRxBytes:      501000,
+		NetTxBytes:      20500,
+	})
+
+	_, err = parseSample("", now)
+	assert.ErrorContains(t, err, "unexpected output")
+}
+
+func TestNewStats(t *testing.T) {
+	prev := &Sample{CPUs: 2, CPUTotal: 10000, CPUIdle: 8500}
+	cur := &Sample{CPUs: 2, CPUTotal: 10200, CPUIdle: 8550, MemoryTotal: 4000, MemoryAvailable: 3000, NetRxBytes: 42}
+	st := NewStats("default", prev, cur)
+	assert.Equal(t, st.CPUPercent, 150.0)
+	assert.Equal(t, st.MemoryUsed, uint64(1000))
+	assert.Equal(t, st.MemoryPercent, 25.0)
+	assert.Equal(t, st.NetRxBytes, uint64(42))
+
+	// the guest was rebooted
+	st = NewStats("default", cur, prev)
+	assert.Equal(t, st.CPUPercent, 0.0)
+}
+
+func TestParseProcess(t *testing.T) {
+	line := "1234 (my (weird) cmd) S 1 1234 1234 0 -1 4194560 100 0 0 0 150 50 0 0 20 0 1 0 100 10000000 256 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0\t" +
+		"0::/system.slice/docker-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.scope"
+	pid, p, err := parseProcess(line, 4096)
+	assert.NilError(t, err)
+	assert.Equal(t, pid, 1234)
+	assert.DeepEqual(t, p, ProcessSample{
+		Command:   "my (weird) cmd",
+		CPUTime:   200,
+		RSS:       256 * 4096,
+		Container: "0123456789ab",
+	})
+
+	_, _, err = parseProcess("1234 (truncated", 4096)
+	assert.ErrorContains(t, err, "unexpected stat")
+}
+
+func TestContainerFromCgroup(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	assert.Equal(t, containerFromCgroup("0::/system.slice/docker-"+id+".scope"), "0123456789ab")
+	assert.Equal(t, containerFromCgroup("0::/default/"+id), "0123456789ab")
+	assert.Equal(t, containerFromCgroup("0::/kubepods/besteffort/pod1234/"+id), "0123456789ab")
+	assert.Equal(t, containerFromCgroup("0::/user.slice/user-501.slice/session-1.scope"), "")
+	assert.Equal(t, containerFromCgroup(""), "")
+}
+
+func TestNewStatsProcesses(t *testing.T) {
+	prev := &Sample{CPUs: 2, CPUTotal: 10000, CPUIdle: 8500, Processes: map[int]ProcessSample{
+		1: {Command: "init", CPUTime: 10},
+		2: {Command: "busy", CPUTime: 100},
+		3: {Command: "old", CPUTime: 500},
+	}}
+	cur := &Sample{CPUs: 2, CPUTotal: 10200, CPUIdle: 8550, MemoryTotal: 4096, Processes: map[int]ProcessSample{
+		1: {Command: "init", CPUTime: 10, RSS: 2048},
+		2: {Command: "busy", CPUTime: 200, RSS: 1024},
+		3: {Command: "new", CPUTime: 5},
+	}}
+	st := NewStats("default", prev, cur)
+	assert.NilError(t, st.SortProcesses("cpu", 2))
+	assert.DeepEqual(t, st.Processes, []ProcessStats{
+		{PID: 2, Command: "busy", CPUPercent: 100, MemoryRSS: 1024, MemoryPercent: 25},
+		{PID: 1, Command: "init", MemoryRSS: 2048, MemoryPercent: 50},
+	})
+
+	assert.NilError(t, st.SortProcesses("memory", 1))
+	assert.Equal(t, st.Processes[0].PID, 1)
+	assert.ErrorContains(t, st.SortProcesses("pid", 1), "unsupported sort key")
+}
+
+func TestNewStatsHostCPU(t *testing.T) {
+	now := time.Now()
+	prev := &Sample{Time: now, HostCPUTime: 10 * time.Second}
+	cur := &Sample{Time: now.Add(2 * time.Second), HostCPUTime: 11 * time.Second}
+	st := NewStats("default", prev, cur)
+	assert.Equal(t, st.HostCPUPercent, 50.0)
+
+	// the host CPU time could not be read
+	st = NewStats("default", &Sample{Time: now}, cur)
+	assert.Equal(t, st.HostCPUPercent, 0.0)
+}
+
+func TestParsePsCPUTime(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"0:01.23":         1230 * time.Millisecond,
+		"  12:34.00\n":    12*time.Minute + 34*time.Second,
+		"01:02:03":        time.Hour + 2*time.Minute + 3*time.Second,
+		"2-01:02:03":      49*time.Hour + 2*time.Minute + 3*time.Second,
+		"1-00:00:00.50\n": 24*time.Hour + 500*time.Millisecond,
+	} {
+		d, err := parsePsCPUTime(s)
+		assert.NilError(t, err, s)
+		assert.Equal(t, d, expected, s)
+	}
+	_, err := parsePsCPUTime("invalid")
+	assert.ErrorContains(t, err, "unexpected cputime")
+}
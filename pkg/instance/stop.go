@@ -13,11 +13,12 @@ import (
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/sirupsen/logrus"
 )
 
 func StopGracefully(inst *store.Instance) error {
-	if inst.Status != store.StatusRunning {
+	if inst.Status != store.StatusRunning && inst.Status != store.StatusCrashed {
 		return fmt.Errorf("expected status %q, got %q (maybe use `limactl stop -f`?)", store.StatusRunning, inst.Status)
 	}
 
@@ -91,6 +92,30 @@ func StopForcibly(inst *store.Instance) {
 	} else {
 		logrus.Info("The host agent process seems already stopped")
 	}
+	if err := metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		m.HostAgentPID = 0
+		m.SSHAddress = ""
+		m.SSHLocalPort = 0
+		return nil
+	}); err != nil {
+		logrus.Error(err)
+	}
+
+	// Kill the virtiofsd processes left behind by the host agent
+	vhostPIDFiles, _ := filepath.Glob(filepath.Join(inst.Dir, strings.ReplaceAll(filenames.VhostPID, "%d", "*")))
+	for _, pidFile := range vhostPIDFiles {
+		pid, err := store.ReadPIDFile(pidFile)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		if pid > 0 {
+			logrus.Infof("Sending SIGKILL to the virtiofsd process %d", pid)
+			if err := osutil.SysKill(pid, osutil.SigKill); err != nil {
+				logrus.Error(err)
+			}
+		}
+	}
 
 	suffixesToBeRemoved := []string{".pid", ".sock", ".tmp"}
 	globPatterns := strings.ReplaceAll(strings.Join(suffixesToBeRemoved, " "), ".", "*.")
@@ -0,0 +1,169 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/localpathutil"
+	"github.com/lima-vm/lima/pkg/nativeimgutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// storageFiles are the files stored in the storage directory of the instance (see store.StorageDir).
+var storageFiles = []string{filenames.BaseDisk, filenames.DiffDisk, filenames.VzSnapshotsDir}
+
+// ensureStorageDir creates the storage directory of the instance, when `storage.dir` is set.
+// `storage.dir` itself is not created, so that the disk images are not written to the mount point
+// of a volume that is not mounted.
+func ensureStorageDir(inst *store.Instance) error {
+	storageDir := store.StorageDir(inst.Dir, inst.Config)
+	if storageDir == inst.Dir {
+		return nil
+	}
+	root := filepath.Dir(storageDir)
+	st, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("storage directory %q is not accessible (is the volume mounted?): %w", root, err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("storage directory %q is not a directory", root)
+	}
+	return os.MkdirAll(storageDir, 0o700)
+}
+
+// MoveStorage moves the disk images of the stopped instance into "<dir>/<INSTANCE>", and saves dir as `storage.dir`.
+// When dir is empty, the disk images are moved back into the instance directory.
+func MoveStorage(_ context.Context, inst *store.Instance, dir string) error {
+	if inst.Status != store.StatusStopped {
+		return fmt.Errorf("expected status %q, got %q (hint: stop the instance with `limactl stop %s`)", store.StatusStopped, inst.Status, inst.Name)
+	}
+	if inst.Config == nil {
+		return errors.New("the configuration of the instance is not loaded")
+	}
+	if inst.VMType == limayaml.WSL2 {
+		return errors.New("vmType wsl2 does not support `storage.dir`")
+	}
+	oldDir := store.StorageDir(inst.Dir, inst.Config)
+	newDir := inst.Dir
+	if dir != "" {
+		expanded, err := localpathutil.Expand(dir)
+		if err != nil {
+			return err
+		}
+		resolved, err := filepath.EvalSymlinks(expanded)
+		if err != nil {
+			return fmt.Errorf("storage directory %q is not accessible (is the volume mounted?): %w", dir, err)
+		}
+		if st, err := os.Stat(resolved); err != nil {
+			return err
+		} else if !st.IsDir() {
+			return fmt.Errorf("storage directory %q is not a directory", dir)
+		}
+		dir = expanded
+		newDir = filepath.Join(resolved, inst.Name)
+	}
+	if newDir == oldDir {
+		logrus.Infof("The disk images of instance %q are already in %q", inst.Name, newDir)
+		return nil
+	}
+	if newDir != inst.Dir {
+		if _, err := os.Stat(newDir); !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%q already exists", newDir)
+		}
+		if err := os.Mkdir(newDir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	var moved, copied []string
+	rollback := func() {
+		for _, f := range moved {
+			if err := os.Rename(filepath.Join(newDir, f), filepath.Join(oldDir, f)); err != nil {
+				logrus.WithError(err).Warnf("Failed to move %q back to %q", f, oldDir)
+			}
+		}
+		for _, f := range copied {
+			_ = os.RemoveAll(filepath.Join(newDir, f))
+		}
+		if newDir != inst.Dir {
+			_ = os.Remove(newDir)
+		}
+	}
+	for _, f := range storageFiles {
+		src, dst := filepath.Join(oldDir, f), filepath.Join(newDir, f)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		logrus.Infof("Moving %q to %q", src, dst)
+		if err := os.Rename(src, dst); err == nil {
+			moved = append(moved, f)
+			continue
+		}
+		// The directories are on different volumes
+		copied = append(copied, f)
+		if err := copySparseTree(src, dst); err != nil {
+			rollback()
+			return fmt.Errorf("failed to copy %q to %q: %w", src, dst, err)
+		}
+	}
+	// The backing file of a qcow2 diffdisk is the absolute path of the basedisk in the old directory
+	diffDisk := filepath.Join(newDir, filenames.DiffDisk)
+	if _, err := os.Stat(diffDisk); err == nil {
+		if err := nativeimgutil.RelativizeBackingFile(diffDisk); err != nil {
+			rollback()
+			return err
+		}
+	}
+	if err := updateYAML(inst, fmt.Sprintf(".storage.dir = %q", dir)); err != nil {
+		rollback()
+		return err
+	}
+	for _, f := range copied {
+		if err := os.RemoveAll(filepath.Join(oldDir, f)); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove %q", filepath.Join(oldDir, f))
+		}
+	}
+	if oldDir != inst.Dir {
+		// Fails when the directory contains unknown files, which are left as they are
+		_ = os.Remove(oldDir)
+	}
+	return nil
+}
+
+// copySparseTree copies the file or the directory src to dst, keeping the files sparse.
+func copySparseTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !d.Type().IsRegular() {
+			logrus.Warnf("Not copying %q (type %s)", path, d.Type())
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return writeSparseFile(f, target, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,58 @@
+package instance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestMoveStorage(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir, err := store.InstanceDir("moved")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(filepath.Join(instDir, filenames.VzSnapshotsDir, "snap1"), 0o700))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), []byte("vmType: qemu\nimages: [{location: /dev/null}]\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.BaseDisk), []byte("base"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), []byte("diff"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.VzSnapshotsDir, "snap1", filenames.DiffDisk), []byte("snap"), 0o644))
+
+	// resolve /var -> /private/var on macOS
+	volume, err := filepath.EvalSymlinks(t.TempDir())
+	assert.NilError(t, err)
+	inst, err := store.Inspect("moved")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, MoveStorage(context.Background(), inst, filepath.Join(volume, "not-mounted")), "is the volume mounted?")
+	assert.NilError(t, MoveStorage(context.Background(), inst, volume))
+
+	inst, err = store.Inspect("moved")
+	assert.NilError(t, err)
+	assert.Equal(t, *inst.Config.Storage.Dir, volume)
+	storageDir := store.StorageDir(inst.Dir, inst.Config)
+	assert.Equal(t, storageDir, filepath.Join(volume, "moved"))
+	b, err := os.ReadFile(filepath.Join(storageDir, filenames.DiffDisk))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "diff")
+	b, err = os.ReadFile(filepath.Join(storageDir, filenames.VzSnapshotsDir, "snap1", filenames.DiffDisk))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "snap")
+	_, err = os.Stat(filepath.Join(instDir, filenames.BaseDisk))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(instDir, filenames.LimaYAML))
+	assert.NilError(t, err)
+
+	// move back into the instance directory
+	assert.NilError(t, MoveStorage(context.Background(), inst, ""))
+	inst, err = store.Inspect("moved")
+	assert.NilError(t, err)
+	assert.Equal(t, store.StorageDir(inst.Dir, inst.Config), instDir)
+	b, err = os.ReadFile(filepath.Join(instDir, filenames.BaseDisk))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "base")
+	_, err = os.Stat(storageDir)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,69 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/sirupsen/logrus"
+)
+
+// Suspend saves the state of the running instance to the disk, and stops the instance without shutting down the guest.
+// The state is restored by the next start of the instance.
+func Suspend(ctx context.Context, inst *store.Instance) error {
+	if inst.Status != store.StatusRunning {
+		return fmt.Errorf("expected status %q, got %q", store.StatusRunning, inst.Status)
+	}
+	if caps, ok := limayaml.LookupDriverCapabilities(inst.VMType); ok && !caps.Suspend {
+		return fmt.Errorf("vmType %s does not support suspending the instance", inst.VMType)
+	}
+	haClient, err := hostagentclient.NewHostAgentClient(filepath.Join(inst.Dir, filenames.HostAgentSock))
+	if err != nil {
+		return err
+	}
+
+	begin := time.Now() // used for logrus propagation
+	logrus.Info("Saving the state of the VM (this may take a while, depending on the memory size)")
+	if err := haClient.Suspend(ctx); err != nil {
+		return err
+	}
+	history.Record(inst.Dir, history.Entry{Event: history.EventSuspend})
+
+	logrus.Info("Waiting for the host agent and the driver processes to shut down")
+	return waitForHostAgentTermination(ctx, inst, begin)
+}
+
+// TakeSuspended returns the state of the suspension recorded by Suspend, and clears it from the metadata.
+// Returns nil when the instance has not been suspended.
+func TakeSuspended(inst *store.Instance) (*metadata.Suspended, error) {
+	var suspended *metadata.Suspended
+	err := metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		suspended = m.Suspended
+		m.Suspended = nil
+		return nil
+	})
+	return suspended, err
+}
+
+// DiscardSuspendedState removes the VM state saved by Suspend, so that the next start boots the VM from scratch.
+func DiscardSuspendedState(inst *store.Instance) error {
+	if inst.Status != store.StatusSuspended {
+		return fmt.Errorf("expected status %q, got %q", store.StatusSuspended, inst.Status)
+	}
+	path := store.SuspendStatePath(inst.Dir, inst.Config)
+	logrus.Infof("Discarding the saved state of the VM %q", path)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	_, err := TakeSuspended(inst)
+	return err
+}
@@ -0,0 +1,35 @@
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"gotest.tools/v3/assert"
+)
+
+func TestDiscardSuspendedState(t *testing.T) {
+	inst := &store.Instance{Name: "suspended", Dir: t.TempDir(), Status: store.StatusSuspended}
+	statePath := filepath.Join(inst.Dir, filenames.SuspendState)
+	assert.NilError(t, os.WriteFile(statePath, []byte("state"), 0o644))
+	tunnels := []metadata.Tunnel{{Name: "socks", Type: TunnelSOCKS, Local: "127.0.0.1:1080"}}
+	assert.NilError(t, metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		m.Suspended = &metadata.Suspended{Time: time.Now(), Tunnels: tunnels}
+		return nil
+	}))
+
+	assert.NilError(t, DiscardSuspendedState(inst))
+	_, err := os.Stat(statePath)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist), err)
+	suspended, err := TakeSuspended(inst)
+	assert.NilError(t, err)
+	assert.Assert(t, suspended == nil)
+
+	inst.Status = store.StatusStopped
+	assert.ErrorContains(t, DiscardSuspendedState(inst), `expected status "Suspended"`)
+}
@@ -0,0 +1,185 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/networks/usernet"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TunnelSOCKS is a SOCKS proxy served by `ssh -D`.
+	TunnelSOCKS = "socks"
+	// TunnelUDP is a UDP port forwarded by the gvisor-tap-vsock usernet.
+	TunnelUDP = "udp"
+)
+
+// ErrTunnelNotFound is returned when the tunnel does not exist.
+var ErrTunnelNotFound = errors.New("tunnel not found")
+
+// Tunnels returns the tunnels of the instance.
+func Tunnels(inst *store.Instance) ([]metadata.Tunnel, error) {
+	m, err := metadata.Read(inst.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return m.Tunnels, nil
+}
+
+// CheckTunnelName returns an error if the instance already has a tunnel named name.
+func CheckTunnelName(inst *store.Instance, name string) error {
+	tunnels, err := Tunnels(inst)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(tunnels, func(t metadata.Tunnel) bool { return t.Name == name }) {
+		return fmt.Errorf("tunnel %q already exists in instance %q", name, inst.Name)
+	}
+	return nil
+}
+
+// AddTunnel registers the tunnel in the metadata of the instance.
+// Fails if a tunnel with the same name already exists.
+func AddTunnel(inst *store.Instance, t metadata.Tunnel) error {
+	return metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		if slices.ContainsFunc(m.Tunnels, func(x metadata.Tunnel) bool { return x.Name == t.Name }) {
+			return fmt.Errorf("tunnel %q already exists in instance %q", t.Name, inst.Name)
+		}
+		m.Tunnels = append(m.Tunnels, t)
+		return nil
+	})
+}
+
+// StartUDPTunnel forwards the UDP port on 127.0.0.1 of the host to the UDP port of the guest,
+// using the gvisor-tap-vsock usernet that provides the network of the instance.
+func StartUDPTunnel(ctx context.Context, inst *store.Instance, name string, hostPort, guestPort int) (*metadata.Tunnel, error) {
+	if err := CheckTunnelName(inst, name); err != nil {
+		return nil, err
+	}
+	client, err := usernetClient(inst)
+	if err != nil {
+		return nil, err
+	}
+	guestIP, err := client.ResolveIPAddress(ctx, limayaml.MACAddress(inst.Dir))
+	if err != nil {
+		return nil, err
+	}
+	t := metadata.Tunnel{
+		Name:   name,
+		Type:   TunnelUDP,
+		Local:  net.JoinHostPort("127.0.0.1", strconv.Itoa(hostPort)),
+		Remote: net.JoinHostPort(guestIP, strconv.Itoa(guestPort)),
+	}
+	if err := client.ExposeUDP(t.Local, t.Remote); err != nil {
+		return nil, fmt.Errorf("failed to forward %s/udp to %s/udp: %w", t.Local, t.Remote, err)
+	}
+	if err := AddTunnel(inst, t); err != nil {
+		if unexposeErr := client.UnexposeUDP(t.Local); unexposeErr != nil {
+			logrus.WithError(unexposeErr).Warnf("Failed to stop forwarding %s/udp", t.Local)
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// StopTunnel stops the tunnel of the instance, and unregisters it.
+func StopTunnel(inst *store.Instance, name string) error {
+	var t metadata.Tunnel
+	if err := metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		i := slices.IndexFunc(m.Tunnels, func(x metadata.Tunnel) bool { return x.Name == name })
+		if i < 0 {
+			return fmt.Errorf("%w: %q in instance %q", ErrTunnelNotFound, name, inst.Name)
+		}
+		t = m.Tunnels[i]
+		m.Tunnels = slices.Delete(m.Tunnels, i, i+1)
+		return nil
+	}); err != nil {
+		return err
+	}
+	return stopTunnel(inst, &t)
+}
+
+// StopTunnels stops all the tunnels of the instance, e.g., when the host agent exits.
+// The errors are logged, as the tunnels may have been already gone with the instance.
+func StopTunnels(inst *store.Instance) {
+	var tunnels []metadata.Tunnel
+	if err := metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		tunnels = m.Tunnels
+		m.Tunnels = nil
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Warnf("Failed to update the metadata of instance %q", inst.Name)
+		return
+	}
+	for _, t := range tunnels {
+		if err := stopTunnel(inst, &t); err != nil {
+			logrus.WithError(err).Debugf("Failed to stop tunnel %q", t.Name)
+		}
+	}
+}
+
+func stopTunnel(inst *store.Instance, t *metadata.Tunnel) error {
+	switch t.Type {
+	case TunnelSOCKS:
+		_ = os.RemoveAll(filepath.Join(inst.Dir, fmt.Sprintf(filenames.TunnelLog, t.Name)))
+		if t.PID == 0 {
+			return nil
+		}
+		exists, err := store.ProcessExists(t.PID)
+		if err != nil || !exists {
+			return err
+		}
+		return osutil.SysKill(t.PID, osutil.SigInt)
+	case TunnelUDP:
+		client, err := usernetClient(inst)
+		if err != nil {
+			return err
+		}
+		return client.UnexposeUDP(t.Local)
+	default:
+		return fmt.Errorf("unknown tunnel type %q", t.Type)
+	}
+}
+
+// usernetClient returns the client of the gvisor-tap-vsock that provides the network of the instance:
+// either the shared network of `networks: [{lima: user-v2}]`, or the one running in the host agent
+// (always for VZ, and for QEMU with `egressPolicy` or `metadataService`).
+func usernetClient(inst *store.Instance) (*usernet.Client, error) {
+	if inst.Config == nil {
+		return nil, errors.New("the configuration of the instance is not loaded")
+	}
+	if i := limayaml.FirstUsernetIndex(inst.Config); i != -1 {
+		nwName := inst.Config.Networks[i].Lima
+		client := usernet.NewClientByName(nwName)
+		if client == nil {
+			return nil, fmt.Errorf("failed to connect to network %q", nwName)
+		}
+		return client, nil
+	}
+	endpointSock, err := usernet.SockWithDirectory(inst.Dir, "", usernet.EndpointSock)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(endpointSock); err != nil {
+		return nil, fmt.Errorf("instance %q is not connected to a usernet (gvisor-tap-vsock) network; "+
+			"add `networks: [{lima: user-v2}]` to the instance: %w", inst.Name, err)
+	}
+	subnetIP, _, err := net.ParseCIDR(networks.SlirpNetwork)
+	if err != nil {
+		return nil, err
+	}
+	return usernet.NewClient(endpointSock, subnetIP), nil
+}
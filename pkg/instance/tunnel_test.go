@@ -0,0 +1,35 @@
+package instance
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"gotest.tools/v3/assert"
+)
+
+func TestTunnels(t *testing.T) {
+	inst := &store.Instance{Name: "tunnels", Dir: t.TempDir()}
+	assert.NilError(t, AddTunnel(inst, metadata.Tunnel{Name: "socks", Type: TunnelSOCKS, Local: "127.0.0.1:1080"}))
+	assert.NilError(t, AddTunnel(inst, metadata.Tunnel{Name: "socks2", Type: TunnelSOCKS, Local: "127.0.0.1:1081"}))
+	assert.ErrorContains(t, AddTunnel(inst, metadata.Tunnel{Name: "socks", Type: TunnelSOCKS, Local: "127.0.0.1:1082"}), "already exists")
+	assert.ErrorContains(t, CheckTunnelName(inst, "socks2"), "already exists")
+	assert.NilError(t, CheckTunnelName(inst, "udp-53"))
+
+	tunnels, err := Tunnels(inst)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tunnels), 2)
+
+	assert.NilError(t, StopTunnel(inst, "socks"))
+	err = StopTunnel(inst, "socks")
+	assert.Assert(t, errors.Is(err, ErrTunnelNotFound), err)
+	tunnels, err = Tunnels(inst)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, tunnels, []metadata.Tunnel{{Name: "socks2", Type: TunnelSOCKS, Local: "127.0.0.1:1081"}})
+
+	StopTunnels(inst)
+	tunnels, err = Tunnels(inst)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tunnels), 0)
+}
@@ -0,0 +1,119 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/driver"
+	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/yqutil"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangeCPUs changes the number of the CPUs of the instance, and saves it in lima.yaml.
+// The CPUs of a running instance are hot-plugged, up to `maxCPUs`, if the driver supports it;
+// otherwise an error is returned, as a restart is required.
+func ChangeCPUs(ctx context.Context, inst *store.Instance, cpus int) error {
+	if cpus <= 0 {
+		return fmt.Errorf("the number of CPUs must be positive, got %d", cpus)
+	}
+	if inst.Config == nil {
+		return errors.New("the configuration of the instance is not loaded")
+	}
+	if inst.Status == store.StatusSuspended {
+		return fmt.Errorf("cannot change the CPUs of suspended instance %q, as the saved state depends on them (hint: run `limactl resume %s` first)",
+			inst.Name, inst.Name)
+	}
+	if inst.Status == store.StatusRunning && cpus != inst.CPUs {
+		caps, ok := limayaml.LookupDriverCapabilities(inst.VMType)
+		if !ok || !slices.Contains(caps.CPUHotplugArches, inst.Arch) {
+			return fmt.Errorf("vmType %s does not support changing the CPUs of a running %s instance; "+
+				"a restart is required: run `limactl stop %s && limactl edit --cpus %d %s && limactl start %s`",
+				inst.VMType, inst.Arch, inst.Name, cpus, inst.Name, inst.Name)
+		}
+		if inst.Config.MaxCPUs == nil || cpus > *inst.Config.MaxCPUs {
+			maxCPUs := inst.CPUs
+			if inst.Config.MaxCPUs != nil {
+				maxCPUs = *inst.Config.MaxCPUs
+			}
+			return fmt.Errorf("cannot increase the CPUs of the running instance beyond `maxCPUs` (%d); "+
+				"a restart is required: run `limactl stop %s && limactl edit --set '.maxCPUs = %d' --cpus %d %s && limactl start %s`",
+				maxCPUs, inst.Name, cpus, cpus, inst.Name, inst.Name)
+		}
+		limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+			Instance: inst,
+		})
+		if err := limaDriver.ChangeCPUs(ctx, cpus); err != nil {
+			return err
+		}
+	}
+
+	if err := updateYAML(inst, fmt.Sprintf(".cpus = %d", cpus)); err != nil {
+		return err
+	}
+	if inst.Status != store.StatusRunning {
+		logrus.Infof("The CPUs of instance %q will be changed to %d on the next start", inst.Name, cpus)
+	}
+	return nil
+}
+
+// ResizeDisk grows the disk of the stopped instance, and saves the size in lima.yaml.
+// The partition and the filesystem of the root disk are grown by cloud-init (growpart) on the next boot.
+func ResizeDisk(ctx context.Context, inst *store.Instance, sizeStr string) error {
+	size, err := units.RAMInBytes(sizeStr)
+	if err != nil {
+		return err
+	}
+	if inst.Config == nil {
+		return errors.New("the configuration of the instance is not loaded")
+	}
+	if inst.Status == store.StatusRunning || inst.Status == store.StatusSuspended {
+		return fmt.Errorf("cannot resize the disk of %s instance %q. Please stop the VM instance", strings.ToLower(inst.Status), inst.Name)
+	}
+	if size < inst.Disk {
+		return fmt.Errorf("specified size %q is less than the current disk size %q. Disk shrinking is currently unavailable",
+			units.BytesSize(float64(size)), units.BytesSize(float64(inst.Disk)))
+	}
+	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
+		Instance: inst,
+	})
+	if err := limaDriver.ResizeDisk(ctx, size); err != nil {
+		return fmt.Errorf("failed to resize the disk of instance %q: %w", inst.Name, err)
+	}
+	return updateYAML(inst, fmt.Sprintf(".disk = %q", sizeStr))
+}
+
+// updateYAML evaluates the yq expression against lima.yaml of the instance, and saves it after the validation.
+func updateYAML(inst *store.Instance, expr string) error {
+	filePath := filepath.Join(inst.Dir, filenames.LimaYAML)
+	yContent, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	yBytes, err := yqutil.EvaluateExpression(expr, yContent)
+	if err != nil {
+		return err
+	}
+	y, err := limayaml.Load(yBytes, filePath)
+	if err != nil {
+		return err
+	}
+	if err := limayaml.Validate(y, false); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, yBytes, 0o644); err != nil {
+		return err
+	}
+	history.RecordEdit(inst.Dir, yContent, yBytes, expr)
+	return nil
+}
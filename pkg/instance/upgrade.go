@@ -0,0 +1,185 @@
+package instance
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/lima-vm/lima/pkg/cidata"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/lima-vm/lima/pkg/upgrade"
+	"github.com/lima-vm/lima/pkg/usrlocalsharelima"
+	"github.com/lima-vm/lima/pkg/version"
+	"github.com/sirupsen/logrus"
+)
+
+// UpgradeResult is the result of Upgrade.
+type UpgradeResult struct {
+	// PreviousVersion is the version of Lima recorded in the metadata before the upgrade.
+	// Empty for the instances created with Lima prior to v0.20.
+	PreviousVersion string
+	// BackupDir is the directory of the files backed up by MigrateLayouts, or empty if no layout was migrated.
+	BackupDir string
+	// GuestAgentUpgraded is true when the guest agent of the running instance was replaced.
+	GuestAgentUpgraded bool
+	// Pending is the list of the upgrades that take effect on the next start of the instance.
+	Pending []string
+}
+
+// UpgradeNeeded returns true if inst was created or last upgraded with another version of Lima,
+// has legacy layouts, or is running an outdated guest agent.
+func UpgradeNeeded(inst *store.Instance) (bool, error) {
+	md, err := metadata.Read(inst.Dir)
+	if err != nil {
+		return false, err
+	}
+	if md.LimaVersion != version.Version {
+		return true, nil
+	}
+	layouts, err := DetectLegacyLayouts(inst)
+	if err != nil {
+		return false, err
+	}
+	if len(layouts) > 0 {
+		return true, nil
+	}
+	return upgrade.OutdatedGuestAgent(inst)
+}
+
+// Upgrade upgrades the instance created or last upgraded with another version of Lima to the current version.
+//
+// The legacy layouts are migrated with MigrateLayouts (which requires the instance to be stopped, if any),
+// the cloud-config is regenerated, and the guest agent of the running instance is replaced over SSH.
+// The guest agent of the stopped instance, the cidata, and the nerdctl archive are upgraded by the boot scripts
+// on the next start. Then the current version is recorded in the metadata as `limaVersion`.
+func Upgrade(ctx context.Context, inst *store.Instance) (*UpgradeResult, error) {
+	md, err := metadata.Read(inst.Dir)
+	if err != nil {
+		return nil, err
+	}
+	res := &UpgradeResult{PreviousVersion: md.LimaVersion}
+
+	layouts, err := DetectLegacyLayouts(inst)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layouts {
+		if l.Manual != "" {
+			return nil, fmt.Errorf("instance %q needs to be migrated by hand (%s): %s", inst.Name, l.Description, l.Manual)
+		}
+	}
+	res.BackupDir, err = MigrateLayouts(inst, layouts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload lima.yaml, as it may have been modified by MigrateLayouts
+	inst, err = store.Inspect(inst.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(inst.Errors) > 0 {
+		return nil, fmt.Errorf("instance %q has errors: %w", inst.Name, errors.Join(inst.Errors...))
+	}
+	if err := cidata.GenerateCloudConfig(inst.Dir, inst.Name, inst.Config); err != nil {
+		return nil, err
+	}
+
+	if inst.Status == store.StatusRunning {
+		outdated, err := upgrade.OutdatedGuestAgent(inst)
+		if err != nil {
+			return nil, err
+		}
+		if outdated {
+			if err := upgradeGuestAgent(ctx, inst); err != nil {
+				return nil, err
+			}
+			res.GuestAgentUpgraded = true
+		}
+		if *inst.Config.Containerd.System || *inst.Config.Containerd.User {
+			res.Pending = append(res.Pending, "nerdctl and containerd are upgraded on the next start, as upgrading them stops the running containers")
+		}
+		res.Pending = append(res.Pending, "the cidata is regenerated on the next start")
+	}
+
+	if err := metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		m.LimaVersion = version.Version
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if res.PreviousVersion != version.Version {
+		prev := res.PreviousVersion
+		if prev == "" {
+			prev = "(unknown)"
+		}
+		history.Record(inst.Dir, history.Entry{Event: history.EventUpgrade, Message: fmt.Sprintf("%s -> %s", prev, version.Version)})
+	}
+	return res, nil
+}
+
+// upgradeGuestAgent replaces the guest agent binary of the running instance with the one installed on the host,
+// and restarts the guest agent service. The instance must allow sudo (`security.sudo: full`).
+func upgradeGuestAgent(ctx context.Context, inst *store.Instance) error {
+	if *inst.Config.Security.Sudo != limayaml.SudoFull {
+		return fmt.Errorf("cannot upgrade the guest agent in the running instance %q, as `security.sudo` is %q; "+
+			"the boot script upgrades it on `limactl restart %s`", inst.Name, *inst.Config.Security.Sudo, inst.Name)
+	}
+	guestAgentBinary, err := usrlocalsharelima.GuestAgentBinary(*inst.Config.OS, *inst.Config.Arch)
+	if err != nil {
+		return err
+	}
+	var guestAgent io.ReadCloser
+	guestAgent, err = os.Open(guestAgentBinary)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		compressedGuestAgent, err := os.Open(guestAgentBinary + ".gz")
+		if err != nil {
+			return err
+		}
+		defer compressedGuestAgent.Close()
+		guestAgent, err = gzip.NewReader(compressedGuestAgent)
+		if err != nil {
+			return err
+		}
+	}
+	defer guestAgent.Close()
+
+	// Same as the boot script 25-guestagent-base.sh
+	dst := shellescape.Quote(path.Join(*inst.Config.GuestInstallPrefix, "bin", "lima-guestagent"))
+	script := fmt.Sprintf(`set -eu
+cat >%[1]s.new
+chmod 755 %[1]s.new
+mv -f %[1]s.new %[1]s
+if [ -f /sbin/openrc-run ]; then
+	rc-service lima-guestagent restart
+else
+	systemctl restart lima-guestagent
+fi`, dst)
+	logrus.Infof("Upgrading the guest agent of instance %q", inst.Name)
+	if _, err := execGuestCommand(ctx, inst, guestAgent, "sudo", "sh", "-c", shellescape.Quote(script)); err != nil {
+		return fmt.Errorf("failed to upgrade the guest agent of instance %q: %w", inst.Name, err)
+	}
+	// The cidata still contains the old guest agent until the next start, but the running guest agent is up to date.
+	// Update the modification time so that upgrade.OutdatedGuestAgent no longer reports the instance.
+	now := time.Now()
+	for _, f := range []string{filenames.CIDataISO, filenames.CIDataISODir} {
+		if err := os.Chtimes(filepath.Join(inst.Dir, f), now, now); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.WithError(err).Warnf("Failed to update the modification time of %q", f)
+		}
+	}
+	return nil
+}
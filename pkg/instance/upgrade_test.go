@@ -0,0 +1,58 @@
+package instance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/history"
+	"github.com/lima-vm/lima/pkg/store/metadata"
+	"github.com/lima-vm/lima/pkg/version"
+	"gotest.tools/v3/assert"
+)
+
+func TestUpgrade(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir, err := store.InstanceDir("old")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(instDir, 0o700))
+	yContent := `vmType: qemu
+images: [{location: /dev/null}]
+user: {name: lima, uid: 1000}
+`
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), []byte(yContent), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), []byte("diff"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaVersion), []byte("0.23.0\n"), 0o444))
+
+	inst, err := store.Inspect("old")
+	assert.NilError(t, err)
+	needed, err := UpgradeNeeded(inst)
+	assert.NilError(t, err)
+	assert.Assert(t, needed)
+
+	res, err := Upgrade(context.Background(), inst)
+	assert.NilError(t, err)
+	assert.Equal(t, res.PreviousVersion, "0.23.0")
+	assert.Assert(t, res.BackupDir != "")
+	assert.Assert(t, !res.GuestAgentUpgraded)
+	_, err = os.Stat(filepath.Join(instDir, filenames.CloudConfig))
+	assert.NilError(t, err)
+
+	md, err := metadata.Read(instDir)
+	assert.NilError(t, err)
+	assert.Equal(t, md.LimaVersion, version.Version)
+	entries, err := history.Read(instDir)
+	assert.NilError(t, err)
+	assert.Equal(t, entries[len(entries)-1].Event, history.EventUpgrade)
+
+	// the legacy default of mountType is pinned
+	inst, err = store.Inspect("old")
+	assert.NilError(t, err)
+	assert.Equal(t, *inst.Config.MountType, "reverse-sshfs")
+	needed, err = UpgradeNeeded(inst)
+	assert.NilError(t, err)
+	assert.Assert(t, !needed)
+}
@@ -0,0 +1,196 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// WaitCondition is a condition for Wait, e.g., "running", "ssh", "guest-agent", "probe:NAME", or "port:PORT".
+type WaitCondition struct {
+	// Kind is one of "running", "ssh", "guest-agent", "probe", and "port"
+	Kind string
+	// Probe is the name of the readiness probe for the "probe" kind
+	Probe string
+	// Port is the TCP port in the guest for the "port" kind
+	Port int
+}
+
+func (c WaitCondition) String() string {
+	switch c.Kind {
+	case "probe":
+		return "probe:" + c.Probe
+	case "port":
+		return "port:" + strconv.Itoa(c.Port)
+	}
+	return c.Kind
+}
+
+// ParseWaitCondition parses a condition for Wait.
+func ParseWaitCondition(s string) (WaitCondition, error) {
+	kind, arg, hasArg := strings.Cut(s, ":")
+	switch kind {
+	case "running", hostagentevents.ReadySSH, hostagentevents.ReadyGuestAgent:
+		if hasArg {
+			return WaitCondition{}, fmt.Errorf("condition %q does not take an argument", kind)
+		}
+		return WaitCondition{Kind: kind}, nil
+	case "probe":
+		if arg == "" {
+			return WaitCondition{}, errors.New("condition \"probe\" requires the name of the probe, e.g., \"probe:NAME\"")
+		}
+		return WaitCondition{Kind: kind, Probe: arg}, nil
+	case "port":
+		port, err := strconv.Atoi(arg)
+		if err != nil || port <= 0 || port > 65535 {
+			return WaitCondition{}, fmt.Errorf("condition \"port\" requires a port number, e.g., \"port:8080\", got %q", arg)
+		}
+		return WaitCondition{Kind: kind, Port: port}, nil
+	}
+	return WaitCondition{}, fmt.Errorf("unknown condition %q, must be one of: running, ssh, guest-agent, probe:NAME, port:PORT", s)
+}
+
+// waitState tracks the host agent events for Wait.
+type waitState struct {
+	running     bool
+	ready       map[string]bool
+	passed      map[string]bool
+	listening   map[hostagentevents.GuestPort]struct{}
+	haStderrLog string
+}
+
+func newWaitState(haStderrLog string) *waitState {
+	st := &waitState{haStderrLog: haStderrLog}
+	st.reset()
+	return st
+}
+
+// reset forgets the state of the previous boot, e.g., when the driver was restarted.
+func (st *waitState) reset() {
+	st.running = false
+	st.ready = make(map[string]bool)
+	st.passed = make(map[string]bool)
+	st.listening = make(map[hostagentevents.GuestPort]struct{})
+}
+
+// onEvent updates the state with the event, and returns an error if the conditions can no longer be met.
+func (st *waitState) onEvent(ev hostagentevents.Event) error {
+	switch {
+	case ev.DriverFailure != nil:
+		if !ev.DriverFailure.Restarting {
+			return fmt.Errorf("the driver failed unexpectedly (%s) (hint: see %q)", ev.DriverFailure.Reason, st.haStderrLog)
+		}
+	case ev.Probe != nil:
+		st.passed[ev.Probe.Name] = ev.Probe.Passed
+	case ev.Ready != "":
+		st.ready[ev.Ready] = true
+	case ev.Unready != "":
+		delete(st.ready, ev.Unready)
+	case ev.GuestPorts != nil:
+		for _, p := range ev.GuestPorts.Removed {
+			delete(st.listening, p)
+		}
+		for _, p := range ev.GuestPorts.Added {
+			st.listening[p] = struct{}{}
+		}
+	case ev.Phase != "", ev.Crash != nil, ev.PortForwardLimit != nil, ev.HostIPChange != nil:
+		// NOP
+	case ev.Status.Exiting:
+		return fmt.Errorf("the instance is shutting down (hint: see %q)", st.haStderrLog)
+	case ev.Status.Running:
+		st.running = true
+	default:
+		// "booting"
+		st.reset()
+	}
+	return nil
+}
+
+// satisfied returns true if the condition is met.
+// An error is returned if the condition can no longer be met.
+func (st *waitState) satisfied(c WaitCondition) (bool, error) {
+	switch c.Kind {
+	case "running":
+		return st.running, nil
+	case "probe":
+		passed, ok := st.passed[c.Probe]
+		if ok && !passed {
+			return false, fmt.Errorf("probe %q failed (hint: see %q)", c.Probe, st.haStderrLog)
+		}
+		if !ok && st.running {
+			return false, fmt.Errorf("probe %q is not defined in the instance", c.Probe)
+		}
+		return passed, nil
+	case "port":
+		for p := range st.listening {
+			if p.Protocol == "tcp" && p.Port == c.Port {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return st.ready[c.Kind], nil
+}
+
+// Wait blocks until all the conditions are met for the running instance, by watching the host agent events.
+// Events since the host agent was started are taken into account too, so the conditions that have been
+// already met are satisfied immediately.
+func Wait(ctx context.Context, inst *store.Instance, conds []WaitCondition, timeout time.Duration) error {
+	if inst.Status != store.StatusRunning {
+		return fmt.Errorf("instance %q is not running (status %q)", inst.Name, inst.Status)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	haStdoutPath := filepath.Join(inst.Dir, filenames.HostAgentStdoutLog)
+	haStderrPath := filepath.Join(inst.Dir, filenames.HostAgentStderrLog)
+	st := newWaitState(haStderrPath)
+	pending := conds
+	var err error
+	onEvent := func(ev hostagentevents.Event) bool {
+		if err = st.onEvent(ev); err != nil {
+			return true
+		}
+		var stillPending []WaitCondition
+		for _, c := range pending {
+			ok, xerr := st.satisfied(c)
+			if xerr != nil {
+				err = xerr
+				return true
+			}
+			if !ok {
+				stillPending = append(stillPending, c)
+			} else {
+				logrus.Debugf("Condition %q is met", c)
+			}
+		}
+		pending = stillPending
+		return len(pending) == 0
+	}
+	if xerr := hostagentevents.Watch(ctx, haStdoutPath, haStderrPath, time.Now(), onEvent); xerr != nil {
+		return xerr
+	}
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		if ctxErr := ctx.Err(); errors.Is(ctxErr, context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %v waiting for %v", timeout, pending)
+		} else if ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("the host agent stopped before meeting the conditions %v", pending)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package instance
+
+import (
+	"testing"
+
+	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseWaitCondition(t *testing.T) {
+	c, err := ParseWaitCondition("ssh")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c, WaitCondition{Kind: "ssh"})
+
+	c, err = ParseWaitCondition("probe:docker")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c, WaitCondition{Kind: "probe", Probe: "docker"})
+	assert.Equal(t, c.String(), "probe:docker")
+
+	c, err = ParseWaitCondition("port:8080")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c, WaitCondition{Kind: "port", Port: 8080})
+
+	_, err = ParseWaitCondition("running:1")
+	assert.ErrorContains(t, err, "does not take an argument")
+	_, err = ParseWaitCondition("probe:")
+	assert.ErrorContains(t, err, "requires the name of the probe")
+	_, err = ParseWaitCondition("port:http")
+	assert.ErrorContains(t, err, "requires a port number")
+	_, err = ParseWaitCondition("stopped")
+	assert.ErrorContains(t, err, "unknown condition")
+}
+
+func TestWaitState(t *testing.T) {
+	st := newWaitState("ha.stderr.log")
+	port := WaitCondition{Kind: "port", Port: 8080}
+	probe := WaitCondition{Kind: "probe", Probe: "docker"}
+
+	assert.NilError(t, st.onEvent(hostagentevents.Event{Status: hostagentevents.Status{SSHLocalPort: 60022}}))
+	assert.NilError(t, st.onEvent(hostagentevents.Event{Ready: hostagentevents.ReadySSH}))
+	ok, err := st.satisfied(WaitCondition{Kind: "ssh"})
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	ok, err = st.satisfied(WaitCondition{Kind: "guest-agent"})
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	// The phases do not reset the state
+	assert.NilError(t, st.onEvent(hostagentevents.Event{Phase: hostagentevents.PhaseOptional}))
+	ok, _ = st.satisfied(WaitCondition{Kind: "ssh"})
+	assert.Assert(t, ok)
+
+	tcp8080 := hostagentevents.GuestPort{Protocol: "tcp", IP: "0.0.0.0", Port: 8080}
+	assert.NilError(t, st.onEvent(hostagentevents.Event{GuestPorts: &hostagentevents.GuestPorts{Added: []hostagentevents.GuestPort{tcp8080}}}))
+	ok, _ = st.satisfied(port)
+	assert.Assert(t, ok)
+	assert.NilError(t, st.onEvent(hostagentevents.Event{GuestPorts: &hostagentevents.GuestPorts{Removed: []hostagentevents.GuestPort{tcp8080}}}))
+	ok, _ = st.satisfied(port)
+	assert.Assert(t, !ok)
+
+	ok, err = st.satisfied(probe)
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+	assert.NilError(t, st.onEvent(hostagentevents.Event{Probe: &hostagentevents.ProbeStatus{Name: "docker", Passed: true}}))
+	ok, _ = st.satisfied(probe)
+	assert.Assert(t, ok)
+
+	assert.NilError(t, st.onEvent(hostagentevents.Event{Status: hostagentevents.Status{Running: true}}))
+	ok, _ = st.satisfied(WaitCondition{Kind: "running"})
+	assert.Assert(t, ok)
+	_, err = st.satisfied(WaitCondition{Kind: "probe", Probe: "undefined"})
+	assert.ErrorContains(t, err, "not defined")
+
+	// restarted by `restartPolicy`
+	assert.NilError(t, st.onEvent(hostagentevents.Event{DriverFailure: &hostagentevents.DriverFailure{Reason: "crash", Restarting: true}}))
+	assert.NilError(t, st.onEvent(hostagentevents.Event{Status: hostagentevents.Status{SSHLocalPort: 60022}}))
+	ok, _ = st.satisfied(WaitCondition{Kind: "running"})
+	assert.Assert(t, !ok)
+	assert.NilError(t, st.onEvent(hostagentevents.Event{Probe: &hostagentevents.ProbeStatus{Name: "docker", Error: "timeout"}}))
+	_, err = st.satisfied(probe)
+	assert.ErrorContains(t, err, "failed")
+
+	assert.ErrorContains(t, st.onEvent(hostagentevents.Event{Status: hostagentevents.Status{Exiting: true}}), "shutting down")
+}
@@ -1,6 +1,7 @@
 package iso9660util
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -17,6 +18,8 @@ type Entry struct {
 	Reader io.Reader
 }
 
+// Write creates an ISO9660 image with Rock Ridge extensions at isoPath.
+// The timestamps of the files are set to Timestamp, so that the same layout always produces the same image.
 func Write(isoPath, label string, layout []Entry) error {
 	if err := os.RemoveAll(isoPath); err != nil {
 		return err
@@ -33,6 +36,7 @@ func Write(isoPath, label string, layout []Entry) error {
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(workdir)
 	if runtime.GOOS == "windows" {
 		// go-embed unfortunately needs unix path
 		workdir = filepath.ToSlash(workdir)
@@ -57,6 +61,9 @@ func Write(isoPath, label string, layout []Entry) error {
 	if err := fs.Finalize(finalizeOptions); err != nil {
 		return err
 	}
+	if err := normalizeTimestamps(isoFile, isoFile); err != nil {
+		return fmt.Errorf("failed to normalize the timestamps in %q: %w", isoPath, err)
+	}
 
 	return isoFile.Close()
 }
@@ -75,6 +82,30 @@ func WriteFile(fs filesystem.FileSystem, pathStr string, r io.Reader) (int64, er
 	return io.Copy(f, r)
 }
 
+// ReadFile reads the file at pathStr in the ISO9660 image.
+func ReadFile(isoPath, pathStr string) ([]byte, error) {
+	isoFile, err := os.Open(isoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer isoFile.Close()
+
+	fileInfo, err := isoFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fs, err := iso9660.Read(isoFile, fileInfo.Size(), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fs.OpenFile(path.Join("/", pathStr), os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
 func IsISO9660(imagePath string) (bool, error) {
 	imageFile, err := os.Open(imagePath)
 	if err != nil {
@@ -0,0 +1,52 @@
+package iso9660util
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReadFile(t *testing.T) {
+	isoPath := filepath.Join(t.TempDir(), "cidata.iso")
+	layout := []Entry{
+		{Path: "meta-data", Reader: strings.NewReader("instance-id: iid\n")},
+		{Path: "provision.system/00000000", Reader: strings.NewReader("#!/bin/sh\n")},
+	}
+	assert.NilError(t, Write(isoPath, "cidata", layout))
+
+	b, err := ReadFile(isoPath, "meta-data")
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "instance-id: iid\n")
+	b, err = ReadFile(isoPath, "provision.system/00000000")
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "#!/bin/sh\n")
+	_, err = ReadFile(isoPath, "user-data")
+	assert.Assert(t, err != nil)
+}
+
+func TestWriteReproducible(t *testing.T) {
+	write := func(isoPath string) []byte {
+		layout := []Entry{
+			{Path: "meta-data", Reader: strings.NewReader("instance-id: iid\n")},
+			{Path: "provision.system/00000000.on-param-change", Reader: strings.NewReader("#!/bin/sh\n")},
+		}
+		assert.NilError(t, Write(isoPath, "cidata", layout))
+		b, err := os.ReadFile(isoPath)
+		assert.NilError(t, err)
+		return b
+	}
+	dir := t.TempDir()
+	first := write(filepath.Join(dir, "first.iso"))
+	time.Sleep(1100 * time.Millisecond)
+	second := write(filepath.Join(dir, "second.iso"))
+	assert.Assert(t, bytes.Equal(first, second), "images differ")
+
+	b, err := ReadFile(filepath.Join(dir, "second.iso"), "provision.system/00000000.on-param-change")
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "#!/bin/sh\n")
+}
@@ -0,0 +1,164 @@
+package iso9660util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Timestamp is the timestamp recorded for all the files in the images created by Write,
+// so that identical layouts produce byte-identical images.
+var Timestamp = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	sectorSize = 2048
+	// pvdSector is the sector of the primary volume descriptor
+	pvdSector = 16
+	// maxDirectoryDepth guards against loops in a corrupted image
+	maxDirectoryDepth = 64
+)
+
+// normalizeTimestamps overwrites the timestamps in the primary volume descriptor, the directory records,
+// and the Rock Ridge "TF" entries with Timestamp.
+//
+// go-diskfs records the current time and the ctime of the workspace files, which cannot be controlled
+// before finalizing the image.
+func normalizeTimestamps(f io.ReaderAt, w io.WriterAt) error {
+	pvd := make([]byte, sectorSize)
+	if _, err := f.ReadAt(pvd, pvdSector*sectorSize); err != nil {
+		return err
+	}
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return fmt.Errorf("primary volume descriptor not found")
+	}
+	// creation, modification, expiration, and effective dates
+	for _, off := range []int{813, 830, 847, 864} {
+		copy(pvd[off:off+17], volumeDescriptorTime(Timestamp))
+	}
+	rootRecord := pvd[156 : 156+34]
+	copy(rootRecord[18:25], directoryRecordTime(Timestamp))
+	if _, err := w.WriteAt(pvd, pvdSector*sectorSize); err != nil {
+		return err
+	}
+	n := &normalizer{r: f, w: w, visited: make(map[uint32]bool)}
+	return n.directory(binary.LittleEndian.Uint32(rootRecord[2:6]), binary.LittleEndian.Uint32(rootRecord[10:14]), 0)
+}
+
+type normalizer struct {
+	r       io.ReaderAt
+	w       io.WriterAt
+	visited map[uint32]bool
+}
+
+func (n *normalizer) directory(location, size uint32, depth int) error {
+	if n.visited[location] {
+		return nil
+	}
+	if depth > maxDirectoryDepth {
+		return fmt.Errorf("directory depth exceeds %d", maxDirectoryDepth)
+	}
+	n.visited[location] = true
+	b := make([]byte, size)
+	if _, err := n.r.ReadAt(b, int64(location)*sectorSize); err != nil {
+		return err
+	}
+	var subdirs [][2]uint32
+	for pos := 0; pos < len(b); {
+		recLen := int(b[pos])
+		if recLen == 0 {
+			// records do not cross the sector boundaries
+			pos = (pos/sectorSize + 1) * sectorSize
+			continue
+		}
+		if recLen < 34 || pos+recLen > len(b) {
+			return fmt.Errorf("invalid directory record at sector %d", location)
+		}
+		rec := b[pos : pos+recLen]
+		copy(rec[18:25], directoryRecordTime(Timestamp))
+		nameLen := int(rec[32])
+		suStart := 33 + nameLen
+		if nameLen%2 == 0 {
+			suStart++
+		}
+		if suStart < recLen {
+			if err := n.systemUse(rec[suStart:]); err != nil {
+				return err
+			}
+		}
+		isSelfOrParent := nameLen == 1 && (rec[33] == 0 || rec[33] == 1)
+		if rec[25]&0x02 != 0 && !isSelfOrParent {
+			subdirs = append(subdirs, [2]uint32{binary.LittleEndian.Uint32(rec[2:6]), binary.LittleEndian.Uint32(rec[10:14])})
+		}
+		pos += recLen
+	}
+	if _, err := n.w.WriteAt(b, int64(location)*sectorSize); err != nil {
+		return err
+	}
+	for _, d := range subdirs {
+		if err := n.directory(d[0], d[1], depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// systemUse normalizes the "TF" entries in the system use area, following the "CE" continuation areas.
+func (n *normalizer) systemUse(b []byte) error {
+	for len(b) >= 4 {
+		sig, entryLen := string(b[0:2]), int(b[2])
+		if entryLen < 4 || entryLen > len(b) {
+			break
+		}
+		entry := b[:entryLen]
+		switch sig {
+		case "TF":
+			flags := entry[4]
+			stampLen := 7
+			if flags&0x80 != 0 {
+				stampLen = 17
+			}
+			for off := 5; off+stampLen <= entryLen; off += stampLen {
+				if stampLen == 7 {
+					copy(entry[off:off+7], directoryRecordTime(Timestamp))
+				} else {
+					copy(entry[off:off+17], volumeDescriptorTime(Timestamp))
+				}
+			}
+		case "CE":
+			if entryLen < 28 {
+				break
+			}
+			location := binary.LittleEndian.Uint32(entry[4:8])
+			offset := binary.LittleEndian.Uint32(entry[12:16])
+			length := binary.LittleEndian.Uint32(entry[20:24])
+			ce := make([]byte, length)
+			at := int64(location)*sectorSize + int64(offset)
+			if _, err := n.r.ReadAt(ce, at); err != nil {
+				return err
+			}
+			if err := n.systemUse(ce); err != nil {
+				return err
+			}
+			if _, err := n.w.WriteAt(ce, at); err != nil {
+				return err
+			}
+		case "ST":
+			return nil
+		}
+		b = b[entryLen:]
+	}
+	return nil
+}
+
+// directoryRecordTime encodes t in the 7-byte format of the directory records.
+func directoryRecordTime(t time.Time) []byte {
+	t = t.UTC()
+	return []byte{byte(t.Year() - 1900), byte(t.Month()), byte(t.Day()), byte(t.Hour()), byte(t.Minute()), byte(t.Second()), 0}
+}
+
+// volumeDescriptorTime encodes t in the 17-byte format of the volume descriptors.
+func volumeDescriptorTime(t time.Time) []byte {
+	t = t.UTC()
+	return append([]byte(fmt.Sprintf("%04d%02d%02d%02d%02d%02d%02d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/10000000)), 0)
+}
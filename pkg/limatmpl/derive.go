@@ -0,0 +1,69 @@
+package limatmpl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/yqutil"
+)
+
+// FromInstance derives a template from the lima.yaml of the existing instance,
+// so that the instance can be reproduced on another machine.
+//
+// The values specific to the machine are stripped:
+//   - `networks[].macAddress`, `ssh.localPort`, `storage.dir`, `additionalDisks`, and `user`
+//     are removed, so that they are generated or defaulted again on the new instance.
+//   - The home directory in `mounts[].location` is replaced with "~".
+//   - The instance directory in `portForwards[].hostSocket` and `copyToHost[].host` is replaced with "{{.Dir}}".
+func FromInstance(inst *store.Instance) (*Template, error) {
+	b, err := os.ReadFile(filepath.Join(inst.Dir, filenames.LimaYAML))
+	if err != nil {
+		return nil, err
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	out, err := derive(b, inst.Dir, homeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive a template from instance %q: %w", inst.Name, err)
+	}
+	return &Template{
+		Locator: inst.Dir,
+		Bytes:   out,
+	}, nil
+}
+
+func derive(b []byte, instDir, homeDir string) ([]byte, error) {
+	exprs := []string{
+		"del(.networks[].macAddress)",
+		"del(.ssh.localPort)",
+		"del(.ssh | select(length == 0))",
+		"del(.storage.dir)",
+		"del(.storage | select(length == 0))",
+		"del(.additionalDisks)",
+		"del(.user)",
+	}
+	if homeDir != "" {
+		exprs = append(exprs, replacePrefixExpr("mounts", "location", homeDir, "~"))
+	}
+	if instDir != "" {
+		exprs = append(exprs,
+			replacePrefixExpr("portForwards", "hostSocket", instDir, "{{.Dir}}"),
+			replacePrefixExpr("copyToHost", "host", instDir, "{{.Dir}}"))
+	}
+	return yqutil.EvaluateExpression(strings.Join(exprs, " | "), b)
+}
+
+// replacePrefixExpr returns the yq expression to replace the directory prefix of `.LIST[].FIELD`.
+// The list is not created when it does not exist.
+func replacePrefixExpr(list, field, dir, replacement string) string {
+	quoted := regexp.QuoteMeta(strings.TrimSuffix(dir, "/"))
+	return fmt.Sprintf("with(select(has(%q)); with(.%s[] | select(.%s | test(%q)); .%s |= sub(%q; %q)))",
+		list, list, field, "^"+quoted+"(/|$)", field, "^"+quoted, replacement)
+}
@@ -0,0 +1,66 @@
+package limatmpl
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDerive(t *testing.T) {
+	const y = `images:
+- location: https://example.com/image.img
+  arch: x86_64
+cpus: 4
+mounts:
+- location: /home/alice/src
+  writable: true
+- location: /home/alice
+- location: /home/alicex
+- location: /tmp/lima
+networks:
+- lima: shared
+  macAddress: "52:55:55:12:34:56"
+ssh:
+  localPort: 60022
+storage:
+  dir: /Volumes/External/lima
+additionalDisks:
+- data
+user:
+  name: alice
+portForwards:
+- guestSocket: /run/docker.sock
+  hostSocket: /home/alice/.lima/docker/sock/docker.sock
+copyToHost:
+- guest: /etc/rancher/k3s/k3s.yaml
+  host: /home/alice/.lima/docker/copied-from-guest/kubeconfig.yaml
+`
+	const expected = `images:
+- location: https://example.com/image.img
+  arch: x86_64
+cpus: 4
+mounts:
+- location: ~/src
+  writable: true
+- location: "~"
+- location: /home/alicex
+- location: /tmp/lima
+networks:
+- lima: shared
+portForwards:
+- guestSocket: /run/docker.sock
+  hostSocket: '{{.Dir}}/sock/docker.sock'
+copyToHost:
+- guest: /etc/rancher/k3s/k3s.yaml
+  host: '{{.Dir}}/copied-from-guest/kubeconfig.yaml'
+`
+	out, err := derive([]byte(y), "/home/alice/.lima/docker", "/home/alice")
+	assert.NilError(t, err)
+	assert.Equal(t, string(out), expected)
+}
+
+func TestDeriveKeepsNonEmptySSH(t *testing.T) {
+	out, err := derive([]byte("ssh:\n  localPort: 60022\n  forwardAgent: true\n"), "/home/alice/.lima/default", "/home/alice")
+	assert.NilError(t, err)
+	assert.Equal(t, string(out), "ssh:\n  forwardAgent: true\n")
+}
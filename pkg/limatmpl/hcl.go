@@ -0,0 +1,271 @@
+package limatmpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// hclLocalsBlock is the block type of the local values, which are referred to as `local.NAME`.
+const hclLocalsBlock = "locals"
+
+// hclFunctions are the functions available in the expressions of HCL templates.
+var hclFunctions = map[string]function.Function{
+	"coalesce":  stdlib.CoalesceFunc,
+	"concat":    stdlib.ConcatFunc,
+	"format":    stdlib.FormatFunc,
+	"join":      stdlib.JoinFunc,
+	"length":    stdlib.LengthFunc,
+	"lower":     stdlib.LowerFunc,
+	"max":       stdlib.MaxFunc,
+	"merge":     stdlib.MergeFunc,
+	"min":       stdlib.MinFunc,
+	"replace":   stdlib.ReplaceFunc,
+	"split":     stdlib.SplitFunc,
+	"trimspace": stdlib.TrimSpaceFunc,
+	"upper":     stdlib.UpperFunc,
+}
+
+// SeemsHCLPath returns true if the path of the locator has the ".hcl" extension.
+func SeemsHCLPath(locator string) bool {
+	p := locator
+	if u, err := url.Parse(locator); err == nil && u.Scheme != "" {
+		p = u.Path
+	}
+	return strings.HasSuffix(strings.ToLower(p), ".hcl")
+}
+
+// ConvertHCL converts a template written in HCL to YAML.
+//
+// The schema is the same as YAML. The fields are written as attributes, e.g., `cpus = 4`,
+// and the objects and the elements of the lists of objects may also be written as blocks, e.g.,
+// `mounts { location = "~" }` appends a mount.
+// The local values defined in `locals` blocks can be referred to as `local.NAME` in the expressions.
+//
+// The template is decoded into limayaml.LimaYAML, so the unknown fields are rejected before the template is used.
+func ConvertHCL(b []byte, filename string) ([]byte, error) {
+	file, diags := hclsyntax.ParseConfig(b, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body := file.Body.(*hclsyntax.Body)
+	evalCtx, diags := hclEvalContext(body)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	v, diags := hclBodyValue(body, reflect.TypeOf(limayaml.LimaYAML{}), evalCtx, true)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var y limayaml.LimaYAML
+	// JSON is a subset of YAML
+	if err := limayaml.Unmarshal(j, &y, filename); err != nil {
+		return nil, err
+	}
+	return limayaml.Marshal(&y, false)
+}
+
+// hclEvalContext evaluates the local values of the `locals` blocks.
+// A local value may refer to the other local values, in any order.
+func hclEvalContext(body *hclsyntax.Body) (*hcl.EvalContext, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	pending := make(map[string]*hclsyntax.Attribute)
+	for _, block := range body.Blocks {
+		if block.Type != hclLocalsBlock {
+			continue
+		}
+		if len(block.Labels) > 0 || len(block.Body.Blocks) > 0 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid locals block",
+				Detail:   "A locals block must not have labels or nested blocks.",
+				Subject:  block.DefRange().Ptr(),
+			})
+			continue
+		}
+		for name, attr := range block.Body.Attributes {
+			if _, ok := pending[name]; ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate local value",
+					Detail:   fmt.Sprintf("The local value %q is defined more than once.", name),
+					Subject:  attr.NameRange.Ptr(),
+				})
+				continue
+			}
+			pending[name] = attr
+		}
+	}
+	locals := make(map[string]cty.Value)
+	evalCtx := &hcl.EvalContext{Functions: hclFunctions}
+	for len(pending) > 0 && !diags.HasErrors() {
+		evalCtx.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+		progress := false
+		for name, attr := range pending {
+			if !hclLocalsResolved(attr.Expr, locals, pending) {
+				continue
+			}
+			v, valDiags := attr.Expr.Value(evalCtx)
+			diags = append(diags, valDiags...)
+			locals[name] = v
+			delete(pending, name)
+			progress = true
+		}
+		if !progress {
+			for _, attr := range pending {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Cyclic local value",
+					Detail:   fmt.Sprintf("The local value %q refers to itself, directly or indirectly.", attr.Name),
+					Subject:  attr.NameRange.Ptr(),
+				})
+			}
+			break
+		}
+	}
+	evalCtx.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+	return evalCtx, diags
+}
+
+// hclLocalsResolved returns false if expr refers to a local value that is still pending.
+func hclLocalsResolved(expr hclsyntax.Expression, locals map[string]cty.Value, pending map[string]*hclsyntax.Attribute) bool {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+		attr, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+		if _, ok := locals[attr.Name]; !ok {
+			if _, ok := pending[attr.Name]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hclBodyValue returns the value of the body as the fields of t, to be marshaled as JSON.
+// The blocks are the objects of the struct fields, or the elements of the slice fields.
+func hclBodyValue(body *hclsyntax.Body, t reflect.Type, evalCtx *hcl.EvalContext, topLevel bool) (map[string]any, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	res := make(map[string]any)
+	for name, attr := range body.Attributes {
+		if _, ok := hclFieldType(t, name); !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported argument",
+				Detail:   fmt.Sprintf("An argument named %q is not expected here.", name),
+				Subject:  attr.NameRange.Ptr(),
+			})
+			continue
+		}
+		v, valDiags := attr.Expr.Value(evalCtx)
+		diags = append(diags, valDiags...)
+		if valDiags.HasErrors() {
+			continue
+		}
+		j, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value",
+				Detail:   fmt.Sprintf("The value of %q cannot be converted: %v.", name, err),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			continue
+		}
+		res[name] = json.RawMessage(j)
+	}
+	for _, block := range body.Blocks {
+		if topLevel && block.Type == hclLocalsBlock {
+			continue
+		}
+		if _, ok := body.Attributes[block.Type]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate field",
+				Detail:   fmt.Sprintf("The field %q is specified as both an attribute and a block.", block.Type),
+				Subject:  block.DefRange().Ptr(),
+			})
+			continue
+		}
+		ft, ok := hclFieldType(t, block.Type)
+		if len(block.Labels) > 0 {
+			ok = false
+		}
+		isSlice := ok && ft.Kind() == reflect.Slice
+		if isSlice {
+			ft = ft.Elem()
+		}
+		for ft != nil && ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if !ok || ft.Kind() != reflect.Struct {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported block type",
+				Detail:   fmt.Sprintf("Blocks of type %q are not expected here; only the objects and the lists of objects can be written as blocks without labels.", block.Type),
+				Subject:  block.DefRange().Ptr(),
+			})
+			continue
+		}
+		v, blockDiags := hclBodyValue(block.Body, ft, evalCtx, false)
+		diags = append(diags, blockDiags...)
+		switch {
+		case isSlice:
+			l, _ := res[block.Type].([]any)
+			res[block.Type] = append(l, v)
+		case res[block.Type] != nil:
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate block",
+				Detail:   fmt.Sprintf("Only one %q block is allowed.", block.Type),
+				Subject:  block.DefRange().Ptr(),
+			})
+		default:
+			res[block.Type] = v
+		}
+	}
+	return res, diags
+}
+
+// hclFieldType returns the type of the field of the struct t, by the name in the YAML tag.
+// The fields of the inline structs are included.
+func hclFieldType(t reflect.Type, name string) (reflect.Type, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tagName, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if f.Anonymous && strings.Contains(","+opts+",", ",inline,") {
+			if ft, ok := hclFieldType(f.Type, name); ok {
+				return ft, true
+			}
+			continue
+		}
+		if tagName == name {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,144 @@
+package limatmpl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestConvertHCL(t *testing.T) {
+	b, err := ConvertHCL([]byte(`
+locals {
+  # a local value may refer to the ones defined later
+  image   = "${local.mirror}/current/${local.release}-server-cloudimg-amd64.img"
+  mirror  = "https://cloud-images.ubuntu.com/${local.release}"
+  release = "noble"
+}
+images {
+  location = local.image
+  arch     = "x86_64"
+}
+images {
+  location = "https://example.com/fallback.img"
+  arch     = upper("aarch64")
+}
+cpus   = 2 * 2
+memory = "4GiB"
+mounts {
+  location = "~"
+}
+mounts {
+  location = "/tmp/lima"
+  writable = true
+}
+containerd {
+  system = false
+  user   = false
+}
+env = { FOO = "bar" }
+`), "test.hcl")
+	assert.NilError(t, err)
+	expected := `images:
+- location: https://cloud-images.ubuntu.com/noble/current/noble-server-cloudimg-amd64.img
+  arch: x86_64
+- location: https://example.com/fallback.img
+  arch: AARCH64
+cpus: 4
+memory: 4GiB
+mounts:
+- location: "~"
+- location: /tmp/lima
+  writable: true
+containerd:
+  system: false
+  user: false
+env:
+  FOO: bar
+`
+	assert.Equal(t, string(b), expected)
+}
+
+func TestConvertHCLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name:  "syntax",
+			input: `cpus = `,
+			err:   "Missing expression",
+		},
+		{
+			name:  "unknown argument",
+			input: `cpu = 4`,
+			err:   `An argument named "cpu" is not expected here`,
+		},
+		{
+			name:  "unknown block",
+			input: `mount { location = "~" }`,
+			err:   `Blocks of type "mount" are not expected here`,
+		},
+		{
+			name:  "block of a scalar",
+			input: `cpus { value = 4 }`,
+			err:   `Blocks of type "cpus" are not expected here`,
+		},
+		{
+			name:  "block with labels",
+			input: `mounts "home" { location = "~" }`,
+			err:   `Blocks of type "mounts" are not expected here`,
+		},
+		{
+			name:  "unknown argument in block",
+			input: `mounts { path = "~" }`,
+			err:   `An argument named "path" is not expected here`,
+		},
+		{
+			name:  "duplicate block",
+			input: "containerd { system = true }\ncontainerd { user = true }",
+			err:   `Only one "containerd" block is allowed`,
+		},
+		{
+			name:  "attribute and block",
+			input: "mounts = []\nmounts { location = \"~\" }",
+			err:   `The field "mounts" is specified as both an attribute and a block`,
+		},
+		{
+			name:  "cyclic locals",
+			input: "locals {\n  a = local.b\n  b = local.a\n}",
+			err:   "Cyclic local value",
+		},
+		{
+			name:  "undefined local",
+			input: "locals {\n  a = 1\n}\ncpus = local.b",
+			err:   "Unsupported attribute",
+		},
+		{
+			name:  "type mismatch",
+			input: `cpus = "four"`,
+			err:   "failed to unmarshal YAML",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ConvertHCL([]byte(tc.input), "test.hcl")
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestReadHCL(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "Dev.HCL")
+	assert.NilError(t, os.WriteFile(p, []byte(`images { location = "/img" }`+"\n"), 0o644))
+	tmpl, err := Read(context.Background(), "", p)
+	assert.NilError(t, err)
+	assert.Equal(t, tmpl.Name, "dev")
+	assert.Equal(t, string(tmpl.Bytes), "images:\n- location: /img\n")
+
+	assert.Assert(t, SeemsHCLPath("https://example.com/dev.hcl?ref=main"))
+	assert.Assert(t, !SeemsHCLPath("https://example.com/dev.yaml"))
+}
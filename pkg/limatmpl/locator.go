@@ -12,6 +12,10 @@ import (
 	"strings"
 
 	"github.com/containerd/containerd/identifiers"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/lima-vm/lima/pkg/credentials"
+	"github.com/lima-vm/lima/pkg/fileutils"
+	"github.com/lima-vm/lima/pkg/identifierutil"
 	"github.com/lima-vm/lima/pkg/ioutilx"
 	"github.com/lima-vm/lima/pkg/templatestore"
 	"github.com/sirupsen/logrus"
@@ -25,8 +29,15 @@ type Template struct {
 
 const yBytesLimit = 4 * 1024 * 1024 // 4MiB
 
+// Read reads the template from the locator.
+//
+// The name may contain `{{.HostUser}}`, which is expanded to the name of the current host user,
+// so that users of a shared machine can use distinct instance names from a common script.
 func Read(ctx context.Context, name, locator string) (*Template, error) {
-	var err error
+	name, err := identifierutil.ExpandHostUser(name)
+	if err != nil {
+		return nil, err
+	}
 
 	tmpl := &Template{
 		Name:    name,
@@ -41,9 +52,11 @@ func Read(ctx context.Context, name, locator string) (*Template, error) {
 		logrus.Debugf("interpreting argument %q as a template name %q", locator, templateName)
 		if tmpl.Name == "" {
 			// e.g., templateName = "deprecated/centos-7" , tmpl.Name = "centos-7"
-			tmpl.Name = filepath.Base(templateName)
+			// e.g., templateName = "myrepo/foo@sha256:0123..." , tmpl.Name = "foo"
+			withoutDigest, _, _ := strings.Cut(templateName, "@")
+			tmpl.Name = filepath.Base(withoutDigest)
 		}
-		tmpl.Bytes, err = templatestore.Read(templateName)
+		tmpl.Bytes, err = templatestore.Fetch(ctx, templateName)
 		if err != nil {
 			return nil, err
 		}
@@ -59,7 +72,7 @@ func Read(ctx context.Context, name, locator string) (*Template, error) {
 		if err != nil {
 			return nil, err
 		}
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := credentials.Client.Do(req)
 		if err != nil {
 			return nil, err
 		}
@@ -68,6 +81,18 @@ func Read(ctx context.Context, name, locator string) (*Template, error) {
 		if err != nil {
 			return nil, err
 		}
+	case fileutils.IsOCI(locator):
+		if tmpl.Name == "" {
+			tmpl.Name, err = InstNameFromOCIRef(locator)
+			if err != nil {
+				return nil, err
+			}
+		}
+		logrus.Debugf("interpreting argument %q as an OCI artifact for instance %q", locator, tmpl.Name)
+		tmpl.Bytes, err = fileutils.ReadOCITemplate(ctx, locator)
+		if err != nil {
+			return nil, err
+		}
 	case SeemsFileURL(locator):
 		if tmpl.Name == "" {
 			tmpl.Name, err = InstNameFromURL(locator)
@@ -108,6 +133,12 @@ func Read(ctx context.Context, name, locator string) (*Template, error) {
 			return nil, fmt.Errorf("unexpected error reading stdin: %w", err)
 		}
 	}
+	if SeemsHCLPath(locator) {
+		tmpl.Bytes, err = ConvertHCL(tmpl.Bytes, locator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert the HCL template %q: %w", locator, err)
+		}
+	}
 	return tmpl, nil
 }
 
@@ -143,7 +174,7 @@ func SeemsYAMLPath(arg string) bool {
 		return true
 	}
 	lower := strings.ToLower(arg)
-	return strings.HasSuffix(lower, ".yml") || strings.HasSuffix(lower, ".yaml")
+	return strings.HasSuffix(lower, ".yml") || strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, ".hcl")
 }
 
 func InstNameFromURL(urlStr string) (string, error) {
@@ -154,9 +185,23 @@ func InstNameFromURL(urlStr string) (string, error) {
 	return InstNameFromYAMLPath(path.Base(u.Path))
 }
 
+// InstNameFromOCIRef returns the instance name for the OCI reference, i.e., the last component of the repository,
+// e.g., "dev-base" for "oci://ghcr.io/org/dev-base:2024.06".
+func InstNameFromOCIRef(ref string) (string, error) {
+	named, err := docker.ParseNormalizedNamed(strings.TrimPrefix(ref, fileutils.OCIScheme))
+	if err != nil {
+		return "", err
+	}
+	s := path.Base(docker.Path(named))
+	if err := identifiers.Validate(s); err != nil {
+		return "", fmt.Errorf("repository name %q is invalid as an instance name: %w", s, err)
+	}
+	return s, nil
+}
+
 func InstNameFromYAMLPath(yamlPath string) (string, error) {
 	s := strings.ToLower(filepath.Base(yamlPath))
-	s = strings.TrimSuffix(strings.TrimSuffix(s, ".yml"), ".yaml")
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(s, ".yml"), ".yaml"), ".hcl")
 	// "." is allowed in instance names, but replaced to "-" for hostnames.
 	// e.g., yaml: "ubuntu-24.04.yaml" , instance name: "ubuntu-24.04", hostname: "lima-ubuntu-24-04"
 	if err := identifiers.Validate(s); err != nil {
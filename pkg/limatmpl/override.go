@@ -0,0 +1,16 @@
+package limatmpl
+
+import "github.com/lima-vm/lima/pkg/limayaml"
+
+// ApplyOverride merges the override YAML into the template with limayaml.MergeOverride,
+// following the same precedence rules as $LIMA_HOME/_config/override.yaml.
+//
+// Calling ApplyOverride multiple times stacks the overrides; the last one has the highest priority.
+func (tmpl *Template) ApplyOverride(override []byte) error {
+	out, err := limayaml.MergeOverride(tmpl.Bytes, override)
+	if err != nil {
+		return err
+	}
+	tmpl.Bytes = out
+	return nil
+}
@@ -0,0 +1,57 @@
+package limatmpl
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestApplyOverride(t *testing.T) {
+	tmpl := &Template{
+		Bytes: []byte(`# base
+images:
+- location: base.img
+cpus: 2
+dns:
+- 1.1.1.1
+mounts:
+- location: "~"
+ssh:
+  localPort: 0
+`),
+	}
+	assert.NilError(t, tmpl.ApplyOverride([]byte(`images:
+- location: team.img
+cpus: 4
+dns:
+- 8.8.8.8
+mounts:
+- location: /tmp/team
+  writable: true
+`)))
+	assert.NilError(t, tmpl.ApplyOverride([]byte(`cpus: 8
+ssh:
+  forwardAgent: true
+env:
+  FOO: bar
+`)))
+	assert.NilError(t, tmpl.ApplyOverride([]byte("# empty\n")))
+	expected := `# base
+images:
+- location: team.img
+- location: base.img
+cpus: 8
+dns:
+- 8.8.8.8
+mounts:
+- location: "~"
+- location: /tmp/team
+  writable: true
+ssh:
+  localPort: 0
+  forwardAgent: true
+env:
+  FOO: bar
+`
+	assert.Equal(t, string(tmpl.Bytes), expected)
+}
@@ -0,0 +1,135 @@
+package limayaml
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DriverCapabilities is the capability manifest advertised by a driver.
+// It is consumed by Validate so that unsupported combinations are rejected
+// before the instance is created, rather than failing at runtime.
+type DriverCapabilities struct {
+	// MountTypes is the list of the supported mount types.
+	MountTypes []MountType `json:"mountTypes"`
+	// Arches is the list of the supported guest architectures.
+	Arches []Arch `json:"arches"`
+	// DisplayTypes is the list of the supported `video.display` values.
+	// Nil means that any value is accepted.
+	DisplayTypes []string `json:"displayTypes,omitempty"`
+	// Snapshot is true if the driver supports `limactl snapshot`.
+	Snapshot bool `json:"snapshot"`
+	// NestedVirtualization is true if the driver supports `nestedVirtualization`.
+	NestedVirtualization bool `json:"nestedVirtualization"`
+	// TPM is true if the driver supports `tpm`.
+	TPM bool `json:"tpm"`
+	// EgressPolicy is true if the driver supports `egressPolicy`.
+	EgressPolicy bool `json:"egressPolicy"`
+	// MetadataService is true if the driver supports `metadataService`.
+	MetadataService bool `json:"metadataService"`
+	// PCIPassthrough is true if the driver supports `passthrough.pci` and `passthrough.gpu` on the current host.
+	PCIPassthrough bool `json:"pciPassthrough"`
+	// SharedMemory is true if the driver supports `sharedMemory`.
+	SharedMemory bool `json:"sharedMemory"`
+	// CrashVMCore is true if the driver supports `crashCapture.vmcore`.
+	CrashVMCore bool `json:"crashVMCore"`
+	// VideoAccel is true if the driver supports `video.accel`.
+	VideoAccel bool `json:"videoAccel"`
+	// AdditionalUsers is true if the driver supports `users`, which are created by cloud-init.
+	AdditionalUsers bool `json:"additionalUsers"`
+	// Pause is true if the driver supports pausing the running instance (`powerSaving.pause`).
+	Pause bool `json:"pause"`
+	// Suspend is true if the driver supports saving the state of the running instance to the disk (`limactl suspend`).
+	Suspend bool `json:"suspend"`
+	// LiveClone is true if the driver supports cloning the running instance (`limactl clone`).
+	LiveClone bool `json:"liveClone"`
+	// CPUHotplugArches is the list of the guest architectures for which the driver supports
+	// changing the CPUs of a running instance, up to `maxCPUs`.
+	CPUHotplugArches []Arch `json:"cpuHotplugArches,omitempty"`
+}
+
+var (
+	driverCapabilities   = make(map[VMType]DriverCapabilities)
+	driverCapabilitiesMu sync.RWMutex
+)
+
+// RegisterDriverCapabilities registers the capability manifest of the driver for vmType.
+// A later registration for the same vmType replaces the earlier one.
+// Validate rejects the vmTypes without a registered manifest; the built-in drivers are registered by package driverutil.
+func RegisterDriverCapabilities(vmType VMType, caps DriverCapabilities) {
+	driverCapabilitiesMu.Lock()
+	defer driverCapabilitiesMu.Unlock()
+	driverCapabilities[vmType] = caps
+}
+
+// LookupDriverCapabilities returns the capability manifest registered for vmType.
+func LookupDriverCapabilities(vmType VMType) (DriverCapabilities, bool) {
+	driverCapabilitiesMu.RLock()
+	defer driverCapabilitiesMu.RUnlock()
+	caps, ok := driverCapabilities[vmType]
+	return caps, ok
+}
+
+// validateDriverCapabilities checks y against the capability manifest of y.VMType.
+// The validation fails closed when the capabilities of the vmType have not been registered,
+// so that a missing registration cannot silently skip the checks.
+func validateDriverCapabilities(y *LimaYAML, warn bool) error {
+	caps, ok := LookupDriverCapabilities(*y.VMType)
+	if !ok {
+		// The built-in drivers are registered by importing package driverutil
+		return fmt.Errorf("vmType %q is not supported by this build of limactl", *y.VMType)
+	}
+	if !slices.Contains(caps.Arches, *y.Arch) {
+		return fmt.Errorf("vmType %s does not support arch %s (supported: %v)", *y.VMType, *y.Arch, caps.Arches)
+	}
+	// The external mount drivers mount the directories over the network, independently of the VM driver
+	if y.MountType != nil && !IsExternalMountType(*y.MountType) && !slices.Contains(caps.MountTypes, *y.MountType) {
+		return fmt.Errorf("vmType %s does not support mountType %s (supported: %v)", *y.VMType, *y.MountType, caps.MountTypes)
+	}
+	if y.TPM != nil && *y.TPM && !caps.TPM {
+		return fmt.Errorf("vmType %s does not support `tpm`", *y.VMType)
+	}
+	if y.EgressPolicy != nil && !caps.EgressPolicy {
+		return fmt.Errorf("vmType %s does not support `egressPolicy`", *y.VMType)
+	}
+	if y.MetadataService.Enabled != nil && *y.MetadataService.Enabled && !caps.MetadataService {
+		return fmt.Errorf("vmType %s does not support `metadataService`", *y.VMType)
+	}
+	if len(y.Passthrough.PCI) > 0 && !caps.PCIPassthrough {
+		return fmt.Errorf("vmType %s does not support `passthrough.pci` on this host", *y.VMType)
+	}
+	if len(y.Passthrough.GPU) > 0 && !caps.PCIPassthrough {
+		return fmt.Errorf("vmType %s does not support `passthrough.gpu` on this host", *y.VMType)
+	}
+	if len(y.SharedMemory) > 0 && !caps.SharedMemory {
+		return fmt.Errorf("vmType %s does not support `sharedMemory`", *y.VMType)
+	}
+	if y.CrashCapture.VMCore != nil && *y.CrashCapture.VMCore && !caps.CrashVMCore {
+		return fmt.Errorf("vmType %s does not support `crashCapture.vmcore`", *y.VMType)
+	}
+	if y.Video.Accel != nil && *y.Video.Accel && !caps.VideoAccel {
+		return fmt.Errorf("vmType %s does not support `video.accel`", *y.VMType)
+	}
+	if len(y.Users) > 0 && !caps.AdditionalUsers {
+		return fmt.Errorf("vmType %s does not support `users`", *y.VMType)
+	}
+	if y.PowerSaving.Pause != nil && *y.PowerSaving.Pause && !caps.Pause {
+		return fmt.Errorf("vmType %s does not support `powerSaving.pause`", *y.VMType)
+	}
+	if warn {
+		if y.MaxCPUs != nil && *y.MaxCPUs > *y.CPUs && !slices.Contains(caps.CPUHotplugArches, *y.Arch) {
+			logrus.Warnf("vmType %s does not support CPU hotplug for arch %s; ignoring `maxCPUs`", *y.VMType, *y.Arch)
+		}
+		if y.NestedVirtualization != nil && *y.NestedVirtualization && !caps.NestedVirtualization {
+			logrus.Warnf("vmType %s does not support `nestedVirtualization`; ignoring", *y.VMType)
+		}
+		if caps.DisplayTypes != nil && y.Video.Display != nil && *y.Video.Display != "" {
+			if !slices.Contains(caps.DisplayTypes, *y.Video.Display) {
+				logrus.Warnf("vmType %s does not support video.display %s (supported: %v)", *y.VMType, *y.Video.Display, caps.DisplayTypes)
+			}
+		}
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package limayaml
 
 import (
 	"bytes"
-	"crypto/sha256"
 	_ "embed"
 	"errors"
 	"fmt"
@@ -26,12 +25,14 @@ import (
 	"golang.org/x/sys/cpu"
 
 	"github.com/lima-vm/lima/pkg/identifierutil"
+	"github.com/lima-vm/lima/pkg/macaddress"
 	. "github.com/lima-vm/lima/pkg/must"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/ptr"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/lima-vm/lima/pkg/version/versionutil"
 )
 
@@ -45,6 +46,17 @@ const (
 	Default9pCacheForRW      string = "mmap"
 
 	DefaultVirtiofsQueueSize int = 1024
+
+	// DefaultInotifyBatchInterval is the default of `mounts[].inotify.batchInterval`
+	DefaultInotifyBatchInterval string = "100ms"
+
+	DefaultSharedMemorySize string = "16MiB"
+
+	// DefaultMaxPortForwards is the default of `portForwardLimits.maxForwards`
+	DefaultMaxPortForwards int = 1000
+
+	// DefaultPowerSavingGuestAgentTick is the default of `powerSaving.guestAgentTick`
+	DefaultPowerSavingGuestAgentTick string = "30s"
 )
 
 var (
@@ -57,10 +69,14 @@ var (
 func defaultCPUType() CPUType {
 	cpuType := map[Arch]string{
 		AARCH64: "cortex-a72",
-		ARMV7L:  "cortex-a7",
+		// The ARMv6 CPUs (e.g., "arm1176" of Raspberry Pi 1) are not supported by the "virt" machine of QEMU,
+		// so the ARMv7 CPU that can execute the ARMv6 binaries is used.
+		ARMV6L: "cortex-a7",
+		ARMV7L: "cortex-a7",
 		// Since https://github.com/lima-vm/lima/pull/494, we use qemu64 cpu for better emulation of x86_64.
-		X8664:   "qemu64",
-		RISCV64: "rv64", // FIXME: what is the right choice for riscv64?
+		X8664:       "qemu64",
+		RISCV64:     "rv64", // FIXME: what is the right choice for riscv64?
+		LOONGARCH64: "la464",
 	}
 	for arch := range cpuType {
 		if IsNativeArch(arch) && IsAccelOS() {
@@ -104,17 +120,11 @@ func FirstUsernetIndex(l *LimaYAML) int {
 	return slices.IndexFunc(l.Networks, func(network Network) bool { return networks.IsUsernet(network.Lima) })
 }
 
+// MACAddress returns the MAC address of the interface identified by uniqueID.
+// The address allocated by `limactl start` is returned, or the address derived from uniqueID
+// if no address has been allocated yet. See pkg/macaddress.
 func MACAddress(uniqueID string) string {
-	sha := sha256.Sum256([]byte(osutil.MachineID() + uniqueID))
-	// "5" is the magic number in the Lima ecosystem.
-	// (Visit https://en.wiktionary.org/wiki/lima and Command-F "five")
-	//
-	// But the second hex number is changed to 2 to satisfy the convention for
-	// local MAC addresses (https://en.wikipedia.org/wiki/MAC_address#Ranges_of_group_and_locally_administered_addresses)
-	//
-	// See also https://gitlab.com/wireshark/wireshark/-/blob/release-4.0/manuf to confirm the uniqueness of this prefix.
-	hw := append(net.HardwareAddr{0x52, 0x55, 0x55}, sha[0:3]...)
-	return hw.String()
+	return macaddress.Lookup(uniqueID)
 }
 
 func hostTimeZone() string {
@@ -180,6 +190,7 @@ func defaultGuestInstallPrefix() string {
 //   - Networks are appended in d, y, o order
 //   - DNS are picked from the highest priority where DNS is not empty.
 //   - CACertificates Files and Certs are uniquely appended in d, y, o order
+//   - Passthrough PCI addresses and GPU IDs are uniquely appended in d, y, o order
 func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	instDir := filepath.Dir(filePath)
 
@@ -188,11 +199,10 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	if !isExistingInstanceDir(instDir) {
 		existingLimaVersion = version.Version
 	} else {
-		limaVersionFile := filepath.Join(instDir, filenames.LimaVersion)
-		if b, err := os.ReadFile(limaVersionFile); err == nil {
-			existingLimaVersion = strings.TrimSpace(string(b))
-		} else if !errors.Is(err, os.ErrNotExist) {
-			logrus.WithError(err).Warnf("Failed to read %q", limaVersionFile)
+		if md, err := metadata.Read(instDir); err == nil {
+			existingLimaVersion = md.LimaVersion
+		} else {
+			logrus.WithError(err).Warnf("Failed to read the metadata of %q", instDir)
 		}
 	}
 
@@ -208,6 +218,9 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	if y.User.UID == nil {
 		y.User.UID = d.User.UID
 	}
+	if y.User.Shell == nil {
+		y.User.Shell = d.User.Shell
+	}
 	if o.User.Name != nil {
 		y.User.Name = o.User.Name
 	}
@@ -220,6 +233,9 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	if o.User.UID != nil {
 		y.User.UID = o.User.UID
 	}
+	if o.User.Shell != nil {
+		y.User.Shell = o.User.Shell
+	}
 	if y.User.Name == nil {
 		y.User.Name = ptr.Of(osutil.LimaUser(existingLimaVersion, warn).Username)
 		warn = false
@@ -248,6 +264,54 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	} else {
 		logrus.WithError(err).Warnf("Couldn't process `user.home` value %q as a template", *y.User.Home)
 	}
+	if y.User.Shell == nil {
+		y.User.Shell = ptr.Of("/bin/bash")
+	}
+
+	users := make([]AdditionalUser, 0, len(d.Users)+len(y.Users)+len(o.Users))
+	userIndex := make(map[string]int)
+	for _, u := range append(append(d.Users, y.Users...), o.Users...) {
+		i, ok := userIndex[u.Name]
+		if !ok {
+			userIndex[u.Name] = len(users)
+			users = append(users, u)
+			continue
+		}
+		if u.Comment != nil {
+			users[i].Comment = u.Comment
+		}
+		if u.Home != nil {
+			users[i].Home = u.Home
+		}
+		if u.UID != nil {
+			users[i].UID = u.UID
+		}
+		if u.Shell != nil {
+			users[i].Shell = u.Shell
+		}
+		if u.Sudo != nil {
+			users[i].Sudo = u.Sudo
+		}
+		if u.SSHPubKeys != nil {
+			users[i].SSHPubKeys = u.SSHPubKeys
+		}
+	}
+	y.Users = users
+	for i := range y.Users {
+		u := &y.Users[i]
+		if u.Comment == nil {
+			u.Comment = ptr.Of(u.Name)
+		}
+		if u.Home == nil {
+			u.Home = ptr.Of("/home/" + u.Name + ".linux")
+		}
+		if u.Shell == nil {
+			u.Shell = ptr.Of("/bin/bash")
+		}
+		if u.Sudo == nil {
+			u.Sudo = ptr.Of(SudoNone)
+		}
+	}
 
 	if y.VMType == nil {
 		y.VMType = d.VMType
@@ -319,6 +383,13 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 		y.CPUs = ptr.Of(defaultCPUs())
 	}
 
+	if y.MaxCPUs == nil {
+		y.MaxCPUs = d.MaxCPUs
+	}
+	if o.MaxCPUs != nil {
+		y.MaxCPUs = o.MaxCPUs
+	}
+
 	if y.Memory == nil {
 		y.Memory = d.Memory
 	}
@@ -371,6 +442,16 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 		y.Video.VNC.Display = ptr.Of("127.0.0.1:0,to=9")
 	}
 
+	if y.Video.Accel == nil {
+		y.Video.Accel = d.Video.Accel
+	}
+	if o.Video.Accel != nil {
+		y.Video.Accel = o.Video.Accel
+	}
+	if y.Video.Accel == nil {
+		y.Video.Accel = ptr.Of(*y.Video.Display == DisplayDefaultAccelerated)
+	}
+
 	if y.Firmware.LegacyBIOS == nil {
 		y.Firmware.LegacyBIOS = d.Firmware.LegacyBIOS
 	}
@@ -462,6 +543,9 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	}
 	y.HostResolver.Hosts = hosts
 
+	// Rules of the same domain are resolved by the first one, so o takes precedence over y and d
+	y.HostResolver.Rules = slices.Concat(o.HostResolver.Rules, y.HostResolver.Rules, d.HostResolver.Rules)
+
 	y.Provision = append(append(o.Provision, y.Provision...), d.Provision...)
 	for i := range y.Provision {
 		provision := &y.Provision[i]
@@ -533,6 +617,16 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 		}
 	}
 
+	if y.Podman.User == nil {
+		y.Podman.User = d.Podman.User
+	}
+	if o.Podman.User != nil {
+		y.Podman.User = o.Podman.User
+	}
+	if y.Podman.User == nil {
+		y.Podman.User = ptr.Of(false)
+	}
+
 	y.Probes = append(append(o.Probes, y.Probes...), d.Probes...)
 	for i := range y.Probes {
 		probe := &y.Probes[i]
@@ -550,6 +644,13 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	}
 
 	y.PortForwards = append(append(o.PortForwards, y.PortForwards...), d.PortForwards...)
+	if *y.Podman.User {
+		// Appended last, so that the rules in the config take precedence
+		y.PortForwards = append(y.PortForwards, PortForward{
+			GuestSocket: PodmanGuestSocket,
+			HostSocket:  PodmanHostSocket,
+		})
+	}
 	for i := range y.PortForwards {
 		FillPortForwardDefaults(&y.PortForwards[i], instDir, y.User, y.Param)
 		// After defaults processing the singular HostPort and GuestPort values should not be used again.
@@ -560,6 +661,128 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 		FillCopyToHostDefaults(&y.CopyToHost[i], instDir, y.User, y.Param)
 	}
 
+	y.UDPRelays = append(append(o.UDPRelays, y.UDPRelays...), d.UDPRelays...)
+
+	y.SocketForwards = append(append(o.SocketForwards, y.SocketForwards...), d.SocketForwards...)
+	for i := range y.SocketForwards {
+		FillSocketForwardDefaults(&y.SocketForwards[i], instDir, y.User, y.Param)
+	}
+
+	if d.EgressPolicy != nil || y.EgressPolicy != nil || o.EgressPolicy != nil {
+		policy := EgressPolicy{}
+		for _, p := range []*EgressPolicy{o.EgressPolicy, y.EgressPolicy, d.EgressPolicy} {
+			if p != nil {
+				policy.Allow = append(policy.Allow, p.Allow...)
+				policy.Deny = append(policy.Deny, p.Deny...)
+			}
+		}
+		y.EgressPolicy = &policy
+	}
+
+	if y.MetadataService.Enabled == nil {
+		y.MetadataService.Enabled = d.MetadataService.Enabled
+	}
+	if o.MetadataService.Enabled != nil {
+		y.MetadataService.Enabled = o.MetadataService.Enabled
+	}
+	if y.MetadataService.Enabled == nil {
+		y.MetadataService.Enabled = ptr.Of(false)
+	}
+
+	if y.PortForwardLimits.MaxForwards == nil {
+		y.PortForwardLimits.MaxForwards = d.PortForwardLimits.MaxForwards
+	}
+	if o.PortForwardLimits.MaxForwards != nil {
+		y.PortForwardLimits.MaxForwards = o.PortForwardLimits.MaxForwards
+	}
+	if y.PortForwardLimits.MaxForwards == nil {
+		y.PortForwardLimits.MaxForwards = ptr.Of(DefaultMaxPortForwards)
+	}
+	if y.PortForwardLimits.MaxConnectionsPerPort == nil {
+		y.PortForwardLimits.MaxConnectionsPerPort = d.PortForwardLimits.MaxConnectionsPerPort
+	}
+	if o.PortForwardLimits.MaxConnectionsPerPort != nil {
+		y.PortForwardLimits.MaxConnectionsPerPort = o.PortForwardLimits.MaxConnectionsPerPort
+	}
+	if y.PortForwardLimits.MaxConnectionsPerPort == nil {
+		y.PortForwardLimits.MaxConnectionsPerPort = ptr.Of(0)
+	}
+	if y.PortForwardLimits.Bandwidth == nil {
+		y.PortForwardLimits.Bandwidth = d.PortForwardLimits.Bandwidth
+	}
+	if o.PortForwardLimits.Bandwidth != nil {
+		y.PortForwardLimits.Bandwidth = o.PortForwardLimits.Bandwidth
+	}
+	if y.PortForwardLimits.Bandwidth == nil {
+		y.PortForwardLimits.Bandwidth = ptr.Of("0")
+	}
+
+	if y.CrashCapture.Enabled == nil {
+		y.CrashCapture.Enabled = d.CrashCapture.Enabled
+	}
+	if o.CrashCapture.Enabled != nil {
+		y.CrashCapture.Enabled = o.CrashCapture.Enabled
+	}
+	if y.CrashCapture.Enabled == nil {
+		y.CrashCapture.Enabled = ptr.Of(true)
+	}
+	if y.CrashCapture.VMCore == nil {
+		y.CrashCapture.VMCore = d.CrashCapture.VMCore
+	}
+	if o.CrashCapture.VMCore != nil {
+		y.CrashCapture.VMCore = o.CrashCapture.VMCore
+	}
+	if y.CrashCapture.VMCore == nil {
+		y.CrashCapture.VMCore = ptr.Of(false)
+	}
+
+	if y.SerialLog.MaxSize == nil {
+		y.SerialLog.MaxSize = d.SerialLog.MaxSize
+	}
+	if o.SerialLog.MaxSize != nil {
+		y.SerialLog.MaxSize = o.SerialLog.MaxSize
+	}
+	if y.SerialLog.MaxSize == nil {
+		y.SerialLog.MaxSize = ptr.Of("10MiB")
+	}
+	if y.SerialLog.MaxFiles == nil {
+		y.SerialLog.MaxFiles = d.SerialLog.MaxFiles
+	}
+	if o.SerialLog.MaxFiles != nil {
+		y.SerialLog.MaxFiles = o.SerialLog.MaxFiles
+	}
+	if y.SerialLog.MaxFiles == nil {
+		y.SerialLog.MaxFiles = ptr.Of(2)
+	}
+
+	if y.PowerSaving.Mode == nil {
+		y.PowerSaving.Mode = d.PowerSaving.Mode
+	}
+	if o.PowerSaving.Mode != nil {
+		y.PowerSaving.Mode = o.PowerSaving.Mode
+	}
+	if y.PowerSaving.Mode == nil {
+		y.PowerSaving.Mode = ptr.Of(PowerSavingAuto)
+	}
+	if y.PowerSaving.GuestAgentTick == nil {
+		y.PowerSaving.GuestAgentTick = d.PowerSaving.GuestAgentTick
+	}
+	if o.PowerSaving.GuestAgentTick != nil {
+		y.PowerSaving.GuestAgentTick = o.PowerSaving.GuestAgentTick
+	}
+	if y.PowerSaving.GuestAgentTick == nil {
+		y.PowerSaving.GuestAgentTick = ptr.Of(DefaultPowerSavingGuestAgentTick)
+	}
+	if y.PowerSaving.Pause == nil {
+		y.PowerSaving.Pause = d.PowerSaving.Pause
+	}
+	if o.PowerSaving.Pause != nil {
+		y.PowerSaving.Pause = o.PowerSaving.Pause
+	}
+	if y.PowerSaving.Pause == nil {
+		y.PowerSaving.Pause = ptr.Of(false)
+	}
+
 	if y.HostResolver.Enabled == nil {
 		y.HostResolver.Enabled = d.HostResolver.Enabled
 	}
@@ -613,6 +836,9 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 			if nw.Metric != nil {
 				networks[i].Metric = nw.Metric
 			}
+			if nw.StaticIP != "" {
+				networks[i].StaticIP = nw.StaticIP
+			}
 		} else {
 			// unnamed network definitions are not combined/overwritten
 			if nw.Interface != "" {
@@ -723,6 +949,39 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 			if mount.Virtiofs.QueueSize != nil {
 				mounts[i].Virtiofs.QueueSize = mount.Virtiofs.QueueSize
 			}
+			if mount.Virtiofs.Tag != nil {
+				mounts[i].Virtiofs.Tag = mount.Virtiofs.Tag
+			}
+			if mount.Virtiofs.Cache != nil {
+				mounts[i].Virtiofs.Cache = mount.Virtiofs.Cache
+			}
+			if len(mount.Virtiofs.IDMap.UID) > 0 {
+				mounts[i].Virtiofs.IDMap.UID = mount.Virtiofs.IDMap.UID
+			}
+			if len(mount.Virtiofs.IDMap.GID) > 0 {
+				mounts[i].Virtiofs.IDMap.GID = mount.Virtiofs.IDMap.GID
+			}
+			if mount.Virtiofs.Sandbox != nil {
+				mounts[i].Virtiofs.Sandbox = mount.Virtiofs.Sandbox
+			}
+			if mount.Virtiofs.ThreadPoolSize != nil {
+				mounts[i].Virtiofs.ThreadPoolSize = mount.Virtiofs.ThreadPoolSize
+			}
+			if mount.Virtiofs.RlimitNofile != nil {
+				mounts[i].Virtiofs.RlimitNofile = mount.Virtiofs.RlimitNofile
+			}
+			if len(mount.Inotify.Include) > 0 {
+				mounts[i].Inotify.Include = mount.Inotify.Include
+			}
+			if len(mount.Inotify.Exclude) > 0 {
+				mounts[i].Inotify.Exclude = mount.Inotify.Exclude
+			}
+			if mount.Inotify.BatchInterval != nil {
+				mounts[i].Inotify.BatchInterval = mount.Inotify.BatchInterval
+			}
+			if mount.Inotify.MaxEventsPerSecond != nil {
+				mounts[i].Inotify.MaxEventsPerSecond = mount.Inotify.MaxEventsPerSecond
+			}
 			if mount.Writable != nil {
 				mounts[i].Writable = mount.Writable
 			}
@@ -759,6 +1018,12 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 		if mount.Virtiofs.QueueSize == nil && *y.VMType == QEMU && *y.MountType == VIRTIOFS {
 			mounts[i].Virtiofs.QueueSize = ptr.Of(DefaultVirtiofsQueueSize)
 		}
+		if mount.Inotify.BatchInterval == nil {
+			mounts[i].Inotify.BatchInterval = ptr.Of(DefaultInotifyBatchInterval)
+		}
+		if mount.Inotify.MaxEventsPerSecond == nil {
+			mounts[i].Inotify.MaxEventsPerSecond = ptr.Of(0)
+		}
 		if mount.Writable == nil {
 			mount.Writable = ptr.Of(false)
 		}
@@ -782,6 +1047,29 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 		y.DNS = o.DNS
 	}
 
+	// Note: DHCP lists are not combined; highest priority setting is picked
+	if len(y.DHCP.SearchDomains) == 0 {
+		y.DHCP.SearchDomains = d.DHCP.SearchDomains
+	}
+	if len(o.DHCP.SearchDomains) > 0 {
+		y.DHCP.SearchDomains = o.DHCP.SearchDomains
+	}
+	if len(y.DHCP.NTPServers) == 0 {
+		y.DHCP.NTPServers = d.DHCP.NTPServers
+	}
+	if len(o.DHCP.NTPServers) > 0 {
+		y.DHCP.NTPServers = o.DHCP.NTPServers
+	}
+	if y.DHCP.MTU == nil {
+		y.DHCP.MTU = d.DHCP.MTU
+	}
+	if o.DHCP.MTU != nil {
+		y.DHCP.MTU = o.DHCP.MTU
+	}
+	if y.DHCP.MTU == nil {
+		y.DHCP.MTU = ptr.Of(0)
+	}
+
 	env := make(map[string]string)
 	for k, v := range d.Env {
 		env[k] = v
@@ -794,6 +1082,49 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 	}
 	y.Env = env
 
+	var modules []string
+	for _, m := range slices.Concat(d.Kernel.Modules, y.Kernel.Modules, o.Kernel.Modules) {
+		if !slices.Contains(modules, m) {
+			modules = append(modules, m)
+		}
+	}
+	y.Kernel.Modules = modules
+
+	if len(d.Sysctl)+len(y.Sysctl)+len(o.Sysctl) > 0 {
+		sysctl := make(map[string]string)
+		for k, v := range d.Sysctl {
+			sysctl[k] = v
+		}
+		for k, v := range y.Sysctl {
+			sysctl[k] = v
+		}
+		for k, v := range o.Sysctl {
+			sysctl[k] = v
+		}
+		y.Sysctl = sysctl
+	}
+
+	if len(d.Labels)+len(y.Labels)+len(o.Labels) > 0 {
+		labels := make(map[string]string)
+		for k, v := range d.Labels {
+			labels[k] = v
+		}
+		for k, v := range y.Labels {
+			labels[k] = v
+		}
+		for k, v := range o.Labels {
+			labels[k] = v
+		}
+		y.Labels = labels
+	}
+
+	if y.Profile == nil {
+		y.Profile = d.Profile
+	}
+	if o.Profile != nil {
+		y.Profile = o.Profile
+	}
+
 	param := make(map[string]string)
 	for k, v := range d.Param {
 		param[k] = v
@@ -856,6 +1187,94 @@ func FillDefault(y, d, o *LimaYAML, filePath string, warn bool) {
 		y.NestedVirtualization = ptr.Of(false)
 	}
 
+	if y.TPM == nil {
+		y.TPM = d.TPM
+	}
+	if o.TPM != nil {
+		y.TPM = o.TPM
+	}
+	if y.TPM == nil {
+		y.TPM = ptr.Of(false)
+	}
+
+	if y.Storage.Dir == nil {
+		y.Storage.Dir = d.Storage.Dir
+	}
+	if o.Storage.Dir != nil {
+		y.Storage.Dir = o.Storage.Dir
+	}
+
+	var pciAddrs []string
+	for _, addr := range append(append(d.Passthrough.PCI, y.Passthrough.PCI...), o.Passthrough.PCI...) {
+		pciAddrs = append(pciAddrs, NormalizePCIAddress(addr))
+	}
+	if len(pciAddrs) > 0 {
+		y.Passthrough.PCI = unique(pciAddrs)
+	}
+	var gpuIDs []string
+	for _, id := range append(append(d.Passthrough.GPU, y.Passthrough.GPU...), o.Passthrough.GPU...) {
+		gpuIDs = append(gpuIDs, strings.ToLower(id))
+	}
+	if len(gpuIDs) > 0 {
+		y.Passthrough.GPU = unique(gpuIDs)
+	}
+
+	var sharedMemory []SharedMemory
+	shmIndex := make(map[string]int)
+	for _, shm := range append(append(d.SharedMemory, y.SharedMemory...), o.SharedMemory...) {
+		if i, ok := shmIndex[shm.Name]; ok {
+			if shm.Size != nil {
+				sharedMemory[i].Size = shm.Size
+			}
+			continue
+		}
+		shmIndex[shm.Name] = len(sharedMemory)
+		sharedMemory = append(sharedMemory, shm)
+	}
+	for i := range sharedMemory {
+		if sharedMemory[i].Size == nil {
+			sharedMemory[i].Size = ptr.Of(DefaultSharedMemorySize)
+		}
+	}
+	y.SharedMemory = sharedMemory
+
+	if y.CloudInit.ExtraUserData == nil {
+		y.CloudInit.ExtraUserData = d.CloudInit.ExtraUserData
+	}
+	if o.CloudInit.ExtraUserData != nil {
+		y.CloudInit.ExtraUserData = o.CloudInit.ExtraUserData
+	}
+
+	if y.RestartPolicy == nil {
+		y.RestartPolicy = d.RestartPolicy
+	}
+	if o.RestartPolicy != nil {
+		y.RestartPolicy = o.RestartPolicy
+	}
+	if y.RestartPolicy == nil {
+		y.RestartPolicy = ptr.Of(RestartPolicyNo)
+	}
+
+	if y.Security.Sudo == nil {
+		y.Security.Sudo = d.Security.Sudo
+	}
+	if o.Security.Sudo != nil {
+		y.Security.Sudo = o.Security.Sudo
+	}
+	if y.Security.Sudo == nil {
+		y.Security.Sudo = ptr.Of(SudoFull)
+	}
+
+	if y.InstanceTags == nil {
+		y.InstanceTags = d.InstanceTags
+	}
+	if o.InstanceTags != nil {
+		y.InstanceTags = o.InstanceTags
+	}
+	if y.InstanceTags == nil {
+		y.InstanceTags = ptr.Of(true)
+	}
+
 	if y.Plain == nil {
 		y.Plain = d.Plain
 	}
@@ -875,8 +1294,11 @@ func fixUpForPlainMode(y *LimaYAML) {
 	}
 	y.Mounts = nil
 	y.PortForwards = nil
+	y.UDPRelays = nil
+	y.SocketForwards = nil
 	y.Containerd.System = ptr.Of(false)
 	y.Containerd.User = ptr.Of(false)
+	y.Podman.User = ptr.Of(false)
 	y.Rosetta.BinFmt = ptr.Of(false)
 	y.Rosetta.Enabled = ptr.Of(false)
 	y.TimeZone = ptr.Of("")
@@ -976,6 +1398,29 @@ func FillPortForwardDefaults(rule *PortForward, instDir string, user User, param
 	}
 }
 
+func FillSocketForwardDefaults(rule *SocketForward, instDir string, user User, param map[string]string) {
+	if rule.GuestDir != "" {
+		if out, err := executeGuestTemplate(rule.GuestDir, instDir, user, param); err == nil {
+			rule.GuestDir = out.String()
+		} else {
+			logrus.WithError(err).Warnf("Couldn't process guestDir %q as a template", rule.GuestDir)
+		}
+	}
+	if rule.HostDir != "" {
+		if out, err := executeHostTemplate(rule.HostDir, instDir, param); err == nil {
+			rule.HostDir = out.String()
+		} else {
+			logrus.WithError(err).Warnf("Couldn't process hostDir %q as a template", rule.HostDir)
+		}
+	}
+	if !filepath.IsAbs(rule.HostDir) {
+		rule.HostDir = filepath.Join(instDir, filenames.SocketDir, rule.HostDir)
+	}
+	if rule.Naming == "" {
+		rule.Naming = SocketForwardNamingRelative
+	}
+}
+
 func FillCopyToHostDefaults(rule *CopyToHost, instDir string, user User, param map[string]string) {
 	if rule.GuestFile != "" {
 		if out, err := executeGuestTemplate(rule.GuestFile, instDir, user, param); err == nil {
@@ -1026,14 +1471,19 @@ func NewArch(arch string) Arch {
 	case "arm64":
 		return AARCH64
 	case "arm":
-		arm := goarm()
-		if arm == 7 {
+		switch arm := goarm(); arm {
+		case 6:
+			return ARMV6L
+		case 7:
 			return ARMV7L
+		default:
+			logrus.Warnf("Unknown arm: %d", arm)
+			return arch
 		}
-		logrus.Warnf("Unknown arm: %d", arm)
-		return arch
 	case "riscv64":
 		return RISCV64
+	case "loong64":
+		return LOONGARCH64
 	default:
 		logrus.Warnf("Unknown arch: %s", arch)
 		return arch
@@ -1228,9 +1678,11 @@ func HasMaxCPU() bool {
 func IsNativeArch(arch Arch) bool {
 	nativeX8664 := arch == X8664 && runtime.GOARCH == "amd64"
 	nativeAARCH64 := arch == AARCH64 && runtime.GOARCH == "arm64"
+	nativeARMV6L := arch == ARMV6L && runtime.GOARCH == "arm" && goarm() == 6
 	nativeARMV7L := arch == ARMV7L && runtime.GOARCH == "arm" && goarm() == 7
 	nativeRISCV64 := arch == RISCV64 && runtime.GOARCH == "riscv64"
-	return nativeX8664 || nativeAARCH64 || nativeARMV7L || nativeRISCV64
+	nativeLOONGARCH64 := arch == LOONGARCH64 && runtime.GOARCH == "loong64"
+	return nativeX8664 || nativeAARCH64 || nativeARMV6L || nativeARMV7L || nativeRISCV64 || nativeLOONGARCH64
 }
 
 func unique(s []string) []string {
@@ -1244,3 +1696,14 @@ func unique(s []string) []string {
 	}
 	return list
 }
+
+// MountTag returns the tag of the 9p or virtiofs device for y.Mounts[index].
+// The tag defaults to "mount<index>", and can be customized with `virtiofs.tag` when mountType is "virtiofs".
+func MountTag(y *LimaYAML, index int) string {
+	if y.MountType != nil && *y.MountType == VIRTIOFS {
+		if tag := y.Mounts[index].Virtiofs.Tag; tag != nil && *tag != "" {
+			return *tag
+		}
+	}
+	return fmt.Sprintf("mount%d", index)
+}
@@ -83,6 +83,9 @@ func TestFillDefault(t *testing.T) {
 			User:     ptr.Of(true),
 			Archives: defaultContainerdArchives(),
 		},
+		Podman: Podman{
+			User: ptr.Of(false),
+		},
 		SSH: SSH{
 			LocalPort:         ptr.Of(0),
 			LoadDotSSHPubKeys: ptr.Of(false),
@@ -102,22 +105,54 @@ func TestFillDefault(t *testing.T) {
 			VNC: VNCOptions{
 				Display: ptr.Of("127.0.0.1:0,to=9"),
 			},
+			Accel: ptr.Of(false),
 		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(true),
 			IPv6:    ptr.Of(false),
 		},
+		DHCP: DHCP{
+			MTU: ptr.Of(0),
+		},
 		PropagateProxyEnv: ptr.Of(true),
 		CACertificates: CACertificates{
 			RemoveDefaults: ptr.Of(false),
 		},
+		MetadataService: MetadataService{
+			Enabled: ptr.Of(false),
+		},
+		PortForwardLimits: PortForwardLimits{
+			MaxForwards:           ptr.Of(DefaultMaxPortForwards),
+			MaxConnectionsPerPort: ptr.Of(0),
+			Bandwidth:             ptr.Of("0"),
+		},
+		CrashCapture: CrashCapture{
+			Enabled: ptr.Of(true),
+			VMCore:  ptr.Of(false),
+		},
+		SerialLog: SerialLog{
+			MaxSize:  ptr.Of("10MiB"),
+			MaxFiles: ptr.Of(2),
+		},
+		InstanceTags: ptr.Of(true),
+		PowerSaving: PowerSaving{
+			Mode:           ptr.Of(PowerSavingAuto),
+			GuestAgentTick: ptr.Of(DefaultPowerSavingGuestAgentTick),
+			Pause:          ptr.Of(false),
+		},
+		Security: Security{
+			Sudo: ptr.Of(SudoFull),
+		},
 		NestedVirtualization: ptr.Of(false),
+		TPM:                  ptr.Of(false),
+		RestartPolicy:        ptr.Of(RestartPolicyNo),
 		Plain:                ptr.Of(false),
 		User: User{
 			Name:    ptr.Of(user.Username),
 			Comment: ptr.Of(user.Name),
 			Home:    ptr.Of(user.HomeDir),
 			UID:     ptr.Of(uint32(uid)),
+			Shell:   ptr.Of("/bin/bash"),
 		},
 	}
 
@@ -167,6 +202,10 @@ func TestFillDefault(t *testing.T) {
 				HostSocket:  "{{.Home}} | {{.Dir}} | {{.Name}} | {{.UID}} | {{.User}} | {{.Param.ONE}}",
 			},
 		},
+		SocketForwards: []SocketForward{
+			{GuestDir: "{{.Home}}/project"},
+			{GuestDir: "/run/app", HostDir: "app", Naming: SocketForwardNamingBasename},
+		},
 		CopyToHost: []CopyToHost{
 			{
 				GuestFile: "{{.Home}} | {{.UID}} | {{.User}} | {{.Param.ONE}}",
@@ -226,6 +265,8 @@ func TestFillDefault(t *testing.T) {
 	expect.Mounts[0].NineP.Msize = ptr.Of(Default9pMsize)
 	expect.Mounts[0].NineP.Cache = ptr.Of(Default9pCacheForRO)
 	expect.Mounts[0].Virtiofs.QueueSize = nil
+	expect.Mounts[0].Inotify.BatchInterval = ptr.Of(DefaultInotifyBatchInterval)
+	expect.Mounts[0].Inotify.MaxEventsPerSecond = ptr.Of(0)
 	// Only missing Mounts field is Writable, and the default value is also the null value: false
 	expect.Mounts[1].Location = fmt.Sprintf("%s/%s", instDir, y.Param["ONE"])
 	expect.Mounts[1].MountPoint = ptr.Of(fmt.Sprintf("/mnt/%s", y.Param["ONE"]))
@@ -238,6 +279,8 @@ func TestFillDefault(t *testing.T) {
 	expect.Mounts[1].NineP.Msize = ptr.Of(Default9pMsize)
 	expect.Mounts[1].NineP.Cache = ptr.Of(Default9pCacheForRO)
 	expect.Mounts[1].Virtiofs.QueueSize = nil
+	expect.Mounts[1].Inotify.BatchInterval = ptr.Of(DefaultInotifyBatchInterval)
+	expect.Mounts[1].Inotify.MaxEventsPerSecond = ptr.Of(0)
 
 	expect.MountType = ptr.Of(NINEP)
 
@@ -282,6 +325,11 @@ func TestFillDefault(t *testing.T) {
 	expect.PortForwards[3].GuestSocket = fmt.Sprintf("%s | %s | %s | %s", user.HomeDir, user.Uid, user.Username, y.Param["ONE"])
 	expect.PortForwards[3].HostSocket = fmt.Sprintf("%s | %s | %s | %s | %s | %s", hostHome, instDir, instName, currentUser.Uid, currentUser.Username, y.Param["ONE"])
 
+	expect.SocketForwards = []SocketForward{
+		{GuestDir: user.HomeDir + "/project", HostDir: filepath.Join(instDir, filenames.SocketDir), Naming: SocketForwardNamingRelative},
+		{GuestDir: "/run/app", HostDir: filepath.Join(instDir, filenames.SocketDir, "app"), Naming: SocketForwardNamingBasename},
+	}
+
 	expect.CopyToHost[0].GuestFile = fmt.Sprintf("%s | %s | %s | %s", user.HomeDir, user.Uid, user.Username, y.Param["ONE"])
 	expect.CopyToHost[0].HostFile = fmt.Sprintf("%s | %s | %s | %s | %s | %s", hostHome, instDir, instName, currentUser.Uid, currentUser.Username, y.Param["ONE"])
 
@@ -306,7 +354,34 @@ func TestFillDefault(t *testing.T) {
 		BinFmt:  ptr.Of(false),
 	}
 
+	expect.MetadataService = MetadataService{
+		Enabled: ptr.Of(false),
+	}
+	expect.CrashCapture = CrashCapture{
+		Enabled: ptr.Of(true),
+		VMCore:  ptr.Of(false),
+	}
+	expect.SerialLog = SerialLog{
+		MaxSize:  ptr.Of("10MiB"),
+		MaxFiles: ptr.Of(2),
+	}
+	expect.InstanceTags = ptr.Of(true)
+	expect.PowerSaving = PowerSaving{
+		Mode:           ptr.Of(PowerSavingAuto),
+		GuestAgentTick: ptr.Of(DefaultPowerSavingGuestAgentTick),
+		Pause:          ptr.Of(false),
+	}
+	expect.PortForwardLimits = PortForwardLimits{
+		MaxForwards:           ptr.Of(DefaultMaxPortForwards),
+		MaxConnectionsPerPort: ptr.Of(0),
+		Bandwidth:             ptr.Of("0"),
+	}
+	expect.Security = Security{
+		Sudo: ptr.Of(SudoFull),
+	}
 	expect.NestedVirtualization = ptr.Of(false)
+	expect.TPM = ptr.Of(false)
+	expect.RestartPolicy = ptr.Of(RestartPolicyNo)
 
 	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath, false)
 	assert.DeepEqual(t, &y, &expect, opts...)
@@ -322,10 +397,12 @@ func TestFillDefault(t *testing.T) {
 		OS:     ptr.Of("unknown"),
 		Arch:   ptr.Of("unknown"),
 		CPUType: CPUType{
-			AARCH64: "arm64",
-			ARMV7L:  "armhf",
-			X8664:   "amd64",
-			RISCV64: "riscv64",
+			AARCH64:     "arm64",
+			ARMV6L:      "armel",
+			ARMV7L:      "armhf",
+			X8664:       "amd64",
+			RISCV64:     "riscv64",
+			LOONGARCH64: "loong64",
 		},
 		CPUs:   ptr.Of(7),
 		Memory: ptr.Of("5GiB"),
@@ -342,6 +419,9 @@ func TestFillDefault(t *testing.T) {
 				{Location: "/tmp/nerdctl.tgz"},
 			},
 		},
+		Podman: Podman{
+			User: ptr.Of(false),
+		},
 		SSH: SSH{
 			LocalPort:         ptr.Of(888),
 			LoadDotSSHPubKeys: ptr.Of(false),
@@ -369,6 +449,7 @@ func TestFillDefault(t *testing.T) {
 			VNC: VNCOptions{
 				Display: ptr.Of("none"),
 			},
+			Accel: ptr.Of(true),
 		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(false),
@@ -376,6 +457,16 @@ func TestFillDefault(t *testing.T) {
 			Hosts: map[string]string{
 				"default": "localhost",
 			},
+			Rules: []HostResolverRule{
+				{Domain: "corp.example.com", Servers: []string{"10.0.0.53"}},
+			},
+		},
+		SharedMemory: []SharedMemory{
+			{Name: "shm0", Size: ptr.Of("32MiB")},
+		},
+		DHCP: DHCP{
+			SearchDomains: []string{"d.example.com"},
+			MTU:           ptr.Of(1400),
 		},
 		PropagateProxyEnv: ptr.Of(false),
 
@@ -436,12 +527,43 @@ func TestFillDefault(t *testing.T) {
 			Enabled: ptr.Of(true),
 			BinFmt:  ptr.Of(true),
 		},
+		MetadataService: MetadataService{
+			Enabled: ptr.Of(true),
+		},
+		CrashCapture: CrashCapture{
+			Enabled: ptr.Of(true),
+			VMCore:  ptr.Of(true),
+		},
+		SerialLog: SerialLog{
+			MaxSize:  ptr.Of("1MiB"),
+			MaxFiles: ptr.Of(5),
+		},
+		InstanceTags: ptr.Of(true),
+		PowerSaving: PowerSaving{
+			Mode:           ptr.Of(PowerSavingAlways),
+			GuestAgentTick: ptr.Of("1m"),
+			Pause:          ptr.Of(true),
+		},
+		PortForwardLimits: PortForwardLimits{
+			MaxForwards:           ptr.Of(100),
+			MaxConnectionsPerPort: ptr.Of(10),
+			Bandwidth:             ptr.Of("10MiB"),
+		},
+		Security: Security{
+			Sudo: ptr.Of(SudoLimited),
+		},
 		NestedVirtualization: ptr.Of(true),
+		TPM:                  ptr.Of(true),
+		RestartPolicy:        ptr.Of(RestartPolicyOnFailure + ":3"),
 		User: User{
 			Name:    ptr.Of("xxx"),
 			Comment: ptr.Of("Foo Bar"),
 			Home:    ptr.Of("/tmp"),
 			UID:     ptr.Of(uint32(8080)),
+			Shell:   ptr.Of("/bin/zsh"),
+		},
+		Users: []AdditionalUser{
+			{Name: "alice", SSHPubKeys: []string{"ssh-ed25519 AAAA alice@example.com"}},
 		},
 	}
 
@@ -459,11 +581,23 @@ func TestFillDefault(t *testing.T) {
 	expect.Mounts[0].NineP.Msize = ptr.Of(Default9pMsize)
 	expect.Mounts[0].NineP.Cache = ptr.Of(Default9pCacheForRO)
 	expect.Mounts[0].Virtiofs.QueueSize = nil
+	expect.Mounts[0].Inotify.BatchInterval = ptr.Of(DefaultInotifyBatchInterval)
+	expect.Mounts[0].Inotify.MaxEventsPerSecond = ptr.Of(0)
 	expect.HostResolver.Hosts = map[string]string{
 		"default": d.HostResolver.Hosts["default"],
 	}
 	expect.MountType = ptr.Of(VIRTIOFS)
 	expect.MountInotify = ptr.Of(false)
+	expect.Users = []AdditionalUser{
+		{
+			Name:       "alice",
+			Comment:    ptr.Of("alice"),
+			Home:       ptr.Of("/home/alice.linux"),
+			Shell:      ptr.Of("/bin/bash"),
+			Sudo:       ptr.Of(SudoNone),
+			SSHPubKeys: []string{"ssh-ed25519 AAAA alice@example.com"},
+		},
+	}
 	expect.CACertificates.RemoveDefaults = ptr.Of(true)
 	expect.CACertificates.Certs = []string{
 		"-----BEGIN CERTIFICATE-----\nYOUR-ORGS-TRUSTED-CA-CERT\n-----END CERTIFICATE-----\n",
@@ -511,10 +645,18 @@ func TestFillDefault(t *testing.T) {
 	expect.Mounts = append(append([]Mount{}, dExpect.Mounts...), y.Mounts...)
 	expect.Networks = append(append([]Network{}, dExpect.Networks...), y.Networks...)
 
+	// y.Users is empty, so dExpect.Users is picked
+	expect.Users = dExpect.Users
+
 	expect.HostResolver.Hosts["default"] = dExpect.HostResolver.Hosts["default"]
+	expect.HostResolver.Rules = dExpect.HostResolver.Rules
+	expect.SharedMemory = dExpect.SharedMemory
 
 	// dExpect.DNS will be ignored, and not appended to y.DNS
 
+	// y.DHCP.SearchDomains is empty, so dExpect.DHCP.SearchDomains is picked
+	expect.DHCP.SearchDomains = dExpect.DHCP.SearchDomains
+
 	// "TWO" does not exist in filledDefaults.Env, so is set from dExpect.Env
 	expect.Env["TWO"] = dExpect.Env["TWO"]
 
@@ -533,10 +675,12 @@ func TestFillDefault(t *testing.T) {
 		OS:     ptr.Of(LINUX),
 		Arch:   ptr.Of(arch),
 		CPUType: CPUType{
-			AARCH64: "uber-arm",
-			ARMV7L:  "armv8",
-			X8664:   "pentium",
-			RISCV64: "sifive-u54",
+			AARCH64:     "uber-arm",
+			ARMV6L:      "arm1176",
+			ARMV7L:      "armv8",
+			X8664:       "pentium",
+			RISCV64:     "sifive-u54",
+			LOONGARCH64: "la132",
 		},
 		CPUs:   ptr.Of(12),
 		Memory: ptr.Of("7GiB"),
@@ -557,6 +701,9 @@ func TestFillDefault(t *testing.T) {
 				},
 			},
 		},
+		Podman: Podman{
+			User: ptr.Of(false),
+		},
 		SSH: SSH{
 			LocalPort:         ptr.Of(4433),
 			LoadDotSSHPubKeys: ptr.Of(true),
@@ -576,6 +723,7 @@ func TestFillDefault(t *testing.T) {
 			VNC: VNCOptions{
 				Display: ptr.Of("none"),
 			},
+			Accel: ptr.Of(false),
 		},
 		HostResolver: HostResolver{
 			Enabled: ptr.Of(false),
@@ -583,6 +731,18 @@ func TestFillDefault(t *testing.T) {
 			Hosts: map[string]string{
 				"override.": "underflow",
 			},
+			Rules: []HostResolverRule{
+				{Domain: "corp.example.com", Servers: []string{"https://dns.example.com/dns-query"}},
+			},
+		},
+		SharedMemory: []SharedMemory{
+			{Name: "shm0", Size: ptr.Of("64MiB")},
+			{Name: "shm1"},
+		},
+		DHCP: DHCP{
+			SearchDomains: []string{"o.example.com"},
+			NTPServers:    []string{"ntp.example.com"},
+			MTU:           ptr.Of(9000),
 		},
 		PropagateProxyEnv: ptr.Of(false),
 
@@ -603,6 +763,10 @@ func TestFillDefault(t *testing.T) {
 				Virtiofs: Virtiofs{
 					QueueSize: ptr.Of(2048),
 				},
+				Inotify: MountInotify{
+					Exclude:       []string{"**/node_modules/**"},
+					BatchInterval: ptr.Of("1s"),
+				},
 			},
 		},
 		MountInotify: ptr.Of(true),
@@ -629,6 +793,7 @@ func TestFillDefault(t *testing.T) {
 			{
 				Lima:      "bridged",
 				Interface: "def0",
+				StaticIP:  "192.168.105.10",
 			},
 		},
 		DNS: []net.IP{
@@ -659,12 +824,44 @@ func TestFillDefault(t *testing.T) {
 			Enabled: ptr.Of(false),
 			BinFmt:  ptr.Of(false),
 		},
+		MetadataService: MetadataService{
+			Enabled: ptr.Of(false),
+		},
+		CrashCapture: CrashCapture{
+			Enabled: ptr.Of(false),
+			VMCore:  ptr.Of(false),
+		},
+		SerialLog: SerialLog{
+			MaxSize:  ptr.Of("0"),
+			MaxFiles: ptr.Of(0),
+		},
+		InstanceTags: ptr.Of(false),
+		PowerSaving: PowerSaving{
+			Mode:           ptr.Of(PowerSavingNever),
+			GuestAgentTick: ptr.Of("2m"),
+			Pause:          ptr.Of(false),
+		},
+		PortForwardLimits: PortForwardLimits{
+			MaxForwards:           ptr.Of(0),
+			MaxConnectionsPerPort: ptr.Of(0),
+			Bandwidth:             ptr.Of("1GiB"),
+		},
+		Security: Security{
+			Sudo: ptr.Of(SudoFull),
+		},
 		NestedVirtualization: ptr.Of(false),
+		TPM:                  ptr.Of(false),
+		RestartPolicy:        ptr.Of(RestartPolicyOnFailure),
 		User: User{
 			Name:    ptr.Of("foo"),
 			Comment: ptr.Of("foo bar baz"),
 			Home:    ptr.Of("/override"),
 			UID:     ptr.Of(uint32(1122)),
+			Shell:   ptr.Of("/bin/fish"),
+		},
+		Users: []AdditionalUser{
+			{Name: "bob", UID: ptr.Of(uint32(1500))},
+			{Name: "alice", Sudo: ptr.Of(SudoFull)},
 		},
 	}
 
@@ -676,6 +873,7 @@ func TestFillDefault(t *testing.T) {
 	expect.Probes = append(append(o.Probes, y.Probes...), dExpect.Probes...)
 	expect.PortForwards = append(append(o.PortForwards, y.PortForwards...), dExpect.PortForwards...)
 	expect.CopyToHost = append(append(o.CopyToHost, y.CopyToHost...), dExpect.CopyToHost...)
+	expect.SocketForwards = append(append(o.SocketForwards, y.SocketForwards...), dExpect.SocketForwards...)
 	expect.Containerd.Archives = append(append(o.Containerd.Archives, y.Containerd.Archives...), dExpect.Containerd.Archives...)
 	expect.Containerd.Archives[3].Arch = *expect.Arch
 	expect.AdditionalDisks = append(append(o.AdditionalDisks, y.AdditionalDisks...), dExpect.AdditionalDisks...)
@@ -683,6 +881,12 @@ func TestFillDefault(t *testing.T) {
 
 	expect.HostResolver.Hosts["default"] = dExpect.HostResolver.Hosts["default"]
 	expect.HostResolver.Hosts["MY.Host"] = dExpect.HostResolver.Hosts["host.lima.internal"]
+	expect.HostResolver.Rules = slices.Concat(o.HostResolver.Rules, dExpect.HostResolver.Rules)
+	// o.SharedMemory[0] overrides the size of dExpect.SharedMemory[0]
+	expect.SharedMemory = []SharedMemory{
+		{Name: "shm0", Size: ptr.Of("64MiB")},
+		{Name: "shm1", Size: ptr.Of(DefaultSharedMemorySize)},
+	}
 
 	// o.Mounts just makes dExpect.Mounts[0] writable because the Location matches
 	expect.Mounts = append(append([]Mount{}, dExpect.Mounts...), y.Mounts...)
@@ -694,6 +898,8 @@ func TestFillDefault(t *testing.T) {
 	expect.Mounts[0].NineP.Msize = ptr.Of("8KiB")
 	expect.Mounts[0].NineP.Cache = ptr.Of("none")
 	expect.Mounts[0].Virtiofs.QueueSize = ptr.Of(2048)
+	expect.Mounts[0].Inotify.Exclude = []string{"**/node_modules/**"}
+	expect.Mounts[0].Inotify.BatchInterval = ptr.Of("1s")
 
 	expect.MountType = ptr.Of(NINEP)
 	expect.MountInotify = ptr.Of(true)
@@ -701,6 +907,7 @@ func TestFillDefault(t *testing.T) {
 	// o.Networks[1] is overriding the dExpect.Networks[0].Lima entry for the "def0" interface
 	expect.Networks = append(append(dExpect.Networks, y.Networks...), o.Networks[0])
 	expect.Networks[0].Lima = o.Networks[1].Lima
+	expect.Networks[0].StaticIP = o.Networks[1].StaticIP
 
 	// Only highest prio DNS are retained
 	expect.DNS = slices.Clone(o.DNS)
@@ -722,13 +929,81 @@ func TestFillDefault(t *testing.T) {
 	}
 	expect.Plain = ptr.Of(false)
 
+	expect.MetadataService.Enabled = ptr.Of(false)
+	expect.CrashCapture.Enabled = ptr.Of(false)
+	expect.CrashCapture.VMCore = ptr.Of(false)
+	expect.SerialLog = o.SerialLog
+	expect.InstanceTags = ptr.Of(false)
+	expect.PortForwardLimits = o.PortForwardLimits
+	expect.Security.Sudo = ptr.Of(SudoFull)
 	expect.NestedVirtualization = ptr.Of(false)
+	expect.TPM = ptr.Of(false)
+	expect.RestartPolicy = ptr.Of(RestartPolicyOnFailure)
+
+	// o.Users[1] is overriding the sudo policy of dExpect.Users[0], as the name matches
+	expect.Users = []AdditionalUser{dExpect.Users[0], {
+		Name:    "bob",
+		Comment: ptr.Of("bob"),
+		Home:    ptr.Of("/home/bob.linux"),
+		UID:     ptr.Of(uint32(1500)),
+		Shell:   ptr.Of("/bin/bash"),
+		Sudo:    ptr.Of(SudoNone),
+	}}
+	expect.Users[0].Sudo = ptr.Of(SudoFull)
 
 	FillDefault(&y, &d, &o, filePath, false)
 	assert.DeepEqual(t, &y, &expect, opts...)
 }
 
+func TestPodmanDefault(t *testing.T) {
+	y := LimaYAML{
+		Podman: Podman{User: ptr.Of(true)},
+		PortForwards: []PortForward{
+			{GuestPort: 80, HostPort: 8080},
+		},
+	}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, "/tmp/lima/instance/lima.yaml", false)
+	assert.Equal(t, len(y.PortForwards), 2)
+	assert.Equal(t, y.PortForwards[0].GuestPort, 80)
+	assert.Equal(t, y.PortForwards[1].GuestSocket, fmt.Sprintf("/run/user/%d/podman/podman.sock", *y.User.UID))
+	assert.Equal(t, y.PortForwards[1].HostSocket, "/tmp/lima/instance/sock/podman.sock")
+
+	y = LimaYAML{
+		Plain:  ptr.Of(true),
+		Podman: Podman{User: ptr.Of(true)},
+	}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, "/tmp/lima/instance/lima.yaml", false)
+	assert.Equal(t, *y.Podman.User, false)
+	assert.Equal(t, len(y.PortForwards), 0)
+}
+
 func TestContainerdDefault(t *testing.T) {
 	archives := defaultContainerdArchives()
 	assert.Assert(t, len(archives) > 0)
 }
+
+func TestKernelConfigDefault(t *testing.T) {
+	y := LimaYAML{
+		Kernel: KernelConfig{Modules: []string{"overlay", "br_netfilter"}},
+		Sysctl: map[string]string{"vm.max_map_count": "262144", "fs.inotify.max_user_watches": "524288"},
+	}
+	d := LimaYAML{
+		Kernel: KernelConfig{Modules: []string{"br_netfilter"}},
+		Sysctl: map[string]string{"vm.max_map_count": "65530"},
+	}
+	o := LimaYAML{
+		Kernel: KernelConfig{Modules: []string{"nf_conntrack"}},
+		Sysctl: map[string]string{"fs.inotify.max_user_watches": "1048576"},
+	}
+	FillDefault(&y, &d, &o, "/tmp/lima/instance/lima.yaml", false)
+	assert.DeepEqual(t, y.Kernel.Modules, []string{"br_netfilter", "overlay", "nf_conntrack"})
+	assert.DeepEqual(t, y.Sysctl, map[string]string{"vm.max_map_count": "262144", "fs.inotify.max_user_watches": "1048576"})
+}
+
+func TestLabelsDefault(t *testing.T) {
+	y := LimaYAML{Labels: map[string]string{"team": "infra", "env": "dev"}}
+	d := LimaYAML{Labels: map[string]string{"team": "default", "owner": "alice"}}
+	o := LimaYAML{Labels: map[string]string{"env": "ci"}}
+	FillDefault(&y, &d, &o, "/tmp/lima/instance/lima.yaml", false)
+	assert.DeepEqual(t, y.Labels, map[string]string{"team": "infra", "env": "ci", "owner": "alice"})
+}
@@ -1,53 +1,85 @@
 package limayaml
 
 import (
+	"fmt"
 	"net"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/opencontainers/go-digest"
 )
 
 type LimaYAML struct {
-	MinimumLimaVersion    *string       `yaml:"minimumLimaVersion,omitempty" json:"minimumLimaVersion,omitempty" jsonschema:"nullable"`
-	VMType                *VMType       `yaml:"vmType,omitempty" json:"vmType,omitempty" jsonschema:"nullable"`
-	VMOpts                VMOpts        `yaml:"vmOpts,omitempty" json:"vmOpts,omitempty"`
-	OS                    *OS           `yaml:"os,omitempty" json:"os,omitempty" jsonschema:"nullable"`
-	Arch                  *Arch         `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"nullable"`
-	Images                []Image       `yaml:"images" json:"images"` // REQUIRED
-	CPUType               CPUType       `yaml:"cpuType,omitempty" json:"cpuType,omitempty" jsonschema:"nullable"`
-	CPUs                  *int          `yaml:"cpus,omitempty" json:"cpus,omitempty" jsonschema:"nullable"`
-	Memory                *string       `yaml:"memory,omitempty" json:"memory,omitempty" jsonschema:"nullable"` // go-units.RAMInBytes
-	Disk                  *string       `yaml:"disk,omitempty" json:"disk,omitempty" jsonschema:"nullable"`     // go-units.RAMInBytes
-	AdditionalDisks       []Disk        `yaml:"additionalDisks,omitempty" json:"additionalDisks,omitempty" jsonschema:"nullable"`
-	Mounts                []Mount       `yaml:"mounts,omitempty" json:"mounts,omitempty"`
-	MountTypesUnsupported []string      `yaml:"mountTypesUnsupported,omitempty" json:"mountTypesUnsupported,omitempty" jsonschema:"nullable"`
-	MountType             *MountType    `yaml:"mountType,omitempty" json:"mountType,omitempty" jsonschema:"nullable"`
-	MountInotify          *bool         `yaml:"mountInotify,omitempty" json:"mountInotify,omitempty" jsonschema:"nullable"`
-	SSH                   SSH           `yaml:"ssh,omitempty" json:"ssh,omitempty"` // REQUIRED (FIXME)
-	Firmware              Firmware      `yaml:"firmware,omitempty" json:"firmware,omitempty"`
-	Audio                 Audio         `yaml:"audio,omitempty" json:"audio,omitempty"`
-	Video                 Video         `yaml:"video,omitempty" json:"video,omitempty"`
-	Provision             []Provision   `yaml:"provision,omitempty" json:"provision,omitempty"`
-	UpgradePackages       *bool         `yaml:"upgradePackages,omitempty" json:"upgradePackages,omitempty" jsonschema:"nullable"`
-	Containerd            Containerd    `yaml:"containerd,omitempty" json:"containerd,omitempty"`
-	GuestInstallPrefix    *string       `yaml:"guestInstallPrefix,omitempty" json:"guestInstallPrefix,omitempty" jsonschema:"nullable"`
-	Probes                []Probe       `yaml:"probes,omitempty" json:"probes,omitempty"`
-	PortForwards          []PortForward `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
-	CopyToHost            []CopyToHost  `yaml:"copyToHost,omitempty" json:"copyToHost,omitempty"`
-	Message               string        `yaml:"message,omitempty" json:"message,omitempty"`
-	Networks              []Network     `yaml:"networks,omitempty" json:"networks,omitempty" jsonschema:"nullable"`
+	MinimumLimaVersion    *string           `yaml:"minimumLimaVersion,omitempty" json:"minimumLimaVersion,omitempty" jsonschema:"nullable"`
+	Requires              Requires          `yaml:"requires,omitempty" json:"requires,omitempty"`
+	VMType                *VMType           `yaml:"vmType,omitempty" json:"vmType,omitempty" jsonschema:"nullable"`
+	VMOpts                VMOpts            `yaml:"vmOpts,omitempty" json:"vmOpts,omitempty"`
+	OS                    *OS               `yaml:"os,omitempty" json:"os,omitempty" jsonschema:"nullable"`
+	Arch                  *Arch             `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"nullable"`
+	Images                []Image           `yaml:"images" json:"images"` // REQUIRED
+	CPUType               CPUType           `yaml:"cpuType,omitempty" json:"cpuType,omitempty" jsonschema:"nullable"`
+	CPUs                  *int              `yaml:"cpus,omitempty" json:"cpus,omitempty" jsonschema:"nullable"`
+	MaxCPUs               *int              `yaml:"maxCPUs,omitempty" json:"maxCPUs,omitempty" jsonschema:"nullable"`
+	Memory                *string           `yaml:"memory,omitempty" json:"memory,omitempty" jsonschema:"nullable"` // go-units.RAMInBytes
+	Disk                  *string           `yaml:"disk,omitempty" json:"disk,omitempty" jsonschema:"nullable"`     // go-units.RAMInBytes
+	AdditionalDisks       []Disk            `yaml:"additionalDisks,omitempty" json:"additionalDisks,omitempty" jsonschema:"nullable"`
+	Storage               Storage           `yaml:"storage,omitempty" json:"storage,omitempty"`
+	Mounts                []Mount           `yaml:"mounts,omitempty" json:"mounts,omitempty"`
+	MountTypesUnsupported []string          `yaml:"mountTypesUnsupported,omitempty" json:"mountTypesUnsupported,omitempty" jsonschema:"nullable"`
+	MountType             *MountType        `yaml:"mountType,omitempty" json:"mountType,omitempty" jsonschema:"nullable"`
+	MountInotify          *bool             `yaml:"mountInotify,omitempty" json:"mountInotify,omitempty" jsonschema:"nullable"`
+	SSH                   SSH               `yaml:"ssh,omitempty" json:"ssh,omitempty"` // REQUIRED (FIXME)
+	Firmware              Firmware          `yaml:"firmware,omitempty" json:"firmware,omitempty"`
+	Audio                 Audio             `yaml:"audio,omitempty" json:"audio,omitempty"`
+	Video                 Video             `yaml:"video,omitempty" json:"video,omitempty"`
+	Provision             []Provision       `yaml:"provision,omitempty" json:"provision,omitempty"`
+	UpgradePackages       *bool             `yaml:"upgradePackages,omitempty" json:"upgradePackages,omitempty" jsonschema:"nullable"`
+	Containerd            Containerd        `yaml:"containerd,omitempty" json:"containerd,omitempty"`
+	Podman                Podman            `yaml:"podman,omitempty" json:"podman,omitempty"`
+	GuestInstallPrefix    *string           `yaml:"guestInstallPrefix,omitempty" json:"guestInstallPrefix,omitempty" jsonschema:"nullable"`
+	Probes                []Probe           `yaml:"probes,omitempty" json:"probes,omitempty"`
+	PortForwards          []PortForward     `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
+	PortForwardLimits     PortForwardLimits `yaml:"portForwardLimits,omitempty" json:"portForwardLimits,omitempty"`
+	CopyToHost            []CopyToHost      `yaml:"copyToHost,omitempty" json:"copyToHost,omitempty"`
+	UDPRelays             []UDPRelay        `yaml:"udpRelays,omitempty" json:"udpRelays,omitempty"`
+	SocketForwards        []SocketForward   `yaml:"socketForwards,omitempty" json:"socketForwards,omitempty"`
+	EgressPolicy          *EgressPolicy     `yaml:"egressPolicy,omitempty" json:"egressPolicy,omitempty" jsonschema:"nullable"`
+	MetadataService       MetadataService   `yaml:"metadataService,omitempty" json:"metadataService,omitempty"`
+	CrashCapture          CrashCapture      `yaml:"crashCapture,omitempty" json:"crashCapture,omitempty"`
+	SerialLog             SerialLog         `yaml:"serialLog,omitempty" json:"serialLog,omitempty"`
+	PowerSaving           PowerSaving       `yaml:"powerSaving,omitempty" json:"powerSaving,omitempty"`
+	InstanceTags          *bool             `yaml:"instanceTags,omitempty" json:"instanceTags,omitempty" jsonschema:"nullable"`
+	Kernel                KernelConfig      `yaml:"kernel,omitempty" json:"kernel,omitempty"`
+	Sysctl                map[string]string `yaml:"sysctl,omitempty" json:"sysctl,omitempty"`
+	Message               string            `yaml:"message,omitempty" json:"message,omitempty"`
+	Networks              []Network         `yaml:"networks,omitempty" json:"networks,omitempty" jsonschema:"nullable"`
 	// `network` was deprecated in Lima v0.7.0, removed in Lima v0.14.0. Use `networks` instead.
 	Env          map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
 	Param        map[string]string `yaml:"param,omitempty" json:"param,omitempty"`
+	Labels       map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Profile      *string           `yaml:"profile,omitempty" json:"profile,omitempty" jsonschema:"nullable"`
 	DNS          []net.IP          `yaml:"dns,omitempty" json:"dns,omitempty"`
 	HostResolver HostResolver      `yaml:"hostResolver,omitempty" json:"hostResolver,omitempty"`
+	DHCP         DHCP              `yaml:"dhcp,omitempty" json:"dhcp,omitempty"`
 	// `useHostResolver` was deprecated in Lima v0.8.1, removed in Lima v0.14.0. Use `hostResolver.enabled` instead.
-	PropagateProxyEnv    *bool          `yaml:"propagateProxyEnv,omitempty" json:"propagateProxyEnv,omitempty" jsonschema:"nullable"`
-	CACertificates       CACertificates `yaml:"caCerts,omitempty" json:"caCerts,omitempty"`
-	Rosetta              Rosetta        `yaml:"rosetta,omitempty" json:"rosetta,omitempty"`
-	Plain                *bool          `yaml:"plain,omitempty" json:"plain,omitempty" jsonschema:"nullable"`
-	TimeZone             *string        `yaml:"timezone,omitempty" json:"timezone,omitempty" jsonschema:"nullable"`
-	NestedVirtualization *bool          `yaml:"nestedVirtualization,omitempty" json:"nestedVirtualization,omitempty" jsonschema:"nullable"`
-	User                 User           `yaml:"user,omitempty" json:"user,omitempty"`
+	PropagateProxyEnv    *bool            `yaml:"propagateProxyEnv,omitempty" json:"propagateProxyEnv,omitempty" jsonschema:"nullable"`
+	CACertificates       CACertificates   `yaml:"caCerts,omitempty" json:"caCerts,omitempty"`
+	Rosetta              Rosetta          `yaml:"rosetta,omitempty" json:"rosetta,omitempty"`
+	CloudInit            CloudInit        `yaml:"cloudInit,omitempty" json:"cloudInit,omitempty"`
+	Plain                *bool            `yaml:"plain,omitempty" json:"plain,omitempty" jsonschema:"nullable"`
+	TimeZone             *string          `yaml:"timezone,omitempty" json:"timezone,omitempty" jsonschema:"nullable"`
+	NestedVirtualization *bool            `yaml:"nestedVirtualization,omitempty" json:"nestedVirtualization,omitempty" jsonschema:"nullable"`
+	TPM                  *bool            `yaml:"tpm,omitempty" json:"tpm,omitempty" jsonschema:"nullable"`
+	RestartPolicy        *RestartPolicy   `yaml:"restartPolicy,omitempty" json:"restartPolicy,omitempty" jsonschema:"nullable"`
+	User                 User             `yaml:"user,omitempty" json:"user,omitempty"`
+	Users                []AdditionalUser `yaml:"users,omitempty" json:"users,omitempty"`
+	Security             Security         `yaml:"security,omitempty" json:"security,omitempty"`
+	Passthrough          Passthrough      `yaml:"passthrough,omitempty" json:"passthrough,omitempty"`
+	SharedMemory         []SharedMemory   `yaml:"sharedMemory,omitempty" json:"sharedMemory,omitempty" jsonschema:"nullable"`
 }
 
 type (
@@ -62,15 +94,18 @@ type CPUType = map[Arch]string
 const (
 	LINUX OS = "Linux"
 
-	X8664   Arch = "x86_64"
-	AARCH64 Arch = "aarch64"
-	ARMV7L  Arch = "armv7l"
-	RISCV64 Arch = "riscv64"
+	X8664       Arch = "x86_64"
+	AARCH64     Arch = "aarch64"
+	ARMV6L      Arch = "armv6l"
+	ARMV7L      Arch = "armv7l"
+	RISCV64     Arch = "riscv64"
+	LOONGARCH64 Arch = "loongarch64"
 
 	REVSSHFS MountType = "reverse-sshfs"
 	NINEP    MountType = "9p"
 	VIRTIOFS MountType = "virtiofs"
 	WSLMount MountType = "wsl2"
+	NFS      MountType = "nfs"
 
 	QEMU VMType = "qemu"
 	VZ   VMType = "vz"
@@ -79,16 +114,93 @@ const (
 
 var (
 	OSTypes    = []OS{LINUX}
-	ArchTypes  = []Arch{X8664, AARCH64, ARMV7L, RISCV64}
-	MountTypes = []MountType{REVSSHFS, NINEP, VIRTIOFS, WSLMount}
+	ArchTypes  = []Arch{X8664, AARCH64, ARMV6L, ARMV7L, RISCV64, LOONGARCH64}
+	MountTypes = []MountType{REVSSHFS, NINEP, VIRTIOFS, WSLMount, NFS}
 	VMTypes    = []VMType{QEMU, VZ, WSL2}
 )
 
+// ExternalMountDriverPrefix is the prefix of the executables of the external mount drivers.
+// `mountType: NAME` is handled by the "lima-mount-NAME" executable in $PATH, when NAME is not a builtin mount type.
+const ExternalMountDriverPrefix = "lima-mount-"
+
+var externalMountTypeRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// IsExternalMountType returns true if the mount type is to be handled by an external mount driver.
+// The existence of the driver is not checked.
+func IsExternalMountType(mountType MountType) bool {
+	return !slices.Contains(MountTypes, mountType) && mountType != "default" && externalMountTypeRegexp.MatchString(mountType)
+}
+
 type User struct {
 	Name    *string `yaml:"name,omitempty" json:"name,omitempty" jsonschema:"nullable"`
 	Comment *string `yaml:"comment,omitempty" json:"comment,omitempty" jsonschema:"nullable"`
 	Home    *string `yaml:"home,omitempty" json:"home,omitempty" jsonschema:"nullable"`
 	UID     *uint32 `yaml:"uid,omitempty" json:"uid,omitempty" jsonschema:"nullable"`
+	Shell   *string `yaml:"shell,omitempty" json:"shell,omitempty" jsonschema:"nullable"`
+}
+
+// AdditionalUser is an account created in addition to `user`, e.g., for sharing an instance in a workshop.
+// Lima itself always connects to the instance as `user`.
+type AdditionalUser struct {
+	Name    string  `yaml:"name" json:"name"`
+	Comment *string `yaml:"comment,omitempty" json:"comment,omitempty" jsonschema:"nullable"`
+	Home    *string `yaml:"home,omitempty" json:"home,omitempty" jsonschema:"nullable"`
+	// UID is allocated by the guest when nil.
+	UID   *uint32     `yaml:"uid,omitempty" json:"uid,omitempty" jsonschema:"nullable"`
+	Shell *string     `yaml:"shell,omitempty" json:"shell,omitempty" jsonschema:"nullable"`
+	Sudo  *SudoPolicy `yaml:"sudo,omitempty" json:"sudo,omitempty" jsonschema:"nullable"`
+	// SSHPubKeys are authorized in addition to the public keys of Lima, which are used by `limactl shell --user`.
+	SSHPubKeys []string `yaml:"sshPubKeys,omitempty" json:"sshPubKeys,omitempty"`
+}
+
+type SudoPolicy = string
+
+const (
+	// SudoFull allows the user to run any command with password-less sudo.
+	SudoFull SudoPolicy = "full"
+	// SudoLimited allows password-less sudo only until the instance is ready, i.e., during the
+	// boot and the provisioning. The host agent revokes it when the instance becomes ready.
+	SudoLimited SudoPolicy = "limited"
+	// SudoNone never allows sudo.
+	SudoNone SudoPolicy = "none"
+)
+
+var SudoPolicies = []SudoPolicy{SudoFull, SudoLimited, SudoNone}
+
+type RestartPolicy = string
+
+const (
+	// RestartPolicyNo never restarts the instance automatically.
+	RestartPolicyNo RestartPolicy = "no"
+	// RestartPolicyOnFailure restarts the instance when the driver fails unexpectedly
+	// (e.g., the QEMU process has crashed or has been killed by the OOM killer).
+	// The maximum number of the restarts can be limited with "on-failure:N".
+	RestartPolicyOnFailure RestartPolicy = "on-failure"
+)
+
+// ParseRestartPolicy parses the restart policy.
+// maxRestarts is 0 when the number of the restarts is not limited.
+func ParseRestartPolicy(policy RestartPolicy) (onFailure bool, maxRestarts int, err error) {
+	if policy == RestartPolicyNo {
+		return false, 0, nil
+	}
+	s, ok := strings.CutPrefix(policy, RestartPolicyOnFailure)
+	if !ok || (s != "" && !strings.HasPrefix(s, ":")) {
+		return false, 0, fmt.Errorf("restart policy must be %q, %q, or %q, got %q", RestartPolicyNo, RestartPolicyOnFailure, RestartPolicyOnFailure+":N", policy)
+	}
+	if s == "" {
+		return true, 0, nil
+	}
+	s = strings.TrimPrefix(s, ":")
+	maxRestarts, err = strconv.Atoi(s)
+	if err != nil || maxRestarts <= 0 {
+		return false, 0, fmt.Errorf("the maximum number of the restarts must be a positive integer, got %q", s)
+	}
+	return true, maxRestarts, nil
+}
+
+type Security struct {
+	Sudo *SudoPolicy `yaml:"sudo,omitempty" json:"sudo,omitempty" jsonschema:"nullable"`
 }
 
 type VMOpts struct {
@@ -104,6 +216,45 @@ type Rosetta struct {
 	BinFmt  *bool `yaml:"binfmt,omitempty" json:"binfmt,omitempty" jsonschema:"nullable"`
 }
 
+type Storage struct {
+	// Dir is the directory for the disk images of the instances, e.g., on an external volume.
+	// The disk images of an instance are stored in "<Dir>/<INSTANCE>".
+	Dir *string `yaml:"dir,omitempty" json:"dir,omitempty" jsonschema:"nullable"`
+}
+
+type Passthrough struct {
+	// PCI is the list of the PCI addresses of the host devices passed through to the guest with VFIO,
+	// e.g., "0000:01:00.0". The devices have to be bound to the vfio-pci driver on the host.
+	PCI []string `yaml:"pci,omitempty" json:"pci,omitempty" jsonschema:"nullable"`
+	// GPU is the list of the GPUs of the host passed through to the guest with VFIO,
+	// as "VENDOR:DEVICE" IDs in hex (e.g., "10de:2684"), or "auto" for the GPUs not used for the host console.
+	// The other functions of the GPUs, e.g., the HDMI audio controllers, are passed through too.
+	GPU []string `yaml:"gpu,omitempty" json:"gpu,omitempty" jsonschema:"nullable"`
+}
+
+// SharedMemory is an inter-VM shared memory device (ivshmem-plain), backed by the host file "$LIMA_HOME/_shm/<NAME>".
+// The instances with the same name share the memory.
+type SharedMemory struct {
+	Name string  `yaml:"name" json:"name"`
+	Size *string `yaml:"size,omitempty" json:"size,omitempty" jsonschema:"nullable"` // default: "16MiB"
+}
+
+// NormalizePCIAddress normalizes the PCI address to the "DDDD:BB:DD.F" form used in sysfs,
+// e.g., "01:00.0" to "0000:01:00.0".
+func NormalizePCIAddress(addr string) string {
+	addr = strings.ToLower(addr)
+	if strings.Count(addr, ":") == 1 {
+		addr = "0000:" + addr
+	}
+	return addr
+}
+
+type CloudInit struct {
+	// ExtraUserData is a cloud-config snippet merged into the user-data generated by Lima.
+	// See ParseExtraUserData for the supported keys.
+	ExtraUserData *string `yaml:"extraUserData,omitempty" json:"extraUserData,omitempty" jsonschema:"nullable"`
+}
+
 type File struct {
 	Location string        `yaml:"location" json:"location"` // REQUIRED
 	Arch     Arch          `yaml:"arch,omitempty" json:"arch,omitempty"`
@@ -131,15 +282,35 @@ type Disk struct {
 	Format *bool    `yaml:"format,omitempty" json:"format,omitempty"`
 	FSType *string  `yaml:"fsType,omitempty" json:"fsType,omitempty"`
 	FSArgs []string `yaml:"fsArgs,omitempty" json:"fsArgs,omitempty"`
+	// MountPoint defaults to "/mnt/lima-NAME"
+	MountPoint   *string  `yaml:"mountPoint,omitempty" json:"mountPoint,omitempty"`
+	MountOptions []string `yaml:"mountOptions,omitempty" json:"mountOptions,omitempty"`
+	// CreateIfMissing creates the disk with Size and DiskFormat when it does not exist yet
+	CreateIfMissing *bool   `yaml:"createIfMissing,omitempty" json:"createIfMissing,omitempty"` // default: false
+	Size            *string `yaml:"size,omitempty" json:"size,omitempty"`
+	DiskFormat      *string `yaml:"diskFormat,omitempty" json:"diskFormat,omitempty"` // default: "qcow2"
 }
 
 type Mount struct {
-	Location   string   `yaml:"location" json:"location"` // REQUIRED
-	MountPoint *string  `yaml:"mountPoint,omitempty" json:"mountPoint,omitempty" jsonschema:"nullable"`
-	Writable   *bool    `yaml:"writable,omitempty" json:"writable,omitempty" jsonschema:"nullable"`
-	SSHFS      SSHFS    `yaml:"sshfs,omitempty" json:"sshfs,omitempty"`
-	NineP      NineP    `yaml:"9p,omitempty" json:"9p,omitempty"`
-	Virtiofs   Virtiofs `yaml:"virtiofs,omitempty" json:"virtiofs,omitempty"`
+	Location   string       `yaml:"location" json:"location"` // REQUIRED
+	MountPoint *string      `yaml:"mountPoint,omitempty" json:"mountPoint,omitempty" jsonschema:"nullable"`
+	Writable   *bool        `yaml:"writable,omitempty" json:"writable,omitempty" jsonschema:"nullable"`
+	SSHFS      SSHFS        `yaml:"sshfs,omitempty" json:"sshfs,omitempty"`
+	NineP      NineP        `yaml:"9p,omitempty" json:"9p,omitempty"`
+	Virtiofs   Virtiofs     `yaml:"virtiofs,omitempty" json:"virtiofs,omitempty"`
+	Inotify    MountInotify `yaml:"inotify,omitempty" json:"inotify,omitempty"`
+}
+
+// MountInotify configures the inotify events forwarded to the guest with `mountInotify: true`.
+type MountInotify struct {
+	// Include and Exclude are the glob patterns (with "**") of the paths relative to the mount location.
+	// An empty Include matches all the paths.
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	// BatchInterval is the interval for coalescing the events of the same path, e.g., "100ms".
+	BatchInterval *string `yaml:"batchInterval,omitempty" json:"batchInterval,omitempty" jsonschema:"nullable"`
+	// MaxEventsPerSecond is the maximum number of the events sent to the guest per second; 0 for no limit.
+	MaxEventsPerSecond *int `yaml:"maxEventsPerSecond,omitempty" json:"maxEventsPerSecond,omitempty" jsonschema:"nullable"`
 }
 
 type SFTPDriver = string
@@ -163,9 +334,47 @@ type NineP struct {
 }
 
 type Virtiofs struct {
-	QueueSize *int `yaml:"queueSize,omitempty" json:"queueSize,omitempty"`
+	QueueSize *int           `yaml:"queueSize,omitempty" json:"queueSize,omitempty"`
+	Tag       *string        `yaml:"tag,omitempty" json:"tag,omitempty" jsonschema:"nullable"`
+	Cache     *VirtiofsCache `yaml:"cache,omitempty" json:"cache,omitempty" jsonschema:"nullable"`
+	// IDMap maps the guest UIDs and GIDs to the host ones (QEMU only).
+	IDMap VirtiofsIDMap `yaml:"idmap,omitempty" json:"idmap,omitempty"`
+	// Sandbox is the sandbox mode of virtiofsd (QEMU only).
+	Sandbox *VirtiofsSandbox `yaml:"sandbox,omitempty" json:"sandbox,omitempty" jsonschema:"nullable"`
+	// ThreadPoolSize is the maximum number of the worker threads of virtiofsd (QEMU only).
+	ThreadPoolSize *int `yaml:"threadPoolSize,omitempty" json:"threadPoolSize,omitempty" jsonschema:"nullable"`
+	// RlimitNofile is the maximum number of the file descriptors of virtiofsd (QEMU only).
+	RlimitNofile *int `yaml:"rlimitNofile,omitempty" json:"rlimitNofile,omitempty" jsonschema:"nullable"`
+}
+
+type VirtiofsIDMap struct {
+	UID []IDMapping `yaml:"uid,omitempty" json:"uid,omitempty"`
+	GID []IDMapping `yaml:"gid,omitempty" json:"gid,omitempty"`
+}
+
+// IDMapping maps the range of IDs [Guest, Guest+Count) in the guest to [Host, Host+Count) on the host.
+type IDMapping struct {
+	Guest int `yaml:"guest" json:"guest"`
+	Host  int `yaml:"host" json:"host"`
+	Count int `yaml:"count" json:"count"`
 }
 
+type VirtiofsCache = string
+
+const (
+	VirtiofsCacheAuto   VirtiofsCache = "auto"
+	VirtiofsCacheAlways VirtiofsCache = "always"
+	VirtiofsCacheNever  VirtiofsCache = "never"
+)
+
+type VirtiofsSandbox = string
+
+const (
+	VirtiofsSandboxNamespace VirtiofsSandbox = "namespace"
+	VirtiofsSandboxChroot    VirtiofsSandbox = "chroot"
+	VirtiofsSandboxNone      VirtiofsSandbox = "none"
+)
+
 type SSH struct {
 	LocalPort *int `yaml:"localPort,omitempty" json:"localPort,omitempty" jsonschema:"nullable"`
 
@@ -195,10 +404,16 @@ type VNCOptions struct {
 	Display *string `yaml:"display,omitempty" json:"display,omitempty" jsonschema:"nullable"`
 }
 
+// DisplayDefaultAccelerated is the QEMU display with the 3D acceleration of the host:
+// "cocoa,gl=es" on macOS (needs ANGLE), or the OpenGL-enabled "default" on the other hosts.
+const DisplayDefaultAccelerated = "default-accelerated"
+
 type Video struct {
-	// Display is a QEMU display string
+	// Display is a QEMU display string, or DisplayDefaultAccelerated
 	Display *string    `yaml:"display,omitempty" json:"display,omitempty" jsonschema:"nullable"`
 	VNC     VNCOptions `yaml:"vnc,omitempty" json:"vnc,omitempty"`
+	// Accel enables the 3D acceleration of the virtio-gpu device
+	Accel *bool `yaml:"accel,omitempty" json:"accel,omitempty" jsonschema:"nullable"`
 }
 
 type ProvisionMode = string
@@ -214,6 +429,7 @@ const (
 type Provision struct {
 	Mode                            ProvisionMode `yaml:"mode,omitempty" json:"mode,omitempty" jsonschema:"default=system"`
 	SkipDefaultDependencyResolution *bool         `yaml:"skipDefaultDependencyResolution,omitempty" json:"skipDefaultDependencyResolution,omitempty"`
+	RerunOnParamChange              *bool         `yaml:"rerunOnParamChange,omitempty" json:"rerunOnParamChange,omitempty"`
 	Script                          string        `yaml:"script" json:"script"`
 	Playbook                        string        `yaml:"playbook,omitempty" json:"playbook,omitempty"`
 }
@@ -224,6 +440,17 @@ type Containerd struct {
 	Archives []File `yaml:"archives,omitempty" json:"archives,omitempty"`                   // default: see defaultContainerdArchives
 }
 
+type Podman struct {
+	// User enables rootless Podman, and forwards its socket to "{{.Dir}}/sock/podman.sock" on the host.
+	User *bool `yaml:"user,omitempty" json:"user,omitempty" jsonschema:"nullable"` // default: false
+}
+
+// PodmanGuestSocket and PodmanHostSocket are the sockets of rootless Podman forwarded when podman.user is enabled.
+const (
+	PodmanGuestSocket = "/run/user/{{.UID}}/podman/podman.sock"
+	PodmanHostSocket  = "{{.Dir}}/sock/podman.sock"
+)
+
 type ProbeMode = string
 
 const (
@@ -232,6 +459,7 @@ const (
 
 type Probe struct {
 	Mode        ProbeMode `yaml:"mode,omitempty" json:"mode,omitempty" jsonschema:"default=readiness"`
+	Name        string    `yaml:"name,omitempty" json:"name,omitempty"`
 	Description string    `yaml:"description,omitempty" json:"description,omitempty"`
 	Script      string    `yaml:"script,omitempty" json:"script,omitempty"`
 	Hint        string    `yaml:"hint,omitempty" json:"hint,omitempty"`
@@ -258,6 +486,139 @@ type PortForward struct {
 	Proto             Proto  `yaml:"proto,omitempty" json:"proto,omitempty"`
 	Reverse           bool   `yaml:"reverse,omitempty" json:"reverse,omitempty"`
 	Ignore            bool   `yaml:"ignore,omitempty" json:"ignore,omitempty"`
+	// HostService publishes the port as a socket-activated service of the host (launchd or systemd),
+	// registered with `limactl host-service install`, instead of forwarding it from the host agent.
+	HostService bool `yaml:"hostService,omitempty" json:"hostService,omitempty"`
+}
+
+// UDPRelay relays the datagrams sent to a UDP multicast group (or the broadcast address)
+// between the host and the guest.
+type UDPRelay struct {
+	IP    net.IP `yaml:"ip" json:"ip"`                           // REQUIRED, IPv4 multicast address or 255.255.255.255
+	Port  int    `yaml:"port" json:"port"`                       // REQUIRED
+	Proto Proto  `yaml:"proto,omitempty" json:"proto,omitempty"` // only "udp"
+}
+
+// SocketForward forwards the listening UNIX sockets created under a guest directory to the host,
+// for as long as they are listening.
+type SocketForward struct {
+	GuestDir string `yaml:"guestDir" json:"guestDir"` // REQUIRED
+	HostDir  string `yaml:"hostDir,omitempty" json:"hostDir,omitempty"`
+	// Naming is the naming policy of the host sockets
+	Naming SocketForwardNaming `yaml:"naming,omitempty" json:"naming,omitempty"`
+}
+
+type SocketForwardNaming = string
+
+const (
+	// SocketForwardNamingRelative preserves the path relative to the guest directory, e.g.,
+	// "GUESTDIR/foo/bar.sock" is forwarded to "HOSTDIR/foo/bar.sock".
+	SocketForwardNamingRelative SocketForwardNaming = "relative"
+	// SocketForwardNamingBasename only preserves the base name, e.g.,
+	// "GUESTDIR/foo/bar.sock" is forwarded to "HOSTDIR/bar.sock".
+	SocketForwardNamingBasename SocketForwardNaming = "basename"
+)
+
+// HostSocket returns the host socket for the guest socket, if the guest socket is under GuestDir.
+func (rule SocketForward) HostSocket(guestSocket string) (string, bool) {
+	dir := strings.TrimSuffix(rule.GuestDir, "/") + "/"
+	rel, ok := strings.CutPrefix(guestSocket, dir)
+	if !ok || rel == "" || slices.Contains(strings.Split(rel, "/"), "..") {
+		return "", false
+	}
+	if rule.Naming == SocketForwardNamingBasename {
+		rel = path.Base(rel)
+	}
+	return filepath.Join(rule.HostDir, filepath.FromSlash(rel)), true
+}
+
+// EgressPolicy restricts the outbound connections of the guest.
+// Deny rules take precedence over allow rules.
+// When Allow is non-empty, connections that match no allow rule are denied.
+type EgressPolicy struct {
+	Allow []EgressRule `yaml:"allow,omitempty" json:"allow,omitempty"`
+	Deny  []EgressRule `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+type EgressRule struct {
+	// `CIDR` and `Domain` are mutually exclusive; exactly one is required
+	CIDR string `yaml:"cidr,omitempty" json:"cidr,omitempty"`
+	// Domain matches the name, and its subdomains when prefixed with "*.".
+	Domain string `yaml:"domain,omitempty" json:"domain,omitempty"`
+	// Ports is the list of the destination ports. Empty means any port.
+	Ports []int `yaml:"ports,omitempty" json:"ports,omitempty"`
+}
+
+// MetadataService serves the cloud-init data of the instance over HTTP at 169.254.169.254,
+// for the images that use the NoCloud-net or Ec2 datasource instead of the cidata ISO.
+type MetadataService struct {
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty" jsonschema:"nullable"`
+}
+
+// PortForwardLimits limits the dynamic port forwarding, to protect the host from the guests
+// that listen on thousands of ports.
+type PortForwardLimits struct {
+	// MaxForwards is the maximum number of the guest ports forwarded at the same time; 0 means unlimited.
+	MaxForwards *int `yaml:"maxForwards,omitempty" json:"maxForwards,omitempty" jsonschema:"nullable"`
+	// MaxConnectionsPerPort is the maximum number of the simultaneous connections to a forwarded port; 0 means unlimited.
+	MaxConnectionsPerPort *int `yaml:"maxConnectionsPerPort,omitempty" json:"maxConnectionsPerPort,omitempty" jsonschema:"nullable"`
+	// Bandwidth is the ceiling of the bytes per second for all the forwarded connections, e.g., "100MiB"; "0" means unlimited.
+	Bandwidth *string `yaml:"bandwidth,omitempty" json:"bandwidth,omitempty" jsonschema:"nullable"`
+}
+
+// Requires is the host requirements of a template, verified by `limactl create` before creating the instance.
+type Requires struct {
+	// Memory is the minimum memory of the host, e.g., "16GiB"
+	Memory *string `yaml:"memory,omitempty" json:"memory,omitempty" jsonschema:"nullable"`
+	// Disk is the minimum free space of the filesystem of the instance directory, e.g., "100GiB"
+	Disk *string `yaml:"disk,omitempty" json:"disk,omitempty" jsonschema:"nullable"`
+	// MacOS is the minimum version of macOS, e.g., "13.5". Ignored on other hosts.
+	MacOS *string `yaml:"macOS,omitempty" json:"macOS,omitempty" jsonschema:"nullable"`
+	// Binaries are the executables that must exist on the host, as the names in $PATH or the absolute paths
+	Binaries []string `yaml:"binaries,omitempty" json:"binaries,omitempty"`
+	// VMTypes are the vmTypes supported by the template
+	VMTypes []VMType `yaml:"vmTypes,omitempty" json:"vmTypes,omitempty"`
+}
+
+// CrashCapture collects the artifacts of a guest kernel panic into the instance directory.
+type CrashCapture struct {
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty" jsonschema:"nullable"`
+	// VMCore dumps the guest memory as a kdump-compressed vmcore on a panic.
+	VMCore *bool `yaml:"vmcore,omitempty" json:"vmcore,omitempty" jsonschema:"nullable"`
+}
+
+// SerialLog limits the disk usage of the serial console logs ("serial*.log") in the instance directory.
+type SerialLog struct {
+	// MaxSize is the size at which each log is rotated, e.g., "10MiB". "0" disables the rotation.
+	MaxSize *string `yaml:"maxSize,omitempty" json:"maxSize,omitempty" jsonschema:"nullable"`
+	// MaxFiles is the number of the rotated logs retained for each log, e.g., "serial.log.1".
+	MaxFiles *int `yaml:"maxFiles,omitempty" json:"maxFiles,omitempty" jsonschema:"nullable"`
+}
+
+// PowerSaving reduces the power consumption of the instance, e.g., while the host is running on battery.
+type PowerSaving struct {
+	Mode *PowerSavingMode `yaml:"mode,omitempty" json:"mode,omitempty" jsonschema:"nullable"`
+	// GuestAgentTick is the interval of polling the events (e.g., the listening ports) in the guest while saving power.
+	GuestAgentTick *string `yaml:"guestAgentTick,omitempty" json:"guestAgentTick,omitempty" jsonschema:"nullable"`
+	// Pause pauses the instance while saving power, for the instances that are not needed on battery.
+	Pause *bool `yaml:"pause,omitempty" json:"pause,omitempty" jsonschema:"nullable"`
+}
+
+type PowerSavingMode = string
+
+const (
+	// PowerSavingAuto saves power while the host is running on battery.
+	PowerSavingAuto PowerSavingMode = "auto"
+	// PowerSavingAlways always saves power.
+	PowerSavingAlways PowerSavingMode = "always"
+	// PowerSavingNever never saves power.
+	PowerSavingNever PowerSavingMode = "never"
+)
+
+// KernelConfig is the configuration of the guest kernel, applied by the guest agent on boot.
+type KernelConfig struct {
+	// Modules are the kernel modules to be loaded, e.g., "br_netfilter".
+	Modules []string `yaml:"modules,omitempty" json:"modules,omitempty" jsonschema:"nullable"`
 }
 
 type CopyToHost struct {
@@ -277,12 +638,35 @@ type Network struct {
 	MACAddress string  `yaml:"macAddress,omitempty" json:"macAddress,omitempty"`
 	Interface  string  `yaml:"interface,omitempty" json:"interface,omitempty"`
 	Metric     *uint32 `yaml:"metric,omitempty" json:"metric,omitempty"`
+	// StaticIP is the IPv4 address of the instance on a "host" or "shared" network, instead of DHCP.
+	StaticIP string `yaml:"staticIP,omitempty" json:"staticIP,omitempty"`
 }
 
 type HostResolver struct {
-	Enabled *bool             `yaml:"enabled,omitempty" json:"enabled,omitempty" jsonschema:"nullable"`
-	IPv6    *bool             `yaml:"ipv6,omitempty" json:"ipv6,omitempty" jsonschema:"nullable"`
-	Hosts   map[string]string `yaml:"hosts,omitempty" json:"hosts,omitempty" jsonschema:"nullable"`
+	Enabled *bool              `yaml:"enabled,omitempty" json:"enabled,omitempty" jsonschema:"nullable"`
+	IPv6    *bool              `yaml:"ipv6,omitempty" json:"ipv6,omitempty" jsonschema:"nullable"`
+	Hosts   map[string]string  `yaml:"hosts,omitempty" json:"hosts,omitempty" jsonschema:"nullable"`
+	Rules   []HostResolverRule `yaml:"rules,omitempty" json:"rules,omitempty" jsonschema:"nullable"`
+}
+
+// HostResolverRule routes the queries for a domain and its subdomains to explicit upstream servers,
+// instead of the host resolver.
+type HostResolverRule struct {
+	// Domain is the domain suffix, e.g., "corp.example.com".
+	Domain string `yaml:"domain" json:"domain"`
+	// Servers are tried in order: "IP", "IP:PORT", or a DNS-over-HTTPS URL, e.g., "https://dns.example.com/dns-query".
+	Servers []string `yaml:"servers" json:"servers"`
+}
+
+// DHCP is the network configuration delivered to the guest by the DHCP server of the user-mode network,
+// and by the network configuration of cloud-init for the other networks.
+type DHCP struct {
+	// SearchDomains are the DNS search domains of the guest, e.g., "corp.example.com".
+	SearchDomains []string `yaml:"searchDomains,omitempty" json:"searchDomains,omitempty" jsonschema:"nullable"`
+	// NTPServers are the NTP servers of the guest.
+	NTPServers []string `yaml:"ntpServers,omitempty" json:"ntpServers,omitempty" jsonschema:"nullable"`
+	// MTU is the MTU of the network interfaces of the guest. 0 means the default of the network.
+	MTU *int `yaml:"mtu,omitempty" json:"mtu,omitempty" jsonschema:"nullable"` // default: 0
 }
 
 type CACertificates struct {
@@ -3,6 +3,7 @@ package limayaml
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -40,3 +41,22 @@ func TestDefaultYAML(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, string(b), defaultYAML)
 }
+
+func TestSocketForwardHostSocket(t *testing.T) {
+	hostDir := filepath.Join(t.TempDir(), "sock")
+	relative := SocketForward{GuestDir: "/home/foo/project/", HostDir: hostDir, Naming: SocketForwardNamingRelative}
+	basename := SocketForward{GuestDir: "/home/foo/project", HostDir: hostDir, Naming: SocketForwardNamingBasename}
+
+	host, ok := relative.HostSocket("/home/foo/project/run/app.sock")
+	assert.Assert(t, ok)
+	assert.Equal(t, host, filepath.Join(hostDir, "run", "app.sock"))
+
+	host, ok = basename.HostSocket("/home/foo/project/run/app.sock")
+	assert.Assert(t, ok)
+	assert.Equal(t, host, filepath.Join(hostDir, "app.sock"))
+
+	for _, guestSocket := range []string{"/home/foo/project", "/home/foo/project2/app.sock", "/run/app.sock", "/home/foo/project/../app.sock"} {
+		_, ok = relative.HostSocket(guestSocket)
+		assert.Assert(t, !ok, guestSocket)
+	}
+}
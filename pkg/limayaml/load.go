@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/containerd/containerd/identifiers"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/sirupsen/logrus"
@@ -48,16 +49,48 @@ func load(b []byte, filePath string, warn bool) (*LimaYAML, error) {
 	}
 
 	overridePath := filepath.Join(configDir, filenames.Override)
-	bytes, err = os.ReadFile(overridePath)
+	overrideBytes, err := os.ReadFile(overridePath)
 	if err == nil {
 		logrus.Debugf("Mixing %q into %q", overridePath, filePath)
-		if err := Unmarshal(bytes, &o, fmt.Sprintf("override file %q", overridePath)); err != nil {
+		if err := Unmarshal(overrideBytes, &o, fmt.Sprintf("override file %q", overridePath)); err != nil {
 			return nil, err
 		}
 	} else if !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
 
+	if profile := profileName(&y, &d, &o); profile != "" {
+		profilePath, err := ProfilePath(profile)
+		if err != nil {
+			return nil, err
+		}
+		bytes, err := os.ReadFile(profilePath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("profile %q does not exist (expected %q)", profile, profilePath)
+			}
+			return nil, err
+		}
+		var p LimaYAML
+		if err := Unmarshal(bytes, &p, fmt.Sprintf("profile file %q", profilePath)); err != nil {
+			return nil, err
+		}
+		if p.Profile != nil {
+			return nil, fmt.Errorf("profile file %q must not set `profile`", profilePath)
+		}
+		logrus.Debugf("Mixing %q into %q", profilePath, filePath)
+		// The profile is an override with a lower priority than override.yaml
+		if len(overrideBytes) > 0 {
+			if bytes, err = MergeOverride(bytes, overrideBytes); err != nil {
+				return nil, fmt.Errorf("failed to merge %q into %q: %w", overridePath, profilePath, err)
+			}
+		}
+		o = LimaYAML{}
+		if err := Unmarshal(bytes, &o, fmt.Sprintf("profile file %q with override file %q", profilePath, overridePath)); err != nil {
+			return nil, err
+		}
+	}
+
 	// It should be called before the `y` parameter is passed to FillDefault() that execute template.
 	if err := ValidateParamIsUsed(&y); err != nil {
 		return nil, err
@@ -66,3 +99,25 @@ func load(b []byte, filePath string, warn bool) (*LimaYAML, error) {
 	FillDefault(&y, &d, &o, filePath, warn)
 	return &y, nil
 }
+
+// profileName returns the name of the profile, with the same precedence as FillDefault.
+func profileName(y, d, o *LimaYAML) string {
+	for _, p := range []*string{o.Profile, y.Profile, d.Profile} {
+		if p != nil {
+			return *p
+		}
+	}
+	return ""
+}
+
+// ProfilePath returns the path of the profile, "$LIMA_HOME/_config/profiles/NAME.yaml".
+func ProfilePath(name string) (string, error) {
+	if err := identifiers.Validate(name); err != nil {
+		return "", fmt.Errorf("invalid profile name %q: %w", name, err)
+	}
+	configDir, err := dirnames.LimaConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, filenames.ProfilesDir, name+".yaml"), nil
+}
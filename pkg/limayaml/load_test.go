@@ -1,6 +1,8 @@
 package limayaml
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -65,3 +67,57 @@ additionalDisks:
 	assert.Equal(t, y.AdditionalDisks[0].FSArgs[0], "-i")
 	assert.Equal(t, y.AdditionalDisks[0].FSArgs[1], "size=512")
 }
+
+func TestLoadProfile(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	configDir := filepath.Join(limaHome, "_config")
+	assert.NilError(t, os.MkdirAll(filepath.Join(configDir, "profiles"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(configDir, "default.yaml"), []byte("cpus: 1\nmemory: 1GiB\ndisk: 10GiB\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(configDir, "profiles", "work.yaml"), []byte(`cpus: 8
+memory: 8GiB
+env:
+  PROFILE: work
+mounts:
+- location: /work
+`), 0o644))
+
+	s := `
+profile: work
+cpus: 2
+env:
+  FOO: foo
+  PROFILE: none
+`
+	y, err := Load([]byte(s), "profile.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, *y.Profile, "work")
+	assert.Equal(t, *y.CPUs, 8)
+	assert.Equal(t, *y.Memory, "8GiB")
+	assert.Equal(t, *y.Disk, "10GiB")
+	assert.DeepEqual(t, y.Env, map[string]string{"FOO": "foo", "PROFILE": "work"})
+	assert.Equal(t, y.Mounts[0].Location, "/work")
+
+	// override.yaml takes precedence over the profile
+	assert.NilError(t, os.WriteFile(filepath.Join(configDir, "override.yaml"), []byte("memory: 4GiB\n"), 0o644))
+	y, err = Load([]byte(s), "profile.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, *y.CPUs, 8)
+	assert.Equal(t, *y.Memory, "4GiB")
+
+	assert.NilError(t, os.WriteFile(filepath.Join(configDir, "profiles", "empty.yaml"), []byte("# empty\n"), 0o644))
+	y, err = Load([]byte("profile: empty\n"), "profile.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, *y.CPUs, 1)
+	assert.Equal(t, *y.Memory, "4GiB")
+
+	// An empty profile name disables the profile
+	y, err = Load([]byte("profile: \"\"\ncpus: 2\n"), "profile.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, *y.CPUs, 2)
+
+	_, err = Load([]byte("profile: home\n"), "profile.yaml")
+	assert.ErrorContains(t, err, `profile "home" does not exist`)
+	_, err = Load([]byte("profile: ../work\n"), "profile.yaml")
+	assert.ErrorContains(t, err, "invalid profile name")
+}
@@ -0,0 +1,96 @@
+package limayaml
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/yqutil"
+)
+
+// MergeOverride merges the override YAML into b, following the same precedence rules
+// as $LIMA_HOME/_config/override.yaml in FillDefault:
+//
+//   - Scalars in the override replace the values in b.
+//   - Maps are merged recursively.
+//   - Slices are combined, starting with the override entries, followed by the entries in b.
+//   - Exceptions: `mounts` and `networks` are combined in the opposite order, so that the override
+//     entries take precedence over the entries in b with the same `location` or `interface`,
+//     and `dns` replaces the list in b.
+//
+// The comments in b are preserved. b is returned as is when the override is empty,
+// and the override is returned as is when b is empty.
+func MergeOverride(b, override []byte) ([]byte, error) {
+	expr, err := overrideExpression(override)
+	if err != nil {
+		return nil, err
+	}
+	if expr == "" {
+		return b, nil
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		// yq cannot merge into an empty document
+		return override, nil
+	}
+	content := strings.TrimSuffix(string(b), "\n") + "\n---\n" + string(override)
+	return yqutil.EvaluateExpression(expr, []byte(content))
+}
+
+// overrideExpression returns the yq expression to merge the second document (the override) into the first one.
+// It returns an empty string when the override is empty.
+func overrideExpression(override []byte) (string, error) {
+	var o map[string]any
+	if err := yaml.Unmarshal(override, &o); err != nil {
+		return "", fmt.Errorf("failed to parse the override: %w", err)
+	}
+	if len(o) == 0 {
+		return "", nil
+	}
+	exprs := []string{"select(documentIndex == 1) as $o", "select(documentIndex == 0)"}
+	for _, p := range slicePaths(o, nil) {
+		var sb strings.Builder
+		for _, k := range p {
+			fmt.Fprintf(&sb, "[%s]", strconv.Quote(k))
+		}
+		path := "." + sb.String()
+		oPath := fmt.Sprintf("($o | %s // [])", path)
+		yPath := fmt.Sprintf("(%s // [])", path)
+		switch {
+		case len(p) == 1 && (p[0] == "mounts" || p[0] == "networks"):
+			exprs = append(exprs, fmt.Sprintf("%s = (%s + %s)", path, yPath, oPath))
+		case len(p) == 1 && p[0] == "dns":
+			exprs = append(exprs, fmt.Sprintf("%s = %s", path, oPath))
+		default:
+			exprs = append(exprs, fmt.Sprintf("%s = (%s + %s)", path, oPath, yPath))
+		}
+	}
+	// The slices are removed from $o in place, so this has to be the last step
+	exprs = append(exprs, `. * ($o | del(.. | select(tag == "!!seq")))`)
+	return yqutil.Join(exprs), nil
+}
+
+// slicePaths returns the paths of the slices in m, without descending into the slices.
+func slicePaths(m map[string]any, prefix []string) [][]string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var res [][]string
+	for _, k := range keys {
+		p := append(append([]string{}, prefix...), k)
+		switch v := m[k].(type) {
+		case []any:
+			res = append(res, p)
+		case map[string]any:
+			res = append(res, slicePaths(v, p)...)
+		}
+	}
+	return res
+}
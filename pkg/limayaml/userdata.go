@@ -0,0 +1,130 @@
+package limayaml
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/goccy/go-yaml"
+)
+
+// extraUserDataListKeys are the cloud-config keys of `cloudInit.extraUserData`
+// that are appended to the lists generated by Lima.
+var extraUserDataListKeys = []string{"bootcmd", "packages", "runcmd", "write_files"}
+
+// extraUserDataKeys are the other cloud-config keys of `cloudInit.extraUserData`.
+// They cannot be merged, so they must not be generated by Lima too.
+var extraUserDataKeys = []string{
+	"apt", "keyboard", "locale", "ntp", "package_reboot_if_required", "package_update", "package_upgrade", "snap", "yum_repos",
+}
+
+// IsExtraUserDataListKey returns true if the value of the key is appended to the list generated by Lima.
+func IsExtraUserDataListKey(key string) bool {
+	return slices.Contains(extraUserDataListKeys, key)
+}
+
+// ParseExtraUserData parses and validates `cloudInit.extraUserData`.
+// The keys are kept in order.
+func ParseExtraUserData(s string) (yaml.MapSlice, error) {
+	var v any
+	if err := yaml.UnmarshalWithOptions([]byte(s), &v, yaml.UseOrderedMap()); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("must be a map, got %T", v)
+	}
+	for _, item := range m {
+		key, ok := item.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("key %v must be a string", item.Key)
+		}
+		switch {
+		case IsExtraUserDataListKey(key):
+			if err := validateExtraUserDataList(key, item.Value); err != nil {
+				return nil, err
+			}
+		case slices.Contains(extraUserDataKeys, key):
+		default:
+			return nil, fmt.Errorf("key %q is not supported, must be one of %v", key, append(slices.Clone(extraUserDataListKeys), extraUserDataKeys...))
+		}
+	}
+	return m, nil
+}
+
+func validateExtraUserDataList(key string, value any) error {
+	list, ok := value.([]any)
+	if !ok {
+		return fmt.Errorf("`%s` must be a list, got %T", key, value)
+	}
+	for i, x := range list {
+		field := fmt.Sprintf("%s[%d]", key, i)
+		switch key {
+		case "write_files":
+			f, ok := x.(yaml.MapSlice)
+			if !ok {
+				return fmt.Errorf("`%s` must be a map, got %T", field, x)
+			}
+			if err := validateExtraUserDataWriteFile(field, f); err != nil {
+				return err
+			}
+		default:
+			// "bootcmd" and "runcmd" accept a shell string or an argv list,
+			// and "packages" accepts a package name or a [name, version] list
+			if err := validateStringOrStrings(field, x); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateExtraUserDataWriteFile(field string, f yaml.MapSlice) error {
+	var hasPath bool
+	for _, item := range f {
+		switch item.Key {
+		case "path":
+			p, ok := item.Value.(string)
+			if !ok || !path.IsAbs(p) {
+				return fmt.Errorf("`%s.path` must be an absolute path, got %v", field, item.Value)
+			}
+			hasPath = true
+		case "content", "owner", "permissions", "encoding":
+			if _, ok := item.Value.(string); !ok {
+				return fmt.Errorf("`%s.%v` must be a string, got %T", field, item.Key, item.Value)
+			}
+		case "append", "defer":
+			if _, ok := item.Value.(bool); !ok {
+				return fmt.Errorf("`%s.%v` must be a boolean, got %T", field, item.Key, item.Value)
+			}
+		default:
+			return fmt.Errorf("`%s.%v` is not supported", field, item.Key)
+		}
+	}
+	if !hasPath {
+		return fmt.Errorf("`%s.path` must be set", field)
+	}
+	return nil
+}
+
+func validateStringOrStrings(field string, x any) error {
+	switch x := x.(type) {
+	case string:
+		return nil
+	case []any:
+		if len(x) == 0 {
+			return fmt.Errorf("`%s` must not be empty", field)
+		}
+		for _, s := range x {
+			if _, ok := s.(string); !ok {
+				return fmt.Errorf("`%s` must be a list of strings, got an element of %T", field, s)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("`%s` must be a string or a list of strings, got %T", field, x)
+	}
+}
@@ -4,16 +4,26 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/containerd/containerd/identifiers"
+	"github.com/containerd/containerd/reference/docker"
 	"github.com/coreos/go-semver/semver"
 	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/guestagent/kernelconfig"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/osutil"
@@ -23,16 +33,18 @@ import (
 )
 
 func validateFileObject(f File, fieldName string) error {
-	if !strings.Contains(f.Location, "://") {
+	if ref, ok := strings.CutPrefix(f.Location, "oci://"); ok {
+		if _, err := docker.ParseDockerRef(ref); err != nil {
+			return fmt.Errorf("field `%s.location` refers to an invalid OCI reference: %q: %w", fieldName, f.Location, err)
+		}
+	} else if !strings.Contains(f.Location, "://") {
 		if _, err := localpathutil.Expand(f.Location); err != nil {
 			return fmt.Errorf("field `%s.location` refers to an invalid local file path: %q: %w", fieldName, f.Location, err)
 		}
 		// f.Location does NOT need to be accessible, so we do NOT check os.Stat(f.Location)
 	}
-	switch f.Arch {
-	case X8664, AARCH64, ARMV7L, RISCV64:
-	default:
-		return fmt.Errorf("field `arch` must be %q, %q, %q, or %q; got %q", X8664, AARCH64, ARMV7L, RISCV64, f.Arch)
+	if !slices.Contains(ArchTypes, f.Arch) {
+		return fmt.Errorf("field `arch` must be one of %v; got %q", ArchTypes, f.Arch)
 	}
 	if f.Digest != "" {
 		if !f.Digest.Algorithm().Available() {
@@ -58,6 +70,9 @@ func Validate(y *LimaYAML, warn bool) error {
 			return fmt.Errorf("template requires Lima version %q; this is only %q", *y.MinimumLimaVersion, limaVersion.String())
 		}
 	}
+	if err := validateRequires(y.Requires); err != nil {
+		return err
+	}
 	if y.VMOpts.QEMU.MinimumVersion != nil {
 		if _, err := semver.NewVersion(*y.VMOpts.QEMU.MinimumVersion); err != nil {
 			return fmt.Errorf("field `vmOpts.qemu.minimumVersion` must be a semvar value, got %q: %w", *y.VMOpts.QEMU.MinimumVersion, err)
@@ -68,10 +83,8 @@ func Validate(y *LimaYAML, warn bool) error {
 	default:
 		return fmt.Errorf("field `os` must be %q; got %q", LINUX, *y.OS)
 	}
-	switch *y.Arch {
-	case X8664, AARCH64, ARMV7L, RISCV64:
-	default:
-		return fmt.Errorf("field `arch` must be %q, %q, %q or %q; got %q", X8664, AARCH64, ARMV7L, RISCV64, *y.Arch)
+	if !slices.Contains(ArchTypes, *y.Arch) {
+		return fmt.Errorf("field `arch` must be one of %v; got %q", ArchTypes, *y.Arch)
 	}
 
 	switch *y.VMType {
@@ -116,10 +129,7 @@ func Validate(y *LimaYAML, warn bool) error {
 	}
 
 	for arch := range y.CPUType {
-		switch arch {
-		case AARCH64, X8664, ARMV7L, RISCV64:
-			// these are the only supported architectures
-		default:
+		if !slices.Contains(ArchTypes, arch) {
 			return fmt.Errorf("field `cpuType` uses unsupported arch %q", arch)
 		}
 	}
@@ -127,6 +137,9 @@ func Validate(y *LimaYAML, warn bool) error {
 	if *y.CPUs == 0 {
 		return errors.New("field `cpus` must be set")
 	}
+	if y.MaxCPUs != nil && *y.MaxCPUs < *y.CPUs {
+		return fmt.Errorf("field `maxCPUs` must be greater than or equal to `cpus` (%d), got %d", *y.CPUs, *y.MaxCPUs)
+	}
 
 	if _, err := units.RAMInBytes(*y.Memory); err != nil {
 		return fmt.Errorf("field `memory` has an invalid value: %w", err)
@@ -165,6 +178,111 @@ func Validate(y *LimaYAML, warn bool) error {
 		if _, err := units.RAMInBytes(*f.NineP.Msize); err != nil {
 			return fmt.Errorf("field `msize` has an invalid value: %w", err)
 		}
+
+		if f.Virtiofs.Tag != nil {
+			// VZ limits the tag to 36 bytes
+			if !virtiofsTagRegexp.MatchString(*f.Virtiofs.Tag) || len(*f.Virtiofs.Tag) > 36 {
+				return fmt.Errorf("field `mounts[%d].virtiofs.tag` must match %s and must not be longer than 36 bytes, got %q", i, virtiofsTagRegexp.String(), *f.Virtiofs.Tag)
+			}
+			if *f.Virtiofs.Tag == "vz-rosetta" {
+				return fmt.Errorf("field `mounts[%d].virtiofs.tag` must not be %q, which is reserved for Rosetta", i, *f.Virtiofs.Tag)
+			}
+		}
+		if f.Virtiofs.Cache != nil {
+			switch *f.Virtiofs.Cache {
+			case VirtiofsCacheAuto, VirtiofsCacheAlways, VirtiofsCacheNever:
+			default:
+				return fmt.Errorf("field `mounts[%d].virtiofs.cache` must be %q, %q, or %q, got %q",
+					i, VirtiofsCacheAuto, VirtiofsCacheAlways, VirtiofsCacheNever, *f.Virtiofs.Cache)
+			}
+			if warn && *y.VMType == VZ {
+				logrus.Warnf("field `mounts[%d].virtiofs.cache` is ignored for vmType %q, as the caching policy of VZ cannot be configured", i, VZ)
+			}
+		}
+		if err := validateIDMappings(f.Virtiofs.IDMap.UID, fmt.Sprintf("mounts[%d].virtiofs.idmap.uid", i)); err != nil {
+			return err
+		}
+		if err := validateIDMappings(f.Virtiofs.IDMap.GID, fmt.Sprintf("mounts[%d].virtiofs.idmap.gid", i)); err != nil {
+			return err
+		}
+		if warn && *y.VMType == VZ && (len(f.Virtiofs.IDMap.UID) > 0 || len(f.Virtiofs.IDMap.GID) > 0) {
+			logrus.Warnf("field `mounts[%d].virtiofs.idmap` is ignored for vmType %q, as VZ does not support mapping the IDs", i, VZ)
+		}
+		if f.Virtiofs.Sandbox != nil {
+			switch *f.Virtiofs.Sandbox {
+			case VirtiofsSandboxNamespace, VirtiofsSandboxChroot, VirtiofsSandboxNone:
+			default:
+				return fmt.Errorf("field `mounts[%d].virtiofs.sandbox` must be %q, %q, or %q, got %q",
+					i, VirtiofsSandboxNamespace, VirtiofsSandboxChroot, VirtiofsSandboxNone, *f.Virtiofs.Sandbox)
+			}
+		}
+		if f.Virtiofs.ThreadPoolSize != nil && *f.Virtiofs.ThreadPoolSize < 0 {
+			return fmt.Errorf("field `mounts[%d].virtiofs.threadPoolSize` must not be negative, got %d", i, *f.Virtiofs.ThreadPoolSize)
+		}
+		if f.Virtiofs.RlimitNofile != nil && *f.Virtiofs.RlimitNofile < 0 {
+			return fmt.Errorf("field `mounts[%d].virtiofs.rlimitNofile` must not be negative, got %d", i, *f.Virtiofs.RlimitNofile)
+		}
+		if warn && *y.VMType == VZ && (f.Virtiofs.Sandbox != nil || f.Virtiofs.ThreadPoolSize != nil || f.Virtiofs.RlimitNofile != nil) {
+			logrus.Warnf("field `mounts[%d].virtiofs.{sandbox,threadPoolSize,rlimitNofile}` is ignored for vmType %q, as VZ does not use virtiofsd", i, VZ)
+		}
+		if err := validateMountInotify(f.Inotify, fmt.Sprintf("mounts[%d].inotify", i)); err != nil {
+			return err
+		}
+	}
+
+	mountTags := make(map[string]int)
+	for i := range y.Mounts {
+		tag := MountTag(y, i)
+		if j, ok := mountTags[tag]; ok {
+			return fmt.Errorf("field `mounts[%d].virtiofs.tag` must be unique, but %q is also used by `mounts[%d]`", i, tag, j)
+		}
+		mountTags[tag] = i
+	}
+
+	// The entries with the same name have been merged by FillDefault
+	for i, shm := range y.SharedMemory {
+		if err := identifiers.Validate(shm.Name); err != nil {
+			return fmt.Errorf("field `sharedMemory[%d].name` is invalid: %w", i, err)
+		}
+		if shm.Size != nil {
+			size, err := units.RAMInBytes(*shm.Size)
+			if err != nil {
+				return fmt.Errorf("field `sharedMemory[%d].size` has an invalid value: %w", i, err)
+			}
+			// The size of a PCI BAR must be a power of 2
+			if size < 1<<20 || size&(size-1) != 0 {
+				return fmt.Errorf("field `sharedMemory[%d].size` must be a power of 2 and at least 1MiB, got %q", i, *shm.Size)
+			}
+		}
+	}
+
+	for i, d := range y.AdditionalDisks {
+		if d.MountPoint != nil && !path.IsAbs(*d.MountPoint) {
+			return fmt.Errorf("field `additionalDisks[%d].mountPoint` must be an absolute path, got %q", i, *d.MountPoint)
+		}
+		if d.MountPoint != nil && strings.ContainsAny(*d.MountPoint, " \t\n") {
+			return fmt.Errorf("field `additionalDisks[%d].mountPoint` must not contain a space, got %q", i, *d.MountPoint)
+		}
+		for _, opt := range d.MountOptions {
+			if opt == "" || strings.ContainsAny(opt, ", \t\n") {
+				return fmt.Errorf("field `additionalDisks[%d].mountOptions` must not contain an empty option or an option with a comma or a space, got %q", i, opt)
+			}
+		}
+		if d.CreateIfMissing != nil && *d.CreateIfMissing && d.Size == nil {
+			return fmt.Errorf("field `additionalDisks[%d].size` must be set when `createIfMissing` is true", i)
+		}
+		if d.Size != nil {
+			if _, err := units.RAMInBytes(*d.Size); err != nil {
+				return fmt.Errorf("field `additionalDisks[%d].size` has an invalid value: %w", i, err)
+			}
+		}
+		if d.DiskFormat != nil {
+			switch *d.DiskFormat {
+			case "qcow2", "raw":
+			default:
+				return fmt.Errorf("field `additionalDisks[%d].diskFormat` must be \"qcow2\" or \"raw\", got %q", i, *d.DiskFormat)
+			}
+		}
 	}
 
 	if *y.SSH.LocalPort != 0 {
@@ -174,9 +292,15 @@ func Validate(y *LimaYAML, warn bool) error {
 	}
 
 	switch *y.MountType {
-	case REVSSHFS, NINEP, VIRTIOFS, WSLMount:
+	case REVSSHFS, NINEP, VIRTIOFS, WSLMount, NFS:
 	default:
-		return fmt.Errorf("field `mountType` must be %q or %q or %q, or %q, got %q", REVSSHFS, NINEP, VIRTIOFS, WSLMount, *y.MountType)
+		if !IsExternalMountType(*y.MountType) {
+			return fmt.Errorf("field `mountType` must be %q or %q or %q, or %q, or %q, or the name of an external mount driver (\"%sNAME\"), got %q",
+				REVSSHFS, NINEP, VIRTIOFS, WSLMount, NFS, ExternalMountDriverPrefix, *y.MountType)
+		}
+		if _, err := exec.LookPath(ExternalMountDriverPrefix + *y.MountType); err != nil {
+			return fmt.Errorf("field `mountType`: external mount driver %q is not found in $PATH: %w", ExternalMountDriverPrefix+*y.MountType, err)
+		}
 	}
 
 	for _, f := range y.MountTypesUnsupported {
@@ -185,6 +309,10 @@ func Validate(y *LimaYAML, warn bool) error {
 		}
 	}
 
+	if err := validateDriverCapabilities(y, warn); err != nil {
+		return err
+	}
+
 	if warn && runtime.GOOS != "linux" {
 		for i, mount := range y.Mounts {
 			if mount.Virtiofs.QueueSize != nil {
@@ -208,6 +336,10 @@ func Validate(y *LimaYAML, warn bool) error {
 			return fmt.Errorf("field `provision[%d].mode` must one of %q, %q, %q, %q, or %q",
 				i, ProvisionModeSystem, ProvisionModeUser, ProvisionModeBoot, ProvisionModeDependency, ProvisionModeAnsible)
 		}
+		if p.RerunOnParamChange != nil && p.Mode != ProvisionModeSystem && p.Mode != ProvisionModeUser {
+			return fmt.Errorf("field `provision[%d].mode` cannot set rerunOnParamChange, only valid on scripts of type %q or %q",
+				i, ProvisionModeSystem, ProvisionModeUser)
+		}
 		if p.Playbook != "" {
 			if p.Mode != ProvisionModeAnsible {
 				return fmt.Errorf("field `provision[%d].mode must be %q if playbook is set", i, ProvisionModeAnsible)
@@ -235,7 +367,14 @@ func Validate(y *LimaYAML, warn bool) error {
 			}
 		}
 	}
+	probeNames := make(map[string]int)
 	for i, p := range y.Probes {
+		if p.Name != "" {
+			if j, ok := probeNames[p.Name]; ok {
+				return fmt.Errorf("field `probe[%d].name` must be unique, but %q is also used by `probe[%d]`", i, p.Name, j)
+			}
+			probeNames[p.Name] = i
+		}
 		if !strings.HasPrefix(p.Script, "#!") {
 			return fmt.Errorf("field `probe[%d].script` must start with a '#!' line", i)
 		}
@@ -323,9 +462,131 @@ func Validate(y *LimaYAML, warn bool) error {
 		if rule.Reverse && rule.HostSocket == "" {
 			return fmt.Errorf("field `%s.reverse` must be %t", field, false)
 		}
+		if rule.HostService {
+			if rule.GuestSocket != "" || rule.HostSocket != "" || rule.GuestPortRange[0] != rule.GuestPortRange[1] {
+				return fmt.Errorf("field `%s.hostService` requires a single `guestPort` and `hostPort`", field)
+			}
+			if rule.Proto != ProtoTCP || rule.Reverse || rule.Ignore {
+				return fmt.Errorf("field `%s.hostService` requires `proto: %s`, and cannot be combined with `reverse` and `ignore`", field, ProtoTCP)
+			}
+		}
 		// Not validating that the various GuestPortRanges and HostPortRanges are not overlapping. Rules will be
 		// processed sequentially and the first matching rule for a guest port determines forwarding behavior.
 	}
+	if err := validatePortForwardLimits(y.PortForwardLimits); err != nil {
+		return err
+	}
+	for i, relay := range y.UDPRelays {
+		field := fmt.Sprintf("udpRelays[%d]", i)
+		if relay.IP.To4() == nil || !(relay.IP.IsMulticast() || relay.IP.Equal(net.IPv4bcast)) {
+			return fmt.Errorf("field `%s.ip` must be an IPv4 multicast address or %s, got %q", field, net.IPv4bcast, relay.IP)
+		}
+		if err := validatePort(field+".port", relay.Port); err != nil {
+			return err
+		}
+		if relay.Proto != "" && relay.Proto != ProtoUDP {
+			return fmt.Errorf("field `%s.proto` must be %q, got %q", field, ProtoUDP, relay.Proto)
+		}
+		for j, other := range y.UDPRelays[:i] {
+			if other.IP.Equal(relay.IP) && other.Port == relay.Port {
+				return fmt.Errorf("field `%s` duplicates `udpRelays[%d]` (%s:%d)", field, j, relay.IP, relay.Port)
+			}
+		}
+	}
+	for i, rule := range y.SocketForwards {
+		field := fmt.Sprintf("socketForwards[%d]", i)
+		if !path.IsAbs(rule.GuestDir) {
+			return fmt.Errorf("field `%s.guestDir` must be an absolute path, but is %q", field, rule.GuestDir)
+		}
+		switch rule.Naming {
+		case SocketForwardNamingRelative, SocketForwardNamingBasename:
+		default:
+			return fmt.Errorf("field `%s.naming` must be %q or %q, got %q", field, SocketForwardNamingRelative, SocketForwardNamingBasename, rule.Naming)
+		}
+	}
+	if y.EgressPolicy != nil {
+		for i, rule := range y.EgressPolicy.Allow {
+			if err := validateEgressRule(fmt.Sprintf("egressPolicy.allow[%d]", i), rule); err != nil {
+				return err
+			}
+		}
+		for i, rule := range y.EgressPolicy.Deny {
+			if err := validateEgressRule(fmt.Sprintf("egressPolicy.deny[%d]", i), rule); err != nil {
+				return err
+			}
+		}
+	}
+	if y.Storage.Dir != nil {
+		if err := validateStorageDir(*y.Storage.Dir); err != nil {
+			return fmt.Errorf("field `storage.dir` %w", err)
+		}
+	}
+	for i, addr := range y.Passthrough.PCI {
+		if !pciAddressRegexp.MatchString(addr) {
+			return fmt.Errorf("field `passthrough.pci[%d]` must be a PCI address like \"0000:01:00.0\", got %q", i, addr)
+		}
+	}
+	for i, id := range y.Passthrough.GPU {
+		if id != "auto" && !gpuIDRegexp.MatchString(id) {
+			return fmt.Errorf("field `passthrough.gpu[%d]` must be \"auto\" or a \"VENDOR:DEVICE\" ID like \"10de:2684\", got %q", i, id)
+		}
+	}
+	if y.Video.Display != nil && *y.Video.Display == DisplayDefaultAccelerated && *y.VMType != QEMU {
+		return fmt.Errorf("field `video.display: %s` requires `vmType: %s`, got %q", DisplayDefaultAccelerated, QEMU, *y.VMType)
+	}
+	if y.Video.Accel != nil && *y.Video.Accel && *y.VMType == QEMU && y.Video.Display != nil {
+		// The display has to support OpenGL ("gl=on")
+		if display, _, _ := strings.Cut(*y.Video.Display, ","); !slices.Contains(qemuAccelDisplays, display) {
+			return fmt.Errorf("field `video.accel` requires `video.display` to be one of %v for QEMU, got %q", qemuAccelDisplays, *y.Video.Display)
+		}
+	}
+	if y.CloudInit.ExtraUserData != nil {
+		if _, err := ParseExtraUserData(*y.CloudInit.ExtraUserData); err != nil {
+			return fmt.Errorf("field `cloudInit.extraUserData` is invalid: %w", err)
+		}
+	}
+	if y.RestartPolicy != nil {
+		if _, _, err := ParseRestartPolicy(*y.RestartPolicy); err != nil {
+			return fmt.Errorf("field `restartPolicy` has an invalid value: %w", err)
+		}
+	}
+	if y.PowerSaving.Mode != nil {
+		switch *y.PowerSaving.Mode {
+		case PowerSavingAuto, PowerSavingAlways, PowerSavingNever:
+		default:
+			return fmt.Errorf("field `powerSaving.mode` must be %q, %q, or %q, got %q",
+				PowerSavingAuto, PowerSavingAlways, PowerSavingNever, *y.PowerSaving.Mode)
+		}
+	}
+	if y.PowerSaving.GuestAgentTick != nil {
+		if d, err := time.ParseDuration(*y.PowerSaving.GuestAgentTick); err != nil {
+			return fmt.Errorf("field `powerSaving.guestAgentTick` has an invalid value: %w", err)
+		} else if d <= 0 {
+			return fmt.Errorf("field `powerSaving.guestAgentTick` must be positive, got %q", *y.PowerSaving.GuestAgentTick)
+		}
+	}
+	if y.SerialLog.MaxSize != nil {
+		if n, err := units.RAMInBytes(*y.SerialLog.MaxSize); err != nil {
+			return fmt.Errorf("field `serialLog.maxSize` has an invalid value: %w", err)
+		} else if n < 0 {
+			return fmt.Errorf("field `serialLog.maxSize` must not be negative, got %q", *y.SerialLog.MaxSize)
+		}
+	}
+	if y.SerialLog.MaxFiles != nil && *y.SerialLog.MaxFiles < 0 {
+		return fmt.Errorf("field `serialLog.maxFiles` must not be negative, got %d", *y.SerialLog.MaxFiles)
+	}
+	if err := validateKernelConfig(y, warn); err != nil {
+		return err
+	}
+	if y.Security.Sudo != nil && !slices.Contains(SudoPolicies, *y.Security.Sudo) {
+		return fmt.Errorf("field `security.sudo` must be one of %v, got %q", SudoPolicies, *y.Security.Sudo)
+	}
+	if err := validateUsers(y); err != nil {
+		return err
+	}
+	if err := validateMetadataService(y); err != nil {
+		return err
+	}
 	for i, rule := range y.CopyToHost {
 		field := fmt.Sprintf("CopyToHost[%d]", i)
 		if rule.GuestFile != "" {
@@ -343,12 +604,43 @@ func Validate(y *LimaYAML, warn bool) error {
 	if y.HostResolver.Enabled != nil && *y.HostResolver.Enabled && len(y.DNS) > 0 {
 		return errors.New("field `dns` must be empty when field `HostResolver.Enabled` is true")
 	}
+	if len(y.HostResolver.Rules) > 0 && y.VMType != nil && *y.VMType == VZ {
+		logrus.Warnf("field `hostResolver.rules` is ignored for vmType %q, as the guest uses the DNS server of the user-mode network", VZ)
+	}
+	for i, rule := range y.HostResolver.Rules {
+		field := fmt.Sprintf("hostResolver.rules[%d]", i)
+		if !searchDomainRegexp.MatchString(strings.TrimSuffix(rule.Domain, ".")) {
+			return fmt.Errorf("field `%s.domain` must be a domain name, got %q", field, rule.Domain)
+		}
+		if len(rule.Servers) == 0 {
+			return fmt.Errorf("field `%s.servers` must not be empty", field)
+		}
+		for j, server := range rule.Servers {
+			if err := validateDNSServer(server); err != nil {
+				return fmt.Errorf("field `%s.servers[%d]` is invalid: %w", field, j, err)
+			}
+		}
+	}
+	for i, domain := range y.DHCP.SearchDomains {
+		if !searchDomainRegexp.MatchString(domain) {
+			return fmt.Errorf("field `dhcp.searchDomains[%d]` must be a domain name, got %q", i, domain)
+		}
+	}
+	for i, server := range y.DHCP.NTPServers {
+		if server == "" || strings.ContainsAny(server, " \t\n") {
+			return fmt.Errorf("field `dhcp.ntpServers[%d]` must be a host name or an IP address, got %q", i, server)
+		}
+	}
+	if mtu := *y.DHCP.MTU; mtu != 0 && (mtu < 68 || mtu > 65535) {
+		return fmt.Errorf("field `dhcp.mtu` must be 0 or between 68 and 65535, got %d", mtu)
+	}
 
 	if err := validateNetwork(y); err != nil {
 		return err
 	}
 	if warn {
 		warnExperimental(y)
+		warnKnownConflicts(y)
 	}
 
 	// Validate Param settings
@@ -365,6 +657,32 @@ func Validate(y *LimaYAML, warn bool) error {
 		}
 	}
 
+	if err := validateLabels(y.Labels); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validLabelKey is the regex for the keys of `labels`, e.g., "team" and "example.com/owner".
+var validLabelKey = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]*[a-zA-Z0-9])?$`)
+
+func validateLabels(labels map[string]string) error {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if !validLabelKey.MatchString(k) {
+			return fmt.Errorf("field `labels` has an invalid key %q: must match regex %q", k, validLabelKey.String())
+		}
+		for _, r := range labels[k] {
+			if !unicode.IsPrint(r) {
+				return fmt.Errorf("field `labels` has an invalid value for key %q: contains unprintable character %q", k, r)
+			}
+		}
+	}
 	return nil
 }
 
@@ -385,15 +703,40 @@ func validateNetwork(y *LimaYAML) error {
 			if err != nil {
 				return err
 			}
-			if !usernet && runtime.GOOS != "darwin" {
+			wireGuard, err := nwCfg.WireGuard(nw.Lima)
+			if err != nil {
+				return err
+			}
+			isSwitch, err := nwCfg.Switch(nw.Lima)
+			if err != nil {
+				return err
+			}
+			if !usernet && !wireGuard && !isSwitch && runtime.GOOS != "darwin" {
 				return fmt.Errorf("field `%s.lima` is only supported on macOS right now", field)
 			}
+			if wireGuard && nw.StaticIP == "" {
+				return fmt.Errorf("field `%s.staticIP` is required, as network %q is a %q network", field, nw.Lima, networks.ModeWireGuard)
+			}
 			if nw.Socket != "" {
 				return fmt.Errorf("field `%s.lima` and field `%s.socket` are mutually exclusive", field, field)
 			}
 			if nw.VZNAT != nil && *nw.VZNAT {
 				return fmt.Errorf("field `%s.lima` and field `%s.vzNAT` are mutually exclusive", field, field)
 			}
+			if nw.StaticIP != "" {
+				ip, err := netip.ParseAddr(nw.StaticIP)
+				if err != nil {
+					return fmt.Errorf("field `%s.staticIP` is invalid: %w", field, err)
+				}
+				_, inDHCPRange, err := nwCfg.StaticIPPrefix(nw.Lima, ip)
+				if err != nil {
+					return fmt.Errorf("field `%s.staticIP` is invalid: %w", field, err)
+				}
+				if inDHCPRange {
+					logrus.Warnf("field `%s.staticIP` %q is in the DHCP range of network %q, and may conflict with the address leased to another instance; "+
+						"consider lowering `dhcpEnd` of the network in networks.yaml", field, nw.StaticIP, nw.Lima)
+				}
+			}
 		case nw.Socket != "":
 			if nw.VZNAT != nil && *nw.VZNAT {
 				return fmt.Errorf("field `%s.socket` and field `%s.vzNAT` are mutually exclusive", field, field)
@@ -416,6 +759,9 @@ func validateNetwork(y *LimaYAML) error {
 		default:
 			return fmt.Errorf("field `%s.lima` or  field `%s.socket must be set", field, field)
 		}
+		if nw.StaticIP != "" && nw.Lima == "" {
+			return fmt.Errorf("field `%s.staticIP` requires field `%s.lima`", field, field)
+		}
 		if nw.MACAddress != "" {
 			hw, err := net.ParseMAC(nw.MACAddress)
 			if err != nil {
@@ -443,9 +789,78 @@ func validateNetwork(y *LimaYAML) error {
 	return nil
 }
 
+func validatePortForwardLimits(limits PortForwardLimits) error {
+	if limits.MaxForwards != nil && *limits.MaxForwards < 0 {
+		return fmt.Errorf("field `portForwardLimits.maxForwards` must be 0 (unlimited) or positive, got %d", *limits.MaxForwards)
+	}
+	if limits.MaxConnectionsPerPort != nil && *limits.MaxConnectionsPerPort < 0 {
+		return fmt.Errorf("field `portForwardLimits.maxConnectionsPerPort` must be 0 (unlimited) or positive, got %d", *limits.MaxConnectionsPerPort)
+	}
+	if limits.Bandwidth != nil {
+		if _, err := ParseBandwidth(*limits.Bandwidth); err != nil {
+			return fmt.Errorf("field `portForwardLimits.bandwidth` has an invalid value: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateRequires(r Requires) error {
+	if r.Memory != nil {
+		if _, err := units.RAMInBytes(*r.Memory); err != nil {
+			return fmt.Errorf("field `requires.memory` has an invalid value: %w", err)
+		}
+	}
+	if r.Disk != nil {
+		if _, err := units.RAMInBytes(*r.Disk); err != nil {
+			return fmt.Errorf("field `requires.disk` has an invalid value: %w", err)
+		}
+	}
+	if r.MacOS != nil {
+		if _, err := ParseMacOSVersion(*r.MacOS); err != nil {
+			return fmt.Errorf("field `requires.macOS` has an invalid value: %w", err)
+		}
+	}
+	for i, b := range r.Binaries {
+		if b == "" {
+			return fmt.Errorf("field `requires.binaries[%d]` must not be empty", i)
+		}
+	}
+	for i, vmType := range r.VMTypes {
+		if !slices.Contains(VMTypes, vmType) {
+			return fmt.Errorf("field `requires.vmTypes[%d]` must be one of %v; got %q", i, VMTypes, vmType)
+		}
+	}
+	return nil
+}
+
+// ParseMacOSVersion parses a macOS version such as "13.5", which may lack the minor or the patch version.
+func ParseMacOSVersion(s string) (*semver.Version, error) {
+	for strings.Count(s, ".") < 2 {
+		s += ".0"
+	}
+	return semver.NewVersion(s)
+}
+
+// ParseBandwidth parses the bytes per second, e.g., "100MiB". "0" and "" mean unlimited, and are parsed as 0.
+func ParseBandwidth(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := units.RAMInBytes(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("bandwidth must not be negative, got %q", s)
+	}
+	return n, nil
+}
+
 // ValidateParamIsUsed checks if the keys in the `param` field are used in any script, probe, copyToHost, or portForward.
 // It should be called before the `y` parameter is passed to FillDefault() that execute template.
+// An unused key is only warned when `metadataService` is enabled, as the guest may consume the params from the metadata service.
 func ValidateParamIsUsed(y *LimaYAML) error {
+	metadataService := y.MetadataService.Enabled != nil && *y.MetadataService.Enabled
 	for key := range y.Param {
 		re, err := regexp.Compile(`{{[^}]*\.Param\.` + key + `[^}]*}}|\bPARAM_` + key + `\b`)
 		if err != nil {
@@ -487,7 +902,30 @@ func ValidateParamIsUsed(y *LimaYAML) error {
 			}
 		}
 		if !keyIsUsed {
-			return fmt.Errorf("field `param` key %q is not used in any provision, probe, copyToHost, or portForward", key)
+			err := fmt.Errorf("field `param` key %q is not used in any provision, probe, copyToHost, or portForward", key)
+			if metadataService {
+				logrus.WithError(err).Warn("The key may be a typo, unless it is consumed from the metadata service")
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMetadataService rejects `metadataService` unless every user of the guest can read the cidata with sudo,
+// as the metadata service serves `user-data` and `param` to every process (and container) in the guest without authentication.
+func validateMetadataService(y *LimaYAML) error {
+	if y.MetadataService.Enabled == nil || !*y.MetadataService.Enabled {
+		return nil
+	}
+	const reason = "as the metadata service exposes `user-data` and `param` to every process in the guest"
+	if y.Security.Sudo != nil && *y.Security.Sudo != SudoFull {
+		return fmt.Errorf("field `metadataService.enabled` requires `security.sudo: %s`, %s", SudoFull, reason)
+	}
+	for i, u := range y.Users {
+		if u.Sudo != nil && *u.Sudo != SudoFull {
+			return fmt.Errorf("field `metadataService.enabled` requires `users[%d].sudo: %s`, %s", i, SudoFull, reason)
 		}
 	}
 	return nil
@@ -507,12 +945,58 @@ func validatePort(field string, port int) error {
 	return nil
 }
 
+// virtiofsTagRegexp matches the tags that can be used in /etc/fstab of the guest without escaping.
+var virtiofsTagRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+var egressDomainRegexp = regexp.MustCompile(`^(\*\.)?[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*\.?$`)
+
+func validateEgressRule(field string, rule EgressRule) error {
+	switch {
+	case rule.CIDR == "" && rule.Domain == "":
+		return fmt.Errorf("field `%s` must specify either `cidr` or `domain`", field)
+	case rule.CIDR != "" && rule.Domain != "":
+		return fmt.Errorf("field `%s` must not specify both `cidr` and `domain`", field)
+	case rule.CIDR != "":
+		if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+			return fmt.Errorf("field `%s.cidr` must be a CIDR, got %q: %w", field, rule.CIDR, err)
+		}
+	default:
+		if !egressDomainRegexp.MatchString(rule.Domain) {
+			return fmt.Errorf("field `%s.domain` must be a domain name, optionally prefixed with \"*.\", got %q", field, rule.Domain)
+		}
+	}
+	for j, port := range rule.Ports {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("field `%s.ports[%d]` must be between 1 and 65535, got %d", field, j, port)
+		}
+	}
+	return nil
+}
+
+// selinuxImageRegexp matches the image locations of the distributions that enable SELinux by default.
+var selinuxImageRegexp = regexp.MustCompile(`(?i)(fedora|centos|rhel|rocky|alma|oracle)`)
+
+// warnKnownConflicts warns about the combinations that are known to cause "permission denied" errors.
+func warnKnownConflicts(y *LimaYAML) {
+	if *y.MountType != REVSSHFS || len(y.Mounts) == 0 {
+		return
+	}
+	for _, f := range y.Images {
+		if f.Arch == *y.Arch && selinuxImageRegexp.MatchString(f.Location) {
+			logrus.Warnf("`mountType: %s` may not be accessible from containers on SELinux-enabled guests such as %q; "+
+				"consider `mountType: %s` or `mountType: %s`", REVSSHFS, path.Base(f.Location), VIRTIOFS, NINEP)
+			return
+		}
+	}
+}
+
 func warnExperimental(y *LimaYAML) {
 	if *y.MountType == VIRTIOFS && runtime.GOOS == "linux" {
 		logrus.Warn("`mountType: virtiofs` on Linux is experimental")
 	}
-	if *y.Arch == RISCV64 {
-		logrus.Warn("`arch: riscv64` is experimental")
+	switch *y.Arch {
+	case RISCV64, ARMV6L, LOONGARCH64:
+		logrus.Warnf("`arch: %s` is experimental", *y.Arch)
 	}
 	if y.Video.Display != nil && strings.Contains(*y.Video.Display, "vnc") {
 		logrus.Warn("`video.display: vnc` is experimental")
@@ -523,4 +1007,186 @@ func warnExperimental(y *LimaYAML) {
 	if y.MountInotify != nil && *y.MountInotify {
 		logrus.Warn("`mountInotify` is experimental")
 	}
+	if y.Video.Accel != nil && *y.Video.Accel {
+		logrus.Warn("`video.accel` is experimental")
+	}
+}
+
+var pciAddressRegexp = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:[0-1][0-9a-f]\.[0-7]$`)
+
+var qemuAccelDisplays = []string{"none", "default", DisplayDefaultAccelerated, "gtk", "sdl", "cocoa", "egl-headless", "dbus"}
+
+var gpuIDRegexp = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{4}$`)
+
+var searchDomainRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+// validateDNSServer validates an upstream server of `hostResolver.rules`.
+func validateDNSServer(server string) error {
+	if strings.Contains(server, "://") {
+		u, err := url.Parse(server)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("DNS-over-HTTPS URL must be an https URL, got %q", server)
+		}
+		return nil
+	}
+	if net.ParseIP(server) != nil {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return fmt.Errorf("must be IP, IP:PORT, or an https URL, got %q", server)
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("must be an IP address, got %q", host)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func validateStorageDir(dir string) error {
+	if dir == "" {
+		// the instance directory
+		return nil
+	}
+	if !filepath.IsAbs(dir) && !strings.HasPrefix(dir, "~") {
+		return fmt.Errorf("must be an absolute path, got %q", dir)
+	}
+	expanded, err := localpathutil.Expand(dir)
+	if err != nil {
+		return fmt.Errorf("refers to an unexpandable path: %q: %w", dir, err)
+	}
+	switch expanded {
+	case "/", "/bin", "/dev", "/etc", "/home", "/opt", "/sbin", "/tmp", "/usr", "/var":
+		return fmt.Errorf("must not be a system path such as /etc or /usr, got %q", dir)
+	}
+	// The directory may not exist yet, e.g., when the external volume is not mounted
+	if st, err := os.Stat(expanded); err == nil && !st.IsDir() {
+		return fmt.Errorf("refers to a non-directory path: %q", dir)
+	}
+	return nil
+}
+
+func validateUsers(y *LimaYAML) error {
+	if y.User.Shell != nil && !path.IsAbs(*y.User.Shell) {
+		return fmt.Errorf("field `user.shell` must be an absolute path, got %q", *y.User.Shell)
+	}
+	for i, u := range y.Users {
+		field := fmt.Sprintf("users[%d]", i)
+		if !osutil.IsValidUsername(u.Name) {
+			return fmt.Errorf("field `%s.name` must be a valid user name, got %q", field, u.Name)
+		}
+		if u.Name == "root" || (y.User.Name != nil && u.Name == *y.User.Name) {
+			return fmt.Errorf("field `%s.name` must not be %q", field, u.Name)
+		}
+		if u.Home != nil {
+			if !path.IsAbs(*u.Home) {
+				return fmt.Errorf("field `%s.home` must be an absolute path, got %q", field, *u.Home)
+			}
+			if y.User.Home != nil && path.Clean(*u.Home) == path.Clean(*y.User.Home) {
+				return fmt.Errorf("field `%s.home` must not be the home directory of `user`", field)
+			}
+		}
+		if u.Shell != nil && !path.IsAbs(*u.Shell) {
+			return fmt.Errorf("field `%s.shell` must be an absolute path, got %q", field, *u.Shell)
+		}
+		// "limited" is revoked by the host agent only for `user`
+		if u.Sudo != nil && *u.Sudo != SudoFull && *u.Sudo != SudoNone {
+			return fmt.Errorf("field `%s.sudo` must be %q or %q, got %q", field, SudoFull, SudoNone, *u.Sudo)
+		}
+		for j, key := range u.SSHPubKeys {
+			if strings.TrimSpace(key) == "" || strings.ContainsAny(key, "\r\n") {
+				return fmt.Errorf("field `%s.sshPubKeys[%d]` must be a single-line public key", field, j)
+			}
+		}
+	}
+	return nil
+}
+
+func validateMountInotify(inotify MountInotify, fieldName string) error {
+	for j, pattern := range inotify.Include {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("field `%s.include[%d]` is not a valid glob pattern: %q", fieldName, j, pattern)
+		}
+	}
+	for j, pattern := range inotify.Exclude {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("field `%s.exclude[%d]` is not a valid glob pattern: %q", fieldName, j, pattern)
+		}
+	}
+	if inotify.BatchInterval != nil {
+		d, err := time.ParseDuration(*inotify.BatchInterval)
+		if err != nil {
+			return fmt.Errorf("field `%s.batchInterval` has an invalid value: %w", fieldName, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("field `%s.batchInterval` must not be negative, got %q", fieldName, *inotify.BatchInterval)
+		}
+	}
+	if inotify.MaxEventsPerSecond != nil && *inotify.MaxEventsPerSecond < 0 {
+		return fmt.Errorf("field `%s.maxEventsPerSecond` must not be negative, got %d", fieldName, *inotify.MaxEventsPerSecond)
+	}
+	return nil
+}
+
+// maxID is the largest valid UID and GID; 4294967295 is reserved as the invalid ID.
+const maxID = 1<<32 - 2
+
+func validateIDMappings(mappings []IDMapping, fieldName string) error {
+	for j, m := range mappings {
+		if m.Guest < 0 || m.Host < 0 {
+			return fmt.Errorf("field `%s[%d]` must not have negative IDs, got guest=%d, host=%d", fieldName, j, m.Guest, m.Host)
+		}
+		if m.Count < 1 {
+			return fmt.Errorf("field `%s[%d].count` must be positive, got %d", fieldName, j, m.Count)
+		}
+		if int64(m.Guest)+int64(m.Count)-1 > maxID || int64(m.Host)+int64(m.Count)-1 > maxID {
+			return fmt.Errorf("field `%s[%d]` exceeds the maximum ID %d", fieldName, j, maxID)
+		}
+		for k, other := range mappings[:j] {
+			if m.Guest < other.Guest+other.Count && other.Guest < m.Guest+m.Count {
+				return fmt.Errorf("field `%s[%d]` overlaps with `%s[%d]` in the guest IDs", fieldName, j, fieldName, k)
+			}
+			if m.Host < other.Host+other.Count && other.Host < m.Host+m.Count {
+				return fmt.Errorf("field `%s[%d]` overlaps with `%s[%d]` in the host IDs", fieldName, j, fieldName, k)
+			}
+		}
+	}
+	return nil
+}
+
+func validateKernelConfig(y *LimaYAML, warn bool) error {
+	for i, m := range y.Kernel.Modules {
+		if err := kernelconfig.ValidateModule(m); err != nil {
+			return fmt.Errorf("field `kernel.modules[%d]` is invalid: %w", i, err)
+		}
+	}
+	keys := make([]string, 0, len(y.Sysctl))
+	for k := range y.Sysctl {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if err := kernelconfig.ValidateSysctl(k, y.Sysctl[k]); err != nil {
+			return fmt.Errorf("field `sysctl` is invalid: %w", err)
+		}
+		if reason, ok := riskySysctls[kernelconfig.NormalizeSysctlKey(k)]; ok && warn {
+			logrus.Warnf("field `sysctl` has %q, which %s", k, reason)
+		}
+	}
+	return nil
+}
+
+// riskySysctls are the sysctl keys accepted with a warning, with the reasons.
+var riskySysctls = map[string]string{
+	"kernel.panic":              "may reboot the guest unexpectedly",
+	"kernel.panic_on_oops":      "may reboot or hang the guest",
+	"kernel.panic_on_warn":      "may reboot or hang the guest",
+	"vm.panic_on_oom":           "may reboot or hang the guest",
+	"kernel.randomize_va_space": "may weaken the security of the guest",
+	"kernel.yama.ptrace_scope":  "may weaken the security of the guest",
 }
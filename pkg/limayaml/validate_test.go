@@ -2,12 +2,53 @@ package limayaml
 
 import (
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 
 	"gotest.tools/v3/assert"
 )
 
+// TestMain registers a manifest that supports everything for the built-in vmTypes, as package driverutil
+// cannot be imported here. The tests that check the capabilities register their own manifests.
+func TestMain(m *testing.M) {
+	for _, vmType := range []VMType{QEMU, VZ, WSL2} {
+		RegisterDriverCapabilities(vmType, DriverCapabilities{
+			MountTypes:           MountTypes,
+			Arches:               ArchTypes,
+			Snapshot:             true,
+			NestedVirtualization: true,
+			TPM:                  true,
+			EgressPolicy:         true,
+			MetadataService:      true,
+			PCIPassthrough:       true,
+			SharedMemory:         true,
+			CrashVMCore:          true,
+			VideoAccel:           true,
+			AdditionalUsers:      true,
+			Pause:                true,
+			Suspend:              true,
+			LiveClone:            true,
+			CPUHotplugArches:     ArchTypes,
+		})
+	}
+	os.Exit(m.Run())
+}
+
+func TestValidateUnregisteredDriverCapabilities(t *testing.T) {
+	caps, _ := LookupDriverCapabilities(QEMU)
+	t.Cleanup(func() {
+		RegisterDriverCapabilities(QEMU, caps)
+	})
+	driverCapabilitiesMu.Lock()
+	delete(driverCapabilities, QEMU)
+	driverCapabilitiesMu.Unlock()
+
+	y, err := Load([]byte(`vmType: "qemu"`+"\n"+`images: [{"location": "/"}]`), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), `vmType "qemu" is not supported by this build of limactl`)
+}
+
 func TestValidateEmpty(t *testing.T) {
 	y, err := Load([]byte{}, "empty.yaml")
 	assert.NilError(t, err)
@@ -46,6 +87,564 @@ func TestValidateProbes(t *testing.T) {
 
 	err = Validate(y, false)
 	assert.Error(t, err, "field `probe[0].script` must start with a '#!' line")
+
+	duplicateProbe := `probes: [{"name": "foo", "script": "#!foo"}, {"name": "foo", "script": "#!bar"}]`
+	y, err = Load([]byte(duplicateProbe+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+
+	err = Validate(y, false)
+	assert.Error(t, err, "field `probe[1].name` must be unique, but \"foo\" is also used by `probe[0]`")
+}
+
+func TestValidateVirtiofsTag(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	mounts := `mountType: virtiofs
+mounts: [{"location": "/tmp/lima-a", "virtiofs": {"tag": "data", "cache": "never"}}, {"location": "/tmp/lima-b"}]`
+	y, err := Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.Equal(t, MountTag(y, 0), "data")
+	assert.Equal(t, MountTag(y, 1), "mount1")
+
+	mounts = `mountType: virtiofs
+mounts: [{"location": "/tmp/lima-a"}, {"location": "/tmp/lima-b", "virtiofs": {"tag": "mount0"}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[1].virtiofs.tag` must be unique, but \"mount0\" is also used by `mounts[0]`")
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"tag": "my data"}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `mounts[0].virtiofs.tag` must match")
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"cache": "none"}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[0].virtiofs.cache` must be \"auto\", \"always\", or \"never\", got \"none\"")
+}
+
+func TestValidateExternalMountType(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test driver is a shell script")
+	}
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte("mountType: smb\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Assert(t, IsExternalMountType(*y.MountType))
+
+	t.Setenv("PATH", t.TempDir())
+	assert.ErrorContains(t, Validate(y, false), "external mount driver \"lima-mount-smb\" is not found")
+
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "lima-mount-smb"), []byte("#!/bin/sh\n"), 0o755))
+	t.Setenv("PATH", dir)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte("mountType: SMB\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "or the name of an external mount driver")
+}
+
+func TestValidateMountInotify(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	mounts := `mounts: [{"location": "/tmp/lima-a", "inotify": {"include": ["src/**"], "exclude": ["**/*.o"], "batchInterval": "500ms", "maxEventsPerSecond": 100}}]`
+	y, err := Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "inotify": {"exclude": ["[node_modules"]}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[0].inotify.exclude[0]` is not a valid glob pattern: \"[node_modules\"")
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "inotify": {"batchInterval": "100"}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `mounts[0].inotify.batchInterval` has an invalid value")
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "inotify": {"maxEventsPerSecond": -1}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[0].inotify.maxEventsPerSecond` must not be negative, got -1")
+}
+
+func TestValidateVirtiofsIDMap(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	mounts := `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"idmap": {"uid": [{"guest": 1000, "host": 501, "count": 1}], "gid": [{"guest": 0, "host": 20, "count": 1}, {"guest": 1000, "host": 100000, "count": 65536}]}}}]`
+	y, err := Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"idmap": {"uid": [{"guest": 1000, "host": 501}]}}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[0].virtiofs.idmap.uid[0].count` must be positive, got 0")
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"idmap": {"gid": [{"guest": 0, "host": 100000, "count": 1000}, {"guest": 999, "host": 20, "count": 1}]}}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[0].virtiofs.idmap.gid[1]` overlaps with `mounts[0].virtiofs.idmap.gid[0]` in the guest IDs")
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"idmap": {"uid": [{"guest": 4294967290, "host": 0, "count": 10}]}}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "exceeds the maximum ID")
+}
+
+func TestValidateVirtiofsd(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	mounts := `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"sandbox": "chroot", "threadPoolSize": 4, "rlimitNofile": 4096}}]`
+	y, err := Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"sandbox": "seccomp"}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[0].virtiofs.sandbox` must be \"namespace\", \"chroot\", or \"none\", got \"seccomp\"")
+
+	mounts = `mounts: [{"location": "/tmp/lima-a", "virtiofs": {"threadPoolSize": -1}}]`
+	y, err = Load([]byte(mounts+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `mounts[0].virtiofs.threadPoolSize` must not be negative, got -1")
+}
+
+func TestValidateSocketForwards(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`socketForwards: [{"guestDir": "/home/{{.User}}/project"}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte(`socketForwards: [{"guestDir": "project"}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `socketForwards[0].guestDir` must be an absolute path, but is \"project\"")
+
+	y, err = Load([]byte(`socketForwards: [{"guestDir": "/run/app", "naming": "flat"}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `socketForwards[0].naming` must be \"relative\" or \"basename\", got \"flat\"")
+}
+
+func TestValidateUDPRelays(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`udpRelays: [{"ip": "224.0.0.251", "port": 5353}, {"ip": "255.255.255.255", "port": 1900, "proto": "udp"}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	cases := []struct {
+		relays   string
+		expected string
+	}{
+		{`[{"ip": "224.0.0.251", "port": 0}]`, "field `udpRelays[0].port` must be set"},
+		{`[{"ip": "224.0.0.251", "port": -1}]`, "field `udpRelays[0].port` must be > 0"},
+		{`[{"ip": "224.0.0.251", "port": 65536}]`, "field `udpRelays[0].port` must be < 65536"},
+		{`[{"ip": "224.0.0.251", "port": 5353, "proto": "tcp"}]`, "field `udpRelays[0].proto` must be \"udp\", got \"tcp\""},
+		{
+			`[{"ip": "224.0.0.251", "port": 5353}, {"ip": "239.255.255.250", "port": 1900}, {"ip": "224.0.0.251", "port": 5353}]`,
+			"field `udpRelays[2]` duplicates `udpRelays[0]` (224.0.0.251:5353)",
+		},
+		{`[{"ip": "192.168.5.2", "port": 5353}]`, "field `udpRelays[0].ip` must be an IPv4 multicast address or 255.255.255.255, got \"192.168.5.2\""},
+		{`[{"ip": "ff02::fb", "port": 5353}]`, "field `udpRelays[0].ip` must be an IPv4 multicast address or 255.255.255.255, got \"ff02::fb\""},
+		{`[{"port": 5353}]`, "field `udpRelays[0].ip` must be an IPv4 multicast address or 255.255.255.255, got \"<nil>\""},
+	}
+	for _, tc := range cases {
+		y, err := Load([]byte("udpRelays: "+tc.relays+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.Error(t, Validate(y, false), tc.expected, tc.relays)
+	}
+}
+
+func TestValidateMaxCPUs(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte("cpus: 2\nmaxCPUs: 8\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte("cpus: 4\nmaxCPUs: 2\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `maxCPUs` must be greater than or equal to `cpus` (4), got 2")
+}
+
+func TestValidateStorageDir(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	for _, dir := range []string{"/Volumes/External/lima", "~/lima-disks"} {
+		y, err := Load([]byte("storage: {dir: "+dir+"}\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.NilError(t, Validate(y, false))
+	}
+
+	y, err := Load([]byte("storage: {dir: lima-disks}\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `storage.dir` must be an absolute path")
+
+	y, err = Load([]byte("storage: {dir: /usr}\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "must not be a system path")
+
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NilError(t, os.WriteFile(file, nil, 0o644))
+	y, err = Load([]byte("storage: {dir: "+file+"}\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "refers to a non-directory path")
+}
+
+func TestValidateAdditionalDisks(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	for _, disk := range []string{
+		"{name: data}",
+		"{name: data, createIfMissing: true, size: 50GiB}",
+		"{name: data, createIfMissing: true, size: 50GiB, diskFormat: raw}",
+	} {
+		y, err := Load([]byte("additionalDisks: ["+disk+"]\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.NilError(t, Validate(y, false))
+	}
+
+	y, err := Load([]byte("additionalDisks: [{name: data, createIfMissing: true}]\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `additionalDisks[0].size` must be set")
+
+	y, err = Load([]byte("additionalDisks: [{name: data, size: big}]\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `additionalDisks[0].size` has an invalid value")
+
+	y, err = Load([]byte("additionalDisks: [{name: data, size: 50GiB, diskFormat: vmdk}]\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `additionalDisks[0].diskFormat` must be")
+}
+
+func TestValidateDHCP(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`dhcp: {searchDomains: ["corp.example.com", "lab"], ntpServers: ["ntp.example.com", "192.168.1.1"], mtu: 1400}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte(`dhcp: {searchDomains: ["corp example"]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `dhcp.searchDomains[0]` must be a domain name")
+
+	y, err = Load([]byte(`dhcp: {ntpServers: [""]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `dhcp.ntpServers[0]` must be")
+
+	y, err = Load([]byte(`dhcp: {mtu: 10}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `dhcp.mtu` must be 0 or between 68 and 65535")
+}
+
+func TestValidateHostResolverRules(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`hostResolver: {rules: [{domain: "corp.example.com", servers: ["10.0.0.53", "10.0.0.54:5353", "[fd00::53]:53", "https://dns.example.com/dns-query"]}]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte(`hostResolver: {rules: [{domain: "corp example", servers: ["10.0.0.53"]}]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `hostResolver.rules[0].domain` must be a domain name")
+
+	y, err = Load([]byte(`hostResolver: {rules: [{domain: "corp.example.com"}]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `hostResolver.rules[0].servers` must not be empty")
+
+	for _, server := range []string{"dns.example.com", "10.0.0.53:0", "http://dns.example.com/dns-query", "tls://10.0.0.53"} {
+		y, err = Load([]byte(`hostResolver: {rules: [{domain: "corp.example.com", servers: ["`+server+`"]}]}`+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.ErrorContains(t, Validate(y, false), "field `hostResolver.rules[0].servers[0]` is invalid", server)
+	}
+}
+
+func TestValidateSharedMemory(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`sharedMemory: [{name: "shm0"}, {name: "shm1", size: "64MiB"}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.Equal(t, *y.SharedMemory[0].Size, DefaultSharedMemorySize)
+
+	y, err = Load([]byte(`sharedMemory: [{name: "shm0", size: "48MiB"}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "must be a power of 2")
+
+	y, err = Load([]byte(`sharedMemory: [{name: "shm/0"}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `sharedMemory[0].name` is invalid")
+}
+
+func TestValidateCrashCapture(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	caps, ok := LookupDriverCapabilities(QEMU)
+	t.Cleanup(func() {
+		if ok {
+			RegisterDriverCapabilities(QEMU, caps)
+		} else {
+			driverCapabilitiesMu.Lock()
+			delete(driverCapabilities, QEMU)
+			driverCapabilitiesMu.Unlock()
+		}
+	})
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes:  MountTypes,
+		Arches:      ArchTypes,
+		CrashVMCore: true,
+	})
+
+	y, err := Load([]byte(`vmType: "qemu"`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.Assert(t, *y.CrashCapture.Enabled)
+	assert.Assert(t, !*y.CrashCapture.VMCore)
+
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`crashCapture: {vmcore: true}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes: MountTypes,
+		Arches:     ArchTypes,
+	})
+	assert.ErrorContains(t, Validate(y, false), "does not support `crashCapture.vmcore`")
+}
+
+func TestValidatePowerSaving(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.Equal(t, *y.PowerSaving.Mode, PowerSavingAuto)
+	assert.Equal(t, *y.PowerSaving.GuestAgentTick, DefaultPowerSavingGuestAgentTick)
+	assert.Assert(t, !*y.PowerSaving.Pause)
+
+	y, err = Load([]byte(`powerSaving: {mode: "sometimes"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `powerSaving.mode` must be \"auto\", \"always\", or \"never\", got \"sometimes\"")
+
+	y, err = Load([]byte(`powerSaving: {guestAgentTick: "0s"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `powerSaving.guestAgentTick` must be positive, got \"0s\"")
+}
+
+func TestValidateRequires(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`requires: {memory: "8GiB", disk: "20GiB", macOS: "13.5", binaries: [socket_vmnet], vmTypes: [vz]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte(`requires: {memory: "lots"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `requires.memory` has an invalid value")
+
+	y, err = Load([]byte(`requires: {macOS: "Sonoma"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `requires.macOS` has an invalid value")
+
+	y, err = Load([]byte(`requires: {vmTypes: [krunkit]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `requires.vmTypes[0]` must be one of")
+}
+
+func TestValidateSerialLog(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.Equal(t, *y.SerialLog.MaxSize, "10MiB")
+	assert.Equal(t, *y.SerialLog.MaxFiles, 2)
+
+	y, err = Load([]byte(`serialLog: {maxSize: "0", maxFiles: 0}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte(`serialLog: {maxSize: "big"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `serialLog.maxSize` has an invalid value")
+
+	y, err = Load([]byte(`serialLog: {maxFiles: -1}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `serialLog.maxFiles` must not be negative, got -1")
+}
+
+func TestValidateKernelConfig(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`
+kernel:
+  modules: [br_netfilter, overlay]
+sysctl:
+  vm.max_map_count: 262144
+  fs.inotify.max_user_watches: "524288"
+  net/ipv4/conf/eth0.100/rp_filter: 0
+`+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.DeepEqual(t, y.Kernel.Modules, []string{"br_netfilter", "overlay"})
+	assert.Equal(t, y.Sysctl["vm.max_map_count"], "262144")
+
+	cases := map[string]string{
+		`kernel: {modules: ["../evil"]}`:                "field `kernel.modules[0]` is invalid: invalid kernel module name \"../evil\"",
+		`sysctl: {"vm/../../etc/passwd": "1"}`:          "field `sysctl` is invalid: invalid sysctl key \"vm/../../etc/passwd\"",
+		`sysctl: {"vm.max_map_count": ""}`:              "field `sysctl` is invalid: invalid value of sysctl \"vm.max_map_count\": \"\"",
+		`sysctl: {"kernel.modprobe": "/tmp/x"}`:         "field `sysctl` is invalid: sysctl \"kernel.modprobe\" is not allowed, as it runs the specified program as root",
+		`sysctl: {"kernel/modules_disabled": "1"}`:      "field `sysctl` is invalid: sysctl \"kernel/modules_disabled\" is not allowed, as it cannot be reverted without a reboot, and prevents `kernel.modules` from being loaded",
+		`sysctl: {"kernel.core_pattern": "|/tmp/x %p"}`: "field `sysctl` is invalid: sysctl \"kernel.core_pattern\" is not allowed to pipe the core dumps to a program, as the program runs as root",
+	}
+	for yamlStr, expected := range cases {
+		y, err := Load([]byte(yamlStr+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.Error(t, Validate(y, false), expected)
+	}
+
+	// risky keys are only warned
+	y, err = Load([]byte(`sysctl: {"kernel.panic": "10", "kernel.core_pattern": "/var/crash/core.%p"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+}
+
+func TestValidatePortForwardLimits(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`portForwardLimits: {maxForwards: 10, maxConnectionsPerPort: 4, bandwidth: "10MiB"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	bandwidth, err := ParseBandwidth(*y.PortForwardLimits.Bandwidth)
+	assert.NilError(t, err)
+	assert.Equal(t, bandwidth, int64(10*1024*1024))
+
+	y, err = Load([]byte(`portForwardLimits: {maxForwards: -1}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `portForwardLimits.maxForwards` must be 0 (unlimited) or positive")
+
+	y, err = Load([]byte(`portForwardLimits: {bandwidth: "fast"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `portForwardLimits.bandwidth` has an invalid value")
+}
+
+func TestValidateRestartPolicy(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	for _, policy := range []string{"no", "on-failure", "on-failure:3"} {
+		y, err := Load([]byte("restartPolicy: "+policy+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.NilError(t, Validate(y, false))
+	}
+
+	y, err := Load([]byte("restartPolicy: always\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `restartPolicy` has an invalid value")
+
+	y, err = Load([]byte("restartPolicy: on-failure:0\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "must be a positive integer")
+}
+
+func TestValidatePassthrough(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	caps, ok := LookupDriverCapabilities(QEMU)
+	t.Cleanup(func() {
+		if ok {
+			RegisterDriverCapabilities(QEMU, caps)
+		} else {
+			driverCapabilitiesMu.Lock()
+			delete(driverCapabilities, QEMU)
+			driverCapabilitiesMu.Unlock()
+		}
+	})
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes:     MountTypes,
+		Arches:         ArchTypes,
+		PCIPassthrough: true,
+	})
+
+	y, err := Load([]byte(`vmType: "qemu"`+"\n"+`passthrough: {pci: ["0000:01:00.0", "02:1F.1", "01:00.0"]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.DeepEqual(t, y.Passthrough.PCI, []string{"0000:01:00.0", "0000:02:1f.1"})
+
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`passthrough: {pci: ["01:00"]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `passthrough.pci[0]` must be a PCI address")
+
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`passthrough: {gpu: ["auto", "10DE:2684", "10de:2684"]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+	assert.DeepEqual(t, y.Passthrough.GPU, []string{"auto", "10de:2684"})
+
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`passthrough: {gpu: ["nvidia"]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `passthrough.gpu[0]` must be")
+
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes: MountTypes,
+		Arches:     ArchTypes,
+	})
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`passthrough: {pci: ["0000:01:00.0"]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "does not support `passthrough.pci`")
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`passthrough: {gpu: ["auto"]}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "does not support `passthrough.gpu`")
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	onFailure, maxRestarts, err := ParseRestartPolicy("no")
+	assert.NilError(t, err)
+	assert.Assert(t, !onFailure)
+	assert.Equal(t, maxRestarts, 0)
+
+	onFailure, maxRestarts, err = ParseRestartPolicy("on-failure")
+	assert.NilError(t, err)
+	assert.Assert(t, onFailure)
+	assert.Equal(t, maxRestarts, 0)
+
+	onFailure, maxRestarts, err = ParseRestartPolicy("on-failure:5")
+	assert.NilError(t, err)
+	assert.Assert(t, onFailure)
+	assert.Equal(t, maxRestarts, 5)
+
+	_, _, err = ParseRestartPolicy("on-failurex")
+	assert.ErrorContains(t, err, "restart policy must be")
+	_, _, err = ParseRestartPolicy("on-failure:x")
+	assert.ErrorContains(t, err, "must be a positive integer")
+}
+
+func TestValidateEgressPolicy(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	validPolicy := `egressPolicy: {"allow": [{"domain": "*.npmjs.org", "ports": [443]}], "deny": [{"cidr": "10.0.0.0/8"}]}`
+	y, err := Load([]byte(validPolicy+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	invalidPolicy := `egressPolicy: {"allow": [{"domain": "example.com", "cidr": "10.0.0.0/8"}]}`
+	y, err = Load([]byte(invalidPolicy+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `egressPolicy.allow[0]` must not specify both `cidr` and `domain`")
+
+	invalidPolicy = `egressPolicy: {"deny": [{"cidr": "10.0.0.0/8", "ports": [0]}]}`
+	y, err = Load([]byte(invalidPolicy+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `egressPolicy.deny[0].ports[0]` must be between 1 and 65535, got 0")
+}
+
+func TestValidateSecuritySudo(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	for _, policy := range SudoPolicies {
+		y, err := Load([]byte("security: {sudo: "+policy+"}\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.NilError(t, Validate(y, false))
+	}
+
+	y, err := Load([]byte("security: {sudo: partial}\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `security.sudo` must be one of [full limited none], got \"partial\"")
+}
+
+func TestValidateHostService(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`portForwards: [{"guestPort": 5432, "hostService": true}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte(`portForwards: [{"guestPortRange": [8000, 8010], "hostService": true}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `portForwards[0].hostService` requires a single `guestPort` and `hostPort`")
+
+	y, err = Load([]byte(`portForwards: [{"guestPort": 53, "proto": "udp", "hostService": true}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `portForwards[0].hostService` requires `proto: tcp`, and cannot be combined with `reverse` and `ignore`")
 }
 
 func TestValidateParamName(t *testing.T) {
@@ -109,12 +708,59 @@ func TestValidateParamValue(t *testing.T) {
 	}
 }
 
+func TestValidateLabels(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	validLabels := []string{
+		`labels: {"team": "infra"}`,
+		`labels: {"example.com/owner": "alice"}`,
+		`labels: {"a": ""}`,
+	}
+	for _, labels := range validLabels {
+		y, err := Load([]byte(labels+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.NilError(t, Validate(y, false))
+	}
+
+	invalidLabels := map[string]string{
+		`labels: {"-team": "infra"}`: "invalid key",
+		`labels: {"team=": "infra"}`: "invalid key",
+		`labels: {"a b": "infra"}`:   "invalid key",
+		`labels: {"team": "a\nb"}`:   "unprintable character",
+	}
+	for labels, expected := range invalidLabels {
+		y, err := Load([]byte(labels+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.ErrorContains(t, Validate(y, false), expected)
+	}
+}
+
+func TestValidateMetadataService(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte("metadataService: {enabled: true}\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	for yaml, expected := range map[string]string{
+		"security: {sudo: none}":    "requires `security.sudo: full`",
+		"security: {sudo: limited}": "requires `security.sudo: full`",
+		"users: [{name: guest}]":    "requires `users[0].sudo: full`",
+	} {
+		y, err := Load([]byte("metadataService: {enabled: true}\n"+yaml+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.ErrorContains(t, Validate(y, false), expected)
+	}
+}
+
 func TestValidateParamIsUsed(t *testing.T) {
 	paramYaml := `param:
   name: value`
 	_, err := Load([]byte(paramYaml), "paramIsNotUsed.yaml")
 	assert.Error(t, err, "field `param` key \"name\" is not used in any provision, probe, copyToHost, or portForward")
 
+	// The params may be consumed via the metadata service, so the unused key is only warned
+	_, err = Load([]byte(paramYaml+"\nmetadataService: {enabled: true}"), "paramIsNotUsed.yaml")
+	assert.NilError(t, err)
+
 	fieldsUsingParam := []string{
 		`mounts: [{"location": "/tmp/{{ .Param.name }}"}]`,
 		`mounts: [{"location": "/tmp", mountPoint: "/tmp/{{ .Param.name }}"}]`,
@@ -161,3 +807,130 @@ func TestValidateParamIsUsed(t *testing.T) {
 		assert.Error(t, err, "field `param` key \"rootFul\" is not used in any provision, probe, copyToHost, or portForward")
 	}
 }
+
+func TestValidateDriverCapabilities(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`vmType: "qemu"`+"\n"+`mountType: "9p"`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+
+	caps, ok := LookupDriverCapabilities(QEMU)
+	t.Cleanup(func() {
+		if ok {
+			RegisterDriverCapabilities(QEMU, caps)
+		} else {
+			driverCapabilitiesMu.Lock()
+			delete(driverCapabilities, QEMU)
+			driverCapabilitiesMu.Unlock()
+		}
+	})
+
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes: []MountType{REVSSHFS, NINEP},
+		Arches:     ArchTypes,
+	})
+	assert.NilError(t, Validate(y, false))
+
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes: []MountType{REVSSHFS},
+		Arches:     ArchTypes,
+	})
+	assert.ErrorContains(t, Validate(y, false), "vmType qemu does not support mountType 9p")
+
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes: []MountType{NINEP},
+		Arches:     []Arch{},
+	})
+	assert.ErrorContains(t, Validate(y, false), "vmType qemu does not support arch")
+}
+
+func TestValidateExtraUserData(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`cloudInit: {extraUserData: "runcmd: [echo hi, [ls, /]]\npackages: [jq]\n"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	for extra, expected := range map[string]string{
+		"users: []":                            `key "users" is not supported`,
+		"runcmd: echo hi":                      "`runcmd` must be a list",
+		"runcmd: [[]]":                         "`runcmd[0]` must not be empty",
+		"write_files: [{content: hi}]":         "`write_files[0].path` must be set",
+		"write_files: [{path: etc/motd}]":      "`write_files[0].path` must be an absolute path",
+		"write_files: [{path: /a, mode: x}]":   "`write_files[0].mode` is not supported",
+		"write_files: [{path: /a, append: 1}]": "`write_files[0].append` must be a boolean",
+		"- runcmd":                             "must be a map",
+	} {
+		_, err := ParseExtraUserData(extra)
+		assert.ErrorContains(t, err, expected, extra)
+	}
+}
+
+func TestValidateVideoAccel(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	for _, display := range []string{"none", "gtk", "sdl,gl=on", "cocoa", DisplayDefaultAccelerated} {
+		y, err := Load([]byte(`vmType: "qemu"`+"\n"+`video: {accel: true, display: "`+display+`"}`+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		assert.NilError(t, Validate(y, false))
+	}
+
+	y, err := Load([]byte(`vmType: "qemu"`+"\n"+`video: {accel: true, display: "vnc"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `video.accel` requires `video.display` to be one of")
+
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`video: {accel: true, display: "curses"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "field `video.accel` requires `video.display` to be one of")
+
+	// "default-accelerated" implies `accel: true`
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`video: {display: "`+DisplayDefaultAccelerated+`"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, *y.Video.Accel, true)
+	assert.NilError(t, Validate(y, false))
+
+	y, err = Load([]byte(`vmType: "vz"`+"\n"+`video: {display: "`+DisplayDefaultAccelerated+`"}`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.Error(t, Validate(y, false), "field `video.display: default-accelerated` requires `vmType: qemu`, got \"vz\"")
+}
+
+func TestValidateUsers(t *testing.T) {
+	images := `images: [{"location": "/"}]`
+	y, err := Load([]byte(`users: [{name: alice, sudo: full, shell: /bin/zsh}, {name: bob, sshPubKeys: ["ssh-ed25519 AAAA bob"]}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, Validate(y, false))
+
+	for users, errMsg := range map[string]string{
+		`[{name: Alice}]`:                        "must be a valid user name",
+		`[{name: root}]`:                         "must not be \"root\"",
+		`[{name: alice, home: alice}]`:           "must be an absolute path",
+		`[{name: alice, shell: zsh}]`:            "must be an absolute path",
+		`[{name: alice, sudo: limited}]`:         "field `users[0].sudo` must be \"full\" or \"none\"",
+		`[{name: alice, sshPubKeys: ["a\nb"]}]`:  "must be a single-line public key",
+		`[{name: alice, sshPubKeys: ["  "]}]`:    "must be a single-line public key",
+		`[{name: alice, home: /home/bob.linux}]`: "",
+	} {
+		y, err := Load([]byte("users: "+users+"\n"+images), "lima.yaml")
+		assert.NilError(t, err)
+		if errMsg == "" {
+			assert.NilError(t, Validate(y, false))
+		} else {
+			assert.ErrorContains(t, Validate(y, false), errMsg, users)
+		}
+	}
+
+	caps, ok := LookupDriverCapabilities(QEMU)
+	t.Cleanup(func() {
+		if ok {
+			RegisterDriverCapabilities(QEMU, caps)
+		} else {
+			driverCapabilitiesMu.Lock()
+			delete(driverCapabilities, QEMU)
+			driverCapabilitiesMu.Unlock()
+		}
+	})
+	RegisterDriverCapabilities(QEMU, DriverCapabilities{
+		MountTypes: MountTypes,
+		Arches:     ArchTypes,
+	})
+	y, err = Load([]byte(`vmType: "qemu"`+"\n"+`users: [{name: alice}]`+"\n"+images), "lima.yaml")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, Validate(y, false), "does not support `users`")
+}
@@ -0,0 +1,85 @@
+// Package logrotate rotates the log files that are written by another process, such as the serial console logs.
+package logrotate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RotatedPath returns the path of the n-th rotated file of path, e.g., "serial.log.1".
+// The larger n is, the older the file is.
+func RotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Rotate copies path to the first rotated file, shifting the existing rotated files, and truncates path.
+// The oldest files are removed so that at most maxFiles rotated files are retained.
+//
+// path is truncated in place rather than renamed, as the writer keeps the file open.
+// The writer must open the file with O_APPEND, otherwise the next write leaves a hole in the file.
+// The bytes written between the copy and the truncation are lost.
+func Rotate(path string, maxFiles int) error {
+	if err := removeRotated(path, maxFiles+1); err != nil {
+		return err
+	}
+	for n := maxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(RotatedPath(path, n), RotatedPath(path, n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if maxFiles > 0 {
+		if err := copyFile(path, RotatedPath(path, 1)); err != nil {
+			return err
+		}
+	}
+	return os.Truncate(path, 0)
+}
+
+// Files returns the existing rotated files of path from the oldest one, followed by path itself when it exists.
+func Files(path string) []string {
+	var files []string
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	for n := 1; ; n++ {
+		rotated := RotatedPath(path, n)
+		if _, err := os.Stat(rotated); err != nil {
+			break
+		}
+		files = append([]string{rotated}, files...)
+	}
+	return files
+}
+
+// RemoveRotated removes all the rotated files of path. path itself is not removed.
+func RemoveRotated(path string) error {
+	return removeRotated(path, 1)
+}
+
+// removeRotated removes the rotated files of path from the from-th one.
+func removeRotated(path string, from int) error {
+	for n := from; ; n++ {
+		if err := os.Remove(RotatedPath(path, n)); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return errors.Join(err, out.Close())
+}
@@ -0,0 +1,43 @@
+package logrotate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serial.log")
+	for _, content := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0o644))
+		assert.NilError(t, Rotate(path, 2))
+	}
+	assert.NilError(t, os.WriteFile(path, []byte("fifth\n"), 0o644))
+
+	files := Files(path)
+	assert.DeepEqual(t, files, []string{RotatedPath(path, 2), RotatedPath(path, 1), path})
+	var contents []string
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		assert.NilError(t, err)
+		contents = append(contents, string(b))
+	}
+	assert.DeepEqual(t, contents, []string{"third\n", "fourth\n", "fifth\n"})
+
+	assert.NilError(t, RemoveRotated(path))
+	assert.DeepEqual(t, Files(path), []string{path})
+}
+
+func TestRotateWithoutRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serial.log")
+	assert.NilError(t, os.WriteFile(path, []byte("first\n"), 0o644))
+	assert.NilError(t, os.WriteFile(RotatedPath(path, 1), []byte("stale\n"), 0o644))
+	assert.NilError(t, Rotate(path, 0))
+
+	assert.DeepEqual(t, Files(path), []string{path})
+	st, err := os.Stat(path)
+	assert.NilError(t, err)
+	assert.Equal(t, st.Size(), int64(0))
+}
@@ -0,0 +1,308 @@
+// Package macaddress allocates the MAC addresses of the network interfaces of the instances.
+//
+// The addresses are derived from the machine ID and the unique ID of the interface (the "owner"),
+// so that an interface gets the same address across restarts. The allocated addresses are recorded in
+// the allocation table "$LIMA_HOME/_networks/mac-addresses.json", and a colliding address (with another
+// instance, or with an interface of the host) is re-derived with a counter, until a free address is found.
+package macaddress
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/osutil"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// maxAttempts is the maximum number of the candidates tried for an owner.
+const maxAttempts = 1000
+
+// Pool is a range of MAC addresses, with the first Bits bits fixed to Prefix.
+type Pool struct {
+	Prefix net.HardwareAddr
+	Bits   int
+}
+
+// DefaultPool is "52:55:55:00:00:00/24".
+//
+// "5" is the magic number in the Lima ecosystem.
+// (Visit https://en.wiktionary.org/wiki/lima and Command-F "five")
+//
+// But the second hex number is changed to 2 to satisfy the convention for
+// local MAC addresses (https://en.wikipedia.org/wiki/MAC_address#Ranges_of_group_and_locally_administered_addresses)
+//
+// See also https://gitlab.com/wireshark/wireshark/-/blob/release-4.0/manuf to confirm the uniqueness of this prefix.
+func DefaultPool() Pool {
+	return Pool{Prefix: net.HardwareAddr{0x52, 0x55, 0x55, 0, 0, 0}, Bits: 24}
+}
+
+// ParsePool parses a pool in the form of "52:55:55:aa:00:00/32".
+// The fixed bits must cover the first byte, which must be a locally administered unicast address,
+// and at least 8 bits must be left for the addresses.
+func ParsePool(s string) (Pool, error) {
+	addr, bitsStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return Pool{}, fmt.Errorf("invalid MAC address pool %q: expected ADDRESS/BITS, e.g., \"52:55:55:aa:00:00/32\"", s)
+	}
+	hw, err := net.ParseMAC(addr)
+	if err != nil {
+		return Pool{}, fmt.Errorf("invalid MAC address pool %q: %w", s, err)
+	}
+	if len(hw) != 6 {
+		return Pool{}, fmt.Errorf("invalid MAC address pool %q: must be a 48 bit (6 bytes) MAC address", s)
+	}
+	bits, err := strconv.Atoi(bitsStr)
+	if err != nil || bits < 8 || bits > 40 {
+		return Pool{}, fmt.Errorf("invalid MAC address pool %q: the number of the fixed bits must be between 8 and 40", s)
+	}
+	if hw[0]&0x02 == 0 || hw[0]&0x01 != 0 {
+		return Pool{}, fmt.Errorf("invalid MAC address pool %q: must be a locally administered unicast address (the first byte must be like 0x52)", s)
+	}
+	p := Pool{Prefix: hw, Bits: bits}
+	if p.String() != fmt.Sprintf("%s/%d", hw, bits) {
+		return Pool{}, fmt.Errorf("invalid MAC address pool %q: the bits after the first %d bits must be zero (%s)", s, bits, p)
+	}
+	return p, nil
+}
+
+// String returns the pool in the form of "52:55:55:00:00:00/24".
+func (p Pool) String() string {
+	return fmt.Sprintf("%s/%d", toHardwareAddr(toUint64(p.Prefix)&p.mask()), p.Bits)
+}
+
+// Contains returns true if hw is in the pool.
+func (p Pool) Contains(hw net.HardwareAddr) bool {
+	return len(hw) == 6 && toUint64(hw)&p.mask() == toUint64(p.Prefix)&p.mask()
+}
+
+func (p Pool) mask() uint64 {
+	return (1<<48 - 1) &^ (1<<(48-p.Bits) - 1)
+}
+
+// candidate returns the n-th candidate address for the owner.
+// The 0-th candidate in DefaultPool is the same as the address derived by the older versions of Lima.
+func (p Pool) candidate(owner string, n int) net.HardwareAddr {
+	seed := osutil.MachineID() + owner
+	if n > 0 {
+		seed += "#" + strconv.Itoa(n)
+	}
+	sha := sha256.Sum256([]byte(seed))
+	return toHardwareAddr(toUint64(p.Prefix)&p.mask() | toUint64(sha[0:6])>>p.Bits)
+}
+
+func toUint64(b []byte) uint64 {
+	var buf [8]byte
+	copy(buf[2:], b)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+func toHardwareAddr(v uint64) net.HardwareAddr {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return net.HardwareAddr(buf[2:])
+}
+
+// table maps the allocated MAC addresses to the owners.
+type table map[string]string
+
+func tableFile() (string, error) {
+	dir, err := dirnames.LimaNetworksDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filenames.MACAddresses), nil
+}
+
+func readTable(file string) (table, error) {
+	t := make(table)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return t, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", file, err)
+	}
+	return t, nil
+}
+
+func (t table) write(file string) error {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (t table) lookup(owner string) string {
+	for mac, o := range t {
+		if o == owner {
+			return mac
+		}
+	}
+	return ""
+}
+
+// prune removes the entries of the owners whose instance directories no longer exist.
+func (t table) prune() {
+	for mac, owner := range t {
+		if _, err := os.Stat(ownerDir(owner)); errors.Is(err, os.ErrNotExist) {
+			logrus.Debugf("Releasing the MAC address %q of %q, which no longer exists", mac, owner)
+			delete(t, mac)
+		}
+	}
+}
+
+// ownerDir returns the instance directory of the owner, i.e., the instance directory itself,
+// or the directory of "lima.yaml#INDEX".
+func ownerDir(owner string) string {
+	if file, _, ok := strings.Cut(owner, "#"); ok {
+		return filepath.Dir(file)
+	}
+	return owner
+}
+
+// hostHardwareAddrs returns the MAC addresses of the interfaces of the host, with the names of the interfaces.
+// Overridden in the tests.
+var hostHardwareAddrs = func() (map[string]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(ifaces))
+	for _, iface := range ifaces {
+		if len(iface.HardwareAddr) > 0 {
+			res[iface.HardwareAddr.String()] = iface.Name
+		}
+	}
+	return res, nil
+}
+
+// withTable calls fn with the allocation table, and writes the table back, while holding the lock.
+func withTable(fn func(t table, host map[string]string) error) error {
+	file, err := tableFile()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	host, err := hostHardwareAddrs()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to get the MAC addresses of the host interfaces")
+	}
+	return lockutil.WithDirLock(dir, func() error {
+		t, err := readTable(file)
+		if err != nil {
+			return err
+		}
+		t.prune()
+		if err := fn(t, host); err != nil {
+			return err
+		}
+		return t.write(file)
+	})
+}
+
+// Lookup returns the MAC address allocated to the owner, or the 0-th candidate in DefaultPool
+// if no address has been allocated yet. The allocation table is not modified.
+func Lookup(owner string) string {
+	file, err := tableFile()
+	if err == nil {
+		var t table
+		if t, err = readTable(file); err == nil {
+			if mac := t.lookup(owner); mac != "" {
+				return mac
+			}
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Debug("Failed to read the MAC address allocation table")
+	}
+	return DefaultPool().candidate(owner, 0).String()
+}
+
+// Allocate allocates a MAC address in the pool to the owner, and records it in the allocation table.
+// The address already allocated to the owner is kept, unless it is out of the pool or collides with a host interface.
+func Allocate(owner string, pool Pool) (string, error) {
+	var res string
+	err := withTable(func(t table, host map[string]string) error {
+		if mac := t.lookup(owner); mac != "" {
+			hw, err := net.ParseMAC(mac)
+			if _, onHost := host[mac]; err == nil && pool.Contains(hw) && !onHost {
+				res = mac
+				return nil
+			}
+			delete(t, mac)
+		}
+		for n := range maxAttempts {
+			mac := pool.candidate(owner, n).String()
+			if other, ok := t[mac]; ok {
+				logrus.Debugf("MAC address %q for %q is already allocated to %q", mac, owner, other)
+				continue
+			}
+			if iface, ok := host[mac]; ok {
+				logrus.Debugf("MAC address %q for %q is already used by the host interface %q", mac, owner, iface)
+				continue
+			}
+			t[mac] = owner
+			res = mac
+			return nil
+		}
+		return fmt.Errorf("failed to allocate a MAC address for %q in the pool %s: no free address found after %d attempts", owner, pool, maxAttempts)
+	})
+	return res, err
+}
+
+// Reserve records the MAC address specified by the user for the owner in the allocation table.
+// An error is returned when the address is already allocated to another owner, or used by a host interface.
+func Reserve(owner, mac string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+	mac = hw.String()
+	return withTable(func(t table, host map[string]string) error {
+		if other, ok := t[mac]; ok && other != owner {
+			return fmt.Errorf("MAC address %q is already allocated to %q", mac, other)
+		}
+		if iface, ok := host[mac]; ok {
+			return fmt.Errorf("MAC address %q is already used by the host interface %q", mac, iface)
+		}
+		if old := t.lookup(owner); old != "" {
+			delete(t, old)
+		}
+		t[mac] = owner
+		return nil
+	})
+}
+
+// Release releases the MAC addresses allocated to the interfaces of the instance in instDir.
+func Release(instDir string) error {
+	return withTable(func(t table, _ map[string]string) error {
+		for mac, owner := range t {
+			if ownerDir(owner) == instDir {
+				delete(t, mac)
+			}
+		}
+		return nil
+	})
+}
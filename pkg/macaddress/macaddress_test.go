@@ -0,0 +1,108 @@
+package macaddress
+
+import (
+	"crypto/sha256"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/osutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestParsePool(t *testing.T) {
+	p, err := ParsePool("52:55:55:AA:00:00/32")
+	assert.NilError(t, err)
+	assert.Equal(t, p.String(), "52:55:55:aa:00:00/32")
+	assert.Assert(t, p.Contains(net.HardwareAddr{0x52, 0x55, 0x55, 0xaa, 0x12, 0x34}))
+	assert.Assert(t, !p.Contains(net.HardwareAddr{0x52, 0x55, 0x55, 0xab, 0x12, 0x34}))
+	assert.Equal(t, DefaultPool().String(), "52:55:55:00:00:00/24")
+
+	for _, s := range []string{
+		"52:55:55:aa:00:00",
+		"52:55:55:aa:00:00/4",
+		"52:55:55:aa:00:00/48",
+		"52:55:55:aa:00:01/32",
+		"50:55:55:aa:00:00/32", // universally administered
+		"53:55:55:aa:00:00/32", // multicast
+		"52:55:55:aa:00/32",
+	} {
+		_, err := ParsePool(s)
+		assert.ErrorContains(t, err, "invalid MAC address pool", s)
+	}
+}
+
+func TestCandidate(t *testing.T) {
+	// The 0-th candidate in the default pool has to be the same as the address derived by the older versions of Lima
+	sha := sha256.Sum256([]byte(osutil.MachineID() + "foo"))
+	legacy := append(net.HardwareAddr{0x52, 0x55, 0x55}, sha[0:3]...)
+	assert.Equal(t, DefaultPool().candidate("foo", 0).String(), legacy.String())
+
+	p, err := ParsePool("52:55:55:aa:00:00/32")
+	assert.NilError(t, err)
+	for n := range 10 {
+		assert.Assert(t, p.Contains(p.candidate("foo", n)))
+	}
+	assert.Assert(t, p.candidate("foo", 0).String() != p.candidate("foo", 1).String())
+}
+
+func TestAllocate(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	instA := filepath.Join(limaHome, "a")
+	instB := filepath.Join(limaHome, "b")
+	assert.NilError(t, os.MkdirAll(instA, 0o755))
+	assert.NilError(t, os.MkdirAll(instB, 0o755))
+	ownerA := filepath.Join(instA, "lima.yaml#0")
+	ownerB := filepath.Join(instB, "lima.yaml#0")
+
+	host := map[string]string{}
+	orig := hostHardwareAddrs
+	hostHardwareAddrs = func() (map[string]string, error) { return host, nil }
+	t.Cleanup(func() { hostHardwareAddrs = orig })
+
+	pool := DefaultPool()
+	macA, err := Allocate(ownerA, pool)
+	assert.NilError(t, err)
+	assert.Equal(t, macA, pool.candidate(ownerA, 0).String())
+	assert.Equal(t, Lookup(ownerA), macA)
+
+	// the same address is kept
+	again, err := Allocate(ownerA, pool)
+	assert.NilError(t, err)
+	assert.Equal(t, again, macA)
+
+	// the address of another instance is not allocated
+	assert.ErrorContains(t, Reserve(ownerB, macA), "already allocated")
+	host[pool.candidate(ownerB, 0).String()] = "bridge100"
+	macB, err := Allocate(ownerB, pool)
+	assert.NilError(t, err)
+	assert.Equal(t, macB, pool.candidate(ownerB, 1).String())
+
+	// the address colliding with a host interface is re-allocated
+	host[macA] = "en0"
+	macA2, err := Allocate(ownerA, pool)
+	assert.NilError(t, err)
+	assert.Assert(t, macA2 != macA)
+	assert.ErrorContains(t, Reserve(ownerA, macA), "host interface \"en0\"")
+
+	// the address in another pool
+	p, err := ParsePool("52:55:55:aa:00:00/32")
+	assert.NilError(t, err)
+	macA3, err := Allocate(ownerA, p)
+	assert.NilError(t, err)
+	hw, err := net.ParseMAC(macA3)
+	assert.NilError(t, err)
+	assert.Assert(t, p.Contains(hw))
+
+	// released on deleting the instance
+	assert.NilError(t, Release(instA))
+	assert.Equal(t, Lookup(ownerA), pool.candidate(ownerA, 0).String())
+	assert.Equal(t, Lookup(ownerB), macB)
+
+	// pruned when the instance directory no longer exists
+	assert.NilError(t, os.RemoveAll(instB))
+	assert.NilError(t, Reserve(ownerA, macB))
+	assert.Equal(t, Lookup(ownerA), macB)
+}
@@ -2,6 +2,8 @@
 package nativeimgutil
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,7 +15,7 @@ import (
 	"github.com/lima-vm/go-qcow2reader/convert"
 	"github.com/lima-vm/go-qcow2reader/image/qcow2"
 	"github.com/lima-vm/go-qcow2reader/image/raw"
-	"github.com/lima-vm/lima/pkg/progressbar"
+	"github.com/lima-vm/lima/pkg/progress"
 	"github.com/sirupsen/logrus"
 )
 
@@ -74,10 +76,7 @@ func ConvertToRaw(source, dest string, size *int64, allowSourceWithBackingFile b
 	}
 
 	// Copy
-	bar, err := progressbar.New(srcImg.Size())
-	if err != nil {
-		return err
-	}
+	bar := progress.New("Converting "+filepath.Base(source), srcImg.Size())
 	bar.Start()
 	err = convert.Convert(destTmpF, srcImg, convert.Options{Progress: bar})
 	bar.Finish()
@@ -131,3 +130,81 @@ func MakeSparse(f *os.File, n int64) error {
 	}
 	return f.Truncate(n)
 }
+
+// qcow2Magic is the magic of the qcow2 header.
+// See https://gitlab.com/qemu-project/qemu/-/blob/master/docs/interop/qcow2.txt for the header layout.
+const qcow2Magic = "QFI\xfb"
+
+// BackingFile returns the backing file name of a qcow2 image, as recorded in the header.
+// The name is read from the header directly, without checking the readability of the image,
+// so that it can be validated for untrusted images.
+// BackingFile returns an empty string for the images without a backing file, and for non-qcow2 images.
+func BackingFile(image string) (string, error) {
+	f, err := os.Open(image)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	name, _, err := readBackingFile(f)
+	return name, err
+}
+
+// readBackingFile returns the backing file name of a qcow2 image, and the offset of the name.
+func readBackingFile(f *os.File) (string, int64, error) {
+	var hdr [20]byte
+	if _, err := f.ReadAt(hdr[:], 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", 0, nil
+		}
+		return "", 0, err
+	}
+	if string(hdr[:4]) != qcow2Magic {
+		return "", 0, nil
+	}
+	offset := int64(binary.BigEndian.Uint64(hdr[8:16]))
+	size := binary.BigEndian.Uint32(hdr[16:20])
+	if offset == 0 || size == 0 {
+		return "", 0, nil
+	}
+	if size > 1023 {
+		return "", 0, fmt.Errorf("invalid backing file name size %d of %q", size, f.Name())
+	}
+	name := make([]byte, size)
+	if _, err := f.ReadAt(name, offset); err != nil {
+		return "", 0, fmt.Errorf("failed to read the backing file name of %q: %w", f.Name(), err)
+	}
+	return string(name), offset, nil
+}
+
+// RelativizeBackingFile rewrites the absolute backing file name of a qcow2 image into its base name,
+// so that the backing file is looked up in the directory of the image.
+// RelativizeBackingFile is a NOP for the images without a backing file, and for non-qcow2 images.
+func RelativizeBackingFile(image string) error {
+	f, err := os.OpenFile(image, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	backingFile, offset, err := readBackingFile(f)
+	if err != nil {
+		return err
+	}
+	if backingFile == "" || !filepath.IsAbs(backingFile) {
+		return nil
+	}
+	// The base name is always shorter than the absolute path, so it fits in place.
+	name := filepath.Base(backingFile)
+	if _, err := f.WriteAt([]byte(name), offset); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(name)))
+	if _, err := f.WriteAt(size[:], 16); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	logrus.Infof("Changed the backing file of %q from %q to %q", image, backingFile, name)
+	return nil
+}
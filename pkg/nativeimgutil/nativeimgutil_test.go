@@ -1,6 +1,7 @@
 package nativeimgutil
 
 import (
+	"encoding/binary"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -83,3 +84,44 @@ func assertFileEquals(t *testing.T, expected, actual string) {
 	assert.NilError(t, err)
 	assert.DeepEqual(t, expectedContent, actualContent)
 }
+
+// writeQcow2Header writes a qcow2 v2 header with the backing file name, without the tables.
+func writeQcow2Header(t *testing.T, name, backingFile string) {
+	hdr := make([]byte, 72)
+	copy(hdr, qcow2Magic)
+	binary.BigEndian.PutUint32(hdr[4:8], 2)
+	binary.BigEndian.PutUint64(hdr[8:16], uint64(len(hdr)))
+	binary.BigEndian.PutUint32(hdr[16:20], uint32(len(backingFile)))
+	binary.BigEndian.PutUint32(hdr[20:24], 16)
+	assert.NilError(t, os.WriteFile(name, append(hdr, backingFile...), 0o644))
+}
+
+func TestRelativizeBackingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	image := filepath.Join(tmpDir, "diffdisk")
+	for _, tc := range []struct {
+		backingFile string
+		expected    string
+	}{
+		{"/Users/foo/.lima/default/basedisk", "basedisk"},
+		{"basedisk", "basedisk"},
+		{"../../../../Users/foo/secret.img", "../../../../Users/foo/secret.img"},
+		{"", ""},
+	} {
+		writeQcow2Header(t, image, tc.backingFile)
+		backingFile, err := BackingFile(image)
+		assert.NilError(t, err)
+		assert.Equal(t, backingFile, tc.backingFile)
+		assert.NilError(t, RelativizeBackingFile(image))
+		backingFile, err = BackingFile(image)
+		assert.NilError(t, err)
+		assert.Equal(t, backingFile, tc.expected)
+	}
+
+	raw := filepath.Join(tmpDir, "raw")
+	assert.NilError(t, os.WriteFile(raw, []byte("raw"), 0o644))
+	backingFile, err := BackingFile(raw)
+	assert.NilError(t, err)
+	assert.Equal(t, backingFile, "")
+	assert.NilError(t, RelativizeBackingFile(raw))
+}
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"github.com/lima-vm/lima/pkg/macaddress"
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 )
@@ -25,6 +26,22 @@ func (c *Config) Check(name string) error {
 	return fmt.Errorf("network %q is not defined", name)
 }
 
+// MACAddressPool returns the pool of the MAC addresses allocated to the instances on the network.
+func (c *Config) MACAddressPool(name string) (macaddress.Pool, error) {
+	if err := c.Check(name); err != nil {
+		return macaddress.Pool{}, err
+	}
+	s := c.Networks[name].MACAddressPool
+	if s == "" {
+		return macaddress.DefaultPool(), nil
+	}
+	pool, err := macaddress.ParsePool(s)
+	if err != nil {
+		return macaddress.Pool{}, fmt.Errorf("networks.yaml field `networks.%s.macAddressPool` error: %w", name, err)
+	}
+	return pool, nil
+}
+
 // Usernet returns true if the mode of given network is ModeUserV2.
 func (c *Config) Usernet(name string) (bool, error) {
 	if nw, ok := c.Networks[name]; ok {
@@ -33,6 +50,20 @@ func (c *Config) Usernet(name string) (bool, error) {
 	return false, fmt.Errorf("network %q is not defined", name)
 }
 
+// Switch returns true if the mode of given network is ModeSwitch.
+func (c *Config) Switch(name string) (bool, error) {
+	if nw, ok := c.Networks[name]; ok {
+		return nw.Mode == ModeSwitch, nil
+	}
+	return false, fmt.Errorf("network %q is not defined", name)
+}
+
+// SwitchDomain returns the DNS domain of the instances on a "switch" network, e.g., "switch.internal".
+// An instance is resolvable as "lima-<NAME>.<DOMAIN>" from the other instances on the network.
+func SwitchDomain(name string) string {
+	return name + ".internal"
+}
+
 // DaemonPath returns the daemon path.
 func (c *Config) DaemonPath(daemon string) (string, error) {
 	switch daemon {
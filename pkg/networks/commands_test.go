@@ -21,6 +21,21 @@ func TestCheck(t *testing.T) {
 	assert.ErrorContains(t, err, "not defined")
 }
 
+func TestSwitch(t *testing.T) {
+	config, err := DefaultConfig()
+	assert.NilError(t, err)
+
+	isSwitch, err := config.Switch("switch")
+	assert.NilError(t, err)
+	assert.Assert(t, isSwitch)
+	isSwitch, err = config.Switch("user-v2")
+	assert.NilError(t, err)
+	assert.Assert(t, !isSwitch)
+	_, err = config.Switch("unknown")
+	assert.ErrorContains(t, err, "not defined")
+	assert.Equal(t, SwitchDomain("switch"), "switch.internal")
+}
+
 func TestLogFile(t *testing.T) {
 	config, err := DefaultConfig()
 	assert.NilError(t, err)
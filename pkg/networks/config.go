@@ -184,3 +184,31 @@ func IsUsernet(name string) bool {
 	}
 	return isUsernet
 }
+
+// IsWireGuard returns true if the given network name is a "wireguard" network.
+// It return false if the cache cannot be loaded or the network is not defined.
+func IsWireGuard(name string) bool {
+	loadCache()
+	if cache.err != nil {
+		return false
+	}
+	isWireGuard, err := cache.cfg.WireGuard(name)
+	if err != nil {
+		return false
+	}
+	return isWireGuard
+}
+
+// IsSwitch returns true if the given network name is a "switch" network.
+// It return false if the cache cannot be loaded or the network is not defined.
+func IsSwitch(name string) bool {
+	loadCache()
+	if cache.err != nil {
+		return false
+	}
+	isSwitch, err := cache.cfg.Switch(name)
+	if err != nil {
+		return false
+	}
+	return isSwitch
+}
@@ -6,4 +6,8 @@ const (
 	SlirpNetwork   = "192.168.5.0/24"
 	SlirpGateway   = "192.168.5.2"
 	SlirpIPAddress = "192.168.5.15"
+	// SlirpIPv6Network is the IPv6 subnet of the gvisor-tap-vsock network that runs in the host agent,
+	// i.e., the default network of VZ, and the network of QEMU with `egressPolicy` or `metadataService`.
+	// The built-in user-mode network of QEMU has its own IPv6 subnet (fec0::/64).
+	SlirpIPv6Network = "fd4c:696d:6100:5::/64"
 )
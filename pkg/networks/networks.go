@@ -1,6 +1,10 @@
 package networks
 
-import "net"
+import (
+	"net"
+
+	"github.com/lima-vm/lima/pkg/networks/wireguard"
+)
 
 type Config struct {
 	Paths    Paths              `yaml:"paths"`
@@ -19,12 +23,25 @@ const (
 	ModeHost    = "host"
 	ModeShared  = "shared"
 	ModeBridged = "bridged"
+	// ModeWireGuard is a WireGuard mesh of the instances on this host and on other hosts; see pkg/networks/wireguard.
+	ModeWireGuard = "wireguard"
+	// ModeSwitch is an internal switch between the instances on this host, run by the user without sudo.
+	// Unlike "user-v2", the network is not connected to the outside, and is never used as the default network.
+	ModeSwitch = "switch"
 )
 
 type Network struct {
-	Mode      string `yaml:"mode"`                // "host", "shared", or "bridged"
-	Interface string `yaml:"interface,omitempty"` // only used by "bridged" networks
-	Gateway   net.IP `yaml:"gateway,omitempty"`   // only used by "host" and "shared" networks
-	DHCPEnd   net.IP `yaml:"dhcpEnd,omitempty"`   // default: same as Gateway, last byte is 254
-	NetMask   net.IP `yaml:"netmask,omitempty"`   // default: 255.255.255.0
+	Mode       string `yaml:"mode"`                 // "user-v2", "switch", "host", "shared", "bridged", or "wireguard"
+	Interface  string `yaml:"interface,omitempty"`  // only used by "bridged" networks
+	Gateway    net.IP `yaml:"gateway,omitempty"`    // only used by "user-v2", "switch", "host", and "shared" networks
+	DHCPEnd    net.IP `yaml:"dhcpEnd,omitempty"`    // default: same as Gateway, last byte is 254
+	NetMask    net.IP `yaml:"netmask,omitempty"`    // default: 255.255.255.0
+	IPv6Subnet string `yaml:"ipv6Subnet,omitempty"` // only used by "user-v2" networks; a /64 prefix; IPv6 is disabled when empty
+	// MACAddressPool is the range of the MAC addresses allocated to the instances, e.g., "52:55:55:aa:00:00/32".
+	// default: "52:55:55:00:00:00/24"
+	MACAddressPool string `yaml:"macAddressPool,omitempty"`
+	// The following fields are only used by "wireguard" networks
+	Subnet     string           `yaml:"subnet,omitempty"`     // the subnet of the mesh, the same on all the hosts, e.g., "10.99.0.0/24"
+	ListenPort int              `yaml:"listenPort,omitempty"` // the first UDP port; default: 51820
+	Peers      []wireguard.Peer `yaml:"peers,omitempty"`      // the members of the mesh on the other hosts
 }
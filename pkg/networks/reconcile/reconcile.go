@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lima-vm/lima/pkg/lockutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/networks/usernet"
 	"github.com/lima-vm/lima/pkg/osutil"
@@ -19,39 +20,64 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Reconcile starts the networks used by the running instances and by newInst, and stops the other networks.
+//
+// newInst is about to be started. Its networks are kept running while the current process is running,
+// until the instance is running, even when Reconcile is called by another process in the meantime,
+// e.g., by the host agent of another instance that has stopped.
 func Reconcile(ctx context.Context, newInst string) error {
-	cfg, err := networks.LoadConfig()
+	networksDir, err := dirnames.LimaNetworksDir()
 	if err != nil {
 		return err
 	}
-	instances, err := store.Instances()
+	if err := os.MkdirAll(networksDir, 0o755); err != nil {
+		return err
+	}
+	return lockutil.WithDirLock(networksDir, func() error {
+		return reconcile(ctx, newInst)
+	})
+}
+
+// Release stops the networks that are no longer used after instName has stopped.
+// It is called by the host agent on exiting, so that the networks are stopped even when
+// the instance was not stopped by `limactl stop`, e.g., on `sudo poweroff` in the guest.
+func Release(ctx context.Context, instName string) error {
+	networksDir, err := dirnames.LimaNetworksDir()
 	if err != nil {
 		return err
 	}
-	activeNetwork := make(map[string]bool, 3)
-	for _, instName := range instances {
-		instance, err := store.Inspect(instName)
+	if err := os.MkdirAll(networksDir, 0o755); err != nil {
+		return err
+	}
+	return lockutil.WithDirLock(networksDir, func() error {
+		pidFile, err := startingPIDFile(instName)
 		if err != nil {
 			return err
 		}
-		// newInst is about to be started, so its networks should be running
-		if instance.Status != store.StatusRunning && instName != newInst {
-			continue
+		if err := os.RemoveAll(pidFile); err != nil {
+			return err
 		}
-		for _, nw := range instance.Networks {
-			if nw.Lima == "" {
-				continue
-			}
-			if _, ok := cfg.Networks[nw.Lima]; !ok {
-				logrus.Errorf("network %q (used by instance %q) is missing from networks.yaml", nw.Lima, instName)
-				continue
-			}
-			activeNetwork[nw.Lima] = true
+		return reconcile(ctx, "")
+	})
+}
+
+func reconcile(ctx context.Context, newInst string) error {
+	cfg, err := networks.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if newInst != "" {
+		if err := writeStartingPIDFile(newInst); err != nil {
+			return err
 		}
 	}
+	users, err := Users()
+	if err != nil {
+		return err
+	}
 	for name := range cfg.Networks {
 		var err error
-		if activeNetwork[name] {
+		if len(users[name]) > 0 {
 			err = startNetwork(ctx, &cfg, name)
 		} else {
 			err = stopNetwork(ctx, &cfg, name)
@@ -179,12 +205,20 @@ func startNetwork(ctx context.Context, cfg *networks.Config, name string) error
 	if err != nil {
 		return err
 	}
-	if isUsernet {
+	isSwitch, err := cfg.Switch(name)
+	if err != nil {
+		return err
+	}
+	if isUsernet || isSwitch {
 		if err := usernet.Start(ctx, name); err != nil {
 			return fmt.Errorf("failed to start usernet %q: %w", name, err)
 		}
 		return nil
 	}
+	// "wireguard" networks have no daemon on the host
+	if isWireGuard, err := cfg.WireGuard(name); err != nil || isWireGuard {
+		return err
+	}
 
 	if runtime.GOOS != "darwin" {
 		return nil
@@ -222,12 +256,20 @@ func stopNetwork(ctx context.Context, cfg *networks.Config, name string) error {
 	if err != nil {
 		return err
 	}
-	if isUsernet {
+	isSwitch, err := cfg.Switch(name)
+	if err != nil {
+		return err
+	}
+	if isUsernet || isSwitch {
 		if err := usernet.Stop(ctx, name); err != nil {
 			return fmt.Errorf("failed to stop usernet %q: %w", name, err)
 		}
 		return nil
 	}
+	// "wireguard" networks have no daemon on the host
+	if isWireGuard, err := cfg.WireGuard(name); err != nil || isWireGuard {
+		return err
+	}
 
 	if runtime.GOOS != "darwin" {
 		return nil
@@ -0,0 +1,155 @@
+package networks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+
+	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/networks/usernet"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/sirupsen/logrus"
+)
+
+// Status is the status of a network in networks.yaml.
+type Status struct {
+	Name    string `json:"name"`
+	Mode    string `json:"mode"`
+	Running bool   `json:"running"`
+	// Instances are the instances that use the network, i.e., the running instances and the instances being started.
+	// The network is stopped when the last instance stops.
+	Instances []string `json:"instances"`
+}
+
+// List returns the status of the networks in networks.yaml, sorted by name.
+func List() ([]Status, error) {
+	cfg, err := networks.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	users, err := Users()
+	if err != nil {
+		return nil, err
+	}
+	var res []Status
+	for name, nw := range cfg.Networks {
+		running, err := isRunning(&cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		if nw.Mode == networks.ModeWireGuard {
+			// A "wireguard" network has no daemon; it runs in the guests that use it
+			running = len(users[name]) > 0
+		}
+		res = append(res, Status{
+			Name:      name,
+			Mode:      nw.Mode,
+			Running:   running,
+			Instances: append([]string{}, users[name]...),
+		})
+	}
+	slices.SortFunc(res, func(a, b Status) int {
+		switch {
+		case a.Name < b.Name:
+			return -1
+		case a.Name > b.Name:
+			return 1
+		}
+		return 0
+	})
+	return res, nil
+}
+
+// Users returns the instances that use each network: the running instances, and the instances being started.
+func Users() (map[string][]string, error) {
+	cfg, err := networks.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	instances, err := store.Instances()
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string][]string)
+	for _, instName := range instances {
+		inst, err := store.Inspect(instName)
+		if err != nil {
+			return nil, err
+		}
+		starting, err := isStarting(instName)
+		if err != nil {
+			return nil, err
+		}
+		if inst.Status != store.StatusRunning && !starting {
+			continue
+		}
+		for _, nw := range inst.Networks {
+			if nw.Lima == "" {
+				continue
+			}
+			if _, ok := cfg.Networks[nw.Lima]; !ok {
+				logrus.Errorf("network %q (used by instance %q) is missing from networks.yaml", nw.Lima, instName)
+				continue
+			}
+			if !slices.Contains(users[nw.Lima], instName) {
+				users[nw.Lima] = append(users[nw.Lima], instName)
+			}
+		}
+	}
+	return users, nil
+}
+
+func isRunning(cfg *networks.Config, name string) (bool, error) {
+	isUsernet, err := cfg.Usernet(name)
+	if err != nil {
+		return false, err
+	}
+	isSwitch, err := cfg.Switch(name)
+	if err != nil {
+		return false, err
+	}
+	pidFile := cfg.PIDFile(name, networks.SocketVMNet)
+	if isUsernet || isSwitch {
+		if pidFile, err = usernet.PIDFile(name); err != nil {
+			return false, err
+		}
+	} else if runtime.GOOS != "darwin" {
+		return false, nil
+	}
+	pid, err := store.ReadPIDFile(pidFile)
+	return pid != 0, err
+}
+
+// startingPIDFile returns "$LIMA_HOME/_networks/_starting/<INSTANCE>.pid", which contains the PID of
+// the process that is starting the instance.
+func startingPIDFile(instName string) (string, error) {
+	networksDir, err := dirnames.LimaNetworksDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(networksDir, "_starting", instName+".pid"), nil
+}
+
+func writeStartingPIDFile(instName string) error {
+	pidFile, err := startingPIDFile(instName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(pidFile), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+// isStarting returns true while the process that is starting the instance is running.
+func isStarting(instName string) (bool, error) {
+	pidFile, err := startingPIDFile(instName)
+	if err != nil {
+		return false, err
+	}
+	pid, err := store.ReadPIDFile(pidFile)
+	return pid != 0, err
+}
@@ -0,0 +1,35 @@
+package networks
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStartingPIDFile(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+
+	starting, err := isStarting("default")
+	assert.NilError(t, err)
+	assert.Assert(t, !starting)
+
+	assert.NilError(t, writeStartingPIDFile("default"))
+	starting, err = isStarting("default")
+	assert.NilError(t, err)
+	assert.Assert(t, starting)
+}
+
+func TestList(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+
+	list, err := List()
+	assert.NilError(t, err)
+	assert.Assert(t, len(list) > 0)
+	for i, nw := range list {
+		if i > 0 {
+			assert.Assert(t, list[i-1].Name < nw.Name)
+		}
+		assert.Assert(t, !nw.Running)
+		assert.Equal(t, len(nw.Instances), 0)
+	}
+}
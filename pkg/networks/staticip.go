@@ -0,0 +1,62 @@
+package networks
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// StaticIPPrefix validates the static IPv4 address of an instance on a "host", "shared", or "wireguard" network,
+// and returns the address with the prefix length of the network, e.g., "192.168.105.10/24".
+// inDHCPRange is true when the address may also be leased to another instance by the DHCP server,
+// i.e., when it is between the gateway and `dhcpEnd`.
+func (c *Config) StaticIPPrefix(name string, ip netip.Addr) (prefix netip.Prefix, inDHCPRange bool, err error) {
+	if err := c.Check(name); err != nil {
+		return netip.Prefix{}, false, err
+	}
+	nw := c.Networks[name]
+	if nw.Mode == ModeWireGuard {
+		prefix, err := c.wireGuardStaticIPPrefix(name, ip)
+		return prefix, false, err
+	}
+	if nw.Mode != ModeHost && nw.Mode != ModeShared {
+		return netip.Prefix{}, false, fmt.Errorf("a static IP address is only supported by %q, %q, and %q networks, not by %q (mode %q)",
+			ModeHost, ModeShared, ModeWireGuard, name, nw.Mode)
+	}
+	if !ip.Is4() {
+		return netip.Prefix{}, false, fmt.Errorf("static IP address %q must be an IPv4 address", ip)
+	}
+	gateway, ok := netip.AddrFromSlice(nw.Gateway.To4())
+	if !ok {
+		return netip.Prefix{}, false, fmt.Errorf("network %q has no valid gateway", name)
+	}
+	mask := nw.NetMask
+	if mask == nil {
+		mask = net.ParseIP("255.255.255.0")
+	}
+	bits, size := net.IPMask(mask.To4()).Size()
+	if size != 32 {
+		return netip.Prefix{}, false, fmt.Errorf("network %q has an invalid netmask %q", name, mask)
+	}
+	subnet := netip.PrefixFrom(gateway, bits).Masked()
+	if !subnet.Contains(ip) {
+		return netip.Prefix{}, false, fmt.Errorf("static IP address %q is not in the subnet %q of network %q", ip, subnet, name)
+	}
+	var broadcast [4]byte
+	base := subnet.Addr().As4()
+	for i := range broadcast {
+		broadcast[i] = base[i] | ^mask.To4()[i]
+	}
+	switch ip {
+	case subnet.Addr(), netip.AddrFrom4(broadcast):
+		return netip.Prefix{}, false, fmt.Errorf("static IP address %q must not be the network or broadcast address of %q", ip, subnet)
+	case gateway:
+		return netip.Prefix{}, false, fmt.Errorf("static IP address %q must not be the gateway of network %q", ip, name)
+	}
+	dhcpEnd, ok := netip.AddrFromSlice(nw.DHCPEnd.To4())
+	if !ok {
+		dhcpEnd = netip.AddrFrom4(broadcast).Prev()
+	}
+	inDHCPRange = gateway.Less(ip) && !dhcpEnd.Less(ip)
+	return netip.PrefixFrom(ip, bits), inDHCPRange, nil
+}
@@ -0,0 +1,41 @@
+package networks
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStaticIPPrefix(t *testing.T) {
+	cfg := Config{Networks: map[string]Network{
+		"shared": {
+			Mode:    ModeShared,
+			Gateway: net.ParseIP("192.168.105.1"),
+			DHCPEnd: net.ParseIP("192.168.105.199"),
+			NetMask: net.ParseIP("255.255.255.0"),
+		},
+		"bridged": {Mode: ModeBridged, Interface: "en0"},
+	}}
+
+	prefix, inDHCPRange, err := cfg.StaticIPPrefix("shared", netip.MustParseAddr("192.168.105.200"))
+	assert.NilError(t, err)
+	assert.Equal(t, prefix.String(), "192.168.105.200/24")
+	assert.Assert(t, !inDHCPRange)
+
+	_, inDHCPRange, err = cfg.StaticIPPrefix("shared", netip.MustParseAddr("192.168.105.10"))
+	assert.NilError(t, err)
+	assert.Assert(t, inDHCPRange)
+
+	for _, ip := range []string{"192.168.106.10", "192.168.105.0", "192.168.105.1", "192.168.105.255", "fd00::10"} {
+		_, _, err = cfg.StaticIPPrefix("shared", netip.MustParseAddr(ip))
+		assert.Assert(t, err != nil, ip)
+	}
+
+	_, _, err = cfg.StaticIPPrefix("bridged", netip.MustParseAddr("192.168.105.10"))
+	assert.ErrorContains(t, err, "only supported by")
+
+	_, _, err = cfg.StaticIPPrefix("unknown", netip.MustParseAddr("192.168.105.10"))
+	assert.ErrorContains(t, err, "not defined")
+}
@@ -23,7 +23,7 @@ func Sudoers() (string, error) {
 	// names must be in stable order to be able to check if sudoers file needs updating
 	names := make([]string, 0, len(cfg.Networks))
 	for name, nw := range cfg.Networks {
-		if nw.Mode == ModeUserV2 {
+		if nw.Mode == ModeUserV2 || nw.Mode == ModeSwitch || nw.Mode == ModeWireGuard {
 			continue // no sudo needed
 		}
 		names = append(names, name)
@@ -51,6 +51,23 @@ func (c *Client) UnExposeSSH(sshPort int) error {
 	})
 }
 
+// ExposeUDP forwards the UDP address on the host to the UDP address in the network.
+func (c *Client) ExposeUDP(local, remote string) error {
+	return c.delegate.Expose(&types.ExposeRequest{
+		Local:    local,
+		Remote:   remote,
+		Protocol: "udp",
+	})
+}
+
+// UnexposeUDP stops forwarding the UDP address on the host.
+func (c *Client) UnexposeUDP(local string) error {
+	return c.delegate.Unexpose(&types.UnexposeRequest{
+		Local:    local,
+		Protocol: "udp",
+	})
+}
+
 func (c *Client) AddDNSHosts(hosts map[string]string) error {
 	hosts["host.lima.internal"] = GatewayIP(c.subnet)
 	zones := dnshosts.ExtractZones(hosts)
@@ -63,6 +80,17 @@ func (c *Client) AddDNSHosts(hosts map[string]string) error {
 	return nil
 }
 
+// AddDNSHost adds the name of a VM to the DNS server of the gateway.
+// Unlike AddDNSHosts, "host.lima.internal" is not added, e.g., for a "switch" network that is not connected to the host.
+func (c *Client) AddDNSHost(name, ipAddress string) error {
+	for _, zone := range dnshosts.ExtractZones(map[string]string{name: ipAddress}) {
+		if err := c.delegate.AddDNS(&zone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Client) ResolveAndForwardSSH(ipAddr string, sshPort int) error {
 	err := c.delegate.Expose(&types.ExposeRequest{
 		Local:    fmt.Sprintf("127.0.0.1:%d", sshPort),
@@ -84,6 +84,19 @@ func Subnet(name string) (net.IP, error) {
 	return ipNet.IP, err
 }
 
+// IPv6Subnet returns the IPv6 subnet for the given network name, or an empty string if IPv6 is disabled.
+func IPv6Subnet(name string) (string, error) {
+	cfg, err := networks.LoadConfig()
+	if err != nil {
+		return "", err
+	}
+	err = cfg.Check(name)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Networks[name].IPv6Subnet, nil
+}
+
 // GatewayIP returns the 2nd IP for the given subnet.
 func GatewayIP(subnet net.IP) string {
 	return cidr.Inc(cidr.Inc(subnet)).String()
@@ -0,0 +1,117 @@
+package usernet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	hostdns "github.com/lima-vm/lima/pkg/hostagent/dns"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+// dnsHandler answers the queries of the VMs from the zones added to gvisor-tap-vsock (see Client.AddDNSHosts),
+// and otherwise with the host resolver.
+// Unlike the DNS server of gvisor-tap-vsock, AAAA queries are answered too.
+type dnsHandler struct {
+	mu       sync.RWMutex
+	zones    []types.Zone
+	resolver dns.Handler
+}
+
+func newDNSHandler() (*dnsHandler, error) {
+	resolver, err := hostdns.NewHandler(hostdns.HandlerOptions{IPv6: true})
+	if err != nil {
+		return nil, err
+	}
+	return &dnsHandler{resolver: resolver}, nil
+}
+
+func (h *dnsHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if reply := h.zoneReply(req); reply != nil {
+		if err := w.WriteMsg(reply); err != nil {
+			logrus.WithError(err).Debug("failed to write a DNS reply")
+		}
+		return
+	}
+	h.resolver.ServeDNS(w, req)
+}
+
+// zoneReply returns the reply for an A or AAAA query of a name in the zones, or nil.
+// As the zones only have IPv4 addresses, AAAA queries are answered with NODATA.
+func (h *dnsHandler) zoneReply(req *dns.Msg) *dns.Msg {
+	if len(req.Question) != 1 {
+		return nil
+	}
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET || (q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA) {
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, zone := range h.zones {
+		name, ok := strings.CutSuffix(dns.CanonicalName(q.Name), "."+dns.CanonicalName(zone.Name))
+		if !ok {
+			continue
+		}
+		reply := new(dns.Msg)
+		reply.SetReply(req)
+		reply.RecursionAvailable = true
+		ip := zone.DefaultIP
+		for _, record := range zone.Records {
+			if (record.Name != "" && record.Name == name) || (record.Regexp != nil && record.Regexp.MatchString(name)) {
+				ip = record.IP
+				break
+			}
+		}
+		if len(ip) == 0 {
+			reply.Rcode = dns.RcodeNameError
+			return reply
+		}
+		if ip4 := ip.To4(); q.Qtype == dns.TypeA && ip4 != nil {
+			reply.Answer = append(reply.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   ip4,
+			})
+		}
+		return reply
+	}
+	return nil
+}
+
+// addZone merges the zone in the same way as gvisor-tap-vsock.
+func (h *dnsHandler) addZone(zone types.Zone) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.zones {
+		if h.zones[i].Name == zone.Name {
+			zone.Records = append(zone.Records, h.zones[i].Records...)
+			h.zones[i] = zone
+			return
+		}
+	}
+	h.zones = append(h.zones, zone)
+}
+
+// mirrorZones wraps the `/services/dns/add` API of gvisor-tap-vsock, so that the zones are also added to h.
+func (h *dnsHandler) mirrorZones(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var zone types.Zone
+			if err := json.Unmarshal(body, &zone); err == nil {
+				h.addZone(zone)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package usernet
+
+import (
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/miekg/dns"
+	"gotest.tools/v3/assert"
+)
+
+func TestDNSHandlerZones(t *testing.T) {
+	h, err := newDNSHandler()
+	assert.NilError(t, err)
+	h.addZone(types.Zone{
+		Name:    "internal.",
+		Records: []types.Record{{Name: "host.lima", IP: net.ParseIP("192.168.5.2")}},
+	})
+	h.addZone(types.Zone{
+		Name:    "internal.",
+		Records: []types.Record{{Regexp: regexp.MustCompile(`^lima-.*$`), IP: net.ParseIP("192.168.5.15")}},
+	})
+	assert.Equal(t, len(h.zones), 1)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		return h.zoneReply(req)
+	}
+
+	reply := query("host.lima.internal.", dns.TypeA)
+	assert.Equal(t, reply.Rcode, dns.RcodeSuccess)
+	assert.Equal(t, len(reply.Answer), 1)
+	assert.Equal(t, reply.Answer[0].(*dns.A).A.String(), "192.168.5.2")
+
+	reply = query("LIMA-default.internal.", dns.TypeA)
+	assert.Equal(t, len(reply.Answer), 1)
+	assert.Equal(t, reply.Answer[0].(*dns.A).A.String(), "192.168.5.15")
+
+	reply = query("host.lima.internal.", dns.TypeAAAA)
+	assert.Equal(t, reply.Rcode, dns.RcodeSuccess, "NODATA")
+	assert.Equal(t, len(reply.Answer), 0)
+
+	reply = query("unknown.internal.", dns.TypeA)
+	assert.Equal(t, reply.Rcode, dns.RcodeNameError)
+
+	assert.Assert(t, query("example.com.", dns.TypeAAAA) == nil, "resolved by the host")
+	assert.Assert(t, query("host.lima.internal.", dns.TypeTXT) == nil, "resolved by the host")
+}
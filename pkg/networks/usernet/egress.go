@@ -0,0 +1,320 @@
+package usernet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	ipProtoTCP    = 6
+	ipProtoUDP    = 17
+	// ipProtoUnknown is returned by parseIPFrame when the chain of the IPv6 extension headers cannot be parsed,
+	// or the packet is a non-first IPv6 fragment
+	ipProtoUnknown = -1
+
+	ipv6HopByHop     = 0
+	ipv6Routing      = 43
+	ipv6Fragment     = 44
+	ipv6AuthHeader   = 51
+	ipv6DestOptions  = 60
+	ipv6NoNextHeader = 59
+)
+
+type egressRule struct {
+	prefix netip.Prefix // valid for CIDR rules
+	domain string       // lowercase, without the trailing dot and the "*." prefix
+	suffix bool         // true if the domain was prefixed with "*."
+	ports  []int
+}
+
+func newEgressRule(r limayaml.EgressRule) (egressRule, error) {
+	rule := egressRule{ports: r.Ports}
+	if r.CIDR != "" {
+		prefix, err := netip.ParsePrefix(r.CIDR)
+		if err != nil {
+			return rule, err
+		}
+		rule.prefix = prefix.Masked()
+		return rule, nil
+	}
+	rule.domain = strings.TrimSuffix(strings.ToLower(r.Domain), ".")
+	if d, ok := strings.CutPrefix(rule.domain, "*."); ok {
+		rule.domain = d
+		rule.suffix = true
+	}
+	return rule, nil
+}
+
+func (r *egressRule) matches(dst netip.Addr, port int, names []string) bool {
+	if len(r.ports) > 0 && !slices.Contains(r.ports, port) {
+		return false
+	}
+	if r.prefix.IsValid() {
+		return r.prefix.Contains(dst)
+	}
+	for _, name := range names {
+		if r.suffix {
+			if strings.HasSuffix(name, "."+r.domain) {
+				return true
+			}
+		} else if name == r.domain {
+			return true
+		}
+	}
+	return false
+}
+
+// egressFilter enforces limayaml.EgressPolicy on the frames sent by the guest.
+//
+// Domain rules are resolved by observing the DNS responses sent to the guest,
+// so an address is associated with a domain only after the guest has looked it up.
+// The associations are never expired, so that long-lived connections survive
+// the expiry of the DNS records.
+type egressFilter struct {
+	// subnets are the IPv4 subnet and the optional IPv6 subnet of the network
+	subnets []netip.Prefix
+	allow   []egressRule
+	deny    []egressRule
+	// portScoped is true if any rule is limited to ports
+	portScoped bool
+	// exempt is the list of the addresses served by the gateway itself, such as MetadataIP
+	exempt []netip.Addr
+
+	mu    sync.RWMutex
+	names map[netip.Addr][]string
+}
+
+func newEgressFilter(policy *limayaml.EgressPolicy, subnet string) (*egressFilter, error) {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return nil, err
+	}
+	f := &egressFilter{
+		subnets: []netip.Prefix{prefix.Masked()},
+		names:   make(map[netip.Addr][]string),
+	}
+	for _, r := range policy.Allow {
+		rule, err := newEgressRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid egress allow rule %+v: %w", r, err)
+		}
+		f.allow = append(f.allow, rule)
+	}
+	for _, r := range policy.Deny {
+		rule, err := newEgressRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid egress deny rule %+v: %w", r, err)
+		}
+		f.deny = append(f.deny, rule)
+	}
+	scoped := func(r egressRule) bool { return len(r.ports) > 0 }
+	f.portScoped = slices.ContainsFunc(f.allow, scoped) || slices.ContainsFunc(f.deny, scoped)
+	return f, nil
+}
+
+// allowed returns true if the guest may send packets to dst:port.
+// Traffic within the subnets (e.g., to the gateway and the DNS server) is always allowed,
+// as well as the IPv6 link-local and multicast traffic (e.g., the neighbor discovery).
+//
+// port is -1 when the port cannot be determined (e.g., non-first fragments); such packets are dropped
+// if any rule is limited to ports, as they could slip past the port-scoped deny rules otherwise.
+func (f *egressFilter) allowed(dst netip.Addr, port int) bool {
+	dst = dst.Unmap()
+	if f.inSubnets(dst) || slices.Contains(f.exempt, dst) || (dst.Is6() && (dst.IsLinkLocalUnicast() || dst.IsMulticast())) {
+		return true
+	}
+	if port < 0 && f.portScoped {
+		return false
+	}
+	f.mu.RLock()
+	names := f.names[dst]
+	f.mu.RUnlock()
+	for i := range f.deny {
+		if f.deny[i].matches(dst, port, names) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for i := range f.allow {
+		if f.allow[i].matches(dst, port, names) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowFrame returns false if the Ethernet frame sent by the guest must be dropped.
+// Non-IP frames (e.g., ARP) are always allowed.
+func (f *egressFilter) allowFrame(frame []byte) bool {
+	dst, proto, transport, ok := parseIPFrame(frame, false)
+	if !ok {
+		return true
+	}
+	port := 0
+	switch {
+	case proto == ipProtoUnknown:
+		port = -1
+	case proto == ipProtoTCP || proto == ipProtoUDP:
+		port = -1
+		if len(transport) >= 4 {
+			port = int(binary.BigEndian.Uint16(transport[2:4]))
+		}
+	}
+	if f.allowed(dst, port) {
+		return true
+	}
+	logrus.Debugf("egressPolicy: dropping a packet to %s (protocol %d, port %d)", dst, proto, port)
+	return false
+}
+
+// observeFrame records the addresses in the DNS responses sent to the guest.
+//
+// Only the responses from the subnets are trusted, so that a DNS server outside
+// cannot vouch for arbitrary addresses. The source port is not checked, as the
+// host resolver listens on a random port that the guest redirects 192.168.5.3:53 to.
+func (f *egressFilter) observeFrame(frame []byte) {
+	src, proto, transport, ok := parseIPFrame(frame, true)
+	if !ok || proto != ipProtoUDP || len(transport) < 8 {
+		return
+	}
+	if !f.inSubnets(src.Unmap()) {
+		return
+	}
+	var msg dns.Msg
+	if err := msg.Unpack(transport[8:]); err != nil || !msg.Response {
+		return
+	}
+	var questions []string
+	for _, q := range msg.Question {
+		questions = append(questions, canonicalName(q.Name))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, rr := range msg.Answer {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		// The question names cover the CNAME chains
+		for _, name := range append([]string{canonicalName(rr.Header().Name)}, questions...) {
+			if !slices.Contains(f.names[addr], name) {
+				f.names[addr] = append(f.names[addr], name)
+			}
+		}
+	}
+}
+
+func (f *egressFilter) inSubnets(addr netip.Addr) bool {
+	return slices.ContainsFunc(f.subnets, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+func canonicalName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// parseIPFrame returns the destination (or the source, if src is true) address, the transport protocol,
+// and the transport payload of an IPv4 or IPv6 Ethernet frame.
+// The transport payload is nil for the non-first fragments, as it does not begin with the transport header.
+// The IPv6 extension headers are skipped; ipProtoUnknown is returned when they are truncated,
+// and for the non-first IPv6 fragments, whose upper-layer protocol is unknown.
+func parseIPFrame(frame []byte, src bool) (addr netip.Addr, proto int, transport []byte, ok bool) {
+	if len(frame) < 14 {
+		return addr, 0, nil, false
+	}
+	pkt := frame[14:]
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case etherTypeIPv4:
+		if len(pkt) < 20 {
+			return addr, 0, nil, false
+		}
+		ihl := int(pkt[0]&0x0f) * 4
+		if ihl < 20 || len(pkt) < ihl {
+			return addr, 0, nil, false
+		}
+		off := 16
+		if src {
+			off = 12
+		}
+		addr = netip.AddrFrom4([4]byte(pkt[off : off+4]))
+		if binary.BigEndian.Uint16(pkt[6:8])&0x1fff != 0 {
+			return addr, int(pkt[9]), nil, true
+		}
+		return addr, int(pkt[9]), pkt[ihl:], true
+	case etherTypeIPv6:
+		if len(pkt) < 40 {
+			return addr, 0, nil, false
+		}
+		off := 24
+		if src {
+			off = 8
+		}
+		addr = netip.AddrFrom16([16]byte(pkt[off : off+16]))
+		proto, transport := skipIPv6ExtensionHeaders(int(pkt[6]), pkt[40:])
+		return addr, proto, transport, true
+	}
+	return addr, 0, nil, false
+}
+
+// skipIPv6ExtensionHeaders returns the upper-layer protocol and its payload,
+// following the chain of the IPv6 extension headers that begins with next.
+func skipIPv6ExtensionHeaders(next int, payload []byte) (int, []byte) {
+	for {
+		var hdrLen int
+		switch next {
+		case ipv6HopByHop, ipv6Routing, ipv6DestOptions:
+			if len(payload) < 2 {
+				return ipProtoUnknown, nil
+			}
+			hdrLen = (int(payload[1]) + 1) * 8
+		case ipv6Fragment:
+			if len(payload) < 8 {
+				return ipProtoUnknown, nil
+			}
+			if binary.BigEndian.Uint16(payload[2:4])&0xfff8 != 0 {
+				// Non-first fragment, which may not even contain the rest of the extension headers
+				return ipProtoUnknown, nil
+			}
+			hdrLen = 8
+		case ipv6AuthHeader:
+			if len(payload) < 2 {
+				return ipProtoUnknown, nil
+			}
+			hdrLen = (int(payload[1]) + 2) * 4
+		case ipv6NoNextHeader:
+			return next, nil
+		default:
+			return next, payload
+		}
+		if len(payload) < hdrLen {
+			return ipProtoUnknown, nil
+		}
+		next, payload = int(payload[0]), payload[hdrLen:]
+	}
+}
+
+func (f *egressFilter) wrap(conn net.Conn, stream bool) net.Conn {
+	return newFrameConn(conn, stream, f.allowFrame, f.observeFrame)
+}
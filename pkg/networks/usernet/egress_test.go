@@ -0,0 +1,153 @@
+package usernet
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/miekg/dns"
+	"gotest.tools/v3/assert"
+)
+
+// ipv4UDPFrame returns an Ethernet frame carrying an IPv4 UDP datagram.
+func ipv4UDPFrame(src, dst netip.Addr, srcPort, dstPort int, payload []byte) []byte {
+	frame := make([]byte, 14+20+8, 14+20+8+len(payload))
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv4)
+	ip := frame[14:]
+	ip[0] = 0x45
+	ip[9] = ipProtoUDP
+	copy(ip[12:16], src.AsSlice())
+	copy(ip[16:20], dst.AsSlice())
+	udp := ip[20:]
+	binary.BigEndian.PutUint16(udp[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dstPort))
+	return append(frame, payload...)
+}
+
+func TestEgressFilter(t *testing.T) {
+	f, err := newEgressFilter(&limayaml.EgressPolicy{
+		Allow: []limayaml.EgressRule{
+			{Domain: "*.npmjs.org", Ports: []int{443}},
+			{CIDR: "10.0.0.0/8"},
+		},
+		Deny: []limayaml.EgressRule{
+			{CIDR: "10.0.0.1/32"},
+		},
+	}, "192.168.5.0/24")
+	assert.NilError(t, err)
+
+	guest := netip.MustParseAddr("192.168.5.15")
+	gateway := netip.MustParseAddr("192.168.5.2")
+	registry := netip.MustParseAddr("104.16.0.35")
+
+	assert.Assert(t, f.allowFrame(ipv4UDPFrame(guest, gateway, 40000, 53, nil)), "the subnet is always allowed")
+	assert.Assert(t, f.allowFrame(ipv4UDPFrame(guest, netip.MustParseAddr("10.1.2.3"), 40000, 8080, nil)))
+	assert.Assert(t, !f.allowFrame(ipv4UDPFrame(guest, netip.MustParseAddr("10.0.0.1"), 40000, 8080, nil)), "deny takes precedence")
+	assert.Assert(t, !f.allowFrame(ipv4UDPFrame(guest, registry, 40000, 443, nil)), "not resolved yet")
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("registry.npmjs.org.", dns.TypeA)
+	msg.Response = true
+	msg.Answer = []dns.RR{
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "registry.npmjs.org.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET}, Target: "cdn.example.net."},
+		&dns.A{Hdr: dns.RR_Header{Name: "cdn.example.net.", Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.IP(registry.AsSlice())},
+	}
+	b, err := msg.Pack()
+	assert.NilError(t, err)
+	f.observeFrame(ipv4UDPFrame(gateway, guest, 53, 40000, b))
+
+	assert.Assert(t, f.allowFrame(ipv4UDPFrame(guest, registry, 40000, 443, nil)))
+	assert.Assert(t, !f.allowFrame(ipv4UDPFrame(guest, registry, 40000, 80, nil)), "port is not allowed")
+
+	f.subnets = append(f.subnets, netip.MustParsePrefix("fd4c:696d:6100:5::/64"))
+	assert.Assert(t, f.allowed(netip.MustParseAddr("fd4c:696d:6100:5::3"), 53), "the IPv6 subnet is always allowed")
+	assert.Assert(t, f.allowed(netip.MustParseAddr("ff02::2"), 0), "the neighbor discovery is always allowed")
+	assert.Assert(t, f.allowed(netip.MustParseAddr("fe80::5894:efff:fee4:cdd"), 0))
+	assert.Assert(t, !f.allowed(netip.MustParseAddr("2001:db8::1"), 443))
+}
+
+func TestEgressFilterDenyOnly(t *testing.T) {
+	f, err := newEgressFilter(&limayaml.EgressPolicy{
+		Deny: []limayaml.EgressRule{
+			{CIDR: "169.254.169.254/32"},
+		},
+	}, "192.168.5.0/24")
+	assert.NilError(t, err)
+	assert.Assert(t, f.allowed(netip.MustParseAddr("1.1.1.1"), 443))
+	assert.Assert(t, !f.allowed(netip.MustParseAddr("169.254.169.254"), 80))
+}
+
+func TestInternalEgressFilter(t *testing.T) {
+	f, err := newEgressFilter(&internalEgressPolicy, "192.168.107.0/24")
+	assert.NilError(t, err)
+	assert.Assert(t, f.allowed(netip.MustParseAddr("192.168.107.1"), 53))
+	assert.Assert(t, f.allowed(netip.MustParseAddr("192.168.107.3"), 22))
+	assert.Assert(t, f.allowed(netip.MustParseAddr("fe80::1"), 0))
+	assert.Assert(t, !f.allowed(netip.MustParseAddr("192.168.5.2"), 22))
+	assert.Assert(t, !f.allowed(netip.MustParseAddr("2001:db8::1"), 443))
+}
+
+// ipv6UDPFrame returns an Ethernet frame carrying an IPv6 UDP datagram, after the extension headers.
+// Each extension header begins with its own type in place of the next header field, which is filled in.
+func ipv6UDPFrame(src, dst netip.Addr, dstPort int, extHeaders ...[]byte) []byte {
+	frame := make([]byte, 14+40)
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv6)
+	copy(frame[14+8:14+24], src.AsSlice())
+	copy(frame[14+24:14+40], dst.AsSlice())
+	next := 14 + 6
+	for _, h := range extHeaders {
+		frame[next] = h[0]
+		next = len(frame)
+		frame = append(frame, 0)
+		frame = append(frame, h[1:]...)
+	}
+	frame[next] = ipProtoUDP
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dstPort))
+	return append(frame, udp...)
+}
+
+func TestEgressFilterFragments(t *testing.T) {
+	f, err := newEgressFilter(&limayaml.EgressPolicy{
+		Deny: []limayaml.EgressRule{
+			{CIDR: "0.0.0.0/0", Ports: []int{25}},
+			{CIDR: "::/0", Ports: []int{25}},
+		},
+	}, "192.168.5.0/24")
+	assert.NilError(t, err)
+
+	guest4 := netip.MustParseAddr("192.168.5.15")
+	mail4 := netip.MustParseAddr("203.0.113.25")
+	frame := ipv4UDPFrame(guest4, mail4, 40000, 25, nil)
+	assert.Assert(t, !f.allowFrame(frame))
+	// Non-first fragment, whose payload happens to look like port 80
+	frag := ipv4UDPFrame(guest4, mail4, 40000, 80, nil)
+	binary.BigEndian.PutUint16(frag[14+6:14+8], 185)
+	assert.Assert(t, !f.allowFrame(frag), "the port of a non-first fragment is unknown")
+	// First fragment
+	binary.BigEndian.PutUint16(frame[14+6:14+8], 0x2000)
+	assert.Assert(t, !f.allowFrame(frame))
+
+	guest6 := netip.MustParseAddr("2001:db8::15")
+	mail6 := netip.MustParseAddr("2001:db8:1::25")
+	hopByHop := []byte{ipv6HopByHop, 0, 1, 4, 0, 0, 0, 0}
+	firstFragment := []byte{ipv6Fragment, 0, 0, 1, 0, 0, 0, 1}      // offset 0, more fragments
+	nonFirstFragment := []byte{ipv6Fragment, 0, 0, 184, 0, 0, 0, 1} // offset 23
+	assert.Assert(t, !f.allowFrame(ipv6UDPFrame(guest6, mail6, 25)))
+	assert.Assert(t, f.allowFrame(ipv6UDPFrame(guest6, mail6, 443)))
+	assert.Assert(t, !f.allowFrame(ipv6UDPFrame(guest6, mail6, 25, hopByHop)), "the hop-by-hop header is skipped")
+	assert.Assert(t, f.allowFrame(ipv6UDPFrame(guest6, mail6, 443, hopByHop)))
+	assert.Assert(t, !f.allowFrame(ipv6UDPFrame(guest6, mail6, 25, hopByHop, firstFragment)), "the fragment header is skipped")
+	assert.Assert(t, f.allowFrame(ipv6UDPFrame(guest6, mail6, 443, firstFragment)))
+	assert.Assert(t, !f.allowFrame(ipv6UDPFrame(guest6, mail6, 443, nonFirstFragment)), "the port of a non-first fragment is unknown")
+	truncated := ipv6UDPFrame(guest6, mail6, 443, hopByHop)
+	assert.Assert(t, !f.allowFrame(truncated[:14+40+4]), "truncated extension headers cannot be classified")
+
+	g, err := newEgressFilter(&limayaml.EgressPolicy{
+		Deny: []limayaml.EgressRule{{CIDR: "2001:db8:2::/48"}},
+	}, "192.168.5.0/24")
+	assert.NilError(t, err)
+	assert.Assert(t, g.allowFrame(ipv6UDPFrame(guest6, mail6, 443, nonFirstFragment)), "no rule is limited to ports")
+}
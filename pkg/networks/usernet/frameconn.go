@@ -0,0 +1,87 @@
+package usernet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+)
+
+// frameConn filters the Ethernet frames sent by the VM, and observes the frames sent to the VM.
+// For stream connections (the QEMU protocol), each frame is prefixed with its big-endian 32-bit length.
+// Otherwise, each Read and Write carries exactly one frame.
+type frameConn struct {
+	net.Conn
+	stream bool
+	// accept returns false if the frame sent by the VM must not be passed to the switch
+	accept func(frame []byte) bool
+	// observe is called with each frame sent to the VM, when non-nil
+	observe func(frame []byte)
+	reader  *bufio.Reader
+	pending []byte
+	writeMu sync.Mutex
+}
+
+func newFrameConn(conn net.Conn, stream bool, accept func([]byte) bool, observe func([]byte)) *frameConn {
+	return &frameConn{
+		Conn:    conn,
+		stream:  stream,
+		accept:  accept,
+		observe: observe,
+		reader:  bufio.NewReader(conn),
+	}
+}
+
+func (c *frameConn) Read(b []byte) (int, error) {
+	if !c.stream {
+		for {
+			n, err := c.Conn.Read(b)
+			if err != nil || c.accept(b[:n]) {
+				return n, err
+			}
+		}
+	}
+	for len(c.pending) == 0 {
+		var size [4]byte
+		if _, err := io.ReadFull(c.reader, size[:]); err != nil {
+			return 0, err
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(c.reader, frame); err != nil {
+			return 0, err
+		}
+		if c.accept(frame) {
+			c.pending = append(size[:], frame...)
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write is called by the switch with a frame, prefixed with its length for stream connections.
+// The writes are serialized with writeFrame.
+func (c *frameConn) Write(b []byte) (int, error) {
+	if c.observe != nil {
+		frame := b
+		if c.stream && len(frame) >= 4 {
+			frame = frame[4:]
+		}
+		c.observe(frame)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.Write(b)
+}
+
+// writeFrame sends a frame that did not come from the switch to the VM.
+func (c *frameConn) writeFrame(frame []byte) error {
+	b := frame
+	if c.stream {
+		b = binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(frame)), uint32(len(frame)))
+		b = append(b, frame...)
+	}
+	_, err := c.Write(b)
+	return err
+}
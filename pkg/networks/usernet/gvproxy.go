@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/containers/gvisor-tap-vsock/pkg/transport"
 	"github.com/containers/gvisor-tap-vsock/pkg/types"
 	"github.com/containers/gvisor-tap-vsock/pkg/virtualnetwork"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
@@ -28,13 +31,35 @@ type GVisorNetstackOpts struct {
 
 	Subnet string
 
+	// IPv6Subnet is the /64 IPv6 subnet of the network, in addition to the IPv4 Subnet.
+	// IPv6 is disabled when empty.
+	IPv6Subnet string
+
 	Async bool
 
 	DefaultLeases map[string]string
+
+	// SearchDomains are delivered by the DHCP server, in addition to the search domains of the host.
+	SearchDomains []string
+
+	// EgressPolicy restricts the outbound connections of the VMs, when non-nil.
+	EgressPolicy *limayaml.EgressPolicy
+
+	// Metadata is served at MetadataIP, when non-nil.
+	Metadata *Metadata
+
+	// Internal disconnects the network from the outside, including the host, for a "switch" network.
+	// The VMs can only reach each other, and the DHCP and DNS servers of the gateway.
+	Internal bool
 }
 
 var opts *GVisorNetstackOpts
 
+// internalEgressPolicy drops all the packets to the outside of the subnets; see GVisorNetstackOpts.Internal.
+var internalEgressPolicy = limayaml.EgressPolicy{
+	Deny: []limayaml.EgressRule{{CIDR: "0.0.0.0/0"}, {CIDR: "::/0"}},
+}
+
 const gatewayMacAddr = "5a:94:ef:e4:0c:dd"
 
 func StartGVisorNetstack(ctx context.Context, gVisorOpts *GVisorNetstackOpts) error {
@@ -71,15 +96,47 @@ func StartGVisorNetstack(ctx context.Context, gVisorOpts *GVisorNetstackOpts) er
 		DHCPStaticLeases:  leases,
 		Forwards:          map[string]string{},
 		DNS:               []types.Zone{},
-		DNSSearchDomains:  searchDomains(),
+		DNSSearchDomains:  append(slices.Clone(opts.SearchDomains), searchDomains()...),
 		NAT: map[string]string{
 			gatewayIP: "127.0.0.1",
 		},
 		GatewayVirtualIPs: []string{gatewayIP},
 	}
+	if opts.Metadata != nil {
+		config.GatewayVirtualIPs = append(config.GatewayVirtualIPs, MetadataIP)
+	}
+	egressPolicy := opts.EgressPolicy
+	if opts.Internal {
+		config.NAT = map[string]string{}
+		egressPolicy = &internalEgressPolicy
+	}
+
+	var gateway6 *ipv6Gateway
+	if opts.IPv6Subnet != "" {
+		gateway6, err = newIPv6Gateway(opts.IPv6Subnet, ip, opts.MTU)
+		if err != nil {
+			return err
+		}
+		// The DNS server of gateway6 also listens on the DNS IP of the IPv4 subnet
+		config.GatewayVirtualIPs = append(config.GatewayVirtualIPs, gateway6.dnsIP4.String())
+	}
+
+	var filter *egressFilter
+	if egressPolicy != nil {
+		filter, err = newEgressFilter(egressPolicy, ipNet.String())
+		if err != nil {
+			return err
+		}
+		if opts.Metadata != nil {
+			filter.exempt = append(filter.exempt, netip.MustParseAddr(MetadataIP))
+		}
+		if gateway6 != nil {
+			filter.subnets = append(filter.subnets, gateway6.prefix)
+		}
+	}
 
 	groupErrs, ctx := errgroup.WithContext(ctx)
-	err = run(ctx, groupErrs, &config)
+	err = run(ctx, groupErrs, &config, filter, gateway6)
 	if err != nil {
 		return err
 	}
@@ -89,7 +146,7 @@ func StartGVisorNetstack(ctx context.Context, gVisorOpts *GVisorNetstackOpts) er
 	return groupErrs.Wait()
 }
 
-func run(ctx context.Context, g *errgroup.Group, configuration *types.Configuration) error {
+func run(ctx context.Context, g *errgroup.Group, configuration *types.Configuration, filter *egressFilter, gateway6 *ipv6Gateway) error {
 	vn, err := virtualnetwork.New(configuration)
 	if err != nil {
 		return err
@@ -99,16 +156,34 @@ func run(ctx context.Context, g *errgroup.Group, configuration *types.Configurat
 	if err != nil {
 		return err
 	}
-	httpServe(ctx, g, ln, vn.Mux())
+	var mux http.Handler = vn.Mux()
+	if gateway6 != nil {
+		if err := gateway6.run(ctx, g); err != nil {
+			return err
+		}
+		m := http.NewServeMux()
+		m.Handle("/", mux)
+		m.Handle("/services/dns/add", gateway6.dns.mirrorZones(mux))
+		mux = m
+	}
+	httpServe(ctx, g, ln, mux)
+
+	if opts.Metadata != nil {
+		metadataLn, err := vn.Listen("tcp", net.JoinHostPort(MetadataIP, "80"))
+		if err != nil {
+			return fmt.Errorf("failed to listen on the metadata service address: %w", err)
+		}
+		httpServe(ctx, g, metadataLn, opts.Metadata.Handler())
+	}
 
 	if opts.QemuSocket != "" {
-		err = listenQEMU(ctx, vn)
+		err = listenQEMU(ctx, vn, filter, gateway6)
 		if err != nil {
 			return err
 		}
 	}
 	if opts.FdSocket != "" {
-		err = listenFD(ctx, vn)
+		err = listenFD(ctx, vn, filter, gateway6)
 		if err != nil {
 			return err
 		}
@@ -116,7 +191,7 @@ func run(ctx context.Context, g *errgroup.Group, configuration *types.Configurat
 	return nil
 }
 
-func listenQEMU(ctx context.Context, vn *virtualnetwork.VirtualNetwork) error {
+func listenQEMU(ctx context.Context, vn *virtualnetwork.VirtualNetwork, filter *egressFilter, gateway6 *ipv6Gateway) error {
 	listener, err := net.Listen("unix", opts.QemuSocket)
 	if err != nil {
 		return err
@@ -130,6 +205,12 @@ func listenQEMU(ctx context.Context, vn *virtualnetwork.VirtualNetwork) error {
 				logrus.Error("QEMU accept failed", err)
 			}
 
+			if filter != nil {
+				conn = filter.wrap(conn, true)
+			}
+			if gateway6 != nil {
+				conn = gateway6.wrap(conn, true)
+			}
 			go func() {
 				err = vn.AcceptQemu(ctx, conn)
 				if err != nil {
@@ -149,7 +230,7 @@ func listenQEMU(ctx context.Context, vn *virtualnetwork.VirtualNetwork) error {
 	return nil
 }
 
-func listenFD(ctx context.Context, vn *virtualnetwork.VirtualNetwork) error {
+func listenFD(ctx context.Context, vn *virtualnetwork.VirtualNetwork, filter *egressFilter, gateway6 *ipv6Gateway) error {
 	listener, err := net.Listen("unix", opts.FdSocket)
 	if err != nil {
 		return err
@@ -177,12 +258,19 @@ func listenFD(ctx context.Context, vn *virtualnetwork.VirtualNetwork) error {
 			}
 			files[0].Close()
 
+			var bessConn net.Conn = &UDPFileConn{Conn: fileConn}
+			if filter != nil {
+				bessConn = filter.wrap(bessConn, false)
+			}
+			if gateway6 != nil {
+				bessConn = gateway6.wrap(bessConn, false)
+			}
 			go func() {
-				err = vn.AcceptBess(ctx, &UDPFileConn{Conn: fileConn})
+				err = vn.AcceptBess(ctx, bessConn)
 				if err != nil {
 					logrus.Error("FD connection closed with error", err)
 				}
-				fileConn.Close()
+				bessConn.Close()
 			}()
 			select {
 			case <-ctx.Done():
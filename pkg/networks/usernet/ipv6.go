@@ -0,0 +1,569 @@
+package usernet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/services/forwarder"
+	"github.com/containers/gvisor-tap-vsock/pkg/tcpproxy"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	ipProtoICMPv6 = 58
+
+	icmpv6RouterSolicit   = 133
+	icmpv6RouterAdvert    = 134
+	icmpv6NeighborSolicit = 135
+	icmpv6NeighborAdvert  = 136
+
+	ndpOptSourceLinkAddr = 1
+	ndpOptTargetLinkAddr = 2
+	ndpOptPrefixInfo     = 3
+	ndpOptMTU            = 5
+	ndpOptRDNSS          = 25
+
+	// raInterval is the interval of the unsolicited router advertisements.
+	// The lifetimes in the advertisements are a few times longer.
+	raInterval = 10 * time.Minute
+	raLifetime = 30 * time.Minute
+
+	ipv6NICID = 1
+)
+
+// ipv6Gateway adds IPv6 to a usernet network, as gvisor-tap-vsock only supports IPv4.
+//
+// The gateway sends router advertisements for SLAAC, with the DNS server as RDNSS (RFC 8106),
+// and forwards the TCP and UDP connections of the VMs to the host, translating the gateway address to ::1.
+// It also serves an IPv6-aware DNS server on DNSIP of both the IPv6 and the IPv4 subnets.
+//
+// The frames for the gateway are diverted from the switch of gvisor-tap-vsock to a separate gvisor netstack.
+// The unicast IPv6 frames between the VMs still go through the switch, but the multicast ones
+// (e.g., neighbor solicitations) are flooded by the gateway, as the switch drops them.
+type ipv6Gateway struct {
+	prefix     netip.Prefix
+	gatewayMAC net.HardwareAddr
+	linkLocal  netip.Addr
+	gatewayIP  netip.Addr
+	dnsIP      netip.Addr
+	dnsIP4     netip.Addr
+	mtu        int
+	stack      *stack.Stack
+	ep         *channel.Endpoint
+	dns        *dnsHandler
+
+	mu        sync.Mutex
+	conns     map[*frameConn]struct{}
+	neighbors map[netip.Addr]neighbor
+}
+
+type neighbor struct {
+	mac  [6]byte
+	conn *frameConn
+}
+
+// newIPv6Gateway creates the gateway for the IPv6 subnet, which must be a /64 prefix for SLAAC.
+// subnet4 is the IPv4 subnet of gvisor-tap-vsock.
+func newIPv6Gateway(subnet6 string, subnet4 net.IP, mtu int) (*ipv6Gateway, error) {
+	prefix, err := netip.ParsePrefix(subnet6)
+	if err != nil {
+		return nil, err
+	}
+	if !prefix.Addr().Is6() || prefix.Addr().Is4In6() || prefix.Bits() != 64 {
+		return nil, fmt.Errorf("IPv6 subnet %q must be a /64 prefix", subnet6)
+	}
+	prefix = prefix.Masked()
+	gatewayMAC, err := net.ParseMAC(gatewayMacAddr)
+	if err != nil {
+		return nil, err
+	}
+	subnet6IP := net.IP(prefix.Addr().AsSlice())
+	g := &ipv6Gateway{
+		prefix:     prefix,
+		gatewayMAC: gatewayMAC,
+		linkLocal:  linkLocalAddr(gatewayMAC),
+		gatewayIP:  netip.MustParseAddr(GatewayIP(subnet6IP)),
+		dnsIP:      netip.MustParseAddr(DNSIP(subnet6IP)),
+		dnsIP4:     netip.MustParseAddr(DNSIP(subnet4.To4())),
+		mtu:        mtu,
+		conns:      make(map[*frameConn]struct{}),
+		neighbors:  make(map[netip.Addr]neighbor),
+	}
+	if g.dns, err = newDNSHandler(); err != nil {
+		return nil, err
+	}
+	if err := g.createStack(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *ipv6Gateway) createStack() error {
+	g.stack = stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{
+			ipv4.NewProtocol,
+			ipv6.NewProtocol,
+		},
+		TransportProtocols: []stack.TransportProtocolFactory{
+			tcp.NewProtocol,
+			udp.NewProtocol,
+			icmp.NewProtocol4,
+			icmp.NewProtocol6,
+		},
+	})
+	// The neighbors are resolved by the gateway itself, so the link endpoint carries bare IP packets
+	g.ep = channel.New(512, uint32(g.mtu), tcpip.LinkAddress(g.gatewayMAC))
+	if err := g.stack.CreateNIC(ipv6NICID, g.ep); err != nil {
+		return errors.New(err.String())
+	}
+	for _, addr := range []netip.Addr{g.linkLocal, g.gatewayIP, g.dnsIP, g.dnsIP4} {
+		if err := g.stack.AddProtocolAddress(ipv6NICID, tcpip.ProtocolAddress{
+			Protocol:          protocolNumber(addr),
+			AddressWithPrefix: tcpip.AddrFromSlice(addr.AsSlice()).WithPrefix(),
+		}, stack.AddressProperties{}); err != nil {
+			return errors.New(err.String())
+		}
+	}
+	// Accept the packets for any address, and reply from that address
+	g.stack.SetSpoofing(ipv6NICID, true)
+	g.stack.SetPromiscuousMode(ipv6NICID, true)
+	g.stack.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv6EmptySubnet, NIC: ipv6NICID},
+		{Destination: header.IPv4EmptySubnet, NIC: ipv6NICID},
+	})
+	g.stack.SetTransportProtocolHandler(tcp.ProtocolNumber, tcp.NewForwarder(g.stack, 0, 10, g.forwardTCP).HandlePacket)
+	g.stack.SetTransportProtocolHandler(udp.ProtocolNumber, udp.NewForwarder(g.stack, g.forwardUDP).HandlePacket)
+	return nil
+}
+
+func (g *ipv6Gateway) run(ctx context.Context, eg *errgroup.Group) error {
+	for _, addr := range []netip.Addr{g.dnsIP, g.dnsIP4} {
+		fullAddr := tcpip.FullAddress{NIC: ipv6NICID, Addr: tcpip.AddrFromSlice(addr.AsSlice()), Port: 53}
+		udpConn, err := gonet.DialUDP(g.stack, &fullAddr, nil, protocolNumber(addr))
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s/udp: %w", addr, err)
+		}
+		tcpLn, err := gonet.ListenTCP(g.stack, fullAddr, protocolNumber(addr))
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s/tcp: %w", addr, err)
+		}
+		dnsServe(ctx, eg, &dns.Server{PacketConn: udpConn, Handler: g.dns})
+		dnsServe(ctx, eg, &dns.Server{Listener: tcpLn, Handler: g.dns})
+	}
+	go g.deliver(ctx)
+	go func() {
+		ticker := time.NewTicker(raInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				g.mu.Lock()
+				for conn := range g.conns {
+					g.advertise(conn)
+				}
+				g.mu.Unlock()
+			}
+		}
+	}()
+	return nil
+}
+
+func dnsServe(ctx context.Context, eg *errgroup.Group, srv *dns.Server) {
+	eg.Go(func() error {
+		<-ctx.Done()
+		return srv.Shutdown()
+	})
+	eg.Go(srv.ActivateAndServe)
+}
+
+// wrap diverts the frames for the gateway from the connection of a VM to the switch.
+func (g *ipv6Gateway) wrap(conn net.Conn, stream bool) net.Conn {
+	c := newFrameConn(conn, stream, nil, nil)
+	c.accept = func(frame []byte) bool {
+		return g.accept(c, frame)
+	}
+	g.mu.Lock()
+	g.conns[c] = struct{}{}
+	g.mu.Unlock()
+	// Advertise the prefix without waiting for a router solicitation,
+	// e.g., when the network has been restarted while the VM is running
+	g.advertise(c)
+	return &ipv6Conn{frameConn: c, gateway: g}
+}
+
+type ipv6Conn struct {
+	*frameConn
+	gateway *ipv6Gateway
+}
+
+func (c *ipv6Conn) Close() error {
+	c.gateway.remove(c.frameConn)
+	return c.frameConn.Close()
+}
+
+func (g *ipv6Gateway) remove(conn *frameConn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.conns, conn)
+	for addr, n := range g.neighbors {
+		if n.conn == conn {
+			delete(g.neighbors, addr)
+		}
+	}
+}
+
+// accept handles a frame sent by the VM, and returns false if the frame must not be passed to the switch.
+func (g *ipv6Gateway) accept(conn *frameConn, frame []byte) bool {
+	if len(frame) < 14 {
+		return true
+	}
+	dstMAC, srcMAC := frame[0:6], frame[6:12]
+	pkt := frame[14:]
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case etherTypeIPv6:
+		if len(pkt) < 40 {
+			return false
+		}
+		g.learn(netip.AddrFrom16([16]byte(pkt[8:24])), srcMAC, conn)
+		if pkt[6] == ipProtoICMPv6 && g.handleNDP(conn, srcMAC, pkt) {
+			return false
+		}
+		switch {
+		case dstMAC[0]&1 == 1:
+			g.flood(conn, frame)
+		case bytes.Equal(dstMAC, g.gatewayMAC):
+			g.inject(ipv6.ProtocolNumber, pkt)
+		default:
+			return true
+		}
+		return false
+	case etherTypeIPv4:
+		if !bytes.Equal(dstMAC, g.gatewayMAC) || len(pkt) < 20 || netip.AddrFrom4([4]byte(pkt[16:20])) != g.dnsIP4 {
+			return true
+		}
+		g.learn(netip.AddrFrom4([4]byte(pkt[12:16])), srcMAC, conn)
+		g.inject(ipv4.ProtocolNumber, pkt)
+		return false
+	}
+	return true
+}
+
+// handleNDP answers the router solicitations, and the neighbor solicitations for the addresses of the gateway.
+// Returns false if the packet has to be handled as usual.
+func (g *ipv6Gateway) handleNDP(conn *frameConn, srcMAC []byte, pkt []byte) bool {
+	msg := pkt[40:]
+	if len(msg) < 4 {
+		return false
+	}
+	switch msg[0] {
+	case icmpv6RouterSolicit:
+		g.advertise(conn)
+		return true
+	case icmpv6NeighborSolicit:
+		if len(msg) < 24 {
+			return true
+		}
+		target := netip.AddrFrom16([16]byte(msg[8:24]))
+		if target != g.linkLocal && target != g.gatewayIP && target != g.dnsIP {
+			return false
+		}
+		src := netip.AddrFrom16([16]byte(pkt[8:24]))
+		if src.IsUnspecified() {
+			// Duplicate address detection of an address of the gateway by a VM
+			return true
+		}
+		frame := ethernetFrame(srcMAC, g.gatewayMAC, etherTypeIPv6, icmpv6Packet(target, src, g.neighborAdvert(target)))
+		if err := conn.writeFrame(frame); err != nil {
+			logrus.WithError(err).Debug("failed to send a neighbor advertisement")
+		}
+		return true
+	}
+	return false
+}
+
+// advertise sends a router advertisement to all the nodes of the connection.
+func (g *ipv6Gateway) advertise(conn *frameConn) {
+	allNodes := netip.IPv6LinkLocalAllNodes()
+	frame := ethernetFrame(multicastMAC(allNodes), g.gatewayMAC, etherTypeIPv6, icmpv6Packet(g.linkLocal, allNodes, g.routerAdvert()))
+	if err := conn.writeFrame(frame); err != nil {
+		logrus.WithError(err).Debug("failed to send a router advertisement")
+	}
+}
+
+func (g *ipv6Gateway) routerAdvert() []byte {
+	// type, code, checksum, cur hop limit, flags (no DHCPv6), router lifetime, reachable time, retrans timer
+	msg := []byte{icmpv6RouterAdvert, 0, 0, 0, 64, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(msg[6:8], uint16(raLifetime/time.Second))
+
+	msg = append(msg, ndpOptSourceLinkAddr, 1)
+	msg = append(msg, g.gatewayMAC...)
+
+	msg = append(msg, ndpOptMTU, 1, 0, 0)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(g.mtu))
+
+	// on-link, autonomous address-configuration
+	msg = append(msg, ndpOptPrefixInfo, 4, byte(g.prefix.Bits()), 0xc0)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(raLifetime/time.Second))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(raLifetime/time.Second))
+	msg = append(msg, 0, 0, 0, 0)
+	msg = append(msg, g.prefix.Addr().AsSlice()...)
+
+	msg = append(msg, ndpOptRDNSS, 3, 0, 0)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(raLifetime/time.Second))
+	msg = append(msg, g.dnsIP.AsSlice()...)
+	return msg
+}
+
+func (g *ipv6Gateway) neighborAdvert(target netip.Addr) []byte {
+	// type, code, checksum, flags (router, solicited, override), reserved
+	msg := []byte{icmpv6NeighborAdvert, 0, 0, 0, 0xe0, 0, 0, 0}
+	msg = append(msg, target.AsSlice()...)
+	msg = append(msg, ndpOptTargetLinkAddr, 1)
+	return append(msg, g.gatewayMAC...)
+}
+
+func (g *ipv6Gateway) learn(addr netip.Addr, mac []byte, conn *frameConn) {
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsMulticast() {
+		return
+	}
+	n := neighbor{mac: [6]byte(mac), conn: conn}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.conns[conn]; ok && g.neighbors[addr] != n {
+		g.neighbors[addr] = n
+	}
+}
+
+// flood sends the multicast frame from a VM to the other VMs.
+func (g *ipv6Gateway) flood(from *frameConn, frame []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for conn := range g.conns {
+		if conn == from {
+			continue
+		}
+		if err := conn.writeFrame(frame); err != nil {
+			logrus.WithError(err).Debug("failed to flood a multicast frame")
+		}
+	}
+}
+
+func (g *ipv6Gateway) inject(proto tcpip.NetworkProtocolNumber, pkt []byte) {
+	p := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(pkt),
+	})
+	g.ep.InjectInbound(proto, p)
+	p.DecRef()
+}
+
+// deliver sends the packets of the netstack to the VMs.
+func (g *ipv6Gateway) deliver(ctx context.Context) {
+	for {
+		p := g.ep.ReadContext(ctx)
+		if p == nil {
+			return
+		}
+		v := p.ToView()
+		p.DecRef()
+		g.output(v.AsSlice())
+		v.Release()
+	}
+}
+
+func (g *ipv6Gateway) output(pkt []byte) {
+	var (
+		dst       netip.Addr
+		etherType uint16
+	)
+	switch {
+	case len(pkt) >= 40 && pkt[0]>>4 == 6:
+		dst, etherType = netip.AddrFrom16([16]byte(pkt[24:40])), etherTypeIPv6
+	case len(pkt) >= 20 && pkt[0]>>4 == 4:
+		dst, etherType = netip.AddrFrom4([4]byte(pkt[16:20])), etherTypeIPv4
+	default:
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if dst.IsMulticast() {
+		frame := ethernetFrame(multicastMAC(dst), g.gatewayMAC, etherType, pkt)
+		for conn := range g.conns {
+			_ = conn.writeFrame(frame)
+		}
+		return
+	}
+	n, ok := g.neighbors[dst]
+	if !ok {
+		logrus.Debugf("usernet: dropping a packet to an unknown neighbor %s", dst)
+		return
+	}
+	if err := n.conn.writeFrame(ethernetFrame(n.mac[:], g.gatewayMAC, etherType, pkt)); err != nil {
+		logrus.WithError(err).Debugf("usernet: failed to send a packet to %s", dst)
+	}
+}
+
+// remoteAddr returns the host address to forward the connections to dst.
+// The gateway address is translated to ::1, and the other addresses in the subnet are not forwarded.
+func (g *ipv6Gateway) remoteAddr(dst tcpip.Address) (string, bool) {
+	addr, ok := netip.AddrFromSlice(dst.AsSlice())
+	switch {
+	case !ok:
+		return "", false
+	case addr == g.gatewayIP:
+		return "::1", true
+	case !addr.Is6() || addr.Is4In6() || !addr.IsGlobalUnicast() || g.prefix.Contains(addr):
+		return "", false
+	}
+	return addr.String(), true
+}
+
+func (g *ipv6Gateway) forwardTCP(r *tcp.ForwarderRequest) {
+	id := r.ID()
+	remote, ok := g.remoteAddr(id.LocalAddress)
+	if !ok {
+		r.Complete(true)
+		return
+	}
+	outbound, err := net.Dial("tcp", net.JoinHostPort(remote, strconv.Itoa(int(id.LocalPort))))
+	if err != nil {
+		logrus.WithError(err).Tracef("usernet: failed to forward a TCP connection to [%s]:%d", remote, id.LocalPort)
+		r.Complete(true)
+		return
+	}
+	var wq waiter.Queue
+	ep, tcpErr := r.CreateEndpoint(&wq)
+	r.Complete(false)
+	if tcpErr != nil {
+		outbound.Close()
+		logrus.Debugf("usernet: failed to create a TCP endpoint: %v", tcpErr)
+		return
+	}
+	proxy := tcpproxy.DialProxy{
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			return outbound, nil
+		},
+	}
+	proxy.HandleConn(gonet.NewTCPConn(&wq, ep))
+}
+
+func (g *ipv6Gateway) forwardUDP(r *udp.ForwarderRequest) {
+	id := r.ID()
+	remote, ok := g.remoteAddr(id.LocalAddress)
+	if !ok {
+		return
+	}
+	var wq waiter.Queue
+	ep, tcpErr := r.CreateEndpoint(&wq)
+	if tcpErr != nil {
+		logrus.Debugf("usernet: failed to create a UDP endpoint: %v", tcpErr)
+		return
+	}
+	remoteAddr := net.JoinHostPort(remote, strconv.Itoa(int(id.LocalPort)))
+	proxy, _ := forwarder.NewUDPProxy(&idleUDPConn{UDPConn: gonet.NewUDPConn(&wq, ep)}, func() (net.Conn, error) {
+		return net.Dial("udp", remoteAddr)
+	})
+	go func() {
+		proxy.Run()
+		ep.Close()
+	}()
+}
+
+// idleUDPConn stops the UDP proxy after forwarder.UDPConnTrackTimeout of inactivity.
+type idleUDPConn struct {
+	*gonet.UDPConn
+}
+
+func (c *idleUDPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	_ = c.SetReadDeadline(time.Now().Add(forwarder.UDPConnTrackTimeout))
+	return c.UDPConn.ReadFrom(b)
+}
+
+func protocolNumber(addr netip.Addr) tcpip.NetworkProtocolNumber {
+	if addr.Is4() {
+		return ipv4.ProtocolNumber
+	}
+	return ipv6.ProtocolNumber
+}
+
+// linkLocalAddr returns the modified EUI-64 link-local address of the MAC address.
+func linkLocalAddr(mac net.HardwareAddr) netip.Addr {
+	a := [16]byte{0: 0xfe, 1: 0x80}
+	copy(a[8:11], mac[0:3])
+	a[8] ^= 0x02
+	a[11], a[12] = 0xff, 0xfe
+	copy(a[13:16], mac[3:6])
+	return netip.AddrFrom16(a)
+}
+
+// multicastMAC returns the Ethernet address of the IPv6 multicast address (RFC 2464).
+// IPv4 multicast is not used by the gateway.
+func multicastMAC(addr netip.Addr) []byte {
+	a := addr.As16()
+	return []byte{0x33, 0x33, a[12], a[13], a[14], a[15]}
+}
+
+func ethernetFrame(dst, src []byte, etherType uint16, payload []byte) []byte {
+	frame := make([]byte, 14, 14+len(payload))
+	copy(frame[0:6], dst)
+	copy(frame[6:12], src)
+	binary.BigEndian.PutUint16(frame[12:14], etherType)
+	return append(frame, payload...)
+}
+
+// icmpv6Packet returns an IPv6 packet carrying the ICMPv6 message, with the checksum filled in.
+func icmpv6Packet(src, dst netip.Addr, msg []byte) []byte {
+	pkt := make([]byte, 40, 40+len(msg))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:6], uint16(len(msg)))
+	pkt[6] = ipProtoICMPv6
+	pkt[7] = 255 // required by NDP
+	copy(pkt[8:24], src.AsSlice())
+	copy(pkt[24:40], dst.AsSlice())
+	pkt = append(pkt, msg...)
+	binary.BigEndian.PutUint16(pkt[42:44], icmpv6Checksum(src, dst, pkt[40:]))
+	return pkt
+}
+
+func icmpv6Checksum(src, dst netip.Addr, msg []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i:]))
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	add(src.AsSlice())
+	add(dst.AsSlice())
+	sum += uint32(len(msg)) + ipProtoICMPv6
+	add(msg)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
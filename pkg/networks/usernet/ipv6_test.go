@@ -0,0 +1,156 @@
+package usernet
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/miekg/dns"
+	"golang.org/x/sync/errgroup"
+	"gotest.tools/v3/assert"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+var guestMAC = []byte{0x52, 0x55, 0x55, 0x12, 0x34, 0x56}
+
+// readFrame reads a frame of the QEMU protocol.
+func readFrame(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+	assert.NilError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	var size [4]byte
+	_, err := io.ReadFull(conn, size[:])
+	assert.NilError(t, err)
+	frame := make([]byte, binary.BigEndian.Uint32(size[:]))
+	_, err = io.ReadFull(conn, frame)
+	assert.NilError(t, err)
+	return frame
+}
+
+func writeFrame(t *testing.T, conn net.Conn, frame []byte) {
+	t.Helper()
+	_, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(frame))), frame...))
+	assert.NilError(t, err)
+}
+
+func ipv6UDPPacket(src, dst netip.Addr, srcPort, dstPort uint16, payload []byte) []byte {
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:2], srcPort)
+	binary.BigEndian.PutUint16(udp[2:4], dstPort)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+	sum := header.PseudoHeaderChecksum(header.UDPProtocolNumber,
+		tcpip.AddrFromSlice(src.AsSlice()), tcpip.AddrFromSlice(dst.AsSlice()), uint16(len(udp)))
+	binary.BigEndian.PutUint16(udp[6:8], ^checksum.Checksum(udp, sum))
+
+	pkt := make([]byte, 40, 40+len(udp))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:6], uint16(len(udp)))
+	pkt[6] = ipProtoUDP
+	pkt[7] = 64
+	copy(pkt[8:24], src.AsSlice())
+	copy(pkt[24:40], dst.AsSlice())
+	return append(pkt, udp...)
+}
+
+func TestIPv6Gateway(t *testing.T) {
+	g, err := newIPv6Gateway("fd4c:696d:6100:5::/64", net.ParseIP("192.168.5.0"), 1500)
+	assert.NilError(t, err)
+	assert.Equal(t, g.gatewayIP.String(), "fd4c:696d:6100:5::2")
+	assert.Equal(t, g.dnsIP.String(), "fd4c:696d:6100:5::3")
+	assert.Equal(t, g.dnsIP4.String(), "192.168.5.3")
+	assert.Equal(t, g.linkLocal.String(), "fe80::5894:efff:fee4:cdd")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	eg, ctx := errgroup.WithContext(ctx)
+	t.Cleanup(func() {
+		cancel()
+		_ = eg.Wait()
+	})
+	assert.NilError(t, g.run(ctx, eg))
+
+	vm, host := net.Pipe()
+	t.Cleanup(func() { _ = vm.Close() })
+	wrapped := make(chan net.Conn)
+	go func() {
+		wrapped <- g.wrap(host, true)
+	}()
+	// The switch of gvisor-tap-vsock reads the frames that are not diverted
+	go func() {
+		_, _ = io.Copy(io.Discard, <-wrapped)
+	}()
+
+	checkRA := func(frame []byte) {
+		t.Helper()
+		assert.DeepEqual(t, frame[0:6], []byte{0x33, 0x33, 0, 0, 0, 1})
+		pkt := frame[14:]
+		src, dst := netip.AddrFrom16([16]byte(pkt[8:24])), netip.AddrFrom16([16]byte(pkt[24:40]))
+		assert.Equal(t, src, g.linkLocal)
+		assert.Equal(t, pkt[7], byte(255))
+		msg := pkt[40:]
+		assert.Equal(t, msg[0], byte(icmpv6RouterAdvert))
+		assert.Equal(t, icmpv6Checksum(src, dst, msg), uint16(0))
+		assert.Assert(t, len(msg) == 16+8+8+32+24)
+		assert.DeepEqual(t, msg[16+8+8+16:16+8+8+32], g.prefix.Addr().AsSlice())
+		assert.DeepEqual(t, msg[len(msg)-16:], g.dnsIP.AsSlice())
+	}
+	checkRA(readFrame(t, vm))
+
+	guestLinkLocal := linkLocalAddr(guestMAC)
+	guest := netip.MustParseAddr("fd4c:696d:6100:5::15")
+	allRouters := netip.MustParseAddr("ff02::2")
+
+	t.Run("router solicitation", func(t *testing.T) {
+		rs := []byte{icmpv6RouterSolicit, 0, 0, 0, 0, 0, 0, 0}
+		writeFrame(t, vm, ethernetFrame(multicastMAC(allRouters), guestMAC, etherTypeIPv6, icmpv6Packet(guestLinkLocal, allRouters, rs)))
+		checkRA(readFrame(t, vm))
+	})
+
+	t.Run("neighbor solicitation", func(t *testing.T) {
+		ns := []byte{icmpv6NeighborSolicit, 0, 0, 0, 0, 0, 0, 0}
+		ns = append(ns, g.gatewayIP.AsSlice()...)
+		writeFrame(t, vm, ethernetFrame(g.gatewayMAC, guestMAC, etherTypeIPv6, icmpv6Packet(guest, g.gatewayIP, ns)))
+		frame := readFrame(t, vm)
+		assert.DeepEqual(t, frame[0:6], guestMAC)
+		msg := frame[14+40:]
+		assert.Equal(t, msg[0], byte(icmpv6NeighborAdvert))
+		assert.DeepEqual(t, msg[8:24], g.gatewayIP.AsSlice())
+		assert.DeepEqual(t, msg[26:32], []byte(g.gatewayMAC))
+	})
+
+	t.Run("dns", func(t *testing.T) {
+		g.dns.addZone(types.Zone{
+			Name:    "internal.",
+			Records: []types.Record{{Name: "host.lima", IP: net.ParseIP("192.168.5.2")}},
+		})
+		query := new(dns.Msg)
+		query.SetQuestion("host.lima.internal.", dns.TypeA)
+		b, err := query.Pack()
+		assert.NilError(t, err)
+		writeFrame(t, vm, ethernetFrame(g.gatewayMAC, guestMAC, etherTypeIPv6, ipv6UDPPacket(guest, g.dnsIP, 40000, 53, b)))
+
+		frame := readFrame(t, vm)
+		assert.DeepEqual(t, frame[0:6], guestMAC)
+		pkt := frame[14:]
+		assert.Equal(t, pkt[6], byte(ipProtoUDP))
+		assert.DeepEqual(t, pkt[24:40], guest.AsSlice())
+		var reply dns.Msg
+		assert.NilError(t, reply.Unpack(pkt[40+8:]))
+		assert.Equal(t, reply.Id, query.Id)
+		assert.Equal(t, len(reply.Answer), 1)
+		assert.Equal(t, reply.Answer[0].(*dns.A).A.String(), "192.168.5.2")
+	})
+}
+
+func TestIPv6GatewayInvalidSubnet(t *testing.T) {
+	_, err := newIPv6Gateway("fd4c:696d:6100:5::/48", net.ParseIP("192.168.5.0"), 1500)
+	assert.ErrorContains(t, err, "must be a /64 prefix")
+	_, err = newIPv6Gateway("192.168.6.0/24", net.ParseIP("192.168.5.0"), 1500)
+	assert.ErrorContains(t, err, "must be a /64 prefix")
+}
@@ -0,0 +1,150 @@
+package usernet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/iso9660util"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// MetadataIP is the link-local address of the metadata service.
+const MetadataIP = "169.254.169.254"
+
+// Metadata serves the cloud-init data of an instance at http://169.254.169.254/ .
+//
+// The following paths are served:
+//   - NoCloud-net datasource: /meta-data, /user-data, /vendor-data, /network-config
+//   - Ec2 datasource: /{version}/meta-data/{key}, /{version}/user-data ("latest" is a version too)
+//   - /lima/param.env: the current `param` of the instance, for observing `limactl edit --param` without a reboot
+type Metadata struct {
+	// ReadCIData reads a file in the cidata, e.g., "user-data".
+	ReadCIData func(name string) ([]byte, error)
+	// Param returns the current `param` of the instance.
+	Param func() (map[string]string, error)
+}
+
+// NewMetadata returns the Metadata of the instance in instDir.
+// The cidata.iso and lima.yaml files are read on every request, so that their updates are served immediately.
+func NewMetadata(instDir string) *Metadata {
+	return &Metadata{
+		ReadCIData: func(name string) ([]byte, error) {
+			return iso9660util.ReadFile(filepath.Join(instDir, filenames.CIDataISO), name)
+		},
+		Param: func() (map[string]string, error) {
+			y, err := store.LoadYAMLByFilePath(filepath.Join(instDir, filenames.LimaYAML))
+			if err != nil {
+				return nil, err
+			}
+			return y.Param, nil
+		},
+	}
+}
+
+// Handler returns the HTTP handler of the metadata service.
+func (m *Metadata) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, name := range []string{"meta-data", "user-data", "network-config"} {
+		mux.HandleFunc("GET /"+name, m.serveCIData(name))
+	}
+	mux.HandleFunc("GET /vendor-data", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("GET /{version}/user-data", m.serveCIData("user-data"))
+	mux.HandleFunc("GET /{version}/meta-data/", m.serveEc2MetaData)
+	mux.HandleFunc("GET /{version}/meta-data/{key}", m.serveEc2MetaData)
+	mux.HandleFunc("GET /lima/param.env", m.serveParamEnv)
+	return mux
+}
+
+func (m *Metadata) serveCIData(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		b, err := m.ReadCIData(name)
+		if err != nil {
+			metadataError(w, err)
+			return
+		}
+		_, _ = w.Write(b)
+	}
+}
+
+// serveEc2MetaData serves the keys of the meta-data file in the Ec2 layout.
+// "hostname" is an alias of "local-hostname".
+func (m *Metadata) serveEc2MetaData(w http.ResponseWriter, r *http.Request) {
+	b, err := m.ReadCIData("meta-data")
+	if err != nil {
+		metadataError(w, err)
+		return
+	}
+	metaData := parseMetaData(b)
+	if hostname, ok := metaData["local-hostname"]; ok {
+		metaData["hostname"] = hostname
+	}
+	key := r.PathValue("key")
+	if key == "" {
+		keys := make([]string, 0, len(metaData))
+		for k := range metaData {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(w, strings.Join(keys, "\n"))
+		return
+	}
+	v, ok := metaData[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprint(w, v)
+}
+
+func (m *Metadata) serveParamEnv(w http.ResponseWriter, _ *http.Request) {
+	param, err := m.Param()
+	if err != nil {
+		metadataError(w, err)
+		return
+	}
+	_, _ = w.Write(paramEnv(param))
+}
+
+func metadataError(w http.ResponseWriter, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	logrus.WithError(err).Warn("metadata service: failed to serve a request")
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// parseMetaData parses the flat "key: value" lines of the meta-data file.
+func parseMetaData(b []byte) map[string]string {
+	res := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		res[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return res
+}
+
+// paramEnv formats param in the same way as the param.env file in the cidata.
+func paramEnv(param map[string]string) []byte {
+	keys := make([]string, 0, len(param))
+	for k := range param {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, "PARAM_%s=%s\n", k, param[k])
+	}
+	return b.Bytes()
+}
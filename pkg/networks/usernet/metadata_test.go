@@ -0,0 +1,67 @@
+package usernet
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMetadataHandler(t *testing.T) {
+	cidata := map[string]string{
+		"meta-data": "instance-id: iid-1\nlocal-hostname: lima-default\n",
+		"user-data": "#cloud-config\n",
+	}
+	m := &Metadata{
+		ReadCIData: func(name string) ([]byte, error) {
+			s, ok := cidata[name]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return []byte(s), nil
+		},
+		Param: func() (map[string]string, error) {
+			return map[string]string{"B": "2", "A": "1"}, nil
+		},
+	}
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	testCases := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/meta-data", http.StatusOK, cidata["meta-data"]},
+		{"/user-data", http.StatusOK, cidata["user-data"]},
+		{"/vendor-data", http.StatusOK, ""},
+		{"/latest/user-data", http.StatusOK, cidata["user-data"]},
+		{"/2009-04-04/meta-data/instance-id", http.StatusOK, "iid-1"},
+		{"/latest/meta-data/hostname", http.StatusOK, "lima-default"},
+		{"/latest/meta-data/", http.StatusOK, "hostname\ninstance-id\nlocal-hostname\n"},
+		{"/latest/meta-data/public-keys", http.StatusNotFound, ""},
+		{"/network-config", http.StatusNotFound, ""},
+		{"/lima/param.env", http.StatusOK, "PARAM_A=1\nPARAM_B=2\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			status, body := get(tc.path)
+			assert.Equal(t, status, tc.status)
+			if tc.status == http.StatusOK {
+				assert.Equal(t, body, tc.body)
+			}
+		})
+	}
+}
@@ -15,13 +15,15 @@ import (
 
 	"github.com/lima-vm/lima/pkg/executil"
 	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/sirupsen/logrus"
 )
 
 // Start starts a instance a usernet network with the given name.
-// The name parameter must point to a valid network configuration name under <LIMA_HOME>/_config/networks.yaml with `mode: user-v2`.
+// The name parameter must point to a valid network configuration name under <LIMA_HOME>/_config/networks.yaml with `mode: user-v2`
+// or `mode: switch`.
 func Start(ctx context.Context, name string) error {
 	logrus.Debugf("Make sure usernet network is started")
 	networksDir, err := dirnames.LimaNetworksDir()
@@ -60,11 +62,25 @@ func Start(ctx context.Context, name string) error {
 			return err
 		}
 
+		subnet6, err := IPv6Subnet(name)
+		if err != nil {
+			return err
+		}
+
 		leases, err := readLeases(name)
 		if err != nil {
 			return err
 		}
 
+		cfg, err := networks.LoadConfig()
+		if err != nil {
+			return err
+		}
+		isSwitch, err := cfg.Switch(name)
+		if err != nil {
+			return err
+		}
+
 		err = lockutil.WithDirLock(usernetDir, func() error {
 			self, err := os.Executable()
 			if err != nil {
@@ -78,9 +94,15 @@ func Start(ctx context.Context, name string) error {
 				"--listen", fdSock,
 				"--subnet", subnet.String(),
 			}
+			if subnet6 != "" {
+				args = append(args, "--ipv6-subnet", subnet6)
+			}
 			if leasesString != "" {
 				args = append(args, "--leases", leasesString)
 			}
+			if isSwitch {
+				args = append(args, "--internal")
+			}
 			cmd := exec.CommandContext(ctx, self, args...)
 			cmd.SysProcAttr = executil.BackgroundSysProcAttr
 
@@ -122,7 +144,8 @@ func Start(ctx context.Context, name string) error {
 }
 
 // Stop stops running instance a usernet network with the given name.
-// The name parameter must point to a valid network configuration name under <LIMA_HOME>/_config/networks.yaml with `mode: user-v2`.
+// The name parameter must point to a valid network configuration name under <LIMA_HOME>/_config/networks.yaml with `mode: user-v2`
+// or `mode: switch`.
 func Stop(ctx context.Context, name string) error {
 	logrus.Debugf("Make sure usernet network is stopped")
 	pidFile, err := PIDFile(name)
@@ -0,0 +1,82 @@
+package networks
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/lima-vm/lima/pkg/networks/wireguard"
+)
+
+// WireGuard returns true if the mode of given network is ModeWireGuard.
+// A "wireguard" network has no NIC on the host; the guest runs the WireGuard interface over its default network.
+func (c *Config) WireGuard(name string) (bool, error) {
+	if nw, ok := c.Networks[name]; ok {
+		return nw.Mode == ModeWireGuard, nil
+	}
+	return false, fmt.Errorf("network %q is not defined", name)
+}
+
+// WireGuardSubnet validates a "wireguard" network, and returns its subnet.
+func (c *Config) WireGuardSubnet(name string) (netip.Prefix, error) {
+	if err := c.Check(name); err != nil {
+		return netip.Prefix{}, err
+	}
+	nw := c.Networks[name]
+	if nw.Mode != ModeWireGuard {
+		return netip.Prefix{}, fmt.Errorf("network %q is not a %q network (mode %q)", name, ModeWireGuard, nw.Mode)
+	}
+	subnet, err := netip.ParsePrefix(nw.Subnet)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("network %q has an invalid subnet: %w", name, err)
+	}
+	if !subnet.Addr().Is4() || subnet.Bits() < 16 {
+		return netip.Prefix{}, fmt.Errorf("subnet %q of network %q must be an IPv4 subnet of /16 or smaller", nw.Subnet, name)
+	}
+	if nw.ListenPort < 0 || nw.ListenPort > 65535 {
+		return netip.Prefix{}, fmt.Errorf("network %q has an invalid listenPort %d", name, nw.ListenPort)
+	}
+	for i := range nw.Peers {
+		if err := nw.Peers[i].Validate(subnet.Masked()); err != nil {
+			return netip.Prefix{}, fmt.Errorf("network %q: %w", name, err)
+		}
+	}
+	return subnet.Masked(), nil
+}
+
+// WireGuardPort returns the UDP port of the instance with the static IP address on a "wireguard" network.
+// The port is forwarded from all the addresses of the host to the same port in the guest.
+func (c *Config) WireGuardPort(name string, ip netip.Addr) (int, error) {
+	subnet, err := c.WireGuardSubnet(name)
+	if err != nil {
+		return 0, err
+	}
+	listenPort := c.Networks[name].ListenPort
+	if listenPort == 0 {
+		listenPort = wireguard.DefaultListenPort
+	}
+	return wireguard.Port(subnet, ip, listenPort)
+}
+
+// wireGuardStaticIPPrefix is StaticIPPrefix of a "wireguard" network.
+// The static IP address is required, as the address of each member of the mesh is configured on the other members.
+func (c *Config) wireGuardStaticIPPrefix(name string, ip netip.Addr) (netip.Prefix, error) {
+	subnet, err := c.WireGuardSubnet(name)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if !subnet.Contains(ip) {
+		return netip.Prefix{}, fmt.Errorf("static IP address %q is not in the subnet %q of network %q", ip, subnet, name)
+	}
+	if ip == subnet.Addr() {
+		return netip.Prefix{}, fmt.Errorf("static IP address %q must not be the network address of %q", ip, subnet)
+	}
+	for _, p := range c.Networks[name].Peers {
+		if p.Address == ip.String() {
+			return netip.Prefix{}, fmt.Errorf("static IP address %q is already used by peer %q of network %q", ip, p.Name, name)
+		}
+	}
+	if _, err := c.WireGuardPort(name, ip); err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(ip, subnet.Bits()), nil
+}
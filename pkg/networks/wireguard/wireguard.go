@@ -0,0 +1,154 @@
+// Package wireguard implements the WireGuard mesh of the "wireguard" networks in networks.yaml,
+// which connects the instances on the same host and on other hosts with a flat private subnet.
+//
+// Each instance runs the WireGuard interface in the guest kernel. The UDP port of the interface is forwarded
+// from all the addresses of the host, so that the peers on the other hosts can reach it.
+package wireguard
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultListenPort is the default `listenPort` of a "wireguard" network.
+	DefaultListenPort = 51820
+	// PersistentKeepalive is the interval in seconds of the keepalive packets, which keep the NAT mappings
+	// of the host and of the user-mode network of the guest alive.
+	PersistentKeepalive = 25
+)
+
+// Peer is a member of the mesh that runs on another host.
+// The entry can be printed on that host with `limactl network wireguard-peer INSTANCE`.
+type Peer struct {
+	Name      string `yaml:"name,omitempty" json:"name,omitempty"` // informational, e.g., "laptop-b/k8s-worker"
+	PublicKey string `yaml:"publicKey" json:"publicKey"`           // base64, as printed by `wg pubkey`
+	Endpoint  string `yaml:"endpoint" json:"endpoint"`             // "HOST:PORT" of the other host
+	Address   string `yaml:"address" json:"address"`               // the address of the peer in the subnet
+}
+
+// Validate validates the peer of a network with the subnet.
+func (p *Peer) Validate(subnet netip.Prefix) error {
+	if _, err := decodeKey(p.PublicKey); err != nil {
+		return fmt.Errorf("invalid public key of peer %q: %w", p.Name, err)
+	}
+	host, port, err := net.SplitHostPort(p.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint of peer %q: %w", p.Name, err)
+	}
+	if host == "" {
+		return fmt.Errorf("endpoint %q of peer %q has no host", p.Endpoint, p.Name)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("endpoint %q of peer %q has an invalid port", p.Endpoint, p.Name)
+	}
+	addr, err := netip.ParseAddr(p.Address)
+	if err != nil {
+		return fmt.Errorf("invalid address of peer %q: %w", p.Name, err)
+	}
+	if !subnet.Contains(addr) {
+		return fmt.Errorf("address %q of peer %q is not in the subnet %q", addr, p.Name, subnet)
+	}
+	return nil
+}
+
+// Port returns the UDP port of the member with the address addr: listenPort plus the host part of the address,
+// e.g., 51830 for 10.99.0.10 in 10.99.0.0/24. The port is the same on the host and in the guest.
+func Port(subnet netip.Prefix, addr netip.Addr, listenPort int) (int, error) {
+	if !subnet.Contains(addr) {
+		return 0, fmt.Errorf("address %q is not in the subnet %q", addr, subnet)
+	}
+	if !addr.Is4() || subnet.Bits() < 16 {
+		return 0, fmt.Errorf("subnet %q must be an IPv4 subnet of /16 or smaller", subnet)
+	}
+	a, base := addr.As4(), subnet.Masked().Addr().As4()
+	port := listenPort + int(binary.BigEndian.Uint32(a[:])-binary.BigEndian.Uint32(base[:]))
+	if port > 65535 {
+		return 0, fmt.Errorf("port %d of address %q exceeds 65535; lower `listenPort` or use a smaller subnet", port, addr)
+	}
+	return port, nil
+}
+
+// GenerateKey generates a private key in the format of `wg genkey`.
+func GenerateKey() (string, error) {
+	var k [32]byte
+	if _, err := rand.Read(k[:]); err != nil {
+		return "", err
+	}
+	// Clamp the scalar as `wg genkey` does
+	k[0] &= 248
+	k[31] = (k[31] & 127) | 64
+	return base64.StdEncoding.EncodeToString(k[:]), nil
+}
+
+// PublicKey returns the public key of the private key, in the format of `wg pubkey`.
+func PublicKey(privateKey string) (string, error) {
+	b, err := decodeKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d bytes", len(b))
+	}
+	return b, nil
+}
+
+// LoadOrGenerateKey loads the private key from the file, or generates it when the file does not exist yet.
+func LoadOrGenerateKey(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		key := strings.TrimSpace(string(b))
+		if _, err := decodeKey(key); err != nil {
+			return "", fmt.Errorf("invalid private key in %q: %w", path, err)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	key, err := GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(key+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Config returns the configuration of an interface in the format of `wg setconf`.
+// The address of the interface is not part of the configuration.
+func Config(privateKey string, listenPort int, peers []Peer) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Interface]\nPrivateKey = %s\nListenPort = %d\n", privateKey, listenPort)
+	for _, p := range peers {
+		sb.WriteString("\n")
+		if p.Name != "" {
+			fmt.Fprintf(&sb, "# %s\n", p.Name)
+		}
+		fmt.Fprintf(&sb, "[Peer]\nPublicKey = %s\nEndpoint = %s\nAllowedIPs = %s/32\nPersistentKeepalive = %d\n",
+			p.PublicKey, p.Endpoint, p.Address, PersistentKeepalive)
+	}
+	return sb.String()
+}
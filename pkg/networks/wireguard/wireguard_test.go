@@ -0,0 +1,94 @@
+package wireguard
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPublicKey(t *testing.T) {
+	// RFC 7748, Section 6.1
+	pub, err := PublicKey("dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=")
+	assert.NilError(t, err)
+	assert.Equal(t, pub, "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=")
+
+	_, err = PublicKey("Zm9v")
+	assert.ErrorContains(t, err, "must be 32 bytes")
+}
+
+func TestLoadOrGenerateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wireguard.key")
+	key, err := LoadOrGenerateKey(path)
+	assert.NilError(t, err)
+	st, err := os.Stat(path)
+	assert.NilError(t, err)
+	assert.Equal(t, st.Mode().Perm(), os.FileMode(0o600))
+
+	loaded, err := LoadOrGenerateKey(path)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded, key)
+	_, err = PublicKey(key)
+	assert.NilError(t, err)
+}
+
+func TestPort(t *testing.T) {
+	subnet := netip.MustParsePrefix("10.99.0.0/24")
+	port, err := Port(subnet, netip.MustParseAddr("10.99.0.10"), DefaultListenPort)
+	assert.NilError(t, err)
+	assert.Equal(t, port, 51830)
+
+	port, err = Port(netip.MustParsePrefix("10.99.0.0/16"), netip.MustParseAddr("10.99.1.2"), 40000)
+	assert.NilError(t, err)
+	assert.Equal(t, port, 40258)
+
+	_, err = Port(subnet, netip.MustParseAddr("10.98.0.10"), DefaultListenPort)
+	assert.ErrorContains(t, err, "is not in the subnet")
+	_, err = Port(netip.MustParsePrefix("10.99.0.0/16"), netip.MustParseAddr("10.99.255.1"), DefaultListenPort)
+	assert.ErrorContains(t, err, "exceeds 65535")
+}
+
+func TestPeerValidate(t *testing.T) {
+	subnet := netip.MustParsePrefix("10.99.0.0/24")
+	peer := Peer{
+		Name:      "b1",
+		PublicKey: "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=",
+		Endpoint:  "192.168.1.20:51841",
+		Address:   "10.99.0.21",
+	}
+	assert.NilError(t, peer.Validate(subnet))
+
+	invalid := peer
+	invalid.Endpoint = "192.168.1.20"
+	assert.ErrorContains(t, invalid.Validate(subnet), "invalid endpoint")
+	invalid = peer
+	invalid.Address = "10.98.0.21"
+	assert.ErrorContains(t, invalid.Validate(subnet), "is not in the subnet")
+	invalid = peer
+	invalid.PublicKey = "foo"
+	assert.ErrorContains(t, invalid.Validate(subnet), "invalid public key")
+}
+
+func TestConfig(t *testing.T) {
+	cfg := Config("dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=", 51830, []Peer{
+		{
+			Name:      "b1",
+			PublicKey: "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=",
+			Endpoint:  "192.168.1.20:51841",
+			Address:   "10.99.0.21",
+		},
+	})
+	assert.Equal(t, cfg, `[Interface]
+PrivateKey = dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=
+ListenPort = 51830
+
+# b1
+[Peer]
+PublicKey = hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=
+Endpoint = 192.168.1.20:51841
+AllowedIPs = 10.99.0.21/32
+PersistentKeepalive = 25
+`)
+}
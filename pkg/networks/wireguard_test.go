@@ -0,0 +1,53 @@
+package networks
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/networks/wireguard"
+	"gotest.tools/v3/assert"
+)
+
+func TestWireGuard(t *testing.T) {
+	cfg := Config{Networks: map[string]Network{
+		"mesh": {
+			Mode:   ModeWireGuard,
+			Subnet: "10.99.0.0/24",
+			Peers: []wireguard.Peer{
+				{
+					Name:      "b1",
+					PublicKey: "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=",
+					Endpoint:  "192.168.1.20:51841",
+					Address:   "10.99.0.21",
+				},
+			},
+		},
+		"wide": {Mode: ModeWireGuard, Subnet: "10.0.0.0/8"},
+		"host": {Mode: ModeHost},
+	}}
+
+	isWireGuard, err := cfg.WireGuard("mesh")
+	assert.NilError(t, err)
+	assert.Assert(t, isWireGuard)
+	isWireGuard, err = cfg.WireGuard("host")
+	assert.NilError(t, err)
+	assert.Assert(t, !isWireGuard)
+
+	prefix, inDHCPRange, err := cfg.StaticIPPrefix("mesh", netip.MustParseAddr("10.99.0.11"))
+	assert.NilError(t, err)
+	assert.Equal(t, prefix.String(), "10.99.0.11/24")
+	assert.Assert(t, !inDHCPRange)
+
+	port, err := cfg.WireGuardPort("mesh", netip.MustParseAddr("10.99.0.11"))
+	assert.NilError(t, err)
+	assert.Equal(t, port, 51831)
+
+	_, _, err = cfg.StaticIPPrefix("mesh", netip.MustParseAddr("10.99.0.21"))
+	assert.ErrorContains(t, err, "already used by peer")
+	_, _, err = cfg.StaticIPPrefix("mesh", netip.MustParseAddr("10.99.1.11"))
+	assert.ErrorContains(t, err, "is not in the subnet")
+	_, _, err = cfg.StaticIPPrefix("wide", netip.MustParseAddr("10.0.0.11"))
+	assert.ErrorContains(t, err, "/16 or smaller")
+	_, err = cfg.WireGuardSubnet("host")
+	assert.ErrorContains(t, err, "is not a \"wireguard\" network")
+}
@@ -0,0 +1,136 @@
+// Package nfsserver serves the host directories over NFSv3 for `mountType: nfs`.
+//
+// The server runs in the host agent, and is exposed to the guest only via the SSH reverse forwards,
+// so it does not need /etc/exports, nfsd, nor root privileges on the host.
+package nfsserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	nfs "github.com/willscott/go-nfs"
+	nfshelper "github.com/willscott/go-nfs/helpers"
+)
+
+// GuestPortBase is the guest TCP port (on 127.0.0.1) of the first mount.
+// The NFS and MOUNT protocols are served on the same port.
+const GuestPortBase = 20490
+
+// GuestPort returns the guest TCP port for the i-th mount.
+func GuestPort(i int) int {
+	return GuestPortBase + i
+}
+
+// handleCacheSize is the number of the file handles remembered by the server.
+// The guest gets ESTALE for the handles evicted from the cache.
+const handleCacheSize = 65536
+
+// Serve serves dir over NFSv3 on l, until ctx is cancelled.
+func Serve(ctx context.Context, l net.Listener, dir string, writable bool) error {
+	fs := &filesystem{
+		Filesystem: osfs.New(dir, osfs.WithBoundOS()),
+		writable:   writable,
+	}
+	handler := nfshelper.NewCachingHandler(nfshelper.NewNullAuthHandler(fs), handleCacheSize)
+	srv := &nfs.Server{Handler: handler, Context: ctx}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	err := srv.Serve(l)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// filesystem adds billy.Change to the osfs.BoundOS filesystem, and optionally makes it read-only.
+type filesystem struct {
+	billy.Filesystem
+	writable bool
+}
+
+var _ billy.Change = (*filesystem)(nil)
+
+// Capabilities implements billy.Capable.
+// go-nfs returns NFS3ERR_ROFS for the write operations when WriteCapability is missing.
+func (fs *filesystem) Capabilities() billy.Capability {
+	if !fs.writable {
+		return billy.ReadCapability | billy.SeekCapability
+	}
+	return billy.Capabilities(fs.Filesystem)
+}
+
+// abs resolves the symlinks in name within the root, as osfs.BoundOS does.
+func (fs *filesystem) abs(name string) (string, error) {
+	return securejoin.SecureJoin(fs.Root(), name)
+}
+
+// absNoFollow is similar to abs but does not resolve the last element of name.
+func (fs *filesystem) absNoFollow(name string) (string, error) {
+	name = filepath.Clean("/" + name)
+	dir, err := fs.abs(filepath.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(name)), nil
+}
+
+func (fs *filesystem) change(name string, follow bool, f func(string) error) error {
+	if !fs.writable {
+		return &os.PathError{Op: "change", Path: name, Err: os.ErrPermission}
+	}
+	abs := fs.abs
+	if !follow {
+		abs = fs.absNoFollow
+	}
+	p, err := abs(name)
+	if err != nil {
+		return err
+	}
+	return f(p)
+}
+
+// Chmod implements billy.Change.
+func (fs *filesystem) Chmod(name string, mode os.FileMode) error {
+	return fs.change(name, true, func(p string) error {
+		return os.Chmod(p, mode)
+	})
+}
+
+// Lchown implements billy.Change.
+func (fs *filesystem) Lchown(name string, uid, gid int) error {
+	return fs.change(name, false, func(p string) error {
+		return ignoreEPERM(os.Lchown(p, uid, gid))
+	})
+}
+
+// Chown implements billy.Change.
+func (fs *filesystem) Chown(name string, uid, gid int) error {
+	return fs.change(name, true, func(p string) error {
+		return ignoreEPERM(os.Chown(p, uid, gid))
+	})
+}
+
+// Chtimes implements billy.Change.
+func (fs *filesystem) Chtimes(name string, atime, mtime time.Time) error {
+	return fs.change(name, true, func(p string) error {
+		return os.Chtimes(p, atime, mtime)
+	})
+}
+
+// ignoreEPERM ignores the failure of chown, as the server is running as a non-root user on the host,
+// and the guest user is usually mapped to the same user.
+func ignoreEPERM(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package nfsserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	nfsc "github.com/willscott/go-nfs-client/nfs"
+	"github.com/willscott/go-nfs-client/nfs/rpc"
+	"gotest.tools/v3/assert"
+)
+
+func mountTest(t *testing.T, dir string, writable bool) *nfsc.Target {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, l, dir, writable)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NilError(t, <-errCh)
+	})
+
+	c, err := rpc.DialTCP("tcp", l.Addr().String(), false)
+	assert.NilError(t, err)
+	t.Cleanup(func() { c.Close() })
+	m := nfsc.Mount{Client: c}
+	target, err := m.Mount("/", rpc.AuthNull)
+	assert.NilError(t, err)
+	return target
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("hello"), 0o644))
+	target := mountTest(t, dir, true)
+
+	f, err := target.Open("/foo")
+	assert.NilError(t, err)
+	b, err := io.ReadAll(f)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+	assert.Equal(t, string(b), "hello")
+
+	_, err = target.Mkdir("/dir", 0o755)
+	assert.NilError(t, err)
+	w, err := target.OpenFile("/dir/bar", 0o644)
+	assert.NilError(t, err)
+	_, err = w.Write([]byte("world"))
+	assert.NilError(t, err)
+	assert.NilError(t, w.Close())
+	b, err = os.ReadFile(filepath.Join(dir, "dir", "bar"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "world")
+
+	assert.NilError(t, target.Remove("/foo"))
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestServeReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("hello"), 0o644))
+	target := mountTest(t, dir, false)
+
+	f, err := target.Open("/foo")
+	assert.NilError(t, err)
+	b, err := io.ReadAll(f)
+	assert.NilError(t, err)
+	// Not calling f.Close(), as it sends COMMIT that fails on the read-only filesystem
+	assert.Equal(t, string(b), "hello")
+
+	_, err = target.Mkdir("/dir", 0o755)
+	assert.Assert(t, err != nil)
+	assert.Assert(t, target.Remove("/foo") != nil)
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	assert.NilError(t, err)
+}
+
+func TestFilesystemAbs(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.Symlink("/etc", filepath.Join(dir, "link")))
+	fs := &filesystem{Filesystem: osfs.New(dir, osfs.WithBoundOS()), writable: true}
+
+	// Symlinks must not escape from the root
+	p, err := fs.abs("link/passwd")
+	assert.NilError(t, err)
+	assert.Equal(t, p, filepath.Join(dir, "etc", "passwd"))
+
+	p, err = fs.absNoFollow("link")
+	assert.NilError(t, err)
+	assert.Equal(t, p, filepath.Join(dir, "link"))
+
+	p, err = fs.absNoFollow("../../link")
+	assert.NilError(t, err)
+	assert.Equal(t, p, filepath.Join(dir, "link"))
+}
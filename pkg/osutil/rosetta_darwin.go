@@ -3,6 +3,8 @@ package osutil
 import (
 	"errors"
 	"fmt"
+	"os/exec"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -23,3 +25,18 @@ func IsBeingRosettaTranslated() bool {
 
 	return ret != 0
 }
+
+// RosettaVersion returns the version of Rosetta installed on the host, like "1.0.0.0.1.1687836402".
+func RosettaVersion() (string, error) {
+	cmd := exec.Command("pkgutil", "--pkg-info", "com.apple.pkg.RosettaUpdateAuto")
+	b, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to execute %v (Rosetta may not be installed): %w", cmd.Args, err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(line, "version: "); ok {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	return "", fmt.Errorf("no version in the output of %v: %q", cmd.Args, string(b))
+}
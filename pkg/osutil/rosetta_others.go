@@ -2,6 +2,13 @@
 
 package osutil
 
+import "errors"
+
 func IsBeingRosettaTranslated() bool {
 	return false
 }
+
+// RosettaVersion returns the version of Rosetta installed on the host.
+func RosettaVersion() (string, error) {
+	return "", errors.New("not implemented")
+}
@@ -40,6 +40,11 @@ var (
 // names to the fallback user as well, so the regex does not allow them.
 var regexUsername = regexp.MustCompile("^[a-z_][a-z0-9_-]*$")
 
+// IsValidUsername returns true if name is valid for `useradd`.
+func IsValidUsername(name string) bool {
+	return regexUsername.MatchString(name)
+}
+
 // regexPath detects valid Linux path.
 var regexPath = regexp.MustCompile("^[/a-zA-Z0-9_-]+$")
 
@@ -0,0 +1,189 @@
+// Package plugin discovers limactl plugins and invokes their JSON contract.
+//
+// A plugin is an executable named "limactl-NAME" (or "limactl-NAME.exe" on Windows) in $PATH.
+// When the same name appears in multiple directories, the first one wins.
+//
+// A plugin may contribute to the standard commands by implementing the following subcommands:
+//
+//   - `limactl-NAME lima-plugin-info` prints a JSON object, shown as `.plugins.NAME` in `limactl info`.
+//   - `limactl-NAME lima-plugin-list INSTANCE...` prints a ListOutput, shown as extra columns in `limactl list --plugins`.
+//
+// Plugins that do not implement a subcommand are expected to exit with a non-zero status.
+// The environment variables LIMA_HOME and LIMACTL are set for the plugin.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Prefix is the prefix of the plugin executable names.
+	Prefix = "limactl-"
+
+	InfoCommand = "lima-plugin-info"
+	ListCommand = "lima-plugin-list"
+
+	// Timeout is the timeout for each invocation of a plugin.
+	Timeout = 5 * time.Second
+)
+
+type Plugin struct {
+	Name string
+	Path string
+}
+
+// ListOutput is the output of `limactl-NAME lima-plugin-list`.
+type ListOutput struct {
+	// Columns is the ordered list of the column names.
+	Columns []string `json:"columns"`
+	// Instances maps instance names to column values.
+	Instances map[string]map[string]string `json:"instances"`
+}
+
+// Discover returns the plugins found in $PATH, sorted by name.
+func Discover() []Plugin {
+	seen := make(map[string]struct{})
+	var plugins []Plugin
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := pluginName(e.Name())
+			if !ok {
+				continue
+			}
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = struct{}{}
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+func pluginName(fileName string) (string, bool) {
+	name, ok := strings.CutPrefix(fileName, Prefix)
+	if !ok {
+		return "", false
+	}
+	if runtime.GOOS == "windows" {
+		name, ok = strings.CutSuffix(name, ".exe")
+		if !ok {
+			return "", false
+		}
+	}
+	return name, name != ""
+}
+
+func isExecutable(path string) bool {
+	st, err := os.Stat(path)
+	if err != nil || st.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || st.Mode()&0o111 != 0
+}
+
+func (p *Plugin) run(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Path, args...)
+	cmd.Env = os.Environ()
+	if limaHome, err := dirnames.LimaDir(); err == nil {
+		cmd.Env = append(cmd.Env, "LIMA_HOME="+limaHome)
+	}
+	if self, err := os.Executable(); err == nil {
+		cmd.Env = append(cmd.Env, "LIMACTL="+self)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	logrus.Debugf("Running plugin %v", cmd.Args)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run %v: %w (stderr=%q)", cmd.Args, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// Info returns the JSON object printed by `limactl-NAME lima-plugin-info`.
+func (p *Plugin) Info(ctx context.Context) (json.RawMessage, error) {
+	out, err := p.run(ctx, InfoCommand)
+	if err != nil {
+		return nil, err
+	}
+	out = bytes.TrimSpace(out)
+	if !json.Valid(out) || !bytes.HasPrefix(out, []byte("{")) {
+		return nil, fmt.Errorf("plugin %q printed an invalid JSON object for %q", p.Name, InfoCommand)
+	}
+	return out, nil
+}
+
+// List returns the output of `limactl-NAME lima-plugin-list INSTANCE...`.
+func (p *Plugin) List(ctx context.Context, instNames []string) (*ListOutput, error) {
+	out, err := p.run(ctx, append([]string{ListCommand}, instNames...)...)
+	if err != nil {
+		return nil, err
+	}
+	var res ListOutput
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("plugin %q printed an invalid output for %q: %w", p.Name, ListCommand, err)
+	}
+	if len(res.Columns) == 0 {
+		return nil, errors.New("no columns")
+	}
+	return &res, nil
+}
+
+// Infos returns the info sections of all the plugins, keyed by the plugin names.
+// The plugins are run in parallel, under the single deadline of Timeout.
+// Plugins that fail are skipped.
+func Infos(ctx context.Context) map[string]json.RawMessage {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	var (
+		res = make(map[string]json.RawMessage)
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+	)
+	for _, p := range Discover() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := p.Info(ctx)
+			if err != nil {
+				logrus.WithError(err).Debugf("Plugin %q does not provide info", p.Name)
+				return
+			}
+			mu.Lock()
+			res[p.Name] = info
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return res
+}
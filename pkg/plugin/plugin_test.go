@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const fooPlugin = `#!/bin/sh
+case "$1" in
+lima-plugin-info)
+	echo '{"status": "ok"}'
+	;;
+lima-plugin-list)
+	shift
+	echo '{"columns": ["K8S"], "instances": {"'"$1"'": {"K8S": "v1.30"}}}'
+	;;
+*)
+	exit 1
+	;;
+esac
+`
+
+func TestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugins are not supported on Windows")
+	}
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir1, "limactl-foo"), []byte(fooPlugin), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir2, "limactl-foo"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir2, "limactl-bar"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir2, "limactl-noexec"), []byte("#!/bin/sh\n"), 0o644))
+	t.Setenv("PATH", dir1+string(os.PathListSeparator)+dir2)
+	t.Setenv("LIMA_HOME", t.TempDir())
+
+	plugins := Discover()
+	assert.DeepEqual(t, plugins, []Plugin{
+		{Name: "bar", Path: filepath.Join(dir2, "limactl-bar")},
+		{Name: "foo", Path: filepath.Join(dir1, "limactl-foo")},
+	})
+
+	ctx := context.Background()
+	infos := Infos(ctx)
+	assert.Equal(t, len(infos), 1)
+	assert.Equal(t, string(infos["foo"]), `{"status": "ok"}`)
+
+	out, err := plugins[1].List(ctx, []string{"default"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, out, &ListOutput{
+		Columns:   []string{"K8S"},
+		Instances: map[string]map[string]string{"default": {"K8S": "v1.30"}},
+	})
+	_, err = plugins[0].List(ctx, []string{"default"})
+	assert.ErrorContains(t, err, "failed to run")
+}
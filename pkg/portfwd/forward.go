@@ -20,12 +20,15 @@ type Forwarder struct {
 	closableListeners *ClosableListeners
 }
 
-func NewPortForwarder(rules []limayaml.PortForward, ignoreTCP, ignoreUDP bool) *Forwarder {
+// NewPortForwarder creates a Forwarder. limits may be nil.
+func NewPortForwarder(rules []limayaml.PortForward, ignoreTCP, ignoreUDP bool, limits *Limits) *Forwarder {
+	closableListeners := NewClosableListener()
+	closableListeners.limits = limits
 	return &Forwarder{
 		rules:             rules,
 		ignoreTCP:         ignoreTCP,
 		ignoreUDP:         ignoreUDP,
-		closableListeners: NewClosableListener(),
+		closableListeners: closableListeners,
 	}
 }
 
@@ -54,6 +57,12 @@ func (fw *Forwarder) OnEvent(ctx context.Context, client *guestagentclient.Guest
 	}
 }
 
+// HostAddress returns the host address that the guest address is forwarded to, or an empty string.
+func (fw *Forwarder) HostAddress(guest *api.IPPort) string {
+	hostAddr, _ := fw.forwardingAddresses(guest)
+	return hostAddr
+}
+
 func (fw *Forwarder) forwardingAddresses(guest *api.IPPort) (hostAddr, guestAddr string) {
 	guestIP := net.ParseIP(guest.Ip)
 	for _, rule := range fw.rules {
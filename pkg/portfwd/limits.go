@@ -0,0 +1,262 @@
+package portfwd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// limitReportInterval is the minimum interval of the events for the same limit and host address.
+const limitReportInterval = time.Minute
+
+// Limits enforces `portForwardLimits`.
+// A nil *Limits imposes no limit.
+type Limits struct {
+	maxForwards           int
+	maxConnectionsPerPort int
+	bandwidth             string
+	// limiter is nil when the bandwidth is unlimited
+	limiter *rate.Limiter
+	onLimit func(events.PortForwardLimit)
+
+	mu       sync.Mutex
+	forwards map[string]struct{}
+	conns    map[string]int
+	// rejected and reported are keyed by the limit and the host address
+	rejected map[string]int
+	reported map[string]time.Time
+}
+
+// NewLimits creates Limits. onLimit is called when a limit has been hit, at most once a minute
+// for each limit and host address.
+func NewLimits(limits limayaml.PortForwardLimits, onLimit func(events.PortForwardLimit)) (*Limits, error) {
+	l := &Limits{
+		onLimit:  onLimit,
+		forwards: make(map[string]struct{}),
+		conns:    make(map[string]int),
+		rejected: make(map[string]int),
+		reported: make(map[string]time.Time),
+	}
+	if limits.MaxForwards != nil {
+		l.maxForwards = *limits.MaxForwards
+	}
+	if limits.MaxConnectionsPerPort != nil {
+		l.maxConnectionsPerPort = *limits.MaxConnectionsPerPort
+	}
+	if limits.Bandwidth != nil {
+		bytesPerSec, err := limayaml.ParseBandwidth(*limits.Bandwidth)
+		if err != nil {
+			return nil, err
+		}
+		if bytesPerSec > 0 {
+			l.bandwidth = *limits.Bandwidth
+			l.limiter = rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))
+		}
+	}
+	return l, nil
+}
+
+// LimitsConnections returns true if the connections are limited by `maxConnectionsPerPort` or `bandwidth`.
+func (l *Limits) LimitsConnections() bool {
+	return l != nil && (l.maxConnectionsPerPort > 0 || l.limiter != nil)
+}
+
+// AcquireForward reserves a forward from hostAddress to guestAddress.
+// It returns false when `maxForwards` forwards are already active.
+// Acquiring the forward that is already active succeeds without reserving another one.
+func (l *Limits) AcquireForward(protocol, hostAddress, guestAddress string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k := key(protocol, hostAddress, guestAddress)
+	if _, ok := l.forwards[k]; ok {
+		return true
+	}
+	if l.maxForwards > 0 && len(l.forwards) >= l.maxForwards {
+		l.rejectLocked(events.LimitMaxForwards, strconv.Itoa(l.maxForwards), "", "")
+		return false
+	}
+	l.forwards[k] = struct{}{}
+	return true
+}
+
+// ReleaseForward releases the forward reserved by AcquireForward, if any.
+func (l *Limits) ReleaseForward(protocol, hostAddress, guestAddress string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.forwards, key(protocol, hostAddress, guestAddress))
+}
+
+// AcquireConnection reserves a connection to the forwarded host address.
+// It returns false when `maxConnectionsPerPort` connections are already active.
+func (l *Limits) AcquireConnection(hostAddress, guestAddress string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxConnectionsPerPort > 0 && l.conns[hostAddress] >= l.maxConnectionsPerPort {
+		l.rejectLocked(events.LimitMaxConnectionsPerPort, strconv.Itoa(l.maxConnectionsPerPort), hostAddress, guestAddress)
+		return false
+	}
+	l.conns[hostAddress]++
+	return true
+}
+
+// ReleaseConnection releases the connection reserved by AcquireConnection.
+func (l *Limits) ReleaseConnection(hostAddress string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[hostAddress] <= 1 {
+		delete(l.conns, hostAddress)
+		return
+	}
+	l.conns[hostAddress]--
+}
+
+// rejectLocked counts the rejection, and reports it unless the same limit has been reported recently.
+func (l *Limits) rejectLocked(limit, value, hostAddress, guestAddress string) {
+	k := limit + "-" + hostAddress
+	l.rejected[k]++
+	if time.Since(l.reported[k]) < limitReportInterval {
+		return
+	}
+	ev := events.PortForwardLimit{
+		Limit:        limit,
+		Value:        value,
+		HostAddress:  hostAddress,
+		GuestAddress: guestAddress,
+		Rejected:     l.rejected[k],
+	}
+	l.reported[k] = time.Now()
+	l.rejected[k] = 0
+	l.report(ev)
+}
+
+func (l *Limits) report(ev events.PortForwardLimit) {
+	if ev.HostAddress != "" {
+		logrus.Warnf("Port forwarding limit %q (%s) has been hit for %s", ev.Limit, ev.Value, ev.HostAddress)
+	} else {
+		logrus.Warnf("Port forwarding limit %q (%s) has been hit", ev.Limit, ev.Value)
+	}
+	if l.onLimit != nil {
+		l.onLimit(ev)
+	}
+}
+
+// Conn wraps the host side of a forwarded connection with the `bandwidth` limit.
+func (l *Limits) Conn(ctx context.Context, conn net.Conn, guestAddress string) net.Conn {
+	if l == nil || l.limiter == nil {
+		return conn
+	}
+	return &limitedConn{Conn: conn, ctx: ctx, limits: l, guestAddress: guestAddress}
+}
+
+// wait blocks until n bytes can be transferred within the `bandwidth` limit.
+func (l *Limits) wait(ctx context.Context, n int, hostAddress, guestAddress string) error {
+	if r := l.limiter.ReserveN(time.Now(), n); r.OK() {
+		delay := r.Delay()
+		if delay == 0 {
+			return nil
+		}
+		l.throttled(hostAddress, guestAddress)
+		select {
+		case <-time.After(delay):
+			return nil
+		case <-ctx.Done():
+			r.Cancel()
+			return ctx.Err()
+		}
+	}
+	// n exceeds the burst
+	return l.limiter.WaitN(ctx, n)
+}
+
+func (l *Limits) throttled(hostAddress, guestAddress string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k := events.LimitBandwidth + "-"
+	if time.Since(l.reported[k]) < limitReportInterval {
+		return
+	}
+	l.reported[k] = time.Now()
+	l.report(events.PortForwardLimit{
+		Limit:        events.LimitBandwidth,
+		Value:        l.bandwidth,
+		HostAddress:  hostAddress,
+		GuestAddress: guestAddress,
+	})
+}
+
+// limitedConn is a net.Conn throttled by the `bandwidth` limit, in both directions.
+type limitedConn struct {
+	net.Conn
+	ctx          context.Context
+	limits       *Limits
+	guestAddress string
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if burst := c.limits.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if waitErr := c.limits.wait(c.ctx, n, c.LocalAddr().String(), c.guestAddress); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	var written int
+	burst := c.limits.limiter.Burst()
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+		if err := c.limits.wait(c.ctx, len(chunk), c.LocalAddr().String(), c.guestAddress); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseRead and CloseWrite are used by bicopy.Bicopy for the half-close.
+
+func (c *limitedConn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return nil
+}
+
+func (c *limitedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package portfwd
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"gotest.tools/v3/assert"
+)
+
+func TestLimits(t *testing.T) {
+	var reported []events.PortForwardLimit
+	l, err := NewLimits(limayaml.PortForwardLimits{
+		MaxForwards:           ptr.Of(2),
+		MaxConnectionsPerPort: ptr.Of(1),
+		Bandwidth:             ptr.Of("0"),
+	}, func(ev events.PortForwardLimit) {
+		reported = append(reported, ev)
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, l.LimitsConnections())
+
+	assert.Assert(t, l.AcquireForward("tcp", "127.0.0.1:8080", "127.0.0.1:8080"))
+	// Acquiring the active forward again does not count
+	assert.Assert(t, l.AcquireForward("tcp", "127.0.0.1:8080", "127.0.0.1:8080"))
+	assert.Assert(t, l.AcquireForward("tcp", "127.0.0.1:8081", "127.0.0.1:8081"))
+	assert.Assert(t, !l.AcquireForward("tcp", "127.0.0.1:8082", "127.0.0.1:8082"))
+	assert.Assert(t, !l.AcquireForward("tcp", "127.0.0.1:8083", "127.0.0.1:8083"))
+	// Reported once a minute
+	assert.DeepEqual(t, reported, []events.PortForwardLimit{{Limit: events.LimitMaxForwards, Value: "2", Rejected: 1}})
+	l.ReleaseForward("tcp", "127.0.0.1:8080", "127.0.0.1:8080")
+	assert.Assert(t, l.AcquireForward("tcp", "127.0.0.1:8082", "127.0.0.1:8082"))
+
+	assert.Assert(t, l.AcquireConnection("127.0.0.1:8081", "127.0.0.1:8081"))
+	assert.Assert(t, !l.AcquireConnection("127.0.0.1:8081", "127.0.0.1:8081"))
+	assert.Assert(t, l.AcquireConnection("127.0.0.1:8082", "127.0.0.1:8082"))
+	l.ReleaseConnection("127.0.0.1:8081")
+	assert.Assert(t, l.AcquireConnection("127.0.0.1:8081", "127.0.0.1:8081"))
+	assert.Equal(t, len(reported), 2)
+	assert.Equal(t, reported[1].Limit, events.LimitMaxConnectionsPerPort)
+	assert.Equal(t, reported[1].HostAddress, "127.0.0.1:8081")
+
+	// nil imposes no limit
+	var unlimited *Limits
+	assert.Assert(t, unlimited.AcquireForward("tcp", "127.0.0.1:8080", "127.0.0.1:8080"))
+	assert.Assert(t, unlimited.AcquireConnection("127.0.0.1:8080", "127.0.0.1:8080"))
+	assert.Assert(t, !unlimited.LimitsConnections())
+}
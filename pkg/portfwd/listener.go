@@ -17,6 +17,8 @@ type ClosableListeners struct {
 	udpListeners   map[string]net.PacketConn
 	listenersRW    sync.Mutex
 	udpListenersRW sync.Mutex
+	// limits may be nil
+	limits *Limits
 }
 
 func NewClosableListener() *ClosableListeners {
@@ -53,6 +55,7 @@ func (p *ClosableListeners) Remove(_ context.Context, protocol, hostAddress, gue
 		if ok {
 			listener.Close()
 			delete(p.listeners, key)
+			p.limits.ReleaseForward("tcp", hostAddress, guestAddress)
 		}
 	case "udp", "udp6":
 		p.udpListenersRW.Lock()
@@ -61,6 +64,7 @@ func (p *ClosableListeners) Remove(_ context.Context, protocol, hostAddress, gue
 		if ok {
 			listener.Close()
 			delete(p.udpListeners, key)
+			p.limits.ReleaseForward("udp", hostAddress, guestAddress)
 		}
 	}
 }
@@ -74,9 +78,14 @@ func (p *ClosableListeners) forwardTCP(ctx context.Context, client *guestagentcl
 		p.listenersRW.Unlock()
 		return
 	}
+	if !p.limits.AcquireForward("tcp", hostAddress, guestAddress) {
+		p.listenersRW.Unlock()
+		return
+	}
 	tcpLis, err := Listen(ctx, p.listenConfig, hostAddress)
 	if err != nil {
 		logrus.Errorf("failed to listen to TCP connection: %v", err)
+		p.limits.ReleaseForward("tcp", hostAddress, guestAddress)
 		p.listenersRW.Unlock()
 		return
 	}
@@ -93,7 +102,14 @@ func (p *ClosableListeners) forwardTCP(ctx context.Context, client *guestagentcl
 			}
 			return
 		}
-		go HandleTCPConnection(ctx, client, conn, guestAddress)
+		if !p.limits.AcquireConnection(hostAddress, guestAddress) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer p.limits.ReleaseConnection(hostAddress)
+			HandleTCPConnection(ctx, client, p.limits.Conn(ctx, conn, guestAddress), guestAddress)
+		}()
 	}
 }
 
@@ -108,9 +124,14 @@ func (p *ClosableListeners) forwardUDP(ctx context.Context, client *guestagentcl
 		return
 	}
 
+	if !p.limits.AcquireForward("udp", hostAddress, guestAddress) {
+		p.udpListenersRW.Unlock()
+		return
+	}
 	udpConn, err := ListenPacket(ctx, p.listenConfig, hostAddress)
 	if err != nil {
 		logrus.Errorf("failed to listen udp: %v", err)
+		p.limits.ReleaseForward("udp", hostAddress, guestAddress)
 		p.udpListenersRW.Unlock()
 		return
 	}
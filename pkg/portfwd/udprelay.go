@@ -0,0 +1,54 @@
+package portfwd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	guestagentclient "github.com/lima-vm/lima/pkg/guestagent/api/client"
+	"github.com/lima-vm/lima/pkg/udprelay"
+)
+
+// HandleUDPRelay relays the datagrams sent to the multicast or broadcast address addr
+// between the host and the guest, until ctx is cancelled.
+func HandleUDPRelay(ctx context.Context, client *guestagentclient.GuestAgentClient, addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := udprelay.Listen(udpAddr)
+	if err != nil {
+		return err
+	}
+	id := fmt.Sprintf("%s-%s", udprelay.Protocol, addr)
+
+	stream, err := client.Tunnel(ctx)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("could not open udp relay tunnel for id: %s error:%w", id, err)
+	}
+	// Handshake message to start tunnel
+	if err := stream.Send(&api.TunnelMessage{Id: id, Protocol: udprelay.Protocol, GuestAddr: addr}); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("could not start udp relay tunnel for id: %s error:%w", id, err)
+	}
+
+	send := func(b []byte) error {
+		return stream.Send(&api.TunnelMessage{Id: id, Protocol: udprelay.Protocol, GuestAddr: addr, Data: b})
+	}
+	recv := func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return msg.Data, nil
+	}
+	err = udprelay.Relay(ctx, conn, udpAddr, send, recv)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/lima-vm/lima/pkg/bicopy"
 	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/udprelay"
 )
 
 type TunnelServer struct{}
@@ -26,6 +27,10 @@ func (s *TunnelServer) Start(stream api.GuestService_TunnelServer) error {
 		return err
 	}
 
+	if in.Protocol == udprelay.Protocol {
+		return relayUDP(stream, in)
+	}
+
 	// We simply forward data form GRPC stream to net.Conn for both tcp and udp. So simple proxy is sufficient
 	conn, err := net.Dial(in.Protocol, in.GuestAddr)
 	if err != nil {
@@ -36,6 +41,33 @@ func (s *TunnelServer) Start(stream api.GuestService_TunnelServer) error {
 	return nil
 }
 
+// relayUDP relays the multicast or broadcast datagrams of in.GuestAddr between the stream and the guest network.
+func relayUDP(stream api.GuestService_TunnelServer, in *api.TunnelMessage) error {
+	addr, err := net.ResolveUDPAddr("udp4", in.GuestAddr)
+	if err != nil {
+		return err
+	}
+	conn, err := udprelay.Listen(addr)
+	if err != nil {
+		return err
+	}
+	send := func(b []byte) error {
+		return stream.Send(&api.TunnelMessage{Id: in.Id, Data: b})
+	}
+	recv := func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return msg.Data, nil
+	}
+	err = udprelay.Relay(stream.Context(), conn, addr, send, recv)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
 type GRPCServerRW struct {
 	id     string
 	stream api.GuestService_TunnelServer
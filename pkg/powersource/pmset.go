@@ -0,0 +1,12 @@
+package powersource
+
+import "strings"
+
+// parsePmset parses the output of `pmset -g ps`, e.g.:
+//
+//	Now drawing from 'Battery Power'
+//	 -InternalBattery-0 (id=1234567)	85%; discharging; 5:12 remaining present: true
+func parsePmset(out string) bool {
+	first, _, _ := strings.Cut(out, "\n")
+	return strings.Contains(first, "'Battery Power'")
+}
@@ -0,0 +1,10 @@
+// Package powersource detects whether the host is running on battery, for `powerSaving.mode: auto`.
+package powersource
+
+import "context"
+
+// OnBattery returns true if the host is running on battery.
+// False is returned for the hosts without a battery, and for the hosts where the power source cannot be detected.
+func OnBattery(ctx context.Context) (bool, error) {
+	return onBattery(ctx)
+}
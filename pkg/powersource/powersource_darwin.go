@@ -0,0 +1,15 @@
+package powersource
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+func onBattery(ctx context.Context) (bool, error) {
+	out, err := exec.CommandContext(ctx, "pmset", "-g", "ps").Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to run pmset: %w", err)
+	}
+	return parsePmset(string(out)), nil
+}
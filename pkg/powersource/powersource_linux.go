@@ -0,0 +1,48 @@
+package powersource
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const powerSupplyDir = "/sys/class/power_supply"
+
+func onBattery(_ context.Context) (bool, error) {
+	return onBatterySysfs(powerSupplyDir)
+}
+
+// onBatterySysfs returns true if the host has a battery that is discharging, and no online external power supply.
+// https://www.kernel.org/doc/html/latest/power/power_supply_class.html
+func onBatterySysfs(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	read := func(name, attr string) string {
+		b, _ := os.ReadFile(filepath.Join(dir, name, attr))
+		return strings.TrimSpace(string(b))
+	}
+	var discharging bool
+	for _, e := range entries {
+		switch read(e.Name(), "type") {
+		case "Mains", "USB":
+			if read(e.Name(), "online") == "1" {
+				return false, nil
+			}
+		case "Battery":
+			// Ignore the batteries of the peripherals, e.g., mice
+			if read(e.Name(), "scope") == "Device" {
+				continue
+			}
+			if read(e.Name(), "status") == "Discharging" {
+				discharging = true
+			}
+		}
+	}
+	return discharging, nil
+}
@@ -0,0 +1,48 @@
+package powersource
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func writeSupply(t *testing.T, dir, name string, attrs map[string]string) {
+	t.Helper()
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, name), 0o755))
+	for k, v := range attrs {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name, k), []byte(v+"\n"), 0o644))
+	}
+}
+
+func TestOnBatterySysfs(t *testing.T) {
+	t.Run("missing", func(t *testing.T) {
+		got, err := onBatterySysfs(filepath.Join(t.TempDir(), "nonexistent"))
+		assert.NilError(t, err)
+		assert.Equal(t, got, false)
+	})
+	t.Run("discharging", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSupply(t, dir, "AC", map[string]string{"type": "Mains", "online": "0"})
+		writeSupply(t, dir, "BAT0", map[string]string{"type": "Battery", "status": "Discharging"})
+		got, err := onBatterySysfs(dir)
+		assert.NilError(t, err)
+		assert.Equal(t, got, true)
+	})
+	t.Run("ac", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSupply(t, dir, "AC", map[string]string{"type": "Mains", "online": "1"})
+		writeSupply(t, dir, "BAT0", map[string]string{"type": "Battery", "status": "Charging"})
+		got, err := onBatterySysfs(dir)
+		assert.NilError(t, err)
+		assert.Equal(t, got, false)
+	})
+	t.Run("peripheral", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSupply(t, dir, "hidpp_battery_0", map[string]string{"type": "Battery", "scope": "Device", "status": "Discharging"})
+		got, err := onBatterySysfs(dir)
+		assert.NilError(t, err)
+		assert.Equal(t, got, false)
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux && !windows
+
+package powersource
+
+import "context"
+
+func onBattery(_ context.Context) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,20 @@
+package powersource
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParsePmset(t *testing.T) {
+	onBattery := `Now drawing from 'Battery Power'
+ -InternalBattery-0 (id=1234567)	85%; discharging; 5:12 remaining present: true
+`
+	assert.Equal(t, parsePmset(onBattery), true)
+
+	onAC := `Now drawing from 'AC Power'
+ -InternalBattery-0 (id=1234567)	100%; charged; 0:00 remaining present: true
+`
+	assert.Equal(t, parsePmset(onAC), false)
+	assert.Equal(t, parsePmset(""), false)
+}
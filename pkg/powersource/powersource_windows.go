@@ -0,0 +1,33 @@
+package powersource
+
+import (
+	"context"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32              = syscall.NewLazyDLL("kernel32.dll")
+	procGetSystemPowerStatus = modkernel32.NewProc("GetSystemPowerStatus")
+)
+
+// systemPowerStatus is SYSTEM_POWER_STATUS.
+// https://learn.microsoft.com/en-us/windows/win32/api/winbase/ns-winbase-system_power_status
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+func onBattery(_ context.Context) (bool, error) {
+	var st systemPowerStatus
+	r, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&st)))
+	if r == 0 {
+		return false, err
+	}
+	// ACLineStatus is 0 for offline, 1 for online, and 255 for unknown
+	return st.ACLineStatus == 0, nil
+}
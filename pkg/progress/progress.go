@@ -0,0 +1,312 @@
+// Package progress reports the progress of long-running tasks, such as downloads and disk conversions,
+// and the phases of the operations, such as booting an instance.
+//
+// The output depends on the mode, which is set by `limactl --progress`:
+// interactive bars on terminals, log lines otherwise, or JSON lines for automation.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/docker/go-units"
+	"github.com/mattn/go-isatty"
+	"github.com/sirupsen/logrus"
+)
+
+type Mode = string
+
+const (
+	// ModeAuto is ModeJSON when the log format is JSON, ModeFancy when stderr is a terminal, and ModePlain otherwise.
+	ModeAuto Mode = "auto"
+	// ModeFancy renders interactive bars, one line per running task.
+	ModeFancy Mode = "fancy"
+	// ModePlain prints log lines when a task starts and finishes, and periodically in between.
+	ModePlain Mode = "plain"
+	// ModeJSON prints Event as JSON lines.
+	ModeJSON Mode = "json"
+	// ModeQuiet prints nothing, except for the debug logs.
+	ModeQuiet Mode = "quiet"
+)
+
+var Modes = []Mode{ModeAuto, ModeFancy, ModePlain, ModeJSON, ModeQuiet}
+
+const (
+	// plainInterval is the interval of the log lines of a task in ModePlain.
+	plainInterval = 5 * time.Second
+	// jsonInterval is the interval of the "progress" events of a task in ModeJSON.
+	jsonInterval = time.Second
+	// fancyDescriptionWidth is the maximum width of the description shown ahead of a bar in ModeFancy.
+	fancyDescriptionWidth = 40
+)
+
+const (
+	EventStep     = "step"
+	EventStart    = "start"
+	EventProgress = "progress"
+	EventFinish   = "finish"
+)
+
+// Event is printed as a JSON line in ModeJSON.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Type is one of EventStep, EventStart, EventProgress, and EventFinish
+	Type string `json:"type"`
+	// ID identifies the task; not set for EventStep
+	ID int64 `json:"id,omitempty"`
+	// Message is the description of the task, or the step
+	Message string `json:"message"`
+	Current int64  `json:"current,omitempty"`
+	// Total is the size of the task, or 0 if unknown
+	Total int64 `json:"total,omitempty"`
+}
+
+var (
+	mu     sync.Mutex
+	mode             = ModeAuto
+	output io.Writer = os.Stderr
+	// pool renders the running bars in ModeFancy
+	pool       *pb.Pool
+	poolActive int
+	lastID     atomic.Int64
+)
+
+// SetMode sets the mode of the progress output.
+func SetMode(m Mode) error {
+	switch m {
+	case ModeAuto, ModeFancy, ModePlain, ModeJSON, ModeQuiet:
+	default:
+		return fmt.Errorf("unsupported progress mode %q (supported: %v)", m, Modes)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	mode = m
+	return nil
+}
+
+// CurrentMode returns the mode of the progress output, with ModeAuto resolved.
+func CurrentMode() Mode {
+	mu.Lock()
+	m := mode
+	mu.Unlock()
+	if m != ModeAuto {
+		return m
+	}
+	switch logrus.StandardLogger().Formatter.(type) {
+	case *logrus.JSONFormatter:
+		return ModeJSON
+	case *logrus.TextFormatter:
+		// Both logrus and pb use stderr by default.
+		fd := os.Stderr.Fd()
+		if isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd) {
+			return ModeFancy
+		}
+	}
+	return ModePlain
+}
+
+// Step reports the beginning of a phase of an operation, e.g., "Generating cidata".
+func Step(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	switch CurrentMode() {
+	case ModeJSON:
+		emit(Event{Type: EventStep, Message: msg})
+	case ModeQuiet:
+		logrus.Debug(msg)
+	default:
+		logrus.Info(msg)
+	}
+}
+
+func emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to marshal the progress event")
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	fmt.Fprintln(output, string(b))
+}
+
+// Bar reports the progress of a task in bytes.
+// Bar implements the Updater interface of go-qcow2reader/convert.
+type Bar struct {
+	mode        Mode
+	id          int64
+	description string
+	total       int64
+	current     atomic.Int64
+	started     time.Time
+
+	mu         sync.Mutex
+	lastReport time.Time
+	finished   bool
+
+	pb     *pb.ProgressBar // ModeFancy only
+	pooled bool            // rendered by pool
+}
+
+// New returns a new Bar for a task of the total size in bytes, or an unknown size if total is not positive.
+// The description, e.g., "Downloading https://...", is shown along with the progress.
+func New(description string, total int64) *Bar {
+	b := &Bar{
+		mode:        CurrentMode(),
+		id:          lastID.Add(1),
+		description: description,
+		total:       total,
+	}
+	if b.mode == ModeFancy {
+		b.pb = pb.New64(total)
+		b.pb.Set(pb.Bytes, true)
+		b.pb.Set("prefix", shorten(description, fancyDescriptionWidth))
+		b.pb.SetTemplateString(`{{string . "prefix"}} {{counters . }} {{bar . | green }} {{percent .}} {{speed . "%s/s"}}`)
+		b.pb.SetWidth(80)
+	}
+	return b
+}
+
+// shorten truncates s from the left, as the tail of a description (e.g., the file name) is the most informative part.
+func shorten(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return "..." + string(r[len(r)-width+3:])
+}
+
+// Start starts reporting the progress.
+func (b *Bar) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.started = time.Now()
+	b.lastReport = b.started
+	switch b.mode {
+	case ModeFancy:
+		mu.Lock()
+		defer mu.Unlock()
+		if pool == nil {
+			p := pb.NewPool()
+			p.Output = output
+			if err := p.Start(); err != nil {
+				// e.g., no controlling terminal
+				logrus.WithError(err).Debug("failed to start the progress bar pool, falling back to a standalone bar")
+				b.pb.SetWriter(output)
+				b.pb.Start()
+				return
+			}
+			pool = p
+		}
+		pool.Add(b.pb)
+		b.pooled = true
+		poolActive++
+	case ModePlain:
+		if b.total > 0 {
+			logrus.Infof("%s (%s)", b.description, units.BytesSize(float64(b.total)))
+		} else {
+			logrus.Info(b.description)
+		}
+	case ModeJSON:
+		emit(Event{Type: EventStart, ID: b.id, Message: b.description, Total: b.total})
+	case ModeQuiet:
+		logrus.Debug(b.description)
+	}
+}
+
+// Add64 adds n bytes to the progress.
+func (b *Bar) Add64(n int64) {
+	current := b.current.Add(n)
+	switch b.mode {
+	case ModeFancy:
+		b.pb.Add64(n)
+	case ModePlain, ModeJSON:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.finished || b.started.IsZero() {
+			return
+		}
+		now := time.Now()
+		if b.mode == ModePlain && now.Sub(b.lastReport) >= plainInterval {
+			b.lastReport = now
+			logrus.Infof("%s: %s", b.description, b.counters(current))
+		} else if b.mode == ModeJSON && now.Sub(b.lastReport) >= jsonInterval {
+			b.lastReport = now
+			emit(Event{Type: EventProgress, ID: b.id, Message: b.description, Current: current, Total: b.total})
+		}
+	}
+}
+
+// Update is an alias of Add64, for go-qcow2reader/convert.
+func (b *Bar) Update(n int64) {
+	b.Add64(n)
+}
+
+// Current returns the progress in bytes.
+func (b *Bar) Current() int64 {
+	return b.current.Load()
+}
+
+func (b *Bar) counters(current int64) string {
+	if b.total <= 0 {
+		return units.BytesSize(float64(current))
+	}
+	return fmt.Sprintf("%d%% (%s / %s)", current*100/b.total,
+		units.BytesSize(float64(current)), units.BytesSize(float64(b.total)))
+}
+
+// NewProxyReader returns a reader that adds the bytes read from r to the progress.
+func (b *Bar) NewProxyReader(r io.Reader) io.Reader {
+	return &proxyReader{r: r, bar: b}
+}
+
+type proxyReader struct {
+	r   io.Reader
+	bar *Bar
+}
+
+func (r *proxyReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.bar.Add64(int64(n))
+	return n, err
+}
+
+// Finish stops reporting the progress. Finish is a NOP if the bar has not been started, or has been already finished.
+func (b *Bar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished || b.started.IsZero() {
+		return
+	}
+	b.finished = true
+	current := b.current.Load()
+	switch b.mode {
+	case ModeFancy:
+		mu.Lock()
+		defer mu.Unlock()
+		b.pb.Finish()
+		if !b.pooled {
+			return
+		}
+		poolActive--
+		if poolActive == 0 {
+			if err := pool.Stop(); err != nil {
+				logrus.WithError(err).Debug("failed to stop the progress bar pool")
+			}
+			pool = nil
+		}
+	case ModePlain:
+		logrus.Infof("%s: done (%s in %v)", b.description, units.BytesSize(float64(current)),
+			time.Since(b.started).Round(time.Second/10))
+	case ModeJSON:
+		emit(Event{Type: EventFinish, ID: b.id, Message: b.description, Current: current, Total: b.total})
+	}
+}
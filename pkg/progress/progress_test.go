@@ -0,0 +1,90 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+)
+
+func setMode(t *testing.T, m Mode) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NilError(t, SetMode(m))
+	output = &buf
+	logrus.SetOutput(&buf)
+	t.Cleanup(func() {
+		_ = SetMode(ModeAuto)
+		output = os.Stderr
+		logrus.SetOutput(os.Stderr)
+	})
+	return &buf
+}
+
+func TestSetMode(t *testing.T) {
+	t.Cleanup(func() { _ = SetMode(ModeAuto) })
+	assert.ErrorContains(t, SetMode("bars"), "unsupported progress mode")
+	for _, m := range Modes {
+		assert.NilError(t, SetMode(m))
+	}
+	assert.Assert(t, CurrentMode() != ModeAuto)
+}
+
+func TestJSON(t *testing.T) {
+	buf := setMode(t, ModeJSON)
+	Step("Generating %s", "cidata.iso")
+	bar := New("Downloading foo", 10)
+	bar.Start()
+	_, err := io.Copy(io.Discard, bar.NewProxyReader(strings.NewReader("0123456789")))
+	assert.NilError(t, err)
+	bar.Finish()
+	bar.Finish()
+
+	var events []Event
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var ev Event
+		assert.NilError(t, dec.Decode(&ev))
+		events = append(events, ev)
+	}
+	assert.Equal(t, len(events), 3)
+	assert.Equal(t, events[0].Type, EventStep)
+	assert.Equal(t, events[0].Message, "Generating cidata.iso")
+	assert.Equal(t, events[1].Type, EventStart)
+	assert.Equal(t, events[1].Total, int64(10))
+	assert.Equal(t, events[2].Type, EventFinish)
+	assert.Equal(t, events[2].ID, events[1].ID)
+	assert.Equal(t, events[2].Current, int64(10))
+}
+
+func TestPlain(t *testing.T) {
+	buf := setMode(t, ModePlain)
+	bar := New("Converting foo", 2048)
+	bar.Start()
+	bar.Update(2048)
+	bar.Finish()
+	s := buf.String()
+	assert.Assert(t, strings.Contains(s, "Converting foo (2KiB)"), s)
+	assert.Assert(t, strings.Contains(s, "Converting foo: done (2KiB in "), s)
+}
+
+func TestQuiet(t *testing.T) {
+	buf := setMode(t, ModeQuiet)
+	Step("Starting")
+	bar := New("Downloading foo", 10)
+	bar.Start()
+	bar.Add64(10)
+	bar.Finish()
+	assert.Equal(t, buf.String(), "")
+	assert.Equal(t, bar.Current(), int64(10))
+}
+
+func TestShorten(t *testing.T) {
+	assert.Equal(t, shorten("foo", 10), "foo")
+	assert.Equal(t, shorten("https://example.com/disk.img", 12), ".../disk.img")
+}
@@ -0,0 +1,304 @@
+// Package prune finds and removes the garbage objects of Lima: the download cache,
+// the disks that are not used by any instance, the dangling snapshots, and the unused images of the image store.
+package prune
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/downloader"
+	"github.com/lima-vm/lima/pkg/imagestore"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// Kinds of the objects.
+const (
+	KindDownload = "download"
+	KindDisk     = "disk"
+	KindSnapshot = "snapshot"
+	KindImage    = "image"
+)
+
+// Object is a garbage object.
+type Object struct {
+	Kind string `json:"kind"`
+	// Name is the URL for KindDownload (or the cache key when the URL is unknown),
+	// the disk name for KindDisk, "INSTANCE/TAG" or "INSTANCE/FILE" for KindSnapshot, and the digest for KindImage.
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+	// LastUsed is set only for KindDownload
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// Report is the result of pruning.
+type Report struct {
+	// DryRun is true when the objects were not removed
+	DryRun    bool     `json:"dryRun"`
+	Objects   []Object `json:"objects"`
+	TotalSize int64    `json:"totalSize"`
+	// Errors are the errors of removing the objects
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Add adds the objects to the report.
+func (r *Report) Add(objs ...Object) {
+	for _, o := range objs {
+		r.Objects = append(r.Objects, o)
+		r.TotalSize += o.Size
+	}
+}
+
+// Remove removes the objects in the report, unless DryRun is set.
+// The objects that failed to be removed are excluded from TotalSize.
+func (r *Report) Remove() {
+	if r.DryRun {
+		return
+	}
+	for _, o := range r.Objects {
+		if err := os.RemoveAll(o.Path); err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("failed to remove %s %q: %v", o.Kind, o.Name, err))
+			r.TotalSize -= o.Size
+		}
+	}
+}
+
+// DownloadPolicy selects the entries of the download cache to be pruned.
+type DownloadPolicy struct {
+	// All selects all the entries
+	All bool
+	// OlderThan selects the entries that have not been used for the duration
+	OlderThan time.Duration
+	// MaxSize selects the least recently used entries, until the cache fits in the size
+	MaxSize int64
+}
+
+// ParseDownloadPolicy parses a comma-separated list of "all", "older-than=DURATION", and "max-size=SIZE",
+// e.g., "older-than=30d,max-size=20GiB".
+// The duration may have "d" (days) as the unit, in addition to the units of time.ParseDuration.
+func ParseDownloadPolicy(s string) (*DownloadPolicy, error) {
+	var p DownloadPolicy
+	for _, f := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(f), "=")
+		var err error
+		switch k {
+		case "all":
+			p.All = true
+		case "older-than":
+			p.OlderThan, err = parseDuration(v)
+			if err == nil && p.OlderThan <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "max-size":
+			p.MaxSize, err = units.RAMInBytes(v)
+			if err == nil && p.MaxSize < 0 {
+				err = errors.New("must not be negative")
+			}
+		default:
+			return nil, fmt.Errorf("invalid download policy %q, must be one of: all, older-than=DURATION, max-size=SIZE", f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid download policy %q: %w", f, err)
+		}
+	}
+	return &p, nil
+}
+
+// parseDuration is like time.ParseDuration, but also accepts the number of days, e.g., "30d".
+func parseDuration(s string) (time.Duration, error) {
+	if d, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Downloads returns the entries of the download cache selected by the policy.
+// The entries in keep (the cache keys) are never selected, but they are counted in the size of the cache for MaxSize.
+func Downloads(policy DownloadPolicy, keep map[string]struct{}, now time.Time, opts ...downloader.Opt) ([]Object, error) {
+	cacheEntries, err := downloader.CacheEntries(opts...)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*downloader.CacheEntry, 0, len(cacheEntries))
+	for key, path := range cacheEntries {
+		entry, err := downloader.InspectCacheEntry(key, path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	// the most recently used first
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].LastUsed.Equal(entries[j].LastUsed) {
+			return entries[i].LastUsed.After(entries[j].LastUsed)
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	var (
+		objs  []Object
+		total int64
+	)
+	for _, entry := range entries {
+		_, kept := keep[entry.Key]
+		var reason string
+		switch {
+		case policy.All:
+			reason = "all downloads"
+		case policy.OlderThan > 0 && now.Sub(entry.LastUsed) > policy.OlderThan:
+			reason = fmt.Sprintf("not used for %s", units.HumanDuration(now.Sub(entry.LastUsed)))
+		case policy.MaxSize > 0 && total+entry.Size > policy.MaxSize:
+			reason = fmt.Sprintf("exceeds max-size %s", units.BytesSize(float64(policy.MaxSize)))
+		}
+		if reason == "" || kept {
+			total += entry.Size
+			continue
+		}
+		name := entry.URL
+		if name == "" {
+			name = entry.Key
+		}
+		objs = append(objs, Object{Kind: KindDownload, Name: name, Path: entry.Path, Size: entry.Size, Reason: reason, LastUsed: &entry.LastUsed})
+	}
+	return objs, nil
+}
+
+// UnusedDisks returns the disks (`limactl disk`) that are neither attached to nor referred by any instance.
+func UnusedDisks(instances []*store.Instance) ([]Object, error) {
+	referred := make(map[string]struct{})
+	for _, inst := range instances {
+		if inst.Config == nil {
+			continue
+		}
+		for _, d := range inst.Config.AdditionalDisks {
+			referred[d.Name] = struct{}{}
+		}
+	}
+	names, err := store.Disks()
+	if err != nil {
+		return nil, err
+	}
+	var objs []Object
+	for _, name := range names {
+		if _, ok := referred[name]; ok {
+			continue
+		}
+		disk, err := store.InspectDisk(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect disk %q: %w", name, err)
+		}
+		if disk.Instance != "" {
+			continue
+		}
+		size, err := dirSize(disk.Dir)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, Object{Kind: KindDisk, Name: name, Path: disk.Dir, Size: size, Reason: "not used by any instance"})
+	}
+	return objs, nil
+}
+
+// UnusedImages returns the images of the image store that are not hard-linked from any instance.
+// The images cloned into the instances are also returned, as the clones do not depend on them.
+// The number of the hard links is unknown on Windows, so no image is returned.
+func UnusedImages() ([]Object, error) {
+	images, err := imagestore.List()
+	if err != nil {
+		return nil, err
+	}
+	var objs []Object
+	for _, img := range images {
+		if img.Links != 1 {
+			continue
+		}
+		objs = append(objs, Object{Kind: KindImage, Name: img.Digest.String(), Path: img.Path, Size: img.Size, Reason: "not linked from any instance"})
+	}
+	return objs, nil
+}
+
+// DanglingSnapshots returns the snapshots that cannot be applied:
+// the snapshots of the vz driver left after changing the vmType of the instance,
+// the empty snapshots, and the temporary files left by an interrupted restore.
+func DanglingSnapshots(instances []*store.Instance) ([]Object, error) {
+	var objs []Object
+	for _, inst := range instances {
+		storageDir := store.StorageDir(inst.Dir, inst.Config)
+		snapshotsDir := filepath.Join(storageDir, filenames.VzSnapshotsDir)
+		entries, err := os.ReadDir(snapshotsDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, e := range entries {
+			path := filepath.Join(snapshotsDir, e.Name())
+			var reason string
+			if inst.VMType != limayaml.VZ {
+				reason = fmt.Sprintf("snapshot of vmType vz, the instance is %s", inst.VMType)
+			} else if files, err := os.ReadDir(path); err == nil && len(files) == 0 {
+				reason = "empty snapshot"
+			}
+			if reason == "" {
+				continue
+			}
+			size, err := dirSize(path)
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, Object{Kind: KindSnapshot, Name: inst.Name + "/" + e.Name(), Path: path, Size: size, Reason: reason})
+		}
+		// a restore may be in progress unless the instance is stopped
+		if inst.Status != store.StatusStopped {
+			continue
+		}
+		dirs := []string{inst.Dir}
+		if storageDir != inst.Dir {
+			dirs = append(dirs, storageDir)
+		}
+		for _, dir := range dirs {
+			tmps, err := filepath.Glob(filepath.Join(dir, "*"+snapshotTmpSuffix))
+			if err != nil {
+				return nil, err
+			}
+			for _, tmp := range tmps {
+				size, err := dirSize(tmp)
+				if err != nil {
+					return nil, err
+				}
+				objs = append(objs, Object{Kind: KindSnapshot, Name: inst.Name + "/" + filepath.Base(tmp), Path: tmp, Size: size, Reason: "left by an interrupted restore"})
+			}
+		}
+	}
+	return objs, nil
+}
+
+// snapshotTmpSuffix is the suffix of the temporary files created while restoring a snapshot of the vz driver
+// (see vz.LoadSnapshot).
+const snapshotTmpSuffix = ".snapshot.tmp"
+
+// dirSize returns the total size of the regular files under path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,178 @@
+package prune
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/downloader"
+	"github.com/lima-vm/lima/pkg/imagestore"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseDownloadPolicy(t *testing.T) {
+	p, err := ParseDownloadPolicy("older-than=30d, max-size=1GiB")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p, &DownloadPolicy{OlderThan: 30 * 24 * time.Hour, MaxSize: 1 << 30})
+
+	p, err = ParseDownloadPolicy("older-than=12h")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p, &DownloadPolicy{OlderThan: 12 * time.Hour})
+
+	p, err = ParseDownloadPolicy("all")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p, &DownloadPolicy{All: true})
+
+	_, err = ParseDownloadPolicy("older-than=0d")
+	assert.ErrorContains(t, err, "must be positive")
+	_, err = ParseDownloadPolicy("older-than=xd")
+	assert.ErrorContains(t, err, "invalid duration")
+	_, err = ParseDownloadPolicy("newer-than=1d")
+	assert.ErrorContains(t, err, "must be one of")
+}
+
+func writeCacheEntry(t *testing.T, cacheDir, url string, size int, lastUsed time.Time) string {
+	t.Helper()
+	dir := filepath.Join(cacheDir, "download", "by-url-sha256", downloader.CacheKey(url))
+	assert.NilError(t, os.MkdirAll(dir, 0o700))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "url"), []byte(url), 0o644))
+	data := filepath.Join(dir, "data")
+	assert.NilError(t, os.WriteFile(data, make([]byte, size), 0o644))
+	assert.NilError(t, os.Chtimes(data, lastUsed, lastUsed))
+	return dir
+}
+
+func TestDownloads(t *testing.T) {
+	cacheDir := t.TempDir()
+	now := time.Now()
+	const (
+		recent = "https://example.com/img-a"
+		old    = "https://example.com/img-b"
+		older  = "https://example.com/img-c"
+	)
+	writeCacheEntry(t, cacheDir, recent, 1000, now.Add(-time.Hour))
+	writeCacheEntry(t, cacheDir, old, 1000, now.Add(-40*24*time.Hour))
+	writeCacheEntry(t, cacheDir, older, 1000, now.Add(-50*24*time.Hour))
+	opt := downloader.WithCacheDir(cacheDir)
+	// the size of the "url" file is counted too
+	entrySize := int64(1000 + len(recent))
+
+	names := func(objs []Object) []string {
+		var res []string
+		for _, o := range objs {
+			res = append(res, o.Name)
+		}
+		return res
+	}
+
+	objs, err := Downloads(DownloadPolicy{OlderThan: 30 * 24 * time.Hour}, nil, now, opt)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names(objs), []string{old, older})
+	assert.Equal(t, objs[0].Size, entrySize)
+
+	// the kept entries are not selected
+	keep := map[string]struct{}{downloader.CacheKey(old): {}}
+	objs, err = Downloads(DownloadPolicy{OlderThan: 30 * 24 * time.Hour}, keep, now, opt)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names(objs), []string{older})
+
+	// the least recently used entries are selected until the cache fits
+	objs, err = Downloads(DownloadPolicy{MaxSize: entrySize * 2}, nil, now, opt)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names(objs), []string{older})
+
+	objs, err = Downloads(DownloadPolicy{All: true}, nil, now, opt)
+	assert.NilError(t, err)
+	assert.Equal(t, len(objs), 3)
+
+	// dry run
+	report := &Report{DryRun: true}
+	report.Add(objs...)
+	report.Remove()
+	assert.Equal(t, report.TotalSize, entrySize*3)
+	entries, err := downloader.CacheEntries(opt)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 3)
+
+	report.DryRun = false
+	report.Remove()
+	assert.Equal(t, len(report.Errors), 0)
+	entries, err = downloader.CacheEntries(opt)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+}
+
+func TestUnusedDisks(t *testing.T) {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	for _, name := range []string{"attached", "referred", "unused"} {
+		dir, err := store.DiskDir(name)
+		assert.NilError(t, err)
+		assert.NilError(t, os.MkdirAll(dir, 0o755))
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, filenames.DataDisk), make([]byte, 4096), 0o644))
+		if name == "attached" {
+			assert.NilError(t, os.Symlink("/nonexistent/instance", filepath.Join(dir, filenames.InUseBy)))
+		}
+	}
+	instances := []*store.Instance{
+		{Name: "foo", Config: &limayaml.LimaYAML{AdditionalDisks: []limayaml.Disk{{Name: "referred"}}}},
+	}
+	objs, err := UnusedDisks(instances)
+	assert.NilError(t, err)
+	assert.Equal(t, len(objs), 1)
+	assert.Equal(t, objs[0].Name, "unused")
+	assert.Equal(t, objs[0].Size, int64(4096))
+}
+
+func TestDanglingSnapshots(t *testing.T) {
+	mkSnapshot := func(instDir, tag string, files ...string) {
+		dir := filepath.Join(instDir, filenames.VzSnapshotsDir, tag)
+		assert.NilError(t, os.MkdirAll(dir, 0o755))
+		for _, f := range files {
+			assert.NilError(t, os.WriteFile(filepath.Join(dir, f), []byte("snap"), 0o644))
+		}
+	}
+	vzDir, qemuDir := t.TempDir(), t.TempDir()
+	mkSnapshot(vzDir, "good", filenames.DiffDisk)
+	mkSnapshot(vzDir, "empty")
+	mkSnapshot(qemuDir, "old", filenames.DiffDisk)
+	assert.NilError(t, os.WriteFile(filepath.Join(vzDir, filenames.DiffDisk+snapshotTmpSuffix), []byte("tmp"), 0o644))
+
+	instances := []*store.Instance{
+		{Name: "vz", Dir: vzDir, VMType: limayaml.VZ, Status: store.StatusStopped},
+		{Name: "qemu", Dir: qemuDir, VMType: limayaml.QEMU, Status: store.StatusRunning},
+	}
+	objs, err := DanglingSnapshots(instances)
+	assert.NilError(t, err)
+	var names []string
+	for _, o := range objs {
+		assert.Equal(t, o.Kind, KindSnapshot)
+		names = append(names, o.Name)
+	}
+	assert.DeepEqual(t, names, []string{"vz/empty", "vz/" + filenames.DiffDisk + snapshotTmpSuffix, "qemu/old"})
+}
+
+func TestUnusedImages(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the number of the hard links is unknown on Windows")
+	}
+	t.Setenv("LIMA_HOME", t.TempDir())
+	instDir := t.TempDir()
+	for _, name := range []string{"used", "unused"} {
+		baseDisk := filepath.Join(instDir, name)
+		assert.NilError(t, os.WriteFile(baseDisk, []byte(name), 0o644))
+		assert.NilError(t, imagestore.Dedup(baseDisk))
+	}
+	assert.NilError(t, os.Remove(filepath.Join(instDir, "unused")))
+
+	objs, err := UnusedImages()
+	assert.NilError(t, err)
+	assert.Equal(t, len(objs), 1)
+	assert.Equal(t, objs[0].Kind, KindImage)
+	assert.Equal(t, objs[0].Name, digest.SHA256.FromString("unused").String())
+}
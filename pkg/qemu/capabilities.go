@@ -0,0 +1,40 @@
+package qemu
+
+import (
+	"runtime"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// Capabilities returns the capability manifest of the QEMU driver.
+func Capabilities() limayaml.DriverCapabilities {
+	mountTypes := []limayaml.MountType{limayaml.REVSSHFS, limayaml.NINEP, limayaml.NFS}
+	if runtime.GOOS == "linux" {
+		mountTypes = append(mountTypes, limayaml.VIRTIOFS)
+	}
+	return limayaml.DriverCapabilities{
+		MountTypes: mountTypes,
+		Arches:     limayaml.ArchTypes,
+		// QEMU accepts arbitrary `-display` strings
+		DisplayTypes:    nil,
+		Snapshot:        true,
+		TPM:             true,
+		EgressPolicy:    true,
+		MetadataService: true,
+		// VFIO is a feature of the Linux kernel
+		PCIPassthrough: runtime.GOOS == "linux",
+		SharedMemory:   true,
+		// `dump-guest-memory` of QMP
+		CrashVMCore:     true,
+		VideoAccel:      true,
+		AdditionalUsers: true,
+		// `stop` and `cont` of QMP
+		Pause: true,
+		// `migrate` to a file, and `-incoming`
+		Suspend: true,
+		// `drive-backup` of QMP
+		LiveClone: true,
+		// aarch64 "virt" machine does not support CPU hotplug
+		CPUHotplugArches: []limayaml.Arch{limayaml.X8664},
+	}
+}
@@ -0,0 +1,128 @@
+package qemu
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+)
+
+// hotplugCPUIDPrefix is the prefix of the device IDs of the hot-plugged CPUs.
+const hotplugCPUIDPrefix = "lima-cpu"
+
+// hotplugMaxCPUs returns `maxCPUs` if CPU hotplug is supported for the instance, otherwise `cpus`.
+func hotplugMaxCPUs(y *limayaml.LimaYAML) int {
+	if y.MaxCPUs == nil || *y.MaxCPUs <= *y.CPUs {
+		return *y.CPUs
+	}
+	if !slices.Contains(Capabilities().CPUHotplugArches, *y.Arch) {
+		return *y.CPUs
+	}
+	return *y.MaxCPUs
+}
+
+// ChangeCPUs hot-plugs or hot-unplugs the CPUs of the running instance, via QMP.
+// Only the CPUs that were hot-plugged can be unplugged, and the unplug is completed asynchronously
+// when the guest releases the CPUs.
+func ChangeCPUs(cfg Config, cpus int) error {
+	qmpClient, err := newQmpClient(cfg)
+	if err != nil {
+		return err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return err
+	}
+	defer func() { _ = qmpClient.Disconnect() }()
+	rawClient := raw.NewMonitor(qmpClient)
+	slots, err := rawClient.QueryHotpluggableCpus()
+	if err != nil {
+		return fmt.Errorf("failed to query the hotpluggable CPUs: %w", err)
+	}
+	var free, hotplugged []raw.HotpluggableCPU
+	current := 0
+	for _, slot := range slots {
+		if slot.QomPath == nil {
+			free = append(free, slot)
+			continue
+		}
+		current += int(slot.VcpusCount)
+		if strings.HasPrefix(path.Base(*slot.QomPath), hotplugCPUIDPrefix) {
+			hotplugged = append(hotplugged, slot)
+		}
+	}
+	// plug the cores in ascending order, and unplug them in descending order
+	sort.Slice(free, func(i, j int) bool { return coreID(free[i]) < coreID(free[j]) })
+	sort.Slice(hotplugged, func(i, j int) bool { return coreID(hotplugged[i]) > coreID(hotplugged[j]) })
+
+	switch {
+	case cpus > current:
+		n := cpus - current
+		if n > len(free) {
+			return fmt.Errorf("cannot increase the CPUs to %d, as the instance was started with `maxCPUs` %d; a restart is required", cpus, current+len(free))
+		}
+		for _, slot := range free[:n] {
+			if err := deviceAddCPU(qmpClient, slot); err != nil {
+				return err
+			}
+		}
+		logrus.Infof("Hot-plugged %d CPUs", n)
+	case cpus < current:
+		n := current - cpus
+		if n > len(hotplugged) {
+			return fmt.Errorf("cannot decrease the CPUs to %d, as only the hot-plugged CPUs (%d) can be removed; a restart is required", cpus, len(hotplugged))
+		}
+		for _, slot := range hotplugged[:n] {
+			if err := rawClient.DeviceDel(path.Base(*slot.QomPath)); err != nil {
+				return fmt.Errorf("failed to remove CPU %q: %w", *slot.QomPath, err)
+			}
+		}
+		logrus.Infof("Requested the guest to release %d CPUs", n)
+	}
+	return nil
+}
+
+func coreID(slot raw.HotpluggableCPU) int64 {
+	if slot.Props.CoreID == nil {
+		return 0
+	}
+	return *slot.Props.CoreID
+}
+
+// deviceAddCPU plugs the CPU into the slot.
+// raw.Monitor.DeviceAdd cannot be used, as it does not support the properties of the slot.
+func deviceAddCPU(qmpClient interface{ Run([]byte) ([]byte, error) }, slot raw.HotpluggableCPU) error {
+	id := fmt.Sprintf("%s%d", hotplugCPUIDPrefix, coreID(slot))
+	args := map[string]any{
+		"driver": slot.Type,
+		"id":     id,
+	}
+	if slot.Props.NodeID != nil {
+		args["node-id"] = *slot.Props.NodeID
+	}
+	if slot.Props.SocketID != nil {
+		args["socket-id"] = *slot.Props.SocketID
+	}
+	if slot.Props.CoreID != nil {
+		args["core-id"] = *slot.Props.CoreID
+	}
+	if slot.Props.ThreadID != nil {
+		args["thread-id"] = *slot.Props.ThreadID
+	}
+	b, err := json.Marshal(map[string]any{
+		"execute":   "device_add",
+		"arguments": args,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := qmpClient.Run(b); err != nil {
+		return fmt.Errorf("failed to add CPU %q: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
+	"gotest.tools/v3/assert"
+)
+
+func TestHotplugMaxCPUs(t *testing.T) {
+	y := &limayaml.LimaYAML{Arch: ptr.Of(limayaml.X8664), CPUs: ptr.Of(2)}
+	assert.Equal(t, hotplugMaxCPUs(y), 2)
+
+	y.MaxCPUs = ptr.Of(8)
+	assert.Equal(t, hotplugMaxCPUs(y), 8)
+
+	y.Arch = ptr.Of(limayaml.AARCH64)
+	assert.Equal(t, hotplugMaxCPUs(y), 2)
+}
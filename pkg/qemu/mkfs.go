@@ -0,0 +1,188 @@
+package qemu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// DataDiskFSTypes is the list of the filesystems supported by `limactl disk create --fs`.
+var DataDiskFSTypes = []string{"ext4", "xfs", "btrfs"}
+
+var fsLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// maxFSLabelLen is the maximum length of the label of each filesystem.
+var maxFSLabelLen = map[string]int{
+	"ext4":  16,
+	"xfs":   12,
+	"btrfs": 255,
+}
+
+// ValidateDataDiskFilesystem validates the filesystem type and the label.
+func ValidateDataDiskFilesystem(fsys *store.DiskFilesystem) error {
+	if !slices.Contains(DataDiskFSTypes, fsys.Type) {
+		return fmt.Errorf("filesystem %q not supported, use one of %v", fsys.Type, DataDiskFSTypes)
+	}
+	if !fsLabelRegexp.MatchString(fsys.Label) {
+		return fmt.Errorf("filesystem label %q must match %s", fsys.Label, fsLabelRegexp)
+	}
+	if maxLen := maxFSLabelLen[fsys.Type]; len(fsys.Label) > maxLen {
+		return fmt.Errorf("filesystem label %q must not be longer than %d characters for %s", fsys.Label, maxLen, fsys.Type)
+	}
+	return nil
+}
+
+const (
+	sectorSize = 512
+	// partitionStart is the first sector of the partition, aligned to 1 MiB as sfdisk does.
+	partitionStart = 2048
+	// gptTrailerSectors is the number of the sectors used by the secondary GPT header and partition array.
+	gptTrailerSectors = 33
+)
+
+// FormatDataDisk creates a GPT partition table with a single Linux partition on the data disk in dir,
+// and creates the filesystem on the partition with `mkfs.<type>` on the host.
+//
+// The filesystem is created as a sparse regular file, so that root privileges are not needed,
+// and then copied into the partition. For qcow2 disks, the raw disk is converted with qemu-img.
+//
+// It returns false without an error when `mkfs.<type>` is not available on the host;
+// the guest creates the filesystem when the disk is attached for the first time in that case.
+func FormatDataDisk(dir, format string, size int, fsys *store.DiskFilesystem) (bool, error) {
+	mkfs, err := exec.LookPath("mkfs." + fsys.Type)
+	if err != nil {
+		logrus.Infof("mkfs.%s is not available on the host; the filesystem will be created by the guest", fsys.Type)
+		return false, nil
+	}
+	dataDisk := filepath.Join(dir, filenames.DataDisk)
+	rawDisk := dataDisk
+	if format != "raw" {
+		rawDisk = dataDisk + ".raw.tmp"
+		defer os.RemoveAll(rawDisk)
+	}
+	totalSectors := uint64(size / sectorSize)
+	if totalSectors <= partitionStart+2*gptTrailerSectors {
+		return false, fmt.Errorf("disk size %d is too small", size)
+	}
+	endSector := totalSectors - gptTrailerSectors - 1
+	if err := writeRawWithPartition(rawDisk, int64(size), endSector); err != nil {
+		return false, err
+	}
+
+	partFile := dataDisk + ".part.tmp"
+	defer os.RemoveAll(partFile)
+	partSize := int64(endSector-partitionStart+1) * sectorSize
+	if err := createSparseFile(partFile, partSize); err != nil {
+		return false, err
+	}
+	args := []string{"-L", fsys.Label}
+	if fsys.Type == "ext4" {
+		// mke2fs asks for confirmation when the target is not a block device
+		args = append(args, "-F")
+	}
+	args = append(args, fsys.MkfsArgs...)
+	args = append(args, partFile)
+	cmd := exec.Command(mkfs, args...)
+	logrus.Infof("Creating the %s filesystem with label %q", fsys.Type, fsys.Label)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return false, fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+	}
+	if err := copySparse(rawDisk, partFile, partitionStart*sectorSize); err != nil {
+		return false, err
+	}
+
+	if format != "raw" {
+		cmd := exec.Command("qemu-img", "convert", "-f", "raw", "-O", format, rawDisk, dataDisk)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return false, fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+		}
+	}
+	return true, nil
+}
+
+func createSparseFile(name string, size int64) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeRawWithPartition(name string, size int64, endSector uint64) error {
+	if err := os.RemoveAll(name); err != nil {
+		return err
+	}
+	if err := createSparseFile(name, size); err != nil {
+		return err
+	}
+	d, err := diskfs.Open(name, diskfs.WithOpenMode(diskfs.ReadWriteExclusive))
+	if err != nil {
+		return err
+	}
+	defer d.File.Close()
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		ProtectiveMBR:      true,
+		Partitions: []*gpt.Partition{
+			{
+				Start: partitionStart,
+				End:   endSector,
+				Type:  gpt.LinuxFilesystem,
+			},
+		},
+	}
+	if err := d.Partition(table); err != nil {
+		return fmt.Errorf("failed to create the partition table on %q: %w", name, err)
+	}
+	return nil
+}
+
+// copySparse copies src into dst at offset, skipping the blocks that are filled with zeros
+// so that dst remains sparse.
+func copySparse(dst, src string, offset int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	buf := make([]byte, 1024*1024)
+	zero := make([]byte, len(buf))
+	for pos := int64(0); ; {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 && !bytes.Equal(buf[:n], zero[:n]) {
+			if _, werr := out.WriteAt(buf[:n], offset+pos); werr != nil {
+				return werr
+			}
+		}
+		pos += int64(n)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
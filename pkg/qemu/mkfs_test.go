@@ -0,0 +1,50 @@
+package qemu
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateDataDiskFilesystem(t *testing.T) {
+	assert.NilError(t, ValidateDataDiskFilesystem(&store.DiskFilesystem{Type: "ext4", Label: "lima-data"}))
+	assert.NilError(t, ValidateDataDiskFilesystem(&store.DiskFilesystem{Type: "btrfs", Label: "a-very-long-btrfs-label"}))
+	assert.ErrorContains(t, ValidateDataDiskFilesystem(&store.DiskFilesystem{Type: "vfat", Label: "data"}), "not supported")
+	assert.ErrorContains(t, ValidateDataDiskFilesystem(&store.DiskFilesystem{Type: "ext4", Label: "my data"}), "must match")
+	assert.ErrorContains(t, ValidateDataDiskFilesystem(&store.DiskFilesystem{Type: "xfs", Label: "lima-longlabel"}), "must not be longer than 12")
+}
+
+func TestFormatDataDiskRaw(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 is not available")
+	}
+	dir := t.TempDir()
+	const size = 64 * 1024 * 1024
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, filenames.DataDisk), nil, 0o644))
+	formatted, err := FormatDataDisk(dir, "raw", size, &store.DiskFilesystem{Type: "ext4", Label: "lima-data"})
+	assert.NilError(t, err)
+	assert.Assert(t, formatted)
+
+	d, err := diskfs.Open(filepath.Join(dir, filenames.DataDisk), diskfs.WithOpenMode(diskfs.ReadOnly))
+	assert.NilError(t, err)
+	defer d.File.Close()
+	assert.Equal(t, d.Size, int64(size))
+	table, err := d.GetPartitionTable()
+	assert.NilError(t, err)
+	parts := table.(*gpt.Table).Partitions
+	assert.Equal(t, parts[0].Start, uint64(partitionStart))
+	assert.Equal(t, parts[0].Type, gpt.LinuxFilesystem)
+
+	// ext4 superblock magic at 1024+0x38 from the start of the partition
+	magic := make([]byte, 2)
+	_, err = d.File.ReadAt(magic, partitionStart*sectorSize+1024+0x38)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, magic, []byte{0x53, 0xef})
+}
@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -20,18 +21,22 @@ import (
 	"github.com/lima-vm/lima/pkg/networks/usernet"
 	"github.com/lima-vm/lima/pkg/osutil"
 
+	"al.essio.dev/pkg/shellescape"
 	"github.com/coreos/go-semver/semver"
 	"github.com/digitalocean/go-qemu/qmp"
 	"github.com/digitalocean/go-qemu/qmp/raw"
 	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/fileutils"
+	"github.com/lima-vm/lima/pkg/imagestore"
 	"github.com/lima-vm/lima/pkg/iso9660util"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/qemu/imgutil"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/vfio"
 	"github.com/mattn/go-shellwords"
 	"github.com/sirupsen/logrus"
 )
@@ -50,20 +55,21 @@ const (
 
 // EnsureDisk also ensures the kernel and the initrd.
 func EnsureDisk(ctx context.Context, cfg Config) error {
-	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	storageDir := store.StorageDir(cfg.InstanceDir, cfg.LimaYAML)
+	diffDisk := filepath.Join(storageDir, filenames.DiffDisk)
 	if _, err := os.Stat(diffDisk); err == nil || !errors.Is(err, os.ErrNotExist) {
 		// disk is already ensured
 		return err
 	}
 
-	baseDisk := filepath.Join(cfg.InstanceDir, filenames.BaseDisk)
+	baseDisk := filepath.Join(storageDir, filenames.BaseDisk)
 	kernel := filepath.Join(cfg.InstanceDir, filenames.Kernel)
 	kernelCmdline := filepath.Join(cfg.InstanceDir, filenames.KernelCmdline)
 	initrd := filepath.Join(cfg.InstanceDir, filenames.Initrd)
 	if _, err := os.Stat(baseDisk); errors.Is(err, os.ErrNotExist) {
 		var ensuredBaseDisk bool
 		errs := make([]error, len(cfg.LimaYAML.Images))
-		for i, f := range cfg.LimaYAML.Images {
+		for i, f := range fileutils.ImagesByMirrorScore(cfg.LimaYAML.Images) {
 			if _, err := fileutils.DownloadFile(ctx, baseDisk, f.File, true, "the image", *cfg.LimaYAML.Arch); err != nil {
 				errs[i] = err
 				continue
@@ -92,6 +98,11 @@ func EnsureDisk(ctx context.Context, cfg Config) error {
 		if !ensuredBaseDisk {
 			return fileutils.Errors(errs)
 		}
+		if imagestore.Enabled() {
+			if err := imagestore.Dedup(baseDisk); err != nil {
+				logrus.WithError(err).Warn("Failed to share the base disk with the image store")
+			}
+		}
 	}
 	diskSize, _ := units.RAMInBytes(*cfg.LimaYAML.Disk)
 	if diskSize == 0 {
@@ -149,6 +160,326 @@ func ResizeDataDisk(dir, format string, size int) error {
 	return nil
 }
 
+// ResizeDisk grows the diffdisk of the instance.
+func ResizeDisk(cfg Config, size int64) error {
+	diffDisk := filepath.Join(store.StorageDir(cfg.InstanceDir, cfg.LimaYAML), filenames.DiffDisk)
+	if _, err := os.Stat(diffDisk); errors.Is(err, os.ErrNotExist) {
+		// the disk will be created with the new size on the first start
+		return nil
+	}
+	diffDiskInfo, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return fmt.Errorf("failed to get the information of disk %q: %w", diffDisk, err)
+	}
+	if size < diffDiskInfo.VSize {
+		return fmt.Errorf("specified size %q is less than the current disk size %q. Disk shrinking is currently unavailable",
+			units.BytesSize(float64(size)), units.BytesSize(float64(diffDiskInfo.VSize)))
+	}
+	if size == diffDiskInfo.VSize {
+		return nil
+	}
+	args := []string{"resize", "-f", diffDiskInfo.Format, diffDisk, strconv.FormatInt(size, 10)}
+	cmd := exec.Command("qemu-img", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+	}
+	return nil
+}
+
+// DumpGuestMemory writes the memory of the running guest to path in the kdump-compressed format,
+// which can be analyzed with crash(8). The command blocks until the dump is complete.
+func DumpGuestMemory(cfg Config, path string) error {
+	qmpClient, err := newQmpClient(cfg)
+	if err != nil {
+		return err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return err
+	}
+	defer func() { _ = qmpClient.Disconnect() }()
+	rawClient := raw.NewMonitor(qmpClient)
+	logrus.Infof("Dumping the guest memory to %q", path)
+	format := raw.DumpGuestMemoryFormatKdumpZlib
+	return rawClient.DumpGuestMemory(false, "file:"+path, nil, nil, nil, &format)
+}
+
+// Pause stops the vCPUs with the QMP `stop` command.
+func Pause(cfg Config) error {
+	qmpClient, err := newQmpClient(cfg)
+	if err != nil {
+		return err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return err
+	}
+	defer func() { _ = qmpClient.Disconnect() }()
+	rawClient := raw.NewMonitor(qmpClient)
+	return rawClient.Stop()
+}
+
+// Resume resumes the vCPUs stopped by Pause, with the QMP `cont` command.
+func Resume(cfg Config) error {
+	qmpClient, err := newQmpClient(cfg)
+	if err != nil {
+		return err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return err
+	}
+	defer func() { _ = qmpClient.Disconnect() }()
+	rawClient := raw.NewMonitor(qmpClient)
+	return rawClient.Cont()
+}
+
+// stateMigrationURI returns the URI of the QMP `migrate` command (incoming=false) or the `-incoming` option (incoming=true)
+// for the state file at path. The "file:" URI requires QEMU 8.2; the older versions pipe the state through cat(1).
+// The "file:" URI cannot be used for a path that contains a comma, which would be parsed as an option.
+func stateMigrationURI(version *semver.Version, path string, incoming bool) string {
+	if !version.LessThan(*semver.New("8.2.0")) && !strings.Contains(path, ",") {
+		return "file:" + path
+	}
+	if incoming {
+		return "exec:cat " + shellescape.Quote(path)
+	}
+	return "exec:cat > " + shellescape.Quote(path)
+}
+
+// waitMigration polls the status of the migration with the QMP `query-migrate` command until the migration completes.
+// exited receives the result of the QEMU process, if not nil.
+func waitMigration(ctx context.Context, qmpClient *qmp.SocketMonitor, exited <-chan error) error {
+	for {
+		// raw.QueryMigrate is not used, as it fails to decode the statuses added in the newer versions of QEMU
+		b, err := qmpClient.Run([]byte(`{"execute":"query-migrate"}`))
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Return struct {
+				Status    string `json:"status"`
+				ErrorDesc string `json:"error-desc"`
+			} `json:"return"`
+		}
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return fmt.Errorf("failed to parse the response of query-migrate %q: %w", string(b), err)
+		}
+		switch resp.Return.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("migration %s: %s", resp.Return.Status, resp.Return.ErrorDesc)
+		}
+		logrus.Debugf("migration status: %q", resp.Return.Status)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-exited:
+			return fmt.Errorf("QEMU exited during the migration: %w", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// SaveState stops the vCPUs, saves the state of the VM to path with the QMP `migrate` command,
+// and terminates QEMU with the QMP `quit` command.
+// The state is written to a temporary file first, so path exists only when the state has been saved completely.
+// On failure, the vCPUs are resumed.
+func SaveState(ctx context.Context, cfg Config, path string) error {
+	exe, _, err := Exe(*cfg.LimaYAML.Arch)
+	if err != nil {
+		return err
+	}
+	version, err := Version(exe)
+	if err != nil {
+		return err
+	}
+	qmpClient, err := newQmpClient(cfg)
+	if err != nil {
+		return err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return err
+	}
+	defer func() { _ = qmpClient.Disconnect() }()
+	rawClient := raw.NewMonitor(qmpClient)
+	if err := rawClient.Stop(); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	logrus.Infof("Saving the VM state to %q", path)
+	err = rawClient.Migrate(stateMigrationURI(version, tmp, false), nil, nil, nil)
+	if err == nil {
+		err = waitMigration(ctx, qmpClient, nil)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return errors.Join(fmt.Errorf("failed to save the VM state: %w", err), rawClient.Cont())
+	}
+	logrus.Info("Sending QMP quit command")
+	if err := rawClient.Quit(); err != nil {
+		_ = os.Remove(path)
+		return errors.Join(err, rawClient.Cont())
+	}
+	return nil
+}
+
+// RestoreState waits for QEMU started with the `-incoming` option to load the state of the VM, and resumes the vCPUs.
+// exited receives the result of the QEMU process.
+func RestoreState(ctx context.Context, cfg Config, exited <-chan error) error {
+	qmpSock := filepath.Join(cfg.InstanceDir, filenames.QMPSock)
+	if err := waitFileExists(qmpSock, 30*time.Second); err != nil {
+		return err
+	}
+	qmpClient, err := newQmpClient(cfg)
+	if err != nil {
+		return err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return err
+	}
+	defer func() { _ = qmpClient.Disconnect() }()
+	if err := waitMigration(ctx, qmpClient, exited); err != nil {
+		return fmt.Errorf("failed to restore the VM state: %w", err)
+	}
+	rawClient := raw.NewMonitor(qmpClient)
+	return rawClient.Cont()
+}
+
+// snapshotJobID is the ID of the block job of SnapshotDisk.
+const snapshotJobID = "lima-snapshot"
+
+// SnapshotDisk starts the QMP `drive-backup` job that writes a point-in-time copy of the disk to dst.
+// Only the top layer of the disk is copied; dst is backed by the same base disk as the disk.
+// The returned wait function blocks until the job has been completed, while the VM keeps running.
+func SnapshotDisk(ctx context.Context, cfg Config, dst string) (func() error, error) {
+	diffDisk := filepath.Join(store.StorageDir(cfg.InstanceDir, cfg.LimaYAML), filenames.DiffDisk)
+	qmpClient, err := newQmpClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := qmpClient.Connect(); err != nil {
+		return nil, err
+	}
+	device, format, err := queryBlockDevice(qmpClient, diffDisk)
+	if err != nil {
+		_ = qmpClient.Disconnect()
+		return nil, err
+	}
+	cmd := map[string]any{
+		"execute": "drive-backup",
+		"arguments": map[string]any{
+			"job-id": snapshotJobID,
+			"device": device,
+			"target": dst,
+			"format": format,
+			"sync":   "top",
+			"mode":   "absolute-paths",
+			// Dismissed after reading the result in waitBlockJob
+			"auto-dismiss": false,
+		},
+	}
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		_ = qmpClient.Disconnect()
+		return nil, err
+	}
+	logrus.Infof("Snapshotting the disk %q (%s) to %q", device, format, dst)
+	if _, err := qmpClient.Run(b); err != nil {
+		_ = qmpClient.Disconnect()
+		return nil, fmt.Errorf("failed to start drive-backup: %w", err)
+	}
+	wait := func() error {
+		defer func() { _ = qmpClient.Disconnect() }()
+		return waitBlockJob(ctx, qmpClient, snapshotJobID)
+	}
+	return wait, nil
+}
+
+// queryBlockDevice returns the name and the format of the block device backed by file.
+func queryBlockDevice(qmpClient *qmp.SocketMonitor, file string) (device, format string, err error) {
+	b, err := qmpClient.Run([]byte(`{"execute":"query-block"}`))
+	if err != nil {
+		return "", "", err
+	}
+	var resp struct {
+		Return []struct {
+			Device   string `json:"device"`
+			Inserted *struct {
+				File string `json:"file"`
+				Drv  string `json:"drv"`
+			} `json:"inserted"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return "", "", fmt.Errorf("failed to parse the response of query-block %q: %w", string(b), err)
+	}
+	for _, blk := range resp.Return {
+		if blk.Inserted != nil && blk.Inserted.File == file {
+			return blk.Device, blk.Inserted.Drv, nil
+		}
+	}
+	return "", "", fmt.Errorf("block device of %q not found", file)
+}
+
+// qmpJob is an element of the response of the QMP `query-jobs` command.
+type qmpJob struct {
+	ID              string `json:"id"`
+	Status          string `json:"status"`
+	CurrentProgress int64  `json:"current-progress"`
+	TotalProgress   int64  `json:"total-progress"`
+	Error           string `json:"error"`
+}
+
+// waitBlockJob waits for the job to conclude, and dismisses it.
+// The job is cancelled when ctx is cancelled.
+func waitBlockJob(ctx context.Context, qmpClient *qmp.SocketMonitor, id string) error {
+	var cancelled bool
+	for {
+		b, err := qmpClient.Run([]byte(`{"execute":"query-jobs"}`))
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Return []qmpJob `json:"return"`
+		}
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return fmt.Errorf("failed to parse the response of query-jobs %q: %w", string(b), err)
+		}
+		idx := slices.IndexFunc(resp.Return, func(j qmpJob) bool { return j.ID == id })
+		if idx < 0 {
+			return fmt.Errorf("job %q not found", id)
+		}
+		job := resp.Return[idx]
+		if job.Status == "concluded" {
+			if _, err := qmpClient.Run([]byte(fmt.Sprintf(`{"execute":"job-dismiss","arguments":{"id":%q}}`, id))); err != nil {
+				logrus.WithError(err).Warnf("failed to dismiss job %q", id)
+			}
+			if cancelled {
+				return ctx.Err()
+			}
+			if job.Error != "" {
+				return fmt.Errorf("job %q failed: %s", id, job.Error)
+			}
+			return nil
+		}
+		logrus.Debugf("job %q: status %q, progress %d/%d", id, job.Status, job.CurrentProgress, job.TotalProgress)
+		select {
+		case <-ctx.Done():
+			if !cancelled {
+				// Keep polling until the job concludes, so that it can be dismissed
+				if _, err := qmpClient.Run([]byte(fmt.Sprintf(`{"execute":"job-cancel","arguments":{"id":%q}}`, id))); err != nil {
+					return errors.Join(ctx.Err(), err)
+				}
+				cancelled = true
+			}
+			time.Sleep(100 * time.Millisecond)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
 func newQmpClient(cfg Config) (*qmp.SocketMonitor, error) {
 	qmpSock := filepath.Join(cfg.InstanceDir, filenames.QMPSock)
 	qmpClient, err := qmp.NewSocketMonitor("unix", qmpSock, 5*time.Second)
@@ -174,7 +505,7 @@ func sendHmpCommand(cfg Config, cmd, tag string) (string, error) {
 }
 
 func execImgCommand(cfg Config, args ...string) (string, error) {
-	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	diffDisk := filepath.Join(store.StorageDir(cfg.InstanceDir, cfg.LimaYAML), filenames.DiffDisk)
 	args = append(args, diffDisk)
 	logrus.Debugf("Running qemu-img %v command", args)
 	cmd := exec.Command("qemu-img", args...)
@@ -373,6 +704,80 @@ func inspectFeatures(exe, machine string) (*features, error) {
 	return &f, nil
 }
 
+// glDisplay returns the display with OpenGL enabled, for `video.accel`.
+func glDisplay(display string) string {
+	name, _, _ := strings.Cut(display, ",")
+	switch {
+	case name == "none":
+		// render off-screen, e.g., for Vulkan compute workloads
+		return "egl-headless"
+	case name == "egl-headless", strings.Contains(display, "gl="):
+		return display
+	case name == "default":
+		// "default" does not accept "gl=on"
+		return "gtk,gl=on"
+	case name == "cocoa":
+		// cocoa supports only OpenGL ES, via ANGLE
+		return display + ",gl=es"
+	default:
+		return display + ",gl=on"
+	}
+}
+
+// angleDylibs are the libraries needed by `-display cocoa,gl=es`: libepoxy, and ANGLE that implements OpenGL ES over Metal.
+var angleDylibs = []string{"libepoxy.0.dylib", "libEGL.dylib", "libGLESv2.dylib"}
+
+// acceleratedDefaultDisplay returns the display for `video.display: default-accelerated`.
+// On macOS, "cocoa,gl=es" is returned when the libraries of angleDylibs are found next to QEMU,
+// or in the search path of dlopen(3).
+func acceleratedDefaultDisplay(exe string) (string, error) {
+	if runtime.GOOS != "darwin" {
+		return glDisplay("default"), nil
+	}
+	dirs := dylibDirs(exe, os.Getenv("DYLD_FALLBACK_LIBRARY_PATH"), os.Getenv("HOME"))
+	if missing := missingDylibs(dirs, angleDylibs); len(missing) > 0 {
+		return "", fmt.Errorf("%v not found in %v; `-display cocoa,gl=es` needs QEMU built with libepoxy, and ANGLE", missing, dirs)
+	}
+	return glDisplay("cocoa"), nil
+}
+
+// dylibDirs returns the "lib" directory next to the "bin" directory of exe, and the fallback search path of dlopen(3).
+func dylibDirs(exe, fallbackPath, home string) []string {
+	dirs := []string{filepath.Join(filepath.Dir(exe), "..", "lib")}
+	if fallbackPath != "" {
+		return append(dirs, filepath.SplitList(fallbackPath)...)
+	}
+	return append(dirs, filepath.Join(home, "lib"), "/usr/local/lib", "/usr/lib")
+}
+
+// missingDylibs returns the names that are not found in any of the dirs.
+func missingDylibs(dirs, names []string) []string {
+	var missing []string
+	for _, name := range names {
+		found := slices.ContainsFunc(dirs, func(dir string) bool {
+			_, err := os.Stat(filepath.Join(dir, name))
+			return err == nil
+		})
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// accelGPUDevice returns the virtio-gpu device with virgl (OpenGL) acceleration, and with Venus (Vulkan) when venus is true.
+func accelGPUDevice(arch limayaml.Arch, venus bool) string {
+	dev := "virtio-gpu-gl-pci"
+	switch arch {
+	case limayaml.X8664, limayaml.RISCV64:
+		dev = "virtio-vga-gl"
+	}
+	if venus {
+		dev += ",blob=true,hostmem=4G,venus=true"
+	}
+	return dev
+}
+
 // showDarwinARM64HVFQEMU620Warning shows a warning on M1 macOS when QEMU is older than 6.2.0_1.
 //
 // See:
@@ -476,6 +881,12 @@ func audioDevice() string {
 	return "oss"
 }
 
+// needsInProcessUsernet returns true if eth0 has to be provided by an in-process gvisor-tap-vsock
+// instead of the built-in user-mode network of QEMU.
+func needsInProcessUsernet(y *limayaml.LimaYAML) bool {
+	return y.EgressPolicy != nil || (y.MetadataService.Enabled != nil && *y.MetadataService.Enabled)
+}
+
 func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err error) {
 	y := cfg.LimaYAML
 	exe, args, err = Exe(*y.Arch)
@@ -488,21 +899,44 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		return "", nil, err
 	}
 
-	version, err := getQemuVersion(exe)
+	version, err := Version(exe)
 	if err != nil {
 		logrus.WithError(err).Warning("Failed to detect QEMU version")
 	} else {
 		logrus.Debugf("QEMU version %s detected", version.String())
-		if version.LessThan(*semver.New(MinimumQemuVersion)) {
-			logrus.Fatalf("QEMU %v is too old, %v or later required", version, MinimumQemuVersion)
+		if err := CheckVersion(version); err != nil {
+			logrus.Fatal(err)
 		}
 		if y.VMOpts.QEMU.MinimumVersion != nil && version.LessThan(*semver.New(*y.VMOpts.QEMU.MinimumVersion)) {
 			logrus.Fatalf("QEMU %v is too old, template requires %q or later", version, *y.VMOpts.QEMU.MinimumVersion)
 		}
-		if runtime.GOOS == "darwin" && runtime.GOARCH == "arm64" && version.Equal(*semver.New("8.2.0")) {
-			logrus.Fatal("QEMU 8.2.0 is no longer supported on ARM Mac due to <https://gitlab.com/qemu-project/qemu/-/issues/1990>. " +
-				"Please upgrade QEMU to v8.2.1 (or downgrade to v8.1.x).")
+	}
+
+	// 3D acceleration of the virtio-gpu device: virgl (OpenGL), and Venus (Vulkan) when available
+	videoAccel := *y.Video.Accel
+	display := *y.Video.Display
+	if display == limayaml.DisplayDefaultAccelerated {
+		display = "default"
+		if videoAccel {
+			if accelDisplay, accelErr := acceleratedDefaultDisplay(exe); accelErr != nil {
+				logrus.WithError(accelErr).Warn("Falling back to the software-rendered default display")
+				videoAccel = false
+			} else {
+				display = accelDisplay
+			}
+		}
+	}
+	var venus bool
+	// err is the error of Version
+	if videoAccel && err == nil {
+		if version.LessThan(*semver.New("6.1.0")) {
+			return "", nil, fmt.Errorf("`video.accel` requires QEMU 6.1.0 or later, got %v", version)
 		}
+		// Venus needs the memfd-backed blob resources of the Linux hosts
+		venus = runtime.GOOS == "linux" && !version.LessThan(*semver.New("9.2.0"))
+	}
+	if videoAccel && !venus {
+		logrus.Info("Venus (Vulkan) acceleration requires QEMU 9.2.0 or later on a Linux host; enabling virgl (OpenGL) acceleration only")
 	}
 
 	// Architecture
@@ -520,10 +954,11 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	memBytes = adjustMemBytesDarwinARM64HVF(memBytes, accel, features)
 	args = appendArgsIfNoConflict(args, "-m", strconv.Itoa(int(memBytes>>20)))
 
-	if *y.MountType == limayaml.VIRTIOFS {
+	// The guest memory has to be shared with virtiofsd, and with virglrenderer for the blob resources of Venus
+	if *y.MountType == limayaml.VIRTIOFS || venus {
 		args = appendArgsIfNoConflict(args, "-object",
-			fmt.Sprintf("memory-backend-file,id=virtiofs-shm,size=%s,mem-path=/dev/shm,share=on", strconv.Itoa(int(memBytes))))
-		args = appendArgsIfNoConflict(args, "-numa", "node,memdev=virtiofs-shm")
+			fmt.Sprintf("memory-backend-file,id=shm,size=%s,mem-path=/dev/shm,share=on", strconv.Itoa(int(memBytes))))
+		args = appendArgsIfNoConflict(args, "-numa", "node,memdev=shm")
 	}
 
 	// CPU
@@ -555,11 +990,18 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 			// This will disable CPU S3/S4 state.
 			args = append(args, "-global", "ICH9-LPC.disable_s3=1")
 			args = append(args, "-global", "ICH9-LPC.disable_s4=1")
-		} else if runtime.GOOS == "windows" && accel == "whpx" {
-			// whpx: injection failed, MSI (0, 0) delivery: 0, dest_mode: 0, trigger mode: 0, vector: 0
-			args = appendArgsIfNoConflict(args, "-machine", "q35,accel="+accel+",kernel-irqchip=off")
 		} else {
-			args = appendArgsIfNoConflict(args, "-machine", "q35,accel="+accel)
+			machine := "q35,accel=" + accel
+			if runtime.GOOS == "windows" && accel == "whpx" {
+				// whpx: injection failed, MSI (0, 0) delivery: 0, dest_mode: 0, trigger mode: 0, vector: 0
+				machine += ",kernel-irqchip=off"
+			}
+			if *y.PowerSaving.Mode != limayaml.PowerSavingNever && features.VersionGEQ7 {
+				// Reduce the wakeups of the idle host by leaving the guest to the kvm-clock (or hv) timers.
+				// The guest no longer falls back to HPET, which is emulated in the user space and wakes up the host frequently.
+				machine += ",hpet=off"
+			}
+			args = appendArgsIfNoConflict(args, "-machine", machine)
 		}
 	case limayaml.AARCH64:
 		machine := "virt,accel=" + accel
@@ -580,18 +1022,26 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		// > yourself.
 		machine := "virt,acpi=off,accel=" + accel
 		args = appendArgsIfNoConflict(args, "-machine", machine)
-	case limayaml.ARMV7L:
+	case limayaml.ARMV6L, limayaml.ARMV7L:
+		// The "raspi0" and "raspi1ap" machines of ARMv6 cannot be used, as they lack PCI (hence virtio-pci).
+		machine := "virt,accel=" + accel
+		args = appendArgsIfNoConflict(args, "-machine", machine)
+	case limayaml.LOONGARCH64:
 		machine := "virt,accel=" + accel
 		args = appendArgsIfNoConflict(args, "-machine", machine)
 	}
 
 	// SMP
-	args = appendArgsIfNoConflict(args, "-smp",
-		fmt.Sprintf("%d,sockets=1,cores=%d,threads=1", *y.CPUs, *y.CPUs))
+	smp := fmt.Sprintf("%d,sockets=1,cores=%d,threads=1", *y.CPUs, *y.CPUs)
+	if maxCPUs := hotplugMaxCPUs(y); maxCPUs > *y.CPUs {
+		// the CPUs are hot-plugged in the unit of cores
+		smp = fmt.Sprintf("%d,maxcpus=%d,sockets=1,cores=%d,threads=1", *y.CPUs, maxCPUs, maxCPUs)
+	}
+	args = appendArgsIfNoConflict(args, "-smp", smp)
 
 	// Firmware
 	legacyBIOS := *y.Firmware.LegacyBIOS
-	if legacyBIOS && *y.Arch != limayaml.X8664 && *y.Arch != limayaml.ARMV7L {
+	if legacyBIOS && *y.Arch != limayaml.X8664 && *y.Arch != limayaml.ARMV6L && *y.Arch != limayaml.ARMV7L {
 		logrus.Warnf("field `firmware.legacyBIOS` is not supported for architecture %q, ignoring", *y.Arch)
 		legacyBIOS = false
 	}
@@ -619,7 +1069,7 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 			logrus.Infof("Using existing firmware (%q)", firmware)
 		}
 		if firmware == "" {
-			firmware, err = getFirmware(exe, *y.Arch)
+			firmware, err = Firmware(exe, *y.Arch)
 			if err != nil {
 				return "", nil, err
 			}
@@ -631,8 +1081,9 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	}
 
 	// Disk
-	baseDisk := filepath.Join(cfg.InstanceDir, filenames.BaseDisk)
-	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	storageDir := store.StorageDir(cfg.InstanceDir, y)
+	baseDisk := filepath.Join(storageDir, filenames.BaseDisk)
+	diffDisk := filepath.Join(storageDir, filenames.DiffDisk)
 	extraDisks := []string{}
 	for _, d := range y.AdditionalDisks {
 		diskName := d.Name
@@ -715,10 +1166,22 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	// Network
 	// Configure default usernetwork with limayaml.MACAddress(driver.Instance.Dir) for eth0 interface
 	firstUsernetIndex := limayaml.FirstUsernetIndex(y)
-	if firstUsernetIndex == -1 {
-		args = append(args, "-netdev", fmt.Sprintf("user,id=net0,net=%s,dhcpstart=%s,hostfwd=tcp:127.0.0.1:%d-:22",
-			networks.SlirpNetwork, networks.SlirpIPAddress, cfg.SSHLocalPort))
-	} else {
+	switch {
+	case firstUsernetIndex == -1 && needsInProcessUsernet(y):
+		// The in-process gvisor-tap-vsock started by the driver provides eth0
+		qemuSock, err := usernet.SockWithDirectory(cfg.InstanceDir, "", usernet.QEMUSock)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, "-netdev", fmt.Sprintf("socket,id=net0,fd={{ fd_connect %q }}", qemuSock))
+	case firstUsernetIndex == -1:
+		netdev := fmt.Sprintf("user,id=net0,net=%s,dhcpstart=%s,hostfwd=tcp:127.0.0.1:%d-:22",
+			networks.SlirpNetwork, networks.SlirpIPAddress, cfg.SSHLocalPort)
+		for _, domain := range y.DHCP.SearchDomains {
+			netdev += ",dnssearch=" + domain
+		}
+		args = append(args, "-netdev", netdev)
+	default:
 		qemuSock, err := usernet.Sock(y.Networks[firstUsernetIndex].Lima, usernet.QEMUSock)
 		if err != nil {
 			return "", nil, err
@@ -734,12 +1197,25 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 				return "", nil, err
 			}
 
-			// Handle usernet connections
+			isWireGuard, err := nwCfg.WireGuard(nw.Lima)
+			if err != nil {
+				return "", nil, err
+			}
+			if isWireGuard {
+				// The WireGuard interface runs in the guest over net0; see pkg/networks/wireguard
+				continue
+			}
+
+			// Handle usernet connections, including "switch" networks
 			isUsernet, err := nwCfg.Usernet(nw.Lima)
 			if err != nil {
 				return "", nil, err
 			}
-			if isUsernet {
+			isSwitch, err := nwCfg.Switch(nw.Lima)
+			if err != nil {
+				return "", nil, err
+			}
+			if isUsernet || isSwitch {
 				if i == firstUsernetIndex {
 					continue
 				}
@@ -748,7 +1224,6 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 					return "", nil, err
 				}
 				args = append(args, "-netdev", fmt.Sprintf("socket,id=net%d,fd={{ fd_connect %q }}", i+1, qemuSock))
-				args = append(args, "-device", fmt.Sprintf("virtio-net-pci,netdev=net%d,mac=%s", i+1, nw.MACAddress))
 			} else {
 				if runtime.GOOS != "darwin" {
 					return "", nil, fmt.Errorf("networks.yaml '%s' configuration is only supported on macOS right now", nw.Lima)
@@ -792,25 +1267,35 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		args = append(args, "-device", fmt.Sprintf("hda-output,audiodev=%s", id))
 	}
 	// Graphics
-	if *y.Video.Display != "" {
-		display := *y.Video.Display
+	if display != "" {
 		if display == "vnc" {
 			display += "=" + *y.Video.VNC.Display
 			display += ",password=on"
 			// use tablet to avoid double cursors
 			input = "tablet"
 		}
+		if videoAccel {
+			display = glDisplay(display)
+		}
 		args = appendArgsIfNoConflict(args, "-display", display)
 	}
 
 	switch *y.Arch {
 	case limayaml.X8664, limayaml.RISCV64:
-		args = append(args, "-device", "virtio-vga")
+		if videoAccel {
+			args = append(args, "-device", accelGPUDevice(*y.Arch, venus))
+		} else {
+			args = append(args, "-device", "virtio-vga")
+		}
 		args = append(args, "-device", "virtio-keyboard-pci")
 		args = append(args, "-device", "virtio-"+input+"-pci")
 		args = append(args, "-device", "qemu-xhci,id=usb-bus")
-	case limayaml.AARCH64, limayaml.ARMV7L:
-		if features.VersionGEQ7 {
+	case limayaml.AARCH64, limayaml.ARMV6L, limayaml.ARMV7L, limayaml.LOONGARCH64:
+		if videoAccel {
+			args = append(args, "-device", accelGPUDevice(*y.Arch, venus))
+			args = append(args, "-device", "virtio-keyboard-pci")
+			args = append(args, "-device", "virtio-"+input+"-pci")
+		} else if features.VersionGEQ7 {
 			args = append(args, "-device", "virtio-gpu")
 			args = append(args, "-device", "virtio-keyboard-pci")
 			args = append(args, "-device", "virtio-"+input+"-pci")
@@ -826,7 +1311,7 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	args = append(args, "-parallel", "none")
 
 	// Serial (default)
-	// This is ttyS0 for Intel and RISC-V, ttyAMA0 for ARM.
+	// This is ttyS0 for Intel, RISC-V, and LoongArch, ttyAMA0 for ARM.
 	serialSock := filepath.Join(cfg.InstanceDir, filenames.SerialSock)
 	if err := os.RemoveAll(serialSock); err != nil {
 		return "", nil, err
@@ -835,15 +1320,16 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 	if err := os.RemoveAll(serialLog); err != nil {
 		return "", nil, err
 	}
+	// The logs are opened with O_APPEND (logappend=on), so that the host agent can truncate them on rotation.
 	const serialChardev = "char-serial"
-	args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s", serialChardev, serialSock, serialLog))
+	args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s,logappend=on", serialChardev, serialSock, serialLog))
 	args = append(args, "-serial", "chardev:"+serialChardev)
 
 	// Serial (PCI, ARM only)
 	// On ARM, the default serial is ttyAMA0, this PCI serial is ttyS0.
 	// https://gitlab.com/qemu-project/qemu/-/issues/1801#note_1494720586
 	switch *y.Arch {
-	case limayaml.AARCH64, limayaml.ARMV7L:
+	case limayaml.AARCH64, limayaml.ARMV6L, limayaml.ARMV7L:
 		serialpSock := filepath.Join(cfg.InstanceDir, filenames.SerialPCISock)
 		if err := os.RemoveAll(serialpSock); err != nil {
 			return "", nil, err
@@ -853,7 +1339,7 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 			return "", nil, err
 		}
 		const serialpChardev = "char-serial-pci"
-		args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s", serialpChardev, serialpSock, serialpLog))
+		args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s,logappend=on", serialpChardev, serialpSock, serialpLog))
 		args = append(args, "-device", "pci-serial,chardev="+serialpChardev)
 	}
 
@@ -867,7 +1353,7 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		return "", nil, err
 	}
 	const serialvChardev = "char-serial-virtio"
-	args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s", serialvChardev, serialvSock, serialvLog))
+	args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s,logappend=on", serialvChardev, serialvSock, serialvLog))
 	// max_ports=1 is required for https://github.com/lima-vm/lima/issues/1689 https://github.com/lima-vm/lima/issues/1691
 	args = append(args, "-device", "virtio-serial-pci,id=virtio-serial0,max_ports=1")
 	args = append(args, "-device", fmt.Sprintf("virtconsole,chardev=%s,id=console0", serialvChardev))
@@ -876,7 +1362,7 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 
 	if *y.MountType == limayaml.NINEP || *y.MountType == limayaml.VIRTIOFS {
 		for i, f := range y.Mounts {
-			tag := fmt.Sprintf("mount%d", i)
+			tag := limayaml.MountTag(y, i)
 			location, err := localpathutil.Expand(f.Location)
 			if err != nil {
 				return "", nil, err
@@ -896,11 +1382,11 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 				}
 				args = append(args, "-virtfs", options)
 			case limayaml.VIRTIOFS:
-				// Note that read-only mode is not supported on the QEMU/virtiofsd side yet:
-				// https://gitlab.com/virtio-fs/virtiofsd/-/issues/97
+				// The read-only mode is enforced by virtiofsd (--readonly), see VirtiofsdCmdline
 				chardev := fmt.Sprintf("char-virtiofs-%d", i)
 				vhostSock := filepath.Join(cfg.InstanceDir, fmt.Sprintf(filenames.VhostSock, i))
-				args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s", chardev, vhostSock))
+				// virtiofsd is restarted by qemu_driver when it exits unexpectedly, so QEMU has to reconnect
+				args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,%s", chardev, vhostSock, vhostUserReconnect(version)))
 
 				options := "vhost-user-fs-pci"
 				options += fmt.Sprintf(",queue-size=%d", *f.Virtiofs.QueueSize)
@@ -911,6 +1397,51 @@ func Cmdline(ctx context.Context, cfg Config) (exe string, args []string, err er
 		}
 	}
 
+	// TPM
+	if *y.TPM {
+		const tpmChardev = "char-tpm"
+		swtpmSock := filepath.Join(cfg.InstanceDir, filenames.SwtpmSock)
+		args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s", tpmChardev, swtpmSock))
+		args = append(args, "-tpmdev", "emulator,id=tpm0,chardev="+tpmChardev)
+		switch *y.Arch {
+		case limayaml.X8664:
+			args = append(args, "-device", "tpm-tis,tpmdev=tpm0")
+		default:
+			// sysbus device for the "virt" machines
+			args = append(args, "-device", "tpm-tis-device,tpmdev=tpm0")
+		}
+	}
+
+	// PCI passthrough (VFIO)
+	pci, err := vfio.Addresses(y.Passthrough.PCI, y.Passthrough.GPU)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, addr := range pci {
+		args = append(args, "-device", fmt.Sprintf("vfio-pci,host=%s,id=hostpci%d", addr, i))
+	}
+
+	// Inter-VM shared memory
+	if len(y.SharedMemory) > 0 {
+		shmDir, err := dirnames.LimaSHMDir()
+		if err != nil {
+			return "", nil, err
+		}
+		if err := os.MkdirAll(shmDir, 0o700); err != nil {
+			return "", nil, err
+		}
+		for i, shm := range y.SharedMemory {
+			size, err := units.RAMInBytes(*shm.Size)
+			if err != nil {
+				return "", nil, err
+			}
+			// QEMU creates the file, or extends it to the size
+			args = append(args, "-object", fmt.Sprintf("memory-backend-file,id=ivshmem%d,mem-path=%s,size=%d,share=on",
+				i, filepath.Join(shmDir, shm.Name), size))
+			args = append(args, "-device", fmt.Sprintf("ivshmem-plain,memdev=ivshmem%d,id=ivshmem-%s", i, shm.Name))
+		}
+	}
+
 	// QMP
 	qmpSock := filepath.Join(cfg.InstanceDir, filenames.QMPSock)
 	if err := os.RemoveAll(qmpSock); err != nil {
@@ -1007,7 +1538,33 @@ func FindVirtiofsd(qemuExe string) (string, error) {
 	return "", errors.New("failed to locate virtiofsd")
 }
 
-func VirtiofsdCmdline(cfg Config, mountIndex int) ([]string, error) {
+// VirtiofsdFeatures is the set of the optional features of virtiofsd, as listed in `virtiofsd --help`.
+type VirtiofsdFeatures struct {
+	// ReadOnly is true if virtiofsd supports --readonly.
+	ReadOnly bool
+	// TranslateID is true if virtiofsd supports --translate-uid and --translate-gid.
+	TranslateID bool
+}
+
+// ProbeVirtiofsd returns the optional features supported by the virtiofsd binary.
+func ProbeVirtiofsd(exe string) (*VirtiofsdFeatures, error) {
+	out, err := exec.Command(exe, "--help").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s --help: %w: %s", exe, err, out)
+	}
+	return parseVirtiofsdHelp(string(out)), nil
+}
+
+func parseVirtiofsdHelp(help string) *VirtiofsdFeatures {
+	return &VirtiofsdFeatures{
+		ReadOnly:    strings.Contains(help, "--readonly"),
+		TranslateID: strings.Contains(help, "--translate-uid") && strings.Contains(help, "--translate-gid"),
+	}
+}
+
+// VirtiofsdCmdline returns the arguments of virtiofsd for the mount.
+// The read-only mode is only enforced in the guest when virtiofsd does not support --readonly.
+func VirtiofsdCmdline(cfg Config, mountIndex int, features *VirtiofsdFeatures) ([]string, error) {
 	mount := cfg.LimaYAML.Mounts[mountIndex]
 	location, err := localpathutil.Expand(mount.Location)
 	if err != nil {
@@ -1020,15 +1577,92 @@ func VirtiofsdCmdline(cfg Config, mountIndex int) ([]string, error) {
 		logrus.Warnf("Failed to remove old vhost socket: %v", err)
 	}
 
-	return []string{
+	args := []string{
 		"--socket-path", vhostSock,
 		"--shared-dir", location,
+	}
+	if mount.Virtiofs.Cache != nil {
+		args = append(args, "--cache", *mount.Virtiofs.Cache)
+	}
+	if mount.Virtiofs.Sandbox != nil {
+		args = append(args, "--sandbox", *mount.Virtiofs.Sandbox)
+	}
+	if mount.Virtiofs.ThreadPoolSize != nil {
+		args = append(args, "--thread-pool-size", strconv.Itoa(*mount.Virtiofs.ThreadPoolSize))
+	}
+	if mount.Virtiofs.RlimitNofile != nil {
+		args = append(args, "--rlimit-nofile", strconv.Itoa(*mount.Virtiofs.RlimitNofile))
+	}
+	if !*mount.Writable {
+		if features.ReadOnly {
+			args = append(args, "--readonly")
+		} else {
+			logrus.Warnf("virtiofsd does not support --readonly; %q is read-only only in the guest", location)
+		}
+	}
+	if idmap := mount.Virtiofs.IDMap; len(idmap.UID) > 0 || len(idmap.GID) > 0 {
+		if !features.TranslateID {
+			return nil, fmt.Errorf("virtiofsd does not support --translate-uid and --translate-gid, required by `mounts[%d].virtiofs.idmap`", mountIndex)
+		}
+		for _, m := range idmap.UID {
+			args = append(args, "--translate-uid", virtiofsdIDMapping(m))
+		}
+		for _, m := range idmap.GID {
+			args = append(args, "--translate-gid", virtiofsdIDMapping(m))
+		}
+	}
+	return args, nil
+}
+
+// vhostUserReconnect returns the chardev option for reconnecting to the restarted vhost-user backend.
+// QEMU 9.2 deprecated "reconnect" (in seconds) in favor of "reconnect-ms".
+func vhostUserReconnect(version *semver.Version) string {
+	if version != nil && !version.LessThan(*semver.New("9.2.0")) {
+		return "reconnect-ms=1000"
+	}
+	return "reconnect=1"
+}
+
+// virtiofsdIDMapping returns the bidirectional mapping "map:GUEST:HOST:COUNT".
+func virtiofsdIDMapping(m limayaml.IDMapping) string {
+	return fmt.Sprintf("map:%d:%d:%d", m.Guest, m.Host, m.Count)
+}
+
+// FindSwtpm returns the path of the swtpm binary.
+func FindSwtpm() (string, error) {
+	exe, err := exec.LookPath("swtpm")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate swtpm (required for `tpm: true`): %w", err)
+	}
+	return exe, nil
+}
+
+// SwtpmCmdline returns the arguments of swtpm for the TPM 2.0 device of the instance.
+// The TPM state is persisted under the instance directory.
+func SwtpmCmdline(cfg Config) ([]string, error) {
+	stateDir := filepath.Join(cfg.InstanceDir, filenames.SwtpmStateDir)
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return nil, err
+	}
+	swtpmSock := filepath.Join(cfg.InstanceDir, filenames.SwtpmSock)
+	// qemu_driver has to wait for the socket to appear, so make sure any old ones are removed here.
+	if err := os.Remove(swtpmSock); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logrus.Warnf("Failed to remove old swtpm socket: %v", err)
+	}
+	return []string{
+		"socket",
+		"--tpm2",
+		"--tpmstate", "dir=" + stateDir,
+		"--ctrl", "type=unixio,path=" + swtpmSock,
+		// exit when QEMU disconnects
+		"--terminate",
 	}, nil
 }
 
 // qemuArch returns the arch string used by qemu.
 func qemuArch(arch limayaml.Arch) string {
-	if arch == limayaml.ARMV7L {
+	switch arch {
+	case limayaml.ARMV6L, limayaml.ARMV7L:
 		return "arm"
 	}
 	return arch
@@ -1078,6 +1712,18 @@ func Accel(arch limayaml.Arch) string {
 	return "tcg"
 }
 
+// CheckVersion returns an error if the QEMU version is not supported on the host.
+func CheckVersion(version *semver.Version) error {
+	if version.LessThan(*semver.New(MinimumQemuVersion)) {
+		return fmt.Errorf("QEMU %v is too old, %v or later required", version, MinimumQemuVersion)
+	}
+	if runtime.GOOS == "darwin" && runtime.GOARCH == "arm64" && version.Equal(*semver.New("8.2.0")) {
+		return errors.New("QEMU 8.2.0 is no longer supported on ARM Mac due to <https://gitlab.com/qemu-project/qemu/-/issues/1990>. " +
+			"Please upgrade QEMU to v8.2.1 (or downgrade to v8.1.x)")
+	}
+	return nil
+}
+
 func parseQemuVersion(output string) (*semver.Version, error) {
 	lines := strings.Split(output, "\n")
 	regex := regexp.MustCompile(`^QEMU emulator version (\d+\.\d+\.\d+)`)
@@ -1088,7 +1734,8 @@ func parseQemuVersion(output string) (*semver.Version, error) {
 	return &semver.Version{}, fmt.Errorf("failed to parse %v", output)
 }
 
-func getQemuVersion(qemuExe string) (*semver.Version, error) {
+// Version returns the version of the QEMU binary.
+func Version(qemuExe string) (*semver.Version, error) {
 	var (
 		stdout bytes.Buffer
 		stderr bytes.Buffer
@@ -1103,9 +1750,11 @@ func getQemuVersion(qemuExe string) (*semver.Version, error) {
 	return parseQemuVersion(stdout.String())
 }
 
-func getFirmware(qemuExe string, arch limayaml.Arch) (string, error) {
+// Firmware returns the path of the EDK2 (UEFI) firmware for the arch, searched next to the QEMU binary,
+// and in the well-known paths of the distro packages.
+func Firmware(qemuExe string, arch limayaml.Arch) (string, error) {
 	switch arch {
-	case limayaml.X8664, limayaml.AARCH64, limayaml.ARMV7L, limayaml.RISCV64:
+	case limayaml.X8664, limayaml.AARCH64, limayaml.ARMV6L, limayaml.ARMV7L, limayaml.RISCV64, limayaml.LOONGARCH64:
 	default:
 		return "", fmt.Errorf("unexpected architecture: %q", arch)
 	}
@@ -1142,12 +1791,15 @@ func getFirmware(qemuExe string, arch limayaml.Arch) (string, error) {
 		candidates = append(candidates, "/usr/share/AAVMF/AAVMF_CODE.fd")
 		// Debian package "qemu-efi-aarch64" (unpadded, backwards compatibility)
 		candidates = append(candidates, "/usr/share/qemu-efi-aarch64/QEMU_EFI.fd")
-	case limayaml.ARMV7L:
+	case limayaml.ARMV6L, limayaml.ARMV7L:
 		// Debian package "qemu-efi-arm"
 		// Fedora package "edk2-arm"
 		candidates = append(candidates, "/usr/share/AAVMF/AAVMF32_CODE.fd")
 	case limayaml.RISCV64:
 		// NOP, as EDK2 for RISCV64 is not packaged yet in well-known distros.
+	case limayaml.LOONGARCH64:
+		// Debian package "qemu-efi-loongarch64"
+		candidates = append(candidates, "/usr/share/qemu-efi-loongarch64/QEMU_EFI.fd")
 	}
 
 	logrus.Debugf("firmware candidates = %v", candidates)
@@ -20,11 +20,15 @@ import (
 
 	"github.com/digitalocean/go-qemu/qmp"
 	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/networks/usernet"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/vfio"
+	"github.com/mdlayher/vsock"
 	"github.com/sirupsen/logrus"
 )
 
@@ -33,7 +37,14 @@ type LimaQemuDriver struct {
 	qCmd    *exec.Cmd
 	qWaitCh chan error
 
-	vhostCmds []*exec.Cmd
+	vhosts   []*virtiofsd
+	swtpmCmd *exec.Cmd
+
+	// inProcessUsernet is set when the driver runs its own gvisor-tap-vsock for `egressPolicy` or `metadataService`
+	inProcessUsernet *usernet.Client
+
+	// vsockCID is the guest CID of the vhost-vsock device, or 0 when the device is not attached
+	vsockCID uint32
 }
 
 func New(driver *driver.BaseDriver) *LimaQemuDriver {
@@ -73,25 +84,74 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 		LimaYAML:     l.Instance.Config,
 		SSHLocalPort: l.SSHLocalPort,
 	}
+	if needsInProcessUsernet(l.Instance.Config) {
+		if err := l.startUsernet(ctx); err != nil {
+			return nil, err
+		}
+	}
+	pci, err := vfio.Addresses(l.Instance.Config.Passthrough.PCI, l.Instance.Config.Passthrough.GPU)
+	if err != nil {
+		return nil, err
+	}
+	if len(pci) > 0 {
+		if err := vfio.Prepare(ctx, pci); err != nil {
+			return nil, err
+		}
+		if memBytes, err := units.RAMInBytes(*l.Instance.Config.Memory); err == nil {
+			if err := vfio.CheckMemlock(uint64(memBytes)); err != nil {
+				logrus.WithError(err).Warn("QEMU may fail to start with PCI passthrough")
+			}
+		}
+	}
 	qExe, qArgs, err := Cmdline(ctx, qCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	var vhostCmds []*exec.Cmd
+	var vhosts []*virtiofsd
 	if *l.Instance.Config.MountType == limayaml.VIRTIOFS {
 		vhostExe, err := FindVirtiofsd(qExe)
 		if err != nil {
 			return nil, err
 		}
+		vhostFeatures, err := ProbeVirtiofsd(vhostExe)
+		if err != nil {
+			return nil, err
+		}
 
 		for i := range l.Instance.Config.Mounts {
-			args, err := VirtiofsdCmdline(qCfg, i)
+			args, err := VirtiofsdCmdline(qCfg, i, vhostFeatures)
 			if err != nil {
 				return nil, err
 			}
 
-			vhostCmds = append(vhostCmds, exec.CommandContext(ctx, vhostExe, args...))
+			vhosts = append(vhosts, newVirtiofsd(l.Instance.Dir, i, vhostExe, args))
+		}
+	}
+
+	// The helper processes are killed when QEMU fails to start
+	qemuStarted := false
+	defer func() {
+		if qemuStarted {
+			return
+		}
+		if err := errors.Join(l.killVhosts(), l.killSwtpm()); err != nil {
+			logrus.WithError(err).Warn("Failed to clean up after the failure of starting QEMU")
+		}
+	}()
+
+	if *l.Instance.Config.TPM {
+		swtpmExe, err := FindSwtpm()
+		if err != nil {
+			return nil, err
+		}
+		args, err := SwtpmCmdline(qCfg)
+		if err != nil {
+			return nil, err
+		}
+		l.swtpmCmd = exec.CommandContext(ctx, swtpmExe, args...)
+		if err := l.startSwtpm(); err != nil {
+			return nil, err
 		}
 	}
 
@@ -104,6 +164,26 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 		}
 		qArgsFinal = append(qArgsFinal, applied)
 	}
+	var vhostVsock *os.File
+	if l.VSockPort != 0 {
+		var cid uint32
+		vhostVsock, cid, err = openVhostVsock(l.Instance.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %q: %w", "/dev/vhost-vsock", err)
+		}
+		defer vhostVsock.Close()
+		applier.files = append(applier.files, vhostVsock)
+		fd := len(applier.files) + 2 // the first FD is 3
+		qArgsFinal = append(qArgsFinal, "-device", fmt.Sprintf("vhost-vsock-pci,guest-cid=%d,vhostfd=%d", cid, fd))
+		l.vsockCID = cid
+	}
+	if l.RestoreState != "" {
+		version, err := Version(qExe)
+		if err != nil {
+			return nil, err
+		}
+		qArgsFinal = append(qArgsFinal, "-incoming", stateMigrationURI(version, l.RestoreState, true))
+	}
 	qCmd := exec.CommandContext(ctx, qExe, qArgsFinal...)
 	qCmd.ExtraFiles = append(qCmd.ExtraFiles, applier.files...)
 	qStdout, err := qCmd.StdoutPipe()
@@ -117,61 +197,11 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 	}
 	go logPipeRoutine(qStderr, "qemu[stderr]")
 
-	for i, vhostCmd := range vhostCmds {
-		vhostStdout, err := vhostCmd.StdoutPipe()
-		if err != nil {
-			return nil, err
-		}
-		go logPipeRoutine(vhostStdout, fmt.Sprintf("virtiofsd-%d[stdout]", i))
-		vhostStderr, err := vhostCmd.StderrPipe()
-		if err != nil {
-			return nil, err
-		}
-		go logPipeRoutine(vhostStderr, fmt.Sprintf("virtiofsd-%d[stderr]", i))
-	}
-
-	for i, vhostCmd := range vhostCmds {
-		logrus.Debugf("vhostCmd[%d].Args: %v", i, vhostCmd.Args)
-		if err := vhostCmd.Start(); err != nil {
+	for _, vhost := range vhosts {
+		if err := vhost.Start(ctx); err != nil {
 			return nil, err
 		}
-
-		vhostWaitCh := make(chan error)
-		go func() {
-			vhostWaitCh <- vhostCmd.Wait()
-		}()
-
-		vhostSock := filepath.Join(l.Instance.Dir, fmt.Sprintf(filenames.VhostSock, i))
-		vhostSockExists := false
-		for attempt := 0; attempt < 5; attempt++ {
-			logrus.Debugf("Try waiting for %s to appear (attempt %d)", vhostSock, attempt)
-
-			if _, err := os.Stat(vhostSock); err != nil {
-				if !errors.Is(err, fs.ErrNotExist) {
-					logrus.Warnf("Failed to check for vhost socket: %v", err)
-				}
-			} else {
-				vhostSockExists = true
-				break
-			}
-
-			retry := time.NewTimer(200 * time.Millisecond)
-			select {
-			case err = <-vhostWaitCh:
-				return nil, fmt.Errorf("virtiofsd never created vhost socket: %w", err)
-			case <-retry.C:
-			}
-		}
-
-		if !vhostSockExists {
-			return nil, fmt.Errorf("vhost socket %s never appeared", vhostSock)
-		}
-
-		go func() {
-			if err := <-vhostWaitCh; err != nil {
-				logrus.Errorf("Error from virtiofsd instance #%d: %v", i, err)
-			}
-		}()
+		l.vhosts = append(l.vhosts, vhost)
 	}
 
 	logrus.Infof("Starting QEMU (hint: to watch the boot progress, see %q)", filepath.Join(qCfg.InstanceDir, "serial*.log"))
@@ -179,15 +209,19 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 	if err := qCmd.Start(); err != nil {
 		return nil, err
 	}
+	qemuStarted = true
 	l.qCmd = qCmd
 	l.qWaitCh = make(chan error)
 	go func() {
 		l.qWaitCh <- qCmd.Wait()
 	}()
-	l.vhostCmds = vhostCmds
+	if l.RestoreState != "" {
+		if err := l.restoreState(ctx, qCfg); err != nil {
+			return nil, err
+		}
+	}
 	go func() {
-		if usernetIndex := limayaml.FirstUsernetIndex(l.Instance.Config); usernetIndex != -1 {
-			client := usernet.NewClientByName(l.Instance.Config.Networks[usernetIndex].Lima)
+		if client := l.usernetClient(); client != nil {
 			err := client.ConfigureDriver(ctx, l.BaseDriver)
 			if err != nil {
 				l.qWaitCh <- err
@@ -197,6 +231,99 @@ func (l *LimaQemuDriver) Start(ctx context.Context) (chan error, error) {
 	return l.qWaitCh, nil
 }
 
+// restoreState waits for QEMU to load the state saved by SaveState, and removes the state file.
+// The state file is removed on failure too, so that the next start boots the VM from scratch
+// rather than failing again.
+func (l *LimaQemuDriver) restoreState(ctx context.Context, qCfg Config) error {
+	path := l.RestoreState
+	l.RestoreState = ""
+	logrus.Infof("Restoring the VM state from %q", path)
+	err := RestoreState(ctx, qCfg, l.qWaitCh)
+	if rmErr := os.Remove(path); rmErr != nil {
+		logrus.WithError(rmErr).Warnf("Failed to remove the VM state %q", path)
+	}
+	if err != nil {
+		qCmd, qWaitCh := l.qCmd, l.qWaitCh
+		l.qCmd = nil
+		if qCmd.ProcessState == nil {
+			_ = qCmd.Process.Kill()
+			<-qWaitCh
+		}
+		_ = os.RemoveAll(filepath.Join(l.Instance.Dir, filenames.PIDFile(*l.Instance.Config.VMType)))
+		_ = l.killVhosts()
+		_ = l.killSwtpm()
+		return fmt.Errorf("%w; the VM state has been discarded, and the next start will boot the VM from scratch", err)
+	}
+	logrus.Info("Restored the VM state")
+	return nil
+}
+
+// startUsernet starts an in-process gvisor-tap-vsock, as the built-in user-mode network
+// of QEMU can neither enforce `egressPolicy` nor serve `metadataService`.
+func (l *LimaQemuDriver) startUsernet(ctx context.Context) error {
+	if firstUsernetIndex := limayaml.FirstUsernetIndex(l.Instance.Config); firstUsernetIndex != -1 {
+		field := "egressPolicy"
+		if l.Instance.Config.EgressPolicy == nil {
+			field = "metadataService"
+		}
+		return fmt.Errorf("field `%s` cannot be used with the shared network %q",
+			field, l.Instance.Config.Networks[firstUsernetIndex].Lima)
+	}
+	var metadata *usernet.Metadata
+	if *l.Instance.Config.MetadataService.Enabled {
+		metadata = usernet.NewMetadata(l.Instance.Dir)
+	}
+	endpointSock, err := usernet.SockWithDirectory(l.Instance.Dir, "", usernet.EndpointSock)
+	if err != nil {
+		return err
+	}
+	qemuSock, err := usernet.SockWithDirectory(l.Instance.Dir, "", usernet.QEMUSock)
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(endpointSock)
+	os.RemoveAll(qemuSock)
+	mtu := 1500
+	if *l.Instance.Config.DHCP.MTU != 0 {
+		mtu = *l.Instance.Config.DHCP.MTU
+	}
+	err = usernet.StartGVisorNetstack(ctx, &usernet.GVisorNetstackOpts{
+		MTU:        mtu,
+		Endpoint:   endpointSock,
+		QemuSocket: qemuSock,
+		Async:      true,
+		DefaultLeases: map[string]string{
+			networks.SlirpIPAddress: limayaml.MACAddress(l.Instance.Dir),
+		},
+		Subnet:        networks.SlirpNetwork,
+		IPv6Subnet:    networks.SlirpIPv6Network,
+		SearchDomains: l.Instance.Config.DHCP.SearchDomains,
+		EgressPolicy:  l.Instance.Config.EgressPolicy,
+		Metadata:      metadata,
+	})
+	if err != nil {
+		return err
+	}
+	subnetIP, _, err := net.ParseCIDR(networks.SlirpNetwork)
+	if err != nil {
+		return err
+	}
+	l.inProcessUsernet = usernet.NewClient(endpointSock, subnetIP)
+	return nil
+}
+
+// usernetClient returns the client of the gvisor-tap-vsock that provides eth0,
+// or nil if eth0 is provided by the built-in user-mode network of QEMU.
+func (l *LimaQemuDriver) usernetClient() *usernet.Client {
+	if l.inProcessUsernet != nil {
+		return l.inProcessUsernet
+	}
+	if usernetIndex := limayaml.FirstUsernetIndex(l.Instance.Config); usernetIndex != -1 {
+		return usernet.NewClientByName(l.Instance.Config.Networks[usernetIndex].Lima)
+	}
+	return nil
+}
+
 func (l *LimaQemuDriver) Stop(ctx context.Context) error {
 	return l.shutdownQEMU(ctx, 3*time.Minute, l.qCmd, l.qWaitCh)
 }
@@ -281,11 +408,73 @@ func (l *LimaQemuDriver) removeVNCFiles() error {
 	return nil
 }
 
+// startSwtpm starts l.swtpmCmd and waits for the control socket to appear.
+func (l *LimaQemuDriver) startSwtpm() error {
+	swtpmCmd := l.swtpmCmd
+	swtpmStdout, err := swtpmCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	go logPipeRoutine(swtpmStdout, "swtpm[stdout]")
+	swtpmStderr, err := swtpmCmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	go logPipeRoutine(swtpmStderr, "swtpm[stderr]")
+
+	logrus.Debugf("swtpmCmd.Args: %v", swtpmCmd.Args)
+	if err := swtpmCmd.Start(); err != nil {
+		return err
+	}
+	swtpmWaitCh := make(chan error)
+	go func() {
+		swtpmWaitCh <- swtpmCmd.Wait()
+	}()
+
+	swtpmSock := filepath.Join(l.Instance.Dir, filenames.SwtpmSock)
+	for attempt := 0; attempt < 10; attempt++ {
+		logrus.Debugf("Try waiting for %s to appear (attempt %d)", swtpmSock, attempt)
+		if _, err := os.Stat(swtpmSock); err == nil {
+			go func() {
+				if err := <-swtpmWaitCh; err != nil {
+					logrus.Errorf("Error from swtpm: %v", err)
+				}
+			}()
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			logrus.Warnf("Failed to check for swtpm socket: %v", err)
+		}
+		retry := time.NewTimer(200 * time.Millisecond)
+		select {
+		case err := <-swtpmWaitCh:
+			return fmt.Errorf("swtpm never created the socket: %w", err)
+		case <-retry.C:
+		}
+	}
+	_ = swtpmCmd.Process.Kill()
+	<-swtpmWaitCh
+	return fmt.Errorf("swtpm socket %s never appeared", swtpmSock)
+}
+
+func (l *LimaQemuDriver) killSwtpm() error {
+	if l.swtpmCmd == nil || l.swtpmCmd.Process == nil {
+		return nil
+	}
+	if err := l.swtpmCmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill swtpm: %w", err)
+	}
+	swtpmSock := filepath.Join(l.Instance.Dir, filenames.SwtpmSock)
+	if err := os.Remove(swtpmSock); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove the swtpm socket: %w", err)
+	}
+	return nil
+}
+
 func (l *LimaQemuDriver) killVhosts() error {
 	var errs []error
-	for i, vhost := range l.vhostCmds {
-		if err := vhost.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
-			errs = append(errs, fmt.Errorf("failed to kill virtiofsd instance #%d: %w", i, err))
+	for _, vhost := range l.vhosts {
+		if err := vhost.Stop(); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
@@ -295,8 +484,7 @@ func (l *LimaQemuDriver) killVhosts() error {
 func (l *LimaQemuDriver) shutdownQEMU(ctx context.Context, timeout time.Duration, qCmd *exec.Cmd, qWaitCh <-chan error) error {
 	// "power button" refers to ACPI on the most archs, except RISC-V
 	logrus.Info("Shutting down QEMU with the power button")
-	if usernetIndex := limayaml.FirstUsernetIndex(l.Instance.Config); usernetIndex != -1 {
-		client := usernet.NewClientByName(l.Instance.Config.Networks[usernetIndex].Lima)
+	if client := l.usernetClient(); client != nil {
 		err := client.UnExposeSSH(l.SSHLocalPort)
 		if err != nil {
 			logrus.Warnf("Failed to remove SSH binding for port %d", l.SSHLocalPort)
@@ -328,7 +516,7 @@ func (l *LimaQemuDriver) shutdownQEMU(ctx context.Context, timeout time.Duration
 		}
 		entry.Info("QEMU has exited")
 		_ = l.removeVNCFiles()
-		return errors.Join(qWaitErr, l.killVhosts())
+		return errors.Join(qWaitErr, l.killVhosts(), l.killSwtpm())
 	case <-deadline:
 	}
 	logrus.Warnf("QEMU did not exit in %v, forcibly killing QEMU", timeout)
@@ -349,7 +537,7 @@ func (l *LimaQemuDriver) killQEMU(_ context.Context, _ time.Duration, qCmd *exec
 	qemuPIDPath := filepath.Join(l.Instance.Dir, filenames.PIDFile(*l.Instance.Config.VMType))
 	_ = os.RemoveAll(qemuPIDPath)
 	_ = l.removeVNCFiles()
-	return errors.Join(qWaitErr, l.killVhosts())
+	return errors.Join(qWaitErr, l.killVhosts(), l.killSwtpm())
 }
 
 func logPipeRoutine(r io.Reader, header string) {
@@ -396,7 +584,74 @@ func (l *LimaQemuDriver) ListSnapshots(_ context.Context) (string, error) {
 	return List(qCfg, l.Instance.Status == store.StatusRunning)
 }
 
+func (l *LimaQemuDriver) ChangeCPUs(_ context.Context, cpus int) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Instance.Config,
+	}
+	return ChangeCPUs(qCfg, cpus)
+}
+
+func (l *LimaQemuDriver) ResizeDisk(_ context.Context, size int64) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Instance.Config,
+	}
+	return ResizeDisk(qCfg, size)
+}
+
+func (l *LimaQemuDriver) DumpGuestMemory(_ context.Context, path string) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Instance.Config,
+	}
+	return DumpGuestMemory(qCfg, path)
+}
+
+func (l *LimaQemuDriver) Pause(_ context.Context) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Instance.Config,
+	}
+	return Pause(qCfg)
+}
+
+func (l *LimaQemuDriver) Resume(_ context.Context) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Instance.Config,
+	}
+	return Resume(qCfg)
+}
+
+func (l *LimaQemuDriver) SaveState(ctx context.Context, path string) error {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Instance.Config,
+	}
+	// QEMU exits on `quit`, and the exit is handled as a stop of the driver
+	return SaveState(ctx, qCfg, path)
+}
+
+func (l *LimaQemuDriver) SnapshotDisk(ctx context.Context, dst string) (func() error, error) {
+	qCfg := Config{
+		Name:        l.Instance.Name,
+		InstanceDir: l.Instance.Dir,
+		LimaYAML:    l.Instance.Config,
+	}
+	return SnapshotDisk(ctx, qCfg, dst)
+}
+
 func (l *LimaQemuDriver) GuestAgentConn(ctx context.Context) (net.Conn, error) {
+	if l.vsockCID != 0 {
+		return vsock.Dial(l.vsockCID, uint32(l.VSockPort), nil)
+	}
 	var d net.Dialer
 	dialContext, err := d.DialContext(ctx, "unix", filepath.Join(l.Instance.Dir, filenames.GuestAgentSock))
 	return dialContext, err
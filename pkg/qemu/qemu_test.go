@@ -1,8 +1,13 @@
 package qemu
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/coreos/go-semver/semver"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/ptr"
 	"gotest.tools/v3/assert"
 )
 
@@ -86,3 +91,119 @@ func TestParseQemuVersion(t *testing.T) {
 		assert.Equal(t, tc.expectedValue, v.String())
 	}
 }
+
+func TestStateMigrationURI(t *testing.T) {
+	v82 := semver.New("8.2.0")
+	v81 := semver.New("8.1.5")
+	assert.Equal(t, stateMigrationURI(v82, "/tmp/lima/suspend.state", false), "file:/tmp/lima/suspend.state")
+	assert.Equal(t, stateMigrationURI(v82, "/tmp/lima/suspend.state", true), "file:/tmp/lima/suspend.state")
+	assert.Equal(t, stateMigrationURI(v81, "/tmp/lima/suspend.state", false), "exec:cat > /tmp/lima/suspend.state")
+	assert.Equal(t, stateMigrationURI(v81, "/tmp/lima/suspend.state", true), "exec:cat /tmp/lima/suspend.state")
+	// a comma would be parsed as an option of "file:"
+	assert.Equal(t, stateMigrationURI(v82, "/tmp/a,b/suspend.state", true), "exec:cat /tmp/a,b/suspend.state")
+	assert.Equal(t, stateMigrationURI(v81, "/tmp/it's/suspend.state", false), `exec:cat > '/tmp/it'"'"'s/suspend.state'`)
+}
+
+func TestGLDisplay(t *testing.T) {
+	assert.Equal(t, glDisplay("none"), "egl-headless")
+	assert.Equal(t, glDisplay("default"), "gtk,gl=on")
+	assert.Equal(t, glDisplay("gtk"), "gtk,gl=on")
+	assert.Equal(t, glDisplay("sdl,gl=es"), "sdl,gl=es")
+	assert.Equal(t, glDisplay("cocoa"), "cocoa,gl=es")
+	assert.Equal(t, glDisplay("egl-headless,rendernode=/dev/dri/renderD128"), "egl-headless,rendernode=/dev/dri/renderD128")
+}
+
+func TestDylibs(t *testing.T) {
+	assert.DeepEqual(t, dylibDirs("/opt/homebrew/bin/qemu-system-aarch64", "", "/Users/foo"),
+		[]string{"/opt/homebrew/lib", "/Users/foo/lib", "/usr/local/lib", "/usr/lib"})
+	assert.DeepEqual(t, dylibDirs("/opt/homebrew/bin/qemu-system-aarch64", "/opt/angle/lib:/opt/epoxy/lib", "/Users/foo"),
+		[]string{"/opt/homebrew/lib", "/opt/angle/lib", "/opt/epoxy/lib"})
+
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir1, "libepoxy.0.dylib"), nil, 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir2, "libEGL.dylib"), nil, 0o644))
+	assert.DeepEqual(t, missingDylibs([]string{dir1, dir2}, angleDylibs), []string{"libGLESv2.dylib"})
+	assert.NilError(t, os.WriteFile(filepath.Join(dir2, "libGLESv2.dylib"), nil, 0o644))
+	assert.Equal(t, len(missingDylibs([]string{dir1, dir2}, angleDylibs)), 0)
+}
+
+func TestAccelGPUDevice(t *testing.T) {
+	assert.Equal(t, accelGPUDevice(limayaml.X8664, false), "virtio-vga-gl")
+	assert.Equal(t, accelGPUDevice(limayaml.AARCH64, false), "virtio-gpu-gl-pci")
+	assert.Equal(t, accelGPUDevice(limayaml.AARCH64, true), "virtio-gpu-gl-pci,blob=true,hostmem=4G,venus=true")
+}
+
+func TestVirtiofsdCmdline(t *testing.T) {
+	instDir := t.TempDir()
+	location := t.TempDir()
+	cfg := Config{
+		InstanceDir: instDir,
+		LimaYAML: &limayaml.LimaYAML{
+			Mounts: []limayaml.Mount{
+				{
+					Location: location,
+					Writable: ptr.Of(false),
+					Virtiofs: limayaml.Virtiofs{
+						IDMap: limayaml.VirtiofsIDMap{
+							UID: []limayaml.IDMapping{{Guest: 1000, Host: 501, Count: 1}},
+							GID: []limayaml.IDMapping{{Guest: 1000, Host: 20, Count: 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+	help := parseVirtiofsdHelp(`Usage: virtiofsd [OPTIONS]
+      --readonly                   Tell the guest which directories are read-only
+      --translate-uid <TRANSLATE_UID>
+      --translate-gid <TRANSLATE_GID>
+`)
+	args, err := VirtiofsdCmdline(cfg, 0, help)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, args, []string{
+		"--socket-path", filepath.Join(instDir, "virtiofsd-0.sock"),
+		"--shared-dir", location,
+		"--readonly",
+		"--translate-uid", "map:1000:501:1",
+		"--translate-gid", "map:1000:20:1",
+	})
+
+	_, err = VirtiofsdCmdline(cfg, 0, parseVirtiofsdHelp("Usage: virtiofsd [OPTIONS]\n"))
+	assert.ErrorContains(t, err, "does not support --translate-uid")
+}
+
+func TestVirtiofsdCmdlineSandbox(t *testing.T) {
+	instDir := t.TempDir()
+	location := t.TempDir()
+	cfg := Config{
+		InstanceDir: instDir,
+		LimaYAML: &limayaml.LimaYAML{
+			Mounts: []limayaml.Mount{
+				{
+					Location: location,
+					Writable: ptr.Of(true),
+					Virtiofs: limayaml.Virtiofs{
+						Sandbox:        ptr.Of(limayaml.VirtiofsSandboxChroot),
+						ThreadPoolSize: ptr.Of(4),
+						RlimitNofile:   ptr.Of(4096),
+					},
+				},
+			},
+		},
+	}
+	args, err := VirtiofsdCmdline(cfg, 0, parseVirtiofsdHelp("Usage: virtiofsd [OPTIONS]\n"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, args, []string{
+		"--socket-path", filepath.Join(instDir, "virtiofsd-0.sock"),
+		"--shared-dir", location,
+		"--sandbox", "chroot",
+		"--thread-pool-size", "4",
+		"--rlimit-nofile", "4096",
+	})
+}
+
+func TestVhostUserReconnect(t *testing.T) {
+	assert.Equal(t, vhostUserReconnect(nil), "reconnect=1")
+	assert.Equal(t, vhostUserReconnect(semver.New("8.2.0")), "reconnect=1")
+	assert.Equal(t, vhostUserReconnect(semver.New("9.2.0")), "reconnect-ms=1000")
+}
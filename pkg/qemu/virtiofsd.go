@@ -0,0 +1,185 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// virtiofsdMaxRestarts is the maximum number of the consecutive restarts of a virtiofsd that keeps crashing.
+	virtiofsdMaxRestarts = 5
+	// virtiofsdStableDuration is the uptime after which a virtiofsd is no longer considered to be crashing.
+	virtiofsdStableDuration = time.Minute
+	virtiofsdRestartDelay   = time.Second
+)
+
+// virtiofsd is the virtiofsd process dedicated to a mount.
+// The process is restarted when it exits unexpectedly, and its PID is recorded in "virtiofsd-%d.pid"
+// so that the process can be killed even after the host agent crashed.
+type virtiofsd struct {
+	index   int
+	exe     string
+	args    []string
+	sock    string
+	pidFile string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stopped bool
+}
+
+func newVirtiofsd(instDir string, index int, exe string, args []string) *virtiofsd {
+	return &virtiofsd{
+		index:   index,
+		exe:     exe,
+		args:    args,
+		sock:    filepath.Join(instDir, fmt.Sprintf(filenames.VhostSock, index)),
+		pidFile: filepath.Join(instDir, fmt.Sprintf(filenames.VhostPID, index)),
+	}
+}
+
+// Start starts virtiofsd, and waits for the vhost-user socket to appear.
+func (v *virtiofsd) Start(ctx context.Context) error {
+	if err := killStaleVirtiofsd(v.pidFile); err != nil {
+		logrus.WithError(err).Warnf("Failed to kill the stale virtiofsd instance #%d", v.index)
+	}
+	waitCh, err := v.start(ctx)
+	if err != nil {
+		return err
+	}
+	go v.supervise(ctx, waitCh)
+	return nil
+}
+
+func (v *virtiofsd) start(ctx context.Context) (<-chan error, error) {
+	// The socket has to be removed, as start waits for the socket to appear
+	if err := os.Remove(v.sock); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logrus.Warnf("Failed to remove old vhost socket: %v", err)
+	}
+	cmd := exec.CommandContext(ctx, v.exe, v.args...)
+	setPdeathsig(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	go logPipeRoutine(stdout, fmt.Sprintf("virtiofsd-%d[stdout]", v.index))
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	go logPipeRoutine(stderr, fmt.Sprintf("virtiofsd-%d[stderr]", v.index))
+
+	logrus.Debugf("vhostCmd[%d].Args: %v", v.index, cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+	v.mu.Lock()
+	v.cmd = cmd
+	v.mu.Unlock()
+	if err := os.WriteFile(v.pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o644); err != nil {
+		logrus.WithError(err).Warnf("Failed to write %q", v.pidFile)
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		logrus.Debugf("Try waiting for %s to appear (attempt %d)", v.sock, attempt)
+		if _, err := os.Stat(v.sock); err == nil {
+			return waitCh, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			logrus.Warnf("Failed to check for vhost socket: %v", err)
+		}
+		retry := time.NewTimer(200 * time.Millisecond)
+		select {
+		case err := <-waitCh:
+			_ = os.Remove(v.pidFile)
+			return nil, fmt.Errorf("virtiofsd never created vhost socket: %w", err)
+		case <-retry.C:
+		}
+	}
+	_ = cmd.Process.Kill()
+	_ = os.Remove(v.pidFile)
+	return nil, fmt.Errorf("vhost socket %s never appeared", v.sock)
+}
+
+// supervise restarts virtiofsd when it exits unexpectedly, unless it keeps crashing.
+func (v *virtiofsd) supervise(ctx context.Context, waitCh <-chan error) {
+	restarts := 0
+	for {
+		started := time.Now()
+		err := <-waitCh
+		v.mu.Lock()
+		stopped := v.stopped
+		v.mu.Unlock()
+		if stopped || ctx.Err() != nil {
+			return
+		}
+		logrus.WithError(err).Errorf("virtiofsd instance #%d exited unexpectedly", v.index)
+		if time.Since(started) > virtiofsdStableDuration {
+			restarts = 0
+		}
+		if restarts >= virtiofsdMaxRestarts {
+			logrus.Errorf("virtiofsd instance #%d crashed %d times in a row, giving up restarting it", v.index, restarts+1)
+			_ = os.Remove(v.pidFile)
+			return
+		}
+		restarts++
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(virtiofsdRestartDelay):
+		}
+		logrus.Infof("Restarting virtiofsd instance #%d (attempt %d)", v.index, restarts)
+		waitCh, err = v.start(ctx)
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed to restart virtiofsd instance #%d", v.index)
+			return
+		}
+	}
+}
+
+// Stop kills virtiofsd, without restarting it.
+func (v *virtiofsd) Stop() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.stopped = true
+	defer os.Remove(v.pidFile)
+	if v.cmd == nil || v.cmd.Process == nil {
+		return nil
+	}
+	if err := v.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill virtiofsd instance #%d: %w", v.index, err)
+	}
+	return nil
+}
+
+// killStaleVirtiofsd kills the virtiofsd left behind by a host agent that crashed.
+func killStaleVirtiofsd(pidFile string) error {
+	pid, err := store.ReadPIDFile(pidFile)
+	if err != nil || pid == 0 {
+		return err
+	}
+	logrus.Infof("Killing the stale virtiofsd process %d", pid)
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := proc.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return os.Remove(pidFile)
+}
@@ -0,0 +1,13 @@
+package qemu
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setPdeathsig makes sure that virtiofsd does not outlive the host agent.
+func setPdeathsig(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package qemu
+
+import "os/exec"
+
+// setPdeathsig is a no-op, as virtiofsd is only supported on Linux hosts.
+func setPdeathsig(_ *exec.Cmd) {}
@@ -0,0 +1,81 @@
+package qemu
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strconv"
+	"unsafe"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	vhostVsockDevice = "/dev/vhost-vsock"
+	// vhostVsockSetGuestCID is VHOST_VSOCK_SET_GUEST_CID: _IOW(VHOST_VIRTIO, 0x60, __u64)
+	vhostVsockSetGuestCID = 0x4008AF60
+	// minGuestCID is the smallest CID that can be assigned to a guest (0-2 are reserved)
+	minGuestCID = 3
+	// guestCIDRange is the range of the CIDs to try, starting from the CID derived from the instance name
+	guestCIDRange = 1 << 20
+	// maxGuestCIDAttempts is the number of CIDs to try before giving up
+	maxGuestCIDAttempts = 64
+)
+
+// VhostVsockAvailable returns true if the guest agent can be connected via vhost-vsock
+// instead of the virtio port or the SSH forwarding.
+//
+// vhost-vsock is used only for the native architecture, as the device needs the KVM acceleration.
+// Set LIMA_QEMU_VSOCK=false to disable it.
+func VhostVsockAvailable(y *limayaml.LimaYAML) bool {
+	if s := os.Getenv("LIMA_QEMU_VSOCK"); s != "" {
+		enabled, err := strconv.ParseBool(s)
+		if err != nil {
+			logrus.WithError(err).Warnf("invalid LIMA_QEMU_VSOCK value %q", s)
+		} else if !enabled {
+			return false
+		}
+	}
+	if !limayaml.IsNativeArch(*y.Arch) {
+		return false
+	}
+	f, err := os.OpenFile(vhostVsockDevice, os.O_RDWR, 0)
+	if err != nil {
+		logrus.WithError(err).Debugf("vhost-vsock is not available")
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+// openVhostVsock opens /dev/vhost-vsock and assigns an unused guest CID to it.
+// The returned file has to be passed to QEMU as `vhostfd`; the CID is released when all the copies
+// of the file are closed.
+func openVhostVsock(instName string) (*os.File, uint32, error) {
+	f, err := os.OpenFile(vhostVsockDevice, os.O_RDWR, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Start from the CID derived from the instance name, so that the CID is stable across restarts
+	// unless it is already used by another VM.
+	base := crc32.ChecksumIEEE([]byte(instName)) % guestCIDRange
+	for i := uint32(0); i < maxGuestCIDAttempts; i++ {
+		cid := uint64(minGuestCID + (base+i)%guestCIDRange)
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), vhostVsockSetGuestCID, uintptr(unsafe.Pointer(&cid)))
+		switch {
+		case errno == 0:
+			return f, uint32(cid), nil
+		case errors.Is(errno, unix.EADDRINUSE):
+			logrus.Debugf("vsock CID %d is already in use", cid)
+			continue
+		default:
+			_ = f.Close()
+			return nil, 0, fmt.Errorf("failed to set the guest CID %d: %w", cid, errno)
+		}
+	}
+	_ = f.Close()
+	return nil, 0, fmt.Errorf("failed to find an unused vsock CID after %d attempts", maxGuestCIDAttempts)
+}
@@ -0,0 +1,22 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestVhostVsockAvailableDisabled(t *testing.T) {
+	t.Setenv("LIMA_QEMU_VSOCK", "false")
+	arch := limayaml.NewArch("")
+	assert.Assert(t, !VhostVsockAvailable(&limayaml.LimaYAML{Arch: &arch}))
+}
+
+func TestVhostVsockAvailableForeignArch(t *testing.T) {
+	arch := limayaml.RISCV64
+	if limayaml.IsNativeArch(arch) {
+		arch = limayaml.X8664
+	}
+	assert.Assert(t, !VhostVsockAvailable(&limayaml.LimaYAML{Arch: &arch}))
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package qemu
+
+import (
+	"errors"
+	"os"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// VhostVsockAvailable returns true if the guest agent can be connected via vhost-vsock.
+// vhost-vsock is only supported on Linux hosts.
+func VhostVsockAvailable(_ *limayaml.LimaYAML) bool {
+	return false
+}
+
+func openVhostVsock(_ string) (*os.File, uint32, error) {
+	return nil, 0, errors.New("vhost-vsock is only supported on Linux hosts")
+}
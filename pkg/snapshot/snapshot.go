@@ -2,34 +2,87 @@ package snapshot
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/driverutil"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/history"
 )
 
+// checkSupported returns an error if the driver of the instance does not advertise snapshot support.
+func checkSupported(inst *store.Instance) error {
+	if caps, ok := limayaml.LookupDriverCapabilities(inst.VMType); ok && !caps.Snapshot {
+		return fmt.Errorf("vmType %s does not support snapshots", inst.VMType)
+	}
+	return nil
+}
+
+// checkNotSuspended returns an error if the instance is suspended, as the saved state of the VM depends on the disk.
+func checkNotSuspended(inst *store.Instance) error {
+	if inst.Status == store.StatusSuspended {
+		return fmt.Errorf("instance %q is suspended (hint: run `limactl resume %s`, or `limactl stop %s` to discard the saved state)",
+			inst.Name, inst.Name, inst.Name)
+	}
+	return nil
+}
+
 func Del(ctx context.Context, inst *store.Instance, tag string) error {
+	if err := checkSupported(inst); err != nil {
+		return err
+	}
+	if err := checkNotSuspended(inst); err != nil {
+		return err
+	}
 	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
 		Instance: inst,
 	})
-	return limaDriver.DeleteSnapshot(ctx, tag)
+	if err := limaDriver.DeleteSnapshot(ctx, tag); err != nil {
+		return err
+	}
+	history.Record(inst.Dir, history.Entry{Event: history.EventSnapshot, Message: "delete " + tag})
+	return nil
 }
 
 func Save(ctx context.Context, inst *store.Instance, tag string) error {
+	if err := checkSupported(inst); err != nil {
+		return err
+	}
+	if err := checkNotSuspended(inst); err != nil {
+		return err
+	}
 	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
 		Instance: inst,
 	})
-	return limaDriver.CreateSnapshot(ctx, tag)
+	if err := limaDriver.CreateSnapshot(ctx, tag); err != nil {
+		return err
+	}
+	history.Record(inst.Dir, history.Entry{Event: history.EventSnapshot, Message: "save " + tag})
+	return nil
 }
 
 func Load(ctx context.Context, inst *store.Instance, tag string) error {
+	if err := checkSupported(inst); err != nil {
+		return err
+	}
+	if err := checkNotSuspended(inst); err != nil {
+		return err
+	}
 	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
 		Instance: inst,
 	})
-	return limaDriver.ApplySnapshot(ctx, tag)
+	if err := limaDriver.ApplySnapshot(ctx, tag); err != nil {
+		return err
+	}
+	history.Record(inst.Dir, history.Entry{Event: history.EventSnapshot, Message: "apply " + tag})
+	return nil
 }
 
 func List(ctx context.Context, inst *store.Instance) (string, error) {
+	if err := checkSupported(inst); err != nil {
+		return "", err
+	}
 	limaDriver := driverutil.CreateTargetDriverInstance(&driver.BaseDriver{
 		Instance: inst,
 	})
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/identifiers"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// DefaultInstanceName is the name of the default instance, unless changed by $LIMA_INSTANCE or `limactl default set`.
+const DefaultInstanceName = "default"
+
+// DefaultInstance returns the name of the instance used when no instance name is specified,
+// e.g., `lima`, `limactl shell`, and `limactl start` without the instance name.
+//
+// The name is looked up in the following order:
+//   - $LIMA_INSTANCE
+//   - $LIMA_HOME/_config/default-instance, written by SetDefaultInstance
+//   - "default"
+func DefaultInstance() (string, error) {
+	if name := os.Getenv("LIMA_INSTANCE"); name != "" {
+		return name, nil
+	}
+	name, err := PersistedDefaultInstance()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return DefaultInstanceName, nil
+	}
+	return name, nil
+}
+
+func defaultInstanceFile() (string, error) {
+	configDir, err := dirnames.LimaConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, filenames.DefaultInstance), nil
+}
+
+// PersistedDefaultInstance returns the name written by SetDefaultInstance.
+// Returns an empty string when the default instance has not been set.
+func PersistedDefaultInstance() (string, error) {
+	path, err := defaultInstanceFile()
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	name := strings.TrimSpace(string(b))
+	if name == "" {
+		return "", nil
+	}
+	if err := identifiers.Validate(name); err != nil {
+		return "", fmt.Errorf("invalid default instance name in %q: %w", path, err)
+	}
+	return name, nil
+}
+
+// SetDefaultInstance persists name as the default instance.
+// An empty name resets the default instance to "default".
+func SetDefaultInstance(name string) error {
+	path, err := defaultInstanceFile()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := identifiers.Validate(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// The file is read by the `lima` shell script too, so it is kept as a plain text
+	return os.WriteFile(path, []byte(name+"\n"), 0o644)
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestDefaultInstance(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	t.Setenv("LIMA_INSTANCE", "")
+
+	name, err := DefaultInstance()
+	assert.NilError(t, err)
+	assert.Equal(t, name, DefaultInstanceName)
+
+	assert.NilError(t, SetDefaultInstance("docker"))
+	b, err := os.ReadFile(filepath.Join(limaHome, filenames.ConfigDir, filenames.DefaultInstance))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "docker\n")
+	name, err = DefaultInstance()
+	assert.NilError(t, err)
+	assert.Equal(t, name, "docker")
+
+	// $LIMA_INSTANCE takes precedence over the persisted name
+	t.Setenv("LIMA_INSTANCE", "podman")
+	name, err = DefaultInstance()
+	assert.NilError(t, err)
+	assert.Equal(t, name, "podman")
+	name, err = PersistedDefaultInstance()
+	assert.NilError(t, err)
+	assert.Equal(t, name, "docker")
+	t.Setenv("LIMA_INSTANCE", "")
+
+	assert.ErrorContains(t, SetDefaultInstance("../foo"), "invalid")
+
+	assert.NilError(t, SetDefaultInstance(""))
+	name, err = DefaultInstance()
+	assert.NilError(t, err)
+	assert.Equal(t, name, DefaultInstanceName)
+	// resetting twice is not an error
+	assert.NilError(t, SetDefaultInstance(""))
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/lima-vm/lima/pkg/identifierutil"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 )
 
@@ -14,11 +15,17 @@ const DotLima = ".lima"
 
 // LimaDir returns the absolute path of `~/.lima` (or $LIMA_HOME, if set).
 //
+// $LIMA_HOME may contain `{{.HostUser}}` so that multiple users of a shared machine
+// can use a common setting, e.g., `LIMA_HOME=/data/lima/{{.HostUser}}`.
+//
 // NOTE: We do not use `~/Library/Application Support/Lima` on macOS.
 // We use `~/.lima` so that we can have enough space for the length of the socket path,
 // which can be only 104 characters on macOS.
 func LimaDir() (string, error) {
-	dir := os.Getenv("LIMA_HOME")
+	dir, err := identifierutil.ExpandHostUser(os.Getenv("LIMA_HOME"))
+	if err != nil {
+		return "", fmt.Errorf("failed to expand $LIMA_HOME: %w", err)
+	}
 	if dir == "" {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
@@ -62,3 +69,21 @@ func LimaDisksDir() (string, error) {
 	}
 	return filepath.Join(limaDir, filenames.DisksDir), nil
 }
+
+// LimaImagesDir returns the path of the image store directory, $LIMA_HOME/_images.
+func LimaImagesDir() (string, error) {
+	limaDir, err := LimaDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(limaDir, filenames.ImagesDir), nil
+}
+
+// LimaSHMDir returns the path of the shared memory directory, $LIMA_HOME/_shm.
+func LimaSHMDir() (string, error) {
+	limaDir, err := LimaDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(limaDir, filenames.SHMDir), nil
+}
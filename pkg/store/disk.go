@@ -1,6 +1,7 @@
 package store
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -20,6 +21,18 @@ type Disk struct {
 	Instance    string `json:"instance"`
 	InstanceDir string `json:"instanceDir"`
 	MountPoint  string `json:"mountPoint"`
+	// Filesystem is set when the disk was created with `limactl disk create --fs`.
+	Filesystem *DiskFilesystem `json:"filesystem,omitempty"`
+}
+
+// DiskFilesystem is the filesystem requested by `limactl disk create --fs`.
+type DiskFilesystem struct {
+	Type     string   `json:"type"`
+	Label    string   `json:"label"`
+	MkfsArgs []string `json:"mkfsArgs,omitempty"`
+	// Formatted is true if the filesystem was created on the host.
+	// Otherwise the guest creates it when the disk is attached for the first time.
+	Formatted bool `json:"formatted"`
 }
 
 func InspectDisk(diskName string) (*Disk, error) {
@@ -55,9 +68,40 @@ func InspectDisk(diskName string) (*Disk, error) {
 
 	disk.MountPoint = fmt.Sprintf("/mnt/lima-%s", diskName)
 
+	disk.Filesystem, err = LoadDiskFilesystem(diskDir)
+	if err != nil {
+		return nil, err
+	}
+
 	return disk, nil
 }
 
+// LoadDiskFilesystem loads the filesystem information of the disk in diskDir.
+// It returns nil if the disk was not created with a filesystem.
+func LoadDiskFilesystem(diskDir string) (*DiskFilesystem, error) {
+	b, err := os.ReadFile(filepath.Join(diskDir, filenames.Filesystem))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var fsys DiskFilesystem
+	if err := json.Unmarshal(b, &fsys); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", filenames.Filesystem, err)
+	}
+	return &fsys, nil
+}
+
+// SaveDiskFilesystem saves the filesystem information of the disk in diskDir.
+func SaveDiskFilesystem(diskDir string, fsys *DiskFilesystem) error {
+	b, err := json.Marshal(fsys)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(diskDir, filenames.Filesystem), b, 0o644)
+}
+
 // inspectDisk attempts to inspect the disk size and format by itself,
 // and falls back to inspectDiskWithQemuImg on an error.
 func inspectDisk(fName string) (size int64, format string, _ error) {
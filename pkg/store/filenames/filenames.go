@@ -11,25 +11,34 @@ const (
 	CacheDir    = "_cache"    // not yet implemented
 	NetworksDir = "_networks" // network log files are stored here
 	DisksDir    = "_disks"    // disks are stored here
+	SHMDir      = "_shm"      // shared memory files of `sharedMemory` are stored here
+	ImagesDir   = "_images"   // base disk images shared across instances are stored here, by the digest
 )
 
 // Filenames used inside the ConfigDir
 
 const (
-	UserPrivateKey = "user"
-	UserPublicKey  = UserPrivateKey + ".pub"
-	NetworksConfig = "networks.yaml"
-	Default        = "default.yaml"
-	Override       = "override.yaml"
+	UserPrivateKey  = "user"
+	UserPublicKey   = UserPrivateKey + ".pub"
+	NetworksConfig  = "networks.yaml"
+	Default         = "default.yaml"
+	Override        = "override.yaml"
+	ProfilesDir     = "profiles" // named overrides, "profiles/NAME.yaml"; see `profile` in lima.yaml
+	TemplateRepos   = "template-repos.yaml"
+	Credentials     = "credentials.yaml"
+	DefaultInstance = "default-instance" // the name of the default instance; see `limactl default`
 )
 
 // Filenames that may appear under an instance directory
 
 const (
 	LimaYAML             = "lima.yaml"
-	LimaVersion          = "lima-version" // Lima version used to create instance
+	Metadata             = "metadata.json" // see pkg/store/metadata
+	LimaVersion          = "lima-version"  // Lima version used to create instance; replaced with Metadata
+	History              = "history.jsonl" // lifecycle events; see pkg/store/history
 	CIDataISO            = "cidata.iso"
 	CIDataISODir         = "cidata"
+	CIDataManifest       = "cidata.manifest.json" // digests of the files in cidata.iso
 	CloudConfig          = "cloud-config.yaml"
 	BaseDisk             = "basedisk"
 	DiffDisk             = "diffdisk"
@@ -46,30 +55,52 @@ const (
 	SSHSock              = "ssh.sock"
 	SSHConfig            = "ssh.config"
 	VhostSock            = "virtiofsd-%d.sock"
+	VhostPID             = "virtiofsd-%d.pid"
+	SwtpmSock            = "swtpm.sock"
+	SwtpmStateDir        = "swtpm" // persistent TPM state; used only when `tpm: true`
 	VNCDisplayFile       = "vncdisplay"
 	VNCPasswordFile      = "vncpassword"
 	GuestAgentSock       = "ga.sock"
 	VirtioPort           = "io.lima-vm.guest_agent.0"
-	HostAgentPID         = "ha.pid"
+	HostAgentPID         = "ha.pid" // replaced with Metadata
 	HostAgentSock        = "ha.sock"
+	MountDriverSock      = "mount.sock"  // socket of the external mount driver ("lima-mount-NAME")
+	NFSSock              = "nfs-%d.sock" // NFS server of `mountType: nfs`, reverse-forwarded to the guest
 	HostAgentStdoutLog   = "ha.stdout.log"
 	HostAgentStderrLog   = "ha.stderr.log"
+	HostServiceStderrLog = "host-service.stderr.log"
+	TunnelLog            = "tunnel-%s.log"       // stderr of the ssh process of `limactl tunnel --type=socks`
+	DriverFailure        = "driver-failure.json" // the last unexpected exit of the driver; removed on `limactl start`
+	Crash                = "crash.json"          // the last kernel panic of the guest; removed on `limactl start`
+	CrashDir             = "crash"               // artifacts of the kernel panics of the guest, e.g., crash/<TIME>/vmcore
+	VMCore               = "vmcore"              // kdump-compressed guest memory under a CrashDir subdirectory
+	WireGuardKey         = "wireguard.key"       // private key of the instance on the "wireguard" networks of networks.yaml
+	SuspendState         = "suspend.state"       // VM state saved by `limactl suspend`, under the storage dir; removed on resume
 	VzIdentifier         = "vz-identifier"
 	VzEfi                = "vz-efi"           // efi variable store
+	VzSnapshotsDir       = "vz-snapshots"     // disk snapshots of the vz driver; `limactl snapshot`
 	QemuEfiCodeFD        = "qemu-efi-code.fd" // efi code; not always created
 	AnsibleInventoryYAML = "ansible-inventory.yaml"
+	MigrateBackupDir     = "migrate-backup" // files backed up by `limactl migrate-layout`, e.g., migrate-backup/<TIME>/lima.yaml
 
 	// SocketDir is the default location for forwarded sockets with a relative paths in HostSocket.
 	SocketDir = "sock"
 
-	Protected = "protected" // empty file; used by `limactl protect`
+	Protected = "protected" // empty file; used by `limactl protect`; replaced with Metadata
 )
 
 // Filenames used under a disk directory
 
 const (
-	DataDisk = "datadisk"
-	InUseBy  = "in_use_by"
+	DataDisk   = "datadisk"
+	InUseBy    = "in_use_by"
+	Filesystem = "filesystem.json" // written by `limactl disk create --fs`
+)
+
+// Filenames used under the NetworksDir
+
+const (
+	MACAddresses = "mac-addresses.json" // the MAC addresses allocated to the instances; see pkg/macaddress
 )
 
 // LongestSock is the longest socket name.
@@ -85,3 +116,9 @@ const LongestSock = SSHSock + ".1234567890123456"
 func PIDFile(name string) string {
 	return name + ".pid"
 }
+
+// SerialLogs returns the names of the serial console logs that may appear under an instance dir.
+// Each log may be accompanied by the rotated logs, e.g., "serial.log.1".
+func SerialLogs() []string {
+	return []string{SerialLog, SerialPCILog, SerialVirtioLog}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterHelp is the help text of `--filter`.
+const FilterHelp = `The instances can be filtered with --filter KEY=VALUE, which can be specified multiple times.
+The instances matching all the filters are selected. The following filters are supported:
+  label=KEY        - the instance has the label KEY
+  label=KEY=VALUE  - the instance has the label KEY with VALUE
+  status=STATUS    - the status of the instance is STATUS (e.g., "Running"), case-insensitive
+  vmType=VMTYPE    - the vmType of the instance is VMTYPE (e.g., "vz")
+`
+
+// Filter is a condition on the instances, specified with `--filter`.
+type Filter struct {
+	// Key is one of "label", "status", and "vmType".
+	Key string
+	// Value is the label key for "label", and the expected value otherwise.
+	Value string
+	// LabelValue is the expected value of the label; nil matches any value.
+	LabelValue *string
+}
+
+// ParseFilter parses a filter in the form of "KEY=VALUE", e.g., "label=team=infra".
+func ParseFilter(s string) (*Filter, error) {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || v == "" {
+		return nil, fmt.Errorf("invalid filter %q: expected KEY=VALUE", s)
+	}
+	f := &Filter{Key: k, Value: v}
+	switch k {
+	case "label":
+		if lk, lv, ok := strings.Cut(v, "="); ok {
+			f.Value = lk
+			f.LabelValue = &lv
+		}
+	case "status", "vmType":
+	default:
+		return nil, fmt.Errorf("invalid filter %q: unknown key %q (expected \"label\", \"status\", or \"vmType\")", s, k)
+	}
+	return f, nil
+}
+
+// ParseFilters parses the filters.
+func ParseFilters(ss []string) ([]Filter, error) {
+	res := make([]Filter, 0, len(ss))
+	for _, s := range ss {
+		f, err := ParseFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *f)
+	}
+	return res, nil
+}
+
+// Match returns true if the instance matches the filter.
+func (f *Filter) Match(inst *Instance) bool {
+	switch f.Key {
+	case "label":
+		v, ok := inst.Labels[f.Value]
+		return ok && (f.LabelValue == nil || v == *f.LabelValue)
+	case "status":
+		return strings.EqualFold(string(inst.Status), f.Value)
+	case "vmType":
+		return string(inst.VMType) == f.Value
+	}
+	return false
+}
+
+// MatchFilters returns true if the instance matches all the filters.
+func MatchFilters(inst *Instance, filters []Filter) bool {
+	for i := range filters {
+		if !filters[i].Match(inst) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFilter(t *testing.T) {
+	inst := &Instance{
+		Name:   "foo",
+		Status: StatusRunning,
+		VMType: "vz",
+		Labels: map[string]string{"team": "infra", "empty": ""},
+	}
+	testCases := map[string]bool{
+		"label=team":       true,
+		"label=team=infra": true,
+		"label=team=dev":   false,
+		"label=empty=":     true,
+		"label=owner":      false,
+		"status=running":   true,
+		"status=Stopped":   false,
+		"vmType=vz":        true,
+		"vmType=qemu":      false,
+	}
+	for s, expected := range testCases {
+		f, err := ParseFilter(s)
+		assert.NilError(t, err, s)
+		assert.Equal(t, f.Match(inst), expected, s)
+	}
+
+	filters, err := ParseFilters([]string{"label=team=infra", "status=Running"})
+	assert.NilError(t, err)
+	assert.Assert(t, MatchFilters(inst, filters))
+	filters, err = ParseFilters([]string{"label=team=infra", "status=Stopped"})
+	assert.NilError(t, err)
+	assert.Assert(t, !MatchFilters(inst, filters))
+
+	for _, s := range []string{"label", "label=", "name=foo"} {
+		_, err := ParseFilter(s)
+		assert.ErrorContains(t, err, "invalid filter", s)
+	}
+}
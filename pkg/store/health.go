@@ -0,0 +1,93 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+
+	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
+// Health is the health of a running instance, derived from the host agent events in ha.stdout.log.
+// Only the events since the last boot are taken into account, i.e., a restart by `restartPolicy`
+// resets the health.
+type Health struct {
+	// StartedAt is the time when the instance was started, or restarted by `restartPolicy`
+	StartedAt time.Time `json:"startedAt"`
+	// Uptime is the duration since StartedAt
+	Uptime time.Duration `json:"uptime"`
+	// Ready is true when the instance has become ready (same as "READY" of `limactl start`)
+	Ready bool `json:"ready"`
+	// Degraded is true when the instance became ready with errors
+	Degraded bool     `json:"degraded,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	// SSH is true when the user session of the guest is accessible over SSH
+	SSH bool `json:"ssh"`
+	// GuestAgent is true when the guest agent is connected
+	GuestAgent bool `json:"guestAgent"`
+	// Probes are the last results of the readiness probes, in the order of the first results
+	Probes []hostagentevents.ProbeStatus `json:"probes,omitempty"`
+}
+
+// readHealth reads the host agent events from haStdoutPath and returns the health of the instance at now.
+// nil is returned when no event has been emitted since the host agent was started.
+func readHealth(haStdoutPath string, now time.Time) (*Health, error) {
+	f, err := os.Open(haStdoutPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var h *Health
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev hostagentevents.Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			// ha.stdout.log may contain a partially written event
+			continue
+		}
+		h = h.onEvent(ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if h != nil && !h.StartedAt.IsZero() && now.After(h.StartedAt) {
+		h.Uptime = now.Sub(h.StartedAt).Truncate(time.Second)
+	}
+	return h, nil
+}
+
+func (h *Health) onEvent(ev hostagentevents.Event) *Health {
+	booting := ev.DriverFailure == nil && ev.Probe == nil && ev.Ready == "" && ev.Unready == "" &&
+		ev.GuestPorts == nil && ev.HostIPChange == nil && !ev.Status.Running && !ev.Status.Exiting
+	if booting || h == nil {
+		h = &Health{StartedAt: ev.Time}
+	}
+	switch {
+	case ev.Probe != nil:
+		for i := range h.Probes {
+			if h.Probes[i].Name == ev.Probe.Name {
+				h.Probes[i] = *ev.Probe
+				return h
+			}
+		}
+		h.Probes = append(h.Probes, *ev.Probe)
+	case ev.Ready == hostagentevents.ReadySSH:
+		h.SSH = true
+	case ev.Ready == hostagentevents.ReadyGuestAgent:
+		h.GuestAgent = true
+	case ev.Unready == hostagentevents.ReadySSH:
+		h.SSH = false
+	case ev.Unready == hostagentevents.ReadyGuestAgent:
+		h.GuestAgent = false
+	case ev.Status.Running:
+		h.Ready = true
+		h.Degraded = ev.Status.Degraded
+		h.Errors = ev.Status.Errors
+	case ev.Status.Exiting:
+		h.Ready = false
+		h.SSH = false
+		h.GuestAgent = false
+	}
+	return h
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestReadHealth(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	evs := []hostagentevents.Event{
+		{Time: t0, Status: hostagentevents.Status{SSHLocalPort: 60022}},
+		{Time: t0.Add(time.Second), Ready: hostagentevents.ReadySSH},
+		{Time: t0.Add(2 * time.Second), Probe: &hostagentevents.ProbeStatus{Name: "docker", Error: "timeout"}},
+		// restarted by `restartPolicy`
+		{Time: t0.Add(time.Minute), DriverFailure: &hostagentevents.DriverFailure{Reason: "crash", Restarting: true}},
+		{Time: t0.Add(2 * time.Minute), Status: hostagentevents.Status{SSHLocalPort: 60022}},
+		{Time: t0.Add(2*time.Minute + time.Second), Ready: hostagentevents.ReadySSH},
+		{Time: t0.Add(2*time.Minute + 2*time.Second), Ready: hostagentevents.ReadyGuestAgent},
+		{Time: t0.Add(2*time.Minute + 3*time.Second), Probe: &hostagentevents.ProbeStatus{Name: "docker", Error: "timeout"}},
+		{Time: t0.Add(2*time.Minute + 4*time.Second), Probe: &hostagentevents.ProbeStatus{Name: "docker", Passed: true}},
+		{Time: t0.Add(2*time.Minute + 5*time.Second), Status: hostagentevents.Status{Running: true, Degraded: true, Errors: []string{"foo"}}},
+		{Time: t0.Add(3 * time.Minute), Unready: hostagentevents.ReadyGuestAgent},
+	}
+	var b []byte
+	for _, ev := range evs {
+		j, err := json.Marshal(ev)
+		assert.NilError(t, err)
+		b = append(append(b, j...), '\n')
+	}
+	// partially written
+	b = append(b, `{"time":`...)
+	haStdoutPath := filepath.Join(t.TempDir(), "ha.stdout.log")
+	assert.NilError(t, os.WriteFile(haStdoutPath, b, 0o644))
+
+	h, err := readHealth(haStdoutPath, t0.Add(5*time.Minute+500*time.Millisecond))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, h, &Health{
+		StartedAt: t0.Add(2 * time.Minute),
+		Uptime:    3 * time.Minute,
+		Ready:     true,
+		Degraded:  true,
+		Errors:    []string{"foo"},
+		SSH:       true,
+		Probes:    []hostagentevents.ProbeStatus{{Name: "docker", Passed: true}},
+	})
+
+	assert.NilError(t, os.WriteFile(haStdoutPath, nil, 0o644))
+	h, err = readHealth(haStdoutPath, t0)
+	assert.NilError(t, err)
+	assert.Assert(t, h == nil)
+}
@@ -0,0 +1,228 @@
+// Package history manages "history.jsonl" in an instance directory, which records the lifecycle events of the instance,
+// such as the creation, the starts and stops, the edits of lima.yaml, the snapshots, and the upgrades of Lima.
+//
+// The history is best-effort: a failure to record an event is logged, but does not fail the operation.
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/version"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/sirupsen/logrus"
+)
+
+type Event = string
+
+const (
+	// EventCreate is recorded when the instance is created from a template.
+	EventCreate Event = "create"
+	// EventImport is recorded when the instance is imported from an archive of `limactl export`.
+	EventImport Event = "import"
+	// EventClone is recorded when the instance is created as a copy of another instance by `limactl clone`.
+	EventClone Event = "clone"
+	// EventStart is recorded when the host agent starts.
+	EventStart Event = "start"
+	// EventStop is recorded when the host agent exits.
+	EventStop Event = "stop"
+	// EventSuspend is recorded when the VM state is saved by `limactl suspend`.
+	EventSuspend Event = "suspend"
+	// EventEdit is recorded when lima.yaml is modified.
+	EventEdit Event = "edit"
+	// EventSnapshot is recorded when a snapshot is saved, applied, or deleted.
+	EventSnapshot Event = "snapshot"
+	// EventUpgrade is recorded when the instance is started with a version of Lima that differs from the previous start.
+	EventUpgrade Event = "upgrade"
+)
+
+// Entry is a line of "history.jsonl".
+type Entry struct {
+	Time  time.Time `json:"time"`
+	Event Event     `json:"event"`
+	// LimaVersion is the version of Lima that recorded the entry.
+	LimaVersion string `json:"limaVersion,omitempty"`
+	// Template is the locator of the template, for EventCreate.
+	Template string `json:"template,omitempty"`
+	// Digest is the digest of lima.yaml, for EventCreate and EventEdit.
+	Digest string `json:"digest,omitempty"`
+	// Diff is the unified diff of lima.yaml, for EventEdit.
+	Diff string `json:"diff,omitempty"`
+	// Message describes the event, e.g., "save TAG" for EventSnapshot, or the error of EventStop.
+	Message string `json:"message,omitempty"`
+}
+
+// Record appends e to the history of the instance in instDir.
+// The time and the Lima version are filled when they are not set.
+func Record(instDir string, e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.LimaVersion == "" {
+		e.LimaVersion = version.Version
+	}
+	if err := appendEntry(instDir, e); err != nil {
+		logrus.WithError(err).Warnf("Failed to record the %q event in the history of %q", e.Event, instDir)
+	}
+}
+
+func appendEntry(instDir string, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return lockutil.WithDirLock(instDir, func() error {
+		f, err := os.OpenFile(filepath.Join(instDir, filenames.History), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		// terminate the line truncated by a crash, so that it does not corrupt the new entry
+		if st, err := f.Stat(); err == nil && st.Size() > 0 {
+			last := make([]byte, 1)
+			if _, err := f.ReadAt(last, st.Size()-1); err == nil && last[0] != '\n' {
+				b = append([]byte{'\n'}, b...)
+			}
+		}
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// RecordEdit records the modification of lima.yaml from oldYAML to newYAML, unless they are identical.
+func RecordEdit(instDir string, oldYAML, newYAML []byte, message string) {
+	if string(oldYAML) == string(newYAML) {
+		return
+	}
+	Record(instDir, Entry{
+		Event:   EventEdit,
+		Digest:  Digest(newYAML),
+		Diff:    Diff(oldYAML, newYAML),
+		Message: message,
+	})
+}
+
+// RecordStart records EventStart, preceded by EventUpgrade when the instance was previously started
+// with another version of Lima.
+func RecordStart(instDir string) {
+	entries, err := Read(instDir)
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to read the history of %q", instDir)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Event != EventStart {
+			continue
+		}
+		if prev := entries[i].LimaVersion; prev != "" && prev != version.Version {
+			Record(instDir, Entry{Event: EventUpgrade, Message: fmt.Sprintf("%s -> %s", prev, version.Version)})
+		}
+		break
+	}
+	Record(instDir, Entry{Event: EventStart})
+}
+
+// Read reads the history of the instance in instDir, in the chronological order.
+// An empty history is returned when the history does not exist, e.g., for the instances created
+// by older versions of Lima.
+func Read(instDir string) ([]Entry, error) {
+	f, err := os.Open(filepath.Join(instDir, filenames.History))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	// the diffs may exceed the default limit of 64KiB
+	scanner.Buffer(nil, 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			// a line may be truncated by a crash; skip it rather than losing the whole history
+			logrus.WithError(err).Warnf("Skipping the line %d of the history of %q", lineNo, instDir)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Template returns the locator of the template that the instance in instDir was created from,
+// or "" when it is unknown, e.g., for the instances created by older versions of Lima.
+func Template(instDir string) string {
+	entries, err := Read(instDir)
+	if err != nil {
+		logrus.WithError(err).Debugf("failed to read the history of %q", instDir)
+		return ""
+	}
+	for _, e := range entries {
+		if e.Event == EventCreate {
+			return e.Template
+		}
+	}
+	return ""
+}
+
+// Digest returns the digest of b, e.g., "sha256:...".
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Diff returns the unified diff from oldYAML to newYAML.
+func Diff(oldYAML, newYAML []byte) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(oldYAML),
+		B:        splitLines(newYAML),
+		FromFile: "a/" + filenames.LimaYAML,
+		ToFile:   "b/" + filenames.LimaYAML,
+		Context:  3,
+	})
+	if err != nil {
+		// never happens, as the diff is written to a buffer
+		return err.Error()
+	}
+	return diff
+}
+
+// splitLines splits b into lines with the line terminators.
+// Unlike difflib.SplitLines, no empty line is appended after the last line terminator.
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// DiffStat returns the numbers of the added and the removed lines in diff.
+func DiffStat(diff string) (added, removed int) {
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,71 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/version"
+	"gotest.tools/v3/assert"
+)
+
+func TestRecord(t *testing.T) {
+	instDir := t.TempDir()
+	entries, err := Read(instDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+	assert.Equal(t, Template(instDir), "")
+
+	Record(instDir, Entry{Event: EventCreate, Template: "template://default", Digest: Digest([]byte("cpus: 1\n"))})
+	RecordEdit(instDir, []byte("cpus: 1\n"), []byte("cpus: 1\n"), "")
+	RecordEdit(instDir, []byte("cpus: 1\n"), []byte("cpus: 2\n"), "limactl edit")
+
+	entries, err = Read(instDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Event, EventCreate)
+	assert.Equal(t, entries[0].LimaVersion, version.Version)
+	assert.Assert(t, !entries[0].Time.IsZero())
+	assert.Equal(t, entries[1].Event, EventEdit)
+	assert.Equal(t, entries[1].Digest, Digest([]byte("cpus: 2\n")))
+	assert.Equal(t, entries[1].Diff, "--- a/lima.yaml\n+++ b/lima.yaml\n@@ -1 +1 @@\n-cpus: 1\n+cpus: 2\n")
+	added, removed := DiffStat(entries[1].Diff)
+	assert.Equal(t, added, 1)
+	assert.Equal(t, removed, 1)
+	assert.Equal(t, Template(instDir), "template://default")
+}
+
+func TestRecordStart(t *testing.T) {
+	instDir := t.TempDir()
+	Record(instDir, Entry{Event: EventStart, LimaVersion: "0.1.0"})
+	Record(instDir, Entry{Event: EventStop, LimaVersion: "0.1.0"})
+	RecordStart(instDir)
+	RecordStart(instDir)
+
+	entries, err := Read(instDir)
+	assert.NilError(t, err)
+	var events []string
+	for _, e := range entries {
+		events = append(events, e.Event)
+	}
+	assert.DeepEqual(t, events, []string{EventStart, EventStop, EventUpgrade, EventStart, EventStart})
+	assert.Equal(t, entries[2].Message, "0.1.0 -> "+version.Version)
+}
+
+func TestReadTruncated(t *testing.T) {
+	instDir := t.TempDir()
+	Record(instDir, Entry{Event: EventStart})
+	f, err := os.OpenFile(filepath.Join(instDir, filenames.History), os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NilError(t, err)
+	_, err = f.WriteString(`{"time":"2024-`)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+	Record(instDir, Entry{Event: EventStop})
+
+	entries, err := Read(instDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Event, EventStart)
+	assert.Equal(t, entries[1].Event, EventStop)
+}
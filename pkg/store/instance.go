@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -18,10 +19,12 @@ import (
 
 	"github.com/docker/go-units"
 	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/identifierutil"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/store/metadata"
 	"github.com/lima-vm/lima/pkg/textutil"
 	"github.com/lima-vm/lima/pkg/version/versionutil"
 	"github.com/sirupsen/logrus"
@@ -36,6 +39,11 @@ const (
 	StatusBroken        Status = "Broken"
 	StatusStopped       Status = "Stopped"
 	StatusRunning       Status = "Running"
+	// StatusCrashed is the status of a running instance whose guest kernel has panicked,
+	// and has not booted again since then.
+	StatusCrashed Status = "Crashed"
+	// StatusSuspended is the status of a stopped instance whose VM state has been saved by `limactl suspend`.
+	StatusSuspended Status = "Suspended"
 )
 
 type Instance struct {
@@ -63,6 +71,16 @@ type Instance struct {
 	Protected       bool               `json:"protected"`
 	LimaVersion     string             `json:"limaVersion"`
 	Param           map[string]string  `json:"param,omitempty"`
+	Labels          map[string]string  `json:"labels,omitempty"`
+	// DriverFailure is the last unexpected exit of the driver since `limactl start`
+	DriverFailure *hostagentevents.DriverFailure `json:"driverFailure,omitempty"`
+	// Crash is the last kernel panic of the guest since `limactl start`
+	Crash *hostagentevents.Crash `json:"crash,omitempty"`
+	// Health is the health of the running instance, derived from the host agent events
+	Health *Health `json:"health,omitempty"`
+	// Plugins maps plugin names to the column values contributed by the plugins.
+	// Only populated by `limactl list --plugins`.
+	Plugins map[string]map[string]string `json:"plugins,omitempty"`
 }
 
 // Inspect returns err only when the instance does not exist (os.ErrNotExist).
@@ -97,10 +115,24 @@ func Inspect(instName string) (*Instance, error) {
 	inst.SSHAddress = "127.0.0.1"
 	inst.SSHLocalPort = *y.SSH.LocalPort // maybe 0
 	inst.SSHConfigFile = filepath.Join(instDir, filenames.SSHConfig)
-	inst.HostAgentPID, err = ReadPIDFile(filepath.Join(instDir, filenames.HostAgentPID))
+	md, err := metadata.Read(instDir)
 	if err != nil {
 		inst.Status = StatusBroken
 		inst.Errors = append(inst.Errors, err)
+		md = &metadata.Metadata{}
+	}
+	inst.HostAgentPID, err = hostAgentPID(instDir, md)
+	if err != nil {
+		inst.Status = StatusBroken
+		inst.Errors = append(inst.Errors, err)
+	}
+	if inst.HostAgentPID != 0 && md.HostAgentPID == inst.HostAgentPID {
+		if md.SSHAddress != "" {
+			inst.SSHAddress = md.SSHAddress
+		}
+		if md.SSHLocalPort != 0 {
+			inst.SSHLocalPort = md.SSHLocalPort
+		}
 	}
 
 	if inst.HostAgentPID != 0 {
@@ -141,12 +173,50 @@ func Inspect(instName string) (*Instance, error) {
 		inst.Disk = 0
 	}
 
-	protected := filepath.Join(instDir, filenames.Protected)
-	if _, err := os.Lstat(protected); !errors.Is(err, os.ErrNotExist) {
-		inst.Protected = true
+	inst.Protected = md.Protected
+
+	driverFailure := filepath.Join(instDir, filenames.DriverFailure)
+	if b, err := os.ReadFile(driverFailure); err == nil {
+		var failure hostagentevents.DriverFailure
+		if err := json.Unmarshal(b, &failure); err != nil {
+			inst.Errors = append(inst.Errors, fmt.Errorf("failed to parse %q: %w", driverFailure, err))
+		} else {
+			inst.DriverFailure = &failure
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		inst.Errors = append(inst.Errors, err)
+	}
+
+	crash := filepath.Join(instDir, filenames.Crash)
+	if b, err := os.ReadFile(crash); err == nil {
+		var c hostagentevents.Crash
+		if err := json.Unmarshal(b, &c); err != nil {
+			inst.Errors = append(inst.Errors, fmt.Errorf("failed to parse %q: %w", crash, err))
+		} else {
+			inst.Crash = &c
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		inst.Errors = append(inst.Errors, err)
 	}
 
 	inspectStatus(instDir, inst, y)
+	if inst.Status == StatusStopped {
+		if _, err := os.Stat(SuspendStatePath(instDir, y)); err == nil {
+			inst.Status = StatusSuspended
+		}
+	}
+
+	if inst.Status == StatusRunning {
+		haStdoutPath := filepath.Join(instDir, filenames.HostAgentStdoutLog)
+		if health, err := readHealth(haStdoutPath, time.Now()); err == nil {
+			inst.Health = health
+		} else {
+			logrus.WithError(err).Debugf("failed to read the health of instance %q from %q", instName, haStdoutPath)
+		}
+	}
+	if inst.Status == StatusRunning && inst.Crash != nil && !inst.Crash.Rebooted {
+		inst.Status = StatusCrashed
+	}
 
 	tmpl, err := template.New("format").Parse(y.Message)
 	if err != nil {
@@ -169,16 +239,14 @@ func Inspect(instName string) (*Instance, error) {
 		}
 	}
 
-	limaVersionFile := filepath.Join(instDir, filenames.LimaVersion)
-	if version, err := os.ReadFile(limaVersionFile); err == nil {
-		inst.LimaVersion = strings.TrimSpace(string(version))
+	inst.LimaVersion = md.LimaVersion
+	if inst.LimaVersion != "" {
 		if _, err = versionutil.Parse(inst.LimaVersion); err != nil {
-			logrus.Warnf("treating lima version %q from %q as very latest release", inst.LimaVersion, limaVersionFile)
+			logrus.Warnf("treating lima version %q of instance %q as very latest release", inst.LimaVersion, instName)
 		}
-	} else if !errors.Is(err, os.ErrNotExist) {
-		inst.Errors = append(inst.Errors, err)
 	}
 	inst.Param = y.Param
+	inst.Labels = y.Labels
 	return inst, nil
 }
 
@@ -206,6 +274,19 @@ func inspectStatusWithPIDFiles(instDir string, inst *Instance, y *limayaml.LimaY
 	}
 }
 
+// hostAgentPID returns the PID of the running host agent, or 0.
+func hostAgentPID(instDir string, md *metadata.Metadata) (int, error) {
+	if md.HostAgentPID != 0 {
+		exists, err := ProcessExists(md.HostAgentPID)
+		if err != nil || !exists {
+			return 0, err
+		}
+		return md.HostAgentPID, nil
+	}
+	// written by the host agents of the older versions of Lima
+	return ReadPIDFile(filepath.Join(instDir, filenames.HostAgentPID))
+}
+
 // ReadPIDFile returns 0 if the PID file does not exist or the process has already terminated
 // (in which case the PID file will be removed).
 func ReadPIDFile(path string) (int, error) {
@@ -220,27 +301,39 @@ func ReadPIDFile(path string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	proc, err := os.FindProcess(pid)
+	exists, err := ProcessExists(pid)
 	if err != nil {
 		return 0, err
 	}
+	if !exists {
+		_ = os.Remove(path)
+		return 0, nil
+	}
+	return pid, nil
+}
+
+// ProcessExists returns true if the process is running.
+func ProcessExists(pid int) (bool, error) {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false, err
+	}
 	// os.FindProcess will only return running processes on Windows, exit early
 	if runtime.GOOS == "windows" {
-		return pid, nil
+		return true, nil
 	}
 	err = proc.Signal(syscall.Signal(0))
 	if err != nil {
 		if errors.Is(err, os.ErrProcessDone) {
-			_ = os.Remove(path)
-			return 0, nil
+			return false, nil
 		}
 		// We may not have permission to send the signal (e.g. to network daemon running as root).
 		// But if we get a permissions error, it means the process is still running.
 		if !errors.Is(err, os.ErrPermission) {
-			return 0, err
+			return false, err
 		}
 	}
-	return pid, nil
+	return true, nil
 }
 
 type FormatData struct {
@@ -280,6 +373,15 @@ func AddGlobalFields(inst *Instance) (FormatData, error) {
 type PrintOptions struct {
 	AllFields     bool
 	TerminalWidth int
+	// PluginColumns are appended to the table format.
+	PluginColumns []PluginColumn
+}
+
+// PluginColumn is a table column contributed by a plugin.
+// The values are taken from Instance.Plugins.
+type PluginColumn struct {
+	Plugin string
+	Name   string
 }
 
 // PrintInstances prints instances in a requested format to a given io.Writer.
@@ -350,6 +452,13 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 		if !hideDir {
 			fmt.Fprint(w, "\tDIR")
 		}
+		var pluginColumns []PluginColumn
+		if options != nil {
+			pluginColumns = options.PluginColumns
+		}
+		for _, c := range pluginColumns {
+			fmt.Fprintf(w, "\t%s", strings.ToUpper(c.Name))
+		}
 		fmt.Fprintln(w)
 
 		u, err := user.Current()
@@ -388,6 +497,13 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 					dir,
 				)
 			}
+			for _, c := range pluginColumns {
+				v := instance.Plugins[c.Plugin][c.Name]
+				if v == "" {
+					v = "-"
+				}
+				fmt.Fprintf(w, "\t%s", v)
+			}
 			fmt.Fprint(w, "\n")
 		}
 		return w.Flush()
@@ -416,10 +532,12 @@ func PrintInstances(w io.Writer, instances []*Instance, format string, options *
 // Protect protects the instance to prohibit accidental removal.
 // Protect does not return an error even when the instance is already protected.
 func (inst *Instance) Protect() error {
-	protected := filepath.Join(inst.Dir, filenames.Protected)
 	// TODO: Do an equivalent of `chmod +a "everyone deny delete,delete_child,file_inherit,directory_inherit"`
 	// https://github.com/lima-vm/lima/issues/1595
-	if err := os.WriteFile(protected, nil, 0o400); err != nil {
+	if err := metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		m.Protected = true
+		return nil
+	}); err != nil {
 		return err
 	}
 	inst.Protected = true
@@ -429,8 +547,10 @@ func (inst *Instance) Protect() error {
 // Unprotect unprotects the instance.
 // Unprotect does not return an error even when the instance is already unprotected.
 func (inst *Instance) Unprotect() error {
-	protected := filepath.Join(inst.Dir, filenames.Protected)
-	if err := os.RemoveAll(protected); err != nil {
+	if err := metadata.Update(inst.Dir, func(m *metadata.Metadata) error {
+		m.Protected = false
+		return nil
+	}); err != nil {
 		return err
 	}
 	inst.Protected = false
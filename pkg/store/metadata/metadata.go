@@ -0,0 +1,205 @@
+// Package metadata manages "metadata.json" in an instance directory, which holds the state of the instance
+// that used to be scattered across marker files ("lima-version", "protected", "ha.pid").
+//
+// The PID files written by the drivers (e.g., "qemu.pid") are not managed here, as they are written by the
+// external processes.
+//
+// The file is replaced atomically on every update, so a crash never leaves a partially written file.
+// The marker files of the instances created by older versions of Lima are still read
+// until the metadata is updated for the first time.
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// SchemaVersion is the version of the schema of Metadata.
+// The version is incremented on incompatible changes; new optional fields do not change the version.
+const SchemaVersion = 1
+
+// Metadata is the content of "metadata.json".
+type Metadata struct {
+	// SchemaVersion is the version of the schema that the file was written with.
+	SchemaVersion int `json:"schemaVersion"`
+	// Generation is incremented on every update.
+	Generation int64 `json:"generation"`
+	// LimaVersion is the version of Lima used to create the instance, or to upgrade it with `limactl upgrade INSTANCE`.
+	// Empty for the instances created with Lima prior to v0.20.
+	LimaVersion string `json:"limaVersion,omitempty"`
+	// Protected is true when the instance is protected with `limactl protect`.
+	Protected bool `json:"protected,omitempty"`
+	// HostAgentPID is the PID of the host agent while the instance is running.
+	// The PID may be stale if the host agent has crashed, so the caller has to check that the process exists.
+	HostAgentPID int `json:"hostAgentPID,omitempty"`
+	// SSHAddress is the address of the SSH server of the running instance.
+	SSHAddress string `json:"sshAddress,omitempty"`
+	// SSHLocalPort is the local port of the SSH server of the running instance.
+	SSHLocalPort int `json:"sshLocalPort,omitempty"`
+	// Tunnels are the tunnels created with `limactl tunnel`. Cleared when the host agent exits.
+	Tunnels []Tunnel `json:"tunnels,omitempty"`
+	// Suspended is set by `limactl suspend`, and cleared by `limactl resume`.
+	Suspended *Suspended `json:"suspended,omitempty"`
+}
+
+// Suspended is the state of an instance suspended with `limactl suspend`.
+type Suspended struct {
+	Time time.Time `json:"time"`
+	// Tunnels are the tunnels at the time of the suspension, re-created on `limactl resume`.
+	Tunnels []Tunnel `json:"tunnels,omitempty"`
+	// UDPDNSLocalPort and TCPDNSLocalPort are the ports of the DNS server of the host agent (`hostResolver`),
+	// reused on resuming, as the guest has been configured to use them on the boot.
+	UDPDNSLocalPort int `json:"udpDNSLocalPort,omitempty"`
+	TCPDNSLocalPort int `json:"tcpDNSLocalPort,omitempty"`
+}
+
+// Tunnel is a tunnel created with `limactl tunnel`.
+type Tunnel struct {
+	// Name is unique in the instance.
+	Name string `json:"name"`
+	// Type is either "socks" or "udp".
+	Type string `json:"type"`
+	// Local is the address on the host, e.g., "127.0.0.1:1080".
+	Local string `json:"local"`
+	// Remote is the address in the guest network that the "udp" tunnel forwards to.
+	Remote string `json:"remote,omitempty"`
+	// PID is the PID of the ssh process of the "socks" tunnel.
+	PID int `json:"pid,omitempty"`
+}
+
+// Read reads the metadata of the instance in instDir.
+// When "metadata.json" does not exist, the metadata is read from the marker files of the older versions of Lima.
+func Read(instDir string) (*Metadata, error) {
+	b, err := os.ReadFile(filepath.Join(instDir, filenames.Metadata))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return readLegacy(instDir)
+		}
+		return nil, err
+	}
+	return parse(b)
+}
+
+func parse(b []byte) (*Metadata, error) {
+	var m Metadata
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", filenames.Metadata, err)
+	}
+	if m.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("%q was written with schema version %d, which is newer than the supported version %d; upgrade Lima",
+			filenames.Metadata, m.SchemaVersion, SchemaVersion)
+	}
+	return &m, nil
+}
+
+// readLegacy reads "lima-version" and "protected".
+// "ha.pid" is read by store.Inspect, as it may be written by a running host agent of an older version of Lima
+// even after "metadata.json" has been created.
+func readLegacy(instDir string) (*Metadata, error) {
+	m := &Metadata{SchemaVersion: SchemaVersion}
+	if b, err := os.ReadFile(filepath.Join(instDir, filenames.LimaVersion)); err == nil {
+		m.LimaVersion = strings.TrimSpace(string(b))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if _, err := os.Lstat(filepath.Join(instDir, filenames.Protected)); err == nil {
+		m.Protected = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Update updates the metadata of the instance in instDir with fn, and writes it atomically.
+// The updates from multiple processes are serialized with a lock on instDir.
+// The marker files of the older versions of Lima are removed, as their content is migrated into the metadata.
+func Update(instDir string, fn func(*Metadata) error) error {
+	return lockutil.WithDirLock(instDir, func() error {
+		m, err := Read(instDir)
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+		m.SchemaVersion = SchemaVersion
+		m.Generation++
+		if err := write(instDir, m); err != nil {
+			return err
+		}
+		for _, f := range []string{filenames.LimaVersion, filenames.Protected} {
+			if err := os.RemoveAll(filepath.Join(instDir, f)); err != nil {
+				logrus.WithError(err).Warnf("Failed to remove the legacy file %q", f)
+			}
+		}
+		return nil
+	})
+}
+
+func write(instDir string, m *Metadata) error {
+	f, err := os.CreateTemp(instDir, filenames.Metadata+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(m)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(instDir, filenames.Metadata))
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Watch sends the metadata of the instance in instDir to the returned channel whenever it changes,
+// starting with the current metadata. The channel is closed when ctx is done.
+func Watch(ctx context.Context, instDir string, interval time.Duration) <-chan *Metadata {
+	ch := make(chan *Metadata)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last *Metadata
+		for {
+			m, err := Read(instDir)
+			if err != nil {
+				logrus.WithError(err).Debugf("Failed to read the metadata of %q", instDir)
+			} else if last == nil || !reflect.DeepEqual(*m, *last) {
+				select {
+				case ch <- m:
+					last = m
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestReadLegacy(t *testing.T) {
+	instDir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaVersion), []byte("1.0.0\n"), 0o444))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.Protected), nil, 0o400))
+
+	m, err := Read(instDir)
+	assert.NilError(t, err)
+	assert.Equal(t, m.LimaVersion, "1.0.0")
+	assert.Assert(t, m.Protected)
+
+	// the legacy files are migrated on the first update
+	assert.NilError(t, Update(instDir, func(m *Metadata) error {
+		m.Protected = false
+		return nil
+	}))
+	_, err = os.Stat(filepath.Join(instDir, filenames.LimaVersion))
+	assert.Assert(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(instDir, filenames.Protected))
+	assert.Assert(t, os.IsNotExist(err))
+
+	m, err = Read(instDir)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m, &Metadata{SchemaVersion: SchemaVersion, Generation: 1, LimaVersion: "1.0.0"})
+}
+
+func TestReadNewerSchema(t *testing.T) {
+	instDir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.Metadata), []byte(`{"schemaVersion": 100}`), 0o644))
+	_, err := Read(instDir)
+	assert.ErrorContains(t, err, "newer than the supported version")
+}
+
+func TestWatch(t *testing.T) {
+	instDir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := Watch(ctx, instDir, 10*time.Millisecond)
+
+	m := <-ch
+	assert.Equal(t, m.HostAgentPID, 0)
+	assert.NilError(t, Update(instDir, func(m *Metadata) error {
+		m.HostAgentPID = 42
+		return nil
+	}))
+	m = <-ch
+	assert.Equal(t, m.HostAgentPID, 42)
+	assert.Equal(t, m.Generation, int64(1))
+}
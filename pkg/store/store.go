@@ -8,6 +8,7 @@ import (
 
 	"github.com/containerd/containerd/identifiers"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 )
@@ -101,6 +102,30 @@ func InstanceDir(name string) (string, error) {
 	return dir, nil
 }
 
+// StorageDir returns the directory for the disk images (basedisk, diffdisk, etc.) of the instance:
+// "<storage.dir>/<INSTANCE>" when `storage.dir` is set, otherwise the instance directory itself.
+// The symbolic links in `storage.dir` are resolved, so that the absolute paths recorded in the disk images
+// (e.g., the backing file of a qcow2 diffdisk) do not depend on them.
+func StorageDir(instDir string, y *limayaml.LimaYAML) string {
+	if y == nil || y.Storage.Dir == nil || *y.Storage.Dir == "" {
+		return instDir
+	}
+	dir, err := localpathutil.Expand(*y.Storage.Dir)
+	if err != nil {
+		// unreachable for a validated YAML
+		dir = *y.Storage.Dir
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return filepath.Join(dir, filepath.Base(instDir))
+}
+
+// SuspendStatePath returns the path of the VM state saved by `limactl suspend`.
+func SuspendStatePath(instDir string, y *limayaml.LimaYAML) string {
+	return filepath.Join(StorageDir(instDir, y), filenames.SuspendState)
+}
+
 func DiskDir(name string) (string, error) {
 	if err := identifiers.Validate(name); err != nil {
 		return "", err
@@ -0,0 +1,314 @@
+package templatestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/credentials"
+	"github.com/lima-vm/lima/pkg/ioutilx"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// TemplateMediaType is the media type of the layer of an OCI artifact that contains a template.
+// The first layer is used when no layer has this media type.
+const TemplateMediaType = "application/vnd.lima.template.v1+yaml"
+
+const templateBytesLimit = 4 * 1024 * 1024 // 4MiB
+
+// httpClient is replaced in the tests.
+var httpClient = credentials.Client
+
+// Fetch reads the template of the name, e.g., "default", "experimental/foo", or "REPO/foo".
+// When the first component of the name is a repository added with `limactl template repo add`,
+// the template is fetched from the repository. The fetched templates are cached, and the cache
+// is used when the repository is not reachable.
+//
+// The name may be pinned to the digest of the template with "@sha256:...", e.g., "REPO/foo@sha256:0123...".
+// The template is verified against the digest, and the cached template is used without accessing the repository.
+func Fetch(ctx context.Context, name string) ([]byte, error) {
+	name = filepath.ToSlash(name)
+	var dgst digest.Digest
+	if n, d, ok := strings.Cut(name, "@"); ok {
+		dgst = digest.Digest(d)
+		if err := dgst.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid digest %q in template name %q: %w", d, name, err)
+		}
+		name = n
+	}
+	repoName, templateName, ok := strings.Cut(name, "/")
+	var repo *Repo
+	if ok {
+		var err error
+		repo, err = LookupRepo(repoName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if repo == nil {
+		b, err := Read(name)
+		if err != nil {
+			return nil, err
+		}
+		if dgst != "" && dgst.Algorithm().FromBytes(b) != dgst {
+			return nil, fmt.Errorf("template %q does not match the digest %q", name, dgst)
+		}
+		return b, nil
+	}
+	return fetchFromRepo(ctx, repo, templateName, dgst)
+}
+
+func fetchFromRepo(ctx context.Context, repo *Repo, templateName string, dgst digest.Digest) ([]byte, error) {
+	if templateName == "" || strings.Contains(templateName, "..") {
+		return nil, fmt.Errorf("invalid template name %q in repository %q", templateName, repo.Name)
+	}
+	cachePath, err := cachePath(repo, templateName)
+	if err != nil {
+		return nil, err
+	}
+	if dgst != "" {
+		if b, err := os.ReadFile(cachePath); err == nil && dgst.Algorithm().FromBytes(b) == dgst {
+			logrus.Debugf("using the cached template %q for %s/%s@%s", cachePath, repo.Name, templateName, dgst)
+			return b, nil
+		}
+	}
+	var b []byte
+	if strings.HasPrefix(repo.URL, "oci://") {
+		b, err = pullOCI(ctx, repo, templateName, dgst)
+	} else {
+		b, err = fetchHTTP(ctx, strings.TrimSuffix(repo.URL, "/")+"/"+templateName+".yaml", nil)
+	}
+	if err != nil {
+		if dgst != "" {
+			return nil, fmt.Errorf("failed to fetch template %q from repository %q: %w", templateName, repo.Name, err)
+		}
+		cached, cacheErr := os.ReadFile(cachePath)
+		if cacheErr != nil {
+			return nil, fmt.Errorf("failed to fetch template %q from repository %q: %w", templateName, repo.Name, err)
+		}
+		logrus.WithError(err).Warnf("Failed to fetch template %q from repository %q, using the cached template", templateName, repo.Name)
+		return cached, nil
+	}
+	if dgst != "" && dgst.Algorithm().FromBytes(b) != dgst {
+		return nil, fmt.Errorf("template %q in repository %q does not match the digest %q (got %q)",
+			templateName, repo.Name, dgst, dgst.Algorithm().FromBytes(b))
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(cachePath, b, 0o644); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// cachePath returns the path of the cached template, under the "templates" directory in the Lima cache,
+// which is keyed by the URL of the repository so that replacing a repository does not use a stale cache.
+func cachePath(repo *Repo, templateName string) (string, error) {
+	ucd, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := digest.SHA256.FromString(repo.URL).Encoded()
+	return filepath.Join(ucd, "lima", "templates", key, filepath.FromSlash(templateName)+".yaml"), nil
+}
+
+// fetchHTTP fetches u. cred is used for the Authorization header when not nil,
+// otherwise httpClient looks up the credential for the host of u.
+func fetchHTTP(ctx context.Context, u string, cred *credentials.Credential) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		credentials.SetAuthorization(req, cred)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %q: %s", u, resp.Status)
+	}
+	return ioutilx.ReadAtMaximum(resp.Body, templateBytesLimit)
+}
+
+// ociRegistry is a minimal client of the OCI distribution API, for pulling artifacts.
+type ociRegistry struct {
+	baseURL    string // "https://REGISTRY"
+	repository string // "OWNER/templates/TEMPLATE"
+	token      string
+}
+
+type ociDescriptor struct {
+	MediaType string        `json:"mediaType"`
+	Digest    digest.Digest `json:"digest"`
+	Size      int64         `json:"size"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+func pullOCI(ctx context.Context, repo *Repo, templateName string, dgst digest.Digest) ([]byte, error) {
+	u, err := url.Parse(repo.URL)
+	if err != nil {
+		return nil, err
+	}
+	reg := &ociRegistry{
+		baseURL:    "https://" + u.Host,
+		repository: path.Join(strings.Trim(u.Path, "/"), templateName),
+	}
+	if dgst == "" {
+		b, err := reg.get(ctx, "manifests/latest", "application/vnd.oci.image.manifest.v1+json")
+		if err != nil {
+			return nil, err
+		}
+		var manifest ociManifest
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse the manifest of %q: %w", reg.repository, err)
+		}
+		layer, err := templateLayer(manifest.Layers)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", reg.repository, err)
+		}
+		dgst = layer.Digest
+	}
+	b, err := reg.get(ctx, "blobs/"+dgst.String(), "")
+	if err != nil {
+		return nil, err
+	}
+	if err := dgst.Validate(); err != nil || dgst.Algorithm().FromBytes(b) != dgst {
+		return nil, fmt.Errorf("the blob of %q does not match the digest %q", reg.repository, dgst)
+	}
+	return b, nil
+}
+
+func templateLayer(layers []ociDescriptor) (*ociDescriptor, error) {
+	for _, l := range layers {
+		if l.MediaType == TemplateMediaType {
+			return &l, nil
+		}
+	}
+	if len(layers) == 0 {
+		return nil, errors.New("the artifact has no layer")
+	}
+	return &layers[0], nil
+}
+
+// get gets "/v2/REPOSITORY/SUFFIX", with a bearer token when the registry requires one.
+func (reg *ociRegistry) get(ctx context.Context, suffix, accept string) ([]byte, error) {
+	u := fmt.Sprintf("%s/v2/%s/%s", reg.baseURL, reg.repository, suffix)
+	b, challenge, err := reg.tryGet(ctx, u, accept)
+	if challenge != "" && reg.token == "" {
+		if reg.token, err = reg.fetchToken(ctx, challenge); err != nil {
+			return nil, err
+		}
+		b, _, err = reg.tryGet(ctx, u, accept)
+	}
+	return b, err
+}
+
+// tryGet returns the challenge of the WWW-Authenticate header when the request is unauthorized.
+func (reg *ociRegistry) tryGet(ctx context.Context, u, accept string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, "", err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if reg.token != "" {
+		req.Header.Set("Authorization", "Bearer "+reg.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var challenge string
+		if resp.StatusCode == http.StatusUnauthorized {
+			challenge = resp.Header.Get("WWW-Authenticate")
+		}
+		return nil, challenge, fmt.Errorf("failed to get %q: %s", u, resp.Status)
+	}
+	b, err := ioutilx.ReadAtMaximum(resp.Body, templateBytesLimit)
+	return b, "", err
+}
+
+// fetchToken fetches a token for the challenge `Bearer realm="...",service="...",scope="..."`.
+func (reg *ociRegistry) fetchToken(ctx context.Context, challenge string) (string, error) {
+	params, ok := strings.CutPrefix(challenge, "Bearer ")
+	if !ok {
+		return "", fmt.Errorf("unsupported authentication challenge %q (only bearer token authentication is supported)", challenge)
+	}
+	values := url.Values{}
+	var realm string
+	for _, kv := range splitChallengeParams(params) {
+		k, v, _ := strings.Cut(kv, "=")
+		v = strings.Trim(v, `"`)
+		if k == "realm" {
+			realm = v
+		} else {
+			values.Set(k, v)
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("missing realm in the authentication challenge %q", challenge)
+	}
+	if values.Get("scope") == "" {
+		values.Set("scope", "repository:"+reg.repository+":pull")
+	}
+	// The credential of the registry is exchanged for the token
+	cred, err := credentials.LookupRegistry(ctx, strings.TrimPrefix(reg.baseURL, "https://"))
+	if err != nil {
+		return "", err
+	}
+	b, err := fetchHTTP(ctx, realm+"?"+values.Encode(), cred)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse the token: %w", err)
+	}
+	if resp.Token != "" {
+		return resp.Token, nil
+	}
+	if resp.AccessToken != "" {
+		return resp.AccessToken, nil
+	}
+	return "", errors.New("the token response has no token")
+}
+
+// splitChallengeParams splits `k1="v1",k2="v2"` by the commas outside the quotes.
+func splitChallengeParams(s string) []string {
+	var res []string
+	var quoted bool
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				res = append(res, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(res, strings.TrimSpace(s[start:]))
+}
@@ -0,0 +1,125 @@
+package templatestore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/credentials"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/v3/assert"
+)
+
+func setupRepoTest(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Setenv("LIMA_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+	httpClient = srv.Client()
+	t.Cleanup(func() { httpClient = credentials.Client })
+	return srv
+}
+
+func TestFetchHTTPS(t *testing.T) {
+	content := "images: []\n"
+	up := true
+	srv := setupRepoTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up || r.URL.Path != "/templates/dir/foo.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	assert.NilError(t, AddRepo(Repo{Name: "myrepo", URL: srv.URL + "/templates/"}))
+	assert.ErrorContains(t, AddRepo(Repo{Name: "myrepo", URL: srv.URL}), "already exists")
+	assert.ErrorContains(t, AddRepo(Repo{Name: "other", URL: "ftp://example.com"}), "scheme")
+
+	b, err := Fetch(context.Background(), "myrepo/dir/foo")
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), content)
+
+	pinned := "myrepo/dir/foo@" + digest.FromString(content).String()
+	_, err = Fetch(context.Background(), "myrepo/dir/foo@"+digest.FromString("other").String())
+	assert.ErrorContains(t, err, "does not match the digest")
+
+	// the cache is used when the repository is not reachable
+	up = false
+	b, err = Fetch(context.Background(), "myrepo/dir/foo")
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), content)
+	b, err = Fetch(context.Background(), pinned)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), content)
+	_, err = Fetch(context.Background(), "myrepo/bar")
+	assert.ErrorContains(t, err, "404")
+
+	assert.NilError(t, RemoveRepo("myrepo"))
+	repos, err := Repos()
+	assert.NilError(t, err)
+	assert.Equal(t, len(repos), 0)
+	assert.ErrorContains(t, RemoveRepo("myrepo"), "does not exist")
+}
+
+func TestFetchOCI(t *testing.T) {
+	content := []byte("images: []\n")
+	blob := digest.FromBytes(content)
+	manifest, err := json.Marshal(ociManifest{Layers: []ociDescriptor{
+		{MediaType: "text/plain", Digest: digest.FromString("readme")},
+		{MediaType: TemplateMediaType, Digest: blob, Size: int64(len(content))},
+	}})
+	assert.NilError(t, err)
+	var srvURL string
+	srv := setupRepoTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:owner/templates/foo:pull" {
+				http.Error(w, "unexpected scope", http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srvURL+`/token",service="registry",scope="repository:owner/templates/foo:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/owner/templates/foo/manifests/latest":
+			_, _ = w.Write(manifest)
+		case "/v2/owner/templates/foo/blobs/" + blob.String():
+			_, _ = w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	srvURL = srv.URL
+	registry := strings.TrimPrefix(srv.URL, "https://")
+	dockerConfig := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+	auth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	assert.NilError(t, os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(`{"auths":{"`+registry+`":{"auth":"`+auth+`"}}}`), 0o600))
+	assert.NilError(t, AddRepo(Repo{Name: "myrepo", URL: "oci://" + registry + "/owner/templates"}))
+
+	b, err := Fetch(context.Background(), "myrepo/foo")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, b, content)
+
+	_, err = Fetch(context.Background(), "myrepo/foo@"+digest.FromString("other").String())
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestSplitChallengeParams(t *testing.T) {
+	assert.DeepEqual(t, splitChallengeParams(`realm="https://auth.example.com/token", scope="repository:foo:pull,push"`),
+		[]string{`realm="https://auth.example.com/token"`, `scope="repository:foo:pull,push"`})
+}
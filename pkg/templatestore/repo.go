@@ -0,0 +1,146 @@
+package templatestore
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/containerd/containerd/identifiers"
+	"github.com/goccy/go-yaml"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// Repo is a template repository, which resolves `template://NAME/TEMPLATE`.
+type Repo struct {
+	Name string `yaml:"name" json:"name"`
+	// URL is the base URL of the repository, "https://HOST/PATH" or "oci://REGISTRY/REPOSITORY".
+	// "https://HOST/PATH/TEMPLATE.yaml" is fetched for a https repository,
+	// "REGISTRY/REPOSITORY/TEMPLATE:latest" is pulled for an oci repository.
+	URL string `yaml:"url" json:"url"`
+}
+
+// reposConfig is the content of $LIMA_HOME/_config/template-repos.yaml.
+type reposConfig struct {
+	Repos []Repo `yaml:"repos"`
+}
+
+func reposConfigPath() (string, error) {
+	configDir, err := dirnames.LimaConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, filenames.TemplateRepos), nil
+}
+
+// Repos returns the template repositories configured with `limactl template repo add`.
+func Repos() ([]Repo, error) {
+	configPath, err := reposConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var config reposConfig
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", configPath, err)
+	}
+	return config.Repos, nil
+}
+
+func writeRepos(repos []Repo) error {
+	configPath, err := reposConfigPath()
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(reposConfig{Repos: repos})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(configPath, b, 0o644)
+}
+
+// ValidateRepo validates the name and the URL of the repository.
+// The name must not shadow the directories of the builtin templates, e.g., "experimental".
+func ValidateRepo(repo Repo) error {
+	if err := identifiers.Validate(repo.Name); err != nil {
+		return fmt.Errorf("invalid repository name %q: %w", repo.Name, err)
+	}
+	if builtins, err := Templates(); err == nil {
+		for _, t := range builtins {
+			if t.Name == repo.Name || strings.HasPrefix(t.Name, repo.Name+"/") {
+				return fmt.Errorf("repository name %q conflicts with the builtin template %q", repo.Name, t.Name)
+			}
+		}
+	}
+	u, err := url.Parse(repo.URL)
+	if err != nil {
+		return fmt.Errorf("invalid repository URL %q: %w", repo.URL, err)
+	}
+	switch u.Scheme {
+	case "https", "http", "oci":
+	default:
+		return fmt.Errorf("invalid repository URL %q: the scheme must be one of https, http, oci", repo.URL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid repository URL %q: missing host", repo.URL)
+	}
+	if u.Scheme == "oci" && strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("invalid repository URL %q: missing repository, e.g., \"oci://ghcr.io/OWNER/templates\"", repo.URL)
+	}
+	return nil
+}
+
+// AddRepo adds the repository. The name must not be used by another repository.
+func AddRepo(repo Repo) error {
+	if err := ValidateRepo(repo); err != nil {
+		return err
+	}
+	repos, err := Repos()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(repos, func(r Repo) bool { return r.Name == repo.Name }) {
+		return fmt.Errorf("repository %q already exists", repo.Name)
+	}
+	return writeRepos(append(repos, repo))
+}
+
+// RemoveRepo removes the repository.
+func RemoveRepo(name string) error {
+	repos, err := Repos()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(repos, func(r Repo) bool { return r.Name == name })
+	if i < 0 {
+		return fmt.Errorf("repository %q does not exist", name)
+	}
+	return writeRepos(slices.Delete(repos, i, i+1))
+}
+
+// LookupRepo returns the repository with the name, or nil.
+func LookupRepo(name string) (*Repo, error) {
+	repos, err := Repos()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range repos {
+		if r.Name == name {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
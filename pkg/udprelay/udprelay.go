@@ -0,0 +1,147 @@
+// Package udprelay relays UDP multicast and broadcast datagrams between the host and the guest.
+//
+// The host agent and the guest agent each open a socket joined to the group,
+// and exchange the received datagrams over a guest agent tunnel.
+package udprelay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// Protocol is the value of TunnelMessage.Protocol for relaying datagrams.
+const Protocol = "udp-relay"
+
+// maxDatagramSize is large enough for mDNS (9000) and SSDP.
+const maxDatagramSize = 9000
+
+// Listen opens a socket that receives the datagrams sent to addr,
+// which must be an IPv4 multicast address or the limited broadcast address.
+//
+// Multicast loopback is enabled so that the local processes can receive the relayed datagrams.
+func Listen(addr *net.UDPAddr) (*net.UDPConn, error) {
+	switch {
+	case addr.IP.IsMulticast():
+		conn, err := net.ListenMulticastUDP("udp4", nil, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := ipv4.NewPacketConn(conn).SetMulticastLoopback(true); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	case addr.IP.Equal(net.IPv4bcast):
+		// SO_BROADCAST is set by the Go runtime for UDP sockets
+		return net.ListenUDP("udp4", &net.UDPAddr{Port: addr.Port})
+	default:
+		return nil, fmt.Errorf("address %s is neither a multicast address nor %s", addr.IP, net.IPv4bcast)
+	}
+}
+
+// Relay relays the datagrams between conn and the peer, until ctx is cancelled or an error occurs.
+//
+// send is called for the datagrams received on conn, and recv is called to receive the datagrams
+// from the peer, which are written to addr.
+// The datagrams written by Relay are not sent back to the peer, to avoid loops.
+func Relay(ctx context.Context, conn *net.UDPConn, addr *net.UDPAddr, send func([]byte) error, recv func() ([]byte, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	var recent recentSet
+	errCh := make(chan error, 2)
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if recent.consume(buf[:n]) {
+				continue
+			}
+			if err := send(append([]byte(nil), buf[:n]...)); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			b, err := recv()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			recent.add(b)
+			if _, err := conn.WriteToUDP(b, addr); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		if errors.Is(err, net.ErrClosed) && ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+}
+
+// recentTTL is how long a written datagram is remembered for loop prevention.
+const recentTTL = 2 * time.Second
+
+// recentSet remembers the hashes of the datagrams written recently.
+type recentSet struct {
+	mu sync.Mutex
+	m  map[uint64]time.Time
+}
+
+func hash(b []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return h.Sum64()
+}
+
+func (r *recentSet) add(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.m == nil {
+		r.m = make(map[uint64]time.Time)
+	}
+	for k, t := range r.m {
+		if now.Sub(t) > recentTTL {
+			delete(r.m, k)
+		}
+	}
+	r.m[hash(b)] = now
+}
+
+// consume returns true if b was written recently, and forgets it.
+func (r *recentSet) consume(b []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := hash(b)
+	t, ok := r.m[k]
+	if !ok {
+		return false
+	}
+	delete(r.m, k)
+	return time.Since(t) <= recentTTL
+}
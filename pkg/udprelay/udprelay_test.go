@@ -0,0 +1,23 @@
+package udprelay
+
+import (
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRecentSet(t *testing.T) {
+	var r recentSet
+	assert.Assert(t, !r.consume([]byte("foo")))
+	r.add([]byte("foo"))
+	assert.Assert(t, !r.consume([]byte("bar")))
+	assert.Assert(t, r.consume([]byte("foo")))
+	// consumed only once
+	assert.Assert(t, !r.consume([]byte("foo")))
+}
+
+func TestListenUnicast(t *testing.T) {
+	_, err := Listen(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353})
+	assert.ErrorContains(t, err, "neither a multicast address")
+}
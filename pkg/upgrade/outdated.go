@@ -0,0 +1,41 @@
+package upgrade
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/usrlocalsharelima"
+)
+
+// OutdatedGuestAgent returns true if inst is running with a guest agent binary
+// that is older than the one currently installed on the host.
+//
+// The guest agent is copied into the cidata at each start, so a running instance
+// whose cidata predates the installed binary has not picked it up yet.
+func OutdatedGuestAgent(inst *store.Instance) (bool, error) {
+	if inst.Status != store.StatusRunning || inst.Config == nil {
+		return false, nil
+	}
+	ga, err := usrlocalsharelima.GuestAgentBinary(*inst.Config.OS, *inst.Config.Arch)
+	if err != nil {
+		return false, err
+	}
+	gaSt, err := os.Stat(ga)
+	if errors.Is(err, os.ErrNotExist) {
+		gaSt, err = os.Stat(ga + ".gz")
+	}
+	if err != nil {
+		return false, err
+	}
+	cidataSt, err := os.Stat(filepath.Join(inst.Dir, filenames.CIDataISO))
+	if errors.Is(err, os.ErrNotExist) {
+		cidataSt, err = os.Stat(filepath.Join(inst.Dir, filenames.CIDataISODir))
+	}
+	if err != nil {
+		return false, err
+	}
+	return gaSt.ModTime().After(cidataSt.ModTime()), nil
+}
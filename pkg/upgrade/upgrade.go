@@ -0,0 +1,301 @@
+// Package upgrade implements `limactl upgrade`.
+package upgrade
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/lima-vm/lima/pkg/httpclientutil"
+	"github.com/lima-vm/lima/pkg/progress"
+	"github.com/lima-vm/lima/pkg/version/versionutil"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Repo is the GitHub repository that hosts the releases.
+	Repo = "lima-vm/lima"
+	// SHA256SUMS is the name of the checksum file attached to each release.
+	SHA256SUMS = "SHA256SUMS"
+)
+
+var latestReleaseURL = "https://api.github.com/repos/" + Repo + "/releases/latest"
+
+type Release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []Asset `json:"assets"`
+}
+
+type Asset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// LatestRelease returns the latest release published on GitHub.
+func LatestRelease(ctx context.Context) (*Release, error) {
+	resp, err := httpclientutil.Get(ctx, http.DefaultClient, latestReleaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the latest release: %w", err)
+	}
+	defer resp.Body.Close()
+	var rel Release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("failed to decode the latest release: %w", err)
+	}
+	if rel.TagName == "" {
+		return nil, errors.New("the latest release has no tag")
+	}
+	return &rel, nil
+}
+
+func (rel *Release) asset(name string) (*Asset, error) {
+	for i := range rel.Assets {
+		if rel.Assets[i].Name == name {
+			return &rel.Assets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s does not contain %q", rel.TagName, name)
+}
+
+// UpdateAvailable returns true if latest is newer than current.
+// Development builds that do not carry a release version are never considered outdated.
+func UpdateAvailable(current, latest string) bool {
+	if _, err := versionutil.Parse(current); err != nil {
+		return false
+	}
+	l, err := versionutil.Parse(latest)
+	if err != nil {
+		return false
+	}
+	return !versionutil.GreaterEqual(current, l.String())
+}
+
+// ArtifactName returns the name of the release archive for the host, e.g.,
+// "lima-1.0.0-Darwin-arm64.tar.gz".
+func ArtifactName(version string) string {
+	goos := runtime.GOOS
+	ostype := strings.ToUpper(goos[:1]) + goos[1:]
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		// macOS's `uname -m` says "arm64"
+		if goos != "darwin" {
+			arch = "aarch64"
+		}
+	}
+	return fmt.Sprintf("lima-%s-%s-%s.tar.gz", strings.TrimPrefix(version, "v"), ostype, arch)
+}
+
+// Prefix returns the installation prefix of the running limactl, e.g., "/usr/local".
+func Prefix() (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	self, err = filepath.EvalSymlinks(self)
+	if err != nil {
+		return "", err
+	}
+	prefix := filepath.Dir(filepath.Dir(self))
+	if _, err := os.Stat(filepath.Join(prefix, "share", "lima")); err != nil {
+		return "", fmt.Errorf("%q does not look like a Lima installation prefix (missing share/lima): %w", prefix, err)
+	}
+	return prefix, nil
+}
+
+type DownloadOptions struct {
+	// SkipVerify skips the verification of the build provenance.
+	// The SHA256 checksum is always verified.
+	SkipVerify bool
+}
+
+// Download downloads the release archive for the host into dir and verifies it.
+// The returned path points to the verified archive.
+func Download(ctx context.Context, rel *Release, dir string, opts DownloadOptions) (string, error) {
+	name := ArtifactName(rel.TagName)
+	archiveAsset, err := rel.asset(name)
+	if err != nil {
+		return "", err
+	}
+	sumsAsset, err := rel.asset(SHA256SUMS)
+	if err != nil {
+		return "", err
+	}
+	sumsPath := filepath.Join(dir, SHA256SUMS)
+	if err := downloadFile(ctx, sumsAsset.BrowserDownloadURL, sumsPath); err != nil {
+		return "", err
+	}
+	archivePath := filepath.Join(dir, name)
+	if err := downloadFile(ctx, archiveAsset.BrowserDownloadURL, archivePath); err != nil {
+		return "", err
+	}
+	sumsF, err := os.Open(sumsPath)
+	if err != nil {
+		return "", err
+	}
+	defer sumsF.Close()
+	expected, err := lookupSHA256(sumsF, name)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySHA256(archivePath, expected); err != nil {
+		return "", err
+	}
+	if opts.SkipVerify {
+		logrus.Warnf("Skipping the build provenance verification of %q", name)
+	} else if err := verifyAttestation(ctx, archivePath); err != nil {
+		return "", err
+	}
+	return archivePath, nil
+}
+
+func downloadFile(ctx context.Context, url, path string) error {
+	resp, err := httpclientutil.Get(ctx, http.DefaultClient, url)
+	if err != nil {
+		return fmt.Errorf("failed to download %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bar := progress.New("Downloading "+url, resp.ContentLength)
+	bar.Start()
+	defer bar.Finish()
+	if _, err := io.Copy(f, bar.NewProxyReader(resp.Body)); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to download %q: %w", url, err)
+	}
+	return f.Close()
+}
+
+// lookupSHA256 returns the digest of name in the `sha256sum` output read from r.
+func lookupSHA256(r io.Reader, name string) (string, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s does not contain %q", SHA256SUMS, name)
+}
+
+func verifySHA256(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("expected digest of %q to be %q, got %q", path, expected, actual)
+	}
+	return nil
+}
+
+// verifyAttestation verifies the signed build provenance that is published by the release workflow.
+func verifyAttestation(ctx context.Context, path string) error {
+	gh, err := exec.LookPath("gh")
+	if err != nil {
+		return fmt.Errorf("the GitHub CLI (`gh`) is required to verify the build provenance (use --insecure-skip-verify to skip): %w", err)
+	}
+	cmd := exec.CommandContext(ctx, gh, "attestation", "verify", path, "--repo", Repo)
+	logrus.Debugf("Running %v", cmd.Args)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to verify the build provenance of %q: %w (out=%q)", path, err, string(out))
+	}
+	return nil
+}
+
+// Install extracts the release archive over prefix.
+// Each file is written next to its destination and renamed into place,
+// so that the running limactl and hostagent processes are not affected.
+func Install(archivePath, prefix string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dst, err := securejoin.SecureJoin(prefix, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := installFile(tr, dst, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, dst); err != nil {
+				return err
+			}
+		default:
+			logrus.Debugf("Ignoring %q (type %q)", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func installFile(r io.Reader, dst string, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
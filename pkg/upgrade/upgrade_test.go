@@ -0,0 +1,75 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestUpdateAvailable(t *testing.T) {
+	assert.Equal(t, UpdateAvailable("v1.0.0", "v1.0.1"), true)
+	assert.Equal(t, UpdateAvailable("v1.0.1", "v1.0.1"), false)
+	assert.Equal(t, UpdateAvailable("v1.0.1-16-gf3dc6ed", "v1.0.1"), false)
+	assert.Equal(t, UpdateAvailable("v1.1.0", "v1.0.1"), false)
+	assert.Equal(t, UpdateAvailable("f3dc6ed", "v1.0.1"), false)
+}
+
+func TestArtifactName(t *testing.T) {
+	name := ArtifactName("v1.0.0")
+	assert.Assert(t, strings.HasPrefix(name, "lima-1.0.0-"), name)
+	if runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
+		assert.Equal(t, name, "lima-1.0.0-Linux-x86_64.tar.gz")
+	}
+}
+
+func TestLookupSHA256(t *testing.T) {
+	sums := "aaaa  lima-1.0.0-Darwin-arm64.tar.gz\nbbbb *lima-1.0.0-Linux-x86_64.tar.gz\n"
+	digest, err := lookupSHA256(strings.NewReader(sums), "lima-1.0.0-Linux-x86_64.tar.gz")
+	assert.NilError(t, err)
+	assert.Equal(t, digest, "bbbb")
+	_, err = lookupSHA256(strings.NewReader(sums), "lima-1.0.0-Linux-riscv64.tar.gz")
+	assert.ErrorContains(t, err, "does not contain")
+}
+
+func TestInstall(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "lima.tar.gz")
+	f, err := os.Create(archive)
+	assert.NilError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	files := map[string]string{
+		"./bin/limactl":                  "limactl",
+		"./share/lima/templates/default": "template",
+		"../escape":                      "escape",
+	}
+	for name, content := range files {
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(content))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	assert.NilError(t, gz.Close())
+	assert.NilError(t, f.Close())
+
+	prefix := filepath.Join(dir, "prefix")
+	assert.NilError(t, os.MkdirAll(filepath.Join(prefix, "bin"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(prefix, "bin", "limactl"), []byte("old"), 0o755))
+	assert.NilError(t, Install(archive, prefix))
+
+	b, err := os.ReadFile(filepath.Join(prefix, "bin", "limactl"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "limactl")
+	b, err = os.ReadFile(filepath.Join(prefix, "share", "lima", "templates", "default"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "template")
+	// "../escape" is confined to the prefix
+	_, err = os.Stat(filepath.Join(dir, "escape"))
+	assert.Assert(t, os.IsNotExist(err))
+}
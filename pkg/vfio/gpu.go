@@ -0,0 +1,127 @@
+package vfio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// GPUAuto selects the GPUs of the host that are not used for the host console.
+const GPUAuto = "auto"
+
+// iommuGroups is replaced in the tests.
+var iommuGroups = "/sys/kernel/iommu_groups"
+
+// CheckIOMMU checks that the IOMMU is enabled on the host.
+func CheckIOMMU() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("PCI passthrough is only supported on Linux hosts, not on %s", runtime.GOOS)
+	}
+	groups, err := os.ReadDir(iommuGroups)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(groups) == 0 {
+		return errors.New("the IOMMU is not enabled; enable it in the firmware settings and in the kernel command line (e.g., `intel_iommu=on` or `amd_iommu=on`)")
+	}
+	return nil
+}
+
+// ResolveGPUs returns the PCI addresses of the GPUs of the IDs, "VENDOR:DEVICE" in hex (e.g., "10de:2684"), or [GPUAuto].
+// The other functions of the GPUs, e.g., the HDMI audio controllers, are included too, as they share the IOMMU group
+// with the GPUs in most cases.
+func ResolveGPUs(ids []string) ([]string, error) {
+	if err := CheckIOMMU(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(sysfsDevices)
+	if err != nil {
+		return nil, err
+	}
+	var gpus []string
+	for _, id := range ids {
+		var found bool
+		for _, e := range entries {
+			addr := e.Name()
+			ok, err := matchGPU(addr, id)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				gpus = append(gpus, addr)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no GPU matches %q", id)
+		}
+	}
+	var addrs []string
+	for _, gpu := range gpus {
+		slot, _, _ := strings.Cut(gpu, ".")
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), slot+".") && !slices.Contains(addrs, e.Name()) {
+				addrs = append(addrs, e.Name())
+			}
+		}
+	}
+	slices.Sort(addrs)
+	return addrs, nil
+}
+
+func matchGPU(addr, id string) (bool, error) {
+	class, err := readAttr(addr, "class")
+	if err != nil {
+		return false, err
+	}
+	// 0x03: display controller
+	if !strings.HasPrefix(class, "0x03") {
+		return false, nil
+	}
+	if id == GPUAuto {
+		bootVGA, err := readAttr(addr, "boot_vga")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		return bootVGA != "1", nil
+	}
+	vendor, err := readAttr(addr, "vendor")
+	if err != nil {
+		return false, err
+	}
+	device, err := readAttr(addr, "device")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimPrefix(vendor, "0x")+":"+strings.TrimPrefix(device, "0x") == id, nil
+}
+
+// readAttr reads the sysfs attribute of the device, e.g., "0x10de" for "vendor".
+func readAttr(addr, name string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(sysfsDevices, addr, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(string(b))), nil
+}
+
+// Addresses returns the PCI addresses of the devices and of the GPUs, without duplicates.
+func Addresses(pci, gpus []string) ([]string, error) {
+	addrs := slices.Clone(pci)
+	if len(gpus) > 0 {
+		resolved, err := ResolveGPUs(gpus)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range resolved {
+			if !slices.Contains(addrs, addr) {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs, nil
+}
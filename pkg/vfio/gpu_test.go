@@ -0,0 +1,59 @@
+package vfio
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func fakePCIDevice(t *testing.T, addr, vendor, device, class string) {
+	t.Helper()
+	fakeDevice(t, addr, "1", "")
+	devDir := filepath.Join(sysfsDevices, addr)
+	for name, value := range map[string]string{"vendor": vendor, "device": device, "class": class} {
+		assert.NilError(t, os.WriteFile(filepath.Join(devDir, name), []byte(value+"\n"), 0o644))
+	}
+}
+
+func TestResolveGPUs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("VFIO is only supported on Linux")
+	}
+	sysfsDevices = t.TempDir()
+	iommuGroups = t.TempDir()
+	t.Cleanup(func() {
+		sysfsDevices = "/sys/bus/pci/devices"
+		iommuGroups = "/sys/kernel/iommu_groups"
+	})
+
+	_, err := ResolveGPUs([]string{GPUAuto})
+	assert.ErrorContains(t, err, "the IOMMU is not enabled")
+	assert.NilError(t, os.Mkdir(filepath.Join(iommuGroups, "1"), 0o755))
+
+	// the console GPU
+	fakePCIDevice(t, "0000:00:02.0", "0x8086", "0x3e92", "0x030000")
+	assert.NilError(t, os.WriteFile(filepath.Join(sysfsDevices, "0000:00:02.0", "boot_vga"), []byte("1\n"), 0o644))
+	// the NVIDIA GPU and its HDMI audio controller
+	fakePCIDevice(t, "0000:01:00.0", "0x10de", "0x2684", "0x030000")
+	fakePCIDevice(t, "0000:01:00.1", "0x10de", "0x22ba", "0x040300")
+	// NVMe
+	fakePCIDevice(t, "0000:02:00.0", "0x144d", "0xa808", "0x010802")
+
+	addrs, err := ResolveGPUs([]string{GPUAuto})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, addrs, []string{"0000:01:00.0", "0000:01:00.1"})
+
+	addrs, err = ResolveGPUs([]string{"8086:3e92"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, addrs, []string{"0000:00:02.0"})
+
+	_, err = ResolveGPUs([]string{"10de:22ba"})
+	assert.ErrorContains(t, err, `no GPU matches "10de:22ba"`)
+
+	addrs, err = Addresses([]string{"0000:02:00.0", "0000:01:00.1"}, []string{"10de:2684"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, addrs, []string{"0000:02:00.0", "0000:01:00.1", "0000:01:00.0"})
+}
@@ -0,0 +1,20 @@
+package vfio
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// CheckMemlock checks that RLIMIT_MEMLOCK allows locking the guest memory, as VFIO pins the whole guest memory.
+func CheckMemlock(memBytes uint64) error {
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &rlim); err != nil {
+		return err
+	}
+	if rlim.Cur != unix.RLIM_INFINITY && rlim.Cur < memBytes {
+		return fmt.Errorf("RLIMIT_MEMLOCK (%d bytes) is smaller than the memory of the instance (%d bytes); "+
+			"raise `memlock` in /etc/security/limits.conf (or `LimitMEMLOCK` of the systemd user service)", rlim.Cur, memBytes)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package vfio
+
+func CheckMemlock(_ uint64) error {
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package vfio checks and prepares the host PCI devices for the passthrough with VFIO on Linux.
+//
+// A device can be passed through when:
+//   - the IOMMU is enabled (e.g., `intel_iommu=on` in the kernel command line), so that the device belongs to an IOMMU group,
+//   - the device is bound to the vfio-pci driver, and
+//   - the current user can open the VFIO group device, "/dev/vfio/<GROUP>".
+//
+// The latter two require the root privilege; they can be automated with the sudoers rules generated by [Sudoers].
+package vfio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const Driver = "vfio-pci"
+
+// sysfsDevices and devVFIO are replaced in the tests.
+var (
+	sysfsDevices = "/sys/bus/pci/devices"
+	devVFIO      = "/dev/vfio"
+)
+
+// ErrNotReady is returned by [Check] when the device exists but is not ready for the passthrough,
+// i.e., not bound to vfio-pci, or the VFIO group device is not accessible.
+var ErrNotReady = errors.New("not ready for VFIO")
+
+// Device is a host PCI device.
+type Device struct {
+	// Address is the PCI address, e.g., "0000:01:00.0".
+	Address string
+	// IOMMUGroup is the IOMMU group, e.g., "12".
+	IOMMUGroup string
+	// Driver is the driver bound to the device, e.g., "vfio-pci". Empty when no driver is bound.
+	Driver string
+}
+
+// GroupDevice returns the path of the VFIO group device, "/dev/vfio/<GROUP>".
+func (d *Device) GroupDevice() string {
+	return filepath.Join(devVFIO, d.IOMMUGroup)
+}
+
+// Inspect returns the device of the PCI address.
+func Inspect(addr string) (*Device, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("PCI passthrough is only supported on Linux hosts, not on %s", runtime.GOOS)
+	}
+	devDir := filepath.Join(sysfsDevices, addr)
+	if _, err := os.Stat(devDir); err != nil {
+		return nil, fmt.Errorf("PCI device %q does not exist: %w", addr, err)
+	}
+	group, err := os.Readlink(filepath.Join(devDir, "iommu_group"))
+	if err != nil {
+		return nil, fmt.Errorf("PCI device %q has no IOMMU group; make sure that the IOMMU is enabled (e.g., `intel_iommu=on` or `amd_iommu=on` in the kernel command line): %w", addr, err)
+	}
+	dev := &Device{
+		Address:    addr,
+		IOMMUGroup: filepath.Base(group),
+	}
+	if driver, err := os.Readlink(filepath.Join(devDir, "driver")); err == nil {
+		dev.Driver = filepath.Base(driver)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return dev, nil
+}
+
+// Check checks that the device is ready for the passthrough.
+// The error wraps [ErrNotReady] when the device can be prepared with [Prepare].
+func Check(addr string) (*Device, error) {
+	dev, err := Inspect(addr)
+	if err != nil {
+		return nil, err
+	}
+	if dev.Driver != Driver {
+		return dev, fmt.Errorf("PCI device %q is bound to %q, not to %q: %w", addr, dev.Driver, Driver, ErrNotReady)
+	}
+	f, err := os.OpenFile(dev.GroupDevice(), os.O_RDWR, 0)
+	if err != nil {
+		return dev, fmt.Errorf("PCI device %q: failed to open the VFIO group device: %w: %w", addr, err, ErrNotReady)
+	}
+	_ = f.Close()
+	return dev, nil
+}
+
+// Prepare checks the devices, and tries to bind them to vfio-pci and to grant the access to
+// the VFIO group devices with `sudo --non-interactive`, using the commands allowed by [Sudoers].
+func Prepare(ctx context.Context, addrs []string) error {
+	for _, addr := range addrs {
+		dev, err := Check(addr)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrNotReady) {
+			return err
+		}
+		logrus.WithError(err).Infof("Preparing PCI device %q for VFIO with sudo", addr)
+		cmds, cmdErr := commands(dev)
+		if cmdErr != nil {
+			return cmdErr
+		}
+		for _, args := range cmds {
+			cmd := exec.CommandContext(ctx, "sudo", append([]string{"--non-interactive"}, args...)...)
+			if out, cmdErr := cmd.CombinedOutput(); cmdErr != nil {
+				return fmt.Errorf("%w (failed to run %v: %q: %w; Hint: run `limactl sudoers | sudo tee /etc/sudoers.d/lima`)",
+					err, cmd.Args, string(out), cmdErr)
+			}
+		}
+		if _, err := Check(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commands returns the commands to be executed with sudo for preparing the device.
+func commands(dev *Device) ([][]string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{
+		// driverctl persists the override across reboots, and is packaged by the major distributions
+		{lookPath("driverctl", "/usr/sbin/driverctl"), "set-override", dev.Address, Driver},
+		{lookPath("chown", "/usr/bin/chown"), u.Username, dev.GroupDevice()},
+	}, nil
+}
+
+// lookPath returns the absolute path of the command, as sudoers requires absolute paths.
+func lookPath(name, fallback string) string {
+	p, err := exec.LookPath(name)
+	if err == nil {
+		p, err = filepath.Abs(p)
+	}
+	if err != nil {
+		logrus.WithError(err).Debugf("%q not found, assuming %q", name, fallback)
+		return fallback
+	}
+	return p
+}
+
+// Sudoers returns the content of the sudoers file that allows the current user to prepare the devices
+// for the passthrough without a password.
+func Sudoers(addrs []string) (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, addr := range addrs {
+		dev, err := Inspect(addr)
+		if err != nil {
+			return "", err
+		}
+		cmds, err := commands(dev)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "# Prepare PCI device %q (IOMMU group %s) for VFIO\n", dev.Address, dev.IOMMUGroup)
+		fmt.Fprintf(&sb, "%s ALL=(root:root) NOPASSWD:NOSETENV: \\\n", u.Username)
+		for i, args := range cmds {
+			sep := ", \\"
+			if i == len(cmds)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&sb, "    %s%s\n", strings.Join(args, " "), sep)
+		}
+		sb.WriteRune('\n')
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,57 @@
+package vfio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func fakeDevice(t *testing.T, addr, group, driver string) {
+	t.Helper()
+	devDir := filepath.Join(sysfsDevices, addr)
+	assert.NilError(t, os.MkdirAll(devDir, 0o755))
+	if group != "" {
+		assert.NilError(t, os.Symlink("../../../../kernel/iommu_groups/"+group, filepath.Join(devDir, "iommu_group")))
+	}
+	if driver != "" {
+		assert.NilError(t, os.Symlink("../../../../bus/pci/drivers/"+driver, filepath.Join(devDir, "driver")))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("VFIO is only supported on Linux")
+	}
+	sysfsDevices = t.TempDir()
+	devVFIO = t.TempDir()
+	t.Cleanup(func() {
+		sysfsDevices = "/sys/bus/pci/devices"
+		devVFIO = "/dev/vfio"
+	})
+
+	_, err := Check("0000:01:00.0")
+	assert.ErrorContains(t, err, "does not exist")
+
+	fakeDevice(t, "0000:01:00.0", "", "")
+	_, err = Check("0000:01:00.0")
+	assert.ErrorContains(t, err, "has no IOMMU group")
+
+	fakeDevice(t, "0000:02:00.0", "12", "nvme")
+	dev, err := Check("0000:02:00.0")
+	assert.Assert(t, errors.Is(err, ErrNotReady), err)
+	assert.Equal(t, dev.IOMMUGroup, "12")
+	assert.Equal(t, dev.Driver, "nvme")
+
+	fakeDevice(t, "0000:03:00.0", "13", Driver)
+	_, err = Check("0000:03:00.0")
+	assert.Assert(t, errors.Is(err, ErrNotReady), err)
+
+	assert.NilError(t, os.WriteFile(filepath.Join(devVFIO, "13"), nil, 0o600))
+	dev, err = Check("0000:03:00.0")
+	assert.NilError(t, err)
+	assert.Equal(t, dev.GroupDevice(), filepath.Join(devVFIO, "13"))
+}
@@ -0,0 +1,29 @@
+package vz
+
+import (
+	"runtime"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// Capabilities returns the capability manifest of the VZ driver.
+// The manifest is available regardless of whether the driver is Enabled,
+// so that templates can be validated on any host.
+func Capabilities() limayaml.DriverCapabilities {
+	return limayaml.DriverCapabilities{
+		MountTypes:           []limayaml.MountType{limayaml.REVSSHFS, limayaml.VIRTIOFS, limayaml.NFS},
+		Arches:               []limayaml.Arch{limayaml.NewArch(runtime.GOARCH)},
+		DisplayTypes:         []string{"vz", "default", "none"},
+		Snapshot:             true,
+		NestedVirtualization: true,
+		EgressPolicy:         true,
+		MetadataService:      true,
+		VideoAccel:           true,
+		AdditionalUsers:      true,
+		Pause:                true,
+		// SaveMachineStateToPath is available only on Apple silicon, with macOS 14 or later
+		Suspend: runtime.GOARCH == "arm64",
+		// The disk is cloned while the VM is paused
+		LiveClone: true,
+	}
+}
@@ -10,26 +10,30 @@ import (
 	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/fileutils"
+	"github.com/lima-vm/lima/pkg/imagestore"
 	"github.com/lima-vm/lima/pkg/iso9660util"
 	"github.com/lima-vm/lima/pkg/nativeimgutil"
+	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
 )
 
 func EnsureDisk(ctx context.Context, driver *driver.BaseDriver) error {
-	diffDisk := filepath.Join(driver.Instance.Dir, filenames.DiffDisk)
+	storageDir := store.StorageDir(driver.Instance.Dir, driver.Instance.Config)
+	diffDisk := filepath.Join(storageDir, filenames.DiffDisk)
 	if _, err := os.Stat(diffDisk); err == nil || !errors.Is(err, os.ErrNotExist) {
 		// disk is already ensured
 		return err
 	}
 
-	baseDisk := filepath.Join(driver.Instance.Dir, filenames.BaseDisk)
+	baseDisk := filepath.Join(storageDir, filenames.BaseDisk)
 	kernel := filepath.Join(driver.Instance.Dir, filenames.Kernel)
 	kernelCmdline := filepath.Join(driver.Instance.Dir, filenames.KernelCmdline)
 	initrd := filepath.Join(driver.Instance.Dir, filenames.Initrd)
 	if _, err := os.Stat(baseDisk); errors.Is(err, os.ErrNotExist) {
 		var ensuredBaseDisk bool
 		errs := make([]error, len(driver.Instance.Config.Images))
-		for i, f := range driver.Instance.Config.Images {
+		for i, f := range fileutils.ImagesByMirrorScore(driver.Instance.Config.Images) {
 			if _, err := fileutils.DownloadFile(ctx, baseDisk, f.File, true, "the image", *driver.Instance.Config.Arch); err != nil {
 				errs[i] = err
 				continue
@@ -59,6 +63,11 @@ func EnsureDisk(ctx context.Context, driver *driver.BaseDriver) error {
 		if !ensuredBaseDisk {
 			return fileutils.Errors(errs)
 		}
+		if imagestore.Enabled() {
+			if err := imagestore.Dedup(baseDisk); err != nil {
+				logrus.WithError(err).Warn("Failed to share the base disk with the image store")
+			}
+		}
 	}
 	diskSize, _ := units.RAMInBytes(*driver.Instance.Config.Disk)
 	if diskSize == 0 {
@@ -85,3 +94,32 @@ func EnsureDisk(ctx context.Context, driver *driver.BaseDriver) error {
 	}
 	return err
 }
+
+// ResizeDisk grows the raw diffdisk of the instance, by extending the sparse file.
+func ResizeDisk(driver *driver.BaseDriver, size int64) error {
+	diffDisk := filepath.Join(store.StorageDir(driver.Instance.Dir, driver.Instance.Config), filenames.DiffDisk)
+	diffDiskF, err := os.OpenFile(diffDisk, os.O_RDWR, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// the disk will be created with the new size on the first start
+			return nil
+		}
+		return err
+	}
+	defer diffDiskF.Close()
+	st, err := diffDiskF.Stat()
+	if err != nil {
+		return err
+	}
+	if size < st.Size() {
+		return fmt.Errorf("specified size %q is less than the current disk size %q. Disk shrinking is currently unavailable",
+			units.BytesSize(float64(size)), units.BytesSize(float64(st.Size())))
+	}
+	if size == st.Size() {
+		return nil
+	}
+	if err := nativeimgutil.MakeSparse(diffDiskF, size); err != nil {
+		return err
+	}
+	return diffDiskF.Close()
+}
@@ -6,3 +6,6 @@ import "errors"
 
 //nolint:revive // error-strings
 var errRosettaUnsupported = errors.New("Rosetta is unsupported on non-ARM64 hosts")
+
+//nolint:revive // error-strings
+var errMachineStateUnsupported = errors.New("Saving the machine state is unsupported on non-ARM64 hosts")
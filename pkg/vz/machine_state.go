@@ -0,0 +1,15 @@
+//go:build darwin && !arm64 && !no_vz
+
+package vz
+
+import (
+	"github.com/Code-Hex/vz/v3"
+)
+
+func saveMachineState(_ *vz.VirtualMachine, _ string) error {
+	return errMachineStateUnsupported
+}
+
+func restoreMachineState(_ *vz.VirtualMachine, _ string) error {
+	return errMachineStateUnsupported
+}
@@ -0,0 +1,17 @@
+//go:build darwin && arm64 && !no_vz
+
+package vz
+
+import (
+	"github.com/Code-Hex/vz/v3"
+)
+
+// saveMachineState saves the state of the paused machine to path. Requires macOS 14 or later.
+func saveMachineState(machine *vz.VirtualMachine, path string) error {
+	return machine.SaveMachineStateToPath(path)
+}
+
+// restoreMachineState restores the state of the stopped machine from path. The machine is paused after the restoration.
+func restoreMachineState(machine *vz.VirtualMachine, path string) error {
+	return machine.RestoreMachineStateFromURL(path)
+}
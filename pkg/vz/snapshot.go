@@ -0,0 +1,150 @@
+package vz
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/containerd/containerd/identifiers"
+	"github.com/containerd/continuity/fs"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshotFiles are the files saved in a snapshot.
+// The files are copied with clonefile(2) on APFS, so a snapshot does not consume extra space until the disk is modified.
+var snapshotFiles = []string{filenames.DiffDisk, filenames.VzEfi}
+
+// snapshotFileDir returns the directory of the snapshot file f of the instance.
+// The disk is in the storage directory (see store.StorageDir), the other files are in the instance directory.
+func snapshotFileDir(instDir, storageDir, f string) string {
+	if f == filenames.DiffDisk {
+		return storageDir
+	}
+	return instDir
+}
+
+// snapshotDir returns the directory of the snapshot.
+// The snapshots are stored in the storage directory, next to the disk, so that the disk can be cloned.
+func snapshotDir(storageDir, tag string) (string, error) {
+	if err := identifiers.Validate(tag); err != nil {
+		return "", fmt.Errorf("invalid snapshot tag %q: %w", tag, err)
+	}
+	return filepath.Join(storageDir, filenames.VzSnapshotsDir, tag), nil
+}
+
+// SaveSnapshot saves the disk and the EFI variable store of the stopped instance as a snapshot.
+func SaveSnapshot(instDir, storageDir, tag string) error {
+	dir, err := snapshotDir(storageDir, tag)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("snapshot %q already exists", tag)
+		}
+		return err
+	}
+	for _, f := range snapshotFiles {
+		src := filepath.Join(snapshotFileDir(instDir, storageDir, f), f)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		// continuity attempts clonefile
+		if err := fs.CopyFile(filepath.Join(dir, f), src); err != nil {
+			_ = os.RemoveAll(dir)
+			return fmt.Errorf("failed to copy %q into snapshot %q: %w", src, tag, err)
+		}
+	}
+	return nil
+}
+
+// LoadSnapshot restores the disk and the EFI variable store of the stopped instance from a snapshot.
+// The snapshot is kept, so it can be loaded again.
+func LoadSnapshot(instDir, storageDir, tag string) error {
+	dir, err := snapshotDir(storageDir, tag)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("snapshot %q does not exist", tag)
+		}
+		return err
+	}
+	for _, f := range snapshotFiles {
+		src := filepath.Join(dir, f)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		dst := filepath.Join(snapshotFileDir(instDir, storageDir, f), f)
+		// Copy into a temporary file first, so that the instance is not left with a partially copied disk
+		tmp := dst + ".snapshot.tmp"
+		if err := fs.CopyFile(tmp, src); err != nil {
+			_ = os.RemoveAll(tmp)
+			return fmt.Errorf("failed to copy %q from snapshot %q: %w", f, tag, err)
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			_ = os.RemoveAll(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSnapshot deletes a snapshot.
+func DeleteSnapshot(storageDir, tag string) error {
+	dir, err := snapshotDir(storageDir, tag)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("snapshot %q does not exist", tag)
+		}
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// ListSnapshots returns the list of the snapshots, with header and newlines,
+// in a format similar to `qemu-img snapshot -l`.
+// It returns an empty string when there is no snapshot.
+func ListSnapshots(storageDir string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(storageDir, filenames.VzSnapshotsDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 4, 8, 4, ' ', 0)
+	var n int
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			logrus.WithError(err).Warnf("failed to inspect snapshot %q", e.Name())
+			continue
+		}
+		if n == 0 {
+			fmt.Fprintln(w, "ID\tTAG\tDATE")
+		}
+		n++
+		fmt.Fprintf(w, "%d\t%s\t%s\n", n, e.Name(), info.ModTime().Format(time.DateTime))
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,49 @@
+package vz
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	instDir := t.TempDir()
+	storageDir := t.TempDir()
+	diffDisk := filepath.Join(storageDir, filenames.DiffDisk)
+	assert.NilError(t, os.WriteFile(diffDisk, []byte("before"), 0o644))
+	vzEfi := filepath.Join(instDir, filenames.VzEfi)
+	assert.NilError(t, os.WriteFile(vzEfi, []byte("efi-before"), 0o644))
+
+	out, err := ListSnapshots(storageDir)
+	assert.NilError(t, err)
+	assert.Equal(t, out, "")
+
+	assert.NilError(t, SaveSnapshot(instDir, storageDir, "snap1"))
+	assert.ErrorContains(t, SaveSnapshot(instDir, storageDir, "snap1"), "already exists")
+	assert.ErrorContains(t, SaveSnapshot(instDir, storageDir, "../snap"), "invalid snapshot tag")
+
+	assert.NilError(t, os.WriteFile(diffDisk, []byte("after"), 0o644))
+	assert.NilError(t, os.WriteFile(vzEfi, []byte("efi-after"), 0o644))
+	assert.NilError(t, LoadSnapshot(instDir, storageDir, "snap1"))
+	b, err := os.ReadFile(diffDisk)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "before")
+	b, err = os.ReadFile(vzEfi)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "efi-before")
+
+	out, err = ListSnapshots(storageDir)
+	assert.NilError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, len(lines), 2)
+	assert.Equal(t, strings.Fields(lines[0])[1], "TAG")
+	assert.Equal(t, strings.Fields(lines[1])[1], "snap1")
+
+	assert.NilError(t, DeleteSnapshot(storageDir, "snap1"))
+	assert.ErrorContains(t, DeleteSnapshot(storageDir, "snap1"), "does not exist")
+	assert.ErrorContains(t, LoadSnapshot(instDir, storageDir, "snap1"), "does not exist")
+}
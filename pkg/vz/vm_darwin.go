@@ -15,7 +15,6 @@ import (
 	"syscall"
 
 	"github.com/Code-Hex/vz/v3"
-	"github.com/coreos/go-semver/semver"
 	"github.com/docker/go-units"
 	"github.com/lima-vm/go-qcow2reader"
 	"github.com/lima-vm/go-qcow2reader/image/raw"
@@ -26,7 +25,6 @@ import (
 	"github.com/lima-vm/lima/pkg/nativeimgutil"
 	"github.com/lima-vm/lima/pkg/networks"
 	"github.com/lima-vm/lima/pkg/networks/usernet"
-	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
 	"github.com/sirupsen/logrus"
@@ -59,7 +57,12 @@ func startVM(ctx context.Context, driver *driver.BaseDriver) (*virtualMachineWra
 		return nil, nil, err
 	}
 
-	err = machine.Start()
+	if driver.RestoreState != "" {
+		err = restoreVM(machine, driver.RestoreState)
+		driver.RestoreState = ""
+	} else {
+		err = machine.Start()
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -114,7 +117,14 @@ func startVM(ctx context.Context, driver *driver.BaseDriver) (*virtualMachineWra
 					wrapper.stopped = true
 					wrapper.mu.Unlock()
 					_ = usernetClient.UnExposeSSH(driver.SSHLocalPort)
-					errCh <- errors.New("vz driver state stopped")
+					// nil, as the guest has shut down by itself
+					errCh <- nil
+				case vz.VirtualMachineStateError:
+					logrus.Error("[VZ] - vm state change: error")
+					// Remove the pid file so that the VM can be started again by `restartPolicy`
+					_ = os.RemoveAll(filepath.Join(driver.Instance.Dir, filenames.PIDFile(*driver.Instance.Config.VMType)))
+					_ = usernetClient.UnExposeSSH(driver.SSHLocalPort)
+					errCh <- errors.New("vz driver state error")
 				default:
 					logrus.Debugf("[VZ] - vm state change: %q", newState)
 				}
@@ -125,9 +135,34 @@ func startVM(ctx context.Context, driver *driver.BaseDriver) (*virtualMachineWra
 	return wrapper, errCh, err
 }
 
+// restoreVM restores the state saved by SaveState, resumes the machine, and removes the state file.
+// The state file is removed on failure too, so that the next start boots the VM from scratch
+// rather than failing again.
+func restoreVM(machine *vz.VirtualMachine, path string) error {
+	logrus.Infof("Restoring the VM state from %q", path)
+	err := restoreMachineState(machine, path)
+	if err == nil {
+		err = machine.Resume()
+	}
+	if rmErr := os.Remove(path); rmErr != nil {
+		logrus.WithError(rmErr).Warnf("Failed to remove the VM state %q", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore the VM state: %w; the VM state has been discarded, and the next start will boot the VM from scratch", err)
+	}
+	logrus.Info("Restored the VM state")
+	return nil
+}
+
 func startUsernet(ctx context.Context, driver *driver.BaseDriver) (*usernet.Client, error) {
 	if firstUsernetIndex := limayaml.FirstUsernetIndex(driver.Instance.Config); firstUsernetIndex != -1 {
 		nwName := driver.Instance.Config.Networks[firstUsernetIndex].Lima
+		if driver.Instance.Config.EgressPolicy != nil {
+			return nil, fmt.Errorf("field `egressPolicy` cannot be used with the shared network %q", nwName)
+		}
+		if *driver.Instance.Config.MetadataService.Enabled {
+			return nil, fmt.Errorf("field `metadataService` cannot be used with the shared network %q", nwName)
+		}
 		return usernet.NewClientByName(nwName), nil
 	}
 	// Start a in-process gvisor-tap-vsock
@@ -141,15 +176,27 @@ func startUsernet(ctx context.Context, driver *driver.BaseDriver) (*usernet.Clie
 	}
 	os.RemoveAll(endpointSock)
 	os.RemoveAll(vzSock)
+	var metadata *usernet.Metadata
+	if *driver.Instance.Config.MetadataService.Enabled {
+		metadata = usernet.NewMetadata(driver.Instance.Dir)
+	}
+	mtu := 1500
+	if *driver.Instance.Config.DHCP.MTU != 0 {
+		mtu = *driver.Instance.Config.DHCP.MTU
+	}
 	err = usernet.StartGVisorNetstack(ctx, &usernet.GVisorNetstackOpts{
-		MTU:      1500,
+		MTU:      mtu,
 		Endpoint: endpointSock,
 		FdSocket: vzSock,
 		Async:    true,
 		DefaultLeases: map[string]string{
 			networks.SlirpIPAddress: limayaml.MACAddress(driver.Instance.Dir),
 		},
-		Subnet: networks.SlirpNetwork,
+		Subnet:        networks.SlirpNetwork,
+		IPv6Subnet:    networks.SlirpIPv6Network,
+		SearchDomains: driver.Instance.Config.DHCP.SearchDomains,
+		EgressPolicy:  driver.Instance.Config.EgressPolicy,
+		Metadata:      metadata,
 	})
 	if err != nil {
 		return nil, err
@@ -239,17 +286,8 @@ func attachPlatformConfig(driver *driver.BaseDriver, vmConfig *vz.VirtualMachine
 
 	// nested virt
 	if *driver.Instance.Config.NestedVirtualization {
-		macOSProductVersion, err := osutil.ProductVersion()
-		if err != nil {
-			return fmt.Errorf("failed to get macOS product version: %w", err)
-		}
-
-		if macOSProductVersion.LessThan(*semver.New("15.0.0")) {
-			return errors.New("nested virtualization requires macOS 15 or newer")
-		}
-
-		if !vz.IsNestedVirtualizationSupported() {
-			return errors.New("nested virtualization is not supported on this device")
+		if err := CheckNestedVirtualization(); err != nil {
+			return err
 		}
 
 		if err := platformConfig.SetNestedVirtualizationEnabled(true); err != nil {
@@ -263,7 +301,11 @@ func attachPlatformConfig(driver *driver.BaseDriver, vmConfig *vz.VirtualMachine
 
 func attachSerialPort(driver *driver.BaseDriver, config *vz.VirtualMachineConfiguration) error {
 	path := filepath.Join(driver.Instance.Dir, filenames.SerialVirtioLog)
-	serialPortAttachment, err := vz.NewFileSerialPortAttachment(path, false)
+	// The log is opened in the append mode, so that the host agent can truncate it on rotation.
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	serialPortAttachment, err := vz.NewFileSerialPortAttachment(path, true)
 	if err != nil {
 		return err
 	}
@@ -351,11 +393,23 @@ func attachNetwork(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfigu
 			if err != nil {
 				return err
 			}
+			isWireGuard, err := nwCfg.WireGuard(nw.Lima)
+			if err != nil {
+				return err
+			}
+			if isWireGuard {
+				// The WireGuard interface runs in the guest over the default network; see pkg/networks/wireguard
+				continue
+			}
 			isUsernet, err := nwCfg.Usernet(nw.Lima)
 			if err != nil {
 				return err
 			}
-			if isUsernet {
+			isSwitch, err := nwCfg.Switch(nw.Lima)
+			if err != nil {
+				return err
+			}
+			if isUsernet || isSwitch {
 				if i == firstUsernetIndex {
 					continue
 				}
@@ -432,8 +486,9 @@ func validateDiskFormat(diskPath string) error {
 }
 
 func attachDisks(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfiguration) error {
-	baseDiskPath := filepath.Join(driver.Instance.Dir, filenames.BaseDisk)
-	diffDiskPath := filepath.Join(driver.Instance.Dir, filenames.DiffDisk)
+	storageDir := store.StorageDir(driver.Instance.Dir, driver.Instance.Config)
+	baseDiskPath := filepath.Join(storageDir, filenames.BaseDisk)
+	diffDiskPath := filepath.Join(storageDir, filenames.DiffDisk)
 	ciDataPath := filepath.Join(driver.Instance.Dir, filenames.CIDataISO)
 	isBaseDiskCDROM, err := iso9660util.IsISO9660(baseDiskPath)
 	if err != nil {
@@ -518,7 +573,13 @@ func attachDisks(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfigura
 }
 
 func attachDisplay(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineConfiguration) error {
-	switch *driver.Instance.Config.Video.Display {
+	display := *driver.Instance.Config.Video.Display
+	if display == "none" && *driver.Instance.Config.Video.Accel {
+		// Virtualization.framework does not provide 3D acceleration to Linux guests,
+		// so `video.accel` just attaches the graphics device without opening a window.
+		display = "vz"
+	}
+	switch display {
 	case "vz", "default":
 		graphicsDeviceConfiguration, err := vz.NewVirtioGraphicsDeviceConfiguration()
 		if err != nil {
@@ -565,7 +626,7 @@ func attachFolderMounts(driver *driver.BaseDriver, vmConfig *vz.VirtualMachineCo
 				return err
 			}
 
-			tag := fmt.Sprintf("mount%d", i)
+			tag := limayaml.MountTag(driver.Instance.Config, i)
 			config, err := vz.NewVirtioFileSystemDeviceConfiguration(tag)
 			if err != nil {
 				return err
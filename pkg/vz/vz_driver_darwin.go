@@ -7,16 +7,22 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/Code-Hex/vz/v3"
+	"github.com/containerd/continuity/fs"
+	"github.com/coreos/go-semver/semver"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/lima-vm/lima/pkg/driver"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/reflectutil"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 )
 
 var knownYamlProperties = []string{
@@ -24,12 +30,15 @@ var knownYamlProperties = []string{
 	"Arch",
 	"Audio",
 	"CACertificates",
+	"CloudInit",
 	"Containerd",
 	"CopyToHost",
 	"CPUs",
 	"CPUType",
+	"DHCP",
 	"Disk",
 	"DNS",
+	"EgressPolicy",
 	"Env",
 	"Firmware",
 	"GuestInstallPrefix",
@@ -37,6 +46,7 @@ var knownYamlProperties = []string{
 	"Images",
 	"Memory",
 	"Message",
+	"MetadataService",
 	"MinimumLimaVersion",
 	"Mounts",
 	"MountType",
@@ -47,13 +57,18 @@ var knownYamlProperties = []string{
 	"OS",
 	"Param",
 	"Plain",
+	"Podman",
 	"PortForwards",
 	"Probes",
 	"PropagateProxyEnv",
 	"Provision",
+	"RestartPolicy",
 	"Rosetta",
+	"Security",
 	"SSH",
+	"Storage",
 	"TimeZone",
+	"UDPRelays",
 	"UpgradePackages",
 	"User",
 	"Video",
@@ -161,6 +176,36 @@ func (l *LimaVzDriver) CreateDisk(ctx context.Context) error {
 	return EnsureDisk(ctx, l.BaseDriver)
 }
 
+// errSnapshotRunning is returned for the snapshot operations against a running instance,
+// as saving the machine state is not supported.
+var errSnapshotRunning = errors.New("vz driver does not support snapshots of a running instance; stop the instance first")
+
+func (l *LimaVzDriver) CreateSnapshot(_ context.Context, tag string) error {
+	if l.Instance.Status == store.StatusRunning {
+		return errSnapshotRunning
+	}
+	return SaveSnapshot(l.Instance.Dir, store.StorageDir(l.Instance.Dir, l.Instance.Config), tag)
+}
+
+func (l *LimaVzDriver) ApplySnapshot(_ context.Context, tag string) error {
+	if l.Instance.Status == store.StatusRunning {
+		return errSnapshotRunning
+	}
+	return LoadSnapshot(l.Instance.Dir, store.StorageDir(l.Instance.Dir, l.Instance.Config), tag)
+}
+
+func (l *LimaVzDriver) DeleteSnapshot(_ context.Context, tag string) error {
+	return DeleteSnapshot(store.StorageDir(l.Instance.Dir, l.Instance.Config), tag)
+}
+
+func (l *LimaVzDriver) ListSnapshots(_ context.Context) (string, error) {
+	return ListSnapshots(store.StorageDir(l.Instance.Dir, l.Instance.Config))
+}
+
+func (l *LimaVzDriver) ResizeDisk(_ context.Context, size int64) error {
+	return ResizeDisk(l.BaseDriver, size)
+}
+
 func (l *LimaVzDriver) Start(ctx context.Context) (chan error, error) {
 	logrus.Infof("Starting VZ (hint: to watch the boot progress, see %q)", filepath.Join(l.Instance.Dir, "serial*.log"))
 	vm, errCh, err := startVM(ctx, l.BaseDriver)
@@ -194,6 +239,13 @@ func (l *LimaVzDriver) RunGUI() error {
 
 func (l *LimaVzDriver) Stop(_ context.Context) error {
 	logrus.Info("Shutting down VZ")
+	l.machine.mu.Lock()
+	stopped := l.machine.stopped
+	l.machine.mu.Unlock()
+	if stopped {
+		// e.g., stopped by SaveState
+		return nil
+	}
 	canStop := l.machine.CanRequestStop()
 
 	if canStop {
@@ -222,6 +274,61 @@ func (l *LimaVzDriver) Stop(_ context.Context) error {
 	return errors.New("vz: CanRequestStop is not supported")
 }
 
+func (l *LimaVzDriver) Pause(_ context.Context) error {
+	if !l.machine.CanPause() {
+		return errors.New("vz: the machine cannot be paused in the current state")
+	}
+	return l.machine.Pause()
+}
+
+func (l *LimaVzDriver) Resume(_ context.Context) error {
+	if !l.machine.CanResume() {
+		return errors.New("vz: the machine cannot be resumed in the current state")
+	}
+	return l.machine.Resume()
+}
+
+func (l *LimaVzDriver) SaveState(ctx context.Context, path string) error {
+	if err := l.Pause(ctx); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	logrus.Infof("Saving the VM state to %q", path)
+	err := saveMachineState(l.machine.VirtualMachine, tmp)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return errors.Join(fmt.Errorf("failed to save the VM state: %w", err), l.machine.Resume())
+	}
+	// Stop terminates the machine without shutting down the guest, and the stop is handled as a stop of the driver
+	if err := l.machine.Stop(); err != nil {
+		_ = os.Remove(path)
+		return errors.Join(err, l.machine.Resume())
+	}
+	return nil
+}
+
+// SnapshotDisk copies the disk while the machine is paused.
+// The copy is made with clonefile(2) on APFS, so the machine is paused only for a moment.
+func (l *LimaVzDriver) SnapshotDisk(ctx context.Context, dst string) (func() error, error) {
+	diffDisk := filepath.Join(store.StorageDir(l.Instance.Dir, l.Instance.Config), filenames.DiffDisk)
+	if err := l.Pause(ctx); err != nil {
+		return nil, err
+	}
+	logrus.Infof("Snapshotting the disk %q to %q", diffDisk, dst)
+	// continuity attempts clonefile
+	if err := fs.CopyFile(dst, diffDisk); err != nil {
+		_ = os.Remove(dst)
+		return nil, errors.Join(fmt.Errorf("failed to copy %q: %w", diffDisk, err), l.Resume(ctx))
+	}
+	if err := l.Resume(ctx); err != nil {
+		return nil, err
+	}
+	return func() error { return nil }, nil
+}
+
 func (l *LimaVzDriver) GuestAgentConn(_ context.Context) (net.Conn, error) {
 	for _, socket := range l.machine.SocketDevices() {
 		connect, err := socket.Connect(uint32(l.VSockPort))
@@ -231,3 +338,18 @@ func (l *LimaVzDriver) GuestAgentConn(_ context.Context) (net.Conn, error) {
 	}
 	return nil, errors.New("unable to connect to guest agent via vsock port 2222")
 }
+
+// CheckNestedVirtualization returns an error if the host does not support `nestedVirtualization`.
+func CheckNestedVirtualization() error {
+	macOSProductVersion, err := osutil.ProductVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get macOS product version: %w", err)
+	}
+	if macOSProductVersion.LessThan(*semver.New("15.0.0")) {
+		return errors.New("nested virtualization requires macOS 15 or newer")
+	}
+	if !vz.IsNestedVirtualizationSupported() {
+		return errors.New("nested virtualization is not supported on this device")
+	}
+	return nil
+}
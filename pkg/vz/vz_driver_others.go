@@ -38,3 +38,7 @@ func (l *LimaVzDriver) Start(_ context.Context) (chan error, error) {
 func (l *LimaVzDriver) Stop(_ context.Context) error {
 	return ErrUnsupported
 }
+
+func CheckNestedVirtualization() error {
+	return ErrUnsupported
+}
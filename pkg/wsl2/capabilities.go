@@ -0,0 +1,16 @@
+package wsl2
+
+import (
+	"runtime"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// Capabilities returns the capability manifest of the WSL2 driver.
+func Capabilities() limayaml.DriverCapabilities {
+	return limayaml.DriverCapabilities{
+		MountTypes:   []limayaml.MountType{limayaml.WSLMount},
+		Arches:       []limayaml.Arch{limayaml.NewArch(runtime.GOARCH)},
+		DisplayTypes: []string{"none"},
+	}
+}
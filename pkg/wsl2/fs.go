@@ -18,7 +18,7 @@ func EnsureFs(ctx context.Context, driver *driver.BaseDriver) error {
 	if _, err := os.Stat(baseDisk); errors.Is(err, os.ErrNotExist) {
 		var ensuredBaseDisk bool
 		errs := make([]error, len(driver.Instance.Config.Images))
-		for i, f := range driver.Instance.Config.Images {
+		for i, f := range fileutils.ImagesByMirrorScore(driver.Instance.Config.Images) {
 			if _, err := fileutils.DownloadFile(ctx, baseDisk, f.File, true, "the image", *driver.Instance.Config.Arch); err != nil {
 				errs[i] = err
 				continue
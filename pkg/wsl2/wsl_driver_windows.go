@@ -31,10 +31,13 @@ var knownYamlProperties = []string{
 	"MountType",
 	"Param",
 	"Plain",
+	"Podman",
 	"PortForwards",
 	"Probes",
 	"PropagateProxyEnv",
 	"Provision",
+	"RestartPolicy",
+	"Security",
 	"SSH",
 	"VMType",
 }